@@ -1,7 +1,13 @@
 package api
 
 import (
+	"time"
+
+	"github.com/grafana/grafana/pkg/api/dtos"
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
 	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/setting"
 )
 
 func (server *HTTPServer) ReloadLdapCfg() Response {
@@ -15,3 +21,247 @@ func (server *HTTPServer) ReloadLdapCfg() Response {
 	}
 	return Success("Ldap config reloaded")
 }
+
+// GetLdapServers lists the configured LDAP servers with their status and the status of their hosts
+func (server *HTTPServer) GetLdapServers() Response {
+	if !ldap.IsEnabled() {
+		return Error(400, "LDAP is not enabled", nil)
+	}
+
+	config, err := ldap.GetConfig()
+	if err != nil {
+		return Error(500, "Failed to get ldap config", err)
+	}
+
+	result := []*dtos.LdapServerDTO{}
+	for _, serverConfig := range config.Servers {
+		hosts := []*dtos.LdapHostDTO{}
+		for _, status := range ldap.HostStatuses(serverConfig) {
+			hosts = append(hosts, &dtos.LdapHostDTO{
+				Address:            status.Address,
+				LastSuccessfulBind: status.LastSuccessfulBind,
+				LastError:          status.LastError,
+				LastErrorAt:        status.LastErrorAt,
+				ErrorsLast5m:       status.ErrorsLast5m,
+				ErrorsLastHour:     status.ErrorsLastHour,
+			})
+		}
+
+		result = append(result, &dtos.LdapServerDTO{
+			Server:        ldap.ServerKey(serverConfig),
+			Enabled:       serverConfig.Enabled == nil || *serverConfig.Enabled,
+			Maintenance:   ldap.InMaintenance(serverConfig),
+			Hosts:         hosts,
+			MissingGroups: ldap.MissingGroups(serverConfig),
+		})
+	}
+
+	return JSON(200, result)
+}
+
+// SetLdapServerMaintenance puts the LDAP server in maintenance mode or takes it out of it
+func (server *HTTPServer) SetLdapServerMaintenance(c *models.ReqContext, form dtos.LdapServerMaintenanceForm) Response {
+	if !ldap.IsEnabled() {
+		return Error(400, "LDAP is not enabled", nil)
+	}
+
+	config, err := ldap.GetConfig()
+	if err != nil {
+		return Error(500, "Failed to get ldap config", err)
+	}
+
+	for _, serverConfig := range config.Servers {
+		if ldap.ServerKey(serverConfig) == form.Server {
+			ldap.SetMaintenance(form.Server, form.Maintenance)
+
+			if form.Maintenance {
+				return Success("LDAP server put in maintenance mode")
+			}
+			return Success("LDAP server taken out of maintenance mode")
+		}
+	}
+
+	return Error(404, "LDAP server not found", nil)
+}
+
+// GetLdapDiagnostics returns the LDAP diagnostics bundle for support
+func (server *HTTPServer) GetLdapDiagnostics() Response {
+	if !ldap.IsEnabled() {
+		return Error(400, "LDAP is not enabled", nil)
+	}
+
+	diagnostics, err := ldap.Diagnose()
+	if err != nil {
+		return Error(500, "Failed to get ldap diagnostics", err)
+	}
+
+	return JSON(200, diagnostics)
+}
+
+// GetLdapLoginAttempts lists the audited LDAP login attempts, newest first
+func (server *HTTPServer) GetLdapLoginAttempts(c *models.ReqContext) Response {
+	if !ldap.IsEnabled() {
+		return Error(400, "LDAP is not enabled", nil)
+	}
+
+	query := models.SearchLoginAttemptsQuery{
+		AuthModule:  ldap.AuthModule,
+		Username:    c.Query("username"),
+		Server:      c.Query("server"),
+		ResultClass: c.Query("result"),
+		Limit:       c.QueryInt("limit"),
+	}
+	if query.Limit <= 0 {
+		query.Limit = 100
+	}
+	if max := setting.LdapMaxResults; max > 0 && query.Limit > max {
+		query.Limit = max
+	}
+	if from := c.QueryInt64("from"); from > 0 {
+		query.From = time.Unix(0, from*int64(time.Millisecond))
+	}
+	if to := c.QueryInt64("to"); to > 0 {
+		query.To = time.Unix(0, to*int64(time.Millisecond))
+	}
+
+	if err := bus.Dispatch(&query); err != nil {
+		return Error(500, "Failed to search ldap login attempts", err)
+	}
+
+	result := []*dtos.LdapLoginAttemptDTO{}
+	for _, attempt := range query.Result {
+		result = append(result, &dtos.LdapLoginAttemptDTO{
+			Username:  attempt.Username,
+			IpAddress: attempt.IpAddress,
+			Server:    attempt.Server,
+			Result:    attempt.ResultClass,
+			Duration:  attempt.Duration,
+			Created:   time.Unix(attempt.Created, 0),
+		})
+	}
+
+	return JSON(200, result)
+}
+
+// GetLdapConfig returns the LDAP config in use with its secrets redacted, and where it was read from
+func (server *HTTPServer) GetLdapConfig() Response {
+	if !ldap.IsEnabled() {
+		return Error(400, "LDAP is not enabled", nil)
+	}
+
+	config, err := ldap.GetConfig()
+	if err != nil {
+		return Error(500, "Failed to get ldap config", err)
+	}
+
+	text, err := ldap.EncodeConfig(config)
+	if err != nil {
+		return Error(500, "Failed to encode ldap config", err)
+	}
+
+	return JSON(200, &dtos.LdapConfigDTO{
+		Source: ldap.ConfigSource(),
+		Config: text,
+	})
+}
+
+// SaveLdapConfig saves the LDAP config in the database
+func (server *HTTPServer) SaveLdapConfig(c *models.ReqContext, form dtos.LdapConfigForm) Response {
+	if !ldap.IsEnabled() {
+		return Error(400, "LDAP is not enabled", nil)
+	}
+	if !setting.LdapDatabaseConfig {
+		return Error(400, "LDAP database config is not enabled", nil)
+	}
+
+	config, err := ldap.ParseConfig(form.Config)
+	if err != nil {
+		return Error(400, err.Error(), err)
+	}
+
+	if err := ldap.SaveDatabaseConfig(config, c.UserId); err != nil {
+		return Error(500, "Failed to save ldap config", err)
+	}
+
+	return Success("Ldap config saved")
+}
+
+// DeleteLdapConfig deletes the LDAP config saved in the database, so the config file is used again
+func (server *HTTPServer) DeleteLdapConfig() Response {
+	if !ldap.IsEnabled() {
+		return Error(400, "LDAP is not enabled", nil)
+	}
+	if !setting.LdapDatabaseConfig {
+		return Error(400, "LDAP database config is not enabled", nil)
+	}
+
+	if err := ldap.DeleteDatabaseConfig(); err != nil {
+		return Error(500, "Failed to delete ldap config", err)
+	}
+
+	return Success("Ldap config deleted")
+}
+
+// GetLdapLoginState tells if the LDAP logins are turned on
+func (server *HTTPServer) GetLdapLoginState() Response {
+	if !ldap.IsEnabled() {
+		return Error(400, "LDAP is not enabled", nil)
+	}
+
+	return JSON(200, &dtos.LdapLoginStateDTO{Enabled: ldap.IsLoginEnabled()})
+}
+
+// SetLdapLoginState turns the LDAP logins on or off, the users then log in with their Grafana password only
+func (server *HTTPServer) SetLdapLoginState(c *models.ReqContext, form dtos.LdapLoginStateForm) Response {
+	if !ldap.IsEnabled() {
+		return Error(400, "LDAP is not enabled", nil)
+	}
+
+	if err := ldap.SetLoginEnabled(form.Enabled, c.UserId); err != nil {
+		return Error(500, "Failed to save the LDAP login state", err)
+	}
+
+	if form.Enabled {
+		return Success("LDAP logins turned on")
+	}
+	return Success("LDAP logins turned off")
+}
+
+// EnrollLdapSecondFactor generates the TOTP seed of an LDAP user whose
+// groups require a second factor, replacing the one enrolled before
+func (server *HTTPServer) EnrollLdapSecondFactor(c *models.ReqContext) Response {
+	if !ldap.IsEnabled() {
+		return Error(400, "LDAP is not enabled", nil)
+	}
+
+	query := &models.GetUserByIdQuery{Id: c.ParamsInt64(":id")}
+	if err := bus.Dispatch(query); err != nil {
+		if err == models.ErrUserNotFound {
+			return Error(404, "User not found", err)
+		}
+		return Error(500, "Failed to get user", err)
+	}
+
+	seed, err := ldap.EnrollSecondFactor(query.Result.Id)
+	if err != nil {
+		return Error(500, "Failed to enroll the second factor", err)
+	}
+
+	return JSON(200, &dtos.LdapSecondFactorDTO{
+		Secret: seed,
+		URL:    ldap.SecondFactorURL(query.Result.Login, seed),
+	})
+}
+
+// ResetLdapSecondFactor deletes the second factor enrolled for a user
+func (server *HTTPServer) ResetLdapSecondFactor(c *models.ReqContext) Response {
+	if !ldap.IsEnabled() {
+		return Error(400, "LDAP is not enabled", nil)
+	}
+
+	if err := ldap.ResetSecondFactor(c.ParamsInt64(":id")); err != nil {
+		return Error(500, "Failed to reset the second factor", err)
+	}
+
+	return Success("Second factor reset")
+}
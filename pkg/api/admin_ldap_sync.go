@@ -0,0 +1,249 @@
+package api
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/grafana/grafana/pkg/api/dtos"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/services/ldapsync"
+)
+
+// GetLdapSyncStatus returns the running LDAP sync job, or the last one
+func (server *HTTPServer) GetLdapSyncStatus() Response {
+	if !ldap.IsEnabled() {
+		return Error(400, "LDAP is not enabled", nil)
+	}
+
+	job, err := server.LdapSyncService.Status()
+	if err == models.ErrLdapSyncJobNotFound {
+		return Error(404, "No LDAP sync has run", err)
+	}
+	if err != nil {
+		return Error(500, "Failed to get the LDAP sync status", err)
+	}
+
+	return JSON(200, ldapSyncJobDTO(job))
+}
+
+// StartLdapSync starts syncing the Grafana users of the LDAP servers
+func (server *HTTPServer) StartLdapSync(c *models.ReqContext) Response {
+	if !ldap.IsEnabled() {
+		return Error(400, "LDAP is not enabled", nil)
+	}
+
+	job, err := server.LdapSyncService.Start(c.UserId)
+	if err != nil {
+		return ldapSyncError(err, "Failed to start the LDAP sync")
+	}
+
+	return JSON(202, ldapSyncJobDTO(job))
+}
+
+// PauseLdapSync stops the running LDAP sync after its checkpoint
+func (server *HTTPServer) PauseLdapSync() Response {
+	if !ldap.IsEnabled() {
+		return Error(400, "LDAP is not enabled", nil)
+	}
+
+	if err := server.LdapSyncService.Pause(); err != nil {
+		return ldapSyncError(err, "Failed to pause the LDAP sync")
+	}
+
+	return Success("LDAP sync paused")
+}
+
+// ResumeLdapSync resumes the paused LDAP sync after its checkpoint
+func (server *HTTPServer) ResumeLdapSync() Response {
+	if !ldap.IsEnabled() {
+		return Error(400, "LDAP is not enabled", nil)
+	}
+
+	job, err := server.LdapSyncService.Resume()
+	if err != nil {
+		return ldapSyncError(err, "Failed to resume the LDAP sync")
+	}
+
+	return JSON(202, ldapSyncJobDTO(job))
+}
+
+// CancelLdapSync stops the running or paused LDAP sync for good
+func (server *HTTPServer) CancelLdapSync() Response {
+	if !ldap.IsEnabled() {
+		return Error(400, "LDAP is not enabled", nil)
+	}
+
+	if err := server.LdapSyncService.Cancel(); err != nil {
+		return ldapSyncError(err, "Failed to cancel the LDAP sync")
+	}
+
+	return Success("LDAP sync cancelled")
+}
+
+// GetLdapSyncReport returns what the LDAP sync job did to each user, as
+// JSON or as CSV with format=csv, for the archives of the access reviews
+func (server *HTTPServer) GetLdapSyncReport(c *models.ReqContext) Response {
+	if !ldap.IsEnabled() {
+		return Error(400, "LDAP is not enabled", nil)
+	}
+
+	id := c.ParamsInt64(":id")
+	job, entries, err := server.LdapSyncService.Report(id)
+	if err == models.ErrLdapSyncJobNotFound {
+		return Error(404, "LDAP sync not found", err)
+	}
+	if err != nil {
+		return Error(500, "Failed to get the LDAP sync report", err)
+	}
+
+	switch c.Query("format") {
+	case "", "json":
+		report := &dtos.LdapSyncReportDTO{Job: ldapSyncJobDTO(job), Entries: make([]*dtos.LdapSyncReportEntryDTO, 0, len(entries))}
+		for _, entry := range entries {
+			report.Entries = append(report.Entries, &dtos.LdapSyncReportEntryDTO{
+				Dn:     entry.Dn,
+				Login:  entry.Login,
+				Action: entry.Action,
+				Detail: entry.Detail,
+				Error:  entry.Error,
+				Time:   entry.Created,
+			})
+		}
+		return JSON(200, report).
+			Header("Content-Disposition", fmt.Sprintf(`attachment; filename="ldap-sync-%d.json"`, id))
+	case "csv":
+		body, err := ldapSyncReportCSV(entries)
+		if err != nil {
+			return Error(500, "Failed to write the LDAP sync report", err)
+		}
+		return Respond(200, body).
+			Header("Content-Type", "text/csv; charset=utf-8").
+			Header("Content-Disposition", fmt.Sprintf(`attachment; filename="ldap-sync-%d.csv"`, id))
+	}
+
+	return Error(400, "Unknown format, json or csv", nil)
+}
+
+// GetLdapSyncRetries returns the LDAP users queued to be synced again
+// after their sync failed, the ones due first first
+func (server *HTTPServer) GetLdapSyncRetries() Response {
+	if !ldap.IsEnabled() {
+		return Error(400, "LDAP is not enabled", nil)
+	}
+
+	retries, err := server.LdapSyncService.Retries()
+	if err != nil {
+		return Error(500, "Failed to get the LDAP sync retries", err)
+	}
+
+	result := make([]*dtos.LdapSyncRetryDTO, 0, len(retries))
+	for _, retry := range retries {
+		result = append(result, &dtos.LdapSyncRetryDTO{
+			Dn:          retry.Dn,
+			Login:       retry.Login,
+			Server:      retry.Server,
+			Attempts:    retry.Attempts,
+			Error:       retry.Error,
+			NextAttempt: retry.NextAttempt,
+			Created:     retry.Created,
+		})
+	}
+	return JSON(200, result)
+}
+
+// FlushLdapSyncRetries syncs the LDAP users queued for retry now and
+// returns what was done to each of them
+func (server *HTTPServer) FlushLdapSyncRetries() Response {
+	if !ldap.IsEnabled() {
+		return Error(400, "LDAP is not enabled", nil)
+	}
+
+	entries, err := server.LdapSyncService.FlushRetries()
+	if err != nil {
+		return ldapSyncError(err, "Failed to sync the LDAP sync retries")
+	}
+
+	result := make([]*dtos.LdapSyncReportEntryDTO, 0, len(entries))
+	for _, entry := range entries {
+		result = append(result, &dtos.LdapSyncReportEntryDTO{
+			Dn:     entry.Dn,
+			Login:  entry.Login,
+			Action: entry.Action,
+			Detail: entry.Detail,
+			Error:  entry.Error,
+			Time:   time.Now(),
+		})
+	}
+	return JSON(200, result)
+}
+
+// DeleteLdapSyncRetries empties the queue of the LDAP sync retries
+func (server *HTTPServer) DeleteLdapSyncRetries() Response {
+	if !ldap.IsEnabled() {
+		return Error(400, "LDAP is not enabled", nil)
+	}
+
+	deleted, err := server.LdapSyncService.ClearRetries()
+	if err != nil {
+		return Error(500, "Failed to delete the LDAP sync retries", err)
+	}
+
+	return Success(fmt.Sprintf("%d LDAP sync retries deleted", deleted))
+}
+
+// ldapSyncReportCSV writes the entries as CSV, with a header row
+func ldapSyncReportCSV(entries []*models.LdapSyncReportEntry) ([]byte, error) {
+	var buffer bytes.Buffer
+	writer := csv.NewWriter(&buffer)
+
+	if err := writer.Write([]string{"time", "dn", "login", "action", "detail", "error"}); err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		row := []string{entry.Created.UTC().Format(time.RFC3339), entry.Dn, entry.Login, entry.Action, entry.Detail, entry.Error}
+		if err := writer.Write(row); err != nil {
+			return nil, err
+		}
+	}
+
+	writer.Flush()
+	return buffer.Bytes(), writer.Error()
+}
+
+// ldapSyncError answers 409 for the errors of the state of the sync
+func ldapSyncError(err error, message string) Response {
+	switch err {
+	case ldapsync.ErrSyncRunning, ldapsync.ErrSyncNotRunning, ldapsync.ErrSyncPaused, ldapsync.ErrSyncNotPaused:
+		return Error(409, err.Error(), err)
+	}
+	return Error(500, message, err)
+}
+
+func ldapSyncJobDTO(job *models.LdapSyncJob) *dtos.LdapSyncJobDTO {
+	// the percentage of the users processed, the total is 0 until they're listed
+	progress := float64(0)
+	if job.Total > 0 {
+		progress = math.Min(100, float64(job.Synced+job.Skipped+job.Failed)*100/float64(job.Total))
+	} else if job.State == models.LdapSyncCompleted {
+		progress = 100
+	}
+
+	return &dtos.LdapSyncJobDTO{
+		Id:         job.Id,
+		State:      job.State,
+		Checkpoint: job.Checkpoint,
+		Total:      job.Total,
+		Synced:     job.Synced,
+		Skipped:    job.Skipped,
+		Failed:     job.Failed,
+		Progress:   math.Round(progress*10) / 10,
+		Error:      job.Error,
+		Started:    job.Started,
+		Updated:    job.Updated,
+		StartedBy:  job.StartedBy,
+	}
+}
@@ -0,0 +1,33 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/grafana/grafana/pkg/models"
+)
+
+func TestLdapSyncReportCSV(t *testing.T) {
+	Convey("Should write the LDAP sync report as CSV", t, func() {
+		created := time.Date(2019, 7, 1, 12, 0, 0, 0, time.UTC)
+		body, err := ldapSyncReportCSV([]*models.LdapSyncReportEntry{
+			{Dn: "cn=ldap-admin,ou=users,dc=grafana,dc=org", Login: "ldap-admin", Action: models.LdapSyncUpdated, Detail: "org 1: Viewer -> Admin", Created: created},
+			{Dn: "cn=ldap-editor,ou=users,dc=grafana,dc=org", Login: "ldap-editor", Action: models.LdapSyncUserFailed, Error: "LDAP timeout", Created: created},
+		})
+
+		So(err, ShouldBeNil)
+		So(string(body), ShouldEqual, "time,dn,login,action,detail,error\n"+
+			"2019-07-01T12:00:00Z,\"cn=ldap-admin,ou=users,dc=grafana,dc=org\",ldap-admin,updated,org 1: Viewer -> Admin,\n"+
+			"2019-07-01T12:00:00Z,\"cn=ldap-editor,ou=users,dc=grafana,dc=org\",ldap-editor,failed,,LDAP timeout\n")
+	})
+}
+
+func TestLdapSyncJobDTO(t *testing.T) {
+	Convey("Should return the progress of the LDAP sync", t, func() {
+		So(ldapSyncJobDTO(&models.LdapSyncJob{State: models.LdapSyncRunning}).Progress, ShouldEqual, 0)
+		So(ldapSyncJobDTO(&models.LdapSyncJob{State: models.LdapSyncRunning, Total: 3, Synced: 1}).Progress, ShouldEqual, 33.3)
+		So(ldapSyncJobDTO(&models.LdapSyncJob{State: models.LdapSyncCompleted}).Progress, ShouldEqual, 100)
+	})
+}
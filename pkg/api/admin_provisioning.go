@@ -28,3 +28,11 @@ func (server *HTTPServer) AdminProvisioningReloadNotifications(c *models.ReqCont
 	}
 	return Success("Notifications config reloaded")
 }
+
+func (server *HTTPServer) AdminProvisioningReloadLdap(c *models.ReqContext) Response {
+	err := server.ProvisioningService.ProvisionLdap()
+	if err != nil {
+		return Error(500, "", err)
+	}
+	return Success("LDAP config reloaded")
+}
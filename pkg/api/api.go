@@ -18,6 +18,7 @@ func (hs *HTTPServer) registerRoutes() {
 	redirectFromLegacyDashboardURL := middleware.RedirectFromLegacyDashboardURL()
 	redirectFromLegacyDashboardSoloURL := middleware.RedirectFromLegacyDashboardSoloURL()
 	quota := middleware.Quota(hs.QuotaService)
+	ldapRateLimit := middleware.LdapRateLimit
 	bind := binding.Bind
 
 	r := hs.RouteRegister
@@ -26,6 +27,7 @@ func (hs *HTTPServer) registerRoutes() {
 	r.Get("/", reqSignedIn, hs.Index)
 	r.Get("/logout", hs.Logout)
 	r.Post("/login", quota("session"), bind(dtos.LoginCommand{}), Wrap(hs.LoginPost))
+	r.Get("/login/pending/:id", quota("session"), Wrap(hs.LoginPending))
 	r.Get("/login/:name", quota("session"), hs.OAuthLogin)
 	r.Get("/login", hs.LoginView)
 	r.Get("/invite/:code", hs.Index)
@@ -139,6 +141,9 @@ func (hs *HTTPServer) registerRoutes() {
 
 			userRoute.Get("/auth-tokens", Wrap(hs.GetUserAuthTokens))
 			userRoute.Post("/revoke-auth-token", bind(m.RevokeAuthTokenCmd{}), Wrap(hs.RevokeUserAuthToken))
+
+			userRoute.Post("/ldap/impersonation/:id", Wrap(hs.StartLdapImpersonation))
+			userRoute.Delete("/ldap/impersonation", Wrap(hs.EndLdapImpersonation))
 		})
 
 		// users (admin permission required)
@@ -374,6 +379,15 @@ func (hs *HTTPServer) registerRoutes() {
 
 	}, reqSignedIn)
 
+	// SCIM api of the LDAP users
+	r.Group("/api/scim/v2", func(scimRoute routing.RouteRegister) {
+		scimRoute.Get("/ServiceProviderConfig", Wrap(hs.GetSCIMServiceProviderConfig))
+		scimRoute.Get("/Users", Wrap(hs.GetSCIMUsers))
+		scimRoute.Get("/Users/:id", Wrap(hs.GetSCIMUser))
+		scimRoute.Get("/Groups", Wrap(hs.GetSCIMGroups))
+		scimRoute.Get("/Groups/:id", Wrap(hs.GetSCIMGroup))
+	}, reqGrafanaAdmin, ldapRateLimit("scim"))
+
 	// admin api
 	r.Group("/api/admin", func(adminRoute routing.RouteRegister) {
 		adminRoute.Get("/settings", AdminGetSettings)
@@ -393,7 +407,28 @@ func (hs *HTTPServer) registerRoutes() {
 		adminRoute.Post("/provisioning/dashboards/reload", Wrap(hs.AdminProvisioningReloadDasboards))
 		adminRoute.Post("/provisioning/datasources/reload", Wrap(hs.AdminProvisioningReloadDatasources))
 		adminRoute.Post("/provisioning/notifications/reload", Wrap(hs.AdminProvisioningReloadNotifications))
+		adminRoute.Post("/provisioning/ldap/reload", Wrap(hs.AdminProvisioningReloadLdap))
 		adminRoute.Post("/ldap/reload", Wrap(hs.ReloadLdapCfg))
+		adminRoute.Get("/ldap/servers", ldapRateLimit("servers"), Wrap(hs.GetLdapServers))
+		adminRoute.Put("/ldap/servers/maintenance", bind(dtos.LdapServerMaintenanceForm{}), Wrap(hs.SetLdapServerMaintenance))
+		adminRoute.Get("/ldap/diagnostics", ldapRateLimit("diagnostics"), Wrap(hs.GetLdapDiagnostics))
+		adminRoute.Get("/ldap/login-attempts", ldapRateLimit("login_attempts"), Wrap(hs.GetLdapLoginAttempts))
+		adminRoute.Get("/ldap/config", ldapRateLimit("config"), Wrap(hs.GetLdapConfig))
+		adminRoute.Put("/ldap/config", bind(dtos.LdapConfigForm{}), Wrap(hs.SaveLdapConfig))
+		adminRoute.Delete("/ldap/config", Wrap(hs.DeleteLdapConfig))
+		adminRoute.Get("/ldap/login", Wrap(hs.GetLdapLoginState))
+		adminRoute.Put("/ldap/login", bind(dtos.LdapLoginStateForm{}), Wrap(hs.SetLdapLoginState))
+		adminRoute.Get("/ldap/sync", Wrap(hs.GetLdapSyncStatus))
+		adminRoute.Post("/ldap/sync", Wrap(hs.StartLdapSync))
+		adminRoute.Post("/ldap/sync/pause", Wrap(hs.PauseLdapSync))
+		adminRoute.Post("/ldap/sync/resume", Wrap(hs.ResumeLdapSync))
+		adminRoute.Post("/ldap/sync/cancel", Wrap(hs.CancelLdapSync))
+		adminRoute.Get("/ldap/sync/:id/report", ldapRateLimit("sync_report"), Wrap(hs.GetLdapSyncReport))
+		adminRoute.Get("/ldap/sync/retries", Wrap(hs.GetLdapSyncRetries))
+		adminRoute.Post("/ldap/sync/retries/flush", Wrap(hs.FlushLdapSyncRetries))
+		adminRoute.Delete("/ldap/sync/retries", Wrap(hs.DeleteLdapSyncRetries))
+		adminRoute.Post("/users/:id/ldap/second-factor", Wrap(hs.EnrollLdapSecondFactor))
+		adminRoute.Delete("/users/:id/ldap/second-factor", Wrap(hs.ResetLdapSecondFactor))
 	}, reqGrafanaAdmin)
 
 	// rendering
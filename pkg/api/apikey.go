@@ -5,6 +5,7 @@ import (
 	"github.com/grafana/grafana/pkg/bus"
 	"github.com/grafana/grafana/pkg/components/apikeygen"
 	m "github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
 )
 
 func GetAPIKeys(c *m.ReqContext) Response {
@@ -44,7 +45,14 @@ func AddAPIKey(c *m.ReqContext, cmd m.AddApiKeyCommand) Response {
 		return Error(400, "Invalid role specified", nil)
 	}
 
+	if ldap.IsApiKeyGatingEnabled() {
+		if response := checkApiKeyGroups(c); response != nil {
+			return response
+		}
+	}
+
 	cmd.OrgId = c.OrgId
+	cmd.CreatedBy = c.UserId
 
 	newKeyInfo := apikeygen.New(cmd.OrgId, cmd.Name)
 	cmd.Key = newKeyInfo.HashedKey
@@ -59,3 +67,41 @@ func AddAPIKey(c *m.ReqContext, cmd m.AddApiKeyCommand) Response {
 
 	return JSON(200, result)
 }
+
+// checkApiKeyGroups only lets the members of the LDAP api_key_groups
+// create API keys, the membership is looked up in the directory. The
+// users without an LDAP entry of their own, like the local users, may
+// only create them if they're protected
+func checkApiKeyGroups(c *m.ReqContext) Response {
+	config, err := getLdapConfig()
+	if err != nil {
+		return Error(500, "Failed to get LDAP config", err)
+	}
+
+	user, err := newMultiLDAP(config.Servers).User(c.Login)
+	if err != nil && err != ldap.ErrInvalidCredentials {
+		return Error(500, "Failed to look the user up in LDAP", err)
+	}
+	if err == nil {
+		linked, err := ldap.IsLinkedUser(c.UserId, user)
+		if err != nil {
+			return Error(500, "Failed to get the LDAP auth info of the user", err)
+		}
+		if !linked {
+			// the entry of the same login belongs to another user
+			user = nil
+		}
+	}
+
+	if user == nil {
+		if !ldap.IsProtectedUser(&ldap.UserInfo{Username: c.Login}) {
+			return Error(403, "Only the LDAP users of the API key groups can create API keys", nil)
+		}
+		return nil
+	}
+	if !ldap.MayHoldApiKeys(user) {
+		return Error(403, "Only the members of the LDAP API key groups can create API keys", nil)
+	}
+
+	return nil
+}
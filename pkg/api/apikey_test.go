@@ -0,0 +1,88 @@
+package api
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/grafana/grafana/pkg/bus"
+	m "github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/services/multildap"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+type mockMultiLDAP struct {
+	multildap.IMultiLDAP
+
+	users map[string]*ldap.UserInfo
+}
+
+func (mock *mockMultiLDAP) User(username string) (*ldap.UserInfo, error) {
+	user, ok := mock.users[username]
+	if !ok {
+		return nil, ldap.ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+func TestApiKeyGroups(t *testing.T) {
+	Convey("checkApiKeyGroups", t, func() {
+		defer func(groups, protected []string) {
+			setting.LdapApiKeyGroups, setting.LdapSyncProtectedUsers = groups, protected
+			newMultiLDAP, getLdapConfig = multildap.New, ldap.GetConfig
+			bus.ClearBusHandlers()
+		}(setting.LdapApiKeyGroups, setting.LdapSyncProtectedUsers)
+		setting.LdapApiKeyGroups = []string{"cn=automation,dc=grafana,dc=org"}
+		setting.LdapSyncProtectedUsers = nil
+
+		getLdapConfig = func() (*ldap.Config, error) { return &ldap.Config{}, nil }
+		newMultiLDAP = func(configs []*ldap.ServerConfig) multildap.IMultiLDAP {
+			return &mockMultiLDAP{users: map[string]*ldap.UserInfo{
+				"roel":   {DN: "cn=roel,dc=grafana,dc=org", Username: "roel", MemberOf: []string{"cn=automation,dc=grafana,dc=org"}},
+				"torkel": {DN: "cn=torkel,dc=grafana,dc=org", Username: "torkel"},
+			}}
+		}
+
+		// the DNs the Grafana users are linked to by id
+		dns := map[int64]string{1: "cn=roel,dc=grafana,dc=org", 2: "cn=torkel,dc=grafana,dc=org"}
+		bus.AddHandler("test", func(query *m.GetAuthInfoQuery) error {
+			dn, ok := dns[query.UserId]
+			if !ok || query.AuthModule != ldap.AuthModule {
+				return m.ErrUserNotFound
+			}
+			query.Result = &m.UserAuth{UserId: query.UserId, AuthModule: ldap.AuthModule, AuthId: dn}
+			return nil
+		})
+
+		check := func(userId int64, login string) int {
+			c := &m.ReqContext{SignedInUser: &m.SignedInUser{UserId: userId, Login: login}}
+			response := checkApiKeyGroups(c)
+			if response == nil {
+				return 200
+			}
+			return response.(*NormalResponse).status
+		}
+
+		Convey("Should let the members of the groups create API keys", func() {
+			So(check(1, "roel"), ShouldEqual, 200)
+		})
+
+		Convey("Should refuse the other LDAP users", func() {
+			So(check(2, "torkel"), ShouldEqual, 403)
+		})
+
+		Convey("Should refuse the local users having the login of a member", func() {
+			So(check(3, "roel"), ShouldEqual, 403)
+		})
+
+		Convey("Should refuse the users missing from LDAP", func() {
+			So(check(4, "admin"), ShouldEqual, 403)
+		})
+
+		Convey("Should let the protected users without an LDAP entry create API keys", func() {
+			setting.LdapSyncProtectedUsers = []string{"admin"}
+			So(check(4, "admin"), ShouldEqual, 200)
+		})
+	})
+}
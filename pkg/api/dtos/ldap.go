@@ -0,0 +1,95 @@
+package dtos
+
+import "time"
+
+type LdapServerDTO struct {
+	Server        string         `json:"server"`
+	Enabled       bool           `json:"enabled"`
+	Maintenance   bool           `json:"maintenance"`
+	Hosts         []*LdapHostDTO `json:"hosts"`
+	MissingGroups []string       `json:"missingGroups"`
+}
+
+type LdapHostDTO struct {
+	Address            string    `json:"address"`
+	LastSuccessfulBind time.Time `json:"lastSuccessfulBind"`
+	LastError          string    `json:"lastError"`
+	LastErrorAt        time.Time `json:"lastErrorAt"`
+	ErrorsLast5m       int       `json:"errorsLast5m"`
+	ErrorsLastHour     int       `json:"errorsLastHour"`
+}
+
+type LdapServerMaintenanceForm struct {
+	Server      string `json:"server" binding:"Required"`
+	Maintenance bool   `json:"maintenance"`
+}
+
+type LdapLoginAttemptDTO struct {
+	Username  string    `json:"username"`
+	IpAddress string    `json:"ipAddress"`
+	Server    string    `json:"server"`
+	Result    string    `json:"result"`
+	Duration  int64     `json:"durationMs"`
+	Created   time.Time `json:"created"`
+}
+
+type LdapConfigDTO struct {
+	Source string `json:"source"`
+	Config string `json:"config"`
+}
+
+type LdapConfigForm struct {
+	Config string `json:"config" binding:"Required"`
+}
+
+type LdapLoginStateDTO struct {
+	Enabled bool `json:"enabled"`
+}
+
+type LdapLoginStateForm struct {
+	Enabled bool `json:"enabled"`
+}
+
+type LdapSecondFactorDTO struct {
+	Secret string `json:"secret"`
+	URL    string `json:"url"`
+}
+
+type LdapSyncJobDTO struct {
+	Id         int64     `json:"id"`
+	State      string    `json:"state"`
+	Checkpoint string    `json:"checkpoint"`
+	Total      int64     `json:"total"`
+	Synced     int64     `json:"synced"`
+	Skipped    int64     `json:"skipped"`
+	Failed     int64     `json:"failed"`
+	Progress   float64   `json:"progress"`
+	Error      string    `json:"error,omitempty"`
+	Started    time.Time `json:"started"`
+	Updated    time.Time `json:"updated"`
+	StartedBy  int64     `json:"startedBy"`
+}
+
+type LdapSyncReportEntryDTO struct {
+	Dn     string    `json:"dn"`
+	Login  string    `json:"login"`
+	Action string    `json:"action"`
+	Detail string    `json:"detail,omitempty"`
+	Error  string    `json:"error,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+type LdapSyncRetryDTO struct {
+	Dn          string    `json:"dn"`
+	Login       string    `json:"login"`
+	Server      string    `json:"server"`
+	Attempts    int       `json:"attempts"`
+	Error       string    `json:"error"`
+	NextAttempt time.Time `json:"nextAttempt"`
+	Created     time.Time `json:"created"`
+}
+
+type LdapSyncReportDTO struct {
+	Job     *LdapSyncJobDTO           `json:"job"`
+	Entries []*LdapSyncReportEntryDTO `json:"entries"`
+}
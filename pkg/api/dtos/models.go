@@ -19,6 +19,8 @@ type LoginCommand struct {
 	User     string `json:"user" binding:"Required"`
 	Password string `json:"password" binding:"Required"`
 	Remember bool   `json:"remember"`
+
+	SecondFactorCode string `json:"secondFactorCode"`
 }
 
 type CurrentUser struct {
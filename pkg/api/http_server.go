@@ -25,8 +25,10 @@ import (
 	"github.com/grafana/grafana/pkg/services/cache"
 	"github.com/grafana/grafana/pkg/services/datasources"
 	"github.com/grafana/grafana/pkg/services/hooks"
+	"github.com/grafana/grafana/pkg/services/ldapsync"
 	"github.com/grafana/grafana/pkg/services/quota"
 	"github.com/grafana/grafana/pkg/services/rendering"
+	"github.com/grafana/grafana/pkg/services/scim"
 	"github.com/grafana/grafana/pkg/setting"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -45,6 +47,7 @@ type ProvisioningService interface {
 	ProvisionDatasources() error
 	ProvisionNotifications() error
 	ProvisionDashboards() error
+	ProvisionLdap() error
 	GetDashboardProvisionerResolvedPath(name string) string
 }
 
@@ -66,6 +69,8 @@ type HTTPServer struct {
 	QuotaService        *quota.QuotaService      `inject:""`
 	RemoteCacheService  *remotecache.RemoteCache `inject:""`
 	ProvisioningService ProvisioningService      `inject:""`
+	SCIMService         *scim.SCIMService        `inject:""`
+	LdapSyncService     *ldapsync.SyncService    `inject:""`
 }
 
 func (hs *HTTPServer) Init() error {
@@ -278,15 +283,23 @@ func (hs *HTTPServer) healthHandler(ctx *macaron.Context) {
 	data.Set("version", setting.BuildVersion)
 	data.Set("commit", setting.BuildCommit)
 
+	status := 200
 	if err := bus.Dispatch(&models.GetDBHealthQuery{}); err != nil {
 		data.Set("database", "failing")
-		ctx.Resp.Header().Set("Content-Type", "application/json; charset=UTF-8")
-		ctx.Resp.WriteHeader(503)
-	} else {
-		ctx.Resp.Header().Set("Content-Type", "application/json; charset=UTF-8")
-		ctx.Resp.WriteHeader(200)
+		status = 503
 	}
 
+	if setting.LdapEnabled && setting.LdapHealthCheck {
+		data.Set("ldap", "ok")
+		if err := bus.Dispatch(&models.GetLDAPHealthQuery{}); err != nil {
+			data.Set("ldap", "failing")
+			status = 503
+		}
+	}
+
+	ctx.Resp.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	ctx.Resp.WriteHeader(status)
+
 	dataBytes, _ := data.EncodePretty()
 	ctx.Resp.Write(dataBytes)
 }
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/middleware"
+	m "github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/services/multildap"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+var newMultiLDAP = multildap.New
+var getLdapConfig = ldap.GetConfig
+
+// StartLdapImpersonation lets a member of the LDAP impersonation group act as
+// another user for troubleshooting, until it ends or impersonation_duration passed.
+// POST /api/user/ldap/impersonation/:id
+func (hs *HTTPServer) StartLdapImpersonation(c *m.ReqContext) Response {
+	if !ldap.IsImpersonationEnabled() {
+		return Error(404, "LDAP impersonation is not enabled", nil)
+	}
+	if c.Impersonation != nil {
+		return Error(400, "End the current impersonation first", nil)
+	}
+	if c.UserToken == nil {
+		return Error(400, "Impersonation needs a login session", nil)
+	}
+
+	userID := c.ParamsInt64(":id")
+	if userID == c.UserId {
+		return Error(400, "You cannot impersonate yourself", nil)
+	}
+
+	config, err := getLdapConfig()
+	if err != nil {
+		return Error(500, "Failed to get LDAP config", err)
+	}
+
+	impersonator, err := newMultiLDAP(config.Servers).User(c.Login)
+	if err != nil && err != ldap.ErrInvalidCredentials {
+		return Error(500, "Failed to look the user up in LDAP", err)
+	}
+	if err == ldap.ErrInvalidCredentials || !ldap.IsImpersonator(impersonator) {
+		hs.log.Warn("Refused an LDAP impersonation", "impersonator", c.Login, "userId", userID)
+		return Error(403, "Only the members of the LDAP impersonation group can impersonate users", nil)
+	}
+
+	// the LDAP user of the same login may not be the signed in user,
+	// like for a local user
+	linked, err := ldap.IsLinkedUser(c.UserId, impersonator)
+	if err != nil {
+		return Error(500, "Failed to get the LDAP auth info of the user", err)
+	}
+	if !linked {
+		hs.log.Warn("Refused an LDAP impersonation, the user isn't linked to the LDAP user of its login",
+			"impersonator", c.Login, "dn", impersonator.DN, "userId", userID)
+		return Error(403, "Only the members of the LDAP impersonation group can impersonate users", nil)
+	}
+
+	query := m.GetUserByIdQuery{Id: userID}
+	if err := bus.Dispatch(&query); err != nil {
+		if err == m.ErrUserNotFound {
+			return Error(404, "User not found", err)
+		}
+		return Error(500, "Failed to get user", err)
+	}
+	if query.Result.IsAdmin && !c.IsGrafanaAdmin {
+		return Error(403, "Only the Grafana admins can impersonate the Grafana admins", nil)
+	}
+
+	started := time.Now()
+	impersonation := &m.LdapImpersonation{
+		ImpersonatorId:    c.UserId,
+		ImpersonatorLogin: c.Login,
+		UserId:            query.Result.Id,
+		UserLogin:         query.Result.Login,
+		TokenId:           c.UserToken.Id,
+		Started:           started,
+		Expires:           started.Add(setting.LdapImpersonationDuration),
+	}
+	if err := middleware.StartImpersonation(hs.RemoteCacheService, c, impersonation); err != nil {
+		return Error(500, "Failed to start the impersonation", err)
+	}
+
+	return Success("Impersonation started")
+}
+
+// EndLdapImpersonation switches back to the impersonator.
+// DELETE /api/user/ldap/impersonation
+func (hs *HTTPServer) EndLdapImpersonation(c *m.ReqContext) Response {
+	if err := middleware.EndImpersonation(hs.RemoteCacheService, c); err != nil {
+		return Error(500, "Failed to end the impersonation", err)
+	}
+
+	return Success("Impersonation ended")
+}
@@ -5,13 +5,15 @@ import (
 	"net/http"
 	"net/url"
 
+	"golang.org/x/xerrors"
+
 	"github.com/grafana/grafana/pkg/api/dtos"
-	"github.com/grafana/grafana/pkg/bus"
 	"github.com/grafana/grafana/pkg/infra/log"
 	"github.com/grafana/grafana/pkg/infra/metrics"
 	"github.com/grafana/grafana/pkg/login"
 	"github.com/grafana/grafana/pkg/middleware"
 	m "github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
 	"github.com/grafana/grafana/pkg/setting"
 	"github.com/grafana/grafana/pkg/util"
 )
@@ -98,24 +100,38 @@ func (hs *HTTPServer) LoginPost(c *m.ReqContext, cmd dtos.LoginCommand) Response
 		Username:   cmd.User,
 		Password:   cmd.Password,
 		IpAddress:  c.Req.RemoteAddr,
-	}
 
-	if err := bus.Dispatch(authQuery); err != nil {
-		if err == login.ErrInvalidCredentials || err == login.ErrTooManyLoginAttempts {
-			return Error(401, "Invalid username or password", err)
-		}
+		SecondFactorCode: cmd.SecondFactorCode,
+	}
 
-		return Error(500, "Error while trying to authenticate user", err)
+	pending, err := dispatchLogin(c, authQuery)
+	if err != nil {
+		return loginErrorResponse(err)
+	}
+	if pending != "" {
+		return pendingLoginResponse(pending)
 	}
 
-	user := authQuery.User
+	return hs.loginSucceeded(c, authQuery)
+}
 
-	hs.loginUserWithUser(user, c)
+// loginSucceeded logs the user of the login query in
+func (hs *HTTPServer) loginSucceeded(c *m.ReqContext, authQuery *m.LoginUserQuery) Response {
+	hs.loginUserWithUser(authQuery.User, c)
 
 	result := map[string]interface{}{
 		"message": "Logged in",
 	}
 
+	if warning := authQuery.PasswordPolicy; warning != nil {
+		if warning.ExpiresIn > 0 {
+			result["passwordExpiresIn"] = int64(warning.ExpiresIn.Seconds())
+		}
+		if warning.GraceLogins >= 0 {
+			result["graceLoginsRemaining"] = warning.GraceLogins
+		}
+	}
+
 	if redirectTo, _ := url.QueryUnescape(c.GetCookie("redirect_to")); len(redirectTo) > 0 {
 		result["redirectUrl"] = redirectTo
 		c.SetCookie("redirect_to", "", -1, setting.AppSubUrl+"/")
@@ -126,6 +142,63 @@ func (hs *HTTPServer) LoginPost(c *m.ReqContext, cmd dtos.LoginCommand) Response
 	return JSON(200, result)
 }
 
+// loginErrorResponse answers the failed login with a message and the code
+// of the error, the result class of the LDAP login attempts, so the login
+// form can tell a refused account from an unavailable directory. With
+// generic_login_errors the refused accounts get the answer of the invalid
+// credentials, and the messages are replaced by the login_error_messages
+func loginErrorResponse(err error) Response {
+	code := ldap.ResultClass(err)
+	var status int
+	var message string
+
+	switch {
+	case err == login.ErrInvalidCredentials || err == ldap.ErrInvalidCredentials || err == login.ErrTooManyLoginAttempts:
+		status, code, message = 401, "invalid_credentials", "Invalid username or password"
+	case err == ldap.ErrSecondFactorRequired:
+		status, message = 401, "A second factor is required"
+	case err == ldap.ErrInvalidSecondFactor:
+		status, message = 401, "Invalid second factor code"
+	case err == ldap.ErrSecondFactorNotEnrolled:
+		status, message = 403, "No second factor is enrolled, ask your Grafana administrator"
+	case err == ldap.ErrOutsideLogonHours || err == ldap.ErrAccountExpired ||
+		err == ldap.ErrPasswordExpired || err == ldap.ErrAccountLocked || err == ldap.ErrPasswordMustChange ||
+		err == ldap.ErrHBACDenied || err == m.ErrLdapUserDisabled || err == ldap.ErrServiceAccountInteractiveLogin ||
+		err == ldap.ErrEmailDomainNotAllowed || err == ldap.ErrLoginCollision:
+		status, message = 403, err.Error()
+		if setting.LdapGenericLoginErrors {
+			status, code, message = 401, "invalid_credentials", "Invalid username or password"
+		}
+	case err == ErrTooManyPendingLogins:
+		status, code, message = 429, "too_many_pending_logins", err.Error()
+	case xerrors.Is(err, ldap.ErrServerUnavailable) || xerrors.Is(err, ldap.ErrTimeout):
+		status, message = 503, "Login provider is unavailable, please try again later"
+	default:
+		status, code, message = 500, "error", "Error while trying to authenticate user"
+	}
+
+	if custom, ok := setting.LdapLoginErrorMessages[code]; ok {
+		message = custom
+	}
+
+	data := map[string]interface{}{
+		"message": message,
+		"code":    code,
+	}
+	if err == ldap.ErrSecondFactorRequired {
+		data["secondFactorRequired"] = true
+		return JSON(status, data)
+	}
+	if setting.Env != setting.PROD {
+		data["error"] = err.Error()
+	}
+
+	resp := JSON(status, data)
+	resp.errMessage = message
+	resp.err = err
+	return resp
+}
+
 func (hs *HTTPServer) loginUserWithUser(user *m.User, c *m.ReqContext) {
 	if user == nil {
 		hs.log.Error("user login with nil user")
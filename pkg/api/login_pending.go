@@ -0,0 +1,196 @@
+package api
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	m "github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/grafana/grafana/pkg/util"
+)
+
+// pendingLoginPollTimeout is how long a poll of a pending login waits for
+// the login to complete before answering it's still pending
+var pendingLoginPollTimeout = 20 * time.Second
+
+// pendingLoginTTL is how long a pending login waits to be polled, the
+// logins the client never polls are forgotten after it
+var pendingLoginTTL = 5 * time.Minute
+
+// maxPendingLogins caps the logins running or pending in the background,
+// and maxPendingLoginsPerClient the ones of a username or of a remote address
+var maxPendingLogins = 1000
+var maxPendingLoginsPerClient = 5
+
+// ErrTooManyPendingLogins is the error of the logins past the caps of the
+// pending logins, they're refused rather than left running
+var ErrTooManyPendingLogins = errors.New("Too many logins are being verified, please try again later")
+
+// pendingLogin is a login which didn't complete before the login_deadline,
+// it's completed by the next poll of the client it came from
+type pendingLogin struct {
+	remoteAddr string
+	query      *m.LoginUserQuery
+	err        error
+	done       chan struct{}
+}
+
+// pendingLogins holds the pending logins by id, and pendingLoginCounts the
+// number of logins running or pending by username and remote address
+var pendingLogins = map[string]*pendingLogin{}
+var pendingLoginCounts = map[string]int{}
+var pendingLoginsTotal = 0
+var pendingLoginsMutex = &sync.Mutex{}
+
+// pendingLoginKeys are the keys of the login in pendingLoginCounts
+func pendingLoginKeys(pending *pendingLogin) []string {
+	return []string{"user:" + strings.ToLower(pending.query.Username), "addr:" + pending.remoteAddr}
+}
+
+// reservePendingLogin counts the login before it starts, unless it's past
+// one of the caps
+func reservePendingLogin(pending *pendingLogin) bool {
+	pendingLoginsMutex.Lock()
+	defer pendingLoginsMutex.Unlock()
+
+	keys := pendingLoginKeys(pending)
+	if pendingLoginsTotal >= maxPendingLogins {
+		return false
+	}
+	for _, key := range keys {
+		if pendingLoginCounts[key] >= maxPendingLoginsPerClient {
+			return false
+		}
+	}
+
+	pendingLoginsTotal++
+	for _, key := range keys {
+		pendingLoginCounts[key]++
+	}
+	return true
+}
+
+// releasePendingLogin uncounts the login, the caller holds pendingLoginsMutex
+func releasePendingLogin(pending *pendingLogin) {
+	pendingLoginsTotal--
+	for _, key := range pendingLoginKeys(pending) {
+		if pendingLoginCounts[key]--; pendingLoginCounts[key] <= 0 {
+			delete(pendingLoginCounts, key)
+		}
+	}
+}
+
+// forgetPendingLogin drops the pending login and returns it, or nil when it
+// was already dropped
+func forgetPendingLogin(id string) *pendingLogin {
+	pendingLoginsMutex.Lock()
+	defer pendingLoginsMutex.Unlock()
+
+	pending, ok := pendingLogins[id]
+	if !ok {
+		return nil
+	}
+	delete(pendingLogins, id)
+	releasePendingLogin(pending)
+	return pending
+}
+
+// dispatchLogin dispatches the login query. With login_deadline and the
+// LDAP authentication enabled, a login taking longer than the deadline
+// keeps running in the background and its pending login is returned. The
+// logins past the caps of the pending logins are refused
+func dispatchLogin(c *m.ReqContext, query *m.LoginUserQuery) (string, error) {
+	if !setting.LdapEnabled || setting.LdapLoginDeadline <= 0 {
+		return "", bus.Dispatch(query)
+	}
+
+	pending := &pendingLogin{remoteAddr: c.RemoteAddr(), query: detachedQuery(query), done: make(chan struct{})}
+	if !reservePendingLogin(pending) {
+		return "", ErrTooManyPendingLogins
+	}
+	go func() {
+		pending.err = bus.Dispatch(pending.query)
+		close(pending.done)
+	}()
+
+	timer := time.NewTimer(setting.LdapLoginDeadline)
+	defer timer.Stop()
+
+	select {
+	case <-pending.done:
+		pendingLoginsMutex.Lock()
+		releasePendingLogin(pending)
+		pendingLoginsMutex.Unlock()
+
+		query.User = pending.query.User
+		query.PasswordPolicy = pending.query.PasswordPolicy
+		return "", pending.err
+	case <-timer.C:
+	}
+
+	id := util.GetRandomString(32)
+
+	pendingLoginsMutex.Lock()
+	pendingLogins[id] = pending
+	pendingLoginsMutex.Unlock()
+
+	time.AfterFunc(pendingLoginTTL, func() {
+		forgetPendingLogin(id)
+	})
+
+	return id, nil
+}
+
+// detachedQuery copies the login query without the context of its request,
+// the login may keep running after the request was answered
+func detachedQuery(query *m.LoginUserQuery) *m.LoginUserQuery {
+	detached := *query
+	detached.ReqContext = nil
+	return &detached
+}
+
+// pendingLoginResponse answers that the login is still being verified,
+// the client polls the pending login to complete it
+func pendingLoginResponse(id string) Response {
+	return JSON(202, map[string]interface{}{
+		"message":      "Still verifying your account, please wait",
+		"code":         "still_verifying",
+		"pendingLogin": id,
+	})
+}
+
+// LoginPending waits for the pending login to complete, then logs the user
+// in like LoginPost. The pending login can only be completed once and by
+// the client it came from
+func (hs *HTTPServer) LoginPending(c *m.ReqContext) Response {
+	id := c.Params(":id")
+
+	pendingLoginsMutex.Lock()
+	pending, ok := pendingLogins[id]
+	pendingLoginsMutex.Unlock()
+	if !ok || pending.remoteAddr != c.RemoteAddr() {
+		return Error(404, "Login not found, please log in again", nil)
+	}
+
+	timer := time.NewTimer(pendingLoginPollTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-pending.done:
+	case <-timer.C:
+		return pendingLoginResponse(id)
+	}
+
+	if forgetPendingLogin(id) == nil {
+		// completed by a concurrent poll
+		return Error(404, "Login not found, please log in again", nil)
+	}
+
+	if pending.err != nil {
+		return loginErrorResponse(pending.err)
+	}
+	return hs.loginSucceeded(c, pending.query)
+}
@@ -0,0 +1,161 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/macaron.v1"
+
+	"github.com/grafana/grafana/pkg/bus"
+	m "github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/auth"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+func TestPendingLogins(t *testing.T) {
+	Convey("Logins past the login_deadline", t, func() {
+		defer func(enabled bool, deadline, poll, ttl time.Duration, cookie string, max, perClient int) {
+			setting.LdapEnabled, setting.LdapLoginDeadline, pendingLoginPollTimeout = enabled, deadline, poll
+			pendingLoginTTL = ttl
+			setting.LoginCookieName = cookie
+			maxPendingLogins, maxPendingLoginsPerClient = max, perClient
+			pendingLogins, pendingLoginCounts, pendingLoginsTotal = map[string]*pendingLogin{}, map[string]int{}, 0
+		}(setting.LdapEnabled, setting.LdapLoginDeadline, pendingLoginPollTimeout, pendingLoginTTL, setting.LoginCookieName,
+			maxPendingLogins, maxPendingLoginsPerClient)
+		setting.LoginCookieName = "grafana_session"
+		setting.LdapEnabled = true
+		setting.LdapLoginDeadline = 10 * time.Millisecond
+		pendingLoginPollTimeout = 10 * time.Millisecond
+
+		release := make(chan struct{})
+		defer close(release)
+		dispatched := make(chan *m.LoginUserQuery, 10)
+		bus.AddHandler("test", func(query *m.LoginUserQuery) error {
+			dispatched <- query
+			switch query.Username {
+			case "locked":
+				return ldap.ErrAccountLocked
+			case "fast":
+				query.User = &m.User{Id: 2, Login: query.Username}
+				return nil
+			}
+			<-release
+			query.User = &m.User{Id: 1, Login: query.Username}
+			return nil
+		})
+		defer bus.ClearBusHandlers()
+
+		req, _ := http.NewRequest("POST", "/login", nil)
+		c := &m.ReqContext{Context: &macaron.Context{Req: macaron.Request{Request: req}}}
+
+		Convey("Should answer the logins completing before the deadline", func() {
+			pending, err := dispatchLogin(c, &m.LoginUserQuery{Username: "locked"})
+			So(pending, ShouldBeEmpty)
+			So(err, ShouldEqual, ldap.ErrAccountLocked)
+		})
+
+		Convey("Should give the logins completing before the deadline their user", func() {
+			query := &m.LoginUserQuery{ReqContext: c, Username: "fast"}
+			pending, err := dispatchLogin(c, query)
+			So(pending, ShouldBeEmpty)
+			So(err, ShouldBeNil)
+			So(query.User.Login, ShouldEqual, "fast")
+		})
+
+		Convey("Should not give the request context to the logins running in the background", func() {
+			_, err := dispatchLogin(c, &m.LoginUserQuery{ReqContext: c, Username: "roel"})
+			So(err, ShouldBeNil)
+			So((<-dispatched).ReqContext, ShouldBeNil)
+		})
+
+		Convey("Should forget the pending logins which are never polled", func() {
+			pendingLoginTTL = 10 * time.Millisecond
+
+			pending, err := dispatchLogin(c, &m.LoginUserQuery{Username: "roel"})
+			So(err, ShouldBeNil)
+			So(pending, ShouldNotBeEmpty)
+
+			time.Sleep(50 * time.Millisecond)
+			pendingLoginsMutex.Lock()
+			_, ok := pendingLogins[pending]
+			pendingLoginsMutex.Unlock()
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("Should refuse the logins past the cap of a username or an address", func() {
+			maxPendingLoginsPerClient = 2
+
+			for i := 0; i < 2; i++ {
+				pending, err := dispatchLogin(c, &m.LoginUserQuery{Username: "roel"})
+				So(err, ShouldBeNil)
+				So(pending, ShouldNotBeEmpty)
+			}
+
+			_, err := dispatchLogin(c, &m.LoginUserQuery{Username: "Roel"})
+			So(err, ShouldEqual, ErrTooManyPendingLogins)
+
+			other, _ := http.NewRequest("POST", "/login", nil)
+			other.RemoteAddr = "10.0.0.2:1234"
+			_, err = dispatchLogin(&m.ReqContext{Context: &macaron.Context{Req: macaron.Request{Request: other}}}, &m.LoginUserQuery{Username: "roel"})
+			So(err, ShouldEqual, ErrTooManyPendingLogins)
+
+			_, err = dispatchLogin(c, &m.LoginUserQuery{Username: "torkel"})
+			So(err, ShouldEqual, ErrTooManyPendingLogins)
+		})
+
+		Convey("Should refuse the logins past the cap of all the clients", func() {
+			maxPendingLogins = 1
+
+			_, err := dispatchLogin(c, &m.LoginUserQuery{Username: "roel"})
+			So(err, ShouldBeNil)
+
+			_, err = dispatchLogin(c, &m.LoginUserQuery{Username: "torkel"})
+			So(err, ShouldEqual, ErrTooManyPendingLogins)
+		})
+
+		Convey("Should uncount the logins once completed or forgotten", func() {
+			maxPendingLogins = 1
+
+			_, err := dispatchLogin(c, &m.LoginUserQuery{Username: "fast"})
+			So(err, ShouldBeNil)
+
+			pendingLoginTTL = 10 * time.Millisecond
+			pending, err := dispatchLogin(c, &m.LoginUserQuery{Username: "roel"})
+			So(err, ShouldBeNil)
+			So(pending, ShouldNotBeEmpty)
+
+			time.Sleep(50 * time.Millisecond)
+			_, err = dispatchLogin(c, &m.LoginUserQuery{Username: "fast"})
+			So(err, ShouldBeNil)
+
+			pendingLoginsMutex.Lock()
+			So(pendingLoginsTotal, ShouldEqual, 0)
+			So(pendingLoginCounts, ShouldBeEmpty)
+			pendingLoginsMutex.Unlock()
+		})
+
+		Convey("Should complete the pending login on the poll after it completed", func() {
+			pending, err := dispatchLogin(c, &m.LoginUserQuery{Username: "roel"})
+			So(err, ShouldBeNil)
+			So(pending, ShouldNotBeEmpty)
+
+			hs := &HTTPServer{Bus: bus.GetBus(), Cfg: setting.NewCfg(), AuthTokenService: auth.NewFakeUserAuthTokenService()}
+			sc := setupScenarioContext("/login/pending/" + pending)
+			sc.m.Get("/login/pending/:id", Wrap(hs.LoginPending))
+
+			sc.fakeReq("GET", "/login/pending/"+pending).exec()
+			So(sc.resp.Code, ShouldEqual, 202)
+
+			release <- struct{}{}
+			sc.fakeReq("GET", "/login/pending/"+pending).exec()
+			So(sc.resp.Code, ShouldEqual, 200)
+			So(sc.resp.Header().Get("Set-Cookie"), ShouldStartWith, "grafana_session=")
+
+			sc.fakeReq("GET", "/login/pending/"+pending).exec()
+			So(sc.resp.Code, ShouldEqual, 404)
+		})
+	})
+}
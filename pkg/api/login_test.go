@@ -0,0 +1,106 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/xerrors"
+
+	"github.com/grafana/grafana/pkg/api/dtos"
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/login"
+	m "github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+func TestLoginErrorResponse(t *testing.T) {
+	Convey("loginErrorResponse", t, func() {
+		defer func(generic bool, messages map[string]string) {
+			setting.LdapGenericLoginErrors, setting.LdapLoginErrorMessages = generic, messages
+		}(setting.LdapGenericLoginErrors, setting.LdapLoginErrorMessages)
+		setting.LdapGenericLoginErrors = false
+		setting.LdapLoginErrorMessages = map[string]string{}
+
+		answer := func(err error) (int, map[string]interface{}) {
+			resp := loginErrorResponse(err).(*NormalResponse)
+			data := map[string]interface{}{}
+			So(json.Unmarshal(resp.body, &data), ShouldBeNil)
+			return resp.status, data
+		}
+
+		Convey("Should answer the code of the error", func() {
+			status, data := answer(login.ErrInvalidCredentials)
+			So(status, ShouldEqual, 401)
+			So(data["code"], ShouldEqual, "invalid_credentials")
+
+			status, data = answer(ldap.ErrInvalidCredentials)
+			So(status, ShouldEqual, 401)
+			So(data["code"], ShouldEqual, "invalid_credentials")
+
+			status, data = answer(ldap.ErrAccountLocked)
+			So(status, ShouldEqual, 403)
+			So(data["code"], ShouldEqual, "account_locked")
+			So(data["message"], ShouldEqual, ldap.ErrAccountLocked.Error())
+
+			status, data = answer(xerrors.Errorf("bind: %w", &ldap.ClassifiedError{Kind: ldap.ErrServerUnavailable, Err: xerrors.New("connection refused")}))
+			So(status, ShouldEqual, 503)
+			So(data["code"], ShouldEqual, "server_unavailable")
+
+			status, data = answer(ldap.ErrSecondFactorRequired)
+			So(status, ShouldEqual, 401)
+			So(data["secondFactorRequired"], ShouldBeTrue)
+
+			status, data = answer(ErrTooManyPendingLogins)
+			So(status, ShouldEqual, 429)
+			So(data["code"], ShouldEqual, "too_many_pending_logins")
+		})
+
+		Convey("Should hide the refused accounts with generic_login_errors", func() {
+			setting.LdapGenericLoginErrors = true
+
+			status, data := answer(ldap.ErrAccountLocked)
+			So(status, ShouldEqual, 401)
+			So(data["code"], ShouldEqual, "invalid_credentials")
+			So(data["message"], ShouldEqual, "Invalid username or password")
+		})
+
+		Convey("Should answer the login_error_messages", func() {
+			setting.LdapLoginErrorMessages = map[string]string{"timeout": "The directory is slow, try again in a minute"}
+
+			status, data := answer(&ldap.ClassifiedError{Kind: ldap.ErrTimeout, Err: xerrors.New("i/o timeout")})
+			So(status, ShouldEqual, 503)
+			So(data["code"], ShouldEqual, "timeout")
+			So(data["message"], ShouldEqual, "The directory is slow, try again in a minute")
+		})
+	})
+}
+
+func TestLoginPostErrors(t *testing.T) {
+	Convey("LoginPost", t, func() {
+		defer bus.ClearBusHandlers()
+		defer func(enabled bool) { setting.LdapEnabled = enabled }(setting.LdapEnabled)
+		setting.LdapEnabled = false
+
+		hs := &HTTPServer{Bus: bus.GetBus(), Cfg: setting.NewCfg()}
+		sc := setupScenarioContext("/login")
+		sc.m.Post("/login", Wrap(func(c *m.ReqContext) Response {
+			return hs.LoginPost(c, dtos.LoginCommand{User: "roel", Password: "wrong"})
+		}))
+
+		Convey("Should answer the wrong LDAP passwords as invalid credentials", func() {
+			bus.AddHandler("test", func(query *m.LoginUserQuery) error {
+				return ldap.ErrInvalidCredentials
+			})
+
+			sc.fakeReq("POST", "/login").exec()
+
+			data := map[string]interface{}{}
+			So(json.Unmarshal(sc.resp.Body.Bytes(), &data), ShouldBeNil)
+			So(sc.resp.Code, ShouldEqual, 401)
+			So(data["code"], ShouldEqual, "invalid_credentials")
+			So(data["message"], ShouldEqual, "Invalid username or password")
+		})
+	})
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/scim"
+)
+
+// scimJSON is the response of a SCIM endpoint, with the SCIM content type
+func scimJSON(status int, body interface{}) *NormalResponse {
+	return JSON(status, body).Header("Content-Type", "application/scim+json")
+}
+
+// scimError is the SCIM error response of the status
+func scimError(status int, detail string) *NormalResponse {
+	return scimJSON(status, scim.NewError(status, "", detail))
+}
+
+// scimDirectory reads the LDAP users and groups, nil with the error response if they can't be read
+func (hs *HTTPServer) scimDirectory() (*scim.Directory, Response) {
+	if hs.SCIMService.IsDisabled() {
+		return nil, scimError(404, "SCIM is not enabled")
+	}
+
+	directory, err := hs.SCIMService.Directory()
+	if err != nil {
+		hs.log.Error("Failed to read the LDAP users for SCIM", "error", err)
+		return nil, scimError(500, "Failed to read the LDAP users")
+	}
+
+	return directory, nil
+}
+
+// GetSCIMServiceProviderConfig returns the features of the SCIM endpoints
+func (hs *HTTPServer) GetSCIMServiceProviderConfig() Response {
+	if hs.SCIMService.IsDisabled() {
+		return scimError(404, "SCIM is not enabled")
+	}
+
+	return scimJSON(200, scim.ServiceProviderConfig())
+}
+
+// GetSCIMUsers lists the LDAP users matching the filter
+func (hs *HTTPServer) GetSCIMUsers(c *models.ReqContext) Response {
+	directory, errResponse := hs.scimDirectory()
+	if errResponse != nil {
+		return errResponse
+	}
+
+	list, err := directory.ListUsers(c.Query("filter"), c.QueryInt("startIndex"), c.QueryInt("count"))
+	if err != nil {
+		return scimJSON(400, err)
+	}
+
+	return scimJSON(200, list)
+}
+
+// GetSCIMUser returns the LDAP user of the id
+func (hs *HTTPServer) GetSCIMUser(c *models.ReqContext) Response {
+	directory, errResponse := hs.scimDirectory()
+	if errResponse != nil {
+		return errResponse
+	}
+
+	user := directory.User(c.Params(":id"))
+	if user == nil {
+		return scimError(404, "User not found")
+	}
+
+	return scimJSON(200, user)
+}
+
+// GetSCIMGroups lists the LDAP groups matching the filter
+func (hs *HTTPServer) GetSCIMGroups(c *models.ReqContext) Response {
+	directory, errResponse := hs.scimDirectory()
+	if errResponse != nil {
+		return errResponse
+	}
+
+	list, err := directory.ListGroups(c.Query("filter"), c.QueryInt("startIndex"), c.QueryInt("count"))
+	if err != nil {
+		return scimJSON(400, err)
+	}
+
+	return scimJSON(200, list)
+}
+
+// GetSCIMGroup returns the LDAP group of the id
+func (hs *HTTPServer) GetSCIMGroup(c *models.ReqContext) Response {
+	directory, errResponse := hs.scimDirectory()
+	if errResponse != nil {
+		return errResponse
+	}
+
+	group := directory.Group(c.Params(":id"))
+	if group == nil {
+		return scimError(404, "Group not found")
+	}
+
+	return scimJSON(200, group)
+}
@@ -28,6 +28,17 @@ func getUserUserProfile(userID int64) Response {
 		return Error(500, "Failed to get user", err)
 	}
 
+	attributesQuery := m.GetUserAttributesQuery{UserId: userID}
+	if err := bus.Dispatch(&attributesQuery); err != nil {
+		return Error(500, "Failed to get user attributes", err)
+	}
+	for _, attribute := range attributesQuery.Result {
+		if query.Result.Attributes == nil {
+			query.Result.Attributes = map[string]string{}
+		}
+		query.Result.Attributes[attribute.Name] = attribute.Value
+	}
+
 	return JSON(200, query.Result)
 }
 
@@ -32,6 +32,10 @@ type Bus interface {
 	AddEventListener(handler HandlerFunc)
 	AddWildcardListener(handler HandlerFunc)
 
+	// HasHandler checks if a handler of the message is registered, so the
+	// work only its handler needs can be skipped without one
+	HasHandler(msg Msg) bool
+
 	// SetTransactionManager allows the user to replace the internal
 	// noop TransactionManager that is responsible for manageing
 	// transactions in `InTransaction`
@@ -122,6 +126,11 @@ func (b *InProcBus) Dispatch(msg Msg) error {
 	return err.(error)
 }
 
+func (b *InProcBus) HasHandler(msg Msg) bool {
+	var msgName = reflect.TypeOf(msg).Elem().Name()
+	return b.handlersWithCtx[msgName] != nil || b.handlers[msgName] != nil
+}
+
 func (b *InProcBus) Publish(msg Msg) error {
 	var msgName = reflect.TypeOf(msg).Elem().Name()
 	var listeners = b.listeners[msgName]
@@ -201,6 +210,10 @@ func DispatchCtx(ctx context.Context, msg Msg) error {
 	return globalBus.DispatchCtx(ctx, msg)
 }
 
+func HasHandler(msg Msg) bool {
+	return globalBus.HasHandler(msg)
+}
+
 func Publish(msg Msg) error {
 	return globalBus.Publish(msg)
 }
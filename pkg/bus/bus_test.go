@@ -110,3 +110,19 @@ func TestEventListeners(t *testing.T) {
 		t.Fatal(fmt.Sprintf("Publish event failed, listeners called: %v, expected: %v", count, 11))
 	}
 }
+
+func TestHasHandler(t *testing.T) {
+	bus := New()
+
+	if bus.HasHandler(&testQuery{}) {
+		t.Fatal("expected no handler before one is registered")
+	}
+
+	bus.AddHandlerCtx(func(ctx context.Context, query *testQuery) error {
+		return nil
+	})
+
+	if !bus.HasHandler(&testQuery{}) {
+		t.Fatal("expected the handler with context to be found")
+	}
+}
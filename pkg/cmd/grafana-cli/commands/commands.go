@@ -109,6 +109,107 @@ var adminCommands = []cli.Command{
 	},
 }
 
+func runLdapCommand(command func(commandLine CommandLine) error) func(context *cli.Context) {
+	return func(context *cli.Context) {
+		cmd := &contextCommandLine{context}
+		if err := command(cmd); err != nil {
+			logger.Errorf("\n%s: ", color.RedString("Error"))
+			logger.Errorf("%s\n\n", err)
+			os.Exit(1)
+		}
+	}
+}
+
+var ldapCommands = []cli.Command{
+	{
+		Name:   "validate",
+		Usage:  "validate <ldap.toml path (optional, defaults to the one configured in grafana.ini)>",
+		Action: runLdapCommand(validateLdapCommand),
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "homepath",
+				Usage: "path to grafana install/home path, defaults to working directory",
+			},
+			cli.StringFlag{
+				Name:  "config",
+				Usage: "path to config file",
+			},
+		},
+	}, {
+		Name:   "bench",
+		Usage:  "bench --user <username> [--password <password> | --search]",
+		Action: runLdapCommand(benchLdapCommand),
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "homepath",
+				Usage: "path to grafana install/home path, defaults to working directory",
+			},
+			cli.StringFlag{
+				Name:  "config",
+				Usage: "path to config file",
+			},
+			cli.StringSliceFlag{
+				Name:  "user",
+				Usage: "username to log in or look up, can be repeated to spread the requests over several users",
+			},
+			cli.StringFlag{
+				Name:  "password",
+				Usage: "password of the users",
+			},
+			cli.BoolFlag{
+				Name:  "search",
+				Usage: "only look the users up instead of logging them in",
+			},
+			cli.IntFlag{
+				Name:  "requests",
+				Value: 100,
+				Usage: "number of logins or searches",
+			},
+			cli.IntFlag{
+				Name:  "concurrency",
+				Value: 10,
+				Usage: "number of logins or searches at once",
+			},
+		},
+	}, {
+		Name:   "simulate",
+		Usage:  "simulate --config <ldap.toml path> --ldif <users.ldif path> --user <username>",
+		Action: runLdapCommand(simulateLdapCommand),
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "config",
+				Usage: "path to the ldap.toml config file",
+			},
+			cli.StringFlag{
+				Name:  "ldif",
+				Usage: "path to the LDIF file with the users and groups",
+			},
+			cli.StringFlag{
+				Name:  "user",
+				Usage: "username to log in",
+			},
+		},
+	}, {
+		Name:   "diff",
+		Usage:  "diff --config <current ldap.toml path> --new-config <new ldap.toml path> [--ldif <users.ldif path>]",
+		Action: runLdapCommand(diffLdapCommand),
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "config",
+				Usage: "path to the current ldap.toml config file",
+			},
+			cli.StringFlag{
+				Name:  "new-config",
+				Usage: "path to the new ldap.toml config file",
+			},
+			cli.StringFlag{
+				Name:  "ldif",
+				Usage: "path to the LDIF file with the users and groups, the directory of the configs is searched without it",
+			},
+		},
+	},
+}
+
 var Commands = []cli.Command{
 	{
 		Name:        "plugins",
@@ -120,4 +221,9 @@ var Commands = []cli.Command{
 		Usage:       "Grafana admin commands",
 		Subcommands: adminCommands,
 	},
+	{
+		Name:        "ldap",
+		Usage:       "LDAP commands",
+		Subcommands: ldapCommands,
+	},
 }
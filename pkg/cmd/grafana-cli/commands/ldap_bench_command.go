@@ -0,0 +1,154 @@
+package commands
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/grafana/grafana/pkg/cmd/grafana-cli/logger"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/services/multildap"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// ldapBenchResult is the outcome of a benchmark run
+type ldapBenchResult struct {
+	Requests  int
+	Errors    int
+	FirstErr  error
+	Duration  time.Duration
+	Latencies []time.Duration
+}
+
+// Percentile returns the latency under which the given share of the requests
+// answered, with the nearest-rank method
+func (result *ldapBenchResult) Percentile(share float64) time.Duration {
+	if len(result.Latencies) == 0 {
+		return 0
+	}
+
+	rank := int(share*float64(len(result.Latencies))+0.5) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(result.Latencies) {
+		rank = len(result.Latencies) - 1
+	}
+	return result.Latencies[rank]
+}
+
+// runLdapBench runs the operation the given number of times, with at most
+// concurrency operations at once. The latencies of the result are sorted
+func runLdapBench(requests, concurrency int, operation func(i int) error) *ldapBenchResult {
+	result := &ldapBenchResult{Requests: requests, Latencies: make([]time.Duration, requests)}
+
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	indexes := make(chan int)
+
+	start := time.Now()
+	for worker := 0; worker < concurrency; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				began := time.Now()
+				err := operation(i)
+				result.Latencies[i] = time.Since(began)
+
+				if err != nil {
+					mutex.Lock()
+					if result.Errors == 0 {
+						result.FirstErr = err
+					}
+					result.Errors++
+					mutex.Unlock()
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < requests; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	result.Duration = time.Since(start)
+
+	sort.Slice(result.Latencies, func(i, j int) bool {
+		return result.Latencies[i] < result.Latencies[j]
+	})
+	return result
+}
+
+func benchLdapCommand(c CommandLine) error {
+	usernames := c.StringSlice("user")
+	if len(usernames) == 0 {
+		return fmt.Errorf("Missing the --user to log in or look up")
+	}
+	password := c.String("password")
+	search := c.Bool("search")
+	if !search && password == "" {
+		return fmt.Errorf("Missing the --password of the users, or --search to only look them up")
+	}
+
+	requests := c.Int("requests")
+	if requests <= 0 {
+		requests = 100
+	}
+	concurrency := c.Int("concurrency")
+	if concurrency <= 0 {
+		concurrency = 10
+	}
+
+	cfg := setting.NewCfg()
+	err := cfg.Load(&setting.CommandLineArgs{
+		Config:   c.String("config"),
+		HomePath: c.String("homepath"),
+	})
+	if err != nil {
+		return fmt.Errorf("Could not read the Grafana config: %v", err)
+	}
+	if !ldap.IsEnabled() {
+		return fmt.Errorf("LDAP is not enabled in the Grafana config")
+	}
+
+	config, err := ldap.GetConfig()
+	if err != nil {
+		return fmt.Errorf("Could not read %s: %v", setting.LdapConfigFile, err)
+	}
+	servers := multildap.New(config.Servers)
+
+	operation := func(i int) error {
+		username := usernames[i%len(usernames)]
+		if search {
+			_, err := servers.User(username)
+			return err
+		}
+		return servers.VerifyPassword(username, password)
+	}
+
+	kind := "logins"
+	if search {
+		kind = "searches"
+	}
+	logger.Infof("Running %d %s with %d at once against %s\n", requests, kind, concurrency, setting.LdapConfigFile)
+
+	result := runLdapBench(requests, concurrency, operation)
+
+	logger.Infof("\n%d %s in %v, %.1f per second\n", result.Requests, kind, result.Duration.Round(time.Millisecond),
+		float64(result.Requests)/result.Duration.Seconds())
+	for _, share := range []float64{0.5, 0.9, 0.95, 0.99, 1} {
+		logger.Infof("  p%-3v %v\n", share*100, result.Percentile(share).Round(time.Microsecond))
+	}
+
+	if result.Errors > 0 {
+		logger.Infof("\n%s %d failed, the first with: %v\n", color.RedString("✗"), result.Errors, result.FirstErr)
+		return fmt.Errorf("%d of the %d %s failed", result.Errors, result.Requests, kind)
+	}
+
+	logger.Infof("\nNo errors %s\n", color.GreenString("✔"))
+	return nil
+}
@@ -0,0 +1,65 @@
+package commands
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/cmd/grafana-cli/commands/commandstest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLdapBench(t *testing.T) {
+	Convey("runLdapBench", t, func() {
+		var running, most int32
+		result := runLdapBench(20, 4, func(i int) error {
+			now := atomic.AddInt32(&running, 1)
+			defer atomic.AddInt32(&running, -1)
+			for {
+				seen := atomic.LoadInt32(&most)
+				if now <= seen || atomic.CompareAndSwapInt32(&most, seen, now) {
+					break
+				}
+			}
+
+			time.Sleep(time.Duration(i) * time.Millisecond)
+			if i%10 == 0 {
+				return errors.New("busy")
+			}
+			return nil
+		})
+
+		So(most, ShouldBeLessThanOrEqualTo, 4)
+		So(result.Requests, ShouldEqual, 20)
+		So(result.Errors, ShouldEqual, 2)
+		So(result.FirstErr.Error(), ShouldEqual, "busy")
+		So(result.Latencies, ShouldHaveLength, 20)
+		So(result.Percentile(0.5), ShouldBeLessThanOrEqualTo, result.Percentile(0.9))
+		So(result.Percentile(1), ShouldBeGreaterThanOrEqualTo, 19*time.Millisecond)
+	})
+
+	Convey("Percentile", t, func() {
+		result := &ldapBenchResult{}
+		for i := 1; i <= 100; i++ {
+			result.Latencies = append(result.Latencies, time.Duration(i)*time.Millisecond)
+		}
+
+		So(result.Percentile(0.5), ShouldEqual, 50*time.Millisecond)
+		So(result.Percentile(0.99), ShouldEqual, 99*time.Millisecond)
+		So(result.Percentile(1), ShouldEqual, 100*time.Millisecond)
+		So((&ldapBenchResult{}).Percentile(0.5), ShouldEqual, 0)
+	})
+
+	Convey("Missing the password", t, func() {
+		commandLine := &commandstest.FakeCommandLine{
+			LocalFlags: &commandstest.FakeFlagger{
+				Data: map[string]interface{}{
+					"user": []string{"ldap-editor"},
+				},
+			},
+		}
+
+		So(benchLdapCommand(commandLine), ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,77 @@
+package commands
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/grafana/grafana/pkg/cmd/grafana-cli/logger"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/services/multildap"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+func diffLdapCommand(c CommandLine) error {
+	beforeFile, afterFile, ldifFile := c.String("config"), c.String("new-config"), c.String("ldif")
+	if beforeFile == "" || afterFile == "" {
+		return fmt.Errorf("Missing the --config or --new-config")
+	}
+
+	before, err := ldap.ReadConfigFile(beforeFile)
+	if err != nil {
+		return fmt.Errorf("Could not read %s: %v", beforeFile, err)
+	}
+	after, err := ldap.ReadConfigFile(afterFile)
+	if err != nil {
+		return fmt.Errorf("Could not read %s: %v", afterFile, err)
+	}
+
+	// the users of the LDIF fixture, the ones of the directory without it
+	users := func(config *ldap.Config) ([]*ldap.UserInfo, error) {
+		return multildap.New(config.Servers).Users()
+	}
+	if ldifFile != "" {
+		ldif, err := ioutil.ReadFile(ldifFile)
+		if err != nil {
+			return fmt.Errorf("Could not read %s: %v", ldifFile, err)
+		}
+		users = func(config *ldap.Config) ([]*ldap.UserInfo, error) {
+			return ldap.SimulatedUsers(config, string(ldif))
+		}
+	}
+
+	// the allow_sign_up default of [auth.ldap], the grafana.ini isn't read
+	setting.LdapAllowSignup = true
+
+	beforeUsers, err := users(before)
+	if err != nil {
+		return fmt.Errorf("Could not get the users of %s: %v", beforeFile, err)
+	}
+	afterUsers, err := users(after)
+	if err != nil {
+		return fmt.Errorf("Could not get the users of %s: %v", afterFile, err)
+	}
+
+	changes := ldap.DiffMappings(before, beforeUsers, after, afterUsers)
+	if len(changes) == 0 {
+		logger.Infof("%s no user changes access or roles\n", color.GreenString("✔"))
+		return nil
+	}
+
+	for _, change := range changes {
+		switch change.Kind {
+		case ldap.MappingGained:
+			logger.Infof("%s %s (%s) gains access\n", color.GreenString("+"), change.Login, change.DN)
+		case ldap.MappingLost:
+			logger.Infof("%s %s (%s) loses access\n", color.RedString("-"), change.Login, change.DN)
+		default:
+			logger.Infof("%s %s (%s) changes roles\n", color.YellowString("~"), change.Login, change.DN)
+		}
+		if len(change.Changes) > 0 {
+			logger.Infof("    %s\n", strings.Join(change.Changes, "\n    "))
+		}
+	}
+	logger.Infof("\n%d users change between %s and %s\n", len(changes), beforeFile, afterFile)
+	return nil
+}
@@ -0,0 +1,73 @@
+package commands
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"github.com/fatih/color"
+	"github.com/grafana/grafana/pkg/cmd/grafana-cli/logger"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+func simulateLdapCommand(c CommandLine) error {
+	configFile, ldifFile, username := c.String("config"), c.String("ldif"), c.String("user")
+	if configFile == "" || ldifFile == "" || username == "" {
+		return fmt.Errorf("Missing the --config, --ldif or --user")
+	}
+
+	config, err := ldap.ReadConfigFile(configFile)
+	if err != nil {
+		return fmt.Errorf("Could not read %s: %v", configFile, err)
+	}
+	ldif, err := ioutil.ReadFile(ldifFile)
+	if err != nil {
+		return fmt.Errorf("Could not read %s: %v", ldifFile, err)
+	}
+
+	// the allow_sign_up default of [auth.ldap], the grafana.ini isn't read
+	setting.LdapAllowSignup = true
+
+	simulation, err := ldap.Simulate(config, string(ldif), username)
+	if err == ldap.ErrInvalidCredentials {
+		return fmt.Errorf("%s is not found by the servers of %s", username, configFile)
+	}
+	if err != nil {
+		return fmt.Errorf("Could not simulate the login of %s: %v", username, err)
+	}
+
+	user := simulation.ExternalUser
+	logger.Infof("%s found by %s as %s\n", username, simulation.Server.Host, simulation.User.DN)
+	logger.Infof("  name:   %s\n", user.Name)
+	logger.Infof("  email:  %s\n", user.Email)
+	logger.Infof("  groups: %v\n", simulation.User.MemberOf)
+
+	if simulation.Err == ldap.ErrInvalidCredentials {
+		logger.Infof("\n%s refused: no group mapping matches\n", color.RedString("✗"))
+		return nil
+	}
+	if simulation.Err != nil {
+		logger.Infof("\n%s refused: %v\n", color.RedString("✗"), simulation.Err)
+		return nil
+	}
+
+	orgs := make([]int64, 0, len(user.OrgRoles))
+	for org := range user.OrgRoles {
+		orgs = append(orgs, org)
+	}
+	sort.Slice(orgs, func(i, j int) bool { return orgs[i] < orgs[j] })
+
+	logger.Infof("\n")
+	for _, org := range orgs {
+		logger.Infof("  org %d: %s\n", org, user.OrgRoles[org])
+	}
+	if len(orgs) == 0 {
+		logger.Infof("  no group mappings, the role is the one of auto_assign_org_role\n")
+	}
+	logger.Infof("  grafana admin: %v\n", user.IsGrafanaAdmin != nil && *user.IsGrafanaAdmin)
+	logger.Infof("  sign up:       %v\n", simulation.SignupAllowed)
+
+	logger.Infof("\n%s allowed\n", color.GreenString("✔"))
+	return nil
+}
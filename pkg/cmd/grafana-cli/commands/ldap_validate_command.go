@@ -0,0 +1,56 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/fatih/color"
+	"github.com/grafana/grafana/pkg/cmd/grafana-cli/logger"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+func validateLdapCommand(c CommandLine) error {
+	configFile := c.Args().First()
+	if configFile == "" {
+		cfg := setting.NewCfg()
+		err := cfg.Load(&setting.CommandLineArgs{
+			Config:   c.String("config"),
+			HomePath: c.String("homepath"),
+		})
+		if err != nil {
+			return fmt.Errorf("Could not read the Grafana config: %v", err)
+		}
+		configFile = setting.LdapConfigFile
+	}
+
+	problems, err := ldap.CheckConfigFile(configFile)
+	if err != nil {
+		return fmt.Errorf("Could not read %s: %v", configFile, err)
+	}
+
+	errors := 0
+	for _, problem := range problems {
+		location := configFile
+		if problem.Line > 0 {
+			location = fmt.Sprintf("%s:%d", configFile, problem.Line)
+		}
+		message := problem.Message
+		if problem.Field != "" {
+			message = problem.Field + ": " + message
+		}
+
+		if problem.Warning {
+			logger.Infof("%s: %s %s\n", location, color.YellowString("warning"), message)
+		} else {
+			logger.Infof("%s: %s %s\n", location, color.RedString("error"), message)
+			errors++
+		}
+	}
+
+	if errors > 0 {
+		return fmt.Errorf("%s has %d error(s)", configFile, errors)
+	}
+
+	logger.Infof("%s is valid %s\n", configFile, color.GreenString("✔"))
+	return nil
+}
@@ -35,14 +35,26 @@ var (
 	M_Api_Dashboard_Insert               prometheus.Counter
 	M_Alerting_Result_State              *prometheus.CounterVec
 	M_Alerting_Notification_Sent         *prometheus.CounterVec
+	M_Ldap_Rejected_Logins               *prometheus.CounterVec
 	M_Aws_CloudWatch_GetMetricStatistics prometheus.Counter
 	M_Aws_CloudWatch_ListMetrics         prometheus.Counter
 	M_Aws_CloudWatch_GetMetricData       prometheus.Counter
 	M_DB_DataSource_QueryById            prometheus.Counter
+	M_Ldap_Duplicate_Users               prometheus.Counter
+	M_Ldap_Direct_Binds                  *prometheus.CounterVec
+	M_Ldap_Failures                      *prometheus.CounterVec
+	M_Ldap_Incomplete_Entries            *prometheus.CounterVec
+	M_Ldap_Empty_Group_Searches          *prometheus.CounterVec
+	M_Ldap_Reconnects                    *prometheus.CounterVec
+	M_Ldap_Login_Failures                *prometheus.CounterVec
 
 	// Timers
 	M_DataSource_ProxyReq_Timer prometheus.Summary
 	M_Alerting_Execution_Time   prometheus.Summary
+	M_Ldap_Operation_Queue_Wait prometheus.Summary
+	M_Ldap_Bind_Duration        *prometheus.SummaryVec
+	M_Ldap_Sync_Duration        prometheus.Summary
+	M_Ldap_Search_Duration      *prometheus.HistogramVec
 
 	// StatTotals
 	M_Alerting_Active_Alerts prometheus.Gauge
@@ -52,6 +64,11 @@ var (
 	M_StatTotal_Orgs         prometheus.Gauge
 	M_StatTotal_Playlists    prometheus.Gauge
 
+	// LDAP connections
+	M_Ldap_Connections_Open   *prometheus.GaugeVec
+	M_Ldap_Connections_Pooled *prometheus.GaugeVec
+	M_Ldap_Connections_In_Use *prometheus.GaugeVec
+
 	// M_Grafana_Version is a gauge that contains build info about this binary
 	//
 	// Deprecated: use M_Grafana_Build_Version instead.
@@ -226,6 +243,54 @@ func init() {
 		Namespace: exporterName,
 	})
 
+	M_Ldap_Duplicate_Users = newCounterStartingAtZero(prometheus.CounterOpts{
+		Name:      "ldap_duplicate_users_total",
+		Help:      "counter for logins existing on more than one ldap server",
+		Namespace: exporterName,
+	})
+
+	M_Ldap_Rejected_Logins = newCounterVecStartingAtZero(prometheus.CounterOpts{
+		Name:      "ldap_rejected_logins_total",
+		Help:      "counter for ldap logins rejected before contacting the directory",
+		Namespace: exporterName,
+	}, []string{"reason"}, "empty", "whitespace", "too_short", "too_long", "control_characters")
+
+	M_Ldap_Direct_Binds = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:      "ldap_direct_binds_total",
+		Help:      "counter for ldap direct binds by bind dn template and result",
+		Namespace: exporterName,
+	}, []string{"template", "result"})
+
+	M_Ldap_Failures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:      "ldap_failures_total",
+		Help:      "counter for failed ldap binds and searches by host, wrong passwords excluded",
+		Namespace: exporterName,
+	}, []string{"host", "operation"})
+
+	M_Ldap_Incomplete_Entries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:      "ldap_incomplete_entries_total",
+		Help:      "counter for ldap entries left out of the users listed for missing a required attribute, by host",
+		Namespace: exporterName,
+	}, []string{"host"})
+
+	M_Ldap_Empty_Group_Searches = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:      "ldap_empty_group_searches_total",
+		Help:      "counter for ldap group searches finding no groups for the user, by server",
+		Namespace: exporterName,
+	}, []string{"server"})
+
+	M_Ldap_Reconnects = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:      "ldap_reconnects_total",
+		Help:      "counter for ldap connections dialed after the previous one to the host failed, by host",
+		Namespace: exporterName,
+	}, []string{"host"})
+
+	M_Ldap_Login_Failures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:      "ldap_login_failures_total",
+		Help:      "counter for ldap logins failing for a login the server doesn't have or a wrong password, by server and reason",
+		Namespace: exporterName,
+	}, []string{"server", "reason"})
+
 	M_DataSource_ProxyReq_Timer = prometheus.NewSummary(prometheus.SummaryOpts{
 		Name:      "api_dataproxy_request_all_milliseconds",
 		Help:      "summary for dataproxy request duration",
@@ -238,6 +303,31 @@ func init() {
 		Namespace: exporterName,
 	})
 
+	M_Ldap_Operation_Queue_Wait = prometheus.NewSummary(prometheus.SummaryOpts{
+		Name:      "ldap_operation_queue_wait_milliseconds",
+		Help:      "summary of the time ldap binds and searches wait for a free slot",
+		Namespace: exporterName,
+	})
+
+	M_Ldap_Bind_Duration = prometheus.NewSummaryVec(prometheus.SummaryOpts{
+		Name:      "ldap_bind_duration_milliseconds",
+		Help:      "summary of the ldap bind duration by host",
+		Namespace: exporterName,
+	}, []string{"host"})
+
+	M_Ldap_Sync_Duration = prometheus.NewSummary(prometheus.SummaryOpts{
+		Name:      "ldap_user_sync_duration_milliseconds",
+		Help:      "summary of the duration of the syncs of the ldap users with grafana",
+		Namespace: exporterName,
+	})
+
+	M_Ldap_Search_Duration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:      "ldap_search_duration_milliseconds",
+		Help:      "histogram of the ldap search duration by host, operation and filter template",
+		Namespace: exporterName,
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 15),
+	}, []string{"host", "operation", "template"})
+
 	M_Alerting_Active_Alerts = prometheus.NewGauge(prometheus.GaugeOpts{
 		Name:      "alerting_active_alerts",
 		Help:      "amount of active alerts",
@@ -274,6 +364,24 @@ func init() {
 		Namespace: exporterName,
 	})
 
+	M_Ldap_Connections_Open = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name:      "ldap_connections_open",
+		Help:      "number of open ldap connections by host",
+		Namespace: exporterName,
+	}, []string{"host"})
+
+	M_Ldap_Connections_Pooled = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name:      "ldap_connections_pooled",
+		Help:      "number of idle ldap service connections kept for reuse by host",
+		Namespace: exporterName,
+	}, []string{"host"})
+
+	M_Ldap_Connections_In_Use = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name:      "ldap_connections_in_use",
+		Help:      "number of ldap connections used by an operation by host",
+		Namespace: exporterName,
+	}, []string{"host"})
+
 	M_Grafana_Version = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Name:      "info",
 		Help:      "Information about the Grafana. This metric is deprecated. please use `grafana_build_info`",
@@ -318,6 +426,10 @@ func initMetricVars() {
 		M_Api_Dashboard_Search,
 		M_DataSource_ProxyReq_Timer,
 		M_Alerting_Execution_Time,
+		M_Ldap_Operation_Queue_Wait,
+		M_Ldap_Bind_Duration,
+		M_Ldap_Sync_Duration,
+		M_Ldap_Search_Duration,
 		M_Api_Admin_User_Create,
 		M_Api_Login_Post,
 		M_Api_Login_OAuth,
@@ -332,12 +444,23 @@ func initMetricVars() {
 		M_Aws_CloudWatch_ListMetrics,
 		M_Aws_CloudWatch_GetMetricData,
 		M_DB_DataSource_QueryById,
+		M_Ldap_Duplicate_Users,
+		M_Ldap_Rejected_Logins,
+		M_Ldap_Direct_Binds,
+		M_Ldap_Failures,
+		M_Ldap_Incomplete_Entries,
+		M_Ldap_Empty_Group_Searches,
+		M_Ldap_Reconnects,
+		M_Ldap_Login_Failures,
 		M_Alerting_Active_Alerts,
 		M_StatTotal_Dashboards,
 		M_StatTotal_Users,
 		M_StatActive_Users,
 		M_StatTotal_Orgs,
 		M_StatTotal_Playlists,
+		M_Ldap_Connections_Open,
+		M_Ldap_Connections_Pooled,
+		M_Ldap_Connections_In_Use,
 		M_Grafana_Version,
 		grafanaBuildVersion)
 
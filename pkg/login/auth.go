@@ -6,11 +6,13 @@ import (
 	"github.com/grafana/grafana/pkg/bus"
 	m "github.com/grafana/grafana/pkg/models"
 	LDAP "github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/services/multildap"
 )
 
 var (
 	ErrEmailNotAllowed       = errors.New("Required email domain not fulfilled")
-	ErrNoLDAPServers         = errors.New("No LDAP servers are configured")
+	ErrNoLDAPServers         = multildap.ErrNoLDAPServers
+	ErrLdapNotEnabled        = errors.New("LDAP is not enabled")
 	ErrInvalidCredentials    = errors.New("Invalid Username or Password")
 	ErrNoEmail               = errors.New("Login provider didn't return an email address")
 	ErrProviderDeniedRequest = errors.New("Login provider denied login request")
@@ -41,6 +43,10 @@ func AuthenticateUser(query *m.LoginUserQuery) error {
 
 	ldapEnabled, ldapErr := loginUsingLdap(query)
 	if ldapEnabled {
+		if ldapErr == LDAP.ErrInvalidSecondFactor {
+			saveInvalidLoginAttempt(query)
+		}
+
 		if ldapErr == nil || ldapErr != LDAP.ErrInvalidCredentials {
 			return ldapErr
 		}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/grafana/grafana/pkg/bus"
 	m "github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
 	"github.com/grafana/grafana/pkg/util"
 )
 
@@ -30,6 +31,32 @@ var loginUsingGrafanaDB = func(query *m.LoginUserQuery) error {
 		return err
 	}
 
+	if err := validateLdapUserState(user); err != nil {
+		return err
+	}
+
 	query.User = user
 	return nil
 }
+
+// validateLdapUserState refuses the users disabled since they're missing
+// from LDAP, they log in again once they're found in LDAP again
+func validateLdapUserState(user *m.User) error {
+	if !setting.LdapDisableMissingUsers {
+		return nil
+	}
+
+	query := &m.GetLdapUserStateQuery{UserId: user.Id}
+	err := bus.Dispatch(query)
+	if err == m.ErrLdapUserStateNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if query.Result.State == m.LdapUserDisabled {
+		return m.ErrLdapUserDisabled
+	}
+	return nil
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/grafana/grafana/pkg/bus"
 	m "github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
 )
 
 func TestGrafanaLogin(t *testing.T) {
@@ -63,6 +64,23 @@ func TestGrafanaLogin(t *testing.T) {
 				So(sc.loginUserQuery.User.Password, ShouldEqual, sc.loginUserQuery.Password)
 			})
 		})
+
+		grafanaLoginScenario("When login with a user disabled since it's missing from LDAP", func(sc *grafanaLoginScenarioContext) {
+			defer func(enabled bool) { setting.LdapDisableMissingUsers = enabled }(setting.LdapDisableMissingUsers)
+			setting.LdapDisableMissingUsers = true
+
+			sc.withValidCredentials()
+			bus.AddHandler("test", func(query *m.GetLdapUserStateQuery) error {
+				query.Result = &m.LdapUserState{UserId: query.UserId, State: m.LdapUserDisabled}
+				return nil
+			})
+			err := loginUsingGrafanaDB(sc.loginUserQuery)
+
+			Convey("it should result in user disabled error", func() {
+				So(err, ShouldEqual, m.ErrLdapUserDisabled)
+				So(sc.loginUserQuery.User, ShouldBeNil)
+			})
+		})
 	})
 }
 
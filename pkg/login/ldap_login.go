@@ -3,12 +3,13 @@ package login
 import (
 	"github.com/grafana/grafana/pkg/models"
 	LDAP "github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/services/multildap"
 	"github.com/grafana/grafana/pkg/util/errutil"
 )
 
-var newLDAP = LDAP.New
+var newLDAP = multildap.New
 var getLDAPConfig = LDAP.GetConfig
-var isLDAPEnabled = LDAP.IsEnabled
+var isLDAPEnabled = LDAP.IsLoginEnabled
 
 // loginUsingLdap logs in user using LDAP. It returns whether LDAP is enabled and optional error and query arg will be
 // populated with the logged in user if successful.
@@ -27,14 +28,37 @@ var loginUsingLdap = func(query *models.LoginUserQuery) (bool, error) {
 		return true, ErrNoLDAPServers
 	}
 
-	for _, server := range config.Servers {
-		auth := newLDAP(server)
+	return true, newLDAP(config.Servers).Login(query)
+}
+
+// VerifyLdapPassword checks the password of an LDAP user without logging it
+// in, so the API can require the user to re-authenticate before destructive
+// operations. The failed attempts count against the brute force protection
+func VerifyLdapPassword(username, password string) error {
+	if !isLDAPEnabled() {
+		return ErrLdapNotEnabled
+	}
+
+	if err := validateLoginAttempts(username); err != nil {
+		return err
+	}
+
+	if err := validatePasswordSet(password); err != nil {
+		return err
+	}
+
+	config, err := getLDAPConfig()
+	if err != nil {
+		return errutil.Wrap("Failed to get LDAP config", err)
+	}
+	if len(config.Servers) == 0 {
+		return ErrNoLDAPServers
+	}
 
-		err := auth.Login(query)
-		if err == nil || err != LDAP.ErrInvalidCredentials {
-			return true, err
-		}
+	err = newLDAP(config.Servers).VerifyPassword(username, password)
+	if err == LDAP.ErrInvalidCredentials {
+		saveInvalidLoginAttempt(&models.LoginUserQuery{Username: username})
 	}
 
-	return true, LDAP.ErrInvalidCredentials
+	return err
 }
@@ -6,8 +6,11 @@ import (
 
 	. "github.com/smartystreets/goconvey/convey"
 
+	"github.com/grafana/grafana/pkg/bus"
 	m "github.com/grafana/grafana/pkg/models"
 	LDAP "github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/services/ldap/ldaptest"
+	"github.com/grafana/grafana/pkg/services/multildap"
 	"github.com/grafana/grafana/pkg/setting"
 )
 
@@ -70,12 +73,273 @@ func TestLdapLogin(t *testing.T) {
 	})
 }
 
+func TestVerifyLdapPassword(t *testing.T) {
+	Convey("VerifyLdapPassword", t, func() {
+		defer func() { isLDAPEnabled = LDAP.IsLoginEnabled }()
+		isLDAPEnabled = func() bool { return true }
+
+		var savedAttempt *m.LoginUserQuery
+		validateAttempts := validateLoginAttempts
+		saveAttempt := saveInvalidLoginAttempt
+		defer func() {
+			validateLoginAttempts = validateAttempts
+			saveInvalidLoginAttempt = saveAttempt
+		}()
+		validateLoginAttempts = func(username string) error { return nil }
+		saveInvalidLoginAttempt = func(query *m.LoginUserQuery) { savedAttempt = query }
+
+		ldapLoginScenario("When the password is valid", func(sc *ldapLoginScenarioContext) {
+			sc.withLoginResult(true)
+			err := VerifyLdapPassword("user", "pwd")
+
+			So(err, ShouldBeNil)
+			So(sc.ldapAuthenticatorMock.verifyCalled, ShouldBeTrue)
+			So(sc.ldapAuthenticatorMock.loginCalled, ShouldBeFalse)
+			So(savedAttempt, ShouldBeNil)
+		})
+
+		ldapLoginScenario("When the password is invalid", func(sc *ldapLoginScenarioContext) {
+			sc.withLoginResult(false)
+			err := VerifyLdapPassword("user", "wrong")
+
+			So(err, ShouldEqual, LDAP.ErrInvalidCredentials)
+			So(savedAttempt.Username, ShouldEqual, "user")
+		})
+
+		ldapLoginScenario("When LDAP is disabled", func(sc *ldapLoginScenarioContext) {
+			isLDAPEnabled = func() bool { return false }
+			err := VerifyLdapPassword("user", "pwd")
+
+			So(err, ShouldEqual, ErrLdapNotEnabled)
+		})
+	})
+}
+
+func TestAuthenticateLdapServiceAccounts(t *testing.T) {
+	Convey("Authenticating LDAP service accounts", t, func() {
+		ldapServerScenario("Against the ldaptest server", func(sc *ldapServerScenarioContext) {
+			sc.servers[0].ServiceAccounts = []*LDAP.ServiceAccountMapping{
+				{BaseDN: "cn=ldap-admin,ou=users,dc=grafana,dc=org", OrgId: 1, OrgRole: m.ROLE_VIEWER},
+			}
+
+			Convey("Should refuse the service accounts logging in to the login form", func() {
+				err := AuthenticateUser(&m.LoginUserQuery{Username: "ldap-admin", Password: "grafana"})
+
+				So(err, ShouldEqual, LDAP.ErrServiceAccountInteractiveLogin)
+				So(sc.upsertUserCmd, ShouldBeNil)
+			})
+
+			Convey("Should log the service accounts in for the API requests without a second factor", func() {
+				query := &m.LoginUserQuery{Username: "ldap-admin", Password: "grafana", NonInteractive: true}
+				err := AuthenticateUser(query)
+
+				So(err, ShouldBeNil)
+				So(query.User.Login, ShouldEqual, "ldap-admin")
+				So(sc.upsertUserCmd.ExternalUser.OrgRoles, ShouldResemble, map[int64]m.RoleType{1: m.ROLE_VIEWER})
+			})
+
+			Convey("Should not create the other users for the API requests", func() {
+				err := AuthenticateUser(&m.LoginUserQuery{Username: "ldap-editor", Password: "grafana", NonInteractive: true})
+
+				So(err, ShouldEqual, m.ErrUserNotFound)
+				So(sc.upsertUserCmd, ShouldBeNil)
+			})
+		})
+	})
+}
+
+func TestAuditLdapLogins(t *testing.T) {
+	Convey("Auditing the LDAP logins", t, func() {
+		ldapServerScenario("Against the ldaptest servers", func(sc *ldapServerScenarioContext) {
+			setting.LdapLoginAudit = true
+			defer func() { setting.LdapLoginAudit = false }()
+
+			Convey("Should save the attempt against the server which answered", func() {
+				err := AuthenticateUser(&m.LoginUserQuery{Username: "ldap-editor", Password: "wrong", IpAddress: "192.168.1.1:56433"})
+
+				So(err, ShouldEqual, LDAP.ErrInvalidCredentials)
+				So(sc.attempts, ShouldHaveLength, 1)
+				So(sc.attempts[0].Server, ShouldEqual, LDAP.ServerKey(sc.servers[0]))
+				So(sc.attempts[0].AuthModule, ShouldEqual, LDAP.AuthModule)
+				So(sc.attempts[0].IpAddress, ShouldEqual, "192.168.1.1:56433")
+				So(sc.attempts[0].ResultClass, ShouldEqual, "invalid_credentials")
+			})
+
+			Convey("Should save the attempt once for each server", func() {
+				other, err := ldaptest.NewServer(adminOnlyLDIF)
+				So(err, ShouldBeNil)
+				defer other.Close()
+				sc.servers = append(sc.servers, ldaptestServerConfig(other))
+
+				setting.LdapDuplicateUsers = multildap.DuplicateUsersConfigOrder
+				defer func() { setting.LdapDuplicateUsers = multildap.DuplicateUsersFirstAnswer }()
+
+				err = AuthenticateUser(&m.LoginUserQuery{Username: "ldap-editor", Password: "grafana"})
+
+				So(err, ShouldBeNil)
+				So(sc.attempts, ShouldHaveLength, 2)
+				So(sc.attempts[0].Server, ShouldEqual, LDAP.ServerKey(sc.servers[0]))
+				So(sc.attempts[0].ResultClass, ShouldEqual, "success")
+				So(sc.attempts[1].Server, ShouldEqual, LDAP.ServerKey(sc.servers[1]))
+				So(sc.attempts[1].ResultClass, ShouldEqual, "invalid_credentials")
+			})
+		})
+	})
+}
+
+func TestAuthenticateAgainstSeveralLdapServers(t *testing.T) {
+	Convey("Authenticating against several LDAP servers", t, func() {
+		ldapServerScenario("Against the ldaptest servers", func(sc *ldapServerScenarioContext) {
+			other, err := ldaptest.NewServer(adminOnlyLDIF)
+			So(err, ShouldBeNil)
+			defer other.Close()
+
+			// the servers are awaited in config order, so the first one answers first
+			setting.LdapDuplicateUsers = multildap.DuplicateUsersConfigOrder
+			defer func() { setting.LdapDuplicateUsers = multildap.DuplicateUsersFirstAnswer }()
+
+			Convey("Should try the other servers when one refuses its service account", func() {
+				refusing := ldaptestServerConfig(other)
+				refusing.BindPassword = "wrong"
+				sc.servers = []*LDAP.ServerConfig{refusing, sc.servers[0]}
+
+				query := &m.LoginUserQuery{Username: "ldap-editor", Password: "grafana"}
+				err := AuthenticateUser(query)
+
+				So(err, ShouldBeNil)
+				So(query.User.Login, ShouldEqual, "ldap-editor")
+			})
+
+			Convey("Should try the other servers when one refuses every direct bind", func() {
+				direct := ldaptestServerConfig(other)
+				direct.AuthStrategy = LDAP.AuthStrategyDirectBind
+				direct.BindDN, direct.BindPassword = "cn=%s,ou=users,dc=grafana,dc=org", ""
+				sc.servers = []*LDAP.ServerConfig{direct, sc.servers[0]}
+
+				query := &m.LoginUserQuery{Username: "ldap-editor", Password: "grafana"}
+				err := AuthenticateUser(query)
+
+				So(err, ShouldBeNil)
+				So(query.User.Login, ShouldEqual, "ldap-editor")
+			})
+
+			Convey("Should still answer invalid credentials when no server has the user", func() {
+				direct := ldaptestServerConfig(other)
+				direct.AuthStrategy = LDAP.AuthStrategyDirectBind
+				direct.BindDN, direct.BindPassword = "cn=%s,ou=users,dc=grafana,dc=org", ""
+				sc.servers = []*LDAP.ServerConfig{direct, sc.servers[0]}
+
+				err := AuthenticateUser(&m.LoginUserQuery{Username: "ldap-unknown", Password: "grafana"})
+
+				So(err, ShouldEqual, LDAP.ErrInvalidCredentials)
+			})
+		})
+	})
+}
+
+// adminOnlyLDIF is a directory only having the bind user of the ldaptest servers
+const adminOnlyLDIF = `
+dn: dc=grafana,dc=org
+objectClass: dcObject
+objectClass: organization
+dc: grafana
+o: Grafana
+
+dn: ou=users,dc=grafana,dc=org
+objectClass: organizationalUnit
+ou: users
+
+dn: cn=ldap-admin,ou=users,dc=grafana,dc=org
+objectClass: inetOrgPerson
+cn: ldap-admin
+sn: ldap-admin
+userPassword: grafana
+`
+
+type ldapServerScenarioContext struct {
+	servers       []*LDAP.ServerConfig
+	upsertUserCmd *m.UpsertUserCommand
+	attempts      []*m.CreateLoginAttemptCommand
+}
+
+type ldapServerScenarioFunc func(sc *ldapServerScenarioContext)
+
+// ldapServerScenario logs in through the multildap login against an ldaptest
+// server, the Grafana users being left to the user database
+func ldapServerScenario(desc string, fn ldapServerScenarioFunc) {
+	Convey(desc, func() {
+		server, err := ldaptest.NewServerFromFiles("../services/ldap/testdata/grafana.ldif")
+		So(err, ShouldBeNil)
+
+		origLoginUsingGrafanaDB := loginUsingGrafanaDB
+		origValidateLoginAttempts := validateLoginAttempts
+		origSaveInvalidLoginAttempt := saveInvalidLoginAttempt
+		defer func() {
+			server.Close()
+			bus.ClearBusHandlers()
+			loginUsingGrafanaDB = origLoginUsingGrafanaDB
+			validateLoginAttempts = origValidateLoginAttempts
+			saveInvalidLoginAttempt = origSaveInvalidLoginAttempt
+			isLDAPEnabled = LDAP.IsLoginEnabled
+			getLDAPConfig = LDAP.GetConfig
+		}()
+
+		sc := &ldapServerScenarioContext{
+			servers: []*LDAP.ServerConfig{ldaptestServerConfig(server)},
+		}
+
+		loginUsingGrafanaDB = func(query *m.LoginUserQuery) error { return m.ErrUserNotFound }
+		validateLoginAttempts = func(username string) error { return nil }
+		saveInvalidLoginAttempt = func(query *m.LoginUserQuery) {}
+		isLDAPEnabled = func() bool { return true }
+		getLDAPConfig = func() (*LDAP.Config, error) {
+			return &LDAP.Config{Servers: sc.servers}, nil
+		}
+
+		bus.AddHandler("test", func(cmd *m.UpsertUserCommand) error {
+			sc.upsertUserCmd = cmd
+			cmd.Result = &m.User{Id: 1, Login: cmd.ExternalUser.Login}
+			return nil
+		})
+		bus.AddHandler("test", func(cmd *m.CreateLoginAttemptCommand) error {
+			sc.attempts = append(sc.attempts, cmd)
+			return nil
+		})
+
+		fn(sc)
+	})
+}
+
+// ldaptestServerConfig returns the config of the ldaptest server, binding
+// as its admin and mapping its groups, the admins requiring a second factor
+func ldaptestServerConfig(server *ldaptest.Server) *LDAP.ServerConfig {
+	return &LDAP.ServerConfig{
+		Host:          server.Host(),
+		Port:          server.Port(),
+		BindDN:        "cn=ldap-admin,ou=users,dc=grafana,dc=org",
+		BindPassword:  "grafana",
+		SearchFilter:  "(cn=%s)",
+		SearchBaseDNs: []string{"dc=grafana,dc=org"},
+		Attr: LDAP.AttributeMap{
+			Username: "cn",
+			Name:     "givenName",
+			Surname:  "sn",
+			Email:    "mail",
+			MemberOf: "memberOf",
+		},
+		Groups: []*LDAP.GroupToOrgRole{
+			{GroupDN: "cn=admins,ou=groups,dc=grafana,dc=org", OrgId: 1, OrgRole: m.ROLE_ADMIN, SecondFactor: true},
+			{GroupDN: "cn=editors,ou=groups,dc=grafana,dc=org", OrgId: 1, OrgRole: m.ROLE_EDITOR},
+		},
+	}
+}
+
 func mockLdapAuthenticator(valid bool) *mockAuth {
 	mock := &mockAuth{
 		validLogin: valid,
 	}
 
-	newLDAP = func(server *LDAP.ServerConfig) LDAP.IAuth {
+	newLDAP = func(servers []*LDAP.ServerConfig) multildap.IMultiLDAP {
 		return mock
 	}
 
@@ -83,8 +347,9 @@ func mockLdapAuthenticator(valid bool) *mockAuth {
 }
 
 type mockAuth struct {
-	validLogin  bool
-	loginCalled bool
+	validLogin   bool
+	loginCalled  bool
+	verifyCalled bool
 }
 
 func (auth *mockAuth) Login(query *m.LoginUserQuery) error {
@@ -97,16 +362,26 @@ func (auth *mockAuth) Login(query *m.LoginUserQuery) error {
 	return nil
 }
 
+func (auth *mockAuth) VerifyPassword(username, password string) error {
+	auth.verifyCalled = true
+
+	if !auth.validLogin {
+		return LDAP.ErrInvalidCredentials
+	}
+
+	return nil
+}
+
 func (auth *mockAuth) Users() ([]*LDAP.UserInfo, error) {
 	return nil, nil
 }
 
-func (auth *mockAuth) SyncUser(query *m.LoginUserQuery) error {
-	return nil
+func (auth *mockAuth) UsersPaged(pageSize int, pacer LDAP.Pacer) ([]*LDAP.UserInfo, error) {
+	return nil, nil
 }
 
-func (auth *mockAuth) GetGrafanaUserFor(ctx *m.ReqContext, ldapUser *LDAP.UserInfo) (*m.User, error) {
-	return nil, nil
+func (auth *mockAuth) User(username string) (*LDAP.UserInfo, error) {
+	return nil, LDAP.ErrInvalidCredentials
 }
 
 type ldapLoginScenarioContext struct {
@@ -141,12 +416,12 @@ func ldapLoginScenario(desc string, fn ldapLoginScenarioFunc) {
 			return config, nil
 		}
 
-		newLDAP = func(server *LDAP.ServerConfig) LDAP.IAuth {
+		newLDAP = func(servers []*LDAP.ServerConfig) multildap.IMultiLDAP {
 			return mock
 		}
 
 		defer func() {
-			newLDAP = LDAP.New
+			newLDAP = multildap.New
 			getLDAPConfig = LDAP.GetConfig
 		}()
 
@@ -23,7 +23,7 @@ const (
 
 var (
 	getLDAPConfig = ldap.GetConfig
-	isLDAPEnabled = ldap.IsEnabled
+	isLDAPEnabled = ldap.IsLoginEnabled
 )
 
 // AuthProxy struct
@@ -35,11 +35,12 @@ type AuthProxy struct {
 
 	LDAP func(server *ldap.ServerConfig) ldap.IAuth
 
-	enabled     bool
-	whitelistIP string
-	headerType  string
-	headers     map[string]string
-	cacheTTL    int
+	enabled        bool
+	whitelistIP    string
+	headerType     string
+	headers        map[string]string
+	cacheTTL       int
+	ldapEnrichment bool
 }
 
 // Error auth proxy specific error
@@ -80,11 +81,12 @@ func New(options *Options) *AuthProxy {
 
 		LDAP: ldap.New,
 
-		enabled:     setting.AuthProxyEnabled,
-		headerType:  setting.AuthProxyHeaderProperty,
-		headers:     setting.AuthProxyHeaders,
-		whitelistIP: setting.AuthProxyWhitelist,
-		cacheTTL:    setting.AuthProxyLdapSyncTtl,
+		enabled:        setting.AuthProxyEnabled,
+		headerType:     setting.AuthProxyHeaderProperty,
+		headers:        setting.AuthProxyHeaders,
+		whitelistIP:    setting.AuthProxyWhitelist,
+		cacheTTL:       setting.AuthProxyLdapSyncTtl,
+		ldapEnrichment: setting.AuthProxyLdapEnrichment,
 	}
 }
 
@@ -170,10 +172,10 @@ func (auth *AuthProxy) GetUserID() (int64, *Error) {
 		return id, nil
 	}
 
-	if isLDAPEnabled() {
+	if auth.ldapEnrichment && isLDAPEnabled() {
 		id, err := auth.GetUserIDViaLDAP()
 
-		if err == ldap.ErrInvalidCredentials {
+		if err != nil && err.DetailsError == ldap.ErrInvalidCredentials {
 			return 0, newError(
 				"Proxy authentication required",
 				ldap.ErrInvalidCredentials,
@@ -212,7 +214,9 @@ func (auth *AuthProxy) GetUserIDViaCache() (int64, error) {
 	return userID.(int64), nil
 }
 
-// GetUserIDViaLDAP gets user via LDAP request
+// GetUserIDViaLDAP gets user via LDAP request, the user is searched
+// with the service account of the servers in order without binding as
+// the user, and the first server finding it maps its groups to org roles
 func (auth *AuthProxy) GetUserIDViaLDAP() (int64, *Error) {
 	query := &models.LoginUserQuery{
 		ReqContext: auth.ctx,
@@ -228,13 +232,28 @@ func (auth *AuthProxy) GetUserIDViaLDAP() (int64, *Error) {
 	}
 
 	for _, server := range config.Servers {
+		if !ldap.CanSearchUsers(server) {
+			continue
+		}
+
 		author := auth.LDAP(server)
-		if err := author.SyncUser(query); err != nil {
+		err := author.SyncUser(query)
+		if err == ldap.ErrCouldNotFindUser {
+			// the user isn't on this server
+			continue
+		}
+		if err == ldap.ErrInvalidCredentials {
+			// no group mapping of the server matches the user
+			return 0, newError("User not allowed by LDAP", ldap.ErrInvalidCredentials)
+		}
+		if err != nil {
 			return 0, newError(err.Error(), nil)
 		}
+
+		return query.User.Id, nil
 	}
 
-	return query.User.Id, nil
+	return 0, newError("User not found in LDAP", ldap.ErrInvalidCredentials)
 }
 
 // GetUserIDViaHeader gets user from the header only
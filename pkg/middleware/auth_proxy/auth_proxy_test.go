@@ -17,11 +17,15 @@ import (
 type TestLDAP struct {
 	ldap.Auth
 	ID         int64
+	syncErr    error
 	syncCalled bool
 }
 
 func (stub *TestLDAP) SyncUser(query *models.LoginUserQuery) error {
 	stub.syncCalled = true
+	if stub.syncErr != nil {
+		return stub.syncErr
+	}
 	query.User = &models.User{
 		Id: stub.ID,
 	}
@@ -32,6 +36,7 @@ func TestMiddlewareContext(t *testing.T) {
 	Convey("auth_proxy helper", t, func() {
 		req, _ := http.NewRequest("POST", "http://example.com", nil)
 		setting.AuthProxyHeaderName = "X-Killa"
+		setting.AuthProxyLdapEnrichment = true
 		name := "markelog"
 
 		req.Header.Add(setting.AuthProxyHeaderName, name)
@@ -77,7 +82,7 @@ func TestMiddlewareContext(t *testing.T) {
 				}
 
 				defer func() {
-					isLDAPEnabled = ldap.IsEnabled
+					isLDAPEnabled = ldap.IsLoginEnabled
 					getLDAPConfig = ldap.GetConfig
 				}()
 
@@ -117,7 +122,7 @@ func TestMiddlewareContext(t *testing.T) {
 				}
 
 				defer func() {
-					isLDAPEnabled = ldap.IsEnabled
+					isLDAPEnabled = ldap.IsLoginEnabled
 					getLDAPConfig = ldap.GetConfig
 				}()
 
@@ -145,6 +150,106 @@ func TestMiddlewareContext(t *testing.T) {
 				So(stub.syncCalled, ShouldEqual, false)
 			})
 
+			Convey("looks the user up on the servers which can search it", func() {
+				isLDAPEnabled = func() bool {
+					return true
+				}
+
+				getLDAPConfig = func() (*ldap.Config, error) {
+					config := &ldap.Config{
+						Servers: []*ldap.ServerConfig{
+							{Host: "direct", AuthStrategy: ldap.AuthStrategyDirectBind},
+							{Host: "other"},
+							{Host: "enrichment", AuthStrategy: ldap.AuthStrategySearchOnly},
+						},
+					}
+					return config, nil
+				}
+
+				defer func() {
+					isLDAPEnabled = ldap.IsLoginEnabled
+					getLDAPConfig = ldap.GetConfig
+				}()
+
+				auth := New(&Options{
+					Store: remotecache.NewFakeStore(t),
+					Ctx:   ctx,
+					OrgID: 4,
+				})
+
+				stubs := map[string]*TestLDAP{
+					"direct":     {ID: 1},
+					"other":      {syncErr: ldap.ErrCouldNotFindUser},
+					"enrichment": {ID: 42},
+				}
+				auth.LDAP = func(server *ldap.ServerConfig) ldap.IAuth {
+					return stubs[server.Host]
+				}
+
+				id, err := auth.GetUserID()
+
+				So(err, ShouldBeNil)
+				So(id, ShouldEqual, 42)
+				So(stubs["direct"].syncCalled, ShouldBeFalse)
+				So(stubs["other"].syncCalled, ShouldBeTrue)
+			})
+
+			Convey("requires authentication if no server has the user", func() {
+				isLDAPEnabled = func() bool {
+					return true
+				}
+
+				getLDAPConfig = func() (*ldap.Config, error) {
+					return &ldap.Config{Servers: []*ldap.ServerConfig{{}}}, nil
+				}
+
+				defer func() {
+					isLDAPEnabled = ldap.IsLoginEnabled
+					getLDAPConfig = ldap.GetConfig
+				}()
+
+				auth := New(&Options{
+					Store: remotecache.NewFakeStore(t),
+					Ctx:   ctx,
+					OrgID: 4,
+				})
+
+				auth.LDAP = func(server *ldap.ServerConfig) ldap.IAuth {
+					return &TestLDAP{syncErr: ldap.ErrCouldNotFindUser}
+				}
+
+				_, err := auth.GetUserID()
+
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "Proxy authentication required")
+			})
+
+			Convey("skips LDAP when the enrichment is turned off", func() {
+				isLDAPEnabled = func() bool {
+					return true
+				}
+
+				defer func() {
+					isLDAPEnabled = ldap.IsLoginEnabled
+				}()
+
+				auth := New(&Options{
+					Store: remotecache.NewFakeStore(t),
+					Ctx:   ctx,
+					OrgID: 4,
+				})
+				auth.ldapEnrichment = false
+
+				stub := &TestLDAP{ID: 42}
+				auth.LDAP = func(server *ldap.ServerConfig) ldap.IAuth {
+					return stub
+				}
+
+				// the header login dispatches on the bus, which has no handler here
+				_, _ = auth.GetUserID()
+
+				So(stub.syncCalled, ShouldBeFalse)
+			})
 		})
 	})
 }
@@ -0,0 +1,114 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/infra/remotecache"
+	m "github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/grafana/grafana/pkg/util"
+)
+
+// impersonationCookieName is the cookie holding the id of the
+// impersonation, the impersonation itself is in the remote cache
+const impersonationCookieName = "grafana_impersonation"
+
+var impersonationLogger = log.New("ldap.impersonation")
+
+func init() {
+	remotecache.Register(m.LdapImpersonation{})
+}
+
+func impersonationCacheKey(id string) string {
+	return "ldap-impersonation-" + id
+}
+
+// StartImpersonation saves the impersonation until it expires and
+// sets the cookie which makes the next requests impersonated
+func StartImpersonation(store remotecache.CacheStorage, ctx *m.ReqContext, impersonation *m.LdapImpersonation) error {
+	id := util.GetRandomString(32)
+	if err := store.Set(impersonationCacheKey(id), *impersonation, time.Until(impersonation.Expires)); err != nil {
+		return err
+	}
+
+	writeImpersonationCookie(ctx, id, int(time.Until(impersonation.Expires).Seconds()))
+	impersonationLogger.Info("Impersonation started",
+		"impersonator", impersonation.ImpersonatorLogin, "impersonatorId", impersonation.ImpersonatorId,
+		"user", impersonation.UserLogin, "userId", impersonation.UserId, "expires", impersonation.Expires)
+
+	return nil
+}
+
+// EndImpersonation deletes the impersonation of the request, if any
+func EndImpersonation(store remotecache.CacheStorage, ctx *m.ReqContext) error {
+	id := ctx.GetCookie(impersonationCookieName)
+	if id == "" {
+		return nil
+	}
+
+	writeImpersonationCookie(ctx, "", -1)
+	if impersonation := ctx.Impersonation; impersonation != nil {
+		impersonationLogger.Info("Impersonation ended",
+			"impersonator", impersonation.ImpersonatorLogin, "impersonatorId", impersonation.ImpersonatorId,
+			"user", impersonation.UserLogin, "userId", impersonation.UserId)
+	}
+
+	if err := store.Delete(impersonationCacheKey(id)); err != nil && err != remotecache.ErrCacheItemNotFound {
+		return err
+	}
+	return nil
+}
+
+// initContextWithImpersonation switches the signed in user to the impersonated
+// one and logs the request with both identities. The impersonation is only
+// followed from the session of the impersonator who started it
+func initContextWithImpersonation(store remotecache.CacheStorage, ctx *m.ReqContext, orgID int64) {
+	id := ctx.GetCookie(impersonationCookieName)
+	if id == "" || !ctx.IsSignedIn || ctx.UserToken == nil {
+		return
+	}
+
+	value, err := store.Get(impersonationCacheKey(id))
+	if err != nil {
+		if err != remotecache.ErrCacheItemNotFound {
+			ctx.Logger.Error("Failed to read the impersonation", "error", err)
+		}
+		writeImpersonationCookie(ctx, "", -1)
+		return
+	}
+
+	impersonation, ok := value.(m.LdapImpersonation)
+	if !ok || impersonation.ImpersonatorId != ctx.UserId || impersonation.TokenId != ctx.UserToken.Id {
+		writeImpersonationCookie(ctx, "", -1)
+		return
+	}
+
+	query := m.GetSignedInUserQuery{UserId: impersonation.UserId, OrgId: orgID}
+	if err := bus.Dispatch(&query); err != nil {
+		ctx.Logger.Error("Failed to get the impersonated user", "userId", impersonation.UserId, "error", err)
+		return
+	}
+
+	ctx.SignedInUser = query.Result
+	ctx.Impersonation = &impersonation
+
+	impersonationLogger.Info("Impersonated request",
+		"impersonator", impersonation.ImpersonatorLogin, "impersonatorId", impersonation.ImpersonatorId,
+		"user", impersonation.UserLogin, "userId", impersonation.UserId,
+		"method", ctx.Req.Method, "path", ctx.Req.URL.Path)
+}
+
+func writeImpersonationCookie(ctx *m.ReqContext, value string, maxAge int) {
+	http.SetCookie(ctx.Resp, &http.Cookie{
+		Name:     impersonationCookieName,
+		Value:    value,
+		HttpOnly: true,
+		Path:     setting.AppSubUrl + "/",
+		Secure:   setting.CookieSecure,
+		MaxAge:   maxAge,
+		SameSite: setting.CookieSameSite,
+	})
+}
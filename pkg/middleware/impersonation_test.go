@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	m "github.com/grafana/grafana/pkg/models"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestImpersonation(t *testing.T) {
+	Convey("Given the impersonation cookie", t, func() {
+		impersonationScenario := func(desc string, impersonation m.LdapImpersonation, fn func(sc *scenarioContext)) {
+			middlewareScenario(t, desc, func(sc *scenarioContext) {
+				sc.withTokenSessionCookie("token")
+
+				bus.AddHandler("test", func(query *m.GetSignedInUserQuery) error {
+					query.Result = &m.SignedInUser{OrgId: 2, UserId: query.UserId}
+					return nil
+				})
+				sc.userAuthTokenService.LookupTokenProvider = func(ctx context.Context, unhashedToken string) (*m.UserToken, error) {
+					return &m.UserToken{Id: 7, UserId: 1, UnhashedToken: unhashedToken}, nil
+				}
+
+				err := sc.remoteCacheService.Set(impersonationCacheKey("id"), impersonation, time.Minute)
+				So(err, ShouldBeNil)
+
+				sc.fakeReq("GET", "/")
+				sc.req.AddCookie(&http.Cookie{Name: impersonationCookieName, Value: "id"})
+				sc.exec()
+
+				fn(sc)
+			})
+		}
+
+		impersonationScenario("Should switch to the impersonated user", m.LdapImpersonation{ImpersonatorId: 1, UserId: 2, TokenId: 7}, func(sc *scenarioContext) {
+			So(sc.context.UserId, ShouldEqual, 2)
+			So(sc.context.Impersonation.ImpersonatorId, ShouldEqual, 1)
+			So(sc.context.UserToken.UserId, ShouldEqual, 1)
+		})
+
+		impersonationScenario("Should not follow the impersonation of another session", m.LdapImpersonation{ImpersonatorId: 1, UserId: 2, TokenId: 8}, func(sc *scenarioContext) {
+			So(sc.context.UserId, ShouldEqual, 1)
+			So(sc.context.Impersonation, ShouldBeNil)
+			So(sc.resp.Header().Get("Set-Cookie"), ShouldContainSubstring, impersonationCookieName+"=;")
+		})
+
+		impersonationScenario("Should not follow the impersonation of another user", m.LdapImpersonation{ImpersonatorId: 3, UserId: 2, TokenId: 7}, func(sc *scenarioContext) {
+			So(sc.context.UserId, ShouldEqual, 1)
+			So(sc.context.Impersonation, ShouldBeNil)
+		})
+	})
+
+	Convey("Given an impersonation which ended", t, func() {
+		middlewareScenario(t, "Should not follow it", func(sc *scenarioContext) {
+			sc.withTokenSessionCookie("token")
+
+			bus.AddHandler("test", func(query *m.GetSignedInUserQuery) error {
+				query.Result = &m.SignedInUser{OrgId: 2, UserId: query.UserId}
+				return nil
+			})
+			sc.userAuthTokenService.LookupTokenProvider = func(ctx context.Context, unhashedToken string) (*m.UserToken, error) {
+				return &m.UserToken{Id: 7, UserId: 1, UnhashedToken: unhashedToken}, nil
+			}
+
+			sc.fakeReq("GET", "/")
+			sc.req.AddCookie(&http.Cookie{Name: impersonationCookieName, Value: "gone"})
+			sc.exec()
+
+			So(sc.context.UserId, ShouldEqual, 1)
+			So(sc.context.Impersonation, ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"gopkg.in/macaron.v1"
+
+	m "github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// ldapRateLimitWindow is the window the endpoint_rate_limits count the requests in
+const ldapRateLimitWindow = time.Minute
+
+// rateWindow counts the requests of a user to an endpoint since start
+type rateWindow struct {
+	start    time.Time
+	requests int
+}
+
+// rateLimiter holds the windows of the users by endpoint and user id
+type rateLimiter struct {
+	mutex   sync.Mutex
+	now     func() time.Time
+	windows map[string]map[int64]*rateWindow
+}
+
+var ldapRateLimiter = &rateLimiter{now: time.Now, windows: map[string]map[int64]*rateWindow{}}
+
+// allow counts the request of the user and returns how long it has to
+// wait if it went over the limit of requests in the window
+func (limiter *rateLimiter) allow(endpoint string, userId int64, limit int) (bool, time.Duration) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	now := limiter.now()
+	windows := limiter.windows[endpoint]
+	if windows == nil {
+		windows = map[int64]*rateWindow{}
+		limiter.windows[endpoint] = windows
+	}
+
+	window := windows[userId]
+	if window == nil || now.Sub(window.start) >= ldapRateLimitWindow {
+		window = &rateWindow{start: now}
+		windows[userId] = window
+	}
+	if window.requests >= limit {
+		return false, window.start.Add(ldapRateLimitWindow).Sub(now)
+	}
+
+	window.requests++
+	return true, 0
+}
+
+// LdapRateLimit limits the requests of each user to the LDAP endpoint to
+// its endpoint_rate_limits per minute, answering 429 over the limit
+func LdapRateLimit(endpoint string) macaron.Handler {
+	return func(c *m.ReqContext) {
+		limit := setting.LdapEndpointRateLimits[endpoint]
+		if limit <= 0 {
+			return
+		}
+
+		allowed, retryAfter := ldapRateLimiter.allow(endpoint, c.UserId, limit)
+		if allowed {
+			return
+		}
+
+		seconds := int(retryAfter.Seconds() + 0.999)
+		c.Resp.Header().Set("Retry-After", strconv.Itoa(seconds))
+		c.JsonApiErr(429, fmt.Sprintf("Too many requests to the LDAP %s endpoints, at most %d per minute, retry in %ds", endpoint, limit, seconds), nil)
+	}
+}
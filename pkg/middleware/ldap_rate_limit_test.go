@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLdapRateLimit(t *testing.T) {
+	Convey("rateLimiter", t, func() {
+		current := time.Date(2019, 7, 1, 0, 0, 0, 0, time.UTC)
+		limiter := &rateLimiter{now: func() time.Time { return current }, windows: map[string]map[int64]*rateWindow{}}
+
+		Convey("Should refuse the requests over the limit until the end of the window", func() {
+			for i := 0; i < 2; i++ {
+				allowed, _ := limiter.allow("scim", 1, 2)
+				So(allowed, ShouldBeTrue)
+			}
+
+			current = current.Add(15 * time.Second)
+			allowed, retryAfter := limiter.allow("scim", 1, 2)
+			So(allowed, ShouldBeFalse)
+			So(retryAfter, ShouldEqual, 45*time.Second)
+
+			current = current.Add(45 * time.Second)
+			allowed, _ = limiter.allow("scim", 1, 2)
+			So(allowed, ShouldBeTrue)
+		})
+
+		Convey("Should count the requests by endpoint and user", func() {
+			allowed, _ := limiter.allow("scim", 1, 1)
+			So(allowed, ShouldBeTrue)
+
+			allowed, _ = limiter.allow("scim", 2, 1)
+			So(allowed, ShouldBeTrue)
+			allowed, _ = limiter.allow("diagnostics", 1, 1)
+			So(allowed, ShouldBeTrue)
+			allowed, _ = limiter.allow("scim", 1, 1)
+			So(allowed, ShouldBeFalse)
+		})
+	})
+}
@@ -55,7 +55,13 @@ func GetContextHandler(ats m.UserTokenService, remoteCache *remotecache.RemoteCa
 		case initContextWithAnonymousUser(ctx):
 		}
 
+		initContextWithImpersonation(remoteCache, ctx, orgId)
+
 		ctx.Logger = log.New("context", "userId", ctx.UserId, "orgId", ctx.OrgId, "uname", ctx.Login)
+		if impersonation := ctx.Impersonation; impersonation != nil {
+			ctx.Logger = log.New("context", "userId", ctx.UserId, "orgId", ctx.OrgId, "uname", ctx.Login,
+				"impersonatorId", impersonation.ImpersonatorId, "impersonator", impersonation.ImpersonatorLogin)
+		}
 		ctx.Data["ctx"] = ctx
 
 		c.Map(ctx)
@@ -143,20 +149,24 @@ func initContextWithBasicAuth(ctx *m.ReqContext, orgId int64) bool {
 		return true
 	}
 
+	// the LDAP service accounts get their Grafana user on their first request
 	loginQuery := m.GetUserByLoginQuery{LoginOrEmail: username}
-	if err := bus.Dispatch(&loginQuery); err != nil {
+	if err := bus.Dispatch(&loginQuery); err != nil && (err != m.ErrUserNotFound || !setting.LdapEnabled) {
 		ctx.JsonApiErr(401, "Basic auth failed", err)
 		return true
 	}
 
-	user := loginQuery.Result
-
-	loginUserQuery := m.LoginUserQuery{Username: username, Password: password, User: user}
+	loginUserQuery := m.LoginUserQuery{Username: username, Password: password, User: loginQuery.Result, NonInteractive: true}
 	if err := bus.Dispatch(&loginUserQuery); err != nil {
 		ctx.JsonApiErr(401, "Invalid username or password", err)
 		return true
 	}
 
+	user := loginQuery.Result
+	if user == nil {
+		user = loginUserQuery.User
+	}
+
 	query := m.GetSignedInUserQuery{UserId: user.Id, OrgId: orgId}
 	if err := bus.Dispatch(&query); err != nil {
 		ctx.JsonApiErr(401, "Authentication error", err)
@@ -15,6 +15,9 @@ type ApiKey struct {
 	Role    RoleType
 	Created time.Time
 	Updated time.Time
+
+	// CreatedBy is the id of the user who created the key, 0 if unknown
+	CreatedBy int64
 }
 
 // ---------------------
@@ -25,6 +28,8 @@ type AddApiKeyCommand struct {
 	OrgId int64    `json:"-"`
 	Key   string   `json:"-"`
 
+	CreatedBy int64 `json:"-"`
+
 	Result *ApiKey `json:"-"`
 }
 
@@ -41,6 +46,13 @@ type DeleteApiKeyCommand struct {
 	OrgId int64 `json:"-"`
 }
 
+// DeleteUserApiKeysCommand deletes the API keys created by the user in all the orgs
+type DeleteUserApiKeysCommand struct {
+	UserId int64
+
+	DeletedRows int64
+}
+
 // ----------------------
 // QUERIES
 
@@ -14,6 +14,10 @@ type ReqContext struct {
 	*SignedInUser
 	UserToken *UserToken
 
+	// Impersonation is set when the signed in user is impersonated, SignedInUser
+	// is then the impersonated user
+	Impersonation *LdapImpersonation
+
 	IsSignedIn     bool
 	IsRenderCall   bool
 	AllowAnonymous bool
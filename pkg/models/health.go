@@ -1,3 +1,5 @@
 package models
 
 type GetDBHealthQuery struct{}
+
+type GetLDAPHealthQuery struct{}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrLdapConfigNotFound = errors.New("LDAP config not found")
+var ErrLdapLoginStateNotFound = errors.New("LDAP login state not found")
+
+// LdapConfig is the LDAP config saved in the database,
+// encrypted since it holds the bind passwords
+type LdapConfig struct {
+	Id        int64
+	Config    []byte
+	Updated   time.Time
+	UpdatedBy int64
+}
+
+// LdapLoginState tells if the LDAP logins were turned off through the admin API
+type LdapLoginState struct {
+	Id        int64
+	Enabled   bool
+	Updated   time.Time
+	UpdatedBy int64
+}
+
+// ---------------------
+// COMMANDS
+
+type SaveLdapConfigCommand struct {
+	Config []byte
+	UserId int64
+}
+
+type DeleteLdapConfigCommand struct{}
+
+type SetLdapLoginStateCommand struct {
+	Enabled bool
+	UserId  int64
+}
+
+// ---------------------
+// QUERIES
+
+type GetLdapConfigQuery struct {
+	Result *LdapConfig
+}
+
+type GetLdapLoginStateQuery struct {
+	Result *LdapLoginState
+}
+
+// LdapImpersonation is a member of the LDAP impersonation group acting
+// as another user, kept in the remote cache until it expires or ends
+type LdapImpersonation struct {
+	ImpersonatorId    int64
+	ImpersonatorLogin string
+	UserId            int64
+	UserLogin         string
+
+	// TokenId is the session of the impersonator, the impersonation ends with it
+	TokenId int64
+	Started time.Time
+	Expires time.Time
+}
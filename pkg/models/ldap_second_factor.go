@@ -0,0 +1,55 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrLdapSecondFactorNotFound = errors.New("LDAP second factor not found")
+
+// LdapSecondFactor is the TOTP seed of an LDAP user enrolled in
+// Grafana, encrypted since it's as sensitive as a password
+type LdapSecondFactor struct {
+	Id      int64
+	UserId  int64
+	Secret  []byte
+	Created time.Time
+}
+
+// LdapSecondFactorCounter is the TOTP counter of the last code accepted
+// for a user, the codes of that period and the ones before are refused
+type LdapSecondFactorCounter struct {
+	Id      int64
+	UserId  int64
+	Counter int64
+	Updated time.Time
+}
+
+// ---------------------
+// COMMANDS
+
+type SaveLdapSecondFactorCommand struct {
+	UserId int64
+	Secret []byte
+}
+
+type DeleteLdapSecondFactorCommand struct {
+	UserId int64
+}
+
+// AcceptLdapSecondFactorCounterCommand saves the counter of the code the
+// user logs in with if it's past the last one accepted, Accepted tells
+type AcceptLdapSecondFactorCounterCommand struct {
+	UserId  int64
+	Counter int64
+
+	Accepted bool
+}
+
+// ---------------------
+// QUERIES
+
+type GetLdapSecondFactorQuery struct {
+	UserId int64
+	Result *LdapSecondFactor
+}
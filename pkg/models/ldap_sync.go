@@ -0,0 +1,92 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrLdapSyncJobNotFound = errors.New("LDAP sync job not found")
+
+// The states of an LDAP sync job
+const (
+	LdapSyncRunning   = "running"
+	LdapSyncPaused    = "paused"
+	LdapSyncCancelled = "cancelled"
+	LdapSyncCompleted = "completed"
+	LdapSyncFailed    = "failed"
+)
+
+// LdapSyncJob is a run of the LDAP user sync. The users are synced in
+// the order of their DN, the checkpoint is the DN of the last one so a
+// paused or interrupted run resumes after it. The directory users without
+// a Grafana user are skipped, they're created on their first login
+type LdapSyncJob struct {
+	Id         int64
+	State      string
+	Checkpoint string
+	Total      int64
+	Synced     int64
+	Skipped    int64
+	Failed     int64
+	Error      string
+	Started    time.Time
+	Updated    time.Time
+	StartedBy  int64
+}
+
+// The actions of the entries of a sync report, besides the
+// LdapUserPendingDisable and LdapUserDisabled of the missing users
+const (
+	LdapSyncUpdated     = "updated"
+	LdapSyncUnchanged   = "unchanged"
+	LdapSyncSkipped     = "skipped"
+	LdapSyncUserFailed  = "failed"
+	LdapSyncDeleted     = "deleted"
+	LdapSyncReactivated = "reactivated"
+	LdapSyncOrgsRemoved = "removed_from_orgs"
+
+	// LdapSyncBaseDNMissed is the action of the entries of the base DNs
+	// whose search timed out, the Dn of the entry is the base DN
+	LdapSyncBaseDNMissed = "base_dn_missed"
+)
+
+// LdapSyncReportEntry is what a sync job did to a user, the detail
+// lists the changes applied or says why the user was skipped
+type LdapSyncReportEntry struct {
+	Id      int64
+	JobId   int64
+	Dn      string
+	Login   string
+	Action  string
+	Detail  string
+	Error   string
+	Created time.Time
+}
+
+// ---------------------
+// COMMANDS
+
+// SaveLdapSyncJobCommand inserts the job if it has no id, or updates it
+type SaveLdapSyncJobCommand struct {
+	Job *LdapSyncJob
+}
+
+// AddLdapSyncReportEntriesCommand adds the entries to the reports of their jobs
+type AddLdapSyncReportEntriesCommand struct {
+	Entries []*LdapSyncReportEntry
+}
+
+// ---------------------
+// QUERIES
+
+// GetLdapSyncJobQuery returns the sync job of the id, the last one without
+type GetLdapSyncJobQuery struct {
+	Id     int64
+	Result *LdapSyncJob
+}
+
+// GetLdapSyncReportQuery returns the report entries of the job in their order
+type GetLdapSyncReportQuery struct {
+	JobId  int64
+	Result []*LdapSyncReportEntry
+}
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrLdapSyncRetryNotFound = errors.New("LDAP sync retry not found")
+
+// LdapSyncRetry is an LDAP user whose sync failed, queued to be synced
+// again from NextAttempt. The delay doubles with each failed attempt, the
+// user leaves the queue once synced. The DN is stored in lowercase, the
+// users are queued by server and DnHash, the SHA-256 of the DN
+type LdapSyncRetry struct {
+	Id          int64
+	Dn          string
+	DnHash      string
+	Login       string
+	Server      string
+	Attempts    int
+	Error       string
+	NextAttempt time.Time
+	Created     time.Time
+	Updated     time.Time
+}
+
+// ---------------------
+// COMMANDS
+
+// SaveLdapSyncRetryCommand inserts the retry if it has no id, or updates it
+type SaveLdapSyncRetryCommand struct {
+	Retry *LdapSyncRetry
+}
+
+// DeleteLdapSyncRetryCommand removes the user of the DN on the server from the queue
+type DeleteLdapSyncRetryCommand struct {
+	Server string
+	Dn     string
+}
+
+// DeleteLdapSyncRetriesCommand empties the queue
+type DeleteLdapSyncRetriesCommand struct {
+	DeletedRows int64
+}
+
+// ---------------------
+// QUERIES
+
+type GetLdapSyncRetryQuery struct {
+	Server string
+	Dn     string
+	Result *LdapSyncRetry
+}
+
+// GetLdapSyncRetriesQuery returns the retries due by DueBy, all of them
+// when it's zero, the ones due first first
+type GetLdapSyncRetriesQuery struct {
+	DueBy  time.Time
+	Result []*LdapSyncRetry
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrLdapUserGuidNotFound = errors.New("LDAP user GUID not found")
+
+// LdapUserGuid links the Grafana user of an LDAP user to the unique id of
+// its entry, which is kept when the entry is moved or renamed. The GUID
+// is hex encoded
+type LdapUserGuid struct {
+	Id      int64
+	UserId  int64
+	Guid    string
+	Created time.Time
+}
+
+// ---------------------
+// COMMANDS
+
+// SetLdapUserGuidCommand links the user to the GUID, replacing the
+// previous GUID of the user and the previous user of the GUID
+type SetLdapUserGuidCommand struct {
+	UserId int64
+	Guid   string
+}
+
+// ---------------------
+// QUERIES
+
+type GetLdapUserGuidQuery struct {
+	Guid   string
+	Result *LdapUserGuid
+}
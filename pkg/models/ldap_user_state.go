@@ -0,0 +1,55 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrLdapUserStateNotFound = errors.New("LDAP user state not found")
+	ErrLdapUserDisabled      = errors.New("User is disabled, it's no longer in LDAP")
+)
+
+// The states of the Grafana users missing from LDAP
+const (
+	LdapUserPendingDisable = "pending_disable"
+	LdapUserDisabled       = "disabled"
+)
+
+// LdapUserState is the state of the Grafana user of an LDAP user missing
+// from the directory since the sync of Missing. It's pending disable during
+// the grace period, then disabled. The users found again lose their state
+type LdapUserState struct {
+	Id      int64
+	UserId  int64
+	State   string
+	Missing time.Time
+	Updated time.Time
+}
+
+// ---------------------
+// COMMANDS
+
+// SetLdapUserStateCommand sets the state of the user, the time it went
+// missing is kept once set
+type SetLdapUserStateCommand struct {
+	UserId int64
+	State  string
+}
+
+type DeleteLdapUserStateCommand struct {
+	UserId int64
+}
+
+// ---------------------
+// QUERIES
+
+type GetLdapUserStateQuery struct {
+	UserId int64
+	Result *LdapUserState
+}
+
+// GetLdapUserStatesQuery returns the states of all the users
+type GetLdapUserStatesQuery struct {
+	Result []*LdapUserState
+}
@@ -9,20 +9,32 @@ type LoginAttempt struct {
 	Username  string
 	IpAddress string
 	Created   int64
+
+	// set for the attempts kept for auditing, which don't count
+	// towards the brute force login protection
+	AuthModule  string
+	Server      string
+	ResultClass string
+	Duration    int64
 }
 
 // ---------------------
 // COMMANDS
 
 type CreateLoginAttemptCommand struct {
-	Username  string
-	IpAddress string
+	Username    string
+	IpAddress   string
+	AuthModule  string
+	Server      string
+	ResultClass string
+	Duration    time.Duration
 
 	Result LoginAttempt
 }
 
 type DeleteOldLoginAttemptsCommand struct {
 	OlderThan   time.Time
+	AuthModule  string
 	DeletedRows int64
 }
 
@@ -34,3 +46,15 @@ type GetUserLoginAttemptCountQuery struct {
 	Since    time.Time
 	Result   int64
 }
+
+type SearchLoginAttemptsQuery struct {
+	AuthModule  string
+	Username    string
+	Server      string
+	ResultClass string
+	From        time.Time
+	To          time.Time
+	Limit       int
+
+	Result []*LoginAttempt
+}
@@ -7,7 +7,15 @@ import (
 
 // Typed errors
 var (
-	ErrTeamMemberAlreadyAdded = errors.New("User is already added to this team")
+	ErrTeamMemberAlreadyAdded    = errors.New("User is already added to this team")
+	ErrTeamMemberRemovedManually = errors.New("User was removed from this team manually")
+)
+
+// The policies of the team syncs for the external members removed from
+// the team manually: the sync adds them back, or leaves them out
+const (
+	TeamMemberRemovalOverride = "override"
+	TeamMemberRemovalRespect  = "respect"
 )
 
 // TeamMember model
@@ -19,19 +27,39 @@ type TeamMember struct {
 	External   bool // Signals that the membership has been created by an external systems, such as LDAP
 	Permission PermissionType
 
+	// The external system and the group of the user in it the membership comes from, like ldap and the group DN
+	ExternalSource string
+	ExternalGroup  string
+
 	Created time.Time
 	Updated time.Time
 }
 
+// TeamMemberRemoval is the manual removal of an external member of the
+// team, the team sync leaves it out of the team with TeamMemberRemovalRespect
+type TeamMemberRemoval struct {
+	Id      int64
+	OrgId   int64
+	TeamId  int64
+	UserId  int64
+	Created time.Time
+}
+
 // ---------------------
 // COMMANDS
 
+// AddTeamMemberCommand adds the user to the team. An external member
+// removed manually isn't added back if the ManualRemovals policy is
+// TeamMemberRemovalRespect, the manual adds clear the removal
 type AddTeamMemberCommand struct {
-	UserId     int64          `json:"userId" binding:"Required"`
-	OrgId      int64          `json:"-"`
-	TeamId     int64          `json:"-"`
-	External   bool           `json:"-"`
-	Permission PermissionType `json:"-"`
+	UserId         int64          `json:"userId" binding:"Required"`
+	OrgId          int64          `json:"-"`
+	TeamId         int64          `json:"-"`
+	External       bool           `json:"-"`
+	ExternalSource string         `json:"-"`
+	ExternalGroup  string         `json:"-"`
+	ManualRemovals string         `json:"-"`
+	Permission     PermissionType `json:"-"`
 }
 
 type UpdateTeamMemberCommand struct {
@@ -42,11 +70,14 @@ type UpdateTeamMemberCommand struct {
 	ProtectLastAdmin bool           `json:"-"`
 }
 
+// RemoveTeamMemberCommand removes the user from the team, the removal
+// of an external member is recorded if Manual
 type RemoveTeamMemberCommand struct {
 	OrgId            int64 `json:"-"`
 	UserId           int64
 	TeamId           int64
 	ProtectLastAdmin bool `json:"-"`
+	Manual           bool `json:"-"`
 }
 
 // ----------------------
@@ -73,4 +104,7 @@ type TeamMemberDTO struct {
 	AvatarUrl  string         `json:"avatarUrl"`
 	Labels     []string       `json:"labels"`
 	Permission PermissionType `json:"permission"`
+
+	ExternalSource string `json:"externalSource,omitempty"`
+	ExternalGroup  string `json:"externalGroup,omitempty"`
 }
@@ -203,6 +203,9 @@ type UserProfileDTO struct {
 	Theme          string `json:"theme"`
 	OrgId          int64  `json:"orgId"`
 	IsGrafanaAdmin bool   `json:"isGrafanaAdmin"`
+
+	// Attributes are the external attributes of the user by name, see UserAttribute
+	Attributes map[string]string `json:"attributes,omitempty"`
 }
 
 type UserSearchHitDTO struct {
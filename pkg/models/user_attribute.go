@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// UserAttribute is an attribute of the user read from an external
+// source, like the cost center or the manager of the LDAP users
+type UserAttribute struct {
+	Id      int64
+	UserId  int64
+	Source  string
+	Name    string
+	Value   string
+	Updated time.Time
+}
+
+// ---------------------
+// COMMANDS
+
+// SetUserAttributesCommand replaces the attributes of the user from the
+// source with the Attributes by name, the unchanged ones are kept as is
+type SetUserAttributesCommand struct {
+	UserId     int64
+	Source     string
+	Attributes map[string]string
+}
+
+// ---------------------
+// QUERIES
+
+type GetUserAttributesQuery struct {
+	UserId int64
+	Result []*UserAttribute
+}
@@ -29,6 +29,19 @@ type ExternalUserInfo struct {
 	Groups         []string
 	OrgRoles       map[int64]RoleType
 	IsGrafanaAdmin *bool // This is a pointer to know if we should sync this or not (nil = ignore sync)
+
+	// GroupDetails describes the Groups the auth module read more of
+	// than their id, like their name, for the team sync
+	GroupDetails []*ExternalGroup
+}
+
+// ExternalGroup is one of the groups of an external user, Id is its
+// value in the Groups of the user
+type ExternalGroup struct {
+	Id          string
+	Name        string
+	Description string
+	GidNumber   string
 }
 
 // ---------------------
@@ -69,6 +82,24 @@ type LoginUserQuery struct {
 	Password   string
 	User       *User
 	IpAddress  string
+
+	// SecondFactorCode is the TOTP code of the users whose LDAP groups require a second factor
+	SecondFactorCode string
+
+	// NonInteractive is set by the basic auth of the API requests, the
+	// only logins of the LDAP service accounts
+	NonInteractive bool
+
+	// PasswordPolicy is set by the LDAP login when the password policy of the directory warns the user
+	PasswordPolicy *PasswordPolicyWarning
+}
+
+// PasswordPolicyWarning holds the warnings of an LDAP password policy on a successful login
+type PasswordPolicyWarning struct {
+	// ExpiresIn is the time left before the password expires, zero if the policy didn't tell
+	ExpiresIn time.Duration
+	// GraceLogins is the number of logins left with the expired password, -1 if it didn't expire
+	GraceLogins int
 }
 
 type GetUserByAuthInfoQuery struct {
@@ -89,7 +120,17 @@ type GetAuthInfoQuery struct {
 	Result *UserAuth
 }
 
+// GetAuthInfoListQuery returns the auth infos of all the users of the
+// auth module, without their OAuth tokens
+type GetAuthInfoListQuery struct {
+	AuthModule string
+	Result     []*UserAuth
+}
+
+// SyncTeamsCommand syncs the teams of the user with its external groups,
+// the ManualRemovals policy applies to the members removed manually
 type SyncTeamsCommand struct {
-	ExternalUser *ExternalUserInfo
-	User         *User
+	ExternalUser   *ExternalUserInfo
+	User           *User
+	ManualRemovals string
 }
@@ -30,6 +30,12 @@ type RevokeAuthTokenCmd struct {
 	AuthTokenId int64 `json:"authTokenId"`
 }
 
+// RevokeAllUserTokensCommand revokes all the sessions of a user through
+// the bus, for the services which don't hold the UserTokenService
+type RevokeAllUserTokensCommand struct {
+	UserId int64
+}
+
 // UserTokenService are used for generating and validating user tokens
 type UserTokenService interface {
 	CreateToken(ctx context.Context, userId int64, clientIP, userAgent string) (*UserToken, error)
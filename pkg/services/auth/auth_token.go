@@ -8,6 +8,7 @@ import (
 
 	"github.com/grafana/grafana/pkg/infra/serverlock"
 
+	"github.com/grafana/grafana/pkg/bus"
 	"github.com/grafana/grafana/pkg/infra/log"
 	"github.com/grafana/grafana/pkg/models"
 	"github.com/grafana/grafana/pkg/registry"
@@ -33,9 +34,14 @@ type UserAuthTokenService struct {
 
 func (s *UserAuthTokenService) Init() error {
 	s.log = log.New("auth")
+	bus.AddHandlerCtx("auth", s.revokeAllUserTokensCommand)
 	return nil
 }
 
+func (s *UserAuthTokenService) revokeAllUserTokensCommand(ctx context.Context, cmd *models.RevokeAllUserTokensCommand) error {
+	return s.RevokeAllUserTokens(ctx, cmd.UserId)
+}
+
 func (s *UserAuthTokenService) ActiveTokenCount(ctx context.Context) (int64, error) {
 
 	var count int64
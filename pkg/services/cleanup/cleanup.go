@@ -12,6 +12,7 @@ import (
 	"github.com/grafana/grafana/pkg/infra/serverlock"
 	m "github.com/grafana/grafana/pkg/models"
 	"github.com/grafana/grafana/pkg/registry"
+	"github.com/grafana/grafana/pkg/services/ldap"
 	"github.com/grafana/grafana/pkg/setting"
 )
 
@@ -42,6 +43,7 @@ func (srv *CleanUpService) Run(ctx context.Context) error {
 			srv.deleteExpiredDashboardVersions()
 			srv.ServerLockService.LockAndExecute(ctx, "delete old login attempts", time.Minute*10, func() {
 				srv.deleteOldLoginAttempts()
+				srv.deleteOldLdapLoginAttempts()
 			})
 
 		case <-ctx.Done():
@@ -121,3 +123,19 @@ func (srv *CleanUpService) deleteOldLoginAttempts() {
 		srv.log.Debug("Deleted expired login attempts", "rows affected", cmd.DeletedRows)
 	}
 }
+
+func (srv *CleanUpService) deleteOldLdapLoginAttempts() {
+	if !setting.LdapLoginAudit {
+		return
+	}
+
+	cmd := m.DeleteOldLoginAttemptsCommand{
+		OlderThan:  time.Now().Add(-setting.LdapLoginAuditRetention),
+		AuthModule: ldap.AuthModule,
+	}
+	if err := bus.Dispatch(&cmd); err != nil {
+		srv.log.Error("Problem deleting expired LDAP login attempts", "error", err.Error())
+	} else {
+		srv.log.Debug("Deleted expired LDAP login attempts", "rows affected", cmd.DeletedRows)
+	}
+}
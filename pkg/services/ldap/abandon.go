@@ -0,0 +1,187 @@
+package ldap
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	ber "gopkg.in/asn1-ber.v1"
+	LDAP "gopkg.in/ldap.v3"
+)
+
+// abandonMessageID is the message ID of the Abandon requests. ldap.v3
+// numbers its requests from 1 and the Abandon requests are never answered,
+// so the highest message ID is never in use when one is sent
+const abandonMessageID = math.MaxInt32
+
+// abandoningConn is the network connection of an ldap.v3 connection. The
+// library keeps the message IDs of its requests to itself and can't send
+// an Abandon request, so the message IDs of the searches are read from
+// the requests written through the connection, and the Abandon requests
+// are written to it in between them
+type abandoningConn struct {
+	net.Conn
+
+	mutex sync.Mutex
+	// watched counts the searches of each searchKey about to be written,
+	// written holds the message IDs of the ones written, oldest first
+	watched map[string]int
+	written map[string][]int64
+}
+
+// searchKey identifies the search of the request, the searches written
+// concurrently with the same key are interchangeable
+func searchKey(baseDN string, scope int64, filter []byte, attributes []string) string {
+	return fmt.Sprintf("%s\x00%d\x00%x\x00%s", baseDN, scope, filter, strings.Join(attributes, "\x00"))
+}
+
+// writtenSearchKey returns the searchKey of the search request written,
+// in the order ldap.v3 encodes its fields
+func writtenSearchKey(request *ber.Packet) (string, bool) {
+	if len(request.Children) < 8 {
+		return "", false
+	}
+	baseDN, ok := request.Children[0].Value.(string)
+	if !ok {
+		return "", false
+	}
+	scope, ok := request.Children[1].Value.(int64)
+	if !ok {
+		return "", false
+	}
+
+	attributes := make([]string, 0, len(request.Children[7].Children))
+	for _, attribute := range request.Children[7].Children {
+		value, _ := attribute.Value.(string)
+		attributes = append(attributes, value)
+	}
+	return searchKey(baseDN, scope, request.Children[6].Bytes(), attributes), true
+}
+
+// Write writes a request of the connection, ldap.v3 writes each in a
+// single call
+func (c *abandoningConn) Write(b []byte) (int, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if packet, err := ber.DecodePacketErr(b); err == nil && len(packet.Children) >= 2 {
+		request := packet.Children[1]
+		if messageID, ok := packet.Children[0].Value.(int64); ok &&
+			request.ClassType == ber.ClassApplication && request.Tag == LDAP.ApplicationSearchRequest {
+			if key, ok := writtenSearchKey(request); ok && c.watched[key] > 0 {
+				if c.watched[key]--; c.watched[key] == 0 {
+					delete(c.watched, key)
+				}
+				c.written[key] = append(c.written[key], messageID)
+			}
+		}
+	}
+	return c.Conn.Write(b)
+}
+
+// watchSearch makes the next search written with the key keep its message ID
+func (c *abandoningConn) watchSearch(key string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.watched == nil {
+		c.watched, c.written = map[string]int{}, map[string][]int64{}
+	}
+	c.watched[key]++
+}
+
+// takeSearch returns the message ID of the oldest search written with the
+// key and forgets it, or stops watching the key and returns 0 if the
+// search was never written
+func (c *abandoningConn) takeSearch(key string) int64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	messageIDs := c.written[key]
+	if len(messageIDs) == 0 {
+		if c.watched[key]--; c.watched[key] <= 0 {
+			delete(c.watched, key)
+		}
+		return 0
+	}
+
+	if len(messageIDs) == 1 {
+		delete(c.written, key)
+	} else {
+		c.written[key] = messageIDs[1:]
+	}
+	return messageIDs[0]
+}
+
+// abandon asks the directory to stop processing the request
+func (c *abandoningConn) abandon(messageID int64) error {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Request")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, int64(abandonMessageID), "MessageID"))
+	packet.AppendChild(ber.NewInteger(ber.ClassApplication, ber.TypePrimitive, LDAP.ApplicationAbandonRequest, messageID, "Abandon Request"))
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	_, err := c.Conn.Write(packet.Bytes())
+	return err
+}
+
+// SetTimeout sets the time after which the requests time out, the
+// searches timing out are abandoned
+func (conn *ldapConnection) SetTimeout(timeout time.Duration) {
+	conn.timeoutMutex.Lock()
+	defer conn.timeoutMutex.Unlock()
+
+	conn.timeout = timeout
+	conn.Conn.SetTimeout(timeout)
+}
+
+// Search sends the search, abandoning it when it times out instead of
+// leaving the directory processing a search nobody waits for anymore
+func (conn *ldapConnection) Search(request *LDAP.SearchRequest) (*LDAP.SearchResult, error) {
+	conn.timeoutMutex.Lock()
+	timeout := conn.timeout
+	conn.timeoutMutex.Unlock()
+
+	if timeout <= 0 {
+		return conn.Conn.Search(request)
+	}
+
+	// ldap.v3 refuses the invalid filters before writing anything
+	filter, err := LDAP.CompileFilter(request.Filter)
+	if err != nil {
+		return conn.Conn.Search(request)
+	}
+
+	key := searchKey(request.BaseDN, int64(request.Scope), filter.Bytes(), request.Attributes)
+	conn.network.watchSearch(key)
+	result, err := conn.Conn.Search(request)
+	if messageID := conn.network.takeSearch(key); messageID > 0 && isTimeout(err) {
+		if abandonErr := conn.network.abandon(messageID); abandonErr != nil {
+			logger.Debug("Failed to abandon the LDAP search", "error", abandonErr)
+		}
+	}
+	return result, err
+}
+
+// TLSConnectionState returns the TLS state of the connection, ldap.v3 only
+// finds it on its own TLS connections
+func (conn *ldapConnection) TLSConnectionState() (tls.ConnectionState, bool) {
+	tlsConn, ok := conn.network.Conn.(*tls.Conn)
+	if !ok {
+		return tls.ConnectionState{}, false
+	}
+	return tlsConn.ConnectionState(), true
+}
+
+// StartTLS can't upgrade the started connection, the reads and writes of
+// ldap.v3 would bypass the TLS connection. dialStartTLS upgrades the network
+// connection before starting it
+func (conn *ldapConnection) StartTLS(*tls.Config) error {
+	return LDAP.NewError(LDAP.ErrorNetwork, errors.New("ldap: StartTLS is sent when dialing"))
+}
@@ -0,0 +1,156 @@
+package ldap
+
+import (
+	"crypto/tls"
+	"net"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/net/proxy"
+	ber "gopkg.in/asn1-ber.v1"
+	LDAP "gopkg.in/ldap.v3"
+)
+
+// serveUnansweredSearches reads the requests of the connection without
+// answering the searches, sending the message IDs of the searches and of
+// the abandoned requests. With a certificate, the StartTLS request is
+// answered and the connection upgraded first
+func serveUnansweredSearches(conn net.Conn, certificate *tls.Certificate, searches, abandoned chan<- int64) {
+	defer conn.Close()
+
+	if certificate != nil {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+		response := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+		response.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, packet.Children[0].Value, "MessageID"))
+		result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, LDAP.ApplicationExtendedResponse, nil, "Extended Response")
+		result.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(LDAP.LDAPResultSuccess), "Result Code"))
+		result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+		result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Diagnostic Message"))
+		response.AppendChild(result)
+		if _, err := conn.Write(response.Bytes()); err != nil {
+			return
+		}
+
+		tlsConn := tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{*certificate}})
+		if err := tlsConn.Handshake(); err != nil {
+			return
+		}
+		conn = tlsConn
+	}
+
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+		request := packet.Children[1]
+		switch request.Tag {
+		case LDAP.ApplicationSearchRequest:
+			searches <- packet.Children[0].Value.(int64)
+		case LDAP.ApplicationAbandonRequest:
+			// the values of the application tags aren't decoded
+			messageID, _ := ber.ParseInt64(request.Data.Bytes())
+			abandoned <- messageID
+		}
+	}
+}
+
+func TestAbandonedSearches(t *testing.T) {
+	Convey("Abandoning the searches", t, func() {
+		searches, abandoned := make(chan int64, 10), make(chan int64, 10)
+		request := &LDAP.SearchRequest{
+			BaseDN: "dc=grafana,dc=org",
+			Scope:  LDAP.ScopeWholeSubtree,
+			Filter: "(uid=*)",
+		}
+
+		Convey("Should abandon the search which timed out", func() {
+			client, server := net.Pipe()
+			go serveUnansweredSearches(server, nil, searches, abandoned)
+
+			conn := newLDAPConnection(client, false)
+			defer conn.Close()
+			conn.SetTimeout(50 * time.Millisecond)
+
+			_, err := conn.Search(request)
+			So(isTimeout(err), ShouldBeTrue)
+
+			searched := <-searches
+			So(<-abandoned, ShouldEqual, searched)
+
+			_, err = conn.Search(request)
+			So(isTimeout(err), ShouldBeTrue)
+			So(<-searches, ShouldBeGreaterThan, searched)
+		})
+
+		Convey("Should not wait for the other searches to abandon its own", func() {
+			client, server := net.Pipe()
+			go serveUnansweredSearches(server, nil, searches, abandoned)
+
+			conn := newLDAPConnection(client, false)
+			defer conn.Close()
+			conn.SetTimeout(200 * time.Millisecond)
+
+			done := make(chan error, 2)
+			for _, filter := range []string{"(uid=roel)", "(uid=torkel)"} {
+				go func(filter string) {
+					_, err := conn.Search(&LDAP.SearchRequest{BaseDN: request.BaseDN, Scope: request.Scope, Filter: filter})
+					done <- err
+				}(filter)
+			}
+
+			searched := map[int64]bool{<-searches: true, <-searches: true}
+			So(abandoned, ShouldBeEmpty)
+
+			So(isTimeout(<-done), ShouldBeTrue)
+			So(isTimeout(<-done), ShouldBeTrue)
+			So(searched, ShouldResemble, map[int64]bool{<-abandoned: true, <-abandoned: true})
+			So(conn.network.watched, ShouldBeEmpty)
+			So(conn.network.written, ShouldBeEmpty)
+		})
+
+		Convey("Should not abandon anything without a timeout", func() {
+			client, server := net.Pipe()
+			go serveUnansweredSearches(server, nil, searches, abandoned)
+
+			conn := newLDAPConnection(client, false)
+			go conn.Search(request)
+
+			<-searches
+			conn.Close()
+			So(abandoned, ShouldBeEmpty)
+		})
+
+		Convey("Should abandon the search of a StartTLS connection through TLS", func() {
+			cert, key := newTestCertificate(nil, nil, 1)
+			certificate := &tls.Certificate{Certificate: [][]byte{cert.Raw}, PrivateKey: key}
+
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			So(err, ShouldBeNil)
+			defer listener.Close()
+			go func() {
+				server, err := listener.Accept()
+				if err == nil {
+					serveUnansweredSearches(server, certificate, searches, abandoned)
+				}
+			}()
+
+			dialed, err := dialStartTLS(proxy.Direct, "tcp", listener.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+			So(err, ShouldBeNil)
+			conn := dialed.(*ldapConnection)
+			defer conn.Close()
+
+			_, ok := conn.TLSConnectionState()
+			So(ok, ShouldBeTrue)
+
+			conn.SetTimeout(50 * time.Millisecond)
+			_, err = conn.Search(request)
+			So(isTimeout(err), ShouldBeTrue)
+			So(<-abandoned, ShouldEqual, <-searches)
+		})
+	})
+}
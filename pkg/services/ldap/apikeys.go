@@ -0,0 +1,26 @@
+package ldap
+
+import (
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// IsApiKeyGatingEnabled checks if only the members of LDAP groups may create API keys
+func IsApiKeyGatingEnabled() bool {
+	return IsEnabled() && len(setting.LdapApiKeyGroups) > 0
+}
+
+// MayHoldApiKeys checks if the user is a member of one of the
+// api_key_groups, or protected. The wildcard isn't followed
+// there since it would let anyone in
+func MayHoldApiKeys(user *UserInfo) bool {
+	if IsProtectedUser(user) {
+		return true
+	}
+
+	for _, group := range setting.LdapApiKeyGroups {
+		if group != "*" && user.isMemberOf(group) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,28 @@
+package ldap
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+func TestApiKeyGroups(t *testing.T) {
+	Convey("MayHoldApiKeys", t, func() {
+		defer func(groups, users []string) {
+			setting.LdapApiKeyGroups, setting.LdapSyncProtectedUsers = groups, users
+		}(setting.LdapApiKeyGroups, setting.LdapSyncProtectedUsers)
+		setting.LdapApiKeyGroups = []string{"cn=automation,dc=grafana,dc=org", "*"}
+
+		Convey("Should only let the members of the groups hold API keys", func() {
+			So(MayHoldApiKeys(&UserInfo{Username: "tod", MemberOf: []string{"CN=Automation,dc=grafana,dc=org"}}), ShouldBeTrue)
+			So(MayHoldApiKeys(&UserInfo{Username: "tod", MemberOf: []string{"cn=users,dc=grafana,dc=org"}}), ShouldBeFalse)
+		})
+
+		Convey("Should let the protected users hold API keys", func() {
+			setting.LdapSyncProtectedUsers = []string{"break-glass"}
+			So(MayHoldApiKeys(&UserInfo{Username: "break-glass"}), ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,57 @@
+package ldap
+
+import (
+	"sort"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+// storedAttributeNames returns the LDAP attributes of the
+// stored_attributes and the manager_attribute to search for, sorted
+func (server *ServerConfig) storedAttributeNames() []string {
+	names := make([]string, 0, len(server.StoredAttributes)+1)
+	for _, attribute := range server.StoredAttributes {
+		names = appendIfNotEmpty(names, attribute)
+	}
+	names = appendIfNotEmpty(names, server.ManagerAttribute)
+	sort.Strings(names)
+	return names
+}
+
+// readStoredAttributes reads the stored_attributes of the entry, the
+// attributes without a value are left out
+func (server *ServerConfig) readStoredAttributes(entry *entryAttributes) map[string]string {
+	if len(server.StoredAttributes) == 0 {
+		return nil
+	}
+
+	attributes := map[string]string{}
+	for name, attribute := range server.StoredAttributes {
+		if value := entry.value(attribute); value != "" {
+			attributes[name] = value
+		}
+	}
+	return attributes
+}
+
+// StoreAttributes saves the stored_attributes of the LDAP user with its
+// Grafana user, only the changed ones are written, and links the Grafana
+// user to the GUID of the entry for RelinkUser
+func (auth *Auth) StoreAttributes(user *UserInfo, userId int64) error {
+	if IsProtectedUser(user) {
+		return nil
+	}
+	if err := auth.storeGUID(user, userId); err != nil {
+		return err
+	}
+	if len(auth.server.StoredAttributes) == 0 && auth.server.ManagerAttribute == "" {
+		return nil
+	}
+
+	return bus.Dispatch(&models.SetUserAttributesCommand{
+		UserId:     userId,
+		Source:     AuthModule,
+		Attributes: user.Attributes,
+	})
+}
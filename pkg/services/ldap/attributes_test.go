@@ -0,0 +1,70 @@
+package ldap
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	LDAP "gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+func TestStoredAttributes(t *testing.T) {
+	Convey("Stored attributes", t, func() {
+		defer bus.ClearBusHandlers()
+
+		auth := &Auth{
+			log: log.New("test-logger"),
+			server: &ServerConfig{
+				Attr: AttributeMap{Username: "uid"},
+				StoredAttributes: map[string]string{
+					"cost_center": "departmentNumber",
+					"manager":     "manager",
+					"region":      "l",
+				},
+			},
+		}
+
+		Convey("Should search for the LDAP attributes", func() {
+			So(auth.server.storedAttributeNames(), ShouldResemble, []string{"departmentNumber", "l", "manager"})
+		})
+
+		Convey("Should read the attributes of the users", func() {
+			result := &LDAP.SearchResult{Entries: []*LDAP.Entry{{
+				DN: "uid=roel,ou=users,dc=grafana,dc=org",
+				Attributes: []*LDAP.EntryAttribute{
+					{Name: "uid", Values: []string{"roel"}},
+					{Name: "departmentNumber", Values: []string{"4200"}},
+					{Name: "manager", Values: []string{"uid=tod,ou=users,dc=grafana,dc=org"}},
+				},
+			}}}
+
+			users := auth.serializeUsers(result, auth.server.Attr)
+			So(users[0].Attributes, ShouldResemble, map[string]string{
+				"cost_center": "4200",
+				"manager":     "uid=tod,ou=users,dc=grafana,dc=org",
+			})
+		})
+
+		Convey("Should store the attributes with the Grafana user", func() {
+			var stored *models.SetUserAttributesCommand
+			bus.AddHandler("test", func(cmd *models.SetUserAttributesCommand) error {
+				stored = cmd
+				return nil
+			})
+
+			user := &UserInfo{Username: "roel", Attributes: map[string]string{"region": "emea"}}
+			So(auth.StoreAttributes(user, 42), ShouldBeNil)
+			So(stored.UserId, ShouldEqual, 42)
+			So(stored.Source, ShouldEqual, "ldap")
+			So(stored.Attributes, ShouldResemble, user.Attributes)
+
+			stored = nil
+			auth.server.StoredAttributes = nil
+			So(auth.StoreAttributes(user, 42), ShouldBeNil)
+			So(stored, ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,116 @@
+package ldap
+
+import (
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/infra/metrics"
+	models "github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// AuthModule is the auth module of the login attempts saved for auditing
+const AuthModule = "ldap"
+
+// resultClasses are the result classes of the audited login attempts,
+// besides "success" and "error" for the other errors. They're also the
+// codes of the login errors answered to the login form
+var resultClasses = []struct {
+	err   error
+	class string
+}{
+	{ErrInvalidCredentials, "invalid_credentials"},
+	{ErrCouldNotFindUser, "invalid_credentials"},
+	{ErrServiceBindFailed, "service_bind_failed"},
+	{ErrCertificateRevoked, "certificate_revoked"},
+	{ErrServerUnavailable, "server_unavailable"},
+	{ErrTimeout, "timeout"},
+	{ErrInsufficientAccess, "insufficient_access"},
+	{ErrConstraintViolation, "constraint_violation"},
+	{ErrPasswordExpired, "password_expired"},
+	{ErrAccountLocked, "account_locked"},
+	{ErrPasswordMustChange, "password_must_change"},
+	{ErrHBACDenied, "hbac_denied"},
+	{ErrServiceAccountInteractiveLogin, "service_account_interactive"},
+	{ErrEmailDomainNotAllowed, "email_domain_not_allowed"},
+	{ErrLoginCollision, "login_collision"},
+	{ErrOutsideLogonHours, "outside_logon_hours"},
+	{ErrAccountExpired, "account_expired"},
+	{ErrSecondFactorRequired, "second_factor_required"},
+	{ErrInvalidSecondFactor, "invalid_second_factor"},
+	{ErrSecondFactorNotEnrolled, "second_factor_not_enrolled"},
+	{models.ErrLdapUserDisabled, "user_disabled"},
+}
+
+// ResultClass returns the result class of the login error
+func ResultClass(err error) string {
+	if err == nil {
+		return "success"
+	}
+
+	for _, resultClass := range resultClasses {
+		if xerrors.Is(err, resultClass.err) {
+			return resultClass.class
+		}
+	}
+
+	return "error"
+}
+
+// recordLoginFailure counts the logins failing for a login the server
+// doesn't have apart from the ones failing for a wrong password
+func (auth *Auth) recordLoginFailure(err error) {
+	reason := ""
+	switch err {
+	case ErrCouldNotFindUser:
+		reason = "user_not_found"
+	case ErrInvalidCredentials:
+		reason = "invalid_credentials"
+	default:
+		return
+	}
+	metrics.M_Ldap_Login_Failures.WithLabelValues(ServerKey(auth.server), reason).Inc()
+}
+
+// AuditLogin saves the login attempt against the server for security
+// reviews if login_audit is enabled, the attempts are deleted after
+// login_audit_retention
+func AuditLogin(server *ServerConfig, query *models.LoginUserQuery, err error, elapsed time.Duration) {
+	if !setting.LdapLoginAudit {
+		return
+	}
+
+	cmd := &models.CreateLoginAttemptCommand{
+		Username:    query.Username,
+		IpAddress:   query.IpAddress,
+		AuthModule:  AuthModule,
+		Server:      ServerKey(server),
+		ResultClass: ResultClass(err),
+		Duration:    elapsed,
+	}
+
+	if err := bus.Dispatch(cmd); err != nil {
+		logger.Warn("Failed to save LDAP login attempt", "error", err)
+	}
+}
+
+// auditRelink saves the relink of the Grafana user of the moved entry
+// with the login attempts if login_audit is enabled
+func (auth *Auth) auditRelink(user *UserInfo) {
+	if !setting.LdapLoginAudit {
+		return
+	}
+
+	cmd := &models.CreateLoginAttemptCommand{
+		Username:    user.Username,
+		AuthModule:  AuthModule,
+		Server:      ServerKey(auth.server),
+		ResultClass: relinkedClass,
+	}
+
+	if err := bus.Dispatch(cmd); err != nil {
+		auth.log.Warn("Failed to save LDAP relink", "error", err)
+	}
+}
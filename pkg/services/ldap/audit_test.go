@@ -0,0 +1,78 @@
+package ldap
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/infra/metrics"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+func TestLoginAudit(t *testing.T) {
+	Convey("resultClass", t, func() {
+		So(ResultClass(nil), ShouldEqual, "success")
+		So(ResultClass(ErrInvalidCredentials), ShouldEqual, "invalid_credentials")
+		So(ResultClass(ErrCouldNotFindUser), ShouldEqual, "invalid_credentials")
+		So(ResultClass(&ClassifiedError{Kind: ErrTimeout, Err: errors.New("")}), ShouldEqual, "timeout")
+		So(ResultClass(errors.New("unknown")), ShouldEqual, "error")
+	})
+
+	Convey("recordLoginFailure", t, func() {
+		auth := &Auth{server: &ServerConfig{Host: "failures", Port: 389}}
+		count := func(reason string) float64 {
+			metric := &dto.Metric{}
+			if err := metrics.M_Ldap_Login_Failures.WithLabelValues("failures:389", reason).Write(metric); err != nil {
+				panic(err)
+			}
+			return metric.Counter.GetValue()
+		}
+		notFound, invalid := count("user_not_found"), count("invalid_credentials")
+
+		auth.recordLoginFailure(ErrCouldNotFindUser)
+		auth.recordLoginFailure(ErrInvalidCredentials)
+		auth.recordLoginFailure(ErrInvalidCredentials)
+		auth.recordLoginFailure(ErrServerUnavailable)
+
+		So(count("user_not_found"), ShouldEqual, notFound+1)
+		So(count("invalid_credentials"), ShouldEqual, invalid+2)
+	})
+
+	Convey("AuditLogin", t, func() {
+		defer bus.ClearBusHandlers()
+		defer func() { setting.LdapLoginAudit = false }()
+
+		var saved *models.CreateLoginAttemptCommand
+		bus.AddHandler("test", func(cmd *models.CreateLoginAttemptCommand) error {
+			saved = cmd
+			return nil
+		})
+
+		server := &ServerConfig{Host: "ldap", Port: 389}
+		query := &models.LoginUserQuery{Username: "roel", IpAddress: "192.168.1.1:56433"}
+
+		Convey("Should not save the attempt by default", func() {
+			AuditLogin(server, query, nil, time.Second)
+			So(saved, ShouldBeNil)
+		})
+
+		Convey("Should save the attempt with its result class", func() {
+			setting.LdapLoginAudit = true
+
+			AuditLogin(server, query, ErrInvalidCredentials, time.Second)
+			So(saved, ShouldResemble, &models.CreateLoginAttemptCommand{
+				Username:    "roel",
+				IpAddress:   "192.168.1.1:56433",
+				AuthModule:  "ldap",
+				Server:      "ldap:389",
+				ResultClass: "invalid_credentials",
+				Duration:    time.Second,
+			})
+		})
+	})
+}
@@ -0,0 +1,98 @@
+package ldap
+
+import (
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+
+	"golang.org/x/xerrors"
+	LDAP "gopkg.in/ldap.v3"
+)
+
+var (
+	// ErrSigningRequired is returned if the server refused a bind over a plain
+	// connection since it requires LDAP signing, which the simple binds only get from TLS
+	ErrSigningRequired = errors.New("LDAP server requires signing, set use_ssl to bind over TLS")
+
+	// ErrChannelBindingUnavailable is returned with channel_binding if the
+	// connection has no server certificate to derive the channel binding from
+	ErrChannelBindingUnavailable = errors.New("LDAP connection can't be channel bound")
+)
+
+// channelBindingPrefix is the prefix of the tls-server-end-point channel binding data, see RFC 5929
+const channelBindingPrefix = "tls-server-end-point:"
+
+// channelBindingToken is the tls-server-end-point channel binding of RFC 5929,
+// the hash of the server certificate: SHA-256 for the MD5 and SHA-1
+// signatures, else the hash of the signature. This is what the domain
+// controllers enforcing LDAP channel binding compare with the one of the bind
+func channelBindingToken(state tls.ConnectionState) ([]byte, error) {
+	if len(state.PeerCertificates) == 0 {
+		return nil, ErrChannelBindingUnavailable
+	}
+	cert := state.PeerCertificates[0]
+
+	var hash crypto.Hash
+	switch cert.SignatureAlgorithm {
+	case x509.MD5WithRSA, x509.SHA1WithRSA, x509.DSAWithSHA1, x509.ECDSAWithSHA1,
+		x509.SHA256WithRSA, x509.SHA256WithRSAPSS, x509.DSAWithSHA256, x509.ECDSAWithSHA256:
+		hash = crypto.SHA256
+	case x509.SHA384WithRSA, x509.SHA384WithRSAPSS, x509.ECDSAWithSHA384:
+		hash = crypto.SHA384
+	case x509.SHA512WithRSA, x509.SHA512WithRSAPSS, x509.ECDSAWithSHA512:
+		hash = crypto.SHA512
+	default:
+		return nil, xerrors.Errorf("%v: unsupported signature algorithm %v", ErrChannelBindingUnavailable, cert.SignatureAlgorithm)
+	}
+
+	digest := hash.New()
+	digest.Write(cert.Raw)
+	return append([]byte(channelBindingPrefix), digest.Sum(nil)...), nil
+}
+
+// bindChannel derives the channel binding of the connection when the
+// server sets channel_binding, the connections which can't be bound are refused
+func (auth *Auth) bindChannel(conn IConnection) error {
+	if !auth.server.ChannelBinding {
+		return nil
+	}
+
+	stater, ok := conn.(tlsStater)
+	if !ok {
+		return ErrChannelBindingUnavailable
+	}
+	state, ok := stater.TLSConnectionState()
+	if !ok {
+		return ErrChannelBindingUnavailable
+	}
+
+	token, err := channelBindingToken(state)
+	if err != nil {
+		return err
+	}
+
+	auth.channelBinding = token
+	return nil
+}
+
+// signingError is ErrSigningRequired if err is the bind over a plain
+// connection a server requiring LDAP signing refused, else err
+func (auth *Auth) signingError(err error) error {
+	if auth.server.UseSSL {
+		return err
+	}
+
+	if ldapErr, ok := err.(*LDAP.Error); ok && ldapErr.ResultCode == LDAP.LDAPResultStrongAuthRequired {
+		return ErrSigningRequired
+	}
+	return err
+}
+
+// validateChannelBinding checks channel_binding is only set for the servers connected over TLS
+func validateChannelBinding(server *ServerConfig) error {
+	if server.ChannelBinding && !server.UseSSL {
+		return xerrors.Errorf("LDAP server %v must set use_ssl for channel_binding", ServerKey(server))
+	}
+	return nil
+}
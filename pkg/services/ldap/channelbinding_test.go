@@ -0,0 +1,80 @@
+package ldap
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	LDAP "gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+)
+
+func TestChannelBinding(t *testing.T) {
+	cert, _ := newTestCertificate(nil, nil, 1)
+
+	Convey("channelBindingToken", t, func() {
+		Convey("Should hash the server certificate", func() {
+			token, err := channelBindingToken(tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}})
+			So(err, ShouldBeNil)
+
+			digest := sha256.Sum256(cert.Raw)
+			So(string(token), ShouldEqual, channelBindingPrefix+string(digest[:]))
+		})
+
+		Convey("Should fail without a server certificate", func() {
+			_, err := channelBindingToken(tls.ConnectionState{})
+			So(err, ShouldEqual, ErrChannelBindingUnavailable)
+		})
+	})
+
+	Convey("bindChannel", t, func() {
+		auth := &Auth{server: &ServerConfig{UseSSL: true, ChannelBinding: true}}
+
+		Convey("Should keep the channel binding of the TLS connections", func() {
+			conn := &tlsLdapConn{state: tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}}
+
+			So(auth.bindChannel(conn), ShouldBeNil)
+			So(auth.channelBinding, ShouldNotBeEmpty)
+		})
+
+		Convey("Should refuse the plain connections", func() {
+			So(auth.bindChannel(&mockLdapConn{}), ShouldEqual, ErrChannelBindingUnavailable)
+		})
+
+		Convey("Should leave the connections alone without channel_binding", func() {
+			auth.server.ChannelBinding = false
+			So(auth.bindChannel(&mockLdapConn{}), ShouldBeNil)
+		})
+	})
+
+	Convey("signingError", t, func() {
+		strongAuthRequired := &LDAP.Error{ResultCode: LDAP.LDAPResultStrongAuthRequired, Err: errors.New("")}
+		auth := &Auth{
+			server: &ServerConfig{BindDN: "cn=admin", BindPassword: "secret"},
+			conn: &mockLdapConn{
+				bindProvider: func(username, password string) error {
+					return strongAuthRequired
+				},
+			},
+			log: log.New("test-logger"),
+		}
+
+		Convey("Should tell the binds refused for signing", func() {
+			So(auth.serverBind(), ShouldEqual, ErrSigningRequired)
+		})
+
+		Convey("Should leave the errors over TLS alone", func() {
+			auth.server.UseSSL = true
+			So(auth.serverBind(), ShouldEqual, strongAuthRequired)
+		})
+	})
+
+	Convey("validateChannelBinding", t, func() {
+		So(validateChannelBinding(&ServerConfig{ChannelBinding: true, UseSSL: true}), ShouldBeNil)
+		So(validateChannelBinding(&ServerConfig{ChannelBinding: true}), ShouldNotBeNil)
+	})
+}
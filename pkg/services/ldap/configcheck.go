@@ -0,0 +1,435 @@
+package ldap
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	LDAP "gopkg.in/ldap.v3"
+
+	m "github.com/grafana/grafana/pkg/models"
+)
+
+// deprecatedKeys are the options which used to be documented but are
+// ignored today, with what to use instead
+var deprecatedKeys = map[string]string{
+	"enable_ssl":      "use use_ssl instead",
+	"verbose_logging": "set filters = ldap:debug in the [log] section of grafana.ini instead",
+}
+
+// parseErrorLine matches the line number in the errors of the TOML parser
+var parseErrorLine = regexp.MustCompile(`^Near line (\d+)`)
+
+// serverPrefix matches the prefix of the server options, like "servers[0]"
+var serverPrefix = regexp.MustCompile(`^servers\[\d+\]`)
+
+// keyIndex matches the array indexes of the key paths, like "[0]"
+var keyIndex = regexp.MustCompile(`\[\d+\]`)
+
+// ConfigProblem is a problem found in an LDAP config file,
+// Line is 0 if it can't be tied to a line of the file
+type ConfigProblem struct {
+	Line    int
+	Field   string
+	Message string
+	Warning bool
+}
+
+func (problem *ConfigProblem) String() string {
+	location := ""
+	if problem.Line > 0 {
+		location = fmt.Sprintf("line %d: ", problem.Line)
+	}
+	if problem.Field != "" {
+		location += problem.Field + ": "
+	}
+	return location + problem.Message
+}
+
+// configChecker collects the problems of a config file
+type configChecker struct {
+	lines    map[string]int
+	problems []*ConfigProblem
+}
+
+// add adds a problem to the config
+func (checker *configChecker) add(warning bool, field string, format string, args ...interface{}) {
+	checker.problems = append(checker.problems, &ConfigProblem{
+		Line:    checker.line(field),
+		Field:   field,
+		Message: fmt.Sprintf(format, args...),
+		Warning: warning,
+	})
+}
+
+// line returns the line of the field, of the [defaults] option it
+// inherited or of the closest table around it if the field isn't set
+func (checker *configChecker) line(field string) int {
+	for path := field; path != ""; {
+		if line, ok := checker.lines[path]; ok {
+			return line
+		}
+		if line, ok := checker.lines[serverPrefix.ReplaceAllString(path, "defaults")]; ok && strings.HasPrefix(path, "servers[") {
+			return line
+		}
+
+		if dot := strings.LastIndex(path, "."); dot >= 0 {
+			path = path[:dot]
+		} else {
+			path = ""
+		}
+	}
+	return 0
+}
+
+func (checker *configChecker) error(field string, format string, args ...interface{}) {
+	checker.add(false, field, format, args...)
+}
+
+func (checker *configChecker) warn(field string, format string, args ...interface{}) {
+	checker.add(true, field, format, args...)
+}
+
+// CheckConfigFile checks the LDAP config file more thoroughly than
+// Grafana does when reading it: the filters, the certificate files and
+// the unknown or deprecated options. The error is only set if the file
+// can't be read
+func CheckConfigFile(configFile string) ([]*ConfigProblem, error) {
+	content, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return checkConfig(string(content)), nil
+}
+
+func checkConfig(content string) []*ConfigProblem {
+	checker := &configChecker{lines: indexKeyLines(content)}
+
+	config := &Config{}
+	meta, err := toml.Decode(content, config)
+	if err != nil {
+		line := 0
+		if match := parseErrorLine.FindStringSubmatch(err.Error()); match != nil {
+			line, _ = strconv.Atoi(match[1])
+		}
+		checker.problems = append(checker.problems, &ConfigProblem{Line: line, Message: err.Error()})
+		return checker.problems
+	}
+	inheritDefaults(config, meta)
+
+	undecoded := map[string]bool{}
+	for _, key := range meta.Undecoded() {
+		// the keys of unknown tables are unknown too, the table is enough
+		if len(key) > 1 && undecoded[key[:len(key)-1].String()] {
+			undecoded[key.String()] = true
+			continue
+		}
+		undecoded[key.String()] = true
+		checker.checkUndecodedKey(key)
+	}
+
+	if config.Version > SchemaVersion {
+		checker.error("version", "version %d is not supported, the latest version is %d", config.Version, SchemaVersion)
+		return checker.problems
+	}
+	if config.Version == 0 {
+		config.Version = 1
+	}
+	for _, change := range schemaChanges(config) {
+		checker.warn(fmt.Sprintf("servers[%d]", change.server), "migrated from version %d: %s, set version = %d once updated",
+			change.from, change.description, SchemaVersion)
+	}
+
+	if len(config.Servers) == 0 {
+		checker.error("", "no [[servers]] defined")
+	}
+
+	for i, server := range config.Servers {
+		checker.checkServer(fmt.Sprintf("servers[%d]", i), server)
+	}
+
+	sort.SliceStable(checker.problems, func(i, j int) bool {
+		return checker.problems[i].Line < checker.problems[j].Line
+	})
+
+	return checker.problems
+}
+
+// checkUndecodedKey flags every occurrence of a key
+// which isn't an option, the TOML keys have no indexes
+func (checker *configChecker) checkUndecodedKey(key toml.Key) {
+	name := key.String()
+	message := "unknown option, it's ignored"
+	if replacement, ok := deprecatedKeys[key[len(key)-1]]; ok && len(key) == 2 {
+		message = "deprecated option, it's ignored, " + replacement
+	}
+
+	found := false
+	for field := range checker.lines {
+		if keyIndex.ReplaceAllString(field, "") == name {
+			checker.warn(field, message)
+			found = true
+		}
+	}
+	if !found {
+		checker.warn(name, message)
+	}
+}
+
+func (checker *configChecker) checkServer(prefix string, server *ServerConfig) {
+	// the presets fill the filters left unset, they're checked filled
+	preset := *server
+	if err := applyPreset(&preset); err != nil {
+		checker.error(prefix+".preset", "%v", err)
+	} else {
+		server = &preset
+	}
+
+	if strings.TrimSpace(server.Host) == "" {
+		checker.error(prefix+".host", "missing option")
+	}
+	if server.Port < 0 || server.Port > 65535 {
+		checker.error(prefix+".port", "%d is not a valid port", server.Port)
+	}
+	if server.UseSSL && server.StartTLS {
+		checker.warn(prefix+".start_tls", "ignored since use_ssl is set")
+	}
+
+	if server.SearchFilter == "" {
+		checker.error(prefix+".search_filter", "missing option")
+	} else {
+		checker.checkFilter(prefix+".search_filter", server.SearchFilter, "the username")
+	}
+	if len(server.SearchBaseDNs) == 0 {
+		checker.error(prefix+".search_base_dns", "missing option")
+	}
+	if server.GroupSearchFilter != "" {
+		checker.checkFilter(prefix+".group_search_filter", server.GroupSearchFilter, "the user attribute")
+		if len(server.GroupSearchBaseDNs) == 0 {
+			checker.error(prefix+".group_search_base_dns", "missing option, group_search_filter is set")
+		}
+	}
+	for i, filter := range server.GroupSearchFilters {
+		checker.checkFilter(fmt.Sprintf("%s.group_search_filters[%d].filter", prefix, i), filter.Filter, "the user attribute")
+	}
+	if len(server.GroupSearchFilters) > 0 && len(server.GroupSearchBaseDNs) == 0 {
+		checker.error(prefix+".group_search_base_dns", "missing option, group_search_filters is set")
+	}
+
+	if placeholder := unknownPlaceholder(server.BindDN); placeholder != "" {
+		checker.error(prefix+".bind_dn", "unknown placeholder %s, use %s", placeholder, placeholderNames)
+	}
+	for _, template := range server.BindDNTemplates {
+		if placeholder := unknownPlaceholder(template); placeholder != "" {
+			checker.error(prefix+".bind_dn_templates", "unknown placeholder %s, use %s", placeholder, placeholderNames)
+		}
+	}
+	if err := validateAuthStrategy(server); err != nil {
+		checker.error(prefix+".auth_strategy", "%v", err)
+	}
+	if hasTemplatedServiceAccount(server) {
+		checker.warn(prefix+".bind_dn", templatedServiceAccountWarning)
+	}
+
+	for i, override := range server.SearchBaseOverrides {
+		overridePrefix := fmt.Sprintf("%s.search_base_overrides[%d]", prefix, i)
+		if override.BaseDN == "" {
+			checker.error(overridePrefix+".base_dn", "missing option")
+		} else if err := validateSearchBaseOverrides(&ServerConfig{
+			SearchBaseDNs:       server.SearchBaseDNs,
+			SearchBaseOverrides: []*SearchBaseOverride{{BaseDN: override.BaseDN}},
+		}); err != nil {
+			checker.error(overridePrefix+".base_dn", "%v", err)
+		}
+		if override.SearchFilter != "" {
+			checker.checkFilter(overridePrefix+".search_filter", override.SearchFilter, "the username")
+		}
+	}
+
+	checker.checkCertificates(prefix, server)
+
+	if server.ProxyURL != "" {
+		proxyURL, err := url.Parse(server.ProxyURL)
+		if err != nil {
+			checker.error(prefix+".proxy_url", "not a valid URL")
+		} else if proxyURL.Scheme != "socks5" && proxyURL.Scheme != "http" {
+			checker.error(prefix+".proxy_url", "unsupported scheme %q, use socks5 or http", proxyURL.Scheme)
+		}
+	}
+
+	for _, check := range server.RevocationChecks {
+		if check != RevocationOCSP && check != RevocationCRL {
+			checker.error(prefix+".revocation_checks", "unknown check %q, use %q or %q", check, RevocationOCSP, RevocationCRL)
+		}
+	}
+
+	if err := validateFIPS(server); err != nil {
+		checker.error(prefix, "%v", err)
+	}
+	if server.ChannelBinding && !server.UseSSL {
+		checker.error(prefix+".channel_binding", "requires use_ssl")
+	}
+	if err := validateQuirks(server); err != nil {
+		checker.error(prefix+".quirks", "%v", err)
+	}
+
+	for i, group := range server.Groups {
+		groupPrefix := fmt.Sprintf("%s.group_mappings[%d]", prefix, i)
+		if group.GroupDN == "" {
+			checker.error(groupPrefix+".group_dn", "missing option")
+		}
+		if group.OrgRole != "" && !group.OrgRole.IsValid() {
+			checker.error(groupPrefix+".org_role", "%q is not a role, use %s, %s or %s", group.OrgRole, m.ROLE_VIEWER, m.ROLE_EDITOR, m.ROLE_ADMIN)
+		}
+	}
+}
+
+// checkFilter checks the filter has a placeholder, %s being value,
+// and compiles once the placeholders are replaced
+func (checker *configChecker) checkFilter(field string, filter string, value string) {
+	depth := 0
+	for i, char := range filter {
+		switch char {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		}
+		if depth < 0 {
+			checker.error(field, "unbalanced parentheses, unexpected \")\" at character %d", i+1)
+			return
+		}
+	}
+	if depth > 0 {
+		checker.error(field, "unbalanced parentheses, %d \"(\" not closed", depth)
+		return
+	}
+
+	if !hasPlaceholder(filter) {
+		checker.error(field, "missing the %%s placeholder for %s", value)
+		return
+	}
+	if placeholder := unknownPlaceholder(filter); placeholder != "" {
+		checker.error(field, "unknown placeholder %s, use %s", placeholder, placeholderNames)
+		return
+	}
+
+	example := newLoginValues("placeholder@grafana.org")
+	if _, err := LDAP.CompileFilter(expandPlaceholders(filter, "placeholder", example, LDAP.EscapeFilter)); err != nil {
+		checker.error(field, "invalid filter: %v", err)
+	}
+}
+
+// checkCertificates loads the certificate files like the connections do
+func (checker *configChecker) checkCertificates(prefix string, server *ServerConfig) {
+	if server.RootCACert != "" {
+		for _, caCertFile := range strings.Split(server.RootCACert, " ") {
+			pem, err := ioutil.ReadFile(caCertFile)
+			if err != nil {
+				checker.error(prefix+".root_ca_cert", "%v", err)
+				continue
+			}
+			if !x509.NewCertPool().AppendCertsFromPEM(pem) {
+				checker.error(prefix+".root_ca_cert", "no PEM certificate in %s", caCertFile)
+			}
+		}
+	}
+
+	switch {
+	case server.ClientCert != "" && server.ClientKey != "":
+		if keyScheme(server.ClientKey) != "" {
+			if err := validateClientKey(server); err != nil {
+				checker.error(prefix+".client_key", "%v", err)
+			}
+			// the key stores are only reachable from the running server
+			if _, err := ioutil.ReadFile(server.ClientCert); err != nil {
+				checker.error(prefix+".client_cert", "%v", err)
+			}
+			return
+		}
+		if _, err := loadClientCertificate(server.ClientCert, server.ClientKey); err != nil {
+			checker.error(prefix+".client_cert", "%v", err)
+		}
+	case server.ClientCert != "":
+		checker.warn(prefix+".client_cert", "ignored since client_key is not set")
+	case server.ClientKey != "":
+		checker.warn(prefix+".client_key", "ignored since client_cert is not set")
+	}
+}
+
+// indexKeyLines maps the key paths of the file, like
+// "servers[0].attributes.email", to the lines they're set on
+func indexKeyLines(content string) map[string]int {
+	lines := map[string]int{}
+	// arrays holds the index of the current table of the arrays of tables
+	arrays := map[string]int{}
+	table := ""
+
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "[["):
+			name := strings.Trim(strings.Fields(line)[0], "[]")
+			if index, ok := arrays[name]; ok {
+				arrays[name] = index + 1
+			} else {
+				arrays[name] = 0
+			}
+			// the arrays in the previous table start over
+			for array := range arrays {
+				if strings.HasPrefix(array, name+".") {
+					delete(arrays, array)
+				}
+			}
+			table = indexedPath(name, arrays)
+		case strings.HasPrefix(line, "["):
+			table = indexedPath(strings.Trim(strings.Fields(line)[0], "[]"), arrays)
+		default:
+			equals := strings.Index(line, "=")
+			if equals < 0 {
+				continue
+			}
+			key := strings.Trim(strings.TrimSpace(line[:equals]), `"`)
+			if table != "" {
+				key = table + "." + key
+			}
+			lines[key] = i + 1
+			continue
+		}
+
+		if _, ok := lines[table]; !ok {
+			lines[table] = i + 1
+		}
+	}
+
+	return lines
+}
+
+// indexedPath adds the indexes of the current tables of the arrays to name
+func indexedPath(name string, arrays map[string]int) string {
+	path, unindexed := "", ""
+	for i, part := range strings.Split(name, ".") {
+		if i > 0 {
+			path += "."
+			unindexed += "."
+		}
+		path += part
+		unindexed += part
+
+		if index, ok := arrays[unindexed]; ok {
+			path += fmt.Sprintf("[%d]", index)
+		}
+	}
+	return path
+}
@@ -0,0 +1,105 @@
+package ldap
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCheckConfig(t *testing.T) {
+	Convey("CheckConfigFile", t, func() {
+		Convey("Should find no problem in the sample config", func() {
+			problems, err := CheckConfigFile("../../../conf/ldap.toml")
+			So(err, ShouldBeNil)
+			So(problems, ShouldBeEmpty)
+		})
+
+		Convey("Should return an error if the file can't be read", func() {
+			_, err := CheckConfigFile("does-not-exist.toml")
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("checkConfig", t, func() {
+		Convey("Should report the line of syntax errors", func() {
+			problems := checkConfig("[[servers]]\nhost = \"ldap\"\nport = \n")
+			So(problems, ShouldHaveLength, 1)
+			So(problems[0].Line, ShouldEqual, 3)
+			So(problems[0].Warning, ShouldBeFalse)
+		})
+
+		Convey("Should report the problems with their line and field", func() {
+			problems := checkConfig(`
+[[servers]]
+host = "ldap"
+enable_ssl = true
+search_filter = "(&(cn=%s)"
+search_base_dns = ["dc=grafana,dc=org"]
+group_search_filter = "(objectClass=posixGroup)"
+group_search_base_dns = ["ou=groups,dc=grafana,dc=org"]
+root_ca_cert = "does-not-exist.pem"
+
+[servers.attributes]
+foo = "bar"
+
+[[servers.group_mappings]]
+group_dn = "*"
+org_role = "Boss"
+`)
+
+			So(problems, ShouldHaveLength, 6)
+			So(problems[0].String(), ShouldEqual, "line 4: servers[0].enable_ssl: deprecated option, it's ignored, use use_ssl instead")
+			So(problems[0].Warning, ShouldBeTrue)
+			So(problems[1].String(), ShouldEqual, `line 5: servers[0].search_filter: unbalanced parentheses, 1 "(" not closed`)
+			So(problems[2].String(), ShouldEqual, "line 7: servers[0].group_search_filter: missing the %s placeholder for the user attribute")
+			So(problems[3].Field, ShouldEqual, "servers[0].root_ca_cert")
+			So(problems[3].Line, ShouldEqual, 9)
+			So(problems[4].String(), ShouldEqual, "line 12: servers[0].attributes.foo: unknown option, it's ignored")
+			So(problems[5].Field, ShouldEqual, "servers[0].group_mappings[0].org_role")
+			So(problems[5].Line, ShouldEqual, 16)
+		})
+
+		Convey("Should tie the missing options to their table", func() {
+			problems := checkConfig("[[servers]]\nhost = \"ldap\"\nsearch_base_dns = [\"dc=grafana,dc=org\"]\n\n[[servers]]\nhost = \"ldap2\"\nsearch_filter = \"(cn=%s)\"\n")
+			So(problems, ShouldHaveLength, 2)
+			So(problems[0].String(), ShouldEqual, "line 1: servers[0].search_filter: missing option")
+			So(problems[1].String(), ShouldEqual, "line 5: servers[1].search_base_dns: missing option")
+		})
+
+		Convey("Should warn about the options migrated from older versions", func() {
+			problems := checkConfig("[[servers]]\nhost = \"ldap\"\nsearch_filter = \"(cn=%s)\"\nsearch_base_dns = [\"dc=grafana,dc=org\"]\n" +
+				"group_search_filter = \"(member=%s)\"\ngroup_search_base_dns = [\"dc=grafana,dc=org\"]\n\n[servers.attributes]\nmember_of = \"cn\"\n")
+			So(problems, ShouldHaveLength, 1)
+			So(problems[0].Warning, ShouldBeTrue)
+			So(problems[0].String(), ShouldEqual, `line 1: servers[0]: migrated from version 1: attributes.member_of = "cn" moved to group_search_group_attribute, set version = 3 once updated`)
+		})
+
+		Convey("Should warn about the bind_dn with a placeholder and bind_password", func() {
+			problems := checkConfig("version = 3\n[[servers]]\nhost = \"ldap\"\nsearch_filter = \"(cn=%s)\"\nsearch_base_dns = [\"dc=grafana,dc=org\"]\n" +
+				"bind_dn = \"cn=%s,dc=grafana,dc=org\"\nbind_password = \"grafana\"\n")
+			So(problems, ShouldHaveLength, 1)
+			So(problems[0].Warning, ShouldBeTrue)
+			So(problems[0].String(), ShouldEqual, "line 6: servers[0].bind_dn: "+templatedServiceAccountWarning)
+		})
+
+		Convey("Should check the search base overrides", func() {
+			problems := checkConfig(`[[servers]]
+host = "ldap"
+search_filter = "(cn=%s)"
+search_base_dns = ["ou=staff,dc=grafana,dc=org"]
+
+[[servers.search_base_overrides]]
+base_dn = "ou=contractors,dc=grafana,dc=org"
+search_filter = "(uid=)"
+`)
+			So(problems, ShouldHaveLength, 2)
+			So(problems[0].String(), ShouldEqual, "line 7: servers[0].search_base_overrides[0].base_dn: ou=contractors,dc=grafana,dc=org is not one of the search_base_dns")
+			So(problems[1].String(), ShouldEqual, "line 8: servers[0].search_base_overrides[0].search_filter: missing the %s placeholder for the username")
+		})
+
+		Convey("Should check the filters filled by the presets", func() {
+			problems := checkConfig("[[servers]]\nhost = \"ldap\"\npreset = \"active_directory\"\nsearch_base_dns = [\"dc=grafana,dc=org\"]\n")
+			So(problems, ShouldBeEmpty)
+		})
+	})
+}
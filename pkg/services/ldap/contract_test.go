@@ -0,0 +1,261 @@
+// +build ldapcontract
+
+package ldap
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	LDAP "gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+// contractVendor is a directory of the contract tests, run against the
+// address of its environment variable, like LDAP_CONTRACT_OPENLDAP=localhost:389.
+// The fixtures are the ones of the devenv blocks, see
+// devenv/docker/blocks/openldap/notes.md
+type contractVendor struct {
+	name string
+	env  string
+
+	server func(host string, port int) *ServerConfig
+
+	// user logs in with password and is a direct member of groups
+	user     string
+	password string
+	groups   []string
+
+	// nestedGroup is a group the user is only a member of through another
+	// group, empty if the directory doesn't resolve the nested groups
+	nestedGroup string
+
+	// referralUser is found through a search continuation reference
+	referralUser string
+
+	// expiredUser and lockedUser are refused by the password policy
+	expiredUser string
+	lockedUser  string
+}
+
+var contractVendors = []*contractVendor{
+	{
+		name: "Active Directory (Samba)",
+		env:  "LDAP_CONTRACT_SAMBA_AD",
+		server: func(host string, port int) *ServerConfig {
+			return &ServerConfig{
+				Host:         host,
+				Port:         port,
+				Preset:       "active_directory",
+				BindDN:       "cn=Administrator,cn=Users,dc=grafana,dc=org",
+				BindPassword: "Grafana123!",
+
+				SearchBaseDNs:                  []string{"cn=Users,dc=grafana,dc=org"},
+				GroupSearchFilter:              "(member:1.2.840.113556.1.4.1941:=%s)",
+				GroupSearchFilterUserAttribute: "dn",
+				GroupSearchBaseDNs:             []string{"ou=groups,dc=grafana,dc=org"},
+			}
+		},
+		user:        "ldap-editor",
+		password:    "Grafana123!",
+		groups:      []string{"CN=editors,OU=groups,DC=grafana,DC=org"},
+		nestedGroup: "CN=staff,OU=groups,DC=grafana,DC=org",
+	},
+	{
+		name: "OpenLDAP",
+		env:  "LDAP_CONTRACT_OPENLDAP",
+		server: func(host string, port int) *ServerConfig {
+			return &ServerConfig{
+				Host:          host,
+				Port:          port,
+				BindDN:        "cn=admin,dc=grafana,dc=org",
+				BindPassword:  "grafana",
+				SearchFilter:  "(cn=%s)",
+				SearchBaseDNs: []string{"dc=grafana,dc=org"},
+				Attr: AttributeMap{
+					Username: "cn",
+					Name:     "givenName",
+					Surname:  "sn",
+					Email:    "mail",
+					MemberOf: "memberOf",
+				},
+			}
+		},
+		user:     "ldap-editor",
+		password: "grafana",
+		groups:   []string{"cn=editors,ou=groups,dc=grafana,dc=org"},
+	},
+	{
+		name: "389-DS",
+		env:  "LDAP_CONTRACT_389DS",
+		server: func(host string, port int) *ServerConfig {
+			return &ServerConfig{
+				Host:           host,
+				Port:           port,
+				Quirks:         []string{Quirk389DS},
+				PasswordPolicy: true,
+				BindDN:         "cn=Directory Manager",
+				BindPassword:   "grafana123",
+				SearchFilter:   "(uid=%s)",
+				SearchBaseDNs:  []string{"ou=people,dc=grafana,dc=org"},
+				Attr: AttributeMap{
+					Username: "uid",
+					Name:     "givenName",
+					Surname:  "sn",
+					Email:    "mail",
+					MemberOf: "memberOf",
+				},
+			}
+		},
+		user:         "ldap-editor",
+		password:     "grafana123",
+		groups:       []string{"cn=editors,ou=groups,dc=grafana,dc=org"},
+		nestedGroup:  "cn=staff,ou=groups,dc=grafana,dc=org",
+		referralUser: "ldap-referred",
+		expiredUser:  "ldap-expired",
+		lockedUser:   "ldap-locked",
+	},
+	{
+		name: "FreeIPA",
+		env:  "LDAP_CONTRACT_FREEIPA",
+		server: func(host string, port int) *ServerConfig {
+			return &ServerConfig{
+				Host:           host,
+				Port:           port,
+				Preset:         "freeipa",
+				PasswordPolicy: true,
+				BindDN:         "uid=admin,cn=users,cn=accounts,dc=example,dc=test",
+				BindPassword:   "Secret123",
+				SearchBaseDNs:  []string{"cn=users,cn=accounts,dc=example,dc=test"},
+			}
+		},
+		user:        "ldap-editor",
+		password:    "grafana123",
+		groups:      []string{"cn=editors,cn=groups,cn=accounts,dc=example,dc=test"},
+		nestedGroup: "cn=staff,cn=groups,cn=accounts,dc=example,dc=test",
+		expiredUser: "ldap-expired",
+	},
+}
+
+func TestContract(t *testing.T) {
+	defer dialServers()()
+
+	for _, vendor := range contractVendors {
+		address := os.Getenv(vendor.env)
+		if address == "" {
+			t.Logf("Skipping the %s contract, %s is not set", vendor.name, vendor.env)
+			continue
+		}
+
+		host, portText, err := net.SplitHostPort(address)
+		if err != nil {
+			t.Fatalf("Invalid %s %q: %v", vendor.env, address, err)
+		}
+		port, err := strconv.Atoi(portText)
+		if err != nil {
+			t.Fatalf("Invalid %s %q: %v", vendor.env, address, err)
+		}
+
+		runContract(t, vendor, host, port)
+	}
+}
+
+func runContract(t *testing.T, vendor *contractVendor, host string, port int) {
+	Convey(vendor.name+" contract", t, func() {
+		server := vendor.server(host, port)
+		So(validateConfig(&Config{Servers: []*ServerConfig{server}}), ShouldBeNil)
+
+		auth := &Auth{server: server, log: log.New("test-logger")}
+		login := func(username, password string) (*UserInfo, error) {
+			return auth.Authenticate(&models.LoginUserQuery{Username: username, Password: password})
+		}
+
+		Convey("Should log the user in with its groups", func() {
+			user, err := login(vendor.user, vendor.password)
+			So(err, ShouldBeNil)
+			for _, group := range vendor.groups {
+				So(user.isMemberOf(group), ShouldBeTrue)
+			}
+		})
+
+		Convey("Should refuse the wrong password", func() {
+			_, err := login(vendor.user, vendor.password+"-wrong")
+			So(err, ShouldEqual, ErrInvalidCredentials)
+		})
+
+		Convey("Should resolve the nested groups", func() {
+			if vendor.nestedGroup == "" {
+				return
+			}
+
+			user, err := login(vendor.user, vendor.password)
+			So(err, ShouldBeNil)
+			So(user.isMemberOf(vendor.nestedGroup), ShouldBeTrue)
+		})
+
+		Convey("Should list all the users of a paged search", func() {
+			users, err := auth.Users()
+			So(err, ShouldBeNil)
+
+			paged, err := contractPagedSearch(server)
+			So(err, ShouldBeNil)
+			So(len(users), ShouldEqual, paged)
+		})
+
+		Convey("Should follow the referrals", func() {
+			if vendor.referralUser == "" {
+				return
+			}
+
+			user, err := auth.User(vendor.referralUser)
+			So(err, ShouldBeNil)
+			So(user.Username, ShouldEqual, vendor.referralUser)
+		})
+
+		Convey("Should enforce the password policy", func() {
+			if vendor.expiredUser != "" {
+				_, err := login(vendor.expiredUser, vendor.password)
+				So(err, ShouldEqual, ErrPasswordExpired)
+			}
+			if vendor.lockedUser != "" {
+				_, err := login(vendor.lockedUser, vendor.password)
+				So(err, ShouldEqual, ErrAccountLocked)
+			}
+		})
+	})
+}
+
+// contractPagedSearch counts the users of the first search base with a
+// paged search of ldap.v3, bypassing Auth
+func contractPagedSearch(server *ServerConfig) (int, error) {
+	conn, err := LDAP.Dial("tcp", net.JoinHostPort(server.Host, strconv.Itoa(server.Port)))
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	if err := conn.Bind(server.BindDN, server.BindPassword); err != nil {
+		return 0, err
+	}
+
+	for _, base := range server.SearchBaseDNs {
+		filter, _ := server.searchBaseSettings(base)
+		result, err := conn.SearchWithPaging(&LDAP.SearchRequest{
+			BaseDN: base,
+			Scope:  LDAP.ScopeWholeSubtree,
+			Filter: expandPlaceholders(filter, "*", allLogins, noEscape),
+		}, 100)
+		if err != nil {
+			return 0, err
+		}
+		if len(result.Entries) > 0 {
+			return len(result.Entries), nil
+		}
+	}
+	return 0, fmt.Errorf("no users in %v", server.SearchBaseDNs)
+}
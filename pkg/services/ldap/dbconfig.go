@@ -0,0 +1,200 @@
+package ldap
+
+import (
+	"bytes"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/grafana/grafana/pkg/bus"
+	models "github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/grafana/grafana/pkg/util"
+	"github.com/grafana/grafana/pkg/util/errutil"
+)
+
+const (
+	// ConfigSourceFile is the source of the config read from config_file
+	ConfigSourceFile = "file"
+
+	// ConfigSourceDatabase is the source of the config saved in the database
+	ConfigSourceDatabase = "database"
+
+	// ConfigSourceProvisioning is the source of the config read from the provisioning files
+	ConfigSourceProvisioning = "provisioning"
+)
+
+// configSource is where the cached config was read from
+var configSource = ConfigSourceFile
+
+// provisionedConfig is the config read from the provisioning files, if there are any
+var provisionedConfig *Config
+
+// loadConfig reads the provisioned config if there is one, then the config
+// saved in the database if database_config is enabled, otherwise the config file
+func loadConfig() (*Config, error) {
+	if provisionedConfig != nil {
+		configSource = ConfigSourceProvisioning
+		return provisionedConfig, nil
+	}
+
+	if setting.LdapDatabaseConfig {
+		result, err := readDatabaseConfig()
+		if err != nil {
+			return nil, err
+		}
+		if result != nil {
+			configSource = ConfigSourceDatabase
+			return result, nil
+		}
+	}
+
+	configSource = ConfigSourceFile
+	return readConfig(setting.LdapConfigFile)
+}
+
+// readDatabaseConfig returns the config saved in the database, or nil if there is none
+func readDatabaseConfig() (*Config, error) {
+	query := &models.GetLdapConfigQuery{}
+	if err := bus.Dispatch(query); err != nil {
+		if err == models.ErrLdapConfigNotFound {
+			return nil, nil
+		}
+		return nil, errutil.Wrap("Failed to load ldap config from the database", err)
+	}
+
+	logger.Info("Ldap enabled, reading config from the database", "updated", query.Result.Updated)
+
+	text, err := util.Decrypt(query.Result.Config, setting.SecretKey)
+	if err != nil {
+		return nil, errutil.Wrap("Failed to decrypt ldap config", err)
+	}
+
+	return ParseConfig(string(text))
+}
+
+// ConfigSource returns where the config in use was read from
+func ConfigSource() string {
+	loadingMutex.Lock()
+	defer loadingMutex.Unlock()
+
+	return configSource
+}
+
+// ParseConfig parses and validates the config in the ldap.toml format
+func ParseConfig(text string) (*Config, error) {
+	result := &Config{}
+
+	meta, err := toml.Decode(text, result)
+	if err != nil {
+		return nil, errutil.Wrap("Failed to parse ldap config", err)
+	}
+	inheritDefaults(result, meta)
+
+	if err := validateConfig(result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// EncodeConfig returns the config in the ldap.toml format, with its secrets redacted
+func EncodeConfig(cfg *Config) (string, error) {
+	redactedConfig := &Config{Version: cfg.Version}
+	for _, server := range cfg.Servers {
+		redactedConfig.Servers = append(redactedConfig.Servers, redactServer(server))
+	}
+
+	return encodeConfig(redactedConfig)
+}
+
+// encodeConfig encodes cfg without its defaults, the servers inherited them already
+func encodeConfig(cfg *Config) (string, error) {
+	inherited := *cfg
+	inherited.Defaults = nil
+
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(&inherited); err != nil {
+		return "", errutil.Wrap("Failed to encode ldap config", err)
+	}
+
+	return buf.String(), nil
+}
+
+// SaveDatabaseConfig encrypts and saves the config in the database and reloads
+// it. The secrets left redacted are kept from the server with the same
+// host and port in the config in use, so the output of EncodeConfig can be saved
+func SaveDatabaseConfig(cfg *Config, userID int64) error {
+	current, err := GetConfig()
+	if err != nil {
+		return err
+	}
+	restoreSecrets(cfg, current)
+
+	text, err := encodeConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	encrypted, err := util.Encrypt([]byte(text), setting.SecretKey)
+	if err != nil {
+		return errutil.Wrap("Failed to encrypt ldap config", err)
+	}
+
+	if err := bus.Dispatch(&models.SaveLdapConfigCommand{Config: encrypted, UserId: userID}); err != nil {
+		return errutil.Wrap("Failed to save ldap config", err)
+	}
+
+	return ReloadConfig()
+}
+
+// DeleteDatabaseConfig deletes the config saved in the database,
+// so the config file is used again, and reloads it
+func DeleteDatabaseConfig() error {
+	if err := bus.Dispatch(&models.DeleteLdapConfigCommand{}); err != nil {
+		return errutil.Wrap("Failed to delete ldap config", err)
+	}
+
+	return ReloadConfig()
+}
+
+// SetProvisionedConfig validates the config read from the provisioning files
+// and reloads it, nil goes back to the database or the config file
+func SetProvisionedConfig(cfg *Config) error {
+	if cfg != nil {
+		if err := validateConfig(cfg); err != nil {
+			return err
+		}
+	}
+
+	loadingMutex.Lock()
+	unchanged := cfg == nil && provisionedConfig == nil
+	provisionedConfig = cfg
+	loadingMutex.Unlock()
+
+	if unchanged {
+		return nil
+	}
+
+	return ReloadConfig()
+}
+
+func restoreSecrets(cfg *Config, current *Config) {
+	if current == nil {
+		return
+	}
+
+	for _, server := range cfg.Servers {
+		for _, currentServer := range current.Servers {
+			if ServerKey(server) != ServerKey(currentServer) {
+				continue
+			}
+
+			if server.BindPassword == redacted {
+				server.BindPassword = currentServer.BindPassword
+			}
+			if isRedactedURL(server.ProxyURL) {
+				server.ProxyURL = currentServer.ProxyURL
+			}
+		}
+	}
+}
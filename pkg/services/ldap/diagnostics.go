@@ -0,0 +1,229 @@
+package ldap
+
+import (
+	"encoding/hex"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	LDAP "gopkg.in/ldap.v3"
+)
+
+// maxRecentErrors is the number of errors kept for the diagnostics bundle
+const maxRecentErrors = 50
+
+// rootDSEAttributes are the rootDSE attributes worth sharing with support
+var rootDSEAttributes = []string{
+	"namingContexts",
+	"defaultNamingContext",
+	"supportedLDAPVersion",
+	"supportedControl",
+	"supportedExtension",
+	"supportedSASLMechanisms",
+	"vendorName",
+	"vendorVersion",
+}
+
+// Diagnostics is the bundle handed to support to look into LDAP issues,
+// nothing in it is secret
+type Diagnostics struct {
+	GeneratedAt time.Time          `json:"generatedAt"`
+	Servers     []*ServerConfig    `json:"servers"`
+	Hosts       []*HostDiagnostics `json:"hosts"`
+	Errors      []*RecentError     `json:"errors"`
+}
+
+// HostDiagnostics is the result of connecting to one of the hosts of a server
+type HostDiagnostics struct {
+	Server    string              `json:"server"`
+	Host      string              `json:"host"`
+	Active    bool                `json:"active"`
+	Reachable bool                `json:"reachable"`
+	Error     string              `json:"error,omitempty"`
+	RootDSE   map[string][]string `json:"rootDSE,omitempty"`
+
+	// ChannelBinding is the hex of the channel binding hash, to compare with the certificate of the server
+	ChannelBinding string `json:"channelBinding,omitempty"`
+}
+
+// RecentError is a sanitized error returned by an LDAP server
+type RecentError struct {
+	Time   time.Time `json:"time"`
+	Server string    `json:"server"`
+	Kind   string    `json:"kind"`
+	Error  string    `json:"error"`
+}
+
+// errorLog keeps the last maxRecentErrors errors
+type errorLog struct {
+	mutex  sync.Mutex
+	errors []*RecentError
+	next   int
+}
+
+var recentErrors = &errorLog{}
+
+func (errorLog *errorLog) add(server *ServerConfig, kind error, err error) {
+	errorLog.mutex.Lock()
+	defer errorLog.mutex.Unlock()
+
+	recent := &RecentError{
+		Time:   time.Now(),
+		Server: ServerKey(server),
+		Kind:   "unclassified",
+		Error:  err.Error(),
+	}
+	if kind != nil {
+		recent.Kind = kind.Error()
+	}
+
+	if len(errorLog.errors) < maxRecentErrors {
+		errorLog.errors = append(errorLog.errors, recent)
+		return
+	}
+
+	errorLog.errors[errorLog.next] = recent
+	errorLog.next = (errorLog.next + 1) % maxRecentErrors
+}
+
+// list returns the errors, oldest first
+func (errorLog *errorLog) list() []*RecentError {
+	errorLog.mutex.Lock()
+	defer errorLog.mutex.Unlock()
+
+	result := make([]*RecentError, 0, len(errorLog.errors))
+	result = append(result, errorLog.errors[errorLog.next:]...)
+	return append(result, errorLog.errors[:errorLog.next]...)
+}
+
+// Diagnose builds the diagnostics bundle: the effective config with its
+// secrets redacted, the connectivity and rootDSE of every host of the
+// active servers, and the last errors returned by the servers
+func Diagnose() (*Diagnostics, error) {
+	config, err := GetConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Diagnostics{
+		GeneratedAt: time.Now(),
+		Servers:     []*ServerConfig{},
+		Hosts:       []*HostDiagnostics{},
+		Errors:      recentErrors.list(),
+	}
+	if config == nil {
+		return result, nil
+	}
+
+	for _, server := range config.Servers {
+		result.Servers = append(result.Servers, redactServer(server))
+
+		for _, host := range strings.Split(server.Host, " ") {
+			hostServer := *server
+			hostServer.Host = host
+
+			diagnostics := &HostDiagnostics{
+				Server: ServerKey(server),
+				Host:   host,
+				Active: IsActive(server),
+			}
+			// servers in maintenance or disabled are left alone
+			if diagnostics.Active {
+				New(&hostServer).(*Auth).diagnose(diagnostics)
+			}
+
+			result.Hosts = append(result.Hosts, diagnostics)
+		}
+	}
+
+	return result, nil
+}
+
+// diagnose connects to the server like WarmUp does and reads its rootDSE
+func (auth *Auth) diagnose(diagnostics *HostDiagnostics) {
+	if err := auth.Dial(); err != nil {
+		diagnostics.Error = auth.sanitizeError(err).Error()
+		return
+	}
+	defer auth.Close()
+
+	if auth.server.authStrategy() != AuthStrategyDirectBind {
+		if err := auth.initialBind("", ""); err != nil {
+			diagnostics.Error = auth.sanitizeError(err).Error()
+			return
+		}
+	}
+	diagnostics.Reachable = true
+	if len(auth.channelBinding) > 0 {
+		diagnostics.ChannelBinding = hex.EncodeToString(auth.channelBinding[len(channelBindingPrefix):])
+	}
+
+	result, err := auth.search(searchDiagnostics, &LDAP.SearchRequest{
+		BaseDN:       "",
+		Scope:        LDAP.ScopeBaseObject,
+		DerefAliases: LDAP.NeverDerefAliases,
+		Filter:       "(objectClass=*)",
+		Attributes:   rootDSEAttributes,
+	})
+	if err != nil {
+		diagnostics.Error = auth.sanitizeError(err).Error()
+		return
+	}
+
+	diagnostics.RootDSE = map[string][]string{}
+	if result != nil && len(result.Entries) > 0 {
+		for _, attribute := range result.Entries[0].Attributes {
+			diagnostics.RootDSE[attribute.Name] = attribute.Values
+		}
+	}
+}
+
+// redactedURLPassword replaces the passwords of the URLs, percent-encoded
+// like any password once the URL is rebuilt
+const redactedURLPassword = "*****"
+
+// redactServer returns a copy of server without its secrets
+func redactServer(server *ServerConfig) *ServerConfig {
+	redactedServer := *server
+
+	if redactedServer.BindPassword != "" {
+		redactedServer.BindPassword = redacted
+	}
+
+	if redactedServer.ProxyURL != "" {
+		redactedServer.ProxyURL = redactURL(redactedServer.ProxyURL)
+	}
+
+	return &redactedServer
+}
+
+// redactURL returns the URL with its password replaced, the URLs which
+// can't be parsed are redacted as a whole
+func redactURL(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return redacted
+	}
+
+	if parsed.User != nil {
+		if _, ok := parsed.User.Password(); ok {
+			parsed.User = url.UserPassword(parsed.User.Username(), redactedURLPassword)
+		}
+	}
+	return parsed.String()
+}
+
+// isRedactedURL tells if the password of the URL was replaced by redactURL
+func isRedactedURL(rawURL string) bool {
+	if rawURL == redacted {
+		return true
+	}
+
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.User == nil {
+		return false
+	}
+	password, ok := parsed.User.Password()
+	return ok && password == redactedURLPassword
+}
@@ -0,0 +1,22 @@
+package ldap
+
+// ldapDial is the dial of the package, before any test mocks it
+var ldapDial = dial
+
+// keepDial returns the func putting hookDial and dial back the way they
+// are now, deferred by the tests mocking them
+func keepDial() func() {
+	hook, mock := hookDial, dial
+	return func() {
+		hookDial, dial = hook, mock
+	}
+}
+
+// dialServers makes the connections dial the LDAP servers for real until
+// the returned func is called, for the tests against the ldaptest server
+// or a vendor directory
+func dialServers() func() {
+	restore := keepDial()
+	hookDial, dial = nil, ldapDial
+	return restore
+}
@@ -0,0 +1,64 @@
+package ldap
+
+import (
+	"github.com/grafana/grafana/pkg/infra/metrics"
+	LDAP "gopkg.in/ldap.v3"
+)
+
+// bindDNTemplates returns the DN templates the users bind with
+// using the direct-bind strategy, bind_dn if no list is set
+func (server *ServerConfig) bindDNTemplates() []string {
+	if len(server.BindDNTemplates) > 0 {
+		return server.BindDNTemplates
+	}
+	return []string{server.BindDN}
+}
+
+// directBind binds as the user with the DN templates in order, a template
+// refused with invalid credentials moves on to the next one since the
+// user may live under another branch, any other error stops the bind.
+// When every template is refused, the server can't tell a login it
+// doesn't have from a wrong password, so ErrCouldNotFindUser lets the
+// next server try
+func (auth *Auth) directBind(username string, userPassword string) error {
+	values := newLoginValues(username)
+
+	for _, template := range auth.server.bindDNTemplates() {
+		bindPath := expandDN(template, values)
+
+		var err error
+		if userPassword == "" {
+			err = auth.conn.UnauthenticatedBind(bindPath)
+		} else {
+			err = auth.userBind(bindPath, userPassword)
+		}
+
+		if err == nil {
+			metrics.M_Ldap_Direct_Binds.WithLabelValues(template, "success").Inc()
+			return nil
+		}
+
+		auth.log.Debug("Direct bind failed", "template", template, "error", err)
+
+		if ldapErr, ok := err.(*LDAP.Error); ok && ldapErr.ResultCode == 49 {
+			metrics.M_Ldap_Direct_Binds.WithLabelValues(template, "invalid_credentials").Inc()
+			// the account of the user was found but can't log in, the other templates aren't tried
+			refused := restrictionError(err)
+			if isAccountDisabled(err) {
+				auth.revokeSessions(&UserInfo{DN: bindPath, Username: username}, "account disabled in the directory")
+				if refused == nil {
+					refused = ErrInvalidCredentials
+				}
+			}
+			if refused != nil {
+				return refused
+			}
+			continue
+		}
+
+		metrics.M_Ldap_Direct_Binds.WithLabelValues(template, "error").Inc()
+		return err
+	}
+
+	return ErrCouldNotFindUser
+}
@@ -0,0 +1,109 @@
+package ldap
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/infra/metrics"
+	dto "github.com/prometheus/client_model/go"
+	. "github.com/smartystreets/goconvey/convey"
+	LDAP "gopkg.in/ldap.v3"
+)
+
+func directBindCount(template, result string) float64 {
+	metric := &dto.Metric{}
+	if err := metrics.M_Ldap_Direct_Binds.WithLabelValues(template, result).Write(metric); err != nil {
+		panic(err)
+	}
+	return metric.Counter.GetValue()
+}
+
+func TestDirectBind(t *testing.T) {
+	Convey("directBind", t, func() {
+		people := "uid=%s,ou=people,dc=grafana,dc=org"
+		service := "uid=%s,ou=service,dc=grafana,dc=org"
+
+		conn := &mockLdapConn{}
+		auth := &Auth{
+			conn: conn,
+			server: &ServerConfig{
+				AuthStrategy:    AuthStrategyDirectBind,
+				BindDNTemplates: []string{people, service},
+			},
+			log: log.New("test-logger"),
+		}
+
+		Convey("Should try the templates in order", func() {
+			tried := []string{}
+			conn.bindProvider = func(username, password string) error {
+				tried = append(tried, username)
+				if username == "uid=bot,ou=service,dc=grafana,dc=org" {
+					return nil
+				}
+				return &LDAP.Error{ResultCode: 49}
+			}
+			before := directBindCount(service, "success")
+
+			So(auth.initialBind("bot", "pwd"), ShouldBeNil)
+			So(tried, ShouldResemble, []string{"uid=bot,ou=people,dc=grafana,dc=org", "uid=bot,ou=service,dc=grafana,dc=org"})
+			So(directBindCount(service, "success"), ShouldEqual, before+1)
+		})
+
+		Convey("Should escape the username in every template", func() {
+			tried := []string{}
+			conn.bindProvider = func(username, password string) error {
+				tried = append(tried, username)
+				return &LDAP.Error{ResultCode: 49}
+			}
+
+			So(auth.initialBind("admin,ou=admins", "pwd"), ShouldEqual, ErrCouldNotFindUser)
+			So(tried, ShouldResemble, []string{
+				`uid=admin\,ou\=admins,ou=people,dc=grafana,dc=org`,
+				`uid=admin\,ou\=admins,ou=service,dc=grafana,dc=org`,
+			})
+		})
+
+		Convey("Should stop on the errors other than invalid credentials", func() {
+			tried := 0
+			conn.bindProvider = func(username, password string) error {
+				tried++
+				return errors.New("connection reset")
+			}
+			before := directBindCount(people, "error")
+
+			So(auth.initialBind("user", "pwd"), ShouldNotBeNil)
+			So(tried, ShouldEqual, 1)
+			So(directBindCount(people, "error"), ShouldEqual, before+1)
+		})
+
+		Convey("Should fall back to bind_dn", func() {
+			auth.server = &ServerConfig{AuthStrategy: AuthStrategyDirectBind, BindDN: people}
+			So(auth.server.bindDNTemplates(), ShouldResemble, []string{people})
+		})
+	})
+
+	Convey("validateAuthStrategy with bind_dn_templates", t, func() {
+		Convey("Should need a placeholder in every template", func() {
+			err := validateAuthStrategy(&ServerConfig{
+				AuthStrategy:    AuthStrategyDirectBind,
+				BindDNTemplates: []string{"uid=%s,ou=people,dc=grafana,dc=org", "cn=admin,dc=grafana,dc=org"},
+			})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Should refuse bind_dn with the templates", func() {
+			err := validateAuthStrategy(&ServerConfig{
+				AuthStrategy:    AuthStrategyDirectBind,
+				BindDN:          "uid=%s,ou=people,dc=grafana,dc=org",
+				BindDNTemplates: []string{"uid=%s,ou=service,dc=grafana,dc=org"},
+			})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Should refuse the templates to search+bind", func() {
+			err := validateAuthStrategy(&ServerConfig{BindDNTemplates: []string{"uid=%s,ou=people,dc=grafana,dc=org"}})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,33 @@
+package ldap
+
+import (
+	"strings"
+)
+
+// escapeDN escapes the value substituted into a DN template, like the
+// username in bind_dn, as described in RFC 4514 section 2.4, so it
+// can't add attributes or RDNs to the DN
+func escapeDN(value string) string {
+	var escaped strings.Builder
+
+	for i := 0; i < len(value); i++ {
+		char := value[i]
+		switch {
+		case char == 0:
+			escaped.WriteString(`\00`)
+		case strings.IndexByte(`"+,;<>\=`, char) >= 0:
+			escaped.WriteByte('\\')
+			escaped.WriteByte(char)
+		case i == 0 && (char == ' ' || char == '#'):
+			escaped.WriteByte('\\')
+			escaped.WriteByte(char)
+		case i == len(value)-1 && char == ' ':
+			escaped.WriteByte('\\')
+			escaped.WriteByte(char)
+		default:
+			escaped.WriteByte(char)
+		}
+	}
+
+	return escaped.String()
+}
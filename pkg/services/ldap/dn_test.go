@@ -0,0 +1,53 @@
+package ldap
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEscapeDN(t *testing.T) {
+	Convey("escapeDN", t, func() {
+		Convey("Should keep regular usernames", func() {
+			So(escapeDN("roel.gerrits"), ShouldEqual, "roel.gerrits")
+			So(escapeDN("Roel Gerrits"), ShouldEqual, "Roel Gerrits")
+		})
+
+		Convey("Should escape the special characters", func() {
+			So(escapeDN(`a,b+c"d\e<f>g;h=i`), ShouldEqual, `a\,b\+c\"d\\e\<f\>g\;h\=i`)
+			So(escapeDN("a\x00b"), ShouldEqual, `a\00b`)
+		})
+
+		Convey("Should escape leading and trailing characters", func() {
+			So(escapeDN("#user"), ShouldEqual, `\#user`)
+			So(escapeDN(" user "), ShouldEqual, `\ user\ `)
+			So(escapeDN("us#er"), ShouldEqual, "us#er")
+		})
+	})
+
+	Convey("initialBind with hostile usernames", t, func() {
+		conn := &mockLdapConn{}
+		var actualUsername string
+		conn.bindProvider = func(username, password string) error {
+			actualUsername = username
+			return nil
+		}
+		auth := &Auth{
+			conn: conn,
+			server: &ServerConfig{
+				BindDN:       "cn=%s,ou=users,dc=grafana,dc=org",
+				AuthStrategy: AuthStrategyDirectBind,
+			},
+		}
+
+		Convey("Should not let the username add RDNs", func() {
+			So(auth.initialBind("admin,ou=admins", "pwd"), ShouldBeNil)
+			So(actualUsername, ShouldEqual, `cn=admin\,ou\=admins,ou=users,dc=grafana,dc=org`)
+		})
+
+		Convey("Should not let the username add attributes", func() {
+			So(auth.initialBind("user+uid=0", "pwd"), ShouldBeNil)
+			So(actualUsername, ShouldEqual, `cn=user\+uid\=0,ou=users,dc=grafana,dc=org`)
+		})
+	})
+}
@@ -0,0 +1,62 @@
+package ldap
+
+import (
+	"errors"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// The ways to handle the users whose email domain isn't allowed
+const (
+	// EmailDomainReject refuses the logins and the syncs of the users
+	EmailDomainReject = "reject"
+
+	// EmailDomainStrip maps the users without an email
+	EmailDomainStrip = "strip"
+)
+
+// ErrEmailDomainNotAllowed is returned for the users whose email
+// isn't in the allowed_email_domains of the server
+var ErrEmailDomainNotAllowed = errors.New("LDAP email domain is not allowed")
+
+// validateEmailDomains checks email_domain_mismatch, defaulting to
+// EmailDomainReject, and normalizes the allowed_email_domains
+func validateEmailDomains(server *ServerConfig) error {
+	switch server.EmailDomainMismatch {
+	case "":
+		server.EmailDomainMismatch = EmailDomainReject
+	case EmailDomainReject, EmailDomainStrip:
+	default:
+		return xerrors.Errorf("invalid email_domain_mismatch %q, it must be reject or strip", server.EmailDomainMismatch)
+	}
+
+	for i, domain := range server.AllowedEmailDomains {
+		domain = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(domain), "@"))
+		if domain == "" || strings.Contains(domain, "@") {
+			return xerrors.Errorf("invalid allowed email domain %q", server.AllowedEmailDomains[i])
+		}
+		server.AllowedEmailDomains[i] = domain
+	}
+	return nil
+}
+
+// emailDomainAllowed checks the domain of the email is one of the
+// allowed_email_domains, any email is allowed without them
+func (server *ServerConfig) emailDomainAllowed(email string) bool {
+	if len(server.AllowedEmailDomains) == 0 {
+		return true
+	}
+
+	at := strings.LastIndex(email, "@")
+	if at == -1 {
+		return false
+	}
+	domain := strings.ToLower(email[at+1:])
+	for _, allowed := range server.AllowedEmailDomains {
+		if domain == allowed {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package ldap
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+)
+
+func TestEmailDomains(t *testing.T) {
+	Convey("validateEmailDomains", t, func() {
+		Convey("Should default to reject and normalize the domains", func() {
+			server := &ServerConfig{AllowedEmailDomains: []string{"@Grafana.org", " grafana.com"}}
+			So(validateEmailDomains(server), ShouldBeNil)
+			So(server.EmailDomainMismatch, ShouldEqual, EmailDomainReject)
+			So(server.AllowedEmailDomains, ShouldResemble, []string{"grafana.org", "grafana.com"})
+		})
+
+		Convey("Should refuse the invalid settings", func() {
+			So(validateEmailDomains(&ServerConfig{EmailDomainMismatch: "drop"}), ShouldNotBeNil)
+			So(validateEmailDomains(&ServerConfig{AllowedEmailDomains: []string{"roel@grafana.org"}}), ShouldNotBeNil)
+			So(validateEmailDomains(&ServerConfig{AllowedEmailDomains: []string{" "}}), ShouldNotBeNil)
+		})
+	})
+
+	Convey("Allowed email domains", t, func() {
+		auth := &Auth{log: log.New("test-logger"), server: &ServerConfig{
+			AllowedEmailDomains: []string{"grafana.org"},
+			EmailDomainMismatch: EmailDomainReject,
+		}}
+		allowed := &UserInfo{Username: "roel", Email: "Roel@GRAFANA.org"}
+		external := &UserInfo{Username: "tod", Email: "tod@partner.example.com"}
+
+		Convey("Should allow any email without allowed_email_domains", func() {
+			auth.server.AllowedEmailDomains = nil
+			_, err := auth.validateGrafanaUser(external, auth.buildGrafanaUser(external))
+			So(err, ShouldBeNil)
+		})
+
+		Convey("Should reject the users of the other domains", func() {
+			_, err := auth.validateGrafanaUser(allowed, auth.buildGrafanaUser(allowed))
+			So(err, ShouldBeNil)
+
+			_, err = auth.validateGrafanaUser(external, auth.buildGrafanaUser(external))
+			So(err, ShouldEqual, ErrEmailDomainNotAllowed)
+
+			_, err = auth.MapGrafanaUser(&UserInfo{Username: "printer"})
+			So(err, ShouldEqual, ErrEmailDomainNotAllowed)
+		})
+
+		Convey("Should map the users of the other domains without an email with strip", func() {
+			auth.server.EmailDomainMismatch = EmailDomainStrip
+
+			extUser, err := auth.MapGrafanaUser(external)
+			So(err, ShouldBeNil)
+			So(extUser.Email, ShouldBeEmpty)
+			So(auth.buildGrafanaUser(allowed).Email, ShouldEqual, "Roel@GRAFANA.org")
+		})
+	})
+}
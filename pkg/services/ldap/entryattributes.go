@@ -0,0 +1,59 @@
+package ldap
+
+import (
+	"strings"
+
+	LDAP "gopkg.in/ldap.v3"
+)
+
+// entryAttributes indexes the attributes of an entry by name, so reading
+// the mapped attributes of a user costs a lookup each instead of a scan
+// of all the attributes of its entry. The index of a search is reused
+// from entry to entry by reset, large syncs don't allocate one per user
+type entryAttributes struct {
+	dn     string
+	values map[string][]string
+}
+
+// newEntryAttributes indexes the attributes of the entry
+func newEntryAttributes(entry *LDAP.Entry) *entryAttributes {
+	attributes := &entryAttributes{values: make(map[string][]string, len(entry.Attributes))}
+	attributes.reset(entry)
+	return attributes
+}
+
+// reset indexes the attributes of the entry in place of the previous one,
+// for an attribute repeated in the entry the first with values is kept
+func (attributes *entryAttributes) reset(entry *LDAP.Entry) {
+	for name := range attributes.values {
+		delete(attributes.values, name)
+	}
+
+	attributes.dn = entry.DN
+	for _, attr := range entry.Attributes {
+		if values, ok := attributes.values[attr.Name]; ok && len(values) > 0 {
+			continue
+		}
+		attributes.values[attr.Name] = attr.Values
+	}
+}
+
+// value returns the first value of the attribute, or the DN of the entry
+// for dn, like getLdapAttrN
+func (attributes *entryAttributes) value(name string) string {
+	if strings.EqualFold(name, "dn") {
+		return attributes.dn
+	}
+	if values := attributes.values[name]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// valuesOf returns the values of the attribute, like getLdapAttrArrayN
+func (attributes *entryAttributes) valuesOf(name string) []string {
+	if values, ok := attributes.values[name]; ok {
+		return values
+	}
+	return []string{}
+}
@@ -0,0 +1,101 @@
+package ldap
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	LDAP "gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+// benchmarkEntries returns entries like the ones of a directory sync, with
+// the mapped attributes among the operational ones
+func benchmarkEntries(count int) *LDAP.SearchResult {
+	result := &LDAP.SearchResult{}
+	for i := 0; i < count; i++ {
+		result.Entries = append(result.Entries, LDAP.NewEntry(fmt.Sprintf("cn=user-%d,ou=users,dc=grafana,dc=org", i), map[string][]string{
+			"objectClass":        {"top", "person", "organizationalPerson", "inetOrgPerson"},
+			"cn":                 {fmt.Sprintf("user-%d", i)},
+			"createTimestamp":    {"20190101000000Z"},
+			"modifyTimestamp":    {"20190101000000Z"},
+			"telephoneNumber":    {"+1 555 0100"},
+			"title":              {"Engineer"},
+			"givenName":          {"Roel"},
+			"sn":                 {"Gerrits"},
+			"sAMAccountName":     {fmt.Sprintf("user%d", i)},
+			"mail":               {fmt.Sprintf("user%d@grafana.org", i)},
+			"departmentNumber":   {"4200"},
+			"l":                  {"emea"},
+			"employeeType":       {"staff"},
+			"objectGUID":         {"\x01\xab\xff"},
+			"manager":            {"cn=tod,ou=users,dc=grafana,dc=org"},
+			"memberOf":           {"cn=admins,ou=groups,dc=grafana,dc=org", "cn=editors,ou=groups,dc=grafana,dc=org"},
+			"userAccountControl": {"512"},
+		}))
+	}
+	return result
+}
+
+func benchmarkAuth() *Auth {
+	return &Auth{
+		log: log.New("test-logger"),
+		server: &ServerConfig{
+			Attr: AttributeMap{
+				Username: "sAMAccountName",
+				Name:     "givenName",
+				Surname:  "sn",
+				Email:    "mail",
+				MemberOf: "memberOf",
+			},
+			StoredAttributes: map[string]string{"cost_center": "departmentNumber", "region": "l"},
+			GuidAttribute:    "objectGUID",
+			ManagerAttribute: "manager",
+			ServiceAccounts: []*ServiceAccountMapping{
+				{Attribute: "employeeType", Value: "service", OrgId: 1, OrgRole: models.ROLE_VIEWER},
+			},
+		},
+	}
+}
+
+func TestSerializeUsers(t *testing.T) {
+	Convey("Serializing the LDAP users", t, func() {
+		auth := benchmarkAuth()
+		users := auth.serializeUsers(benchmarkEntries(2), auth.server.Attr)
+
+		So(users, ShouldHaveLength, 2)
+		So(users[1].DN, ShouldEqual, "cn=user-1,ou=users,dc=grafana,dc=org")
+		So(users[1].Username, ShouldEqual, "user1")
+		So(users[1].FirstName, ShouldEqual, "Roel")
+		So(users[1].LastName, ShouldEqual, "Gerrits")
+		So(users[1].Email, ShouldEqual, "user1@grafana.org")
+		So(users[1].MemberOf, ShouldResemble, []string{"cn=admins,ou=groups,dc=grafana,dc=org", "cn=editors,ou=groups,dc=grafana,dc=org"})
+		So(users[1].Attributes, ShouldResemble, map[string]string{"cost_center": "4200", "region": "emea"})
+		So(users[1].GUID, ShouldEqual, "01abff")
+		So(users[1].managerDN, ShouldEqual, "cn=tod,ou=users,dc=grafana,dc=org")
+		So(users[1].ServiceAccount, ShouldBeFalse)
+
+		Convey("Should read the attributes missing from the entries as empty", func() {
+			result := &LDAP.SearchResult{Entries: []*LDAP.Entry{LDAP.NewEntry("cn=leo,dc=grafana,dc=org", nil)}}
+			users := auth.serializeUsers(result, auth.server.Attr)
+
+			So(users[0].DN, ShouldEqual, "cn=leo,dc=grafana,dc=org")
+			So(users[0].Username, ShouldBeEmpty)
+			So(users[0].MemberOf, ShouldBeEmpty)
+			So(users[0].GUID, ShouldBeEmpty)
+		})
+	})
+}
+
+func BenchmarkSerializeUsers(b *testing.B) {
+	auth := benchmarkAuth()
+	result := benchmarkEntries(1000)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		auth.serializeUsers(result, auth.server.Attr)
+	}
+}
@@ -0,0 +1,93 @@
+package ldap
+
+import (
+	"errors"
+	"net"
+	"strings"
+
+	LDAP "gopkg.in/ldap.v3"
+)
+
+var (
+	// ErrServerUnavailable is the kind of the errors returned if the
+	// LDAP server can't be reached or is too busy to answer
+	ErrServerUnavailable = errors.New("LDAP server is unavailable")
+
+	// ErrTimeout is the kind of the errors returned if the
+	// LDAP server didn't answer in time
+	ErrTimeout = errors.New("LDAP operation timed out")
+
+	// ErrInsufficientAccess is the kind of the errors returned if the
+	// bound user isn't allowed to do the operation
+	ErrInsufficientAccess = errors.New("LDAP access is insufficient")
+
+	// ErrConstraintViolation is the kind of the errors returned if the
+	// LDAP server refuses the operation because of a constraint
+	ErrConstraintViolation = errors.New("LDAP constraint is violated")
+)
+
+// ClassifiedError is an error returned by the LDAP server with its
+// kind, one of the Err* values, so callers can check it with xerrors.Is
+// instead of matching the message. Invalid credentials are always
+// returned as ErrInvalidCredentials itself
+type ClassifiedError struct {
+	Kind error
+	Err  error
+}
+
+func (e *ClassifiedError) Error() string {
+	return e.Kind.Error() + ": " + e.Err.Error()
+}
+
+// Is reports whether target is the kind of the error
+func (e *ClassifiedError) Is(target error) bool {
+	return e.Kind == target
+}
+
+// Unwrap returns the underlying error
+func (e *ClassifiedError) Unwrap() error {
+	return e.Err
+}
+
+// classifyError returns the kind of err, or nil if it has no kind
+func classifyError(err error) error {
+	if ldapErr, ok := err.(*LDAP.Error); ok {
+		switch ldapErr.ResultCode {
+		case LDAP.LDAPResultInvalidCredentials:
+			return ErrInvalidCredentials
+		case LDAP.LDAPResultBusy, LDAP.LDAPResultUnavailable, LDAP.LDAPResultServerDown, LDAP.LDAPResultConnectError:
+			return ErrServerUnavailable
+		case LDAP.LDAPResultTimeLimitExceeded, LDAP.LDAPResultTimeout:
+			return ErrTimeout
+		case LDAP.LDAPResultInsufficientAccessRights, LDAP.LDAPResultStrongAuthRequired, LDAP.LDAPResultConfidentialityRequired:
+			return ErrInsufficientAccess
+		case LDAP.LDAPResultConstraintViolation:
+			return ErrConstraintViolation
+		case LDAP.ErrorNetwork:
+			if isTimeout(ldapErr.Err) {
+				return ErrTimeout
+			}
+			return ErrServerUnavailable
+		}
+		return nil
+	}
+
+	if isTimeout(err) {
+		return ErrTimeout
+	}
+
+	return nil
+}
+
+func isTimeout(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return true
+	}
+
+	// the LDAP library reports its request timeout as a plain error
+	return strings.Contains(err.Error(), "timed out")
+}
@@ -0,0 +1,57 @@
+package ldap
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/xerrors"
+	"gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+)
+
+func TestClassifyError(t *testing.T) {
+	Convey("classifyError", t, func() {
+		Convey("Should classify the LDAP result codes", func() {
+			So(classifyError(&ldap.Error{ResultCode: ldap.LDAPResultInvalidCredentials}), ShouldEqual, ErrInvalidCredentials)
+			So(classifyError(&ldap.Error{ResultCode: ldap.LDAPResultUnavailable}), ShouldEqual, ErrServerUnavailable)
+			So(classifyError(&ldap.Error{ResultCode: ldap.LDAPResultBusy}), ShouldEqual, ErrServerUnavailable)
+			So(classifyError(&ldap.Error{ResultCode: ldap.LDAPResultTimeLimitExceeded}), ShouldEqual, ErrTimeout)
+			So(classifyError(&ldap.Error{ResultCode: ldap.LDAPResultInsufficientAccessRights}), ShouldEqual, ErrInsufficientAccess)
+			So(classifyError(&ldap.Error{ResultCode: ldap.LDAPResultConstraintViolation}), ShouldEqual, ErrConstraintViolation)
+			So(classifyError(&ldap.Error{ResultCode: ldap.LDAPResultOther}), ShouldBeNil)
+		})
+
+		Convey("Should classify the network errors", func() {
+			So(classifyError(ldap.NewError(ldap.ErrorNetwork, errors.New("connection refused"))), ShouldEqual, ErrServerUnavailable)
+			So(classifyError(ldap.NewError(ldap.ErrorNetwork, errors.New("i/o timeout (timed out)"))), ShouldEqual, ErrTimeout)
+			So(classifyError(errors.New("ldap: connection timed out")), ShouldEqual, ErrTimeout)
+		})
+	})
+
+	Convey("sanitizeError classification", t, func() {
+		auth := &Auth{server: &ServerConfig{}, log: log.New("test-logger")}
+
+		Convey("Should let callers check the kind", func() {
+			err := auth.sanitizeError(&ldap.Error{
+				ResultCode: ldap.LDAPResultUnavailable,
+				Err:        errors.New("cn=roel is being replicated"),
+			})
+
+			So(xerrors.Is(err, ErrServerUnavailable), ShouldBeTrue)
+			So(xerrors.Is(err, ErrTimeout), ShouldBeFalse)
+			So(err.Error(), ShouldNotContainSubstring, "roel")
+
+			var ldapErr *ldap.Error
+			So(xerrors.As(err, &ldapErr), ShouldBeTrue)
+			So(ldapErr.ResultCode, ShouldEqual, ldap.LDAPResultUnavailable)
+		})
+
+		Convey("Should return invalid credentials as is", func() {
+			err := auth.sanitizeError(&ldap.Error{ResultCode: ldap.LDAPResultInvalidCredentials, Err: errors.New("")})
+
+			So(err, ShouldEqual, ErrInvalidCredentials)
+		})
+	})
+}
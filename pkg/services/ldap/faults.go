@@ -0,0 +1,218 @@
+package ldap
+
+import (
+	"errors"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+	LDAP "gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// FaultConfig is the faults injected in the binds and searches of the
+// connections, to check how the retries, the failover and the health
+// checks cope with a misbehaving directory
+type FaultConfig struct {
+	// Latency is added to every operation
+	Latency time.Duration
+
+	// TimeoutRate is the share of the operations timing out after Timeout
+	TimeoutRate float64
+	Timeout     time.Duration
+
+	// ErrorRate is the share of the operations failing with ResultCode
+	ErrorRate  float64
+	ResultCode uint16
+
+	// DisconnectRate is the share of the searches cut by a disconnection,
+	// the later operations of the connection failing as well
+	DisconnectRate float64
+
+	// Seed seeds the draws of the faults, 0 seeds them with the time
+	Seed int64
+}
+
+// errFaultTimeout and errFaultDisconnect are the errors of ldap.v3
+// for the timeouts and the closed connections
+var (
+	errFaultTimeout    = errors.New("ldap: connection timed out")
+	errFaultDisconnect = LDAP.NewError(LDAP.ErrorNetwork, errors.New("ldap: connection closed"))
+)
+
+// ParseFaults parses the fault_injection setting, like
+// "latency=200ms,error_rate=0.1,result_code=51,disconnect_rate=0.05"
+func ParseFaults(spec string) (*FaultConfig, error) {
+	config := &FaultConfig{Timeout: 10 * time.Second, ResultCode: LDAP.LDAPResultUnavailable}
+
+	for _, option := range strings.Split(spec, ",") {
+		option = strings.TrimSpace(option)
+		if option == "" {
+			continue
+		}
+
+		parts := strings.SplitN(option, "=", 2)
+		if len(parts) != 2 {
+			return nil, xerrors.Errorf("invalid LDAP fault %q, use name=value", option)
+		}
+		name, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+
+		var err error
+		switch name {
+		case "latency":
+			config.Latency, err = time.ParseDuration(value)
+		case "timeout":
+			config.Timeout, err = time.ParseDuration(value)
+		case "timeout_rate":
+			config.TimeoutRate, err = parseRate(value)
+		case "error_rate":
+			config.ErrorRate, err = parseRate(value)
+		case "result_code":
+			var code uint64
+			code, err = strconv.ParseUint(value, 10, 16)
+			config.ResultCode = uint16(code)
+		case "disconnect_rate":
+			config.DisconnectRate, err = parseRate(value)
+		case "seed":
+			config.Seed, err = strconv.ParseInt(value, 10, 64)
+		default:
+			return nil, xerrors.Errorf("unknown LDAP fault %q", name)
+		}
+		if err != nil {
+			return nil, xerrors.Errorf("invalid LDAP fault %q: %w", option, err)
+		}
+	}
+
+	return config, nil
+}
+
+func parseRate(value string) (float64, error) {
+	rate, err := strconv.ParseFloat(value, 64)
+	if err == nil && (rate < 0 || rate > 1) {
+		err = xerrors.New("rate must be between 0 and 1")
+	}
+	return rate, err
+}
+
+// faults are the faults of the fault_injection setting, nil if there are none
+var faults struct {
+	sync.Mutex
+	spec   string
+	config *FaultConfig
+}
+
+// configuredFaults returns the faults of the fault_injection setting, which
+// is only read in development mode so it can't be left on in production
+func configuredFaults() *FaultConfig {
+	if setting.LdapFaultInjection == "" || setting.Env != setting.DEV {
+		return nil
+	}
+
+	faults.Lock()
+	defer faults.Unlock()
+
+	if faults.spec != setting.LdapFaultInjection {
+		config, err := ParseFaults(setting.LdapFaultInjection)
+		if err != nil {
+			logger.Error("Invalid LDAP fault injection, no faults are injected", "error", err)
+		} else {
+			logger.Warn("Injecting faults in the LDAP connections", "faults", setting.LdapFaultInjection)
+		}
+		faults.spec, faults.config = setting.LdapFaultInjection, config
+	}
+	return faults.config
+}
+
+// faultyConnection injects the faults in the binds and searches of the connection
+type faultyConnection struct {
+	IConnection
+	config *FaultConfig
+
+	mutex        sync.Mutex
+	random       *rand.Rand
+	disconnected bool
+}
+
+// injectFaults wraps the connection to inject the faults, if any
+func injectFaults(conn IConnection, config *FaultConfig) IConnection {
+	if config == nil {
+		return conn
+	}
+
+	seed := config.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &faultyConnection{
+		IConnection: conn,
+		config:      config,
+		random:      rand.New(rand.NewSource(seed)),
+	}
+}
+
+// fault returns the error injected in the operation, if any
+func (conn *faultyConnection) fault(search bool) error {
+	time.Sleep(conn.config.Latency)
+
+	conn.mutex.Lock()
+	disconnected := conn.disconnected
+	timeout := !disconnected && conn.draw(conn.config.TimeoutRate)
+	failed := !disconnected && !timeout && conn.draw(conn.config.ErrorRate)
+	disconnect := search && !disconnected && !timeout && !failed && conn.draw(conn.config.DisconnectRate)
+	conn.disconnected = disconnected || disconnect
+	conn.mutex.Unlock()
+
+	switch {
+	case disconnected:
+		return errFaultDisconnect
+	case timeout:
+		time.Sleep(conn.config.Timeout)
+		return errFaultTimeout
+	case failed:
+		return LDAP.NewError(conn.config.ResultCode, xerrors.New("injected LDAP fault"))
+	case disconnect:
+		conn.IConnection.Close()
+		return errFaultDisconnect
+	}
+	return nil
+}
+
+func (conn *faultyConnection) draw(rate float64) bool {
+	return rate > 0 && conn.random.Float64() < rate
+}
+
+func (conn *faultyConnection) Bind(username, password string) error {
+	if err := conn.fault(false); err != nil {
+		return err
+	}
+	return conn.IConnection.Bind(username, password)
+}
+
+func (conn *faultyConnection) UnauthenticatedBind(username string) error {
+	if err := conn.fault(false); err != nil {
+		return err
+	}
+	return conn.IConnection.UnauthenticatedBind(username)
+}
+
+func (conn *faultyConnection) SimpleBind(request *LDAP.SimpleBindRequest) (*LDAP.SimpleBindResult, error) {
+	if err := conn.fault(false); err != nil {
+		return nil, err
+	}
+	return conn.IConnection.SimpleBind(request)
+}
+
+func (conn *faultyConnection) Search(request *LDAP.SearchRequest) (*LDAP.SearchResult, error) {
+	if err := conn.fault(true); err != nil {
+		return nil, err
+	}
+	return conn.IConnection.Search(request)
+}
+
+func (conn *faultyConnection) SearchStream(request *LDAP.SearchRequest, pagingSize uint32, handle EntryHandler) error {
+	return streamSearch(conn, request, pagingSize, handle)
+}
@@ -0,0 +1,116 @@
+package ldap
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	LDAP "gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+func TestFaults(t *testing.T) {
+	Convey("ParseFaults", t, func() {
+		config, err := ParseFaults("latency=200ms, error_rate=0.1,result_code=51,disconnect_rate=0.05,seed=42")
+		So(err, ShouldBeNil)
+		So(config, ShouldResemble, &FaultConfig{
+			Latency:        200 * time.Millisecond,
+			Timeout:        10 * time.Second,
+			ErrorRate:      0.1,
+			ResultCode:     LDAP.LDAPResultBusy,
+			DisconnectRate: 0.05,
+			Seed:           42,
+		})
+
+		_, err = ParseFaults("error_rate=2")
+		So(err, ShouldNotBeNil)
+		_, err = ParseFaults("flakiness=1")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("configuredFaults", t, func() {
+		defer func() {
+			setting.LdapFaultInjection = ""
+			setting.Env = setting.DEV
+		}()
+		setting.LdapFaultInjection = "error_rate=1"
+
+		So(configuredFaults().ErrorRate, ShouldEqual, 1)
+
+		setting.Env = setting.PROD
+		So(configuredFaults(), ShouldBeNil)
+	})
+
+	Convey("injectFaults", t, func() {
+		closed := false
+		mock := &mockLdapConn{
+			searchProvider: func(request *LDAP.SearchRequest) (*LDAP.SearchResult, error) {
+				return &LDAP.SearchResult{}, nil
+			},
+		}
+		conn := injectFaults(&closingConn{mockLdapConn: mock, closed: &closed}, &FaultConfig{})
+		request := &LDAP.SearchRequest{}
+
+		Convey("Should not wrap the connection without faults", func() {
+			So(injectFaults(mock, nil), ShouldEqual, mock)
+		})
+
+		Convey("Should add the latency", func() {
+			conn.(*faultyConnection).config.Latency = 20 * time.Millisecond
+
+			start := time.Now()
+			So(conn.Bind("cn=admin", "secret"), ShouldBeNil)
+			So(time.Since(start), ShouldBeGreaterThanOrEqualTo, 20*time.Millisecond)
+		})
+
+		Convey("Should fail with the result code", func() {
+			conn.(*faultyConnection).config.ErrorRate = 1
+			conn.(*faultyConnection).config.ResultCode = LDAP.LDAPResultBusy
+
+			So(LDAP.IsErrorWithCode(conn.Bind("cn=admin", "secret"), LDAP.LDAPResultBusy), ShouldBeTrue)
+			_, err := conn.Search(request)
+			So(LDAP.IsErrorWithCode(err, LDAP.LDAPResultBusy), ShouldBeTrue)
+		})
+
+		Convey("Should time out", func() {
+			conn.(*faultyConnection).config.TimeoutRate = 1
+			conn.(*faultyConnection).config.Timeout = time.Millisecond
+
+			So(conn.Bind("cn=admin", "secret"), ShouldEqual, errFaultTimeout)
+		})
+
+		Convey("Should disconnect in the searches only, for good", func() {
+			conn.(*faultyConnection).config.DisconnectRate = 1
+
+			So(conn.Bind("cn=admin", "secret"), ShouldBeNil)
+			_, err := conn.Search(request)
+			So(LDAP.IsErrorWithCode(err, LDAP.ErrorNetwork), ShouldBeTrue)
+			So(closed, ShouldBeTrue)
+
+			conn.(*faultyConnection).config.DisconnectRate = 0
+			So(LDAP.IsErrorWithCode(conn.Bind("cn=admin", "secret"), LDAP.ErrorNetwork), ShouldBeTrue)
+		})
+
+		Convey("Should have the busy errors retried", func() {
+			busyRetryDelay = time.Millisecond
+			defer func() { busyRetryDelay = 250 * time.Millisecond }()
+
+			faulty := injectFaults(mock, &FaultConfig{ErrorRate: 0.5, ResultCode: LDAP.LDAPResultBusy, Seed: 1})
+			retried := retryConnection(faulty, 10)
+			for i := 0; i < 20; i++ {
+				So(retried.Bind("cn=admin", "secret"), ShouldBeNil)
+			}
+		})
+	})
+}
+
+// closingConn records that the connection was closed
+type closingConn struct {
+	*mockLdapConn
+	closed *bool
+}
+
+func (conn *closingConn) Close() {
+	*conn.closed = true
+}
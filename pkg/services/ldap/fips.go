@@ -0,0 +1,57 @@
+package ldap
+
+import (
+	"crypto/tls"
+
+	"golang.org/x/xerrors"
+
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// fipsCipherSuites are the FIPS 140-2 approved cipher suites supported by crypto/tls
+var fipsCipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_RSA_WITH_AES_256_GCM_SHA384,
+}
+
+// fipsCurves are the FIPS 140-2 approved elliptic curves
+var fipsCurves = []tls.CurveID{
+	tls.CurveP256,
+	tls.CurveP384,
+	tls.CurveP521,
+}
+
+// applyFIPS restricts the TLS config to the FIPS approved
+// protocol versions and algorithms when fips_mode is enabled
+func applyFIPS(config *tls.Config) {
+	if !setting.LdapFIPSMode {
+		return
+	}
+
+	config.MinVersion = tls.VersionTLS12
+	config.MaxVersion = tls.VersionTLS12
+	config.CipherSuites = fipsCipherSuites
+	config.CurvePreferences = fipsCurves
+	config.PreferServerCipherSuites = false
+}
+
+// validateFIPS checks that the server settings are compatible with fips_mode
+func validateFIPS(server *ServerConfig) error {
+	if !setting.LdapFIPSMode {
+		return nil
+	}
+
+	if !server.UseSSL {
+		return xerrors.Errorf("LDAP server %v must set use_ssl in fips_mode", ServerKey(server))
+	}
+
+	if server.SkipVerifySSL {
+		return xerrors.Errorf("LDAP server %v can't use ssl_skip_verify in fips_mode", ServerKey(server))
+	}
+
+	return nil
+}
@@ -0,0 +1,44 @@
+package ldap
+
+import (
+	"crypto/tls"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+func TestFIPSMode(t *testing.T) {
+	Convey("FIPS mode", t, func() {
+		defer func() { setting.LdapFIPSMode = false }()
+
+		Convey("Should leave the TLS config alone when disabled", func() {
+			config := &tls.Config{}
+
+			applyFIPS(config)
+
+			So(config.CipherSuites, ShouldBeNil)
+			So(validateFIPS(&ServerConfig{SkipVerifySSL: true}), ShouldBeNil)
+		})
+
+		Convey("Should restrict the TLS config when enabled", func() {
+			setting.LdapFIPSMode = true
+			config := &tls.Config{}
+
+			applyFIPS(config)
+
+			So(config.MinVersion, ShouldEqual, tls.VersionTLS12)
+			So(config.CipherSuites, ShouldResemble, fipsCipherSuites)
+			So(config.CurvePreferences, ShouldResemble, fipsCurves)
+		})
+
+		Convey("Should refuse incompatible servers when enabled", func() {
+			setting.LdapFIPSMode = true
+
+			So(validateFIPS(&ServerConfig{UseSSL: true}), ShouldBeNil)
+			So(validateFIPS(&ServerConfig{UseSSL: false}), ShouldNotBeNil)
+			So(validateFIPS(&ServerConfig{UseSSL: true, SkipVerifySSL: true}), ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,84 @@
+package ldap
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	LDAP "gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/infra/metrics"
+)
+
+// emptyGroupSearchesWarning is the number of group searches finding no
+// groups, with none found before, after which the group search of a
+// server is reported as misconfigured
+const emptyGroupSearchesWarning = 10
+
+// groupSearchHints are the usual causes of group searches finding nothing
+const groupSearchHints = "check that group_search_base_dns exist and contain the groups, that the filters match " +
+	"the group entries of the members with the user attribute their %s is replaced with, and that the bind account " +
+	"may read the groups"
+
+// groupSearchState tells how the group searches of a server went
+type groupSearchState struct {
+	found   bool
+	empty   int
+	warned  bool
+	missing map[string]bool
+}
+
+// groupSearchStates are kept by server and group_search_base_dns, so a
+// config changing the bases starts over
+var groupSearchStates = map[string]*groupSearchState{}
+var groupSearchStatesMutex = &sync.Mutex{}
+
+// isNoSuchObject checks if the error is the one of a base DN missing
+// from the directory
+func isNoSuchObject(err error) bool {
+	ldapErr, ok := err.(*LDAP.Error)
+	return ok && ldapErr.ResultCode == LDAP.LDAPResultNoSuchObject
+}
+
+// recordGroupSearch records the result of a group search of the user,
+// with the group search bases missing from the directory. Once the
+// searches found no groups emptyGroupSearchesWarning times, and never
+// found any, a single warning is logged with the remediation hints
+// instead of one per login
+func (auth *Auth) recordGroupSearch(found bool, missingBases []string) {
+	key := ServerKey(auth.server) + "\x00" + strings.Join(auth.server.GroupSearchBaseDNs, "\x00")
+
+	groupSearchStatesMutex.Lock()
+	defer groupSearchStatesMutex.Unlock()
+
+	state, ok := groupSearchStates[key]
+	if !ok {
+		state = &groupSearchState{missing: map[string]bool{}}
+		groupSearchStates[key] = state
+	}
+	for _, base := range missingBases {
+		state.missing[base] = true
+	}
+
+	if found {
+		state.found = true
+		return
+	}
+
+	metrics.M_Ldap_Empty_Group_Searches.WithLabelValues(ServerKey(auth.server)).Inc()
+	state.empty++
+	if state.found || state.warned || state.empty < emptyGroupSearchesWarning {
+		return
+	}
+	state.warned = true
+
+	missing := make([]string, 0, len(state.missing))
+	for base := range state.missing {
+		missing = append(missing, base)
+	}
+	sort.Strings(missing)
+
+	auth.log.Warn("LDAP group searches find no groups for any user, the group search is likely misconfigured, "+groupSearchHints,
+		"server", ServerKey(auth.server), "searches", state.empty, "group_search_base_dns", auth.server.GroupSearchBaseDNs,
+		"missing_base_dns", missing)
+}
@@ -0,0 +1,73 @@
+package ldap
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	LDAP "gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+)
+
+func TestGroupSearchBases(t *testing.T) {
+	Convey("Searching for groups in misconfigured bases", t, func() {
+		defer func() { groupSearchStates = map[string]*groupSearchState{} }()
+
+		found := false
+		conn := &mockLdapConn{}
+		conn.searchProvider = func(request *LDAP.SearchRequest) (*LDAP.SearchResult, error) {
+			if request.BaseDN == "ou=users,dc=grafana,dc=org" {
+				return &LDAP.SearchResult{Entries: []*LDAP.Entry{
+					LDAP.NewEntry(fmt.Sprintf("uid=%s,ou=users,dc=grafana,dc=org", request.Filter), map[string][]string{"uid": {request.Filter}}),
+				}}, nil
+			}
+			if request.BaseDN == "ou=grups,dc=grafana,dc=org" {
+				return nil, &LDAP.Error{ResultCode: LDAP.LDAPResultNoSuchObject, Err: errors.New("no such object")}
+			}
+			if found {
+				return &LDAP.SearchResult{Entries: []*LDAP.Entry{LDAP.NewEntry("cn=admins,ou=groups,dc=grafana,dc=org", nil)}}, nil
+			}
+			return &LDAP.SearchResult{}, nil
+		}
+		auth := &Auth{conn: conn, log: log.New("test-logger"), server: &ServerConfig{
+			Host:               "ldap.example.org",
+			Attr:               AttributeMap{Username: "uid"},
+			SearchFilter:       "%s",
+			SearchBaseDNs:      []string{"ou=users,dc=grafana,dc=org"},
+			GroupSearchFilter:  "(memberUid=%s)",
+			GroupSearchBaseDNs: []string{"ou=grups,dc=grafana,dc=org", "ou=groups,dc=grafana,dc=org"},
+		}}
+		state := func() *groupSearchState {
+			return groupSearchStates["ldap.example.org:0\x00ou=grups,dc=grafana,dc=org\x00ou=groups,dc=grafana,dc=org"]
+		}
+
+		Convey("Should skip the missing bases and warn once after the empty searches", func() {
+			for i := 0; i < emptyGroupSearchesWarning-1; i++ {
+				_, err := auth.searchForUser(fmt.Sprintf("user%d", i), searchEverything)
+				So(err, ShouldBeNil)
+			}
+			So(state().warned, ShouldBeFalse)
+
+			_, err := auth.searchForUser("roel", searchEverything)
+			So(err, ShouldBeNil)
+			So(state().warned, ShouldBeTrue)
+			So(state().missing, ShouldResemble, map[string]bool{"ou=grups,dc=grafana,dc=org": true})
+		})
+
+		Convey("Should not warn once groups were found", func() {
+			found = true
+			user, err := auth.searchForUser("roel", searchEverything)
+			So(err, ShouldBeNil)
+			So(user.MemberOf, ShouldResemble, []string{"cn=admins,ou=groups,dc=grafana,dc=org"})
+
+			found = false
+			for i := 0; i < emptyGroupSearchesWarning; i++ {
+				_, err := auth.searchForUser(fmt.Sprintf("user%d", i), searchEverything)
+				So(err, ShouldBeNil)
+			}
+			So(state().warned, ShouldBeFalse)
+		})
+	})
+}
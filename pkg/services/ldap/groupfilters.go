@@ -0,0 +1,125 @@
+package ldap
+
+import (
+	"strings"
+
+	"golang.org/x/xerrors"
+	LDAP "gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/models"
+)
+
+// GroupSearchFilter is one of the group_search_filters, the %s of its
+// filter is the value of the UserAttribute of the user, "dn" for its DN
+type GroupSearchFilter struct {
+	Filter        string `toml:"filter"`
+	UserAttribute string `toml:"user_attribute"`
+}
+
+// Group is a group of the user matched by the group search, with the
+// group_attributes of its entry. ID is the value of the group in the
+// MemberOf of the user, of the group_search_group_attribute
+type Group struct {
+	DN          string
+	ID          string
+	Name        string
+	Description string
+	GidNumber   string
+}
+
+// GroupAttributeMap names the attributes of the group entries read into
+// the Group of the groups matched by the group search
+type GroupAttributeMap struct {
+	Name        string `toml:"name"`
+	Description string `toml:"description"`
+	GidNumber   string `toml:"gid_number"`
+}
+
+// groupSearchAttributes returns the attributes of the group entries
+// searched for, the id of the groups and the group_attributes
+func (server *ServerConfig) groupSearchAttributes(groupIdAttribute string) []string {
+	return appendIfNotEmpty([]string{groupIdAttribute},
+		server.GroupAttr.Name,
+		server.GroupAttr.Description,
+		server.GroupAttr.GidNumber,
+	)
+}
+
+// readGroup reads the group of the entry n of the group search result
+func (server *ServerConfig) readGroup(result *LDAP.SearchResult, n int, groupIdAttribute string) *Group {
+	group := &Group{
+		DN: result.Entries[n].DN,
+		ID: getLdapAttrN(groupIdAttribute, result, n),
+	}
+	if server.GroupAttr.Name != "" {
+		group.Name = getLdapAttrN(server.GroupAttr.Name, result, n)
+	}
+	if server.GroupAttr.Description != "" {
+		group.Description = getLdapAttrN(server.GroupAttr.Description, result, n)
+	}
+	if server.GroupAttr.GidNumber != "" {
+		group.GidNumber = getLdapAttrN(server.GroupAttr.GidNumber, result, n)
+	}
+	return group
+}
+
+// externalGroups returns the groups with the group_attributes read for
+// the GroupDetails of the Grafana user
+func externalGroups(groups []*Group) []*models.ExternalGroup {
+	var details []*models.ExternalGroup
+	for _, group := range groups {
+		if group.Name == "" && group.Description == "" && group.GidNumber == "" {
+			continue
+		}
+		details = append(details, &models.ExternalGroup{
+			Id:          group.ID,
+			Name:        group.Name,
+			Description: group.Description,
+			GidNumber:   group.GidNumber,
+		})
+	}
+	return details
+}
+
+// groupSearchFilters returns the group_search_filter and the
+// group_search_filters, the groups of the user are the union of their
+// matches
+func (server *ServerConfig) groupSearchFilters() []*GroupSearchFilter {
+	filters := make([]*GroupSearchFilter, 0, len(server.GroupSearchFilters)+1)
+	if server.GroupSearchFilter != "" {
+		filters = append(filters, &GroupSearchFilter{
+			Filter:        server.GroupSearchFilter,
+			UserAttribute: server.GroupSearchFilterUserAttribute,
+		})
+	}
+	return append(filters, server.GroupSearchFilters...)
+}
+
+// groupSearchUserAttributes returns the attributes of the user the group
+// search filters need, besides its DN
+func (server *ServerConfig) groupSearchUserAttributes() []string {
+	var attributes []string
+	for _, filter := range server.groupSearchFilters() {
+		if !strings.EqualFold(filter.UserAttribute, "dn") {
+			attributes = appendIfNotEmpty(attributes, filter.UserAttribute)
+		}
+	}
+	return attributes
+}
+
+// validateGroupSearchFilters checks the group_search_filters have a
+// filter and group_search_base_dns to search
+func validateGroupSearchFilters(server *ServerConfig) error {
+	for i, filter := range server.GroupSearchFilters {
+		if filter.Filter == "" {
+			return xerrors.Errorf("group_search_filters %d has no filter", i+1)
+		}
+		if placeholder := unknownPlaceholder(filter.Filter); placeholder != "" {
+			return xerrors.Errorf("Unknown placeholder %s in group_search_filters %d, use %s", placeholder, i+1, placeholderNames)
+		}
+	}
+	if len(server.GroupSearchFilters) > 0 && len(server.GroupSearchBaseDNs) == 0 {
+		return xerrors.New("group_search_filters requires group_search_base_dns")
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package ldap
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	LDAP "gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+)
+
+func TestGroupSearchFilters(t *testing.T) {
+	Convey("validateGroupSearchFilters", t, func() {
+		So(validateGroupSearchFilters(&ServerConfig{}), ShouldBeNil)
+		So(validateGroupSearchFilters(&ServerConfig{
+			GroupSearchFilters: []*GroupSearchFilter{{Filter: "(member=%s)"}},
+		}), ShouldNotBeNil)
+		So(validateGroupSearchFilters(&ServerConfig{
+			GroupSearchBaseDNs: []string{"ou=groups,dc=grafana,dc=org"},
+			GroupSearchFilters: []*GroupSearchFilter{{UserAttribute: "dn"}},
+		}), ShouldNotBeNil)
+		So(validateGroupSearchFilters(&ServerConfig{
+			GroupSearchBaseDNs: []string{"ou=groups,dc=grafana,dc=org"},
+			GroupSearchFilters: []*GroupSearchFilter{{Filter: "(member={{.Login}})"}},
+		}), ShouldNotBeNil)
+	})
+
+	Convey("Searching for the groups of a user with several group search filters", t, func() {
+		conn := &mockLdapConn{}
+		var filters []string
+		conn.searchProvider = func(request *LDAP.SearchRequest) (*LDAP.SearchResult, error) {
+			switch request.Filter {
+			case "(uid=roel)":
+				return &LDAP.SearchResult{Entries: []*LDAP.Entry{
+					LDAP.NewEntry("uid=roel,ou=users,dc=grafana,dc=org", map[string][]string{"uid": {"roel"}}),
+				}}, nil
+			case "(&(objectClass=posixGroup)(memberUid=roel))":
+				filters = append(filters, request.Filter)
+				return &LDAP.SearchResult{Entries: []*LDAP.Entry{
+					LDAP.NewEntry("cn=admins,ou=groups,dc=grafana,dc=org", nil),
+					LDAP.NewEntry("cn=posix,ou=groups,dc=grafana,dc=org", nil),
+				}}, nil
+			case "(&(objectClass=groupOfNames)(member=uid=roel,ou=users,dc=grafana,dc=org))":
+				filters = append(filters, request.Filter)
+				return &LDAP.SearchResult{Entries: []*LDAP.Entry{
+					LDAP.NewEntry("CN=admins,ou=groups,dc=grafana,dc=org", nil),
+					LDAP.NewEntry("cn=editors,ou=groups,dc=grafana,dc=org", nil),
+				}}, nil
+			}
+			return &LDAP.SearchResult{}, nil
+		}
+
+		auth := &Auth{conn: conn, log: log.New("test-logger"), server: &ServerConfig{
+			Attr:                           AttributeMap{Username: "uid"},
+			SearchFilter:                   "(uid=%s)",
+			SearchBaseDNs:                  []string{"ou=users,dc=grafana,dc=org"},
+			GroupSearchFilter:              "(&(objectClass=posixGroup)(memberUid=%s))",
+			GroupSearchFilterUserAttribute: "uid",
+			GroupSearchBaseDNs:             []string{"ou=groups,dc=grafana,dc=org"},
+			GroupSearchFilters: []*GroupSearchFilter{
+				{Filter: "(&(objectClass=groupOfNames)(member=%s))", UserAttribute: "dn"},
+			},
+		}}
+
+		Convey("Should union the groups matching the filters", func() {
+			user, err := auth.searchForUser("roel", searchEverything)
+			So(err, ShouldBeNil)
+			So(filters, ShouldHaveLength, 2)
+			So(user.MemberOf, ShouldResemble, []string{
+				"cn=admins,ou=groups,dc=grafana,dc=org",
+				"cn=posix,ou=groups,dc=grafana,dc=org",
+				"cn=editors,ou=groups,dc=grafana,dc=org",
+			})
+		})
+
+		Convey("Should read the group_attributes of the groups", func() {
+			auth.server.GroupSearchFilters = nil
+			auth.server.GroupAttr = GroupAttributeMap{Name: "cn", Description: "description", GidNumber: "gidNumber"}
+			conn.searchProvider = func(request *LDAP.SearchRequest) (*LDAP.SearchResult, error) {
+				if request.Filter == "(uid=roel)" {
+					return &LDAP.SearchResult{Entries: []*LDAP.Entry{
+						LDAP.NewEntry("uid=roel,ou=users,dc=grafana,dc=org", map[string][]string{"uid": {"roel"}}),
+					}}, nil
+				}
+				So(request.Attributes, ShouldResemble, []string{"dn", "cn", "description", "gidNumber"})
+				return &LDAP.SearchResult{Entries: []*LDAP.Entry{
+					LDAP.NewEntry("cn=admins,ou=groups,dc=grafana,dc=org", map[string][]string{
+						"cn": {"admins"}, "description": {"Grafana admins"}, "gidNumber": {"5001"},
+					}),
+					LDAP.NewEntry("cn=posix,ou=groups,dc=grafana,dc=org", nil),
+				}}, nil
+			}
+
+			user, err := auth.searchForUser("roel", searchEverything)
+			So(err, ShouldBeNil)
+			So(user.MemberOf, ShouldResemble, []string{"cn=admins,ou=groups,dc=grafana,dc=org", "cn=posix,ou=groups,dc=grafana,dc=org"})
+			So(user.Groups, ShouldHaveLength, 2)
+			So(*user.Groups[0], ShouldResemble, Group{
+				DN:          "cn=admins,ou=groups,dc=grafana,dc=org",
+				ID:          "cn=admins,ou=groups,dc=grafana,dc=org",
+				Name:        "admins",
+				Description: "Grafana admins",
+				GidNumber:   "5001",
+			})
+
+			details := auth.buildGrafanaUser(user).GroupDetails
+			So(details, ShouldHaveLength, 1)
+			So(details[0].Id, ShouldEqual, "cn=admins,ou=groups,dc=grafana,dc=org")
+			So(details[0].Name, ShouldEqual, "admins")
+		})
+	})
+}
@@ -0,0 +1,72 @@
+package ldap
+
+import (
+	"sort"
+	"strings"
+)
+
+// groupMapping is the lookup of the group mappings of a server, built
+// once per config load. Mapping a user then costs a lookup per group of
+// the user instead of comparing every group with every mapping, which
+// adds up for the syncs of hundreds of thousands of users
+type groupMapping struct {
+	// mappings are the indexes in the group mappings of the mappings of
+	// each lowercased group DN, in config order
+	mappings map[string][]int
+
+	// wildcards are the indexes of the "*" mappings
+	wildcards []int
+}
+
+// newGroupMapping builds the lookup of the group mappings
+func newGroupMapping(groups []*GroupToOrgRole) *groupMapping {
+	mapping := &groupMapping{mappings: map[string][]int{}}
+	for i, group := range groups {
+		if group.GroupDN == "*" {
+			mapping.wildcards = append(mapping.wildcards, i)
+			continue
+		}
+		key := strings.ToLower(group.GroupDN)
+		mapping.mappings[key] = append(mapping.mappings[key], i)
+	}
+	return mapping
+}
+
+// buildGroupMapping builds the lookup of the group mappings of the server,
+// it must be rebuilt when they change
+func (server *ServerConfig) buildGroupMapping() {
+	server.groupMapping = newGroupMapping(server.Groups)
+}
+
+// matchingGroups returns the group mappings the user is a member of, in
+// config order. The servers whose lookup wasn't built, like the ones of
+// the tests, compare the groups with the mappings
+func (server *ServerConfig) matchingGroups(user *UserInfo) []*GroupToOrgRole {
+	if server.groupMapping == nil {
+		matching := []*GroupToOrgRole{}
+		for _, group := range server.Groups {
+			if user.isMemberOf(group.GroupDN) {
+				matching = append(matching, group)
+			}
+		}
+		return matching
+	}
+
+	indexes := append([]int{}, server.groupMapping.wildcards...)
+	seen := map[string]bool{}
+	for _, member := range user.MemberOf {
+		key := strings.ToLower(member)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		indexes = append(indexes, server.groupMapping.mappings[key]...)
+	}
+	sort.Ints(indexes)
+
+	matching := make([]*GroupToOrgRole, 0, len(indexes))
+	for _, i := range indexes {
+		matching = append(matching, server.Groups[i])
+	}
+	return matching
+}
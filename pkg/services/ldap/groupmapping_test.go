@@ -0,0 +1,114 @@
+package ldap
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/grafana/grafana/pkg/models"
+)
+
+func TestGroupMapping(t *testing.T) {
+	Convey("Group mapping lookup", t, func() {
+		groups := func() []*GroupToOrgRole {
+			isAdmin := true
+			return []*GroupToOrgRole{
+				{GroupDN: "cn=admins,dc=grafana,dc=org", OrgId: 1, OrgRole: models.ROLE_ADMIN, IsGrafanaAdmin: &isAdmin},
+				{GroupDN: "cn=editors,dc=grafana,dc=org", OrgId: 1, OrgRole: models.ROLE_EDITOR},
+				{GroupDN: "CN=Editors,DC=grafana,DC=org", OrgId: 2, OrgRole: models.ROLE_EDITOR},
+				{GroupDN: "*", OrgId: 2, OrgRole: models.ROLE_VIEWER},
+				{GroupDN: "cn=viewers,dc=grafana,dc=org", OrgId: 3, OrgRole: models.ROLE_VIEWER},
+			}
+		}
+		memoized := &ServerConfig{Groups: groups()}
+		memoized.buildGroupMapping()
+		linear := &ServerConfig{Groups: groups()}
+
+		users := []*UserInfo{
+			{DN: "cn=roel", MemberOf: []string{"cn=editors,dc=grafana,dc=org", "CN=ADMINS,dc=grafana,dc=org"}},
+			{DN: "cn=tod", MemberOf: []string{"cn=viewers,dc=grafana,dc=org", "cn=viewers,dc=grafana,dc=org"}},
+			{DN: "cn=torkel", MemberOf: []string{"cn=unmapped,dc=grafana,dc=org"}},
+			{DN: "cn=leo"},
+		}
+
+		Convey("Should match the mappings in config order, once each", func() {
+			matching := memoized.matchingGroups(users[0])
+
+			dns := []string{}
+			for _, group := range matching {
+				dns = append(dns, group.GroupDN)
+			}
+			So(dns, ShouldResemble, []string{
+				"cn=admins,dc=grafana,dc=org",
+				"cn=editors,dc=grafana,dc=org",
+				"CN=Editors,DC=grafana,DC=org",
+				"*",
+			})
+		})
+
+		Convey("Should map the users like comparing every group with every mapping", func() {
+			for _, user := range users {
+				expected := New(linear).(*Auth).buildGrafanaUser(user)
+				actual := New(memoized).(*Auth).buildGrafanaUser(user)
+				So(actual, ShouldResemble, expected)
+			}
+		})
+
+		Convey("Should be built by validateConfig", func() {
+			config := &Config{Servers: []*ServerConfig{{
+				Host:          "ldap.example.org",
+				SearchFilter:  "(cn=%s)",
+				SearchBaseDNs: []string{"dc=grafana,dc=org"},
+				Groups:        groups(),
+			}}}
+			So(validateConfig(config), ShouldBeNil)
+			So(config.Servers[0].groupMapping, ShouldNotBeNil)
+			So(config.Servers[0].matchingGroups(users[2]), ShouldHaveLength, 1)
+		})
+	})
+}
+
+// benchmarkServer returns a server with 500 group mappings over 10 orgs,
+// and a user member of 50 groups, a tenth of them mapped
+func benchmarkServer() (*ServerConfig, *UserInfo) {
+	server := &ServerConfig{}
+	for i := 0; i < 500; i++ {
+		server.Groups = append(server.Groups, &GroupToOrgRole{
+			GroupDN: fmt.Sprintf("cn=group-%d,ou=groups,dc=grafana,dc=org", i),
+			OrgId:   int64(i%10 + 1),
+			OrgRole: models.ROLE_VIEWER,
+		})
+	}
+
+	user := &UserInfo{DN: "cn=roel,dc=grafana,dc=org"}
+	for i := 0; i < 50; i++ {
+		group := fmt.Sprintf("cn=unmapped-%d,ou=groups,dc=grafana,dc=org", i)
+		if i%10 == 0 {
+			group = fmt.Sprintf("CN=Group-%d,ou=groups,dc=grafana,dc=org", i*10+5)
+		}
+		user.MemberOf = append(user.MemberOf, group)
+	}
+	return server, user
+}
+
+func BenchmarkBuildGrafanaUserLinear(b *testing.B) {
+	server, user := benchmarkServer()
+	auth := New(server).(*Auth)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		auth.buildGrafanaUser(user)
+	}
+}
+
+func BenchmarkBuildGrafanaUserMemoized(b *testing.B) {
+	server, user := benchmarkServer()
+	server.buildGroupMapping()
+	auth := New(server).(*Auth)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		auth.buildGrafanaUser(user)
+	}
+}
@@ -0,0 +1,106 @@
+package ldap
+
+import (
+	"errors"
+	"strings"
+
+	LDAP "gopkg.in/ldap.v3"
+)
+
+// modifyTimestampAttribute is the operational attribute of the time an
+// entry was last modified, it changes with the members of a group
+const modifyTimestampAttribute = "modifyTimestamp"
+
+// defaultGroupMemberAttribute is the group_member_attribute by default
+const defaultGroupMemberAttribute = "member"
+
+// WatchedGroup is a mapped group read by WatchGroups. Its Members are nil
+// when it wasn't modified
+type WatchedGroup struct {
+	DN       string
+	Modified string
+	Members  []string
+}
+
+// groupMemberAttribute returns the attribute of the members of the groups
+func (server *ServerConfig) groupMemberAttribute() string {
+	if server.GroupMemberAttribute == "" {
+		return defaultGroupMemberAttribute
+	}
+	return server.GroupMemberAttribute
+}
+
+// mappedGroupDNs returns the DNs of the group mappings, without the
+// wildcard one and the duplicates
+func (server *ServerConfig) mappedGroupDNs() []string {
+	seen := map[string]bool{}
+	dns := []string{}
+	for _, group := range server.Groups {
+		key := strings.ToLower(group.GroupDN)
+		if group.GroupDN == "*" || group.GroupDN == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		dns = append(dns, group.GroupDN)
+	}
+	return dns
+}
+
+// WatchGroups reads the modifyTimestamp of the mapped groups and the
+// members of the ones whose timestamp isn't the one in modified, by DN.
+// The members of the groups without a readable timestamp are always
+// read, and the groups which can't be read are left out
+func (auth *Auth) WatchGroups(modified map[string]string) ([]*WatchedGroup, error) {
+	if err := operations.start(auth); err != nil {
+		return nil, err
+	}
+	defer operations.finish(auth)
+
+	err := auth.connectService()
+	if err != nil {
+		return nil, auth.sanitizeError(err)
+	}
+	defer auth.conn.Close()
+
+	memberAttr := auth.server.groupMemberAttribute()
+	groups := []*WatchedGroup{}
+	for _, dn := range auth.server.mappedGroupDNs() {
+		result, err := auth.readGroupEntry(dn, modifyTimestampAttribute)
+		if err != nil {
+			auth.log.Debug("Failed to read the watched LDAP group", "dn", dn, "error", auth.sanitizeError(err))
+			continue
+		}
+
+		group := &WatchedGroup{DN: dn, Modified: getLdapAttr(modifyTimestampAttribute, result)}
+		if group.Modified == "" || group.Modified != modified[dn] {
+			result, err = auth.readGroupEntry(dn, memberAttr)
+			if err != nil {
+				auth.log.Debug("Failed to read the members of the watched LDAP group", "dn", dn, "error", auth.sanitizeError(err))
+				continue
+			}
+			group.Members = append([]string{}, getLdapAttrArray(memberAttr, result)...)
+		}
+		groups = append(groups, group)
+	}
+
+	return groups, nil
+}
+
+// readGroupEntry reads the attribute of the entry of the group
+func (auth *Auth) readGroupEntry(dn string, attribute string) (*LDAP.SearchResult, error) {
+	result, err := auth.search(searchGroupWatch, &LDAP.SearchRequest{
+		BaseDN:       dn,
+		Scope:        LDAP.ScopeBaseObject,
+		DerefAliases: LDAP.NeverDerefAliases,
+		Attributes:   []string{attribute},
+		TimeLimit:    auth.server.SearchTimeout,
+		Filter:       "(objectClass=*)",
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Entries) == 0 {
+		return nil, errors.New("group entry not found")
+	}
+	return result, nil
+}
@@ -0,0 +1,79 @@
+package ldap
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	LDAP "gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+)
+
+func TestWatchGroups(t *testing.T) {
+	Convey("WatchGroups", t, func() {
+		entries := map[string]*LDAP.Entry{
+			"cn=admins,dc=grafana,dc=org": LDAP.NewEntry("cn=admins,dc=grafana,dc=org", map[string][]string{
+				"modifyTimestamp": {"20191014120000Z"},
+				"member":          {"cn=roel,dc=grafana,dc=org", "cn=tod,dc=grafana,dc=org"},
+			}),
+			"cn=editors,dc=grafana,dc=org": LDAP.NewEntry("cn=editors,dc=grafana,dc=org", map[string][]string{
+				"member": {"cn=torkel,dc=grafana,dc=org"},
+			}),
+		}
+		conn := &mockLdapConn{}
+		conn.searchProvider = func(request *LDAP.SearchRequest) (*LDAP.SearchResult, error) {
+			So(request.Scope, ShouldEqual, LDAP.ScopeBaseObject)
+			result := &LDAP.SearchResult{}
+			if entry, ok := entries[request.BaseDN]; ok {
+				result.Entries = []*LDAP.Entry{LDAP.NewEntry(entry.DN, map[string][]string{
+					request.Attributes[0]: entry.GetAttributeValues(request.Attributes[0]),
+				})}
+			}
+			return result, nil
+		}
+		hookDial = func(auth *Auth) error {
+			auth.conn = conn
+			return nil
+		}
+		defer keepDial()()
+
+		auth := &Auth{log: log.New("test-logger"), server: &ServerConfig{
+			BindDN: "cn=admin,dc=grafana,dc=org",
+			Groups: []*GroupToOrgRole{
+				{GroupDN: "cn=admins,dc=grafana,dc=org"},
+				{GroupDN: "cn=admins,dc=grafana,dc=org", OrgId: 2},
+				{GroupDN: "cn=editors,dc=grafana,dc=org"},
+				{GroupDN: "cn=gone,dc=grafana,dc=org"},
+				{GroupDN: "*"},
+			},
+		}}
+
+		Convey("Should read the members of the modified groups", func() {
+			groups, err := auth.WatchGroups(map[string]string{})
+			So(err, ShouldBeNil)
+			So(groups, ShouldHaveLength, 2)
+			So(groups[0].Modified, ShouldEqual, "20191014120000Z")
+			So(groups[0].Members, ShouldResemble, []string{"cn=roel,dc=grafana,dc=org", "cn=tod,dc=grafana,dc=org"})
+			So(groups[1].Members, ShouldResemble, []string{"cn=torkel,dc=grafana,dc=org"})
+		})
+
+		Convey("Should not read the members of the groups with the same timestamp", func() {
+			groups, err := auth.WatchGroups(map[string]string{"cn=admins,dc=grafana,dc=org": "20191014120000Z"})
+			So(err, ShouldBeNil)
+			So(groups[0].Members, ShouldBeNil)
+			// without timestamp the members are always read
+			So(groups[1].Members, ShouldNotBeNil)
+		})
+
+		Convey("Should read the group_member_attribute", func() {
+			entries["cn=admins,dc=grafana,dc=org"] = LDAP.NewEntry("cn=admins,dc=grafana,dc=org", map[string][]string{
+				"memberUid": {"roel"},
+			})
+			auth.server.GroupMemberAttribute = "memberUid"
+
+			groups, err := auth.WatchGroups(map[string]string{})
+			So(err, ShouldBeNil)
+			So(groups[0].Members, ShouldResemble, []string{"roel"})
+		})
+	})
+}
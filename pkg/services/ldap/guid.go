@@ -0,0 +1,71 @@
+package ldap
+
+import (
+	"encoding/hex"
+	"strings"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+// relinkedClass is the result class of the audited relinks of the
+// Grafana users of the moved entries
+const relinkedClass = "relinked"
+
+// readGUID reads the guid_attribute of the entry, hex
+// encoded since objectGUID is binary
+func (server *ServerConfig) readGUID(entry *entryAttributes) string {
+	if server.GuidAttribute == "" {
+		return ""
+	}
+	return hex.EncodeToString([]byte(entry.value(server.GuidAttribute)))
+}
+
+// RelinkUser links the Grafana user of the GUID of the LDAP user to its
+// DN when the entry was moved or renamed, so it keeps its Grafana user
+// instead of getting a new one. The relinks are logged and audited
+func (auth *Auth) RelinkUser(user *UserInfo) error {
+	if user.GUID == "" {
+		return nil
+	}
+
+	query := &models.GetLdapUserGuidQuery{Guid: user.GUID}
+	if err := bus.Dispatch(query); err == models.ErrLdapUserGuidNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	userId := query.Result.UserId
+
+	linkedDN, err := ldapAuthId(userId)
+	if err != nil || linkedDN == "" || strings.EqualFold(linkedDN, user.DN) {
+		return err
+	}
+
+	// the new DN may already have a Grafana user of its own
+	current := &models.GetAuthInfoQuery{AuthModule: AuthModule, AuthId: user.DN}
+	if err := bus.Dispatch(current); err == nil && current.Result.UserId != userId {
+		auth.log.Warn("Not relinking the Grafana user of the moved LDAP entry, its DN has another Grafana user",
+			"login", user.Username, "dn", user.DN, "previousDn", linkedDN, "userId", userId, "dnUserId", current.Result.UserId)
+		return nil
+	} else if err != nil && err != models.ErrUserNotFound {
+		return err
+	}
+
+	if err := bus.Dispatch(&models.UpdateAuthInfoCommand{AuthModule: AuthModule, AuthId: user.DN, UserId: userId}); err != nil {
+		return err
+	}
+
+	auth.log.Info("Relinked the Grafana user of the moved LDAP entry", "login", user.Username, "dn", user.DN,
+		"previousDn", linkedDN, "userId", userId)
+	auth.auditRelink(user)
+	return nil
+}
+
+// storeGUID links the Grafana user to the GUID of the entry of the LDAP user
+func (auth *Auth) storeGUID(user *UserInfo, userId int64) error {
+	if user.GUID == "" {
+		return nil
+	}
+	return bus.Dispatch(&models.SetLdapUserGuidCommand{UserId: userId, Guid: user.GUID})
+}
@@ -0,0 +1,82 @@
+package ldap
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	LDAP "gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+func TestRelinkUser(t *testing.T) {
+	Convey("readGUID", t, func() {
+		entry := newEntryAttributes(LDAP.NewEntry("cn=roel,dc=grafana,dc=org", map[string][]string{"objectGUID": {"\x01\xab\xff"}}))
+		So((&ServerConfig{GuidAttribute: "objectGUID"}).readGUID(entry), ShouldEqual, "01abff")
+		So((&ServerConfig{}).readGUID(entry), ShouldBeEmpty)
+	})
+
+	Convey("RelinkUser", t, func() {
+		defer bus.ClearBusHandlers()
+		defer func(audit bool) { setting.LdapLoginAudit = audit }(setting.LdapLoginAudit)
+		setting.LdapLoginAudit = true
+
+		// the DNs the Grafana users are linked to by id
+		dns := map[int64]string{1: "cn=roel,ou=a,dc=grafana,dc=org", 2: "cn=tod,ou=b,dc=grafana,dc=org"}
+		bus.AddHandler("test", func(query *models.GetLdapUserGuidQuery) error {
+			if query.Guid != "01abff" {
+				return models.ErrLdapUserGuidNotFound
+			}
+			query.Result = &models.LdapUserGuid{UserId: 1, Guid: query.Guid}
+			return nil
+		})
+		bus.AddHandler("test", func(query *models.GetAuthInfoQuery) error {
+			for id, dn := range dns {
+				if id == query.UserId || dn == query.AuthId {
+					query.Result = &models.UserAuth{UserId: id, AuthModule: query.AuthModule, AuthId: dn}
+					return nil
+				}
+			}
+			return models.ErrUserNotFound
+		})
+		var relinked *models.UpdateAuthInfoCommand
+		bus.AddHandler("test", func(cmd *models.UpdateAuthInfoCommand) error {
+			relinked = cmd
+			dns[cmd.UserId] = cmd.AuthId
+			return nil
+		})
+		var audited *models.CreateLoginAttemptCommand
+		bus.AddHandler("test", func(cmd *models.CreateLoginAttemptCommand) error {
+			audited = cmd
+			return nil
+		})
+
+		auth := &Auth{log: log.New("test-logger"), server: &ServerConfig{Host: "ldap.example.org", GuidAttribute: "objectGUID"}}
+
+		Convey("Should relink the Grafana user of the moved entry and audit it", func() {
+			So(auth.RelinkUser(&UserInfo{DN: "cn=roel.m,ou=c,dc=grafana,dc=org", Username: "roel.m", GUID: "01abff"}), ShouldBeNil)
+			So(relinked, ShouldNotBeNil)
+			So(relinked.UserId, ShouldEqual, 1)
+			So(relinked.AuthModule, ShouldEqual, AuthModule)
+			So(relinked.AuthId, ShouldEqual, "cn=roel.m,ou=c,dc=grafana,dc=org")
+			So(audited.Username, ShouldEqual, "roel.m")
+			So(audited.ResultClass, ShouldEqual, relinkedClass)
+		})
+
+		Convey("Should leave the entries not moved and the unknown GUIDs", func() {
+			So(auth.RelinkUser(&UserInfo{DN: "CN=roel,OU=a,dc=grafana,dc=org", GUID: "01abff"}), ShouldBeNil)
+			So(auth.RelinkUser(&UserInfo{DN: "cn=torkel,dc=grafana,dc=org", GUID: "02cd"}), ShouldBeNil)
+			So(auth.RelinkUser(&UserInfo{DN: "cn=torkel,dc=grafana,dc=org"}), ShouldBeNil)
+			So(relinked, ShouldBeNil)
+			So(audited, ShouldBeNil)
+		})
+
+		Convey("Should not relink to a DN which has another Grafana user", func() {
+			So(auth.RelinkUser(&UserInfo{DN: "cn=tod,ou=b,dc=grafana,dc=org", GUID: "01abff"}), ShouldBeNil)
+			So(relinked, ShouldBeNil)
+		})
+	})
+}
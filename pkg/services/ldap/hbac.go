@@ -0,0 +1,178 @@
+package ldap
+
+import (
+	"errors"
+	"strings"
+
+	"golang.org/x/xerrors"
+	LDAP "gopkg.in/ldap.v3"
+)
+
+// ErrHBACDenied is returned if none of the FreeIPA HBAC rules
+// allows the user to access hbac_service
+var ErrHBACDenied = errors.New("LDAP HBAC rules don't allow the user to access Grafana")
+
+const presetFreeIPA = "freeipa"
+
+// freeIPAPolicyContainers are the containers of the FreeIPA policy
+// entries the memberOf of the users lists along with their groups
+var freeIPAPolicyContainers = []string{
+	",cn=hbac,",
+	",cn=sudorules,cn=sudo,",
+	",cn=roles,cn=accounts,",
+	",cn=privileges,cn=pbac,",
+	",cn=permissions,cn=pbac,",
+}
+
+// hbacRuleAttributes are the attributes of the ipaHBACRule entries deciding who they allow
+var hbacRuleAttributes = []string{
+	"cn",
+	"userCategory", "memberUser",
+	"hostCategory", "memberHost",
+	"serviceCategory", "memberService",
+}
+
+// withoutFreeIPAPolicies drops the HBAC rules, sudo rules and roles from
+// the memberOf of a FreeIPA user, so only its groups are left
+func withoutFreeIPAPolicies(memberOf []string) []string {
+	groups := make([]string, 0, len(memberOf))
+
+	for _, dn := range memberOf {
+		isPolicy := false
+		for _, container := range freeIPAPolicyContainers {
+			if strings.Contains(strings.ToLower(dn), container) {
+				isPolicy = true
+				break
+			}
+		}
+		if !isPolicy {
+			groups = append(groups, dn)
+		}
+	}
+
+	return groups
+}
+
+// checkHBAC checks that one of the enabled HBAC rules of the FreeIPA
+// domain allows the user to access hbac_service on hbac_host, like
+// SSSD does for the SSH and console logins. The rules are read with the
+// bind of the user, which FreeIPA allows by default
+func (auth *Auth) checkHBAC(user *UserInfo) error {
+	service := auth.server.HBACService
+	if service == "" {
+		return nil
+	}
+
+	suffix, err := domainSuffix(auth.server.SearchBaseDNs)
+	if err != nil {
+		return err
+	}
+
+	result, err := auth.search(searchHBAC, &LDAP.SearchRequest{
+		BaseDN:       "cn=hbac," + suffix,
+		Scope:        LDAP.ScopeSingleLevel,
+		DerefAliases: LDAP.NeverDerefAliases,
+		Filter:       "(&(objectClass=ipaHBACRule)(ipaEnabledFlag=TRUE)(accessRuleType=allow))",
+		Attributes:   hbacRuleAttributes,
+		TimeLimit:    auth.server.SearchTimeout,
+	})
+	if err != nil {
+		return err
+	}
+
+	serviceDN := "cn=" + escapeDN(service) + ",cn=hbacservices,cn=hbac," + suffix
+	serviceGroups, err := auth.entryMemberOf(serviceDN)
+	if err != nil {
+		return err
+	}
+
+	var hostDN string
+	var hostGroups []string
+	if host := auth.server.HBACHost; host != "" {
+		hostDN = "fqdn=" + escapeDN(host) + ",cn=computers,cn=accounts," + suffix
+		if hostGroups, err = auth.entryMemberOf(hostDN); err != nil {
+			return err
+		}
+	}
+
+	userDNs := append([]string{user.DN}, user.MemberOf...)
+	for _, rule := range result.Entries {
+		if matchesHBAC(rule, "userCategory", "memberUser", userDNs) &&
+			matchesHBAC(rule, "serviceCategory", "memberService", append([]string{serviceDN}, serviceGroups...)) &&
+			matchesHBAC(rule, "hostCategory", "memberHost", append([]string{hostDN}, hostGroups...)) {
+			auth.log.Debug("Login allowed by HBAC rule", "username", user.Username, "rule", rule.GetAttributeValue("cn"))
+			return nil
+		}
+	}
+
+	auth.log.Info("Login refused by the HBAC rules", "username", user.Username, "service", service)
+	return ErrHBACDenied
+}
+
+// matchesHBAC checks if the category of the rule is "all" or its
+// members list one of the DNs
+func matchesHBAC(rule *LDAP.Entry, category string, members string, dns []string) bool {
+	if strings.EqualFold(rule.GetAttributeValue(category), "all") {
+		return true
+	}
+
+	for _, member := range rule.GetAttributeValues(members) {
+		for _, dn := range dns {
+			if dn != "" && strings.EqualFold(member, dn) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// entryMemberOf returns the memberOf of the entry, the host and service
+// groups of the HBAC rules, nothing if the entry doesn't exist
+func (auth *Auth) entryMemberOf(dn string) ([]string, error) {
+	result, err := auth.search(searchHBAC, &LDAP.SearchRequest{
+		BaseDN:       dn,
+		Scope:        LDAP.ScopeBaseObject,
+		DerefAliases: LDAP.NeverDerefAliases,
+		Filter:       "(objectClass=*)",
+		Attributes:   []string{"memberOf"},
+		TimeLimit:    auth.server.SearchTimeout,
+	})
+	if ldapErr, ok := err.(*LDAP.Error); ok && ldapErr.ResultCode == LDAP.LDAPResultNoSuchObject {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Entries) == 0 {
+		return nil, nil
+	}
+
+	return result.Entries[0].GetAttributeValues("memberOf"), nil
+}
+
+// domainSuffix is the dc= suffix of the first search base DN, under
+// which FreeIPA keeps its accounts and policies
+func domainSuffix(searchBaseDNs []string) (string, error) {
+	if len(searchBaseDNs) == 0 {
+		return "", xerrors.New("hbac_service needs search_base_dns")
+	}
+
+	dn, err := LDAP.ParseDN(searchBaseDNs[0])
+	if err != nil {
+		return "", xerrors.Errorf("Failed to parse search base DN %q: %w", searchBaseDNs[0], err)
+	}
+
+	components := []string{}
+	for _, rdn := range dn.RDNs {
+		if len(rdn.Attributes) == 1 && strings.EqualFold(rdn.Attributes[0].Type, "dc") {
+			components = append(components, "dc="+escapeDN(rdn.Attributes[0].Value))
+		} else {
+			components = components[:0]
+		}
+	}
+	if len(components) == 0 {
+		return "", xerrors.Errorf("search base DN %q has no dc= suffix for the HBAC rules", searchBaseDNs[0])
+	}
+
+	return strings.Join(components, ","), nil
+}
@@ -0,0 +1,99 @@
+package ldap
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	LDAP "gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+)
+
+func TestHBAC(t *testing.T) {
+	Convey("withoutFreeIPAPolicies", t, func() {
+		memberOf := withoutFreeIPAPolicies([]string{
+			"cn=admins,cn=groups,cn=accounts,dc=example,dc=org",
+			"ipaUniqueID=1234,cn=hbac,dc=example,dc=org",
+			"cn=helpdesk,cn=roles,cn=accounts,dc=example,dc=org",
+		})
+		So(memberOf, ShouldResemble, []string{"cn=admins,cn=groups,cn=accounts,dc=example,dc=org"})
+	})
+
+	Convey("domainSuffix", t, func() {
+		suffix, err := domainSuffix([]string{"cn=users,cn=accounts,dc=example,dc=org"})
+		So(err, ShouldBeNil)
+		So(suffix, ShouldEqual, "dc=example,dc=org")
+
+		_, err = domainSuffix([]string{"o=example"})
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("checkHBAC", t, func() {
+		const suffix = "dc=example,dc=org"
+		rules := []*LDAP.Entry{}
+		hostGroups := []string{}
+		conn := &mockLdapConn{
+			searchProvider: func(request *LDAP.SearchRequest) (*LDAP.SearchResult, error) {
+				switch request.BaseDN {
+				case "cn=hbac," + suffix:
+					return &LDAP.SearchResult{Entries: rules}, nil
+				case "fqdn=grafana.example.org,cn=computers,cn=accounts," + suffix:
+					return &LDAP.SearchResult{Entries: []*LDAP.Entry{
+						LDAP.NewEntry(request.BaseDN, map[string][]string{"memberOf": hostGroups}),
+					}}, nil
+				}
+				return nil, &LDAP.Error{ResultCode: LDAP.LDAPResultNoSuchObject}
+			},
+		}
+		auth := &Auth{
+			server: &ServerConfig{
+				SearchBaseDNs: []string{"cn=users,cn=accounts," + suffix},
+				HBACService:   "grafana",
+				HBACHost:      "grafana.example.org",
+			},
+			conn: conn,
+			log:  log.New("test-logger"),
+		}
+		user := &UserInfo{
+			DN:       "uid=roel,cn=users,cn=accounts," + suffix,
+			Username: "roel",
+			MemberOf: []string{"cn=grafana,cn=groups,cn=accounts," + suffix},
+		}
+
+		Convey("Should allow the users of a rule for the service and host groups", func() {
+			hostGroups = []string{"cn=web,cn=hostgroups,cn=accounts," + suffix}
+			rules = append(rules, LDAP.NewEntry("ipaUniqueID=1,cn=hbac,"+suffix, map[string][]string{
+				"memberUser":    {"cn=grafana,cn=groups,cn=accounts," + suffix},
+				"memberService": {"cn=grafana,cn=hbacservices,cn=hbac," + suffix},
+				"memberHost":    {"cn=web,cn=hostgroups,cn=accounts," + suffix},
+			}))
+
+			So(auth.checkHBAC(user), ShouldBeNil)
+		})
+
+		Convey("Should allow the rules for all", func() {
+			rules = append(rules, LDAP.NewEntry("ipaUniqueID=1,cn=hbac,"+suffix, map[string][]string{
+				"userCategory":    {"all"},
+				"serviceCategory": {"all"},
+				"hostCategory":    {"all"},
+			}))
+
+			So(auth.checkHBAC(user), ShouldBeNil)
+		})
+
+		Convey("Should refuse the users no rule allows", func() {
+			rules = append(rules, LDAP.NewEntry("ipaUniqueID=1,cn=hbac,"+suffix, map[string][]string{
+				"userCategory":  {"all"},
+				"hostCategory":  {"all"},
+				"memberService": {"cn=sshd,cn=hbacservices,cn=hbac," + suffix},
+			}))
+
+			So(auth.checkHBAC(user), ShouldEqual, ErrHBACDenied)
+		})
+
+		Convey("Should not check without hbac_service", func() {
+			auth.server.HBACService = ""
+			So(auth.checkHBAC(user), ShouldBeNil)
+		})
+	})
+}
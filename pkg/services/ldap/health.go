@@ -0,0 +1,69 @@
+package ldap
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	models "github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// errNoActiveServers is returned by the health check if every server is disabled or in maintenance
+var errNoActiveServers = errors.New("No active LDAP servers")
+
+// healthChecker caches the result of the health check, so frequent
+// load balancer probes don't turn into directory traffic
+type healthChecker struct {
+	mutex     sync.Mutex
+	checkedAt time.Time
+	err       error
+	now       func() time.Time
+}
+
+var health = &healthChecker{now: time.Now}
+
+// getHealth answers the GetLDAPHealthQuery dispatched by /api/health
+func getHealth(query *models.GetLDAPHealthQuery) error {
+	return health.check(setting.LdapHealthCheckCacheTTL)
+}
+
+// check returns the cached result if it's younger than ttl,
+// otherwise checks that at least one active server can be bound to
+func (checker *healthChecker) check(ttl time.Duration) error {
+	checker.mutex.Lock()
+	defer checker.mutex.Unlock()
+
+	now := checker.now()
+	if !checker.checkedAt.IsZero() && now.Sub(checker.checkedAt) < ttl {
+		return checker.err
+	}
+
+	checker.err = checkServers()
+	checker.checkedAt = now
+
+	return checker.err
+}
+
+func checkServers() error {
+	config, err := GetConfig()
+	if err != nil {
+		return err
+	}
+	if config == nil {
+		return nil
+	}
+
+	err = errNoActiveServers
+	for _, server := range config.Servers {
+		if !IsActive(server) {
+			continue
+		}
+
+		if err = checkServer(server); err == nil {
+			return nil
+		}
+	}
+
+	return err
+}
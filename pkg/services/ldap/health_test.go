@@ -0,0 +1,63 @@
+package ldap
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+func TestHealthChecker(t *testing.T) {
+	Convey("healthChecker", t, func() {
+		setting.LdapEnabled = true
+		config = &Config{
+			Servers: []*ServerConfig{{Host: "first"}, {Host: "second"}},
+		}
+		down := map[string]bool{}
+		checked := 0
+		originalCheckServer := checkServer
+		checkServer = func(server *ServerConfig) error {
+			checked++
+			if down[server.Host] {
+				return errors.New("connection refused")
+			}
+			return nil
+		}
+		defer func() {
+			setting.LdapEnabled = false
+			config = nil
+			checkServer = originalCheckServer
+		}()
+
+		now := time.Now()
+		checker := &healthChecker{now: func() time.Time { return now }}
+
+		Convey("Should be healthy if one server can be bound to", func() {
+			down["first"] = true
+
+			So(checker.check(time.Minute), ShouldBeNil)
+			So(checked, ShouldEqual, 2)
+		})
+
+		Convey("Should fail if no server can be bound to", func() {
+			down["first"] = true
+			down["second"] = true
+
+			So(checker.check(time.Minute), ShouldNotBeNil)
+		})
+
+		Convey("Should cache the result", func() {
+			So(checker.check(time.Minute), ShouldBeNil)
+			down["first"] = true
+			down["second"] = true
+			So(checker.check(time.Minute), ShouldBeNil)
+			So(checked, ShouldEqual, 1)
+
+			now = now.Add(2 * time.Minute)
+			So(checker.check(time.Minute), ShouldNotBeNil)
+		})
+	})
+}
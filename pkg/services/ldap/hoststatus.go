@@ -0,0 +1,253 @@
+package ldap
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	LDAP "gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/infra/metrics"
+)
+
+// errorWindow is the number of minutes the error counts are kept for
+const errorWindow = 60
+
+// HostStatus tells how a host of a server has been behaving
+type HostStatus struct {
+	Address            string
+	LastSuccessfulBind time.Time
+	LastError          string
+	LastErrorAt        time.Time
+	ErrorsLast5m       int
+	ErrorsLastHour     int
+}
+
+// hostStats counts the errors of a host per minute, over the last errorWindow minutes
+type hostStats struct {
+	lastSuccessfulBind time.Time
+	lastError          string
+	lastErrorAt        time.Time
+	minutes            [errorWindow]int64
+	counts             [errorWindow]int
+
+	// lost is set when a connection to the host failed, the next
+	// connection dialed to the host is a reconnect
+	lost bool
+}
+
+// hosts holds the stats of the hosts by address, they're kept across
+// config reloads but not across restarts
+var hosts = map[string]*hostStats{}
+var hostsMutex = &sync.Mutex{}
+
+// now is a variable so tests can replace it
+var now = time.Now
+
+func getHostStats(address string) *hostStats {
+	stats, ok := hosts[address]
+	if !ok {
+		stats = &hostStats{}
+		hosts[address] = stats
+	}
+	return stats
+}
+
+func recordHostBind(address string) {
+	hostsMutex.Lock()
+	defer hostsMutex.Unlock()
+
+	getHostStats(address).lastSuccessfulBind = now()
+}
+
+func recordHostError(address string, err error, secrets ...string) {
+	hostsMutex.Lock()
+	defer hostsMutex.Unlock()
+
+	stats := getHostStats(address)
+	stats.lastError = scrub(err.Error(), secrets)
+	stats.lastErrorAt = now()
+
+	minute := stats.lastErrorAt.Unix() / 60
+	i := minute % errorWindow
+	if stats.minutes[i] != minute {
+		stats.minutes[i] = minute
+		stats.counts[i] = 0
+	}
+	stats.counts[i]++
+}
+
+// errorsSince sums the errors of the last minutes, including the current one
+func (stats *hostStats) errorsSince(current int64, minutes int64) int {
+	total := 0
+	for i, minute := range stats.minutes {
+		if current-minute < minutes {
+			total += stats.counts[i]
+		}
+	}
+	return total
+}
+
+// HostStatuses returns the status of every host of the server
+func HostStatuses(server *ServerConfig) []*HostStatus {
+	hostsMutex.Lock()
+	defer hostsMutex.Unlock()
+
+	current := now().Unix() / 60
+	result := []*HostStatus{}
+	for _, host := range strings.Split(server.Host, " ") {
+		address := fmt.Sprintf("%s:%d", host, server.Port)
+		status := &HostStatus{Address: address}
+
+		if stats, ok := hosts[address]; ok {
+			status.LastSuccessfulBind = stats.lastSuccessfulBind
+			status.LastError = stats.lastError
+			status.LastErrorAt = stats.lastErrorAt
+			status.ErrorsLast5m = stats.errorsSince(current, 5)
+			status.ErrorsLastHour = stats.errorsSince(current, errorWindow)
+		}
+
+		result = append(result, status)
+	}
+
+	return result
+}
+
+// recordHostConnection counts a connection dialed to the host, as a
+// reconnect if the previous one failed
+func recordHostConnection(address string) {
+	hostsMutex.Lock()
+	stats := getHostStats(address)
+	reconnect := stats.lost
+	stats.lost = false
+	hostsMutex.Unlock()
+
+	if reconnect {
+		metrics.M_Ldap_Reconnects.WithLabelValues(address).Inc()
+	}
+	metrics.M_Ldap_Connections_Open.WithLabelValues(address).Inc()
+	metrics.M_Ldap_Connections_In_Use.WithLabelValues(address).Inc()
+}
+
+// recordHostConnectionLost marks the host as having lost a connection
+func recordHostConnectionLost(address string) {
+	hostsMutex.Lock()
+	defer hostsMutex.Unlock()
+
+	getHostStats(address).lost = true
+}
+
+// recordHostConnectionPooled moves a connection of the host from the ones
+// in use to the pooled ones, or back. The connections not dialed by Dial
+// have no host and aren't counted
+func recordHostConnectionPooled(address string, pooled bool) {
+	if address == "" {
+		return
+	}
+
+	delta := 1.0
+	if !pooled {
+		delta = -1
+	}
+	metrics.M_Ldap_Connections_Pooled.WithLabelValues(address).Add(delta)
+	metrics.M_Ldap_Connections_In_Use.WithLabelValues(address).Sub(delta)
+}
+
+// isConnectionError checks if the error failed the connection rather than
+// being answered by the server: the network errors, timeouts and
+// unavailable servers
+func isConnectionError(err error) bool {
+	ldapErr, ok := err.(*LDAP.Error)
+	return !ok || ldapErr.ResultCode >= LDAP.ErrorNetwork || classifyError(err) == ErrServerUnavailable
+}
+
+// trackedConnection is a connection which records the successful binds
+// and the errors of its host, and their metrics
+type trackedConnection struct {
+	IConnection
+	address string
+
+	mutex  sync.Mutex
+	closed bool
+}
+
+func trackConnection(conn IConnection, address string) IConnection {
+	recordHostConnection(address)
+	return &trackedConnection{IConnection: conn, address: address}
+}
+
+func (conn *trackedConnection) Bind(username, password string) error {
+	start := time.Now()
+	err := conn.IConnection.Bind(username, password)
+	conn.record(start, err, password)
+	return err
+}
+
+func (conn *trackedConnection) SimpleBind(request *LDAP.SimpleBindRequest) (*LDAP.SimpleBindResult, error) {
+	start := time.Now()
+	result, err := conn.IConnection.SimpleBind(request)
+	conn.record(start, err, request.Password)
+	return result, err
+}
+
+func (conn *trackedConnection) UnauthenticatedBind(username string) error {
+	start := time.Now()
+	err := conn.IConnection.UnauthenticatedBind(username)
+	conn.record(start, err)
+	return err
+}
+
+func (conn *trackedConnection) Search(request *LDAP.SearchRequest) (*LDAP.SearchResult, error) {
+	result, err := conn.IConnection.Search(request)
+	if err != nil {
+		recordHostError(conn.address, err)
+		metrics.M_Ldap_Failures.WithLabelValues(conn.address, "search").Inc()
+		if isConnectionError(err) {
+			recordHostConnectionLost(conn.address)
+		}
+	}
+	return result, err
+}
+
+func (conn *trackedConnection) SearchStream(request *LDAP.SearchRequest, pagingSize uint32, handle EntryHandler) error {
+	return streamSearch(conn, request, pagingSize, handle)
+}
+
+// record records the bind result, wrong passwords
+// are the users' fault so they don't count as errors
+func (conn *trackedConnection) record(start time.Time, err error, secrets ...string) {
+	elapsed := time.Since(start)
+	metrics.M_Ldap_Bind_Duration.WithLabelValues(conn.address).Observe(float64(elapsed.Nanoseconds() / int64(time.Millisecond)))
+
+	if err == nil {
+		recordHostBind(conn.address)
+		return
+	}
+
+	if ldapErr, ok := err.(*LDAP.Error); ok && ldapErr.ResultCode == LDAP.LDAPResultInvalidCredentials {
+		return
+	}
+
+	recordHostError(conn.address, err, secrets...)
+	metrics.M_Ldap_Failures.WithLabelValues(conn.address, "bind").Inc()
+	if isConnectionError(err) {
+		recordHostConnectionLost(conn.address)
+	}
+}
+
+// Close closes the connection, once however many of the wrapping
+// connections close it
+func (conn *trackedConnection) Close() {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+
+	if conn.closed {
+		return
+	}
+	conn.closed = true
+	conn.IConnection.Close()
+
+	metrics.M_Ldap_Connections_Open.WithLabelValues(conn.address).Dec()
+	metrics.M_Ldap_Connections_In_Use.WithLabelValues(conn.address).Dec()
+}
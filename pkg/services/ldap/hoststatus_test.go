@@ -0,0 +1,130 @@
+package ldap
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	. "github.com/smartystreets/goconvey/convey"
+	LDAP "gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/infra/metrics"
+)
+
+func gaugeValue(gauge *prometheus.GaugeVec, host string) float64 {
+	metric := &dto.Metric{}
+	if err := gauge.WithLabelValues(host).Write(metric); err != nil {
+		panic(err)
+	}
+	return metric.Gauge.GetValue()
+}
+
+func reconnectCount(host string) float64 {
+	metric := &dto.Metric{}
+	if err := metrics.M_Ldap_Reconnects.WithLabelValues(host).Write(metric); err != nil {
+		panic(err)
+	}
+	return metric.Counter.GetValue()
+}
+
+func TestHostStatuses(t *testing.T) {
+	Convey("HostStatuses", t, func() {
+		current := time.Date(2019, 6, 3, 10, 0, 0, 0, time.UTC)
+		now = func() time.Time { return current }
+		defer func() {
+			now = time.Now
+			hosts = map[string]*hostStats{}
+		}()
+
+		server := &ServerConfig{Host: "first second", Port: 389}
+
+		Convey("Should record the binds and errors of every host", func() {
+			bindErr := errors.New("bind failed")
+			mock := &mockLdapConn{}
+			mock.bindProvider = func(username, password string) error {
+				return bindErr
+			}
+			conn := trackConnection(mock, "second:389")
+
+			recordHostBind("first:389")
+			current = current.Add(time.Minute)
+			So(conn.Bind("cn=admin", "secret"), ShouldEqual, bindErr)
+
+			statuses := HostStatuses(server)
+			So(statuses, ShouldHaveLength, 2)
+			So(statuses[0].Address, ShouldEqual, "first:389")
+			So(statuses[0].LastSuccessfulBind, ShouldEqual, current.Add(-time.Minute))
+			So(statuses[0].ErrorsLastHour, ShouldEqual, 0)
+			So(statuses[1].LastError, ShouldEqual, "bind failed")
+			So(statuses[1].LastErrorAt, ShouldEqual, current)
+			So(statuses[1].ErrorsLast5m, ShouldEqual, 1)
+		})
+
+		Convey("Should not count wrong passwords", func() {
+			mock := &mockLdapConn{}
+			mock.bindProvider = func(username, password string) error {
+				return &LDAP.Error{ResultCode: LDAP.LDAPResultInvalidCredentials}
+			}
+			conn := trackConnection(mock, "first:389")
+
+			So(conn.Bind("cn=user", "wrong"), ShouldNotBeNil)
+			So(HostStatuses(server)[0].ErrorsLastHour, ShouldEqual, 0)
+		})
+
+		Convey("Should roll the error counts", func() {
+			for i := 0; i < 3; i++ {
+				recordHostError("first:389", errors.New("connection refused"))
+				current = current.Add(10 * time.Minute)
+			}
+
+			status := HostStatuses(server)[0]
+			So(status.ErrorsLast5m, ShouldEqual, 0)
+			So(status.ErrorsLastHour, ShouldEqual, 3)
+
+			current = current.Add(40 * time.Minute)
+			status = HostStatuses(server)[0]
+			So(status.ErrorsLastHour, ShouldEqual, 1)
+		})
+	})
+}
+
+func TestHostConnectionMetrics(t *testing.T) {
+	Convey("Connection metrics of the hosts", t, func() {
+		defer func() { hosts = map[string]*hostStats{} }()
+
+		address := "metrics.example.org:389"
+		open := gaugeValue(metrics.M_Ldap_Connections_Open, address)
+		inUse := gaugeValue(metrics.M_Ldap_Connections_In_Use, address)
+		pooled := gaugeValue(metrics.M_Ldap_Connections_Pooled, address)
+		reconnects := reconnectCount(address)
+
+		mock := &mockLdapConn{}
+		mock.searchProvider = func(request *LDAP.SearchRequest) (*LDAP.SearchResult, error) {
+			return nil, LDAP.NewError(LDAP.ErrorNetwork, errors.New("connection reset"))
+		}
+		conn := trackConnection(mock, address)
+		So(gaugeValue(metrics.M_Ldap_Connections_Open, address), ShouldEqual, open+1)
+		So(gaugeValue(metrics.M_Ldap_Connections_In_Use, address), ShouldEqual, inUse+1)
+
+		recordHostConnectionPooled(address, true)
+		So(gaugeValue(metrics.M_Ldap_Connections_Pooled, address), ShouldEqual, pooled+1)
+		So(gaugeValue(metrics.M_Ldap_Connections_In_Use, address), ShouldEqual, inUse)
+		recordHostConnectionPooled(address, false)
+
+		_, err := conn.Search(&LDAP.SearchRequest{})
+		So(err, ShouldNotBeNil)
+		conn.Close()
+		conn.Close()
+		So(gaugeValue(metrics.M_Ldap_Connections_Open, address), ShouldEqual, open)
+		So(gaugeValue(metrics.M_Ldap_Connections_In_Use, address), ShouldEqual, inUse)
+		So(gaugeValue(metrics.M_Ldap_Connections_Pooled, address), ShouldEqual, pooled)
+
+		trackConnection(mock, address).Close()
+		So(reconnectCount(address), ShouldEqual, reconnects+1)
+
+		trackConnection(mock, address).Close()
+		So(reconnectCount(address), ShouldEqual, reconnects+1)
+	})
+}
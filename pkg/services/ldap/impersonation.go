@@ -0,0 +1,21 @@
+package ldap
+
+import (
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// IsImpersonationEnabled checks if the members of an LDAP group may impersonate the other users
+func IsImpersonationEnabled() bool {
+	return IsEnabled() && setting.LdapImpersonationGroup != ""
+}
+
+// IsImpersonator checks if the user is a member of impersonation_group,
+// the wildcard isn't followed there since it would let anyone in
+func IsImpersonator(user *UserInfo) bool {
+	group := setting.LdapImpersonationGroup
+	if group == "" || group == "*" {
+		return false
+	}
+
+	return user.isMemberOf(group)
+}
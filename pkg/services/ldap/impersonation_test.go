@@ -0,0 +1,32 @@
+package ldap
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+func TestIsImpersonator(t *testing.T) {
+	Convey("IsImpersonator", t, func() {
+		defer func() { setting.LdapImpersonationGroup = "" }()
+		user := &UserInfo{MemberOf: []string{"cn=support,dc=grafana,dc=org"}}
+
+		Convey("Should check the membership of the impersonation group", func() {
+			setting.LdapImpersonationGroup = "CN=support,dc=grafana,dc=org"
+			So(IsImpersonator(user), ShouldBeTrue)
+
+			setting.LdapImpersonationGroup = "cn=admins,dc=grafana,dc=org"
+			So(IsImpersonator(user), ShouldBeFalse)
+		})
+
+		Convey("Should not let anyone in with the wildcard or without a group", func() {
+			setting.LdapImpersonationGroup = "*"
+			So(IsImpersonator(user), ShouldBeFalse)
+
+			setting.LdapImpersonationGroup = ""
+			So(IsImpersonator(user), ShouldBeFalse)
+		})
+	})
+}
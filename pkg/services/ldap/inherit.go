@@ -0,0 +1,65 @@
+package ldap
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// inheritDefaults sets the options the servers leave unset to the ones
+// of the [defaults] block, meta tells which options the TOML document sets
+// so a server can still turn off an option the defaults turn on
+func inheritDefaults(config *Config, meta toml.MetaData) {
+	if config.Defaults == nil {
+		return
+	}
+
+	defaults, servers := definedKeys(meta)
+	for i, server := range config.Servers {
+		if i >= len(servers) {
+			break
+		}
+		inherit(reflect.ValueOf(server).Elem(), reflect.ValueOf(config.Defaults).Elem(), defaults, servers[i], "")
+	}
+}
+
+// definedKeys returns the keys set in the [defaults] block and in every
+// [[servers]] block, without their prefix, like "attributes.email"
+func definedKeys(meta toml.MetaData) (map[string]bool, []map[string]bool) {
+	defaults := map[string]bool{}
+	servers := []map[string]bool{}
+
+	for _, key := range meta.Keys() {
+		switch {
+		case len(key) == 1 && key[0] == "servers":
+			// the header of the next [[servers]] block
+			servers = append(servers, map[string]bool{})
+		case len(key) > 1 && key[0] == "servers" && len(servers) > 0:
+			servers[len(servers)-1][strings.Join(key[1:], ".")] = true
+		case len(key) > 1 && key[0] == "defaults":
+			defaults[strings.Join(key[1:], ".")] = true
+		}
+	}
+
+	return defaults, servers
+}
+
+// inherit copies the fields of defaults which are defined there
+// but not in server, the tables like [servers.attributes] are
+// inherited key by key and the arrays as a whole
+func inherit(server reflect.Value, defaults reflect.Value, fromDefaults, fromServer map[string]bool, prefix string) {
+	for i := 0; i < server.NumField(); i++ {
+		field := server.Type().Field(i)
+		name := prefix + strings.Split(field.Tag.Get("toml"), ",")[0]
+
+		if field.Type.Kind() == reflect.Struct {
+			inherit(server.Field(i), defaults.Field(i), fromDefaults, fromServer, name+".")
+			continue
+		}
+
+		if fromDefaults[name] && !fromServer[name] {
+			server.Field(i).Set(defaults.Field(i))
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package ldap
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const replicasConfig = `
+[defaults]
+port = 636
+use_ssl = true
+root_ca_cert = "/etc/grafana/ca.pem"
+bind_dn = "cn=admin,dc=grafana,dc=org"
+search_filter = "(cn=%s)"
+search_base_dns = ["dc=grafana,dc=org"]
+
+[defaults.attributes]
+username = "cn"
+email = "mail"
+
+[[defaults.group_mappings]]
+group_dn = "cn=admins,dc=grafana,dc=org"
+org_role = "Admin"
+
+[[servers]]
+host = "ldap1"
+
+[[servers]]
+host = "ldap2"
+use_ssl = false
+port = 389
+
+[servers.attributes]
+email = "email"
+
+[[servers.group_mappings]]
+group_dn = "*"
+org_role = "Viewer"
+`
+
+func TestInheritDefaults(t *testing.T) {
+	Convey("inheritDefaults", t, func() {
+		config, err := ParseConfig(replicasConfig)
+		So(err, ShouldBeNil)
+		So(config.Servers, ShouldHaveLength, 2)
+
+		Convey("Should set the options left unset to the defaults", func() {
+			server := config.Servers[0]
+			So(server.Host, ShouldEqual, "ldap1")
+			So(server.Port, ShouldEqual, 636)
+			So(server.UseSSL, ShouldBeTrue)
+			So(server.RootCACert, ShouldEqual, "/etc/grafana/ca.pem")
+			So(server.SearchBaseDNs, ShouldResemble, []string{"dc=grafana,dc=org"})
+			So(server.Attr.Email, ShouldEqual, "mail")
+			So(server.Groups, ShouldHaveLength, 1)
+			So(server.Groups[0].OrgRole, ShouldEqual, "Admin")
+		})
+
+		Convey("Should keep the options the servers set, even to false", func() {
+			server := config.Servers[1]
+			So(server.Port, ShouldEqual, 389)
+			So(server.UseSSL, ShouldBeFalse)
+			So(server.RootCACert, ShouldEqual, "/etc/grafana/ca.pem")
+		})
+
+		Convey("Should inherit the attributes one by one and the group mappings as a whole", func() {
+			server := config.Servers[1]
+			So(server.Attr.Username, ShouldEqual, "cn")
+			So(server.Attr.Email, ShouldEqual, "email")
+			So(server.Groups, ShouldHaveLength, 1)
+			So(server.Groups[0].GroupDN, ShouldEqual, "*")
+		})
+
+		Convey("Should encode the servers without the defaults", func() {
+			text, err := encodeConfig(config)
+			So(err, ShouldBeNil)
+			So(text, ShouldNotContainSubstring, "[defaults]")
+
+			decoded, err := ParseConfig(text)
+			So(err, ShouldBeNil)
+			So(decoded.Servers[0].RootCACert, ShouldEqual, "/etc/grafana/ca.pem")
+			So(decoded.Servers[1].UseSSL, ShouldBeFalse)
+		})
+	})
+
+	Convey("checkConfig with defaults", t, func() {
+		problems := checkConfig(`
+[defaults]
+search_filter = "(cn=%s"
+enable_ssl = true
+
+[[servers]]
+host = "ldap1"
+search_base_dns = ["dc=grafana,dc=org"]
+`)
+
+		Convey("Should tie the inherited options to the defaults", func() {
+			So(problems, ShouldHaveLength, 2)
+			So(problems[0].String(), ShouldEqual, `line 3: servers[0].search_filter: unbalanced parentheses, 1 "(" not closed`)
+			So(problems[1].String(), ShouldEqual, "line 4: defaults.enable_ssl: deprecated option, it's ignored, use use_ssl instead")
+		})
+	})
+}
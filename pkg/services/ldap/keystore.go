@@ -0,0 +1,115 @@
+package ldap
+
+import (
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"regexp"
+	"sync"
+
+	"golang.org/x/xerrors"
+)
+
+// KeyProvider loads the private key of the client certificate
+// from a key store, like an HSM, instead of a PEM file
+type KeyProvider func(uri string, cert *x509.Certificate) (crypto.Signer, error)
+
+var keyProvidersMutex sync.RWMutex
+var keyProviders = map[string]KeyProvider{}
+
+// RegisterKeyProvider makes the client_key URIs with the given
+// scheme, e.g. "keystore:ldap", use the provider. No provider is
+// registered by default, the client keys are PEM files and the
+// configs with a client_key URI of another scheme are refused
+func RegisterKeyProvider(scheme string, provider KeyProvider) {
+	keyProvidersMutex.Lock()
+	defer keyProvidersMutex.Unlock()
+
+	keyProviders[scheme] = provider
+}
+
+// keySchemePattern matches the URI schemes of client_key, like "pkcs11:",
+// the single letters being left to the Windows drive letters
+var keySchemePattern = regexp.MustCompile(`^([a-zA-Z][a-zA-Z0-9+.-]+):`)
+
+// keyScheme returns the URI scheme of client_key, or an empty string if
+// it's the path to a PEM file
+func keyScheme(key string) string {
+	match := keySchemePattern.FindStringSubmatch(key)
+	if match == nil {
+		return ""
+	}
+	return match[1]
+}
+
+// keyProvider returns the provider registered for the scheme
+func keyProvider(scheme string) (KeyProvider, bool) {
+	keyProvidersMutex.RLock()
+	defer keyProvidersMutex.RUnlock()
+
+	provider, ok := keyProviders[scheme]
+	return provider, ok
+}
+
+// validateClientKey checks a client_key URI has a provider, an unknown
+// scheme isn't read as the path to a PEM file
+func validateClientKey(server *ServerConfig) error {
+	scheme := keyScheme(server.ClientKey)
+	if scheme == "" {
+		return nil
+	}
+
+	if _, ok := keyProvider(scheme); !ok {
+		return xerrors.Errorf("no key provider is registered for the client_key scheme %q", scheme)
+	}
+	return nil
+}
+
+// loadClientCertificate loads the client certificate and its key,
+// which is either a PEM file or a URI handled by a KeyProvider
+func loadClientCertificate(certFile, key string) (tls.Certificate, error) {
+	scheme := keyScheme(key)
+	if scheme == "" {
+		return tls.LoadX509KeyPair(certFile, key)
+	}
+
+	provider, ok := keyProvider(scheme)
+	if !ok {
+		return tls.Certificate{}, xerrors.Errorf("No key provider is registered for the client_key scheme %q", scheme)
+	}
+
+	certPEM, err := ioutil.ReadFile(certFile)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	var cert tls.Certificate
+	for {
+		var block *pem.Block
+		block, certPEM = pem.Decode(certPEM)
+		if block == nil {
+			break
+		}
+		if block.Type == "CERTIFICATE" {
+			cert.Certificate = append(cert.Certificate, block.Bytes)
+		}
+	}
+	if len(cert.Certificate) == 0 {
+		return tls.Certificate{}, xerrors.Errorf("No certificate found in %v", certFile)
+	}
+
+	cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	signer, err := provider(key, cert.Leaf)
+	if err != nil {
+		return tls.Certificate{}, xerrors.Errorf("Failed to load the client key from %v: %v", scheme, err)
+	}
+	cert.PrivateKey = signer
+
+	return cert, nil
+}
@@ -0,0 +1,106 @@
+package ldap
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLoadClientCertificate(t *testing.T) {
+	Convey("loadClientCertificate", t, func() {
+		ca, caKey := newTestCertificate(nil, nil, 1)
+		leaf, leafKey := newTestCertificate(ca, caKey, 2)
+
+		certFile, err := ioutil.TempFile("", "ldap-client-cert")
+		So(err, ShouldBeNil)
+		defer os.Remove(certFile.Name())
+		So(pem.Encode(certFile, &pem.Block{Type: "CERTIFICATE", Bytes: leaf.Raw}), ShouldBeNil)
+		certFile.Close()
+
+		Convey("Should refuse the keys of the schemes without a provider", func() {
+			_, err := loadClientCertificate(certFile.Name(), "pkcs11:token=ldap;object=client")
+
+			So(err, ShouldNotBeNil)
+			So(os.IsNotExist(err), ShouldBeFalse)
+			So(err.Error(), ShouldContainSubstring, `"pkcs11"`)
+		})
+
+		Convey("Should read the Windows paths as files", func() {
+			_, err := loadClientCertificate(certFile.Name(), `C:\grafana\client.key`)
+
+			So(err, ShouldNotBeNil)
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+
+		Convey("Should load the key from the registered provider", func() {
+			var actualURI string
+			RegisterKeyProvider("keystore", func(uri string, cert *x509.Certificate) (crypto.Signer, error) {
+				actualURI = uri
+				return leafKey, nil
+			})
+			defer func() {
+				keyProvidersMutex.Lock()
+				delete(keyProviders, "keystore")
+				keyProvidersMutex.Unlock()
+			}()
+
+			cert, err := loadClientCertificate(certFile.Name(), "keystore:ldap")
+
+			So(err, ShouldBeNil)
+			So(actualURI, ShouldEqual, "keystore:ldap")
+			So(cert.PrivateKey, ShouldEqual, leafKey)
+			So(cert.Leaf.SerialNumber.Int64(), ShouldEqual, 2)
+		})
+
+		Convey("Should report the provider failures", func() {
+			RegisterKeyProvider("keystore", func(uri string, cert *x509.Certificate) (crypto.Signer, error) {
+				return nil, errors.New("token is locked")
+			})
+			defer func() {
+				keyProvidersMutex.Lock()
+				delete(keyProviders, "keystore")
+				keyProvidersMutex.Unlock()
+			}()
+
+			_, err := loadClientCertificate(certFile.Name(), "keystore:ldap")
+
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "token is locked")
+		})
+	})
+}
+
+func TestValidateClientKey(t *testing.T) {
+	Convey("validateClientKey", t, func() {
+		Convey("Should accept the PEM files", func() {
+			So(validateClientKey(&ServerConfig{ClientKey: "/etc/grafana/client.key"}), ShouldBeNil)
+			So(validateClientKey(&ServerConfig{ClientKey: `C:\grafana\client.key`}), ShouldBeNil)
+		})
+
+		Convey("Should refuse the schemes without a provider", func() {
+			err := validateClientKey(&ServerConfig{ClientKey: "pkcs11:token=ldap;object=client"})
+
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, `"pkcs11"`)
+		})
+
+		Convey("Should accept the schemes with a provider", func() {
+			RegisterKeyProvider("pkcs11", func(uri string, cert *x509.Certificate) (crypto.Signer, error) {
+				return nil, nil
+			})
+			defer func() {
+				keyProvidersMutex.Lock()
+				delete(keyProviders, "pkcs11")
+				keyProvidersMutex.Unlock()
+			}()
+
+			So(validateClientKey(&ServerConfig{ClientKey: "pkcs11:token=ldap;object=client"}), ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,19 @@
+package ldap
+
+import (
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+// groupsNeeded checks if the logins use the groups of the users: for the
+// group mappings, the sign_up_groups, the HBAC rules, the impersonation
+// and API key groups, or the team sync. Without any, the logins neither
+// read memberOf nor search for the groups, saving a round trip
+func (server *ServerConfig) groupsNeeded() bool {
+	return len(server.Groups) > 0 ||
+		len(server.SignUpGroups) > 0 ||
+		server.HBACService != "" ||
+		IsImpersonationEnabled() ||
+		IsApiKeyGatingEnabled() ||
+		bus.HasHandler(&models.SyncTeamsCommand{})
+}
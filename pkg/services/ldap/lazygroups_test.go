@@ -0,0 +1,70 @@
+package ldap
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	LDAP "gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+func TestLazyGroups(t *testing.T) {
+	Convey("groupsNeeded", t, func() {
+		defer bus.ClearBusHandlers()
+
+		So((&ServerConfig{}).groupsNeeded(), ShouldBeFalse)
+		So((&ServerConfig{Groups: []*GroupToOrgRole{{GroupDN: "*"}}}).groupsNeeded(), ShouldBeTrue)
+		So((&ServerConfig{SignUpGroups: []string{"cn=users"}}).groupsNeeded(), ShouldBeTrue)
+		So((&ServerConfig{HBACService: "grafana"}).groupsNeeded(), ShouldBeTrue)
+
+		bus.AddHandlerCtx("test", func(ctx context.Context, cmd *models.SyncTeamsCommand) error {
+			return nil
+		})
+		So((&ServerConfig{}).groupsNeeded(), ShouldBeTrue)
+	})
+
+	Convey("Searching for a user without its groups", t, func() {
+		conn := &mockLdapConn{}
+		var searches []*LDAP.SearchRequest
+		conn.searchProvider = func(request *LDAP.SearchRequest) (*LDAP.SearchResult, error) {
+			searches = append(searches, request)
+			if request.Filter != "(uid=roel)" {
+				return &LDAP.SearchResult{Entries: []*LDAP.Entry{LDAP.NewEntry("cn=admins,ou=groups,dc=grafana,dc=org", nil)}}, nil
+			}
+			return &LDAP.SearchResult{Entries: []*LDAP.Entry{
+				LDAP.NewEntry("uid=roel,ou=users,dc=grafana,dc=org", map[string][]string{
+					"uid":      {"roel"},
+					"memberOf": {"cn=admins,ou=groups,dc=grafana,dc=org"},
+				}),
+			}}, nil
+		}
+
+		auth := &Auth{conn: conn, log: log.New("test-logger"), server: &ServerConfig{
+			Attr:               AttributeMap{Username: "uid", MemberOf: "memberOf"},
+			SearchFilter:       "(uid=%s)",
+			SearchBaseDNs:      []string{"ou=users,dc=grafana,dc=org"},
+			GroupSearchFilter:  "(&(objectClass=posixGroup)(memberUid=%s))",
+			GroupSearchBaseDNs: []string{"ou=groups,dc=grafana,dc=org"},
+		}}
+
+		Convey("Should neither read memberOf nor search for the groups", func() {
+			user, err := auth.searchForUser("roel", userSearch{profile: true})
+			So(err, ShouldBeNil)
+			So(user.Username, ShouldEqual, "roel")
+			So(user.MemberOf, ShouldBeEmpty)
+			So(searches, ShouldHaveLength, 1)
+			So(searches[0].Attributes, ShouldNotContain, "memberOf")
+		})
+
+		Convey("Should still search for the groups when asked", func() {
+			user, err := auth.searchForUser("roel", searchEverything)
+			So(err, ShouldBeNil)
+			So(user.MemberOf, ShouldResemble, []string{"cn=admins,ou=groups,dc=grafana,dc=org"})
+			So(searches, ShouldHaveLength, 2)
+		})
+	})
+}
@@ -6,13 +6,21 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/davecgh/go-spew/spew"
+	"golang.org/x/net/proxy"
+	"golang.org/x/sync/singleflight"
+	"golang.org/x/xerrors"
+	ber "gopkg.in/asn1-ber.v1"
 	LDAP "gopkg.in/ldap.v3"
 
 	"github.com/grafana/grafana/pkg/bus"
 	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/infra/metrics"
 	models "github.com/grafana/grafana/pkg/models"
 	"github.com/grafana/grafana/pkg/setting"
 )
@@ -21,45 +29,195 @@ import (
 type IConnection interface {
 	Bind(username, password string) error
 	UnauthenticatedBind(username string) error
+	SimpleBind(*LDAP.SimpleBindRequest) (*LDAP.SimpleBindResult, error)
 	Search(*LDAP.SearchRequest) (*LDAP.SearchResult, error)
+	SearchStream(request *LDAP.SearchRequest, pagingSize uint32, handle EntryHandler) error
 	StartTLS(*tls.Config) error
 	Close()
 }
 
 // IAuth is interface for LDAP authorization
 type IAuth interface {
-	Login(query *models.LoginUserQuery) error
+	Authenticate(query *models.LoginUserQuery) (*UserInfo, error)
+	VerifyPassword(username, password string) error
+	VerifySecondFactor(query *models.LoginUserQuery, user *UserInfo, grafanaUser *models.User) error
 	SyncUser(query *models.LoginUserQuery) error
+	User(username string) (*UserInfo, error)
 	GetGrafanaUserFor(
 		ctx *models.ReqContext,
 		user *UserInfo,
 	) (*models.User, error)
+	MapGrafanaUser(user *UserInfo) (*models.ExternalUserInfo, error)
+	ApplyGroupQuotas(user *UserInfo) error
+	StoreAttributes(user *UserInfo, userId int64) error
+	RelinkUser(user *UserInfo) error
 	Users() ([]*UserInfo, error)
+	UsersPaged(pageSize int, pacer Pacer) ([]*UserInfo, error)
+	Close()
+}
+
+// Pacer paces a paged search, told the latency of each page before the
+// next one is requested. The search is aborted with its error
+type Pacer interface {
+	Pace(latency time.Duration) error
 }
 
 // Auth is basic struct of LDAP authorization
 type Auth struct {
-	server            *ServerConfig
-	conn              IConnection
-	requireSecondBind bool
-	log               log.Logger
+	server *ServerConfig
+	conn   IConnection
+	log    log.Logger
+
+	// mutex guards conn and closed, since Close can be called
+	// from another goroutine while an operation is in flight
+	mutex  sync.Mutex
+	closed bool
+
+	// address is the address of the host of the connection
+	address string
+
+	// passwordPolicy holds the warnings of the password policy
+	// control of the last user bind, see userBind
+	passwordPolicy *models.PasswordPolicyWarning
+
+	// channelBinding is the tls-server-end-point channel binding
+	// of the connection with channel_binding, see bindChannel
+	channelBinding []byte
 }
 
 var (
 
 	// ErrInvalidCredentials is returned if username and password do not match
 	ErrInvalidCredentials = errors.New("Invalid Username or Password")
+
+	// ErrCouldNotFindUser is returned by the lookups of a server when no
+	// entry matches the login, and by direct bind when every template is
+	// refused, so the next server can be tried. It's answered as
+	// ErrInvalidCredentials, the users can't tell a missing login from a
+	// wrong password
+	ErrCouldNotFindUser = errors.New("Can't find user in LDAP")
+
+	// ErrServiceBindFailed is returned if the server refuses the bind_dn
+	// and bind_password of the service account, a misconfigured server
+	// rather than a wrong password of the user
+	ErrServiceBindFailed = errors.New("LDAP server refused the bind_dn credentials")
+
+	// ErrClosed is returned if the connection was closed before it was established
+	ErrClosed = errors.New("LDAP connection is closed")
 )
 
-var dial = func(network, addr string) (IConnection, error) {
-	return LDAP.Dial(network, addr)
+// searchTimeoutGrace is how much longer than the search time limit
+// we wait for a response, in case the directory doesn't enforce the limit.
+// The searches still running then are abandoned
+const searchTimeoutGrace = 5 * time.Second
+
+type timeoutSetter interface {
+	SetTimeout(time.Duration)
+}
+
+var dial = func(dialer proxy.Dialer, network, addr string) (IConnection, error) {
+	c, err := dialer.Dial(network, addr)
+	if err != nil {
+		return nil, LDAP.NewError(LDAP.ErrorNetwork, err)
+	}
+	return newLDAPConnection(c, false), nil
+}
+
+var dialTLS = func(dialer proxy.Dialer, network, addr string, config *tls.Config) (IConnection, error) {
+	c, err := dialer.Dial(network, addr)
+	if err != nil {
+		return nil, LDAP.NewError(LDAP.ErrorNetwork, err)
+	}
+
+	tlsConn, err := handshake(c, config)
+	if err != nil {
+		return nil, err
+	}
+	return newLDAPConnection(tlsConn, true), nil
+}
+
+// dialStartTLS sends the StartTLS request before starting the connection,
+// so the requests of ldap.v3 are written through the TLS connection like
+// the ones of dialTLS
+var dialStartTLS = func(dialer proxy.Dialer, network, addr string, config *tls.Config) (IConnection, error) {
+	c, err := dialer.Dial(network, addr)
+	if err != nil {
+		return nil, LDAP.NewError(LDAP.ErrorNetwork, err)
+	}
+
+	if err := startTLS(c); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	tlsConn, err := handshake(c, config)
+	if err != nil {
+		return nil, err
+	}
+	return newLDAPConnection(tlsConn, true), nil
+}
+
+// startTLS sends the StartTLS extended request, with the first message ID
+// of the connection, and reads its response
+func startTLS(c net.Conn) error {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Request")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, int64(1), "MessageID"))
+	request := ber.Encode(ber.ClassApplication, ber.TypeConstructed, LDAP.ApplicationExtendedRequest, nil, "Start TLS")
+	request.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimitive, 0, "1.3.6.1.4.1.1466.20037", "TLS Extended Command"))
+	packet.AppendChild(request)
+
+	err := c.SetDeadline(time.Now().Add(LDAP.DefaultTimeout))
+	if err == nil {
+		_, err = c.Write(packet.Bytes())
+	}
+	if err != nil {
+		return LDAP.NewError(LDAP.ErrorNetwork, err)
+	}
+
+	response, err := ber.ReadPacket(c)
+	if err != nil {
+		return LDAP.NewError(LDAP.ErrorNetwork, err)
+	}
+	return LDAP.GetLDAPError(response)
+}
+
+// handshake runs the TLS handshake of the connection, closing it when it fails
+func handshake(c net.Conn, config *tls.Config) (*tls.Conn, error) {
+	tlsConn := tls.Client(c, config)
+	err := c.SetDeadline(time.Now().Add(LDAP.DefaultTimeout))
+	if err == nil {
+		err = tlsConn.Handshake()
+		if err == nil {
+			err = c.SetDeadline(time.Time{})
+		}
+	}
+	if err != nil {
+		c.Close()
+		return nil, LDAP.NewError(LDAP.ErrorNetwork, err)
+	}
+	return tlsConn, nil
+}
+
+// newDialer enables the TCP keepalive probes, so connections silently
+// dropped by a firewall fail instead of hanging
+func newDialer() *net.Dialer {
+	keepAlive := setting.LdapTCPKeepAlive
+	if keepAlive <= 0 {
+		// a negative value disables the keepalive probes
+		keepAlive = -1
+	}
+
+	return &net.Dialer{
+		Timeout:   LDAP.DefaultTimeout,
+		KeepAlive: keepAlive,
+	}
 }
 
 // New creates the new LDAP auth
 func New(server *ServerConfig) IAuth {
 	return &Auth{
 		server: server,
-		log:    log.New("ldap"),
+		log:    NewLogger("ldap"),
 	}
 }
 
@@ -70,6 +228,7 @@ func (auth *Auth) Dial() error {
 	}
 
 	var err error
+	var conn IConnection
 	var certPool *x509.CertPool
 	if auth.server.RootCACert != "" {
 		certPool = x509.NewCertPool()
@@ -85,11 +244,15 @@ func (auth *Auth) Dial() error {
 	}
 	var clientCert tls.Certificate
 	if auth.server.ClientCert != "" && auth.server.ClientKey != "" {
-		clientCert, err = tls.LoadX509KeyPair(auth.server.ClientCert, auth.server.ClientKey)
+		clientCert, err = loadClientCertificate(auth.server.ClientCert, auth.server.ClientKey)
 		if err != nil {
 			return err
 		}
 	}
+	dialer, err := newProxyDialer(auth.server)
+	if err != nil {
+		return err
+	}
 	for _, host := range strings.Split(auth.server.Host, " ") {
 		address := fmt.Sprintf("%s:%d", host, auth.server.Port)
 		if auth.server.UseSSL {
@@ -101,170 +264,411 @@ func (auth *Auth) Dial() error {
 			if len(clientCert.Certificate) > 0 {
 				tlsCfg.Certificates = append(tlsCfg.Certificates, clientCert)
 			}
+			applyFIPS(tlsCfg)
 			if auth.server.StartTLS {
-				auth.conn, err = dial("tcp", address)
-				if err == nil {
-					if err = auth.conn.StartTLS(tlsCfg); err == nil {
-						return nil
-					}
-				}
+				conn, err = dialStartTLS(dialer, "tcp", address, tlsCfg)
 			} else {
-				auth.conn, err = LDAP.DialTLS("tcp", address, tlsCfg)
+				conn, err = dialTLS(dialer, "tcp", address, tlsCfg)
 			}
 		} else {
-			auth.conn, err = dial("tcp", address)
+			conn, err = dial(dialer, "tcp", address)
 		}
 
 		if err == nil {
-			return nil
+			return auth.setConn(conn, address)
 		}
+		recordHostError(address, err)
 	}
 	return err
 }
 
-// Login logs in the user
-func (auth *Auth) Login(query *models.LoginUserQuery) error {
+// setConn stores the established connection unless the server
+// certificate is revoked or the Auth was closed while dialing
+func (auth *Auth) setConn(conn IConnection, address string) error {
+	if err := auth.checkRevocation(conn); err != nil {
+		conn.Close()
+		return err
+	}
+	if err := auth.bindChannel(conn); err != nil {
+		conn.Close()
+		return err
+	}
+	auth.detectQuirks(conn)
+
+	auth.mutex.Lock()
+	defer auth.mutex.Unlock()
+
+	if auth.closed {
+		conn.Close()
+		return ErrClosed
+	}
+
+	if auth.server.SearchTimeout > 0 {
+		if c, ok := conn.(timeoutSetter); ok {
+			c.SetTimeout(time.Duration(auth.server.SearchTimeout)*time.Second + searchTimeoutGrace)
+		}
+	}
+
+	conn = recordConnection(injectFaults(conn, configuredFaults()), auth.server)
+	auth.address = address
+	auth.conn = retryConnection(limitConnection(timeConnection(trackConnection(conn, address), address, auth.log)), auth.server.BusyRetries)
+	return nil
+}
+
+// Close closes the LDAP connection, which aborts any operation
+// that is still in flight on it. The Auth can't be dialed afterwards
+func (auth *Auth) Close() {
+	auth.mutex.Lock()
+	defer auth.mutex.Unlock()
+
+	auth.closed = true
+	if conn, ok := auth.conn.(*serviceConnection); ok {
+		conn.abort()
+	} else if auth.conn != nil {
+		auth.conn.Close()
+	}
+}
+
+// Authenticate verifies the user credentials against the LDAP server
+// and returns the user entry, without touching Grafana users
+func (auth *Auth) Authenticate(query *models.LoginUserQuery) (*UserInfo, error) {
+	user, err := auth.authenticate(query, userSearch{profile: true, groups: auth.server.groupsNeeded()})
+	if err != nil {
+		err = auth.sanitizeError(err, query.Password)
+		auth.recordLoginFailure(err)
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// VerifyPassword checks the password of the user against the LDAP server,
+// for the re-authentication before sensitive operations. It only binds and
+// searches the user, the Grafana user is neither created nor updated
+func (auth *Auth) VerifyPassword(username, password string) error {
+	query := &models.LoginUserQuery{Username: username, Password: password}
+
+	// the HBAC rules are still checked, they need the groups
+	_, err := auth.authenticate(query, userSearch{groups: auth.server.HBACService != ""})
+	if err != nil {
+		err = auth.sanitizeError(err, query.Password)
+		auth.recordLoginFailure(err)
+		return err
+	}
+	return nil
+}
+
+// authenticate binds as the user, looking it up with search
+func (auth *Auth) authenticate(query *models.LoginUserQuery, search userSearch) (*UserInfo, error) {
+	defer auth.logForRequest(query.ReqContext)()
+
+	if err := auth.validateLogin(query); err != nil {
+		return nil, err
+	}
+
+	strategy := auth.server.authStrategy()
+	if strategy == AuthStrategySearchOnly {
+		return nil, ErrSearchOnly
+	}
+
+	if err := operations.start(auth); err != nil {
+		return nil, err
+	}
+	defer operations.finish(auth)
+
 	// connect to ldap server
 	if err := auth.Dial(); err != nil {
-		return err
+		return nil, err
 	}
-	defer auth.conn.Close()
+	// the connection may be replaced for the user bind
+	defer func() { auth.conn.Close() }()
 
 	// perform initial authentication
 	if err := auth.initialBind(query.Username, query.Password); err != nil {
-		return err
+		return nil, err
 	}
 
 	// find user entry & attributes
-	user, err := auth.searchForUser(query.Username)
+	user, err := auth.searchForUser(query.Username, search)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	auth.log.Debug("Ldap User found", "info", spew.Sdump(user))
+	auth.log.Debug("Ldap User found", "info", dumpUser(user))
 
-	// check if a second user bind is needed
-	if auth.requireSecondBind {
-		err = auth.secondBind(user, query.Password)
-		if err != nil {
-			return err
+	// check the password of the user found
+	if strategy == AuthStrategySearchBind {
+		if err := auth.redial(); err != nil {
+			return nil, err
+		}
+		if err := auth.secondBind(user, query.Password); err != nil {
+			return nil, err
 		}
 	}
 
-	grafanaUser, err := auth.GetGrafanaUserFor(query.ReqContext, user)
-	if err != nil {
-		return err
+	// the restrictions are only checked once the password was, so
+	// they don't tell anything about the account to a wrong password
+	if err := auth.checkAccountRestrictions(user); err != nil {
+		return nil, err
+	}
+	if err := auth.checkHBAC(user); err != nil {
+		return nil, err
 	}
 
-	query.User = grafanaUser
-	return nil
+	if warning := auth.passwordPolicy; warning != nil {
+		auth.log.Info("LDAP password policy warning",
+			"username", user.Username, "expiresIn", warning.ExpiresIn, "graceLogins", warning.GraceLogins)
+		user.PasswordPolicy = warning
+	}
+
+	return user, nil
 }
 
 // SyncUser syncs user with Grafana
 func (auth *Auth) SyncUser(query *models.LoginUserQuery) error {
-	// connect to ldap server
-	err := auth.Dial()
+	defer auth.logForRequest(query.ReqContext)()
+
+	start := time.Now()
+	defer func() {
+		elapsed := time.Since(start)
+		metrics.M_Ldap_Sync_Duration.Observe(float64(elapsed.Nanoseconds() / int64(time.Millisecond)))
+	}()
+
+	user, err := auth.User(query.Username)
 	if err != nil {
 		return err
 	}
-	defer auth.conn.Close()
 
-	err = auth.serverBind()
+	grafanaUser, err := auth.GetGrafanaUserFor(query.ReqContext, user)
 	if err != nil {
 		return err
 	}
 
-	// find user entry & attributes
-	user, err := auth.searchForUser(query.Username)
-	if err != nil {
-		auth.log.Error("Failed searching for user in ldap", "error", err)
-		return err
+	query.User = grafanaUser
+	return nil
+}
+
+// User looks the user up with the bind account, without
+// touching the Grafana user. It returns ErrCouldNotFindUser
+// if the user isn't in the directory
+func (auth *Auth) User(username string) (*UserInfo, error) {
+	if err := operations.start(auth); err != nil {
+		return nil, err
 	}
+	defer operations.finish(auth)
 
-	auth.log.Debug("Ldap User found", "info", spew.Sdump(user))
+	// connect to ldap server
+	err := auth.connectService()
+	if err != nil {
+		return nil, auth.sanitizeError(err)
+	}
+	defer auth.conn.Close()
 
-	grafanaUser, err := auth.GetGrafanaUserFor(query.ReqContext, user)
+	// find user entry & attributes
+	user, err := auth.searchForUser(username, searchEverything)
 	if err != nil {
-		return err
+		err = auth.sanitizeError(err)
+		auth.log.Error("Failed searching for user in ldap", "error", err)
+		return nil, err
 	}
 
-	query.User = grafanaUser
-	return nil
+	auth.log.Debug("Ldap User found", "info", dumpUser(user))
+	return user, nil
 }
 
 func (auth *Auth) GetGrafanaUserFor(
 	ctx *models.ReqContext,
 	user *UserInfo,
 ) (*models.User, error) {
+	defer auth.logForRequest(ctx)()
+
+	extUser := auth.buildGrafanaUser(user)
+
+	signupAllowed, err := auth.validateGrafanaUser(user, extUser)
+	if err != nil {
+		if err == ErrInvalidCredentials {
+			auth.revokeSessions(user, "no group mapping matches")
+			auth.removeFromOrgs(user)
+		}
+		return nil, err
+	}
+	if IsProtectedUser(user) {
+		return auth.protectedGrafanaUser(extUser)
+	}
+	if err := auth.RelinkUser(user); err != nil {
+		return nil, err
+	}
+	if err := auth.resolveLoginCollision(extUser); err != nil {
+		return nil, err
+	}
+	if err := auth.protectOrgs(extUser); err != nil {
+		return nil, err
+	}
+
+	// add/update user in grafana
+	upsertUserCmd := &models.UpsertUserCommand{
+		ReqContext:    ctx,
+		ExternalUser:  extUser,
+		SignupAllowed: signupAllowed,
+	}
+
+	err = bus.Dispatch(upsertUserCmd)
+	if err != nil {
+		return nil, err
+	}
+
+	auth.reactivateUser(upsertUserCmd.Result)
+
+	if err := auth.ApplyGroupQuotas(user); err != nil {
+		auth.log.Warn("Failed to apply the quotas of the LDAP groups", "login", user.Username, "error", err)
+	}
+	if err := auth.StoreAttributes(user, upsertUserCmd.Result.Id); err != nil {
+		auth.log.Warn("Failed to store the attributes of the LDAP user", "login", user.Username, "error", err)
+	}
+
+	return upsertUserCmd.Result, nil
+}
+
+// MapGrafanaUser maps the LDAP user to the Grafana user GetGrafanaUserFor
+// would upsert, without writing anything. It returns ErrInvalidCredentials
+// if no group mapping matches
+func (auth *Auth) MapGrafanaUser(user *UserInfo) (*models.ExternalUserInfo, error) {
+	extUser := auth.buildGrafanaUser(user)
+
+	if _, err := auth.validateGrafanaUser(user, extUser); err != nil {
+		return nil, err
+	}
+	if err := auth.resolveLoginCollision(extUser); err != nil {
+		return nil, err
+	}
+	if err := auth.protectOrgs(extUser); err != nil {
+		return nil, err
+	}
+
+	return extUser, nil
+}
+
+// buildGrafanaUser maps the LDAP user to the Grafana user, with the
+// org roles of the first group mapping matching in each org, or of the
+// service account mappings for the service accounts
+func (auth *Auth) buildGrafanaUser(user *UserInfo) *models.ExternalUserInfo {
 	extUser := &models.ExternalUserInfo{
 		AuthModule: "ldap",
 		AuthId:     user.DN,
 		Name:       fmt.Sprintf("%s %s", user.FirstName, user.LastName),
-		Login:      user.Username,
+		Login:      auth.server.normalizeLogin(user.Username),
 		Email:      user.Email,
 		Groups:     user.MemberOf,
 		OrgRoles:   map[int64]models.RoleType{},
+
+		GroupDetails: externalGroups(user.Groups),
+	}
+
+	if !auth.server.emailDomainAllowed(user.Email) && auth.server.EmailDomainMismatch == EmailDomainStrip {
+		auth.log.Debug("Mapping the LDAP user without its email, its domain is not allowed", "username", user.Username, "email", user.Email)
+		extUser.Email = ""
+	}
+
+	// the service accounts only get the roles of their mappings
+	if user.ServiceAccount {
+		isGrafanaAdmin := false
+		extUser.IsGrafanaAdmin = &isGrafanaAdmin
+		for orgId, orgRole := range user.serviceAccountRoles {
+			extUser.OrgRoles[orgId] = orgRole
+		}
+		return extUser
 	}
 
-	for _, group := range auth.server.Groups {
+	for _, group := range auth.server.matchingGroups(user) {
 		// only use the first match for each org
 		if extUser.OrgRoles[group.OrgId] != "" {
 			continue
 		}
 
-		if user.isMemberOf(group.GroupDN) {
-			extUser.OrgRoles[group.OrgId] = group.OrgRole
-			if extUser.IsGrafanaAdmin == nil || !*extUser.IsGrafanaAdmin {
-				extUser.IsGrafanaAdmin = group.IsGrafanaAdmin
-			}
+		extUser.OrgRoles[group.OrgId] = group.OrgRole
+		if extUser.IsGrafanaAdmin == nil || !*extUser.IsGrafanaAdmin {
+			extUser.IsGrafanaAdmin = group.IsGrafanaAdmin
 		}
 	}
 
-	// validate that the user has access
-	// if there are no ldap group mappings access is true
-	// otherwise a single group must match
+	return extUser
+}
+
+// validateGrafanaUser checks the user has access and returns if a Grafana
+// user may be created for it on its first login. The access is given if
+// there are no ldap group mappings, otherwise a single group must match.
+// The sign up follows allow_sign_up and is restricted to the members of
+// the sign_up_groups when set, the other users must be pre-provisioned.
+// The sign_up_groups don't apply to the service accounts. The users whose
+// email domain isn't allowed are refused with email_domain_mismatch = reject
+func (auth *Auth) validateGrafanaUser(user *UserInfo, extUser *models.ExternalUserInfo) (bool, error) {
+	if !auth.server.emailDomainAllowed(user.Email) && auth.server.EmailDomainMismatch != EmailDomainStrip {
+		auth.log.Info("Ldap Auth: the email domain of the user is not allowed", "username", user.Username, "email", user.Email)
+		return false, ErrEmailDomainNotAllowed
+	}
+
 	if len(auth.server.Groups) > 0 && len(extUser.OrgRoles) < 1 {
 		auth.log.Info(
 			"Ldap Auth: user does not belong in any of the specified ldap groups",
 			"username", user.Username,
 			"groups", user.MemberOf,
 		)
-		return nil, ErrInvalidCredentials
+		return false, ErrInvalidCredentials
 	}
 
-	// add/update user in grafana
-	upsertUserCmd := &models.UpsertUserCommand{
-		ReqContext:    ctx,
-		ExternalUser:  extUser,
-		SignupAllowed: setting.LdapAllowSignup,
+	signupAllowed := setting.LdapAllowSignup
+	if auth.server.AllowSignUp != nil {
+		signupAllowed = *auth.server.AllowSignUp
+	}
+	if !signupAllowed || len(auth.server.SignUpGroups) == 0 || user.ServiceAccount {
+		return signupAllowed, nil
 	}
 
-	err := bus.Dispatch(upsertUserCmd)
-	if err != nil {
-		return nil, err
+	for _, group := range auth.server.SignUpGroups {
+		if user.isMemberOf(group) {
+			return true, nil
+		}
 	}
 
-	return upsertUserCmd.Result, nil
+	auth.log.Debug(
+		"Ldap Auth: user is not in any of the sign up groups, it must already exist in Grafana",
+		"username", user.Username,
+		"groups", user.MemberOf,
+	)
+	return false, nil
 }
 
 func (auth *Auth) serverBind() error {
+	return auth.serverBindAs(auth.server.BindDN)
+}
+
+// serverBindAs binds as bindDN with bind_password
+func (auth *Auth) serverBindAs(bindDN string) error {
+	// the client certificate already authenticated the connection
+	if auth.server.ClientCertAuth {
+		return nil
+	}
+
 	bindFn := func() error {
-		return auth.conn.Bind(auth.server.BindDN, auth.server.BindPassword)
+		return auth.conn.Bind(bindDN, auth.server.BindPassword)
 	}
 
 	if auth.server.BindPassword == "" {
 		bindFn = func() error {
-			return auth.conn.UnauthenticatedBind(auth.server.BindDN)
+			return auth.conn.UnauthenticatedBind(bindDN)
 		}
 	}
 
 	// bind_dn and bind_password to bind
 	if err := bindFn(); err != nil {
-		auth.log.Info("LDAP initial bind failed, %v", err)
+		auth.log.Debug("LDAP initial bind failed", "error", err)
 
+		if err := auth.signingError(err); err == ErrSigningRequired {
+			return err
+		}
 		if ldapErr, ok := err.(*LDAP.Error); ok {
 			if ldapErr.ResultCode == 49 {
-				return ErrInvalidCredentials
+				return ErrServiceBindFailed
 			}
 		}
 		return err
@@ -273,9 +677,34 @@ func (auth *Auth) serverBind() error {
 	return nil
 }
 
+// redial replaces the connection with a new one before the user bind
+// with separate_user_bind, for the directories which don't allow the
+// connection of the service account to be bound again
+func (auth *Auth) redial() error {
+	if !auth.server.SeparateUserBind || auth.server.authStrategy() != AuthStrategySearchBind {
+		return nil
+	}
+
+	auth.conn.Close()
+	return auth.Dial()
+}
+
 func (auth *Auth) secondBind(user *UserInfo, userPassword string) error {
-	if err := auth.conn.Bind(user.DN, userPassword); err != nil {
-		auth.log.Info("Second bind failed", "error", err)
+	if err := auth.userBind(user.DN, userPassword); err != nil {
+		auth.log.Debug("Second bind failed", "error", err)
+
+		if isAccountDisabled(err) {
+			auth.revokeSessions(user, "account disabled in the directory")
+		}
+		if restriction := restrictionError(err); restriction != nil {
+			return restriction
+		}
+		if typed := auth.quirkBindError(err); typed != nil {
+			return typed
+		}
+		if err := auth.signingError(err); err == ErrSigningRequired {
+			return err
+		}
 
 		if ldapErr, ok := err.(*LDAP.Error); ok {
 			if ldapErr.ResultCode == 49 {
@@ -288,161 +717,283 @@ func (auth *Auth) secondBind(user *UserInfo, userPassword string) error {
 	return nil
 }
 
-func (auth *Auth) initialBind(username, userPassword string) error {
-	if auth.server.BindPassword != "" || auth.server.BindDN == "" {
-		userPassword = auth.server.BindPassword
-		auth.requireSecondBind = true
+// initialBind binds with the service account, as bind_dn of the username with the deprecated
+// placeholder and bind_password, or as the user with the direct-bind strategy
+func (auth *Auth) initialBind(username string, userPassword string) error {
+	if hasTemplatedServiceAccount(auth.server) {
+		return auth.serverBindAs(expandDN(auth.server.BindDN, newLoginValues(username)))
 	}
+	if auth.server.authStrategy() != AuthStrategyDirectBind {
+		return auth.serverBind()
+	}
+
+	return auth.directBind(username, userPassword)
+}
 
-	bindPath := auth.server.BindDN
-	if strings.Contains(bindPath, "%s") {
-		bindPath = fmt.Sprintf(auth.server.BindDN, username)
+// searches collapses identical concurrent directory lookups, e.g. a
+// burst of requests re-checking the same user, into a single query.
+// Results handed out by it are shared between callers and must be
+// treated as read-only.
+var searches = &singleflight.Group{}
+
+// searchForUser looks the user up, reading what the search asks for: the
+// logins skip the groups when nothing uses them, and the password
+// verifications skip the profile of the Grafana user too
+func (auth *Auth) searchForUser(username string, search userSearch) (*UserInfo, error) {
+	entry, err := auth.searchUserEntry(username, auth.server.requestedAttributes(search))
+	if err != nil {
+		return nil, err
 	}
+	searchResult, attr := entry.result, entry.attr
 
-	bindFn := func() error {
-		return auth.conn.Bind(bindPath, userPassword)
+	if len(searchResult.Entries) == 0 {
+		return nil, ErrCouldNotFindUser
 	}
 
-	if userPassword == "" {
-		bindFn = func() error {
-			return auth.conn.UnauthenticatedBind(bindPath)
+	if len(searchResult.Entries) > 1 {
+		if searchResult, err = auth.chooseEntry(username, searchResult); err != nil {
+			return nil, err
 		}
 	}
 
-	if err := bindFn(); err != nil {
-		auth.log.Info("Initial bind failed", "error", err)
-
-		if ldapErr, ok := err.(*LDAP.Error); ok {
-			if ldapErr.ResultCode == 49 {
-				return ErrInvalidCredentials
-			}
+	var memberOf []string
+	var groups []*Group
+	if search.groups {
+		if memberOf, groups, err = auth.getMemberOf(username, searchResult, attr); err != nil {
+			return nil, err
 		}
-		return err
+	} else {
+		auth.log.Debug("Skipping the LDAP group lookup, the groups aren't used", "username", username)
 	}
 
-	return nil
+	user := &UserInfo{
+		DN:       searchResult.Entries[0].DN,
+		Username: getLdapAttr(attr.Username, searchResult),
+		MemberOf: memberOf,
+		Groups:   groups,
+	}
+	if auth.server.AccountRestrictions {
+		user.restrictions = readAccountRestrictions(searchResult.Entries[0])
+	}
+	if !search.profile {
+		return user, nil
+	}
+
+	user.LastName = getLdapAttr(attr.Surname, searchResult)
+	user.FirstName = getLdapAttr(attr.Name, searchResult)
+	user.Email = getLdapAttr(attr.Email, searchResult)
+	if attribute := auth.server.SecondFactorSeedAttribute; attribute != "" {
+		user.secondFactorSeed = getLdapAttr(attribute, searchResult)
+	}
+	attributes := newEntryAttributes(searchResult.Entries[0])
+	user.Attributes = auth.server.readStoredAttributes(attributes)
+	user.GUID = auth.server.readGUID(attributes)
+	auth.server.readServiceAccount(user, attributes)
+	if attribute := auth.server.ManagerAttribute; attribute != "" {
+		user.managerDN = getLdapAttr(attribute, searchResult)
+		auth.resolveManagers(user)
+	}
+
+	return user, nil
 }
 
-func (auth *Auth) searchForUser(username string) (*UserInfo, error) {
-	var searchResult *LDAP.SearchResult
-	var err error
+// userEntry is the result of searchUserEntry, with the
+// attributes of the search base the user was found in
+type userEntry struct {
+	result *LDAP.SearchResult
+	attr   AttributeMap
+}
 
-	for _, searchBase := range auth.server.SearchBaseDNs {
-		attributes := make([]string, 0)
-		inputs := auth.server.Attr
-		attributes = appendIfNotEmpty(attributes,
-			inputs.Username,
-			inputs.Surname,
-			inputs.Email,
-			inputs.Name,
-			inputs.MemberOf)
+// searchUserEntry looks the user up in the configured search bases,
+// sharing the result with concurrent lookups of the same user. Only the
+// attributes of the profile and of the groups the search asks for are read
+func (auth *Auth) searchUserEntry(username string, search userSearch) (*userEntry, error) {
+	key := "user\x00" + ServerKey(auth.server) + "\x00" + username + search.key()
 
-		searchReq := LDAP.SearchRequest{
-			BaseDN:       searchBase,
-			Scope:        LDAP.ScopeWholeSubtree,
-			DerefAliases: LDAP.NeverDerefAliases,
-			Attributes:   attributes,
-			Filter: strings.Replace(
-				auth.server.SearchFilter,
-				"%s", LDAP.EscapeFilter(username),
-				-1,
-			),
-		}
+	result, err, _ := searches.Do(key, func() (interface{}, error) {
+		entry := &userEntry{attr: auth.server.Attr}
+		var err error
 
-		auth.log.Debug("Ldap Search For User Request", "info", spew.Sdump(searchReq))
+		for _, searchBase := range auth.server.SearchBaseDNs {
+			filter, inputs := auth.server.searchBaseSettings(searchBase)
+			searchReq := LDAP.SearchRequest{
+				BaseDN:       searchBase,
+				Scope:        LDAP.ScopeWholeSubtree,
+				DerefAliases: LDAP.NeverDerefAliases,
+				Attributes:   auth.server.userSearchAttributes(inputs, search),
+				TimeLimit:    auth.server.SearchTimeout,
+				Filter:       expandFilter(filter, newLoginValues(username)),
+			}
 
-		searchResult, err = auth.conn.Search(&searchReq)
-		if err != nil {
-			return nil, err
+			auth.log.Debug("Ldap Search For User Request", "info", spew.Sdump(searchReq))
+
+			entry.result, err = auth.search(searchUser, &searchReq)
+			if err != nil {
+				return nil, err
+			}
+			if entry.result, err = auth.followReferrals(&searchReq, entry.result); err != nil {
+				return nil, err
+			}
+
+			if len(entry.result.Entries) > 0 {
+				entry.attr = inputs
+				break
+			}
 		}
 
-		if len(searchResult.Entries) > 0 {
-			break
+		if entry.result == nil {
+			entry.result = &LDAP.SearchResult{}
 		}
-	}
 
-	if len(searchResult.Entries) == 0 {
-		return nil, ErrInvalidCredentials
+		return entry, nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	if len(searchResult.Entries) > 1 {
-		return nil, errors.New("Ldap search matched more than one entry, please review your filter setting")
+	return result.(*userEntry), nil
+}
+
+// getMemberOf returns the groups of the user found by searchUserEntry,
+// either from the member attribute or, when group search filters are
+// configured, by searching for the groups matching any of them. Only
+// the group search returns the Group of the groups
+func (auth *Auth) getMemberOf(username string, searchResult *LDAP.SearchResult, attr AttributeMap) ([]string, []*Group, error) {
+	filters := auth.server.groupSearchFilters()
+	if len(filters) == 0 {
+		memberOf := getLdapAttrArray(attr.MemberOf, searchResult)
+		if auth.server.Preset == presetFreeIPA {
+			return withoutFreeIPAPolicies(memberOf), nil, nil
+		}
+		return append([]string(nil), memberOf...), nil, nil
 	}
 
 	var memberOf []string
-	if auth.server.GroupSearchFilter == "" {
-		memberOf = getLdapAttrArray(auth.server.Attr.MemberOf, searchResult)
-	} else {
-		// If we are using a POSIX LDAP schema it won't support memberOf, so we manually search the groups
-		var groupSearchResult *LDAP.SearchResult
-		for _, groupSearchBase := range auth.server.GroupSearchBaseDNs {
-			var filter_replace string
-			if auth.server.GroupSearchFilterUserAttribute == "" {
-				filter_replace = getLdapAttr(auth.server.Attr.Username, searchResult)
-			} else {
-				filter_replace = getLdapAttr(auth.server.GroupSearchFilterUserAttribute, searchResult)
+	var groups []*Group
+	seen := map[string]bool{}
+	for _, filter := range filters {
+		found, err := auth.searchGroups(username, searchResult, attr, filter)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, group := range found {
+			if key := strings.ToLower(group.ID); !seen[key] {
+				seen[key] = true
+				memberOf = append(memberOf, group.ID)
+				groups = append(groups, group)
 			}
+		}
+	}
+	return memberOf, groups, nil
+}
 
-			filter := strings.Replace(
-				auth.server.GroupSearchFilter, "%s",
-				LDAP.EscapeFilter(filter_replace),
-				-1,
-			)
+// searchGroups searches for the groups of the user matching the filter,
+// since a POSIX LDAP schema doesn't support memberOf
+func (auth *Auth) searchGroups(username string, searchResult *LDAP.SearchResult, attr AttributeMap, groupFilter *GroupSearchFilter) ([]*Group, error) {
+	var filter_replace string
+	if groupFilter.UserAttribute == "" {
+		filter_replace = getLdapAttr(attr.Username, searchResult)
+	} else {
+		filter_replace = getLdapAttr(groupFilter.UserAttribute, searchResult)
+	}
 
-			auth.log.Info("Searching for user's groups", "filter", filter)
+	filter := expandPlaceholders(
+		groupFilter.Filter,
+		filter_replace,
+		newLoginValues(username),
+		LDAP.EscapeFilter,
+	)
 
-			// support old way of reading settings
-			groupIdAttribute := auth.server.Attr.MemberOf
-			// but prefer dn attribute if default settings are used
-			if groupIdAttribute == "" || groupIdAttribute == "memberOf" {
-				groupIdAttribute = "dn"
-			}
+	key := "groups\x00" + ServerKey(auth.server) + "\x00" + filter
+
+	result, err, _ := searches.Do(key, func() (interface{}, error) {
+		var groups []*Group
+		var missingBases []string
+
+		groupIdAttribute := auth.server.GroupSearchGroupAttribute
+		if groupIdAttribute == "" {
+			groupIdAttribute = "dn"
+		}
+
+		for _, groupSearchBase := range auth.server.GroupSearchBaseDNs {
+			auth.log.Debug("Searching for user's groups", "filter", filter)
 
 			groupSearchReq := LDAP.SearchRequest{
 				BaseDN:       groupSearchBase,
 				Scope:        LDAP.ScopeWholeSubtree,
 				DerefAliases: LDAP.NeverDerefAliases,
-				Attributes:   []string{groupIdAttribute},
+				Attributes:   auth.server.groupSearchAttributes(groupIdAttribute),
+				TimeLimit:    auth.server.SearchTimeout,
 				Filter:       filter,
 			}
 
-			groupSearchResult, err = auth.conn.Search(&groupSearchReq)
+			groupSearchResult, err := auth.search(searchGroups, &groupSearchReq)
+			if isNoSuchObject(err) {
+				// a missing base has no groups, the others may
+				auth.log.Debug("Group search base not found", "base_dn", groupSearchBase)
+				missingBases = append(missingBases, groupSearchBase)
+				continue
+			}
 			if err != nil {
 				return nil, err
 			}
 
 			if len(groupSearchResult.Entries) > 0 {
 				for i := range groupSearchResult.Entries {
-					memberOf = append(memberOf, getLdapAttrN(groupIdAttribute, groupSearchResult, i))
+					groups = append(groups, auth.server.readGroup(groupSearchResult, i, groupIdAttribute))
 				}
 				break
 			}
 		}
+
+		auth.recordGroupSearch(len(groups) > 0, missingBases)
+		return groups, nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return &UserInfo{
-		DN:        searchResult.Entries[0].DN,
-		LastName:  getLdapAttr(auth.server.Attr.Surname, searchResult),
-		FirstName: getLdapAttr(auth.server.Attr.Name, searchResult),
-		Username:  getLdapAttr(auth.server.Attr.Username, searchResult),
-		Email:     getLdapAttr(auth.server.Attr.Email, searchResult),
-		MemberOf:  memberOf,
-	}, nil
+	// the groups are shared with the concurrent lookups
+	groups := result.([]*Group)
+	copies := make([]*Group, 0, len(groups))
+	for _, group := range groups {
+		copied := *group
+		copies = append(copies, &copied)
+	}
+	return copies, nil
 }
 
+// Users gets the users of the first base DN with users. When the searches
+// of some base DNs time out, the users found are returned along with a
+// *PartialUsersError listing these base DNs
 func (ldap *Auth) Users() ([]*UserInfo, error) {
-	var result *LDAP.SearchResult
-	var err error
+	return ldap.UsersPaged(0, nil)
+}
+
+// UsersPaged gets the users like Users, searching them in pages of
+// pageSize entries, or in one go with 0 unless the quirks of the directory
+// need pages, so the size limits of the directory apply to each page.
+// The pacer, if any, paces the pages
+func (ldap *Auth) UsersPaged(pageSize int, pacer Pacer) ([]*UserInfo, error) {
+	result := &LDAP.SearchResult{}
+	var partial *PartialUsersError
 	server := ldap.server
 
-	if err := ldap.Dial(); err != nil {
+	if err := operations.start(ldap); err != nil {
 		return nil, err
 	}
+	defer operations.finish(ldap)
+
+	if err := ldap.connectService(); err != nil {
+		return nil, ldap.sanitizeError(err)
+	}
 	defer ldap.conn.Close()
 
+	inputs := server.Attr
 	for _, base := range server.SearchBaseDNs {
+		var filter string
+		filter, inputs = server.searchBaseSettings(base)
 		attributes := make([]string, 0)
-		inputs := server.Attr
 		attributes = appendIfNotEmpty(
 			attributes,
 			inputs.Username,
@@ -450,69 +1001,121 @@ func (ldap *Auth) Users() ([]*UserInfo, error) {
 			inputs.Email,
 			inputs.Name,
 			inputs.MemberOf,
+			server.GuidAttribute,
 		)
+		attributes = append(attributes, server.storedAttributeNames()...)
+		attributes = append(attributes, server.serviceAccountAttributeNames()...)
 
 		req := LDAP.SearchRequest{
 			BaseDN:       base,
 			Scope:        LDAP.ScopeWholeSubtree,
 			DerefAliases: LDAP.NeverDerefAliases,
 			Attributes:   attributes,
+			TimeLimit:    server.SearchTimeout,
 
 			// Doing a star here to get all the users in one go
-			Filter: strings.Replace(server.SearchFilter, "%s", "*", -1),
+			Filter: expandPlaceholders(filter, "*", allLogins, noEscape),
 		}
 
-		result, err = ldap.conn.Search(&req)
+		var found *LDAP.SearchResult
+		var err error
+		if pageSize > 0 {
+			found, err = ldap.searchPaged(&req, pageSize, pacer)
+		} else {
+			found, err = ldap.searchAll(&req)
+		}
 		if err != nil {
-			return nil, err
+			err = ldap.sanitizeError(err)
+			if !xerrors.Is(err, ErrTimeout) {
+				return nil, err
+			}
+
+			// the other base DNs may still have the users
+			ldap.log.Warn("Search of the LDAP users timed out, their users are missing", "base_dn", base, "error", err)
+			if partial == nil {
+				partial = &PartialUsersError{}
+			}
+			partial.Errors = append(partial.Errors, &BaseDNError{Server: server.Host, BaseDN: base, Err: err})
+			continue
 		}
 
-		if len(result.Entries) > 0 {
+		result.Entries = append(result.Entries, found.Entries...)
+		if len(found.Entries) > 0 {
 			break
 		}
 	}
 
-	return ldap.serializeUsers(result), nil
-}
-
-func (ldap *Auth) serializeUsers(users *LDAP.SearchResult) []*UserInfo {
-	var serialized []*UserInfo
-
-	for index := range users.Entries {
-		serialize := &UserInfo{
-			DN: getLdapAttrN(
-				"dn",
-				users,
-				index,
-			),
-			LastName: getLdapAttrN(
-				ldap.server.Attr.Surname,
-				users,
-				index,
-			),
-			FirstName: getLdapAttrN(
-				ldap.server.Attr.Name,
-				users,
-				index,
-			),
-			Username: getLdapAttrN(
-				ldap.server.Attr.Username,
-				users,
-				index,
-			),
-			Email: getLdapAttrN(
-				ldap.server.Attr.Email,
-				users,
-				index,
-			),
-			MemberOf: getLdapAttrArrayN(
-				ldap.server.Attr.MemberOf,
-				users,
-				index,
-			),
-		}
-
-		serialized = append(serialized, serialize)
+	users := ldap.skipIncompleteUsers(ldap.serializeUsers(result, inputs))
+	ldap.resolveManagers(users...)
+	if partial != nil {
+		return users, partial
+	}
+	return users, nil
+}
+
+// searchPaged sends the search in pages of pageSize entries with the
+// simple paged results control and returns the entries of all the pages.
+// The pacer, if any, is told the latency of each page
+func (auth *Auth) searchPaged(request *LDAP.SearchRequest, pageSize int, pacer Pacer) (*LDAP.SearchResult, error) {
+	paging := LDAP.NewControlPaging(uint32(pageSize))
+	paged := *request
+	paged.Controls = append(append([]LDAP.Control(nil), request.Controls...), paging)
+
+	result := &LDAP.SearchResult{}
+	for {
+		start := time.Now()
+		page, err := auth.search(searchEnumeration, &paged)
+		if err != nil {
+			return nil, err
+		}
+		result.Entries = append(result.Entries, page.Entries...)
+		result.Referrals = append(result.Referrals, page.Referrals...)
+
+		response, ok := LDAP.FindControl(page.Controls, LDAP.ControlTypePaging).(*LDAP.ControlPaging)
+		if !ok || len(response.Cookie) == 0 {
+			return result, nil
+		}
+		paging.SetCookie(response.Cookie)
+
+		if pacer != nil {
+			if err := pacer.Pace(time.Since(start)); err != nil {
+				abandonPagedSearch(auth.conn, &paged, paging)
+				return nil, err
+			}
+		}
+	}
+}
+
+// serializeUsers reads the users of the entries of the search. The
+// attributes of each entry are indexed once, and the users allocated
+// together, the syncs of large directories serialize many of them
+func (ldap *Auth) serializeUsers(users *LDAP.SearchResult, attr AttributeMap) []*UserInfo {
+	if len(users.Entries) == 0 {
+		return nil
+	}
+
+	serialized := make([]*UserInfo, len(users.Entries))
+	infos := make([]UserInfo, len(users.Entries))
+	attributes := &entryAttributes{values: map[string][]string{}}
+
+	for index, entry := range users.Entries {
+		attributes.reset(entry)
+
+		serialize := &infos[index]
+		serialize.DN = attributes.dn
+		serialize.LastName = attributes.value(attr.Surname)
+		serialize.FirstName = attributes.value(attr.Name)
+		serialize.Username = attributes.value(attr.Username)
+		serialize.Email = attributes.value(attr.Email)
+		serialize.MemberOf = attributes.valuesOf(attr.MemberOf)
+		serialize.Attributes = ldap.server.readStoredAttributes(attributes)
+		serialize.GUID = ldap.server.readGUID(attributes)
+		if attribute := ldap.server.ManagerAttribute; attribute != "" {
+			serialize.managerDN = attributes.value(attribute)
+		}
+		ldap.server.readServiceAccount(serialize, attributes)
+
+		serialized[index] = serialize
 	}
 
 	return serialized
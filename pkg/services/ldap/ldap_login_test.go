@@ -7,6 +7,7 @@ import (
 	"gopkg.in/ldap.v3"
 
 	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/setting"
 )
 
 func TestLdapLogin(t *testing.T) {
@@ -35,7 +36,7 @@ func TestLdapLogin(t *testing.T) {
 				log:  log.New("test-logger"),
 			}
 
-			err := auth.Login(scenario.loginUserQuery)
+			_, err := auth.Authenticate(scenario.loginUserQuery)
 
 			Convey("it should return invalid credentials error", func() {
 				So(err, ShouldEqual, ErrInvalidCredentials)
@@ -72,14 +73,107 @@ func TestLdapLogin(t *testing.T) {
 				log:  log.New("test-logger"),
 			}
 
-			err := auth.Login(scenario.loginUserQuery)
+			user, err := auth.Authenticate(scenario.loginUserQuery)
+			So(err, ShouldBeNil)
+
+			grafanaUser, err := auth.GetGrafanaUserFor(scenario.loginUserQuery.ReqContext, user)
 
 			Convey("it should not return error", func() {
 				So(err, ShouldBeNil)
 			})
 
 			Convey("it should get user", func() {
-				So(scenario.loginUserQuery.User.Login, ShouldEqual, "markelog")
+				So(grafanaUser.Login, ShouldEqual, "markelog")
+			})
+		})
+
+		AuthScenario("When login with a placeholder in bind_dn and bind_password", func(scenario *scenarioContext) {
+			conn := &mockLdapConn{}
+			entry := ldap.Entry{DN: "uid=user,ou=users,dc=grafana,dc=org", Attributes: []*ldap.EntryAttribute{
+				{Name: "username", Values: []string{"user"}},
+			}}
+			conn.setSearchResult(&ldap.SearchResult{Entries: []*ldap.Entry{&entry}})
+
+			binds := [][2]string{}
+			conn.bindProvider = func(username, password string) error {
+				binds = append(binds, [2]string{username, password})
+				return nil
+			}
+			auth := &Auth{
+				server: &ServerConfig{
+					BindDN:        "cn=%s,ou=services,dc=grafana,dc=org",
+					BindPassword:  "grafana",
+					Attr:          AttributeMap{Username: "username"},
+					SearchBaseDNs: []string{"BaseDNHere"},
+				},
+				conn: conn,
+				log:  log.New("test-logger"),
+			}
+
+			_, err := auth.Authenticate(scenario.loginUserQuery)
+
+			Convey("it should bind as bind_dn of the username before binding as the user", func() {
+				So(err, ShouldBeNil)
+				So(binds, ShouldResemble, [][2]string{
+					{"cn=user,ou=services,dc=grafana,dc=org", "grafana"},
+					{"uid=user,ou=users,dc=grafana,dc=org", "pwd"},
+				})
+			})
+		})
+
+		AuthScenario("When login with an empty password", func(scenario *scenarioContext) {
+			setting.LdapRejectEmptyPasswords = true
+			defer func() { setting.LdapRejectEmptyPasswords = false }()
+
+			conn := &mockLdapConn{}
+			bindCalled := false
+			conn.bindProvider = func(username, password string) error {
+				bindCalled = true
+				return nil
+			}
+			conn.unauthenticatedBindProvider = func(username string) error {
+				bindCalled = true
+				return nil
+			}
+			auth := &Auth{
+				server: &ServerConfig{
+					BindDN:        "cn=%s,dc=grafana,dc=org",
+					AuthStrategy:  AuthStrategyDirectBind,
+					SearchBaseDNs: []string{"BaseDNHere"},
+				},
+				conn: conn,
+				log:  log.New("test-logger"),
+			}
+			scenario.loginUserQuery.Password = ""
+
+			_, err := auth.Authenticate(scenario.loginUserQuery)
+
+			Convey("it should be rejected before any bind", func() {
+				So(err, ShouldEqual, ErrInvalidCredentials)
+				So(bindCalled, ShouldBeFalse)
+			})
+		})
+
+		AuthScenario("When login on a search-only server", func(scenario *scenarioContext) {
+			dialCalled := false
+			defer keepDial()()
+			hookDial = func(auth *Auth) error {
+				dialCalled = true
+				return nil
+			}
+			auth := &Auth{
+				server: &ServerConfig{
+					AuthStrategy:  AuthStrategySearchOnly,
+					SearchBaseDNs: []string{"BaseDNHere"},
+				},
+				log: log.New("test-logger"),
+			}
+
+			_, err := auth.Authenticate(scenario.loginUserQuery)
+
+			Convey("it should be refused before dialing", func() {
+				So(err, ShouldEqual, ErrSearchOnly)
+				So(dialCalled, ShouldBeFalse)
 			})
 		})
 	})
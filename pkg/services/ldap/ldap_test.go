@@ -2,14 +2,18 @@ package ldap
 
 import (
 	"context"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/net/proxy"
 	"gopkg.in/ldap.v3"
 
 	"github.com/grafana/grafana/pkg/bus"
 	"github.com/grafana/grafana/pkg/infra/log"
 	m "github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
 )
 
 func TestAuth(t *testing.T) {
@@ -25,18 +29,17 @@ func TestAuth(t *testing.T) {
 			Auth := &Auth{
 				conn: conn,
 				server: &ServerConfig{
-					BindDN:       "cn=%s,o=users,dc=grafana,dc=org",
+					BindDN:       "cn=admin,dc=grafana,dc=org",
 					BindPassword: "bindpwd",
 				},
 			}
 			err := Auth.initialBind("user", "pwd")
 			So(err, ShouldBeNil)
-			So(Auth.requireSecondBind, ShouldBeTrue)
-			So(actualUsername, ShouldEqual, "cn=user,o=users,dc=grafana,dc=org")
+			So(actualUsername, ShouldEqual, "cn=admin,dc=grafana,dc=org")
 			So(actualPassword, ShouldEqual, "bindpwd")
 		})
 
-		Convey("Given bind dn configured", func() {
+		Convey("Given the direct-bind strategy", func() {
 			conn := &mockLdapConn{}
 			var actualUsername, actualPassword string
 			conn.bindProvider = func(username, password string) error {
@@ -47,12 +50,12 @@ func TestAuth(t *testing.T) {
 			Auth := &Auth{
 				conn: conn,
 				server: &ServerConfig{
-					BindDN: "cn=%s,o=users,dc=grafana,dc=org",
+					BindDN:       "cn=%s,o=users,dc=grafana,dc=org",
+					AuthStrategy: AuthStrategyDirectBind,
 				},
 			}
 			err := Auth.initialBind("user", "pwd")
 			So(err, ShouldBeNil)
-			So(Auth.requireSecondBind, ShouldBeFalse)
 			So(actualUsername, ShouldEqual, "cn=user,o=users,dc=grafana,dc=org")
 			So(actualPassword, ShouldEqual, "pwd")
 		})
@@ -72,7 +75,6 @@ func TestAuth(t *testing.T) {
 			}
 			err := Auth.initialBind("user", "pwd")
 			So(err, ShouldBeNil)
-			So(Auth.requireSecondBind, ShouldBeTrue)
 			So(unauthenticatedBindWasCalled, ShouldBeTrue)
 			So(actualUsername, ShouldBeEmpty)
 		})
@@ -100,6 +102,23 @@ func TestAuth(t *testing.T) {
 			So(actualPassword, ShouldEqual, "bindpwd")
 		})
 
+		Convey("Given bind dn and password refused by the server", func() {
+			conn := &mockLdapConn{}
+			conn.bindProvider = func(username, password string) error {
+				return &ldap.Error{ResultCode: 49}
+			}
+			Auth := &Auth{
+				conn: conn,
+				log:  log.New("test-logger"),
+				server: &ServerConfig{
+					BindDN:       "o=users,dc=grafana,dc=org",
+					BindPassword: "wrong",
+				},
+			}
+			err := Auth.serverBind()
+			So(err, ShouldEqual, ErrServiceBindFailed)
+		})
+
 		Convey("Given bind dn configured", func() {
 			conn := &mockLdapConn{}
 			unauthenticatedBindWasCalled := false
@@ -202,6 +221,23 @@ func TestAuth(t *testing.T) {
 			So(result, ShouldEqual, user1)
 		})
 
+		AuthScenario("Given a user to map without writing", func(sc *scenarioContext) {
+			Auth := New(&ServerConfig{
+				Groups: []*GroupToOrgRole{
+					{GroupDN: "cn=users", OrgId: 2, OrgRole: "Editor"},
+				},
+			})
+
+			extUser, err := Auth.MapGrafanaUser(&UserInfo{DN: "torkelo", Username: "torkelo", MemberOf: []string{"cn=users"}})
+			So(err, ShouldBeNil)
+			So(extUser.OrgRoles, ShouldResemble, map[int64]m.RoleType{2: m.ROLE_EDITOR})
+			So(sc.createUserCmd, ShouldBeNil)
+			So(sc.updateUserCmd, ShouldBeNil)
+
+			_, err = Auth.MapGrafanaUser(&UserInfo{DN: "torkelo", Username: "torkelo"})
+			So(err, ShouldEqual, ErrInvalidCredentials)
+		})
+
 		AuthScenario("Given no existing grafana user", func(sc *scenarioContext) {
 			Auth := New(&ServerConfig{
 				Groups: []*GroupToOrgRole{
@@ -234,6 +270,49 @@ func TestAuth(t *testing.T) {
 
 	})
 
+	Convey("validateGrafanaUser", t, func() {
+		allowSignUp := setting.LdapAllowSignup
+		defer func() { setting.LdapAllowSignup = allowSignUp }()
+		setting.LdapAllowSignup = true
+
+		member := &UserInfo{MemberOf: []string{"cn=grafana-users,dc=grafana,dc=org"}}
+		other := &UserInfo{MemberOf: []string{"cn=others,dc=grafana,dc=org"}}
+		extUser := &m.ExternalUserInfo{OrgRoles: map[int64]m.RoleType{}}
+		newAuth := func(server *ServerConfig) *Auth {
+			return &Auth{server: server, log: log.New("test-logger")}
+		}
+
+		Convey("Should follow allow_sign_up of [auth.ldap] by default", func() {
+			auth := newAuth(&ServerConfig{})
+			signupAllowed, err := auth.validateGrafanaUser(other, extUser)
+			So(err, ShouldBeNil)
+			So(signupAllowed, ShouldBeTrue)
+
+			setting.LdapAllowSignup = false
+			signupAllowed, _ = auth.validateGrafanaUser(other, extUser)
+			So(signupAllowed, ShouldBeFalse)
+		})
+
+		Convey("Should let the server override allow_sign_up", func() {
+			denied := false
+			signupAllowed, err := newAuth(&ServerConfig{AllowSignUp: &denied}).validateGrafanaUser(member, extUser)
+			So(err, ShouldBeNil)
+			So(signupAllowed, ShouldBeFalse)
+		})
+
+		Convey("Should only sign up the members of sign_up_groups", func() {
+			auth := newAuth(&ServerConfig{SignUpGroups: []string{"CN=grafana-users,dc=grafana,dc=org"}})
+
+			signupAllowed, err := auth.validateGrafanaUser(member, extUser)
+			So(err, ShouldBeNil)
+			So(signupAllowed, ShouldBeTrue)
+
+			signupAllowed, err = auth.validateGrafanaUser(other, extUser)
+			So(err, ShouldBeNil)
+			So(signupAllowed, ShouldBeFalse)
+		})
+	})
+
 	Convey("When syncing ldap groups to grafana org roles", t, func() {
 		AuthScenario("given no current user orgs", func(sc *scenarioContext) {
 			Auth := New(&ServerConfig{
@@ -406,8 +485,9 @@ func TestAuth(t *testing.T) {
 			log:  log.New("test-logger"),
 		}
 
+		defer keepDial()()
 		dialCalled := false
-		dial = func(network, addr string) (IConnection, error) {
+		dial = func(dialer proxy.Dialer, network, addr string) (IConnection, error) {
 			dialCalled = true
 			return mockLdapConnection, nil
 		}
@@ -482,7 +562,7 @@ func TestAuth(t *testing.T) {
 			log:  log.New("test-logger"),
 		}
 
-		searchResult, err := Auth.searchForUser("roelgerrits")
+		searchResult, err := Auth.searchForUser("roelgerrits", searchEverything)
 
 		So(err, ShouldBeNil)
 		So(searchResult, ShouldNotBeNil)
@@ -493,4 +573,93 @@ func TestAuth(t *testing.T) {
 		// No empty attributes should be added to the search request
 		So(len(mockLdapConnection.searchAttributes), ShouldEqual, 3)
 	})
+
+	Convey("When searching for a user with a search timeout", t, func() {
+		mockLdapConnection := &mockLdapConn{}
+		entry := ldap.Entry{
+			DN: "dn", Attributes: []*ldap.EntryAttribute{
+				{Name: "username", Values: []string{"roelgerrits"}},
+			}}
+		mockLdapConnection.setSearchResult(&ldap.SearchResult{Entries: []*ldap.Entry{&entry}})
+
+		Auth := &Auth{
+			server: &ServerConfig{
+				Attr:          AttributeMap{Username: "username"},
+				SearchBaseDNs: []string{"BaseDNHere"},
+				SearchTimeout: 10,
+			},
+			conn: mockLdapConnection,
+			log:  log.New("test-logger"),
+		}
+
+		_, err := Auth.searchForUser("roelgerrits", searchEverything)
+
+		So(err, ShouldBeNil)
+		So(mockLdapConnection.searchTimeLimit, ShouldEqual, 10)
+	})
+
+	Convey("When the same user is searched for concurrently", t, func() {
+		const callers = 10
+		entry := ldap.Entry{
+			DN: "dn", Attributes: []*ldap.EntryAttribute{
+				{Name: "username", Values: []string{"roelgerrits"}},
+				{Name: "memberof", Values: []string{"admins"}},
+			}}
+		conn := &blockingLdapConn{
+			result:  &ldap.SearchResult{Entries: []*ldap.Entry{&entry}},
+			started: make(chan struct{}, callers),
+			release: make(chan struct{}),
+		}
+
+		auth := &Auth{
+			server: &ServerConfig{
+				Host: "ldap.example.org",
+				Attr: AttributeMap{
+					Username: "username",
+					MemberOf: "memberof",
+				},
+				SearchBaseDNs: []string{"BaseDNHere"},
+			},
+			conn: conn,
+			log:  log.New("test-logger"),
+		}
+
+		results := make(chan *UserInfo, callers)
+		search := func() {
+			user, _ := auth.searchForUser("roelgerrits", searchEverything)
+			results <- user
+		}
+
+		go search()
+		<-conn.started
+		for i := 1; i < callers; i++ {
+			go search()
+		}
+		time.Sleep(50 * time.Millisecond)
+		close(conn.release)
+
+		for i := 0; i < callers; i++ {
+			user := <-results
+			So(user, ShouldNotBeNil)
+			So(user.Username, ShouldEqual, "roelgerrits")
+			So(user.MemberOf, ShouldResemble, []string{"admins"})
+		}
+
+		So(atomic.LoadInt32(&conn.searches), ShouldEqual, 1)
+	})
+}
+
+type blockingLdapConn struct {
+	mockLdapConn
+	result   *ldap.SearchResult
+	searches int32
+	started  chan struct{}
+	release  chan struct{}
+}
+
+func (c *blockingLdapConn) Search(sr *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	atomic.AddInt32(&c.searches, 1)
+	c.started <- struct{}{}
+	<-c.release
+	return c.result, nil
 }
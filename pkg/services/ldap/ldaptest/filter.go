@@ -0,0 +1,153 @@
+package ldaptest
+
+import (
+	"strings"
+
+	"golang.org/x/xerrors"
+	ber "gopkg.in/asn1-ber.v1"
+	LDAP "gopkg.in/ldap.v3"
+)
+
+// matchFilter checks if the entry matches the filter of a search request.
+// The values are compared case-insensitively, as the caseIgnore matching
+// rules of most directory attributes do, and the extensible matches with
+// a matching rule, like the Active Directory LDAP_MATCHING_RULE_IN_CHAIN,
+// match nothing
+func matchFilter(filter *ber.Packet, entry *LDAP.Entry) (bool, error) {
+	if filter.ClassType != ber.ClassContext {
+		return false, xerrors.Errorf("invalid filter class %d", filter.ClassType)
+	}
+
+	switch filter.Tag {
+	case LDAP.FilterAnd:
+		for _, child := range filter.Children {
+			matches, err := matchFilter(child, entry)
+			if err != nil || !matches {
+				return false, err
+			}
+		}
+		return true, nil
+
+	case LDAP.FilterOr:
+		for _, child := range filter.Children {
+			matches, err := matchFilter(child, entry)
+			if err != nil || matches {
+				return matches, err
+			}
+		}
+		return false, nil
+
+	case LDAP.FilterNot:
+		if len(filter.Children) != 1 {
+			return false, xerrors.New("invalid not filter")
+		}
+		matches, err := matchFilter(filter.Children[0], entry)
+		return !matches, err
+
+	case LDAP.FilterPresent:
+		return len(entryValues(entry, filter.Data.String())) > 0, nil
+
+	case LDAP.FilterEqualityMatch, LDAP.FilterApproxMatch, LDAP.FilterGreaterOrEqual, LDAP.FilterLessOrEqual:
+		if len(filter.Children) != 2 {
+			return false, xerrors.New("invalid attribute value assertion")
+		}
+		name, assertion := packetString(filter.Children[0]), strings.ToLower(packetString(filter.Children[1]))
+
+		for _, value := range entryValues(entry, name) {
+			value = strings.ToLower(value)
+			switch {
+			case filter.Tag == LDAP.FilterGreaterOrEqual && value >= assertion,
+				filter.Tag == LDAP.FilterLessOrEqual && value <= assertion,
+				value == assertion:
+				return true, nil
+			}
+		}
+		return false, nil
+
+	case LDAP.FilterSubstrings:
+		if len(filter.Children) != 2 {
+			return false, xerrors.New("invalid substrings filter")
+		}
+		for _, value := range entryValues(entry, packetString(filter.Children[0])) {
+			if matchSubstrings(filter.Children[1].Children, strings.ToLower(value)) {
+				return true, nil
+			}
+		}
+		return false, nil
+
+	case LDAP.FilterExtensibleMatch:
+		var rule, name, assertion string
+		for _, child := range filter.Children {
+			switch child.Tag {
+			case 1:
+				rule = child.Data.String()
+			case 2:
+				name = child.Data.String()
+			case 3:
+				assertion = child.Data.String()
+			}
+		}
+		if rule != "" || name == "" {
+			return false, nil
+		}
+		for _, value := range entryValues(entry, name) {
+			if strings.EqualFold(value, assertion) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	return false, xerrors.Errorf("unknown filter %d", filter.Tag)
+}
+
+// matchSubstrings checks if the value has the initial, any and final substrings, in order
+func matchSubstrings(substrings []*ber.Packet, value string) bool {
+	for _, substring := range substrings {
+		part := strings.ToLower(substring.Data.String())
+
+		switch substring.Tag {
+		case LDAP.FilterSubstringsInitial:
+			if !strings.HasPrefix(value, part) {
+				return false
+			}
+			value = value[len(part):]
+		case LDAP.FilterSubstringsAny:
+			index := strings.Index(value, part)
+			if index < 0 {
+				return false
+			}
+			value = value[index+len(part):]
+		case LDAP.FilterSubstringsFinal:
+			if !strings.HasSuffix(value, part) {
+				return false
+			}
+			value = ""
+		}
+	}
+	return true
+}
+
+// entryValues returns the values of the attribute, whatever the case of its name
+func entryValues(entry *LDAP.Entry, name string) []string {
+	values := []string{}
+	for _, attribute := range entry.Attributes {
+		if strings.EqualFold(attribute.Name, name) {
+			values = append(values, attribute.Values...)
+		}
+	}
+
+	if len(values) == 0 && strings.EqualFold(name, "objectClass") {
+		// Every entry has an objectClass, the (objectClass=*) filters find them all
+		return []string{"top"}
+	}
+	return values
+}
+
+// packetString is the string of an octet string packet, whatever its class
+func packetString(packet *ber.Packet) string {
+	if value, ok := packet.Value.(string); ok {
+		return value
+	}
+	return packet.Data.String()
+}
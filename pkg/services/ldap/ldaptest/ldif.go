@@ -0,0 +1,125 @@
+package ldaptest
+
+import (
+	"bufio"
+	"encoding/base64"
+	"strings"
+
+	"golang.org/x/xerrors"
+	LDAP "gopkg.in/ldap.v3"
+)
+
+// ParseLDIF reads the entries of the LDIF content records, the
+// change records like the ones with changetype aren't supported
+func ParseLDIF(ldif string) ([]*LDAP.Entry, error) {
+	entries := []*LDAP.Entry{}
+	var lines []string
+
+	flush := func() error {
+		if len(lines) == 0 {
+			return nil
+		}
+		entry, err := parseRecord(lines)
+		if err != nil {
+			return err
+		}
+		if entry != nil {
+			entries = append(entries, entry)
+		}
+		lines = nil
+		return nil
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(ldif))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		switch {
+		case strings.TrimSpace(line) == "":
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		case strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, " "):
+			// Folded line, continuing the previous one
+			if len(lines) == 0 {
+				return nil, xerrors.Errorf("LDIF continuation line without a record: %q", line)
+			}
+			lines[len(lines)-1] += line[1:]
+		default:
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// parseRecord reads the entry of the lines of a record, nil for the version record
+func parseRecord(lines []string) (*LDAP.Entry, error) {
+	var dn string
+	attributes := map[string][]string{}
+	names := []string{}
+
+	for _, line := range lines {
+		name, value, err := parseLine(line)
+		if err != nil {
+			return nil, err
+		}
+
+		switch strings.ToLower(name) {
+		case "version":
+			continue
+		case "dn":
+			dn = value
+			continue
+		case "changetype":
+			return nil, xerrors.Errorf("LDIF change records aren't supported: %q", dn)
+		}
+		if dn == "" {
+			return nil, xerrors.Errorf("LDIF record doesn't start with a dn: %q", line)
+		}
+
+		if _, ok := attributes[name]; !ok {
+			names = append(names, name)
+		}
+		attributes[name] = append(attributes[name], value)
+	}
+
+	if dn == "" {
+		return nil, nil
+	}
+
+	// Keep the attributes in the order of the record
+	entry := &LDAP.Entry{DN: dn}
+	for _, name := range names {
+		entry.Attributes = append(entry.Attributes, LDAP.NewEntryAttribute(name, attributes[name]))
+	}
+	return entry, nil
+}
+
+// parseLine reads the "name: value" or base64 "name:: value" line
+func parseLine(line string) (string, string, error) {
+	index := strings.Index(line, ":")
+	if index < 1 {
+		return "", "", xerrors.Errorf("invalid LDIF line %q", line)
+	}
+	name, value := line[:index], line[index+1:]
+
+	if strings.HasPrefix(value, ":") {
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value[1:]))
+		if err != nil {
+			return "", "", xerrors.Errorf("invalid base64 value of %q: %v", name, err)
+		}
+		return name, string(decoded), nil
+	}
+	if strings.HasPrefix(value, "<") {
+		return "", "", xerrors.Errorf("LDIF URL values aren't supported: %q", line)
+	}
+
+	return name, strings.TrimLeft(value, " "), nil
+}
@@ -0,0 +1,138 @@
+package ldaptest
+
+import (
+	"sort"
+	"strings"
+
+	ber "gopkg.in/asn1-ber.v1"
+	LDAP "gopkg.in/ldap.v3"
+)
+
+// message is the LDAP message of the response to the request of messageID
+func message(messageID int64, response *ber.Packet, controls []LDAP.Control) *ber.Packet {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "MessageID"))
+	packet.AppendChild(response)
+
+	if len(controls) > 0 {
+		controlsPacket := ber.Encode(ber.ClassContext, ber.TypeConstructed, 0, nil, "Controls")
+		for _, control := range controls {
+			controlsPacket.AppendChild(control.Encode())
+		}
+		packet.AppendChild(controlsPacket)
+	}
+	return packet
+}
+
+// result is the LDAPResult response of the tag
+func result(tag ber.Tag, resultCode uint16, diagnosticMessage string) *ber.Packet {
+	packet := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, LDAP.ApplicationMap[uint8(tag)])
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(resultCode), "Result Code"))
+	packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, diagnosticMessage, "Diagnostic Message"))
+	return packet
+}
+
+// searchEntry is the search result entry of the entry, with the attributes
+// of the request. memberOf is the computed memberOf of the entry, returned
+// when the request asks for it or for the operational attributes
+func searchEntry(entry *LDAP.Entry, memberOf []string, attributes []string, typesOnly bool) *ber.Packet {
+	all, operational := len(attributes) == 0, false
+	requested := map[string]bool{}
+	for _, attribute := range attributes {
+		switch attribute {
+		case "*":
+			all = true
+		case "+":
+			operational = true
+		default:
+			requested[strings.ToLower(attribute)] = true
+		}
+	}
+
+	entryAttributes := []*LDAP.EntryAttribute{}
+	for _, attribute := range entry.Attributes {
+		if all || requested[strings.ToLower(attribute.Name)] {
+			entryAttributes = append(entryAttributes, attribute)
+		}
+	}
+	if len(memberOf) > 0 && (operational || requested["memberof"]) {
+		entryAttributes = append(entryAttributes, LDAP.NewEntryAttribute("memberOf", memberOf))
+	}
+
+	packet := ber.Encode(ber.ClassApplication, ber.TypeConstructed, LDAP.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.DN, "Object Name"))
+
+	attributesPacket := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+	for _, attribute := range entryAttributes {
+		attributePacket := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+		attributePacket.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, attribute.Name, "Type"))
+		values := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		if !typesOnly {
+			for _, value := range attribute.Values {
+				values.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "Value"))
+			}
+		}
+		attributePacket.AppendChild(values)
+		attributesPacket.AppendChild(attributePacket)
+	}
+	packet.AppendChild(attributesPacket)
+
+	return packet
+}
+
+// normalizeDN is the DN with lower case attribute types and values and
+// without the spaces around its RDNs, the DN itself if it can't be parsed
+func normalizeDN(dn string) string {
+	parsed, err := LDAP.ParseDN(dn)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(dn))
+	}
+	return normalizeRDNs(parsed.RDNs)
+}
+
+// parentDN is the normalized DN of the parent of the entry of dn, "" for the top entries
+func parentDN(dn string) string {
+	parsed, err := LDAP.ParseDN(dn)
+	if err != nil || len(parsed.RDNs) < 2 {
+		return ""
+	}
+	return normalizeRDNs(parsed.RDNs[1:])
+}
+
+func normalizeRDNs(rdns []*LDAP.RelativeDN) string {
+	normalized := make([]string, 0, len(rdns))
+	for _, rdn := range rdns {
+		values := make([]string, 0, len(rdn.Attributes))
+		for _, attribute := range rdn.Attributes {
+			values = append(values, strings.ToLower(attribute.Type)+"="+escapeValue(strings.ToLower(attribute.Value)))
+		}
+		sort.Strings(values)
+		normalized = append(normalized, strings.Join(values, "+"))
+	}
+	return strings.Join(normalized, ",")
+}
+
+// escapeValue escapes the special characters of an RDN value
+func escapeValue(value string) string {
+	var escaped strings.Builder
+	for _, r := range value {
+		if strings.ContainsRune(`,+"\<>;=`, r) {
+			escaped.WriteRune('\\')
+		}
+		escaped.WriteRune(r)
+	}
+	return escaped.String()
+}
+
+// inScope checks if the normalized dn is in the scope of the normalized base
+func inScope(dn string, base string, scope int64) bool {
+	switch scope {
+	case LDAP.ScopeBaseObject:
+		return dn == base
+	case LDAP.ScopeSingleLevel:
+		return parentDN(dn) == base && dn != base
+	default:
+		return dn == base || base == "" || strings.HasSuffix(dn, ","+base)
+	}
+}
@@ -0,0 +1,388 @@
+// Package ldaptest provides an in-process LDAP server for the tests of the
+// LDAP login, sync and multildap code, so they can run against the entries
+// of LDIF fixtures instead of hand-written IConnection mocks
+package ldaptest
+
+import (
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	ber "gopkg.in/asn1-ber.v1"
+	LDAP "gopkg.in/ldap.v3"
+)
+
+// VendorName is the vendorName of the rootDSE of the server
+const VendorName = "Grafana ldaptest"
+
+// Server is an LDAP server listening on the loopback interface. It serves
+// the simple binds, checked against the plain text userPassword of the
+// entries, and the searches, with the paged results control. The memberOf
+// of the entries which don't set it is computed from the member and
+// uniqueMember of the groups, like the memberof overlay of OpenLDAP does.
+// The other operations are refused as unwillingToPerform
+type Server struct {
+	listener net.Listener
+	mutex    sync.RWMutex
+	entries  []*LDAP.Entry
+	conns    map[net.Conn]struct{}
+	wg       sync.WaitGroup
+}
+
+// NewServer starts a server serving the entries of the LDIF content
+func NewServer(ldif string) (*Server, error) {
+	entries, err := ParseLDIF(ldif)
+	if err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	server := &Server{
+		listener: listener,
+		entries:  entries,
+		conns:    map[net.Conn]struct{}{},
+	}
+
+	server.wg.Add(1)
+	go server.accept()
+
+	return server, nil
+}
+
+// NewServerFromFiles starts a server serving the entries of the LDIF files
+func NewServerFromFiles(paths ...string) (*Server, error) {
+	ldif := []string{}
+	for _, path := range paths {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		ldif = append(ldif, string(content))
+	}
+
+	return NewServer(strings.Join(ldif, "\n\n"))
+}
+
+// Host is the host of the server, for the host of the LDAP server config
+func (server *Server) Host() string {
+	return server.listener.Addr().(*net.TCPAddr).IP.String()
+}
+
+// Port is the port of the server, for the port of the LDAP server config
+func (server *Server) Port() int {
+	return server.listener.Addr().(*net.TCPAddr).Port
+}
+
+// Address is the host:port of the server
+func (server *Server) Address() string {
+	return server.listener.Addr().String()
+}
+
+// AddEntries adds the entries of the LDIF content to the server
+func (server *Server) AddEntries(ldif string) error {
+	entries, err := ParseLDIF(ldif)
+	if err != nil {
+		return err
+	}
+
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	server.entries = append(server.entries, entries...)
+	return nil
+}
+
+// Close stops the server and closes its connections
+func (server *Server) Close() error {
+	err := server.listener.Close()
+
+	server.mutex.Lock()
+	for conn := range server.conns {
+		conn.Close()
+	}
+	server.mutex.Unlock()
+
+	server.wg.Wait()
+	return err
+}
+
+func (server *Server) accept() {
+	defer server.wg.Done()
+
+	for {
+		conn, err := server.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		server.mutex.Lock()
+		server.conns[conn] = struct{}{}
+		server.mutex.Unlock()
+
+		server.wg.Add(1)
+		go server.serve(conn)
+	}
+}
+
+// serve answers the requests of the connection until it's unbound or closed
+func (server *Server) serve(conn net.Conn) {
+	defer server.wg.Done()
+	defer func() {
+		server.mutex.Lock()
+		delete(server.conns, conn)
+		server.mutex.Unlock()
+		conn.Close()
+	}()
+
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+
+		messageID, ok := packet.Children[0].Value.(int64)
+		if !ok {
+			return
+		}
+		request := packet.Children[1]
+
+		var responses []*ber.Packet
+		var controls []LDAP.Control
+		switch request.Tag {
+		case LDAP.ApplicationUnbindRequest:
+			return
+		case LDAP.ApplicationAbandonRequest:
+			continue
+		case LDAP.ApplicationBindRequest:
+			responses = []*ber.Packet{server.bind(request)}
+		case LDAP.ApplicationSearchRequest:
+			var requestControls *ber.Packet
+			if len(packet.Children) > 2 {
+				requestControls = packet.Children[2]
+			}
+			responses, controls = server.search(request, requestControls)
+		case LDAP.ApplicationExtendedRequest:
+			responses = []*ber.Packet{result(LDAP.ApplicationExtendedResponse, LDAP.LDAPResultProtocolError, "unsupported extended operation")}
+		default:
+			// The responses of the add, modify, delete, modify DN and compare requests follow their tag
+			responses = []*ber.Packet{result(request.Tag+1, LDAP.LDAPResultUnwillingToPerform, "the ldaptest server is read-only")}
+		}
+
+		for i, response := range responses {
+			// The controls are the ones of the last response, the search result done
+			var responseControls []LDAP.Control
+			if i == len(responses)-1 {
+				responseControls = controls
+			}
+			if _, err := conn.Write(message(messageID, response, responseControls).Bytes()); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// bind checks the simple bind of the request against the userPassword of its entry
+func (server *Server) bind(request *ber.Packet) *ber.Packet {
+	if len(request.Children) < 3 {
+		return result(LDAP.ApplicationBindResponse, LDAP.LDAPResultProtocolError, "invalid bind request")
+	}
+	if request.Children[2].Tag != 0 {
+		return result(LDAP.ApplicationBindResponse, LDAP.LDAPResultAuthMethodNotSupported, "only the simple binds are supported")
+	}
+
+	dn, password := packetString(request.Children[1]), request.Children[2].Data.String()
+	switch {
+	case dn == "" && password == "":
+		return result(LDAP.ApplicationBindResponse, LDAP.LDAPResultSuccess, "")
+	case password == "":
+		return result(LDAP.ApplicationBindResponse, LDAP.LDAPResultUnwillingToPerform, "unauthenticated bind not allowed")
+	}
+
+	server.mutex.RLock()
+	defer server.mutex.RUnlock()
+
+	if entry := server.entry(dn); entry != nil {
+		for _, userPassword := range entryValues(entry, "userPassword") {
+			if userPassword == password {
+				return result(LDAP.ApplicationBindResponse, LDAP.LDAPResultSuccess, "")
+			}
+		}
+	}
+	return result(LDAP.ApplicationBindResponse, LDAP.LDAPResultInvalidCredentials, "")
+}
+
+// search returns the entries matching the request, and the search result
+// done with its controls
+func (server *Server) search(request *ber.Packet, controls *ber.Packet) ([]*ber.Packet, []LDAP.Control) {
+	if len(request.Children) < 8 {
+		return []*ber.Packet{result(LDAP.ApplicationSearchResultDone, LDAP.LDAPResultProtocolError, "invalid search request")}, nil
+	}
+
+	baseDN := packetString(request.Children[0])
+	scope, _ := request.Children[1].Value.(int64)
+	sizeLimit, _ := request.Children[3].Value.(int64)
+	typesOnly, _ := request.Children[5].Value.(bool)
+	filter := request.Children[6]
+	attributes := []string{}
+	for _, attribute := range request.Children[7].Children {
+		attributes = append(attributes, packetString(attribute))
+	}
+
+	server.mutex.RLock()
+	defer server.mutex.RUnlock()
+
+	if baseDN == "" && scope == LDAP.ScopeBaseObject {
+		return []*ber.Packet{
+			searchEntry(server.rootDSE(), nil, attributes, typesOnly),
+			result(LDAP.ApplicationSearchResultDone, LDAP.LDAPResultSuccess, ""),
+		}, nil
+	}
+
+	base := normalizeDN(baseDN)
+	if !server.exists(base) {
+		return []*ber.Packet{result(LDAP.ApplicationSearchResultDone, LDAP.LDAPResultNoSuchObject, "")}, nil
+	}
+
+	matches := []*match{}
+	for _, entry := range server.entries {
+		if !inScope(normalizeDN(entry.DN), base, scope) {
+			continue
+		}
+		found := server.withMemberOf(entry)
+
+		ok, err := matchFilter(filter, found.filtered)
+		if err != nil {
+			return []*ber.Packet{result(LDAP.ApplicationSearchResultDone, LDAP.LDAPResultProtocolError, err.Error())}, nil
+		}
+		if ok {
+			matches = append(matches, found)
+		}
+	}
+
+	var paging *LDAP.ControlPaging
+	if controls != nil {
+		for _, child := range controls.Children {
+			if control, err := LDAP.DecodeControl(child); err == nil {
+				if control, ok := control.(*LDAP.ControlPaging); ok {
+					paging = control
+				}
+			}
+		}
+	}
+
+	var cookie []byte
+	if paging != nil {
+		offset, _ := strconv.Atoi(string(paging.Cookie))
+		if offset > len(matches) {
+			offset = len(matches)
+		}
+		matches = matches[offset:]
+		if paging.PagingSize > 0 && int(paging.PagingSize) < len(matches) {
+			matches = matches[:paging.PagingSize]
+			cookie = []byte(strconv.Itoa(offset + int(paging.PagingSize)))
+		}
+	}
+
+	responses := []*ber.Packet{}
+	resultCode := uint16(LDAP.LDAPResultSuccess)
+	for i, found := range matches {
+		if sizeLimit > 0 && int64(i) >= sizeLimit {
+			resultCode = LDAP.LDAPResultSizeLimitExceeded
+			break
+		}
+		responses = append(responses, searchEntry(found.entry, found.memberOf, attributes, typesOnly))
+	}
+
+	responses = append(responses, result(LDAP.ApplicationSearchResultDone, resultCode, ""))
+	if paging == nil {
+		return responses, nil
+	}
+
+	response := LDAP.NewControlPaging(paging.PagingSize)
+	response.SetCookie(cookie)
+	return responses, []LDAP.Control{response}
+}
+
+// entry returns the entry of the DN, nil if there is none
+func (server *Server) entry(dn string) *LDAP.Entry {
+	normalized := normalizeDN(dn)
+	for _, entry := range server.entries {
+		if normalizeDN(entry.DN) == normalized {
+			return entry
+		}
+	}
+	return nil
+}
+
+// match is an entry found by a search
+type match struct {
+	entry *LDAP.Entry
+
+	// memberOf is the computed memberOf of the entry, an operational
+	// attribute only returned when the search asks for it
+	memberOf []string
+
+	// filtered is the entry with its computed memberOf, for the filters
+	filtered *LDAP.Entry
+}
+
+// exists checks if there is an entry of the normalized DN, or under it,
+// the fixtures don't have to define all the containers of their entries
+func (server *Server) exists(dn string) bool {
+	for _, entry := range server.entries {
+		if inScope(normalizeDN(entry.DN), dn, LDAP.ScopeWholeSubtree) {
+			return true
+		}
+	}
+	return false
+}
+
+// withMemberOf computes the memberOf of the entry from the groups listing
+// it as their member, unless the entry sets its memberOf itself
+func (server *Server) withMemberOf(entry *LDAP.Entry) *match {
+	found := &match{entry: entry, filtered: entry}
+	if len(entryValues(entry, "memberOf")) > 0 {
+		return found
+	}
+
+	dn := normalizeDN(entry.DN)
+	for _, group := range server.entries {
+		for _, member := range append(entryValues(group, "member"), entryValues(group, "uniqueMember")...) {
+			if normalizeDN(member) == dn {
+				found.memberOf = append(found.memberOf, group.DN)
+				break
+			}
+		}
+	}
+	if len(found.memberOf) > 0 {
+		filtered := *entry
+		filtered.Attributes = append(append([]*LDAP.EntryAttribute(nil), entry.Attributes...),
+			LDAP.NewEntryAttribute("memberOf", found.memberOf))
+		found.filtered = &filtered
+	}
+	return found
+}
+
+// rootDSE is the root entry of the server, listing the naming contexts of the entries
+func (server *Server) rootDSE() *LDAP.Entry {
+	namingContexts := []string{}
+	for _, entry := range server.entries {
+		if server.entry(parentDN(entry.DN)) == nil {
+			namingContexts = append(namingContexts, entry.DN)
+		}
+	}
+
+	return LDAP.NewEntry("", map[string][]string{
+		"objectClass":          {"top"},
+		"namingContexts":       namingContexts,
+		"supportedLDAPVersion": {"3"},
+		"supportedControl":     {LDAP.ControlTypePaging},
+		"vendorName":           {VendorName},
+	})
+}
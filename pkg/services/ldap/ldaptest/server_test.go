@@ -0,0 +1,125 @@
+package ldaptest
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	LDAP "gopkg.in/ldap.v3"
+)
+
+const fixture = `
+version: 1
+
+# Folded lines and base64 values
+dn: cn=ldap-admin,ou=users,dc=grafana,dc=org
+objectClass: inetOrgPerson
+cn: ldap-admin
+mail: ldap-admin@grafana.c
+ om
+sn:: R3JhZmFuYQ==
+userPassword: grafana
+
+dn: cn=ldap-editor,ou=users,dc=grafana,dc=org
+objectClass: inetOrgPerson
+cn: ldap-editor
+mail: ldap-editor@grafana.com
+userPassword: grafana
+
+dn: cn=admins,ou=groups,dc=grafana,dc=org
+objectClass: groupOfNames
+cn: admins
+member: CN=ldap-admin,OU=users,DC=grafana,DC=org
+`
+
+func TestServer(t *testing.T) {
+	Convey("ParseLDIF", t, func() {
+		entries, err := ParseLDIF(fixture)
+		So(err, ShouldBeNil)
+		So(entries, ShouldHaveLength, 3)
+		So(entries[0].DN, ShouldEqual, "cn=ldap-admin,ou=users,dc=grafana,dc=org")
+		So(entries[0].GetAttributeValue("mail"), ShouldEqual, "ldap-admin@grafana.com")
+		So(entries[0].GetAttributeValue("sn"), ShouldEqual, "Grafana")
+
+		_, err = ParseLDIF("dn: cn=admins,dc=grafana,dc=org\nchangetype: delete\n")
+		So(err, ShouldNotBeNil)
+
+		_, err = ParseLDIF("cn: admins\n")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Server", t, func() {
+		server, err := NewServer(fixture)
+		So(err, ShouldBeNil)
+		defer server.Close()
+
+		conn, err := LDAP.Dial("tcp", server.Address())
+		So(err, ShouldBeNil)
+		defer conn.Close()
+
+		search := func(baseDN string, scope int, filter string, attributes ...string) []*LDAP.Entry {
+			result, err := conn.Search(LDAP.NewSearchRequest(baseDN, scope, LDAP.NeverDerefAliases, 0, 0, false, filter, attributes, nil))
+			So(err, ShouldBeNil)
+			return result.Entries
+		}
+
+		Convey("Should check the binds against the userPassword", func() {
+			So(conn.Bind("cn=ldap-admin,ou=users,dc=grafana,dc=org", "grafana"), ShouldBeNil)
+
+			err := conn.Bind("cn=ldap-admin,ou=users,dc=grafana,dc=org", "wrong")
+			So(LDAP.IsErrorWithCode(err, LDAP.LDAPResultInvalidCredentials), ShouldBeTrue)
+
+			err = conn.Bind("cn=unknown,ou=users,dc=grafana,dc=org", "grafana")
+			So(LDAP.IsErrorWithCode(err, LDAP.LDAPResultInvalidCredentials), ShouldBeTrue)
+
+			err = conn.UnauthenticatedBind("cn=ldap-admin,ou=users,dc=grafana,dc=org")
+			So(LDAP.IsErrorWithCode(err, LDAP.LDAPResultUnwillingToPerform), ShouldBeTrue)
+		})
+
+		Convey("Should search with the filters", func() {
+			entries := search("dc=grafana,dc=org", LDAP.ScopeWholeSubtree, "(&(objectClass=inetOrgPerson)(|(cn=LDAP-EDITOR)(mail=*admin@*.com)))", "cn")
+			So(entries, ShouldHaveLength, 2)
+			So(entries[0].GetAttributeValue("cn"), ShouldEqual, "ldap-admin")
+			So(entries[0].GetAttributeValue("mail"), ShouldEqual, "")
+
+			So(search("dc=grafana,dc=org", LDAP.ScopeWholeSubtree, "(!(objectClass=inetOrgPerson))"), ShouldHaveLength, 1)
+			So(search("dc=grafana,dc=org", LDAP.ScopeWholeSubtree, "(sn=*)"), ShouldHaveLength, 1)
+			So(search("dc=grafana,dc=org", LDAP.ScopeSingleLevel, "(objectClass=*)"), ShouldBeEmpty)
+			So(search("ou=users,dc=grafana,dc=org", LDAP.ScopeSingleLevel, "(objectClass=*)"), ShouldHaveLength, 2)
+			So(search("cn=admins,ou=groups,dc=grafana,dc=org", LDAP.ScopeBaseObject, "(objectClass=*)"), ShouldHaveLength, 1)
+
+			_, err := conn.Search(LDAP.NewSearchRequest("dc=example,dc=org", LDAP.ScopeWholeSubtree, LDAP.NeverDerefAliases, 0, 0, false, "(cn=*)", nil, nil))
+			So(LDAP.IsErrorWithCode(err, LDAP.LDAPResultNoSuchObject), ShouldBeTrue)
+		})
+
+		Convey("Should compute the memberOf from the groups", func() {
+			entries := search("dc=grafana,dc=org", LDAP.ScopeWholeSubtree, "(cn=ldap-admin)")
+			So(entries[0].GetAttributeValues("memberOf"), ShouldBeEmpty)
+
+			entries = search("dc=grafana,dc=org", LDAP.ScopeWholeSubtree, "(memberOf=cn=admins,ou=groups,dc=grafana,dc=org)", "memberOf")
+			So(entries, ShouldHaveLength, 1)
+			So(entries[0].GetAttributeValues("memberOf"), ShouldResemble, []string{"cn=admins,ou=groups,dc=grafana,dc=org"})
+		})
+
+		Convey("Should page the searches", func() {
+			result, err := conn.SearchWithPaging(LDAP.NewSearchRequest("dc=grafana,dc=org", LDAP.ScopeWholeSubtree, LDAP.NeverDerefAliases, 0, 0, false, "(objectClass=*)", nil, nil), 1)
+			So(err, ShouldBeNil)
+			So(result.Entries, ShouldHaveLength, 3)
+		})
+
+		Convey("Should return the rootDSE", func() {
+			entries := search("", LDAP.ScopeBaseObject, "(objectClass=*)", "vendorName")
+			So(entries, ShouldHaveLength, 1)
+			So(entries[0].GetAttributeValue("vendorName"), ShouldEqual, VendorName)
+		})
+
+		Convey("Should refuse the writes", func() {
+			err := conn.Del(LDAP.NewDelRequest("cn=admins,ou=groups,dc=grafana,dc=org", nil))
+			So(LDAP.IsErrorWithCode(err, LDAP.LDAPResultUnwillingToPerform), ShouldBeTrue)
+		})
+
+		Convey("Should serve the added entries", func() {
+			So(server.AddEntries("dn: cn=ldap-viewer,ou=users,dc=grafana,dc=org\ncn: ldap-viewer\n"), ShouldBeNil)
+			So(search("dc=grafana,dc=org", LDAP.ScopeWholeSubtree, "(cn=ldap-viewer)"), ShouldHaveLength, 1)
+		})
+	})
+}
@@ -0,0 +1,71 @@
+package ldap
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap/ldaptest"
+)
+
+func TestLdaptestServer(t *testing.T) {
+	Convey("Against the ldaptest server", t, func() {
+		server, err := ldaptest.NewServerFromFiles("testdata/grafana.ldif")
+		So(err, ShouldBeNil)
+		defer server.Close()
+
+		defer dialServers()()
+
+		auth := &Auth{
+			server: &ServerConfig{
+				Host:          server.Host(),
+				Port:          server.Port(),
+				BindDN:        "cn=ldap-admin,ou=users,dc=grafana,dc=org",
+				BindPassword:  "grafana",
+				SearchFilter:  "(cn=%s)",
+				SearchBaseDNs: []string{"dc=grafana,dc=org"},
+				Attr: AttributeMap{
+					Username: "cn",
+					Name:     "givenName",
+					Surname:  "sn",
+					Email:    "mail",
+					MemberOf: "memberOf",
+				},
+				Groups: []*GroupToOrgRole{
+					{GroupDN: "cn=editors,ou=groups,dc=grafana,dc=org", OrgId: 1, OrgRole: models.ROLE_EDITOR},
+				},
+			},
+			log: log.New("test-logger"),
+		}
+
+		Convey("Should authenticate the user with its groups", func() {
+			user, err := auth.Authenticate(&models.LoginUserQuery{Username: "ldap-editor", Password: "grafana"})
+			So(err, ShouldBeNil)
+			So(user.DN, ShouldEqual, "cn=ldap-editor,ou=users,dc=grafana,dc=org")
+			So(user.FirstName, ShouldEqual, "Editor")
+			So(user.Email, ShouldEqual, "ldap-editor@grafana.com")
+			So(user.MemberOf, ShouldResemble, []string{"cn=editors,ou=groups,dc=grafana,dc=org"})
+		})
+
+		Convey("Should refuse the wrong password", func() {
+			_, err := auth.Authenticate(&models.LoginUserQuery{Username: "ldap-editor", Password: "wrong"})
+			So(err, ShouldEqual, ErrInvalidCredentials)
+		})
+
+		Convey("Should refuse the unknown users", func() {
+			_, err := auth.Authenticate(&models.LoginUserQuery{Username: "ldap-unknown", Password: "grafana"})
+			So(err, ShouldEqual, ErrCouldNotFindUser)
+		})
+
+		Convey("Should list the users", func() {
+			auth.server.SearchFilter = "(&(objectClass=inetOrgPerson)(cn=%s))"
+
+			users, err := auth.Users()
+			So(err, ShouldBeNil)
+			So(users, ShouldHaveLength, 3)
+			So(users[0].MemberOf, ShouldHaveLength, 2)
+		})
+	})
+}
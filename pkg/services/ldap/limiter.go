@@ -0,0 +1,110 @@
+package ldap
+
+import (
+	"sync"
+	"time"
+
+	LDAP "gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/infra/metrics"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+var (
+	limiter      *operationLimiter
+	limiterMutex sync.Mutex
+)
+
+// operationLimiter is a semaphore limiting how many
+// binds and searches run against the directories at once
+type operationLimiter struct {
+	slots chan struct{}
+}
+
+func newOperationLimiter(size int) *operationLimiter {
+	return &operationLimiter{
+		slots: make(chan struct{}, size),
+	}
+}
+
+// acquire waits for a free slot, the returned function releases it
+func (limiter *operationLimiter) acquire() func() {
+	start := time.Now()
+	limiter.slots <- struct{}{}
+
+	elapsed := time.Since(start)
+	metrics.M_Ldap_Operation_Queue_Wait.Observe(float64(elapsed.Nanoseconds() / int64(time.Millisecond)))
+
+	return func() {
+		<-limiter.slots
+	}
+}
+
+// getLimiter returns the limiter sized by the max_concurrent_operations
+// setting, or nil if the number of operations is not limited
+func getLimiter() *operationLimiter {
+	if setting.LdapMaxConcurrentOperations <= 0 {
+		return nil
+	}
+
+	limiterMutex.Lock()
+	defer limiterMutex.Unlock()
+
+	if limiter == nil {
+		limiter = newOperationLimiter(setting.LdapMaxConcurrentOperations)
+	}
+
+	return limiter
+}
+
+// limitedConnection is a connection whose binds and searches
+// wait for a slot of the limiter before being sent
+type limitedConnection struct {
+	IConnection
+	limiter *operationLimiter
+}
+
+// limitConnection wraps the connection with the limiter, if any
+func limitConnection(conn IConnection) IConnection {
+	limiter := getLimiter()
+	if limiter == nil {
+		return conn
+	}
+
+	return &limitedConnection{
+		IConnection: conn,
+		limiter:     limiter,
+	}
+}
+
+func (conn *limitedConnection) Bind(username, password string) error {
+	release := conn.limiter.acquire()
+	defer release()
+
+	return conn.IConnection.Bind(username, password)
+}
+
+func (conn *limitedConnection) SimpleBind(request *LDAP.SimpleBindRequest) (*LDAP.SimpleBindResult, error) {
+	release := conn.limiter.acquire()
+	defer release()
+
+	return conn.IConnection.SimpleBind(request)
+}
+
+func (conn *limitedConnection) UnauthenticatedBind(username string) error {
+	release := conn.limiter.acquire()
+	defer release()
+
+	return conn.IConnection.UnauthenticatedBind(username)
+}
+
+func (conn *limitedConnection) Search(request *LDAP.SearchRequest) (*LDAP.SearchResult, error) {
+	release := conn.limiter.acquire()
+	defer release()
+
+	return conn.IConnection.Search(request)
+}
+
+func (conn *limitedConnection) SearchStream(request *LDAP.SearchRequest, pagingSize uint32, handle EntryHandler) error {
+	return streamSearch(conn, request, pagingSize, handle)
+}
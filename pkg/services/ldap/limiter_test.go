@@ -0,0 +1,54 @@
+package ldap
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestOperationLimiter(t *testing.T) {
+	Convey("Operation limiter", t, func() {
+		Convey("Should not run more operations than the limit at once", func() {
+			limiter := newOperationLimiter(2)
+
+			var mutex sync.Mutex
+			running, maxRunning := 0, 0
+
+			conn := &limitedConnection{
+				IConnection: &mockLdapConn{
+					bindProvider: func(username, password string) error {
+						mutex.Lock()
+						running++
+						if running > maxRunning {
+							maxRunning = running
+						}
+						mutex.Unlock()
+
+						time.Sleep(5 * time.Millisecond)
+
+						mutex.Lock()
+						running--
+						mutex.Unlock()
+						return nil
+					},
+				},
+				limiter: limiter,
+			}
+
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					conn.Bind("user", "pwd")
+				}()
+			}
+			wg.Wait()
+
+			So(maxRunning, ShouldBeLessThanOrEqualTo, 2)
+			So(len(limiter.slots), ShouldEqual, 0)
+		})
+	})
+}
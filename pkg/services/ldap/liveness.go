@@ -0,0 +1,51 @@
+package ldap
+
+import (
+	"context"
+	"time"
+)
+
+// probeLiveness periodically checks the active servers until ctx is done
+func (service *LDAPService) probeLiveness(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	unreachable := map[string]bool{}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			service.probeServers(unreachable)
+		}
+	}
+}
+
+// probeServers checks the active servers once, logging the servers which
+// became unreachable or recovered since the previous check
+func (service *LDAPService) probeServers(unreachable map[string]bool) {
+	config, err := GetConfig()
+	if err != nil || config == nil {
+		return
+	}
+
+	for _, server := range config.Servers {
+		if !IsActive(server) {
+			continue
+		}
+
+		key := ServerKey(server)
+		if err := checkServer(server); err != nil {
+			if !unreachable[key] {
+				service.log.Warn("LDAP server is unreachable", "server", key, "error", err)
+			}
+			unreachable[key] = true
+			continue
+		}
+
+		if unreachable[key] {
+			service.log.Info("LDAP server is reachable again", "server", key)
+			delete(unreachable, key)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package ldap
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+func TestLivenessProbe(t *testing.T) {
+	Convey("probeServers", t, func() {
+		setting.LdapEnabled = true
+		config = &Config{
+			Servers: []*ServerConfig{{Host: "first"}, {Host: "second"}},
+		}
+		down := map[string]bool{"first": true}
+		originalCheckServer := checkServer
+		checkServer = func(server *ServerConfig) error {
+			if down[server.Host] {
+				return errors.New("connection timed out")
+			}
+			return nil
+		}
+		defer func() {
+			setting.LdapEnabled = false
+			config = nil
+			checkServer = originalCheckServer
+		}()
+
+		service := &LDAPService{log: log.New("test-logger")}
+		unreachable := map[string]bool{}
+
+		Convey("Should remember the unreachable servers", func() {
+			service.probeServers(unreachable)
+
+			So(unreachable, ShouldResemble, map[string]bool{"first:0": true})
+		})
+
+		Convey("Should forget the servers which recovered", func() {
+			service.probeServers(unreachable)
+			down["first"] = false
+			service.probeServers(unreachable)
+
+			So(unreachable, ShouldBeEmpty)
+		})
+	})
+}
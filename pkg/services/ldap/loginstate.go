@@ -0,0 +1,65 @@
+package ldap
+
+import (
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	models "github.com/grafana/grafana/pkg/models"
+)
+
+// loginStateTTL is how long the saved login state is cached, the
+// other Grafana instances follow a toggle within that time
+const loginStateTTL = 10 * time.Second
+
+// loginState caches the login state saved in the database
+var loginState = struct {
+	sync.Mutex
+	enabled bool
+	readAt  time.Time
+}{enabled: true}
+
+// IsLoginEnabled checks if the users can log in with LDAP: LDAP is
+// enabled and the logins weren't turned off through the admin API
+func IsLoginEnabled() bool {
+	if !IsEnabled() {
+		return false
+	}
+
+	loginState.Lock()
+	defer loginState.Unlock()
+
+	if now().Sub(loginState.readAt) < loginStateTTL {
+		return loginState.enabled
+	}
+
+	query := &models.GetLdapLoginStateQuery{}
+	switch err := bus.Dispatch(query); err {
+	case nil:
+		loginState.enabled = query.Result.Enabled
+	case models.ErrLdapLoginStateNotFound:
+		loginState.enabled = true
+	default:
+		// keep the last known state, the database may be having the outage too
+		logger.Warn("Failed to read the LDAP login state, keeping the last one", "enabled", loginState.enabled, "error", err)
+	}
+	loginState.readAt = now()
+
+	return loginState.enabled
+}
+
+// SetLoginEnabled turns the LDAP logins on or off without a restart,
+// the state is saved in the database so it's kept across restarts
+func SetLoginEnabled(enabled bool, userID int64) error {
+	if err := bus.Dispatch(&models.SetLdapLoginStateCommand{Enabled: enabled, UserId: userID}); err != nil {
+		return err
+	}
+
+	loginState.Lock()
+	loginState.enabled = enabled
+	loginState.readAt = now()
+	loginState.Unlock()
+
+	logger.Info("LDAP logins toggled", "enabled", enabled, "userId", userID)
+	return nil
+}
@@ -0,0 +1,83 @@
+package ldap
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/grafana/grafana/pkg/bus"
+	models "github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+func TestLoginState(t *testing.T) {
+	Convey("IsLoginEnabled", t, func() {
+		setting.LdapEnabled = true
+		current := time.Now()
+		now = func() time.Time { return current }
+		loginState.enabled, loginState.readAt = true, time.Time{}
+		defer func() {
+			setting.LdapEnabled = false
+			now = time.Now
+			loginState.enabled, loginState.readAt = true, time.Time{}
+			bus.ClearBusHandlers()
+		}()
+
+		reads := 0
+		var saved *models.LdapLoginState
+		var readErr error
+		bus.AddHandler("test", func(query *models.GetLdapLoginStateQuery) error {
+			reads++
+			if readErr != nil {
+				return readErr
+			}
+			if saved == nil {
+				return models.ErrLdapLoginStateNotFound
+			}
+			query.Result = saved
+			return nil
+		})
+		bus.AddHandler("test", func(cmd *models.SetLdapLoginStateCommand) error {
+			saved = &models.LdapLoginState{Enabled: cmd.Enabled, UpdatedBy: cmd.UserId}
+			return nil
+		})
+
+		Convey("Should be on if the state was never saved", func() {
+			So(IsLoginEnabled(), ShouldBeTrue)
+		})
+
+		Convey("Should be off if LDAP is disabled", func() {
+			setting.LdapEnabled = false
+			So(IsLoginEnabled(), ShouldBeFalse)
+		})
+
+		Convey("Should follow the toggle at once", func() {
+			So(SetLoginEnabled(false, 1), ShouldBeNil)
+			So(saved.Enabled, ShouldBeFalse)
+			So(IsLoginEnabled(), ShouldBeFalse)
+			So(reads, ShouldEqual, 0)
+		})
+
+		Convey("Should read the saved state again once cached for the TTL", func() {
+			So(IsLoginEnabled(), ShouldBeTrue)
+			saved = &models.LdapLoginState{Enabled: false}
+
+			So(IsLoginEnabled(), ShouldBeTrue)
+			So(reads, ShouldEqual, 1)
+
+			current = current.Add(loginStateTTL)
+			So(IsLoginEnabled(), ShouldBeFalse)
+			So(reads, ShouldEqual, 2)
+		})
+
+		Convey("Should keep the last state if it can't be read", func() {
+			So(SetLoginEnabled(false, 1), ShouldBeNil)
+			readErr = errors.New("database is down")
+
+			current = current.Add(loginStateTTL)
+			So(IsLoginEnabled(), ShouldBeFalse)
+		})
+	})
+}
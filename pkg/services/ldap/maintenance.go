@@ -0,0 +1,48 @@
+package ldap
+
+import (
+	"fmt"
+	"sync"
+)
+
+// maintenance holds the keys of the servers put in maintenance mode at
+// runtime, it's kept across config reloads but not across restarts
+var maintenance = map[string]bool{}
+var maintenanceMutex = &sync.RWMutex{}
+
+// ServerKey identifies the server across config reloads
+func ServerKey(server *ServerConfig) string {
+	return fmt.Sprintf("%s:%d", server.Host, server.Port)
+}
+
+// SetMaintenance puts the server in maintenance mode or takes it out of it
+func SetMaintenance(key string, enabled bool) {
+	maintenanceMutex.Lock()
+	defer maintenanceMutex.Unlock()
+
+	if enabled {
+		maintenance[key] = true
+	} else {
+		delete(maintenance, key)
+	}
+
+	logger.Info("LDAP server maintenance mode changed", "server", key, "maintenance", enabled)
+}
+
+// InMaintenance checks if the server is in maintenance mode
+func InMaintenance(server *ServerConfig) bool {
+	maintenanceMutex.RLock()
+	defer maintenanceMutex.RUnlock()
+
+	return maintenance[ServerKey(server)]
+}
+
+// IsActive checks if the server should be queried, i.e.
+// it's neither disabled in the config nor in maintenance mode
+func IsActive(server *ServerConfig) bool {
+	if server.Enabled != nil && !*server.Enabled {
+		return false
+	}
+
+	return !InMaintenance(server)
+}
@@ -0,0 +1,139 @@
+package ldap
+
+import (
+	"strings"
+
+	"golang.org/x/xerrors"
+	LDAP "gopkg.in/ldap.v3"
+)
+
+// maxManagerChainDepth caps manager_chain_depth, the chains are
+// looked up one entry at a time
+const maxManagerChainDepth = 10
+
+// The names of the stored attributes of the manager chain
+const (
+	managerLoginAttribute = "manager_login"
+	managerChainAttribute = "manager_chain"
+)
+
+// validateManagerChain checks the depth of the manager chain and that
+// the stored_attributes don't use the names of the manager attributes
+func validateManagerChain(server *ServerConfig) error {
+	if server.ManagerAttribute == "" {
+		return nil
+	}
+	if server.ManagerChainDepth < 0 || server.ManagerChainDepth > maxManagerChainDepth {
+		return xerrors.Errorf("manager_chain_depth must be between 1 and %d", maxManagerChainDepth)
+	}
+	for _, name := range []string{managerLoginAttribute, managerChainAttribute} {
+		if _, ok := server.StoredAttributes[name]; ok {
+			return xerrors.Errorf("stored attribute %q is reserved for the manager chain", name)
+		}
+	}
+	return nil
+}
+
+// managerChainDepth is the number of managers to resolve, 1 by default
+func (server *ServerConfig) managerChainDepth() int {
+	if server.ManagerChainDepth == 0 {
+		return 1
+	}
+	return server.ManagerChainDepth
+}
+
+// managerEntry is the login and the manager DN of an entry of the chain
+type managerEntry struct {
+	login     string
+	managerDN string
+}
+
+// managerResolver resolves the manager chains of the users, with the
+// entries already read and the ones it looked up by DN
+type managerResolver struct {
+	auth    *Auth
+	entries map[string]*managerEntry
+}
+
+func (auth *Auth) newManagerResolver(users []*UserInfo) *managerResolver {
+	resolver := &managerResolver{auth: auth, entries: make(map[string]*managerEntry, len(users))}
+	for _, user := range users {
+		resolver.entries[strings.ToLower(user.DN)] = &managerEntry{login: user.Username, managerDN: user.managerDN}
+	}
+	return resolver
+}
+
+// lookup returns the entry of the DN, nil if it's not found. The entries
+// are searched on the open connection, the errors are only logged so a
+// manager out of reach doesn't fail the login
+func (resolver *managerResolver) lookup(dn string) *managerEntry {
+	key := strings.ToLower(dn)
+	if entry, ok := resolver.entries[key]; ok {
+		return entry
+	}
+
+	server := resolver.auth.server
+	result, err := resolver.auth.search(searchManager, &LDAP.SearchRequest{
+		BaseDN:       dn,
+		Scope:        LDAP.ScopeBaseObject,
+		DerefAliases: LDAP.NeverDerefAliases,
+		Attributes:   appendIfNotEmpty(nil, server.Attr.Username, server.ManagerAttribute),
+		TimeLimit:    server.SearchTimeout,
+		Filter:       "(objectClass=*)",
+	})
+
+	var entry *managerEntry
+	if err != nil || len(result.Entries) != 1 {
+		resolver.auth.log.Debug("LDAP manager not found", "dn", dn, "error", err)
+	} else {
+		entry = &managerEntry{
+			login:     getLdapAttr(server.Attr.Username, result),
+			managerDN: getLdapAttr(server.ManagerAttribute, result),
+		}
+	}
+	resolver.entries[key] = entry
+	return entry
+}
+
+// resolve sets the logins of the manager chain of the user, nearest
+// first, and adds them to its stored attributes as the manager_login
+// and the comma separated manager_chain. The chain stops at the top, at
+// an entry not found or at a loop
+func (resolver *managerResolver) resolve(user *UserInfo) {
+	seen := map[string]bool{strings.ToLower(user.DN): true}
+	dn := user.managerDN
+
+	var managers []string
+	for len(managers) < resolver.auth.server.managerChainDepth() && dn != "" && !seen[strings.ToLower(dn)] {
+		seen[strings.ToLower(dn)] = true
+
+		entry := resolver.lookup(dn)
+		if entry == nil || entry.login == "" {
+			break
+		}
+		managers = append(managers, entry.login)
+		dn = entry.managerDN
+	}
+
+	user.Managers = managers
+	if len(managers) == 0 {
+		return
+	}
+	if user.Attributes == nil {
+		user.Attributes = map[string]string{}
+	}
+	user.Attributes[managerLoginAttribute] = managers[0]
+	user.Attributes[managerChainAttribute] = strings.Join(managers, ",")
+}
+
+// resolveManagers resolves the manager chains of the users with manager_attribute
+func (auth *Auth) resolveManagers(users ...*UserInfo) {
+	if auth.server.ManagerAttribute == "" {
+		return
+	}
+
+	resolver := auth.newManagerResolver(users)
+	for _, user := range users {
+		resolver.resolve(user)
+	}
+}
@@ -0,0 +1,89 @@
+package ldap
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	LDAP "gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+)
+
+func TestManagerChain(t *testing.T) {
+	Convey("Manager chain", t, func() {
+		// the directory: roel reports to tod, who reports to ceo
+		directory := map[string][2]string{
+			"uid=roel,dc=grafana,dc=org": {"roel", "uid=tod,dc=grafana,dc=org"},
+			"uid=tod,dc=grafana,dc=org":  {"tod", "uid=ceo,dc=grafana,dc=org"},
+			"uid=ceo,dc=grafana,dc=org":  {"ceo", ""},
+		}
+
+		var searched []string
+		conn := &mockLdapConn{}
+		conn.searchProvider = func(request *LDAP.SearchRequest) (*LDAP.SearchResult, error) {
+			searched = append(searched, request.BaseDN)
+			entry, ok := directory[request.BaseDN]
+			if !ok {
+				return &LDAP.SearchResult{}, nil
+			}
+			return &LDAP.SearchResult{Entries: []*LDAP.Entry{{
+				DN: request.BaseDN,
+				Attributes: []*LDAP.EntryAttribute{
+					{Name: "uid", Values: []string{entry[0]}},
+					{Name: "manager", Values: []string{entry[1]}},
+				},
+			}}}, nil
+		}
+
+		auth := &Auth{
+			conn: conn,
+			log:  log.New("test-logger"),
+			server: &ServerConfig{
+				Attr:             AttributeMap{Username: "uid"},
+				ManagerAttribute: "manager",
+			},
+		}
+		roel := &UserInfo{DN: "uid=roel,dc=grafana,dc=org", Username: "roel", managerDN: "uid=tod,dc=grafana,dc=org"}
+
+		Convey("Should resolve the direct manager by default", func() {
+			auth.resolveManagers(roel)
+			So(roel.Managers, ShouldResemble, []string{"tod"})
+			So(roel.Attributes, ShouldResemble, map[string]string{"manager_login": "tod", "manager_chain": "tod"})
+		})
+
+		Convey("Should resolve the chain up to the depth", func() {
+			auth.server.ManagerChainDepth = 5
+			auth.resolveManagers(roel)
+			So(roel.Managers, ShouldResemble, []string{"tod", "ceo"})
+			So(roel.Attributes["manager_chain"], ShouldEqual, "tod,ceo")
+		})
+
+		Convey("Should use the users already read and stop at the loops", func() {
+			auth.server.ManagerChainDepth = 5
+			tod := &UserInfo{DN: "uid=tod,dc=grafana,dc=org", Username: "tod", managerDN: "uid=roel,dc=grafana,dc=org"}
+			auth.resolveManagers(roel, tod)
+			So(roel.Managers, ShouldResemble, []string{"tod"})
+			So(tod.Managers, ShouldResemble, []string{"roel"})
+			So(searched, ShouldBeEmpty)
+		})
+
+		Convey("Should stop at the managers not found", func() {
+			roel.managerDN = "uid=gone,dc=grafana,dc=org"
+			auth.resolveManagers(roel)
+			So(roel.Managers, ShouldBeEmpty)
+			So(roel.Attributes, ShouldBeNil)
+		})
+
+		Convey("Should validate the depth and the reserved names", func() {
+			auth.server.ManagerChainDepth = 11
+			So(validateManagerChain(auth.server), ShouldNotBeNil)
+
+			auth.server.ManagerChainDepth = 2
+			auth.server.StoredAttributes = map[string]string{"manager_chain": "manager"}
+			So(validateManagerChain(auth.server), ShouldNotBeNil)
+
+			auth.server.StoredAttributes = nil
+			So(validateManagerChain(auth.server), ShouldBeNil)
+		})
+	})
+}
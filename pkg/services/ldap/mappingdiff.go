@@ -0,0 +1,186 @@
+package ldap
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap/ldaptest"
+)
+
+// The kinds of the mapping changes
+const (
+	MappingGained  = "gained_access"
+	MappingLost    = "lost_access"
+	MappingChanged = "changed"
+)
+
+// MappingChange is how the Grafana user a user of the directory maps to
+// changes from a config to another
+type MappingChange struct {
+	DN    string
+	Login string
+
+	// Kind is MappingGained, MappingLost or MappingChanged
+	Kind string
+
+	// Changes are the org roles and the Grafana admin permission changed
+	Changes []string
+}
+
+// SimulatedUsers gets the users of the LDIF entries, served by the
+// ldaptest server in place of each active server of the config. A user
+// found by several servers is only returned as found by the first one
+func SimulatedUsers(config *Config, ldif string) ([]*UserInfo, error) {
+	directory, err := ldaptest.NewServer(ldif)
+	if err != nil {
+		return nil, err
+	}
+	defer directory.Close()
+
+	var result []*UserInfo
+	seen := map[string]bool{}
+	for _, server := range config.Servers {
+		if !IsActive(server) || !CanSearchUsers(server) {
+			continue
+		}
+
+		auth := &Auth{server: simulatedServer(server, directory), log: logger}
+		users, err := auth.Users()
+		if err != nil {
+			return nil, err
+		}
+		for _, user := range users {
+			if key := strings.ToLower(user.DN); !seen[key] {
+				seen[key] = true
+				user.Server = server.Host
+				result = append(result, user)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// DiffMappings maps the users found with each config, by the server of
+// the config which found them, and returns the users gaining or losing
+// access or changing roles from the before config to the after one, in
+// the order of their DN. The users are only mapped, nothing is written
+func DiffMappings(before *Config, beforeUsers []*UserInfo, after *Config, afterUsers []*UserInfo) []*MappingChange {
+	mappedBefore, mappedAfter := mapDirectory(before, beforeUsers), mapDirectory(after, afterUsers)
+
+	var dns []string
+	for dn := range mappedBefore {
+		dns = append(dns, dn)
+	}
+	for dn := range mappedAfter {
+		if _, ok := mappedBefore[dn]; !ok {
+			dns = append(dns, dn)
+		}
+	}
+	sort.Strings(dns)
+
+	changes := []*MappingChange{}
+	for _, dn := range dns {
+		if change := diffMapping(mappedBefore[dn], mappedAfter[dn]); change != nil {
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+// mapDirectory maps the users with access to their Grafana user by
+// lowercase DN, the users without access are left out
+func mapDirectory(config *Config, users []*UserInfo) map[string]*models.ExternalUserInfo {
+	servers := map[string]*ServerConfig{}
+	for _, server := range config.Servers {
+		if _, ok := servers[server.Host]; !ok {
+			servers[server.Host] = server
+		}
+	}
+
+	mapped := map[string]*models.ExternalUserInfo{}
+	for _, user := range users {
+		server, ok := servers[user.Server]
+		if !ok {
+			continue
+		}
+
+		auth := &Auth{server: server, log: logger}
+		extUser := auth.buildGrafanaUser(user)
+		if _, err := auth.validateGrafanaUser(user, extUser); err != nil {
+			continue
+		}
+		mapped[strings.ToLower(user.DN)] = extUser
+	}
+	return mapped
+}
+
+// diffMapping compares the Grafana users a user maps to, nil without
+// access, and returns nil if nothing changes
+func diffMapping(before, after *models.ExternalUserInfo) *MappingChange {
+	switch {
+	case before == nil && after == nil:
+		return nil
+	case before == nil:
+		return &MappingChange{DN: after.AuthId, Login: after.Login, Kind: MappingGained, Changes: describeRoles(after)}
+	case after == nil:
+		return &MappingChange{DN: before.AuthId, Login: before.Login, Kind: MappingLost, Changes: describeRoles(before)}
+	}
+
+	change := &MappingChange{DN: after.AuthId, Login: after.Login, Kind: MappingChanged}
+	for _, orgId := range orgIds(before.OrgRoles, after.OrgRoles) {
+		from, to := before.OrgRoles[orgId], after.OrgRoles[orgId]
+		if from != to {
+			change.Changes = append(change.Changes, fmt.Sprintf("org %d: %s -> %s", orgId, roleOrNone(from), roleOrNone(to)))
+		}
+	}
+	if from, to := isGrafanaAdmin(before), isGrafanaAdmin(after); from != to {
+		change.Changes = append(change.Changes, fmt.Sprintf("grafana admin: %v -> %v", from, to))
+	}
+
+	if len(change.Changes) == 0 {
+		return nil
+	}
+	return change
+}
+
+// describeRoles lists the org roles and the Grafana admin permission of the user
+func describeRoles(extUser *models.ExternalUserInfo) []string {
+	var roles []string
+	for _, orgId := range orgIds(extUser.OrgRoles) {
+		roles = append(roles, fmt.Sprintf("org %d: %s", orgId, extUser.OrgRoles[orgId]))
+	}
+	if isGrafanaAdmin(extUser) {
+		roles = append(roles, "grafana admin")
+	}
+	return roles
+}
+
+// orgIds returns the sorted org ids of the org roles
+func orgIds(orgRoles ...map[int64]models.RoleType) []int64 {
+	seen := map[int64]bool{}
+	var ids []int64
+	for _, roles := range orgRoles {
+		for orgId := range roles {
+			if !seen[orgId] {
+				seen[orgId] = true
+				ids = append(ids, orgId)
+			}
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func roleOrNone(role models.RoleType) string {
+	if role == "" {
+		return "none"
+	}
+	return string(role)
+}
+
+func isGrafanaAdmin(extUser *models.ExternalUserInfo) bool {
+	return extUser.IsGrafanaAdmin != nil && *extUser.IsGrafanaAdmin
+}
@@ -0,0 +1,77 @@
+package ldap
+
+import (
+	"io/ioutil"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/grafana/grafana/pkg/models"
+)
+
+func TestDiffMappings(t *testing.T) {
+	Convey("DiffMappings", t, func() {
+		ldif, err := ioutil.ReadFile("testdata/grafana.ldif")
+		So(err, ShouldBeNil)
+
+		defer dialServers()()
+
+		admin := true
+		server := func(groups ...*GroupToOrgRole) *Config {
+			return &Config{Servers: []*ServerConfig{{
+				Host:          "ldap.example.org",
+				SearchFilter:  "(cn=%s)",
+				SearchBaseDNs: []string{"ou=users,dc=grafana,dc=org"},
+				Attr:          AttributeMap{Username: "cn", Email: "mail", MemberOf: "memberOf"},
+				Groups:        groups,
+			}}}
+		}
+		before := server(
+			&GroupToOrgRole{GroupDN: "cn=admins,ou=groups,dc=grafana,dc=org", OrgId: 1, OrgRole: models.ROLE_ADMIN, IsGrafanaAdmin: &admin},
+			&GroupToOrgRole{GroupDN: "cn=editors,ou=groups,dc=grafana,dc=org", OrgId: 1, OrgRole: models.ROLE_EDITOR},
+		)
+
+		beforeUsers, err := SimulatedUsers(before, string(ldif))
+		So(err, ShouldBeNil)
+		So(beforeUsers, ShouldHaveLength, 3)
+		So(beforeUsers[0].Server, ShouldEqual, "ldap.example.org")
+
+		Convey("Should report the users gaining access and changing roles", func() {
+			after := server(
+				&GroupToOrgRole{GroupDN: "cn=admins,ou=groups,dc=grafana,dc=org", OrgId: 1, OrgRole: models.ROLE_ADMIN},
+				&GroupToOrgRole{GroupDN: "cn=editors,ou=groups,dc=grafana,dc=org", OrgId: 1, OrgRole: models.ROLE_VIEWER},
+				&GroupToOrgRole{GroupDN: "*", OrgId: 2, OrgRole: models.ROLE_VIEWER},
+			)
+			afterUsers, err := SimulatedUsers(after, string(ldif))
+			So(err, ShouldBeNil)
+
+			changes := DiffMappings(before, beforeUsers, after, afterUsers)
+			So(changes, ShouldHaveLength, 3)
+
+			So(changes[0].Login, ShouldEqual, "ldap-admin")
+			So(changes[0].Kind, ShouldEqual, MappingChanged)
+			So(changes[0].Changes, ShouldResemble, []string{"org 2: none -> Viewer", "grafana admin: true -> false"})
+
+			So(changes[1].Login, ShouldEqual, "ldap-editor")
+			So(changes[1].Changes, ShouldResemble, []string{"org 1: Editor -> Viewer", "org 2: none -> Viewer"})
+
+			So(changes[2].Login, ShouldEqual, "ldap-viewer")
+			So(changes[2].Kind, ShouldEqual, MappingGained)
+			So(changes[2].Changes, ShouldResemble, []string{"org 2: Viewer"})
+		})
+
+		Convey("Should report the users losing access", func() {
+			after := server(&GroupToOrgRole{GroupDN: "cn=admins,ou=groups,dc=grafana,dc=org", OrgId: 1, OrgRole: models.ROLE_ADMIN, IsGrafanaAdmin: &admin})
+
+			changes := DiffMappings(before, beforeUsers, after, beforeUsers)
+			So(changes, ShouldHaveLength, 1)
+			So(changes[0].DN, ShouldEqual, "cn=ldap-editor,ou=users,dc=grafana,dc=org")
+			So(changes[0].Kind, ShouldEqual, MappingLost)
+			So(changes[0].Changes, ShouldResemble, []string{"org 1: Editor"})
+		})
+
+		Convey("Should report nothing for the same config", func() {
+			So(DiffMappings(before, beforeUsers, before, beforeUsers), ShouldBeEmpty)
+		})
+	})
+}
@@ -0,0 +1,116 @@
+package ldap
+
+import (
+	"errors"
+	"strings"
+
+	"golang.org/x/xerrors"
+	LDAP "gopkg.in/ldap.v3"
+)
+
+// The multiple_matches policies for the logins matching several entries
+const (
+	// MultipleMatchesFail refuses the login
+	MultipleMatchesFail = "fail"
+
+	// MultipleMatchesBaseDNOrder chooses the entry under the first of the
+	// preferred_base_dns containing one
+	MultipleMatchesBaseDNOrder = "base_dn_order"
+
+	// MultipleMatchesExact chooses the entry whose exact_match_attribute
+	// equals the login typed
+	MultipleMatchesExact = "exact_match"
+)
+
+// ErrMultipleEntries is returned when the search of the user matches
+// several entries and none can be chosen
+var ErrMultipleEntries = errors.New("Ldap search matched more than one entry, please review your filter setting")
+
+// validateMultipleMatches checks multiple_matches, defaulting to
+// MultipleMatchesFail, and the settings of its policy
+func validateMultipleMatches(server *ServerConfig) error {
+	switch server.MultipleMatches {
+	case "":
+		server.MultipleMatches = MultipleMatchesFail
+	case MultipleMatchesFail:
+	case MultipleMatchesBaseDNOrder:
+		if len(server.PreferredBaseDNs) == 0 {
+			return xerrors.New("multiple_matches = base_dn_order requires preferred_base_dns")
+		}
+	case MultipleMatchesExact:
+		if server.ExactMatchAttribute == "" {
+			return xerrors.New("multiple_matches = exact_match requires exact_match_attribute")
+		}
+	default:
+		return xerrors.Errorf("invalid multiple_matches %q, it must be fail, base_dn_order or exact_match", server.MultipleMatches)
+	}
+	return nil
+}
+
+// chooseEntry returns the search result with the entry chosen by the
+// multiple_matches policy among the ones matched by the login. The
+// result is shared by searchUserEntry, a new one is returned
+func (auth *Auth) chooseEntry(username string, result *LDAP.SearchResult) (*LDAP.SearchResult, error) {
+	var chosen *LDAP.Entry
+	switch auth.server.MultipleMatches {
+	case MultipleMatchesBaseDNOrder:
+		chosen = entryByBaseDN(result.Entries, auth.server.PreferredBaseDNs)
+	case MultipleMatchesExact:
+		chosen = entryByExactMatch(result.Entries, auth.server.ExactMatchAttribute, username)
+	}
+
+	dns := make([]string, 0, len(result.Entries))
+	for _, entry := range result.Entries {
+		dns = append(dns, entry.DN)
+	}
+	if chosen == nil {
+		auth.log.Warn("Ldap search matched more than one entry", "username", username, "dns", dns,
+			"policy", auth.server.MultipleMatches)
+		return nil, ErrMultipleEntries
+	}
+
+	auth.log.Info("Ldap search matched more than one entry, chose one by multiple_matches", "username", username,
+		"dn", chosen.DN, "dns", dns, "policy", auth.server.MultipleMatches)
+	return &LDAP.SearchResult{Entries: []*LDAP.Entry{chosen}, Controls: result.Controls}, nil
+}
+
+// entryByBaseDN returns the single entry under the first of the base DNs
+// containing any, nil if there are none or several
+func entryByBaseDN(entries []*LDAP.Entry, baseDNs []string) *LDAP.Entry {
+	for _, base := range baseDNs {
+		base = strings.ToLower(base)
+
+		var under []*LDAP.Entry
+		for _, entry := range entries {
+			dn := strings.ToLower(entry.DN)
+			if dn == base || strings.HasSuffix(dn, ","+base) {
+				under = append(under, entry)
+			}
+		}
+		if len(under) > 0 {
+			if len(under) == 1 {
+				return under[0]
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+// entryByExactMatch returns the single entry with a value of the
+// attribute equal to the login, compared case-insensitively
+func entryByExactMatch(entries []*LDAP.Entry, attribute, username string) *LDAP.Entry {
+	var chosen *LDAP.Entry
+	for _, entry := range entries {
+		for _, value := range entry.GetAttributeValues(attribute) {
+			if strings.EqualFold(value, username) {
+				if chosen != nil {
+					return nil
+				}
+				chosen = entry
+				break
+			}
+		}
+	}
+	return chosen
+}
@@ -0,0 +1,68 @@
+package ldap
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	LDAP "gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+)
+
+func TestMultipleMatches(t *testing.T) {
+	Convey("validateMultipleMatches", t, func() {
+		server := &ServerConfig{}
+		So(validateMultipleMatches(server), ShouldBeNil)
+		So(server.MultipleMatches, ShouldEqual, MultipleMatchesFail)
+
+		So(validateMultipleMatches(&ServerConfig{MultipleMatches: "first"}), ShouldNotBeNil)
+		So(validateMultipleMatches(&ServerConfig{MultipleMatches: MultipleMatchesBaseDNOrder}), ShouldNotBeNil)
+		So(validateMultipleMatches(&ServerConfig{MultipleMatches: MultipleMatchesExact}), ShouldNotBeNil)
+	})
+
+	Convey("Searching for a user matching several entries", t, func() {
+		conn := &mockLdapConn{}
+		conn.setSearchResult(&LDAP.SearchResult{Entries: []*LDAP.Entry{
+			LDAP.NewEntry("uid=roel,ou=contractors,dc=grafana,dc=org", map[string][]string{"uid": {"roel"}, "mail": {"roel@partner.org"}}),
+			LDAP.NewEntry("uid=roel.g,ou=staff,dc=grafana,dc=org", map[string][]string{"uid": {"roel.g"}, "mail": {"Roel@grafana.org"}}),
+		}})
+		auth := &Auth{conn: conn, log: log.New("test-logger"), server: &ServerConfig{
+			Attr:             AttributeMap{Username: "uid", Email: "mail"},
+			SearchFilter:     "(|(uid=%s)(mail=%s))",
+			SearchBaseDNs:    []string{"dc=grafana,dc=org"},
+			MultipleMatches:  MultipleMatchesFail,
+			PreferredBaseDNs: []string{"ou=staff,dc=grafana,dc=org", "ou=contractors,dc=grafana,dc=org"},
+		}}
+
+		Convey("Should fail by default", func() {
+			_, err := auth.searchForUser("roel", searchEverything)
+			So(err, ShouldEqual, ErrMultipleEntries)
+		})
+
+		Convey("Should choose the entry under the first preferred base DN with base_dn_order", func() {
+			auth.server.MultipleMatches = MultipleMatchesBaseDNOrder
+
+			user, err := auth.searchForUser("roel", searchEverything)
+			So(err, ShouldBeNil)
+			So(user.DN, ShouldEqual, "uid=roel.g,ou=staff,dc=grafana,dc=org")
+			So(user.Username, ShouldEqual, "roel.g")
+
+			auth.server.PreferredBaseDNs = []string{"ou=interns,dc=grafana,dc=org", "dc=grafana,dc=org"}
+			_, err = auth.searchForUser("roel", searchEverything)
+			So(err, ShouldEqual, ErrMultipleEntries)
+		})
+
+		Convey("Should choose the entry whose attribute is the login with exact_match", func() {
+			auth.server.MultipleMatches = MultipleMatchesExact
+			auth.server.ExactMatchAttribute = "mail"
+
+			user, err := auth.searchForUser("roel@grafana.org", searchEverything)
+			So(err, ShouldBeNil)
+			So(user.DN, ShouldEqual, "uid=roel.g,ou=staff,dc=grafana,dc=org")
+			So(conn.searchAttributes, ShouldContain, "mail")
+
+			_, err = auth.searchForUser("roel@example.org", searchEverything)
+			So(err, ShouldEqual, ErrMultipleEntries)
+		})
+	})
+}
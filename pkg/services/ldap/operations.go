@@ -0,0 +1,84 @@
+package ldap
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrShuttingDown is returned if an operation is started while Grafana shuts down
+var ErrShuttingDown = errors.New("LDAP authentication is shutting down")
+
+// operations tracks the in-flight LDAP operations
+var operations = newOperationTracker()
+
+// operationTracker keeps count of the in-flight operations of
+// every Auth, so they can be waited for or aborted on shutdown
+type operationTracker struct {
+	mutex    sync.Mutex
+	wg       sync.WaitGroup
+	draining bool
+	auths    map[*Auth]int
+}
+
+func newOperationTracker() *operationTracker {
+	return &operationTracker{
+		auths: map[*Auth]int{},
+	}
+}
+
+// start registers the operation unless the tracker is draining
+func (tracker *operationTracker) start(auth *Auth) error {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	if tracker.draining {
+		return ErrShuttingDown
+	}
+
+	tracker.auths[auth]++
+	tracker.wg.Add(1)
+	return nil
+}
+
+// finish unregisters the operation
+func (tracker *operationTracker) finish(auth *Auth) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	tracker.auths[auth]--
+	if tracker.auths[auth] <= 0 {
+		delete(tracker.auths, auth)
+	}
+	tracker.wg.Done()
+}
+
+// drain stops accepting new operations and waits for the in-flight ones.
+// The connections of the operations still running after the timeout
+// are closed, it returns how many there were
+func (tracker *operationTracker) drain(timeout time.Duration) int {
+	tracker.mutex.Lock()
+	tracker.draining = true
+	tracker.mutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		tracker.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return 0
+	case <-time.After(timeout):
+	}
+
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	for auth := range tracker.auths {
+		auth.Close()
+	}
+
+	return len(tracker.auths)
+}
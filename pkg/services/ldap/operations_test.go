@@ -0,0 +1,48 @@
+package ldap
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestOperationTracker(t *testing.T) {
+	Convey("Operation tracker", t, func() {
+		tracker := newOperationTracker()
+
+		Convey("Should reject new operations once draining", func() {
+			closed := tracker.drain(time.Second)
+			err := tracker.start(&Auth{})
+
+			So(closed, ShouldEqual, 0)
+			So(err, ShouldEqual, ErrShuttingDown)
+		})
+
+		Convey("Should wait for the in-flight operations", func() {
+			auth := &Auth{}
+			So(tracker.start(auth), ShouldBeNil)
+
+			go func() {
+				time.Sleep(10 * time.Millisecond)
+				tracker.finish(auth)
+			}()
+
+			closed := tracker.drain(time.Second)
+
+			So(closed, ShouldEqual, 0)
+			So(tracker.auths, ShouldBeEmpty)
+		})
+
+		Convey("Should close the connections of unfinished operations", func() {
+			conn := &mockLdapConn{}
+			auth := &Auth{conn: conn}
+			So(tracker.start(auth), ShouldBeNil)
+
+			closed := tracker.drain(10 * time.Millisecond)
+
+			So(closed, ShouldEqual, 1)
+			So(auth.closed, ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,55 @@
+package ldap
+
+import (
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// isExemptOrg checks if the org is in org_removal_exempt_org_ids
+func isExemptOrg(orgId int64) bool {
+	for _, exempt := range setting.LdapOrgRemovalExemptOrgIds {
+		if exempt == orgId {
+			return true
+		}
+	}
+	return false
+}
+
+// removeFromOrgs removes the Grafana user of the LDAP user matching no
+// group mapping anymore from all its orgs with strict_org_removal, but
+// the protected and exempt ones. Without it the user keeps its orgs
+func (auth *Auth) removeFromOrgs(user *UserInfo) {
+	if !setting.LdapStrictOrgRemoval || IsProtectedUser(user) {
+		return
+	}
+
+	query := &models.GetUserByAuthInfoQuery{AuthModule: AuthModule, AuthId: user.DN, Login: user.Username}
+	if err := bus.Dispatch(query); err != nil {
+		if err != models.ErrUserNotFound {
+			auth.log.Warn("Failed to find the Grafana user to remove from its orgs", "login", user.Username, "error", err)
+		}
+		return
+	}
+
+	orgsQuery := &models.GetUserOrgListQuery{UserId: query.Result.Id}
+	if err := bus.Dispatch(orgsQuery); err != nil {
+		auth.log.Warn("Failed to list the orgs to remove the user from", "login", user.Username, "error", err)
+		return
+	}
+
+	for _, org := range orgsQuery.Result {
+		if isProtectedOrg(org.OrgId) || isExemptOrg(org.OrgId) {
+			continue
+		}
+
+		cmd := &models.RemoveOrgUserCommand{UserId: query.Result.Id, OrgId: org.OrgId}
+		if err := bus.Dispatch(cmd); err != nil {
+			auth.log.Warn("Failed to remove the LDAP user from the org", "login", user.Username, "orgId", org.OrgId, "error", err)
+			continue
+		}
+
+		auth.log.Info("Removed the LDAP user matching no group mapping from the org",
+			"login", user.Username, "dn", user.DN, "orgId", org.OrgId, "role", org.Role)
+	}
+}
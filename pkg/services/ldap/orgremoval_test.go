@@ -0,0 +1,88 @@
+package ldap
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+func TestOrgRemoval(t *testing.T) {
+	Convey("Org removal", t, func() {
+		defer func(strict bool, exempt, protected []int64) {
+			setting.LdapStrictOrgRemoval, setting.LdapOrgRemovalExemptOrgIds, setting.LdapSyncProtectedOrgIds = strict, exempt, protected
+		}(setting.LdapStrictOrgRemoval, setting.LdapOrgRemovalExemptOrgIds, setting.LdapSyncProtectedOrgIds)
+
+		auth := New(&ServerConfig{
+			Groups: []*GroupToOrgRole{
+				{GroupDN: "cn=admins", OrgId: 1, OrgRole: models.ROLE_ADMIN},
+				{GroupDN: "cn=users", OrgId: 2, OrgRole: models.ROLE_VIEWER},
+			},
+		})
+		orgs := []*models.UserOrgDTO{
+			{OrgId: 1, Role: models.ROLE_ADMIN},
+			{OrgId: 2, Role: models.ROLE_VIEWER},
+			{OrgId: 3, Role: models.ROLE_EDITOR},
+			{OrgId: 4, Role: models.ROLE_EDITOR},
+		}
+
+		AuthScenario("Given a user losing its last group in strict mode", func(sc *scenarioContext) {
+			setting.LdapStrictOrgRemoval = true
+			setting.LdapOrgRemovalExemptOrgIds = []int64{3}
+			setting.LdapSyncProtectedOrgIds = []int64{4}
+			sc.userQueryReturns(&models.User{Id: 1, Login: "roel"})
+			sc.userOrgsQueryReturns(orgs)
+
+			var removed []int64
+			bus.AddHandler("test", func(cmd *models.RemoveOrgUserCommand) error {
+				removed = append(removed, cmd.OrgId)
+				return nil
+			})
+
+			_, err := auth.GetGrafanaUserFor(nil, &UserInfo{DN: "uid=roel", Username: "roel"})
+
+			Convey("Should remove it from its orgs but the exempt and protected ones", func() {
+				So(err, ShouldEqual, ErrInvalidCredentials)
+				So(removed, ShouldResemble, []int64{1, 2})
+			})
+		})
+
+		AuthScenario("Given a user losing its last group without strict mode", func(sc *scenarioContext) {
+			sc.userOrgsQueryReturns(orgs)
+
+			_, err := auth.GetGrafanaUserFor(nil, &UserInfo{DN: "uid=roel", Username: "roel"})
+
+			Convey("Should keep its orgs", func() {
+				So(err, ShouldEqual, ErrInvalidCredentials)
+				So(sc.removeOrgUserCmd, ShouldBeNil)
+			})
+		})
+
+		AuthScenario("Given a user losing the group of an exempt org", func(sc *scenarioContext) {
+			setting.LdapOrgRemovalExemptOrgIds = []int64{1}
+			sc.userOrgsQueryReturns(orgs[:2])
+
+			_, err := auth.GetGrafanaUserFor(nil, &UserInfo{DN: "uid=roel", Username: "roel", MemberOf: []string{"cn=users"}})
+
+			Convey("Should keep its role in the exempt org", func() {
+				So(err, ShouldBeNil)
+				So(sc.removeOrgUserCmd, ShouldBeNil)
+				So(sc.updateOrgUserCmd, ShouldBeNil)
+			})
+		})
+
+		AuthScenario("Given a user losing the group of an org", func(sc *scenarioContext) {
+			sc.userOrgsQueryReturns(orgs[:2])
+
+			_, err := auth.GetGrafanaUserFor(nil, &UserInfo{DN: "uid=roel", Username: "roel", MemberOf: []string{"cn=users"}})
+
+			Convey("Should remove it from the org", func() {
+				So(err, ShouldBeNil)
+				So(sc.removeOrgUserCmd.OrgId, ShouldEqual, 1)
+			})
+		})
+	})
+}
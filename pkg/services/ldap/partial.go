@@ -0,0 +1,55 @@
+package ldap
+
+import (
+	"fmt"
+	"strings"
+)
+
+// BaseDNError is the error of the search of the users under a base DN
+type BaseDNError struct {
+	Server string
+	BaseDN string
+	Err    error
+}
+
+// PartialUsersError is returned along with the users by Users and
+// UsersPaged when the searches of some base DNs timed out. The users of
+// the other base DNs are returned, the ones under the base DNs of the
+// errors are missing
+type PartialUsersError struct {
+	Errors []*BaseDNError
+}
+
+func (e *PartialUsersError) Error() string {
+	var bases []string
+	for _, baseErr := range e.Errors {
+		bases = append(bases, fmt.Sprintf("%s on %s: %s", baseErr.BaseDN, baseErr.Server, baseErr.Err))
+	}
+	return fmt.Sprintf("LDAP search of %d base DNs timed out, their users are missing: %s",
+		len(e.Errors), strings.Join(bases, "; "))
+}
+
+// Add adds the base DN errors of other to the ones of the error
+func (e *PartialUsersError) Add(other *PartialUsersError) {
+	e.Errors = append(e.Errors, other.Errors...)
+}
+
+// Covers checks if the user of the DN may be under a base DN whose
+// search failed, so its absence from the users doesn't mean it left
+func (e *PartialUsersError) Covers(dn string) bool {
+	dn = strings.ToLower(dn)
+	for _, baseErr := range e.Errors {
+		base := strings.ToLower(baseErr.BaseDN)
+		if dn == base || strings.HasSuffix(dn, ","+base) {
+			return true
+		}
+	}
+	return false
+}
+
+// AsPartialUsers returns the error of Users or UsersPaged if it only
+// reports missing base DNs, so the users returned with it can be used
+func AsPartialUsers(err error) (*PartialUsersError, bool) {
+	partial, ok := err.(*PartialUsersError)
+	return partial, ok
+}
@@ -0,0 +1,72 @@
+package ldap
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/xerrors"
+	LDAP "gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+)
+
+func TestPartialUsers(t *testing.T) {
+	Convey("Users with base DNs timing out", t, func() {
+		defer keepDial()()
+		defer func() {
+			recentErrors = &errorLog{}
+		}()
+
+		failures := map[string]error{}
+		conn := &mockLdapConn{}
+		conn.searchProvider = func(request *LDAP.SearchRequest) (*LDAP.SearchResult, error) {
+			if err := failures[request.BaseDN]; err != nil {
+				return nil, err
+			}
+			return &LDAP.SearchResult{Entries: []*LDAP.Entry{
+				LDAP.NewEntry("cn=roel,"+request.BaseDN, map[string][]string{"uid": {"roel"}}),
+			}}, nil
+		}
+		hookDial = func(auth *Auth) error {
+			auth.conn = conn
+			return nil
+		}
+		auth := &Auth{
+			log: log.New("test-logger"),
+			server: &ServerConfig{
+				Host:          "ldap.example.org",
+				Attr:          AttributeMap{Username: "uid"},
+				SearchFilter:  "(uid=%s)",
+				SearchBaseDNs: []string{"ou=a,dc=grafana,dc=org", "ou=b,dc=grafana,dc=org"},
+			},
+		}
+
+		Convey("Should return the users of the other base DNs with the timed out ones", func() {
+			failures["ou=a,dc=grafana,dc=org"] = &LDAP.Error{ResultCode: LDAP.LDAPResultTimeLimitExceeded, Err: errors.New("time limit exceeded")}
+
+			users, err := auth.Users()
+			So(users, ShouldHaveLength, 1)
+			So(users[0].DN, ShouldEqual, "cn=roel,ou=b,dc=grafana,dc=org")
+
+			partial, ok := AsPartialUsers(err)
+			So(ok, ShouldBeTrue)
+			So(partial.Errors, ShouldHaveLength, 1)
+			So(partial.Errors[0].Server, ShouldEqual, "ldap.example.org")
+			So(partial.Errors[0].BaseDN, ShouldEqual, "ou=a,dc=grafana,dc=org")
+			So(xerrors.Is(partial.Errors[0].Err, ErrTimeout), ShouldBeTrue)
+			So(partial.Covers("cn=tod,ou=a,dc=grafana,dc=org"), ShouldBeTrue)
+			So(partial.Covers("cn=roel,ou=b,dc=grafana,dc=org"), ShouldBeFalse)
+		})
+
+		Convey("Should fail on the other errors", func() {
+			failures["ou=a,dc=grafana,dc=org"] = &LDAP.Error{ResultCode: LDAP.LDAPResultInsufficientAccessRights, Err: errors.New("denied")}
+
+			users, err := auth.Users()
+			So(users, ShouldBeNil)
+			So(xerrors.Is(err, ErrInsufficientAccess), ShouldBeTrue)
+			_, ok := AsPartialUsers(err)
+			So(ok, ShouldBeFalse)
+		})
+	})
+}
@@ -0,0 +1,131 @@
+package ldap
+
+import (
+	"regexp"
+	"strings"
+
+	"golang.org/x/xerrors"
+	LDAP "gopkg.in/ldap.v3"
+)
+
+// placeholderPattern matches %s and the named placeholders like {{.Username}}
+var placeholderPattern = regexp.MustCompile(`%s|\{\{\s*\.(\w+)\s*\}\}`)
+
+// placeholderNames lists the named placeholders for the errors
+const placeholderNames = "{{.Username}}, {{.User}}, {{.Domain}} or {{.Email}}"
+
+// loginValues are the values of the named placeholders
+type loginValues struct {
+	// Username is the login as typed
+	Username string
+	// User is the login without its @domain
+	User string
+	// Domain is the domain of a user@domain login, empty otherwise
+	Domain string
+	// Email is the login if it's an email, empty otherwise
+	Email string
+}
+
+// allLogins matches every login, to list the users
+var allLogins = &loginValues{Username: "*", User: "*", Domain: "*", Email: "*"}
+
+func newLoginValues(login string) *loginValues {
+	values := &loginValues{Username: login, User: login}
+
+	if at := strings.LastIndex(login, "@"); at >= 0 {
+		values.User = login[:at]
+		values.Domain = login[at+1:]
+	}
+	if match := emailPattern.FindString(login); match == login {
+		values.Email = login
+	}
+
+	return values
+}
+
+// get returns the value of the named placeholder
+func (values *loginValues) get(name string) (string, bool) {
+	switch name {
+	case "Username":
+		return values.Username, true
+	case "User":
+		return values.User, true
+	case "Domain":
+		return values.Domain, true
+	case "Email":
+		return values.Email, true
+	}
+	return "", false
+}
+
+// expandFilter replaces the placeholders of a search filter with
+// the values escaped for filters, %s is the login
+func expandFilter(filter string, values *loginValues) string {
+	return expandPlaceholders(filter, values.Username, values, LDAP.EscapeFilter)
+}
+
+// expandDN replaces the placeholders of a DN with the values escaped for DNs
+func expandDN(dn string, values *loginValues) string {
+	return expandPlaceholders(dn, values.Username, values, escapeDN)
+}
+
+// expandPlaceholders replaces the placeholders of text in one pass,
+// so the values are never expanded again. %s is replaced with percent
+func expandPlaceholders(text string, percent string, values *loginValues, escape func(string) string) string {
+	return placeholderPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+		if placeholder == "%s" {
+			return escape(percent)
+		}
+
+		name := placeholderPattern.FindStringSubmatch(placeholder)[1]
+		if value, ok := values.get(name); ok {
+			return escape(value)
+		}
+		return placeholder
+	})
+}
+
+// noEscape leaves the values as they are, for the wildcards of allLogins
+func noEscape(value string) string {
+	return value
+}
+
+// hasPlaceholder checks if text has %s or a named placeholder
+func hasPlaceholder(text string) bool {
+	return placeholderPattern.MatchString(text)
+}
+
+// validatePlaceholders checks the named placeholders of the
+// server are known, the unknown ones would be sent as they are
+func validatePlaceholders(server *ServerConfig) error {
+	options := [][2]string{
+		{"bind_dn", server.BindDN},
+		{"search_filter", server.SearchFilter},
+		{"group_search_filter", server.GroupSearchFilter},
+	}
+
+	for _, template := range server.BindDNTemplates {
+		options = append(options, [2]string{"bind_dn_templates", template})
+	}
+
+	for _, option := range options {
+		if placeholder := unknownPlaceholder(option[1]); placeholder != "" {
+			return xerrors.Errorf("Unknown placeholder %s in %v, use %s", placeholder, option[0], placeholderNames)
+		}
+	}
+
+	return nil
+}
+
+// unknownPlaceholder returns the first named placeholder of text which isn't known
+func unknownPlaceholder(text string) string {
+	for _, match := range placeholderPattern.FindAllStringSubmatch(text, -1) {
+		if match[0] == "%s" {
+			continue
+		}
+		if _, ok := (&loginValues{}).get(match[1]); !ok {
+			return match[0]
+		}
+	}
+	return ""
+}
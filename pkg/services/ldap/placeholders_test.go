@@ -0,0 +1,65 @@
+package ldap
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPlaceholders(t *testing.T) {
+	Convey("newLoginValues", t, func() {
+		Convey("Should split the logins with a domain", func() {
+			values := newLoginValues("roel@grafana.org")
+			So(values.Username, ShouldEqual, "roel@grafana.org")
+			So(values.User, ShouldEqual, "roel")
+			So(values.Domain, ShouldEqual, "grafana.org")
+			So(values.Email, ShouldEqual, "roel@grafana.org")
+		})
+
+		Convey("Should leave the domain and email empty for the other logins", func() {
+			values := newLoginValues("roel")
+			So(values.User, ShouldEqual, "roel")
+			So(values.Domain, ShouldBeEmpty)
+			So(values.Email, ShouldBeEmpty)
+		})
+	})
+
+	Convey("expandFilter", t, func() {
+		Convey("Should replace %s and the named placeholders", func() {
+			filter := expandFilter("(|(sAMAccountName={{.User}})(mail={{ .Email }})(uid=%s))", newLoginValues("roel@grafana.org"))
+			So(filter, ShouldEqual, "(|(sAMAccountName=roel)(mail=roel@grafana.org)(uid=roel@grafana.org))")
+		})
+
+		Convey("Should escape the values for filters once", func() {
+			filter := expandFilter("(&(cn={{.User}})(uid=%s))", newLoginValues("*)(cn=%s"))
+			So(filter, ShouldEqual, `(&(cn=\2a\29\28cn=%s)(uid=\2a\29\28cn=%s))`)
+		})
+
+		Convey("Should leave the unknown placeholders alone", func() {
+			So(expandFilter("(cn={{.Nickname}})", newLoginValues("roel")), ShouldEqual, "(cn={{.Nickname}})")
+		})
+	})
+
+	Convey("expandDN", t, func() {
+		Convey("Should escape the values for DNs", func() {
+			dn := expandDN("cn={{.User}},ou={{.Domain}},dc=grafana,dc=org", newLoginValues("doe, john@emea"))
+			So(dn, ShouldEqual, `cn=doe\, john,ou=emea,dc=grafana,dc=org`)
+		})
+	})
+
+	Convey("validatePlaceholders", t, func() {
+		Convey("Should refuse the unknown placeholders", func() {
+			err := validatePlaceholders(&ServerConfig{SearchFilter: "(cn={{.Login}})"})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "{{.Login}} in search_filter")
+		})
+
+		Convey("Should accept the known ones", func() {
+			err := validatePlaceholders(&ServerConfig{
+				BindDN:       "cn={{.User}},dc=grafana,dc=org",
+				SearchFilter: "(|(cn=%s)(mail={{.Email}}))",
+			})
+			So(err, ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,90 @@
+package ldap
+
+import (
+	"errors"
+	"time"
+
+	LDAP "gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/models"
+)
+
+var (
+	// ErrPasswordExpired is returned if the password policy
+	// refused the bind since the password expired
+	ErrPasswordExpired = errors.New("LDAP password has expired")
+
+	// ErrAccountLocked is returned if the password policy locked the
+	// account, after too many failures or by an administrator
+	ErrAccountLocked = errors.New("LDAP account is locked")
+
+	// ErrPasswordMustChange is returned if the password was reset
+	// and must be changed before the user can log in
+	ErrPasswordMustChange = errors.New("LDAP password must be changed")
+)
+
+// passwordPolicyErrors are the errors of the password policy control which refuse a bind
+var passwordPolicyErrors = map[int8]error{
+	LDAP.BeheraPasswordExpired:  ErrPasswordExpired,
+	LDAP.BeheraAccountLocked:    ErrAccountLocked,
+	LDAP.BeheraChangeAfterReset: ErrPasswordMustChange,
+}
+
+// userBind binds as the user, asking for the draft-behera password policy
+// control when the server sets password_policy. A bind the policy refused
+// returns the typed error of the control, the warnings of a successful one
+// are kept for the user
+func (auth *Auth) userBind(dn string, password string) error {
+	auth.passwordPolicy = nil
+	if !auth.server.PasswordPolicy {
+		return auth.conn.Bind(dn, password)
+	}
+
+	result, err := auth.conn.SimpleBind(&LDAP.SimpleBindRequest{
+		Username: dn,
+		Password: password,
+		Controls: []LDAP.Control{LDAP.NewControlBeheraPasswordPolicy()},
+	})
+
+	var control *LDAP.ControlBeheraPasswordPolicy
+	if result != nil {
+		control, _ = LDAP.FindControl(result.Controls, LDAP.ControlTypeBeheraPasswordPolicy).(*LDAP.ControlBeheraPasswordPolicy)
+	}
+
+	if err != nil {
+		if policyErr := passwordPolicyError(control); policyErr != nil {
+			auth.log.Debug("Bind refused by the password policy", "error", err, "reason", control.ErrorString)
+			return policyErr
+		}
+		return err
+	}
+
+	auth.passwordPolicy = passwordPolicyWarning(control)
+	return nil
+}
+
+// passwordPolicyError is the typed error of the password policy control which refused the bind, if any
+func passwordPolicyError(control *LDAP.ControlBeheraPasswordPolicy) error {
+	if control == nil || control.Error < 0 {
+		return nil
+	}
+
+	return passwordPolicyErrors[control.Error]
+}
+
+// passwordPolicyWarning reads the warnings of the password policy control of a successful bind
+func passwordPolicyWarning(control *LDAP.ControlBeheraPasswordPolicy) *models.PasswordPolicyWarning {
+	if control == nil || (control.Expire < 0 && control.Grace < 0) {
+		return nil
+	}
+
+	warning := &models.PasswordPolicyWarning{GraceLogins: -1}
+	if control.Expire >= 0 {
+		warning.ExpiresIn = time.Duration(control.Expire) * time.Second
+	}
+	if control.Grace >= 0 {
+		warning.GraceLogins = int(control.Grace)
+	}
+
+	return warning
+}
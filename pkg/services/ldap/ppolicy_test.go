@@ -0,0 +1,92 @@
+package ldap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	. "github.com/smartystreets/goconvey/convey"
+	LDAP "gopkg.in/ldap.v3"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	Convey("passwordPolicyError", t, func() {
+		Convey("Should give the typed errors of the refused binds", func() {
+			control := LDAP.NewControlBeheraPasswordPolicy()
+			So(passwordPolicyError(control), ShouldBeNil)
+			So(passwordPolicyError(nil), ShouldBeNil)
+
+			control.Error = LDAP.BeheraAccountLocked
+			So(passwordPolicyError(control), ShouldEqual, ErrAccountLocked)
+
+			control.Error = LDAP.BeheraPasswordTooShort
+			So(passwordPolicyError(control), ShouldBeNil)
+		})
+	})
+
+	Convey("passwordPolicyWarning", t, func() {
+		Convey("Should read the expiration and the grace logins", func() {
+			control := LDAP.NewControlBeheraPasswordPolicy()
+			So(passwordPolicyWarning(control), ShouldBeNil)
+
+			control.Expire = 3600
+			warning := passwordPolicyWarning(control)
+			So(warning.ExpiresIn, ShouldEqual, time.Hour)
+			So(warning.GraceLogins, ShouldEqual, -1)
+
+			control.Expire = -1
+			control.Grace = 2
+			warning = passwordPolicyWarning(control)
+			So(warning.ExpiresIn, ShouldEqual, 0)
+			So(warning.GraceLogins, ShouldEqual, 2)
+		})
+	})
+
+	Convey("userBind", t, func() {
+		control := LDAP.NewControlBeheraPasswordPolicy()
+		var request *LDAP.SimpleBindRequest
+		connection := &mockLdapConn{
+			simpleBindProvider: func(req *LDAP.SimpleBindRequest) (*LDAP.SimpleBindResult, error) {
+				request = req
+				result := &LDAP.SimpleBindResult{Controls: []LDAP.Control{control}}
+				if control.Error >= 0 {
+					return result, &LDAP.Error{ResultCode: 49}
+				}
+				return result, nil
+			},
+		}
+		auth := &Auth{
+			server: &ServerConfig{PasswordPolicy: true},
+			conn:   connection,
+			log:    log.New("test-logger"),
+		}
+
+		Convey("Should ask for the control and keep the warnings", func() {
+			control.Grace = 1
+
+			err := auth.secondBind(&UserInfo{DN: "cn=user"}, "pwd")
+			So(err, ShouldBeNil)
+			So(request.Controls[0].GetControlType(), ShouldEqual, LDAP.ControlTypeBeheraPasswordPolicy)
+			So(auth.passwordPolicy.GraceLogins, ShouldEqual, 1)
+		})
+
+		Convey("Should return the typed error of the refused binds", func() {
+			control.Error = LDAP.BeheraPasswordExpired
+
+			err := auth.secondBind(&UserInfo{DN: "cn=user"}, "pwd")
+			So(err, ShouldEqual, ErrPasswordExpired)
+		})
+
+		Convey("Should return invalid credentials without the control", func() {
+			control.Error = LDAP.BeheraPasswordExpired
+			auth.server.PasswordPolicy = false
+			connection.bindProvider = func(username, password string) error {
+				return &LDAP.Error{ResultCode: 49}
+			}
+
+			err := auth.secondBind(&UserInfo{DN: "cn=user"}, "pwd")
+			So(err, ShouldEqual, ErrInvalidCredentials)
+			So(request, ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,109 @@
+package ldap
+
+import (
+	"sync"
+
+	LDAP "gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// missingGroups holds the mapped groups the last check didn't find, by server
+var missingGroups = map[string][]string{}
+var missingGroupsMutex = &sync.Mutex{}
+
+// configReloaded is called with the config read by ReloadConfig, it's set
+// while the service runs
+var configReloaded func(config *Config)
+
+// checkGroups is a variable so tests can replace it
+var checkGroups = func(server *ServerConfig) ([]string, error) {
+	auth := New(server).(*Auth)
+	return auth.FindMissingGroups()
+}
+
+// MissingGroups returns the mapped groups of the server the last check
+// didn't find in the directory
+func MissingGroups(server *ServerConfig) []string {
+	missingGroupsMutex.Lock()
+	defer missingGroupsMutex.Unlock()
+
+	return append([]string{}, missingGroups[ServerKey(server)]...)
+}
+
+// FindMissingGroups returns the DNs of the group mappings which don't
+// resolve in the directory, usually a typo leaving their users without
+// access. The group names which aren't DNs, like the ones of a POSIX
+// group search, can't be looked up and are skipped
+func (auth *Auth) FindMissingGroups() ([]string, error) {
+	if err := operations.start(auth); err != nil {
+		return nil, err
+	}
+	defer operations.finish(auth)
+
+	err := auth.connectService()
+	if err != nil {
+		return nil, auth.sanitizeError(err)
+	}
+	defer auth.conn.Close()
+
+	missing := []string{}
+	for _, dn := range auth.server.mappedGroupDNs() {
+		if parsed, err := LDAP.ParseDN(dn); err != nil || len(parsed.RDNs) == 0 {
+			continue
+		}
+
+		result, err := auth.search(searchGroupCheck, &LDAP.SearchRequest{
+			BaseDN:       dn,
+			Scope:        LDAP.ScopeBaseObject,
+			DerefAliases: LDAP.NeverDerefAliases,
+			Attributes:   []string{"dn"},
+			TimeLimit:    auth.server.SearchTimeout,
+			Filter:       "(objectClass=*)",
+		})
+		if isNoSuchObject(err) {
+			missing = append(missing, dn)
+			continue
+		}
+		if err != nil {
+			return nil, auth.sanitizeError(err)
+		}
+		if len(result.Entries) == 0 {
+			missing = append(missing, dn)
+		}
+	}
+
+	return missing, nil
+}
+
+// checkMappedGroups looks up the mapped groups of the active servers,
+// logging the ones missing from the directory
+func checkMappedGroups(config *Config) {
+	if !setting.LdapCheckMappedGroups || config == nil {
+		return
+	}
+
+	for _, server := range config.Servers {
+		if !IsActive(server) {
+			continue
+		}
+
+		key := ServerKey(server)
+		missing, err := checkGroups(server)
+		if err != nil {
+			logger.Warn("Failed to check the mapped LDAP groups", "server", key, "error", err)
+			continue
+		}
+		for _, dn := range missing {
+			logger.Warn("Mapped LDAP group not found in the directory, its users get no access", "server", key, "group_dn", dn)
+		}
+
+		missingGroupsMutex.Lock()
+		if len(missing) > 0 {
+			missingGroups[key] = missing
+		} else {
+			delete(missingGroups, key)
+		}
+		missingGroupsMutex.Unlock()
+	}
+}
@@ -0,0 +1,72 @@
+package ldap
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	LDAP "gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+func TestMappedGroupsCheck(t *testing.T) {
+	Convey("FindMissingGroups", t, func() {
+		conn := &mockLdapConn{}
+		conn.searchProvider = func(request *LDAP.SearchRequest) (*LDAP.SearchResult, error) {
+			switch request.BaseDN {
+			case "cn=admins,dc=grafana,dc=org":
+				return &LDAP.SearchResult{Entries: []*LDAP.Entry{LDAP.NewEntry(request.BaseDN, nil)}}, nil
+			case "cn=admnis,dc=grafana,dc=org":
+				return nil, &LDAP.Error{ResultCode: LDAP.LDAPResultNoSuchObject, Err: errors.New("no such object")}
+			}
+			return &LDAP.SearchResult{}, nil
+		}
+		hookDial = func(auth *Auth) error {
+			auth.conn = conn
+			return nil
+		}
+		defer keepDial()()
+
+		auth := &Auth{log: log.New("test-logger"), server: &ServerConfig{
+			BindDN: "cn=admin,dc=grafana,dc=org",
+			Groups: []*GroupToOrgRole{
+				{GroupDN: "cn=admins,dc=grafana,dc=org"},
+				{GroupDN: "cn=admnis,dc=grafana,dc=org"},
+				{GroupDN: "cn=editors,dc=grafana,dc=org"},
+				{GroupDN: "viewers"},
+				{GroupDN: "*"},
+			},
+		}}
+
+		missing, err := auth.FindMissingGroups()
+		So(err, ShouldBeNil)
+		So(missing, ShouldResemble, []string{"cn=admnis,dc=grafana,dc=org", "cn=editors,dc=grafana,dc=org"})
+	})
+
+	Convey("checkMappedGroups", t, func() {
+		defer func(check bool, original func(*ServerConfig) ([]string, error)) {
+			setting.LdapCheckMappedGroups, checkGroups = check, original
+			missingGroups = map[string][]string{}
+		}(setting.LdapCheckMappedGroups, checkGroups)
+		setting.LdapCheckMappedGroups = true
+
+		first, second := &ServerConfig{Host: "first"}, &ServerConfig{Host: "second"}
+		found := map[string][]string{"first": {"cn=admnis,dc=grafana,dc=org"}}
+		checkGroups = func(server *ServerConfig) ([]string, error) {
+			if server.Host == "second" {
+				return nil, errors.New("connection timed out")
+			}
+			return found[server.Host], nil
+		}
+
+		checkMappedGroups(&Config{Servers: []*ServerConfig{first, second}})
+		So(MissingGroups(first), ShouldResemble, []string{"cn=admnis,dc=grafana,dc=org"})
+		So(MissingGroups(second), ShouldBeEmpty)
+
+		found["first"] = nil
+		checkMappedGroups(&Config{Servers: []*ServerConfig{first}})
+		So(MissingGroups(first), ShouldBeEmpty)
+	})
+}
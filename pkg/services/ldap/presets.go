@@ -0,0 +1,174 @@
+package ldap
+
+import (
+	"sort"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// preset holds the options of a directory vendor, they fill
+// the options of the servers using it which are left unset
+type preset struct {
+	searchFilter                   string
+	attributes                     AttributeMap
+	groupSearchFilter              string
+	groupSearchFilterUserAttribute string
+
+	// groupsRDN replaces the OU of the search base DNs for the group
+	// search base DNs, for the directories keeping them apart
+	groupsRDN string
+
+	// separateUserBind and busyRetries are the ones of the
+	// compatibility profile of the directory
+	separateUserBind bool
+	busyRetries      int
+	clientCertAuth   bool
+}
+
+var presets = map[string]*preset{
+	"active_directory": {
+		searchFilter: "(sAMAccountName=%s)",
+		attributes: AttributeMap{
+			Username: "sAMAccountName",
+			Name:     "givenName",
+			Surname:  "sn",
+			Email:    "mail",
+			MemberOf: "memberOf",
+		},
+	},
+	// without the memberof overlay, so the groups are searched
+	"openldap": {
+		searchFilter: "(uid=%s)",
+		attributes: AttributeMap{
+			Username: "uid",
+			Name:     "givenName",
+			Surname:  "sn",
+			Email:    "mail",
+		},
+		groupSearchFilter:              "(&(objectClass=groupOfNames)(member=%s))",
+		groupSearchFilterUserAttribute: "dn",
+	},
+	"freeipa": {
+		searchFilter: "(uid=%s)",
+		attributes: AttributeMap{
+			Username: "uid",
+			Name:     "givenName",
+			Surname:  "sn",
+			Email:    "mail",
+			MemberOf: "memberOf",
+		},
+	},
+	// the Okta LDAP interface lists the members in uniqueMember, rate
+	// limits by answering busy and doesn't allow binding a connection again
+	"okta_ldap": {
+		searchFilter: "(uid=%s)",
+		attributes: AttributeMap{
+			Username: "uid",
+			Name:     "givenName",
+			Surname:  "sn",
+			Email:    "mail",
+		},
+		groupSearchFilter:              "(&(objectClass=groupofUniqueNames)(uniqueMember=%s))",
+		groupSearchFilterUserAttribute: "dn",
+		groupsRDN:                      "ou=groups",
+		separateUserBind:               true,
+		busyRetries:                    3,
+	},
+	// Google Secure LDAP authenticates the clients with their certificate,
+	// the users log in with their email and the groups list their members
+	"google_secure_ldap": {
+		searchFilter: "(|(uid=%s)(mail=%s))",
+		attributes: AttributeMap{
+			Username: "uid",
+			Name:     "givenName",
+			Surname:  "sn",
+			Email:    "mail",
+		},
+		groupSearchFilter:              "(&(objectClass=groupOfNames)(member=%s))",
+		groupSearchFilterUserAttribute: "dn",
+		groupsRDN:                      "ou=Groups",
+		clientCertAuth:                 true,
+	},
+	"jumpcloud": {
+		searchFilter: "(uid=%s)",
+		attributes: AttributeMap{
+			Username: "uid",
+			Name:     "givenName",
+			Surname:  "sn",
+			Email:    "mail",
+			MemberOf: "memberOf",
+		},
+	},
+}
+
+// applyPreset fills the options left unset with the ones of the server preset
+func applyPreset(server *ServerConfig) error {
+	if server.Preset == "" {
+		return nil
+	}
+
+	preset, ok := presets[server.Preset]
+	if !ok {
+		names := []string{}
+		for name := range presets {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		return xerrors.Errorf("Unknown LDAP preset %q, the presets are %s", server.Preset, strings.Join(names, ", "))
+	}
+
+	fill(&server.SearchFilter, preset.searchFilter)
+	fill(&server.Attr.Username, preset.attributes.Username)
+	fill(&server.Attr.Name, preset.attributes.Name)
+	fill(&server.Attr.Surname, preset.attributes.Surname)
+	fill(&server.Attr.Email, preset.attributes.Email)
+	fill(&server.Attr.MemberOf, preset.attributes.MemberOf)
+
+	// a server of a group searching preset can still use memberOf
+	if server.Attr.MemberOf == "" || server.GroupSearchFilter != "" {
+		fill(&server.GroupSearchFilter, preset.groupSearchFilter)
+		fill(&server.GroupSearchFilterUserAttribute, preset.groupSearchFilterUserAttribute)
+	}
+	if len(server.groupSearchFilters()) > 0 && len(server.GroupSearchBaseDNs) == 0 {
+		server.GroupSearchBaseDNs = groupSearchBaseDNs(server.SearchBaseDNs, preset.groupsRDN)
+	}
+
+	if preset.separateUserBind {
+		server.SeparateUserBind = true
+	}
+	if preset.clientCertAuth {
+		server.ClientCertAuth = true
+	}
+	if server.BusyRetries == 0 {
+		server.BusyRetries = preset.busyRetries
+	}
+
+	return nil
+}
+
+// groupSearchBaseDNs are the search base DNs with their first RDN replaced
+// by groupsRDN when it's an OU, like "ou=users,dc=example" becoming
+// "ou=groups,dc=example". The base DNs of the whole directory are kept
+func groupSearchBaseDNs(searchBaseDNs []string, groupsRDN string) []string {
+	if groupsRDN == "" {
+		return searchBaseDNs
+	}
+
+	result := make([]string, len(searchBaseDNs))
+	for i, baseDN := range searchBaseDNs {
+		result[i] = baseDN
+		comma := strings.Index(baseDN, ",")
+		if comma >= 0 && strings.HasPrefix(strings.ToLower(baseDN), "ou=") {
+			result[i] = groupsRDN + baseDN[comma:]
+		}
+	}
+	return result
+}
+
+func fill(option *string, value string) {
+	if *option == "" {
+		*option = value
+	}
+}
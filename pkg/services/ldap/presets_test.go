@@ -0,0 +1,94 @@
+package ldap
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPresets(t *testing.T) {
+	Convey("applyPreset", t, func() {
+		Convey("Should fill the options left unset", func() {
+			server := &ServerConfig{
+				Preset: "active_directory",
+				Attr:   AttributeMap{Email: "userPrincipalName"},
+			}
+
+			So(applyPreset(server), ShouldBeNil)
+			So(server.SearchFilter, ShouldEqual, "(sAMAccountName=%s)")
+			So(server.Attr.Username, ShouldEqual, "sAMAccountName")
+			So(server.Attr.Email, ShouldEqual, "userPrincipalName")
+			So(server.Attr.MemberOf, ShouldEqual, "memberOf")
+			So(server.GroupSearchFilter, ShouldBeEmpty)
+		})
+
+		Convey("Should search the groups in the search base DNs", func() {
+			server := &ServerConfig{
+				Preset:        "openldap",
+				SearchBaseDNs: []string{"dc=grafana,dc=org"},
+			}
+
+			So(applyPreset(server), ShouldBeNil)
+			So(server.GroupSearchFilter, ShouldEqual, "(&(objectClass=groupOfNames)(member=%s))")
+			So(server.GroupSearchFilterUserAttribute, ShouldEqual, "dn")
+			So(server.GroupSearchBaseDNs, ShouldResemble, []string{"dc=grafana,dc=org"})
+		})
+
+		Convey("Should not search the groups if memberOf is set", func() {
+			server := &ServerConfig{
+				Preset: "openldap",
+				Attr:   AttributeMap{MemberOf: "memberOf"},
+			}
+
+			So(applyPreset(server), ShouldBeNil)
+			So(server.GroupSearchFilter, ShouldBeEmpty)
+		})
+
+		Convey("Should apply the Okta compatibility profile", func() {
+			server := &ServerConfig{
+				Preset:        "okta_ldap",
+				SearchBaseDNs: []string{"ou=users,dc=example,dc=okta,dc=com", "dc=example,dc=okta,dc=com"},
+			}
+
+			So(applyPreset(server), ShouldBeNil)
+			So(server.GroupSearchFilter, ShouldEqual, "(&(objectClass=groupofUniqueNames)(uniqueMember=%s))")
+			So(server.GroupSearchBaseDNs, ShouldResemble, []string{"ou=groups,dc=example,dc=okta,dc=com", "dc=example,dc=okta,dc=com"})
+			So(server.SeparateUserBind, ShouldBeTrue)
+			So(server.BusyRetries, ShouldEqual, 3)
+		})
+
+		Convey("Should authenticate Google Secure LDAP with the client certificate", func() {
+			server := &ServerConfig{
+				Preset:        "google_secure_ldap",
+				SearchBaseDNs: []string{"ou=Users,dc=example,dc=com"},
+			}
+
+			So(applyPreset(server), ShouldBeNil)
+			So(server.ClientCertAuth, ShouldBeTrue)
+			So(server.GroupSearchBaseDNs, ShouldResemble, []string{"ou=Groups,dc=example,dc=com"})
+
+			bound := false
+			auth := &Auth{
+				server: server,
+				conn: &mockLdapConn{
+					bindProvider: func(username, password string) error {
+						bound = true
+						return nil
+					},
+					unauthenticatedBindProvider: func(username string) error {
+						bound = true
+						return nil
+					},
+				},
+			}
+			So(auth.serverBind(), ShouldBeNil)
+			So(bound, ShouldBeFalse)
+		})
+
+		Convey("Should reject unknown presets", func() {
+			err := applyPreset(&ServerConfig{Preset: "novell"})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "active_directory, freeipa, google_secure_ldap, jumpcloud, okta_ldap, openldap")
+		})
+	})
+}
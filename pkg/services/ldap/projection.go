@@ -0,0 +1,85 @@
+package ldap
+
+import (
+	"golang.org/x/xerrors"
+)
+
+// The attribute_projection policies for the attributes of the user searches
+const (
+	// AttributeProjectionOperation requests the attributes the operation
+	// looking the user up needs, a password verification only the ones
+	// of the bind and of the account checks
+	AttributeProjectionOperation = "operation"
+
+	// AttributeProjectionAll requests all the mapped attributes
+	AttributeProjectionAll = "all"
+)
+
+// userSearch is what a lookup of the user reads on top of the entry to
+// bind with and the attributes of the account checks
+type userSearch struct {
+	// profile reads the mapped attributes of the Grafana user
+	profile bool
+
+	// groups reads the groups of the user
+	groups bool
+}
+
+// searchEverything is the lookup reading everything about the user
+var searchEverything = userSearch{profile: true, groups: true}
+
+// validateAttributeProjection checks attribute_projection, defaulting to
+// AttributeProjectionOperation
+func validateAttributeProjection(server *ServerConfig) error {
+	switch server.AttributeProjection {
+	case "":
+		server.AttributeProjection = AttributeProjectionOperation
+	case AttributeProjectionOperation, AttributeProjectionAll:
+	default:
+		return xerrors.Errorf("invalid attribute_projection %q, it must be operation or all", server.AttributeProjection)
+	}
+	return nil
+}
+
+// requestedAttributes returns the attributes the search requests for the
+// lookup, all the mapped ones with attribute_projection = all
+func (server *ServerConfig) requestedAttributes(search userSearch) userSearch {
+	if server.AttributeProjection == AttributeProjectionAll {
+		return searchEverything
+	}
+	return search
+}
+
+// key tells the lookups apart in the searches shared by concurrent lookups
+func (search userSearch) key() string {
+	key := ""
+	if !search.profile {
+		key += "\x00noprofile"
+	}
+	if !search.groups {
+		key += "\x00nogroups"
+	}
+	return key
+}
+
+// userSearchAttributes returns the attributes the search of the user
+// requests: the ones to bind with and of the account checks, and the ones
+// of the profile and of the groups when the search reads them
+func (server *ServerConfig) userSearchAttributes(inputs AttributeMap, search userSearch) []string {
+	attributes := appendIfNotEmpty([]string{}, inputs.Username, server.ExactMatchAttribute)
+	if server.AccountRestrictions {
+		attributes = append(attributes, logonHoursAttribute, accountExpiresAttribute)
+	}
+
+	if search.profile {
+		attributes = appendIfNotEmpty(attributes, inputs.Surname, inputs.Email, inputs.Name,
+			server.SecondFactorSeedAttribute, server.GuidAttribute)
+		attributes = append(attributes, server.storedAttributeNames()...)
+		attributes = append(attributes, server.serviceAccountAttributeNames()...)
+	}
+	if search.groups {
+		attributes = appendIfNotEmpty(attributes, inputs.MemberOf)
+		attributes = append(attributes, server.groupSearchUserAttributes()...)
+	}
+	return attributes
+}
@@ -0,0 +1,68 @@
+package ldap
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	LDAP "gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+func TestAttributeProjection(t *testing.T) {
+	Convey("validateAttributeProjection", t, func() {
+		server := &ServerConfig{}
+		So(validateAttributeProjection(server), ShouldBeNil)
+		So(server.AttributeProjection, ShouldEqual, AttributeProjectionOperation)
+
+		So(validateAttributeProjection(&ServerConfig{AttributeProjection: AttributeProjectionAll}), ShouldBeNil)
+		So(validateAttributeProjection(&ServerConfig{AttributeProjection: "some"}), ShouldNotBeNil)
+	})
+
+	Convey("Attributes of the user searches", t, func() {
+		defer keepDial()()
+
+		conn := &mockLdapConn{}
+		conn.setSearchResult(&LDAP.SearchResult{Entries: []*LDAP.Entry{
+			LDAP.NewEntry("uid=roel,ou=users,dc=grafana,dc=org", map[string][]string{"uid": {"roel"}, "mail": {"roel@grafana.org"}}),
+		}})
+		hookDial = func(auth *Auth) error {
+			auth.conn = conn
+			return nil
+		}
+
+		auth := &Auth{
+			server: &ServerConfig{
+				BindDN:              "cn=admin,dc=grafana,dc=org",
+				SearchFilter:        "(uid=%s)",
+				SearchBaseDNs:       []string{"ou=users,dc=grafana,dc=org"},
+				Attr:                AttributeMap{Username: "uid", Email: "mail", Name: "givenName", MemberOf: "memberOf"},
+				GuidAttribute:       "objectGUID",
+				StoredAttributes:    map[string]string{"region": "l"},
+				AttributeProjection: AttributeProjectionOperation,
+				Groups:              []*GroupToOrgRole{{GroupDN: "*", OrgId: 1, OrgRole: models.ROLE_VIEWER}},
+			},
+			log: log.New("test-logger"),
+		}
+
+		Convey("Should request the mapped attributes to log in", func() {
+			user, err := auth.Authenticate(&models.LoginUserQuery{Username: "roel", Password: "pwd"})
+			So(err, ShouldBeNil)
+			So(user.Email, ShouldEqual, "roel@grafana.org")
+			So(conn.searchAttributes, ShouldResemble, []string{"uid", "mail", "givenName", "objectGUID", "l", "memberOf"})
+		})
+
+		Convey("Should only request the attributes to bind with to verify a password", func() {
+			So(auth.VerifyPassword("roel", "pwd"), ShouldBeNil)
+			So(conn.searchAttributes, ShouldResemble, []string{"uid"})
+		})
+
+		Convey("Should request all the mapped attributes with all", func() {
+			auth.server.AttributeProjection = AttributeProjectionAll
+
+			So(auth.VerifyPassword("roel", "pwd"), ShouldBeNil)
+			So(conn.searchAttributes, ShouldResemble, []string{"uid", "mail", "givenName", "objectGUID", "l", "memberOf"})
+		})
+	})
+}
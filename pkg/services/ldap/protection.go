@@ -0,0 +1,130 @@
+package ldap
+
+import (
+	"strings"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// IsProtectedUser checks if the login or the DN of the user is in
+// sync_protected_users, the syncs never modify the Grafana user of
+// these users, like the break-glass admin accounts and service users
+func IsProtectedUser(user *UserInfo) bool {
+	for _, protected := range setting.LdapSyncProtectedUsers {
+		if strings.EqualFold(protected, user.Username) || strings.EqualFold(protected, user.DN) {
+			return true
+		}
+	}
+	return false
+}
+
+// isProtectedOrg checks if the org is in sync_protected_org_ids
+func isProtectedOrg(orgId int64) bool {
+	for _, protected := range setting.LdapSyncProtectedOrgIds {
+		if protected == orgId {
+			return true
+		}
+	}
+	return false
+}
+
+// protectedGrafanaUser returns the Grafana user of the protected user
+// as is, logging the changes the sync attempted
+func (auth *Auth) protectedGrafanaUser(extUser *models.ExternalUserInfo) (*models.User, error) {
+	query := grafanaUserQuery(extUser)
+	if err := bus.Dispatch(query); err != nil {
+		auth.log.Warn("Not creating the protected LDAP user", "login", extUser.Login, "dn", extUser.AuthId)
+		return nil, err
+	}
+
+	auth.log.Info(
+		"Not syncing the protected LDAP user",
+		"login", extUser.Login,
+		"dn", extUser.AuthId,
+		"name", extUser.Name,
+		"email", extUser.Email,
+		"orgRoles", extUser.OrgRoles,
+		"isGrafanaAdmin", extUser.IsGrafanaAdmin != nil && *extUser.IsGrafanaAdmin,
+	)
+
+	return query.Result, nil
+}
+
+// protectOrgs keeps the roles of the user in the protected orgs as they
+// are, the sync neither adds the user to these orgs, removes it from
+// them nor changes its role in them. The user losing the groups of an
+// exempt org keeps its current role in it too
+func (auth *Auth) protectOrgs(extUser *models.ExternalUserInfo) error {
+	if len(setting.LdapSyncProtectedOrgIds) == 0 && len(setting.LdapOrgRemovalExemptOrgIds) == 0 {
+		return nil
+	}
+
+	// the current roles in the protected and exempt orgs, none for a new user
+	current := map[int64]models.RoleType{}
+	query := grafanaUserQuery(extUser)
+	err := bus.Dispatch(query)
+	if err != nil && err != models.ErrUserNotFound {
+		return err
+	}
+	if err == nil {
+		orgsQuery := &models.GetUserOrgListQuery{UserId: query.Result.Id}
+		if err := bus.Dispatch(orgsQuery); err != nil {
+			return err
+		}
+		for _, org := range orgsQuery.Result {
+			if isProtectedOrg(org.OrgId) || isExemptOrg(org.OrgId) {
+				current[org.OrgId] = org.Role
+			}
+		}
+	}
+
+	// don't sync org roles if none are mapped, the protected orgs included
+	if len(extUser.OrgRoles) == 0 {
+		return nil
+	}
+
+	for _, orgId := range setting.LdapSyncProtectedOrgIds {
+		role, mapped := extUser.OrgRoles[orgId]
+		if role == current[orgId] {
+			continue
+		}
+
+		if mapped {
+			auth.log.Info("Not syncing the role of the LDAP user in the protected org",
+				"login", extUser.Login, "orgId", orgId, "role", role, "currentRole", current[orgId])
+		} else {
+			auth.log.Info("Not removing the LDAP user from the protected org",
+				"login", extUser.Login, "orgId", orgId, "currentRole", current[orgId])
+		}
+
+		if current[orgId] == "" {
+			delete(extUser.OrgRoles, orgId)
+		} else {
+			extUser.OrgRoles[orgId] = current[orgId]
+		}
+	}
+
+	for _, orgId := range setting.LdapOrgRemovalExemptOrgIds {
+		if _, mapped := extUser.OrgRoles[orgId]; mapped || current[orgId] == "" {
+			continue
+		}
+
+		auth.log.Info("Not removing the LDAP user from the exempt org",
+			"login", extUser.Login, "orgId", orgId, "currentRole", current[orgId])
+		extUser.OrgRoles[orgId] = current[orgId]
+	}
+
+	return nil
+}
+
+// grafanaUserQuery is the lookup of the Grafana user of the upsert
+func grafanaUserQuery(extUser *models.ExternalUserInfo) *models.GetUserByAuthInfoQuery {
+	return &models.GetUserByAuthInfoQuery{
+		AuthModule: extUser.AuthModule,
+		AuthId:     extUser.AuthId,
+		Email:      extUser.Email,
+		Login:      extUser.Login,
+	}
+}
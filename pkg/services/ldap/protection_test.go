@@ -0,0 +1,95 @@
+package ldap
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+func TestProtection(t *testing.T) {
+	Convey("Sync protection", t, func() {
+		defer func(users []string, orgs []int64) {
+			setting.LdapSyncProtectedUsers, setting.LdapSyncProtectedOrgIds = users, orgs
+		}(setting.LdapSyncProtectedUsers, setting.LdapSyncProtectedOrgIds)
+
+		auth := New(&ServerConfig{
+			Groups: []*GroupToOrgRole{
+				{GroupDN: "cn=users", OrgId: 1, OrgRole: models.ROLE_ADMIN},
+				{GroupDN: "cn=users", OrgId: 2, OrgRole: models.ROLE_VIEWER},
+			},
+		})
+		user := &UserInfo{DN: "uid=break-glass,dc=grafana,dc=org", Username: "break-glass", MemberOf: []string{"cn=users"}}
+
+		Convey("Should protect the users by login or DN", func() {
+			setting.LdapSyncProtectedUsers = []string{"admin", "UID=break-glass,dc=grafana,dc=org"}
+			So(IsProtectedUser(user), ShouldBeTrue)
+
+			setting.LdapSyncProtectedUsers = []string{"Break-Glass"}
+			So(IsProtectedUser(user), ShouldBeTrue)
+
+			setting.LdapSyncProtectedUsers = []string{"admin"}
+			So(IsProtectedUser(user), ShouldBeFalse)
+		})
+
+		AuthScenario("Given a protected user", func(sc *scenarioContext) {
+			setting.LdapSyncProtectedUsers = []string{"break-glass"}
+			existing := &models.User{Id: 1, Login: "break-glass"}
+			sc.userQueryReturns(existing)
+
+			result, err := auth.GetGrafanaUserFor(nil, user)
+
+			Convey("Should return the Grafana user as is", func() {
+				So(err, ShouldBeNil)
+				So(result, ShouldEqual, existing)
+				So(sc.updateUserCmd, ShouldBeNil)
+				So(sc.addOrgUserCmd, ShouldBeNil)
+				So(sc.updateUserPermissionsCmd, ShouldBeNil)
+			})
+		})
+
+		AuthScenario("Given a protected user without a Grafana user", func(sc *scenarioContext) {
+			setting.LdapSyncProtectedUsers = []string{"break-glass"}
+			sc.userQueryReturns(nil)
+
+			_, err := auth.GetGrafanaUserFor(nil, user)
+
+			Convey("Should not create it", func() {
+				So(err, ShouldEqual, models.ErrUserNotFound)
+				So(sc.createUserCmd, ShouldBeNil)
+			})
+		})
+
+		AuthScenario("Given a protected org with another role", func(sc *scenarioContext) {
+			setting.LdapSyncProtectedOrgIds = []int64{1, 3}
+			sc.userOrgsQueryReturns([]*models.UserOrgDTO{
+				{OrgId: 1, Role: models.ROLE_EDITOR},
+				{OrgId: 3, Role: models.ROLE_VIEWER},
+			})
+
+			_, err := auth.GetGrafanaUserFor(nil, user)
+
+			Convey("Should keep the roles of the protected orgs", func() {
+				So(err, ShouldBeNil)
+				So(sc.updateOrgUserCmd, ShouldBeNil)
+				So(sc.removeOrgUserCmd, ShouldBeNil)
+				So(sc.addOrgUserCmd.OrgId, ShouldEqual, 2)
+			})
+		})
+
+		AuthScenario("Given a protected org the user is not in", func(sc *scenarioContext) {
+			setting.LdapSyncProtectedOrgIds = []int64{2}
+			sc.userOrgsQueryReturns([]*models.UserOrgDTO{{OrgId: 1, Role: models.ROLE_ADMIN}})
+
+			_, err := auth.GetGrafanaUserFor(nil, user)
+
+			Convey("Should not add the user to it", func() {
+				So(err, ShouldBeNil)
+				So(sc.addOrgUserCmd, ShouldBeNil)
+				So(sc.updateOrgUserCmd, ShouldBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,81 @@
+package ldap
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+
+	"golang.org/x/net/proxy"
+)
+
+// newProxyDialer returns the dialer used to reach the server,
+// going through the proxy configured in proxy_url if any
+func newProxyDialer(server *ServerConfig) (proxy.Dialer, error) {
+	dialer := newDialer()
+	if server.ProxyURL == "" {
+		return dialer, nil
+	}
+
+	proxyURL, err := url.Parse(server.ProxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid LDAP proxy_url: %v", err)
+	}
+
+	switch proxyURL.Scheme {
+	case "socks5":
+		return proxy.FromURL(proxyURL, dialer)
+	case "http":
+		return &httpConnectDialer{proxy: proxyURL, forward: dialer}, nil
+	default:
+		return nil, fmt.Errorf("Unsupported LDAP proxy_url scheme %q, use socks5 or http", proxyURL.Scheme)
+	}
+}
+
+// httpConnectDialer tunnels the connections through an HTTP proxy with the CONNECT method
+type httpConnectDialer struct {
+	proxy   *url.URL
+	forward proxy.Dialer
+}
+
+func (d *httpConnectDialer) Dial(network, addr string) (net.Conn, error) {
+	conn, err := d.forward.Dial(network, d.proxy.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: http.Header{},
+	}
+	if user := d.proxy.User; user != nil {
+		password, _ := user.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(user.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// The LDAP client speaks first, so nothing but the proxy
+	// response can be buffered by the reader
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("LDAP proxy %s refused to connect to %s: %s", d.proxy.Host, addr, resp.Status)
+	}
+
+	return conn, nil
+}
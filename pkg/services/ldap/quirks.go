@@ -0,0 +1,242 @@
+package ldap
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/xerrors"
+	LDAP "gopkg.in/ldap.v3"
+)
+
+const (
+	// QuirkEDirectory maps the NDS error codes of the eDirectory binds,
+	// like its intruder lockout, to the typed errors
+	QuirkEDirectory = "edirectory"
+
+	// QuirkOpenDJ lists the users with paged searches, OpenDJ refuses the
+	// unindexed searches returning more entries than its size limit
+	QuirkOpenDJ = "opendj"
+
+	// Quirk389DS follows the search continuation references of 389-DS,
+	// which can list several URLs in one reference and add a scope to the DN
+	Quirk389DS = "389ds"
+
+	// QuirksNone disables the detection of the quirks of the server
+	QuirksNone = "none"
+)
+
+// quirksPageSize is the page size of the paged searches of QuirkOpenDJ
+const quirksPageSize = 500
+
+// quirkVendors are the rootDSE vendorName or vendorVersion
+// fragments of the directories with quirks
+var quirkVendors = []struct {
+	fragment string
+	quirk    string
+}{
+	{"Novell", QuirkEDirectory},
+	{"NetIQ", QuirkEDirectory},
+	{"OpenDJ", QuirkOpenDJ},
+	{"ForgeRock", QuirkOpenDJ},
+	{"389 Project", Quirk389DS},
+	{"389-Directory", Quirk389DS},
+	{"Red Hat-Directory", Quirk389DS},
+}
+
+// eDirectoryBindErrors are the NDS error codes of the binds eDirectory refuses
+var eDirectoryBindErrors = map[string]error{
+	"(-197)": ErrAccountLocked,      // ERR_LOGIN_LOCKOUT, the intruder lockout
+	"(-220)": ErrAccountExpired,     // ERR_ACCOUNT_EXPIRED
+	"(-222)": ErrPasswordExpired,    // ERR_PASSWORD_EXPIRED
+	"(-669)": ErrInvalidCredentials, // ERR_FAILED_AUTHENTICATION
+}
+
+// detectedQuirks caches the quirks read from the rootDSE by server
+var detectedQuirks sync.Map
+
+// validateQuirks checks the quirks of the server are known
+func validateQuirks(server *ServerConfig) error {
+	for _, quirk := range server.Quirks {
+		switch quirk {
+		case QuirkEDirectory, QuirkOpenDJ, Quirk389DS, QuirksNone:
+		default:
+			return xerrors.Errorf("Unknown LDAP quirk %q, use %q, %q, %q or %q",
+				quirk, QuirkEDirectory, QuirkOpenDJ, Quirk389DS, QuirksNone)
+		}
+	}
+	return nil
+}
+
+// detectQuirks reads the vendor of the server from the rootDSE of conn,
+// once by server, unless the quirks are set in the config
+func (auth *Auth) detectQuirks(conn IConnection) {
+	if len(auth.server.Quirks) > 0 {
+		return
+	}
+
+	key := ServerKey(auth.server)
+	if _, ok := detectedQuirks.Load(key); ok {
+		return
+	}
+
+	quirks := []string{}
+	result, err := conn.Search(&LDAP.SearchRequest{
+		BaseDN:       "",
+		Scope:        LDAP.ScopeBaseObject,
+		DerefAliases: LDAP.NeverDerefAliases,
+		Filter:       "(objectClass=*)",
+		Attributes:   []string{"vendorName", "vendorVersion"},
+	})
+	if err != nil {
+		auth.log.Debug("Failed to read the rootDSE for the quirks", "error", err)
+	} else if result != nil && len(result.Entries) == 1 {
+		quirks = vendorQuirks(result.Entries[0].GetAttributeValue("vendorName") + " " +
+			result.Entries[0].GetAttributeValue("vendorVersion"))
+	}
+
+	if len(quirks) > 0 {
+		auth.log.Info("LDAP quirks detected", "server", key, "quirks", quirks)
+	}
+	detectedQuirks.Store(key, quirks)
+}
+
+// vendorQuirks returns the quirks of the rootDSE vendor
+func vendorQuirks(vendor string) []string {
+	quirks := []string{}
+	for _, vendorQuirk := range quirkVendors {
+		if strings.Contains(vendor, vendorQuirk.fragment) && !containsString(quirks, vendorQuirk.quirk) {
+			quirks = append(quirks, vendorQuirk.quirk)
+		}
+	}
+	return quirks
+}
+
+// hasQuirk checks if the server has the quirk, set in the config or detected
+func (auth *Auth) hasQuirk(quirk string) bool {
+	if len(auth.server.Quirks) > 0 {
+		return containsString(auth.server.Quirks, quirk)
+	}
+
+	quirks, ok := detectedQuirks.Load(ServerKey(auth.server))
+	return ok && containsString(quirks.([]string), quirk)
+}
+
+// quirkBindError is the typed error of the bind refused by an eDirectory server, if any
+func (auth *Auth) quirkBindError(err error) error {
+	if !auth.hasQuirk(QuirkEDirectory) {
+		return nil
+	}
+
+	ldapErr, ok := err.(*LDAP.Error)
+	if !ok || ldapErr.Err == nil {
+		return nil
+	}
+	for code, typed := range eDirectoryBindErrors {
+		if strings.Contains(ldapErr.Err.Error(), code) {
+			return typed
+		}
+	}
+	return nil
+}
+
+// searchAll sends the search in pages with QuirkOpenDJ, the size limits
+// of OpenDJ apply to the pages instead of the whole result
+func (auth *Auth) searchAll(request *LDAP.SearchRequest) (*LDAP.SearchResult, error) {
+	if !auth.hasQuirk(QuirkOpenDJ) {
+		return auth.search(searchEnumeration, request)
+	}
+
+	return auth.searchPaged(request, quirksPageSize, nil)
+}
+
+// followReferrals searches the servers of the continuation references of
+// a 389-DS search which found nothing, with the service account
+func (auth *Auth) followReferrals(request *LDAP.SearchRequest, result *LDAP.SearchResult) (*LDAP.SearchResult, error) {
+	if len(result.Entries) > 0 || len(result.Referrals) == 0 || !auth.hasQuirk(Quirk389DS) || !CanSearchUsers(auth.server) {
+		return result, nil
+	}
+
+	for _, reference := range result.Referrals {
+		// 389-DS may put several URLs in one reference
+		for _, referral := range strings.Fields(reference) {
+			server, baseDN, err := referralServer(auth.server, referral)
+			if err != nil {
+				auth.log.Debug("Skipping the LDAP referral", "referral", referral, "error", err)
+				continue
+			}
+
+			referred, err := auth.searchReferral(server, baseDN, request)
+			if err != nil {
+				auth.log.Debug("Failed to follow the LDAP referral", "referral", referral, "error", err)
+				continue
+			}
+			if len(referred.Entries) > 0 {
+				return referred, nil
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// searchReferral sends the search to the referred server, in baseDN if set
+func (auth *Auth) searchReferral(server *ServerConfig, baseDN string, request *LDAP.SearchRequest) (*LDAP.SearchResult, error) {
+	referred := New(server).(*Auth)
+	if err := referred.Dial(); err != nil {
+		return nil, err
+	}
+	defer referred.Close()
+
+	if err := referred.serverBind(); err != nil {
+		return nil, err
+	}
+
+	search := *request
+	if baseDN != "" {
+		search.BaseDN = baseDN
+	}
+	return referred.search(searchReferral, &search)
+}
+
+// referralServer is the server of an LDAP URL with the settings of server,
+// and its DN. 389-DS may leave the DN out, or add the "??sub" scope to it
+func referralServer(server *ServerConfig, referral string) (*ServerConfig, string, error) {
+	parsed, err := url.Parse(referral)
+	if err != nil {
+		return nil, "", err
+	}
+
+	referred := *server
+	referred.Host = parsed.Hostname()
+	switch parsed.Scheme {
+	case "ldap":
+		referred.Port = 389
+	case "ldaps":
+		referred.Port = 636
+		referred.UseSSL = true
+		referred.StartTLS = false
+	default:
+		return nil, "", xerrors.Errorf("unsupported scheme %q", parsed.Scheme)
+	}
+	if port := parsed.Port(); port != "" {
+		if referred.Port, err = strconv.Atoi(port); err != nil {
+			return nil, "", err
+		}
+	}
+	if referred.Host == "" {
+		return nil, "", xerrors.New("missing host")
+	}
+
+	return &referred, strings.TrimPrefix(parsed.Path, "/"), nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,132 @@
+package ldap
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	LDAP "gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+)
+
+func TestQuirks(t *testing.T) {
+	Convey("detectQuirks", t, func() {
+		server := &ServerConfig{Host: "quirks.example.org", Port: 389}
+		defer detectedQuirks.Delete(ServerKey(server))
+
+		auth := &Auth{server: server, log: log.New("test-logger")}
+		conn := &mockLdapConn{
+			result: &LDAP.SearchResult{Entries: []*LDAP.Entry{LDAP.NewEntry("", map[string][]string{
+				"vendorName":    {"NetIQ Corporation"},
+				"vendorVersion": {"LDAP Agent for NetIQ eDirectory 9.1"},
+			})}},
+		}
+
+		auth.detectQuirks(conn)
+		So(auth.hasQuirk(QuirkEDirectory), ShouldBeTrue)
+		So(auth.hasQuirk(QuirkOpenDJ), ShouldBeFalse)
+
+		Convey("Should prefer the quirks of the config", func() {
+			server.Quirks = []string{QuirksNone}
+			So(auth.hasQuirk(QuirkEDirectory), ShouldBeFalse)
+		})
+	})
+
+	Convey("quirkBindError", t, func() {
+		auth := &Auth{server: &ServerConfig{Quirks: []string{QuirkEDirectory}}}
+
+		err := &LDAP.Error{ResultCode: LDAP.LDAPResultUnwillingToPerform, Err: errors.New("NDS error: login lockout (-197)")}
+		So(auth.quirkBindError(err), ShouldEqual, ErrAccountLocked)
+
+		auth.server.Quirks = []string{QuirkOpenDJ}
+		So(auth.quirkBindError(err), ShouldBeNil)
+	})
+
+	Convey("searchAll", t, func() {
+		pages := 0
+		conn := &mockLdapConn{
+			searchProvider: func(request *LDAP.SearchRequest) (*LDAP.SearchResult, error) {
+				pages++
+				paging := LDAP.FindControl(request.Controls, LDAP.ControlTypePaging).(*LDAP.ControlPaging)
+				result := &LDAP.SearchResult{Entries: []*LDAP.Entry{LDAP.NewEntry("uid=user", nil)}}
+				if len(paging.Cookie) == 0 {
+					result.Controls = []LDAP.Control{&LDAP.ControlPaging{Cookie: []byte("next")}}
+				}
+				return result, nil
+			},
+		}
+		auth := &Auth{server: &ServerConfig{Quirks: []string{QuirkOpenDJ}}, conn: conn}
+
+		result, err := auth.searchAll(&LDAP.SearchRequest{BaseDN: "dc=grafana,dc=org"})
+		So(err, ShouldBeNil)
+		So(pages, ShouldEqual, 2)
+		So(result.Entries, ShouldHaveLength, 2)
+	})
+
+	Convey("searchPaged with a pacer", t, func() {
+		var sizes []uint32
+		conn := &mockLdapConn{
+			searchProvider: func(request *LDAP.SearchRequest) (*LDAP.SearchResult, error) {
+				paging := LDAP.FindControl(request.Controls, LDAP.ControlTypePaging).(*LDAP.ControlPaging)
+				sizes = append(sizes, paging.PagingSize)
+				result := &LDAP.SearchResult{Entries: []*LDAP.Entry{LDAP.NewEntry("uid=user", nil)}}
+				if len(sizes) < 3 {
+					result.Controls = []LDAP.Control{&LDAP.ControlPaging{Cookie: []byte("next")}}
+				}
+				return result, nil
+			},
+		}
+		auth := &Auth{server: &ServerConfig{}, conn: conn, log: log.New("test-logger")}
+
+		Convey("Should pace each page but the last one", func() {
+			pacer := &mockPacer{}
+			result, err := auth.searchPaged(&LDAP.SearchRequest{BaseDN: "dc=grafana,dc=org"}, 10, pacer)
+			So(err, ShouldBeNil)
+			So(result.Entries, ShouldHaveLength, 3)
+			So(pacer.paced, ShouldEqual, 2)
+		})
+
+		Convey("Should abandon the search when the pacer fails", func() {
+			pacer := &mockPacer{err: errors.New("sync stopped")}
+			_, err := auth.searchPaged(&LDAP.SearchRequest{BaseDN: "dc=grafana,dc=org"}, 10, pacer)
+			So(err, ShouldEqual, pacer.err)
+			So(sizes, ShouldResemble, []uint32{10, 0})
+		})
+	})
+
+	Convey("referralServer", t, func() {
+		server := &ServerConfig{Host: "ldap1", Port: 636, UseSSL: true}
+
+		referred, baseDN, err := referralServer(server, "ldap://ldap2.example.org/ou=People%2Cdc=example,dc=com??sub")
+		So(err, ShouldBeNil)
+		So(referred.Host, ShouldEqual, "ldap2.example.org")
+		So(referred.Port, ShouldEqual, 389)
+		So(baseDN, ShouldEqual, "ou=People,dc=example,dc=com")
+
+		referred, baseDN, err = referralServer(server, "ldaps://ldap3:1636")
+		So(err, ShouldBeNil)
+		So(referred.Port, ShouldEqual, 1636)
+		So(baseDN, ShouldBeEmpty)
+		So(server.Host, ShouldEqual, "ldap1")
+
+		_, _, err = referralServer(server, "http://ldap4")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("validateQuirks", t, func() {
+		So(validateQuirks(&ServerConfig{Quirks: []string{Quirk389DS}}), ShouldBeNil)
+		So(validateQuirks(&ServerConfig{Quirks: []string{"novell"}}), ShouldNotBeNil)
+	})
+}
+
+type mockPacer struct {
+	paced int
+	err   error
+}
+
+func (pacer *mockPacer) Pace(latency time.Duration) error {
+	pacer.paced++
+	return pacer.err
+}
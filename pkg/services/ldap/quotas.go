@@ -0,0 +1,87 @@
+package ldap
+
+import (
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+	"golang.org/x/xerrors"
+)
+
+// validateGroupQuotas checks the quotas of the group mappings are org
+// quota targets: org_user, data_source, dashboard and api_key
+func validateGroupQuotas(server *ServerConfig) error {
+	targets := (&setting.OrgQuota{}).ToMap()
+	for _, group := range server.Groups {
+		for target := range group.Quotas {
+			if _, ok := targets[target]; !ok {
+				return xerrors.Errorf("invalid quota target %q of group %q", target, group.GroupDN)
+			}
+		}
+	}
+	return nil
+}
+
+// groupQuotas returns the quotas of the group mappings the user is a
+// member of by org and target, the largest limit of each target
+func (auth *Auth) groupQuotas(user *UserInfo) map[int64]map[string]int64 {
+	quotas := map[int64]map[string]int64{}
+	for _, group := range auth.server.matchingGroups(user) {
+		if len(group.Quotas) == 0 {
+			continue
+		}
+
+		if quotas[group.OrgId] == nil {
+			quotas[group.OrgId] = map[string]int64{}
+		}
+		for target, limit := range group.Quotas {
+			current, ok := quotas[group.OrgId][target]
+			if !ok || isLargerQuota(limit, current) {
+				quotas[group.OrgId][target] = limit
+			}
+		}
+	}
+	return quotas
+}
+
+// ApplyGroupQuotas raises the quotas of the orgs of the group mappings
+// of the user to the quotas of these mappings, the larger org quotas
+// and the protected orgs are left as they are
+func (auth *Auth) ApplyGroupQuotas(user *UserInfo) error {
+	if !setting.Quota.Enabled || IsProtectedUser(user) {
+		return nil
+	}
+
+	defaults := setting.Quota.Org.ToMap()
+	for orgId, quotas := range auth.groupQuotas(user) {
+		if isProtectedOrg(orgId) {
+			continue
+		}
+
+		for target, limit := range quotas {
+			query := &models.GetOrgQuotaByTargetQuery{OrgId: orgId, Target: target, Default: defaults[target]}
+			if err := bus.Dispatch(query); err != nil {
+				return err
+			}
+			if !isLargerQuota(limit, query.Result.Limit) {
+				continue
+			}
+
+			auth.log.Info("Raising the org quota of the LDAP group", "login", user.Username, "orgId", orgId,
+				"target", target, "limit", limit, "previousLimit", query.Result.Limit)
+			if err := bus.Dispatch(&models.UpdateOrgQuotaCmd{OrgId: orgId, Target: target, Limit: limit}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// isLargerQuota checks if the limit is larger than the other one, the
+// negative limits being unlimited
+func isLargerQuota(limit, other int64) bool {
+	if other < 0 {
+		return false
+	}
+	return limit < 0 || limit > other
+}
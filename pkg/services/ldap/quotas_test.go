@@ -0,0 +1,75 @@
+package ldap
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+func TestGroupQuotas(t *testing.T) {
+	Convey("Quotas of the group mappings", t, func() {
+		defer bus.ClearBusHandlers()
+		defer func(quota setting.QuotaSettings) { setting.Quota = quota }(setting.Quota)
+		setting.Quota = setting.QuotaSettings{Enabled: true, Org: &setting.OrgQuota{Dashboard: 10, ApiKey: 10}}
+
+		server := &ServerConfig{
+			Groups: []*GroupToOrgRole{
+				{GroupDN: "cn=power-users", OrgId: 1, OrgRole: models.ROLE_EDITOR, Quotas: map[string]int64{"dashboard": 500, "api_key": 50}},
+				{GroupDN: "cn=unlimited", OrgId: 1, OrgRole: models.ROLE_EDITOR, Quotas: map[string]int64{"dashboard": -1}},
+				{GroupDN: "cn=users", OrgId: 2, OrgRole: models.ROLE_VIEWER, Quotas: map[string]int64{"dashboard": 20}},
+			},
+		}
+		auth := New(server).(*Auth)
+
+		quotas := map[int64]map[string]int64{2: {"dashboard": 100}}
+		var updated []*models.UpdateOrgQuotaCmd
+		bus.AddHandler("test", func(query *models.GetOrgQuotaByTargetQuery) error {
+			limit, ok := quotas[query.OrgId][query.Target]
+			if !ok {
+				limit = query.Default
+			}
+			query.Result = &models.OrgQuotaDTO{OrgId: query.OrgId, Target: query.Target, Limit: limit}
+			return nil
+		})
+		bus.AddHandler("test", func(cmd *models.UpdateOrgQuotaCmd) error {
+			updated = append(updated, cmd)
+			return nil
+		})
+
+		Convey("Should take the largest limit of the groups of the user", func() {
+			user := &UserInfo{Username: "roel", MemberOf: []string{"cn=power-users", "cn=unlimited", "cn=users"}}
+			So(auth.groupQuotas(user), ShouldResemble, map[int64]map[string]int64{
+				1: {"dashboard": -1, "api_key": 50},
+				2: {"dashboard": 20},
+			})
+		})
+
+		Convey("Should only raise the org quotas", func() {
+			user := &UserInfo{Username: "roel", MemberOf: []string{"cn=power-users", "cn=users"}}
+			So(auth.ApplyGroupQuotas(user), ShouldBeNil)
+			So(updated, ShouldHaveLength, 2)
+			for _, cmd := range updated {
+				So(cmd.OrgId, ShouldEqual, 1)
+				So(cmd.Limit, ShouldEqual, server.Groups[0].Quotas[cmd.Target])
+			}
+		})
+
+		Convey("Should not apply the quotas when they're disabled", func() {
+			setting.Quota.Enabled = false
+			So(auth.ApplyGroupQuotas(&UserInfo{MemberOf: []string{"cn=power-users"}}), ShouldBeNil)
+			So(updated, ShouldBeEmpty)
+		})
+
+		Convey("Should reject the targets that aren't org quotas", func() {
+			server.Groups[0].Quotas["alert"] = 10
+			So(validateGroupQuotas(server), ShouldNotBeNil)
+
+			delete(server.Groups[0].Quotas, "alert")
+			So(validateGroupQuotas(server), ShouldBeNil)
+		})
+	})
+}
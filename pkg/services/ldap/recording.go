@@ -0,0 +1,465 @@
+package ldap
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/xerrors"
+	LDAP "gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// The operations of the recorded exchanges
+const (
+	RecordedBind                = "bind"
+	RecordedUnauthenticatedBind = "unauthenticated_bind"
+	RecordedSimpleBind          = "simple_bind"
+	RecordedSearch              = "search"
+)
+
+// secretAttributes are the attributes left out of the recorded entries,
+// on top of the second_factor_seed_attribute of the server
+var secretAttributes = []string{
+	"userPassword",
+	"unicodePwd",
+	"authPassword",
+	"sambaNTPassword",
+	"sambaLMPassword",
+	"krbPrincipalKey",
+	"ipaNTHash",
+}
+
+// RecordedExchange is a request of the connection to the LDAP server and
+// its response. The passwords of the binds aren't recorded
+type RecordedExchange struct {
+	Operation string          `json:"operation"`
+	Username  string          `json:"username,omitempty"`
+	Search    *RecordedQuery  `json:"search,omitempty"`
+	Result    *RecordedResult `json:"result,omitempty"`
+	Error     *RecordedError  `json:"error,omitempty"`
+}
+
+// RecordedQuery is the search of a recorded exchange
+type RecordedQuery struct {
+	BaseDN     string   `json:"baseDN"`
+	Scope      int      `json:"scope"`
+	Filter     string   `json:"filter"`
+	Attributes []string `json:"attributes"`
+}
+
+// RecordedResult is the result of a recorded search or simple bind
+type RecordedResult struct {
+	Entries   []*RecordedEntry   `json:"entries,omitempty"`
+	Referrals []string           `json:"referrals,omitempty"`
+	Controls  []*RecordedControl `json:"controls,omitempty"`
+}
+
+// RecordedControl is a response control, its value being the JSON of the
+// ldap.v3 type of the control
+type RecordedControl struct {
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+// RecordedEntry is an entry of a recorded search
+type RecordedEntry struct {
+	DN         string              `json:"dn"`
+	Attributes map[string][]string `json:"attributes"`
+}
+
+// RecordedError is the error of a recorded exchange
+type RecordedError struct {
+	ResultCode uint16 `json:"resultCode,omitempty"`
+	Message    string `json:"message"`
+}
+
+// recorder appends the exchanges to the record_file of [auth.ldap]
+var recorder = &exchangeRecorder{}
+
+type exchangeRecorder struct {
+	mutex sync.Mutex
+	path  string
+	file  *os.File
+}
+
+// record appends the exchange to the record file, opened on the first
+// exchange. It's only meant for debugging, so the errors are logged only
+func (recorder *exchangeRecorder) record(exchange *RecordedExchange) {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	if recorder.file == nil || recorder.path != setting.LdapRecordFile {
+		if recorder.file != nil {
+			recorder.file.Close()
+		}
+		file, err := os.OpenFile(setting.LdapRecordFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			logger.Error("Failed to open the LDAP record file", "file", setting.LdapRecordFile, "error", err)
+			return
+		}
+		recorder.path, recorder.file = setting.LdapRecordFile, file
+	}
+
+	line, err := json.Marshal(exchange)
+	if err == nil {
+		_, err = recorder.file.Write(append(line, '\n'))
+	}
+	if err != nil {
+		logger.Error("Failed to record the LDAP exchange", "file", recorder.path, "error", err)
+	}
+}
+
+// recordedConnection records the binds and searches of the connection
+type recordedConnection struct {
+	IConnection
+	secrets []string
+}
+
+// recordConnection wraps the connection to record its exchanges, if record_file is set
+func recordConnection(conn IConnection, server *ServerConfig) IConnection {
+	if setting.LdapRecordFile == "" {
+		return conn
+	}
+
+	secrets := secretAttributes
+	if server.SecondFactorSeedAttribute != "" {
+		secrets = append(append([]string(nil), secrets...), server.SecondFactorSeedAttribute)
+	}
+	return &recordedConnection{IConnection: conn, secrets: secrets}
+}
+
+func (conn *recordedConnection) Bind(username, password string) error {
+	err := conn.IConnection.Bind(username, password)
+	recorder.record(&RecordedExchange{Operation: RecordedBind, Username: username, Error: recordError(err)})
+	return err
+}
+
+func (conn *recordedConnection) UnauthenticatedBind(username string) error {
+	err := conn.IConnection.UnauthenticatedBind(username)
+	recorder.record(&RecordedExchange{Operation: RecordedUnauthenticatedBind, Username: username, Error: recordError(err)})
+	return err
+}
+
+func (conn *recordedConnection) SimpleBind(request *LDAP.SimpleBindRequest) (*LDAP.SimpleBindResult, error) {
+	result, err := conn.IConnection.SimpleBind(request)
+
+	exchange := &RecordedExchange{Operation: RecordedSimpleBind, Username: request.Username, Error: recordError(err)}
+	if result != nil {
+		exchange.Result = &RecordedResult{Controls: recordControls(result.Controls)}
+	}
+	recorder.record(exchange)
+
+	return result, err
+}
+
+func (conn *recordedConnection) Search(request *LDAP.SearchRequest) (*LDAP.SearchResult, error) {
+	result, err := conn.IConnection.Search(request)
+
+	exchange := &RecordedExchange{
+		Operation: RecordedSearch,
+		Search: &RecordedQuery{
+			BaseDN:     request.BaseDN,
+			Scope:      request.Scope,
+			Filter:     request.Filter,
+			Attributes: request.Attributes,
+		},
+		Error: recordError(err),
+	}
+	if result != nil {
+		exchange.Result = &RecordedResult{
+			Referrals: result.Referrals,
+			Controls:  recordControls(result.Controls),
+		}
+		for _, entry := range result.Entries {
+			recorded := &RecordedEntry{DN: entry.DN, Attributes: map[string][]string{}}
+			for _, attribute := range entry.Attributes {
+				if !isSecretAttribute(conn.secrets, attribute.Name) {
+					recorded.Attributes[attribute.Name] = attribute.Values
+				}
+			}
+			exchange.Result.Entries = append(exchange.Result.Entries, recorded)
+		}
+	}
+	recorder.record(exchange)
+
+	return result, err
+}
+
+func (conn *recordedConnection) SearchStream(request *LDAP.SearchRequest, pagingSize uint32, handle EntryHandler) error {
+	return streamSearch(conn, request, pagingSize, handle)
+}
+
+func isSecretAttribute(secrets []string, name string) bool {
+	for _, secret := range secrets {
+		if strings.EqualFold(secret, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func recordError(err error) *RecordedError {
+	if err == nil {
+		return nil
+	}
+
+	if ldapErr, ok := err.(*LDAP.Error); ok {
+		recorded := &RecordedError{ResultCode: ldapErr.ResultCode}
+		if ldapErr.Err != nil {
+			recorded.Message = ldapErr.Err.Error()
+		}
+		return recorded
+	}
+	return &RecordedError{Message: err.Error()}
+}
+
+func recordControls(controls []LDAP.Control) []*RecordedControl {
+	var recorded []*RecordedControl
+	for _, control := range controls {
+		value, err := json.Marshal(control)
+		if err != nil {
+			continue
+		}
+		recorded = append(recorded, &RecordedControl{Type: control.GetControlType(), Value: value})
+	}
+	return recorded
+}
+
+// ReadRecording reads the exchanges recorded in the record_file format
+func ReadRecording(reader io.Reader) ([]*RecordedExchange, error) {
+	exchanges := []*RecordedExchange{}
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		exchange := &RecordedExchange{}
+		if err := json.Unmarshal(scanner.Bytes(), exchange); err != nil {
+			return nil, xerrors.Errorf("invalid recorded exchange on line %d: %w", line, err)
+		}
+		exchanges = append(exchanges, exchange)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return exchanges, nil
+}
+
+// ReplayConnection is a connection answering with the recorded exchanges
+// of a directory, to reproduce its behaviour in the tests. Each request is
+// answered with the first unused exchange matching it, or with the last one
+// once it's used. The binds match on the username, any password is accepted
+type ReplayConnection struct {
+	mutex     sync.Mutex
+	exchanges []*RecordedExchange
+	used      []bool
+}
+
+// NewReplayConnection returns the connection replaying the exchanges of the record file
+func NewReplayConnection(path string) (*ReplayConnection, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	exchanges, err := ReadRecording(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return ReplayExchanges(exchanges), nil
+}
+
+// ReplayExchanges returns the connection replaying the exchanges
+func ReplayExchanges(exchanges []*RecordedExchange) *ReplayConnection {
+	return &ReplayConnection{
+		exchanges: exchanges,
+		used:      make([]bool, len(exchanges)),
+	}
+}
+
+// replay returns the exchange matching the request
+func (conn *ReplayConnection) replay(matches func(*RecordedExchange) bool) (*RecordedExchange, bool) {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+
+	last := -1
+	for i, exchange := range conn.exchanges {
+		if !matches(exchange) {
+			continue
+		}
+		if !conn.used[i] {
+			conn.used[i] = true
+			return exchange, true
+		}
+		last = i
+	}
+
+	if last < 0 {
+		return nil, false
+	}
+	return conn.exchanges[last], true
+}
+
+func (conn *ReplayConnection) bind(operation string, username string) (*RecordedExchange, error) {
+	exchange, ok := conn.replay(func(exchange *RecordedExchange) bool {
+		return exchange.Operation == operation && strings.EqualFold(exchange.Username, username)
+	})
+	if !ok {
+		return nil, xerrors.Errorf("no recorded %s of %q", operation, username)
+	}
+	return exchange, replayError(exchange.Error)
+}
+
+func (conn *ReplayConnection) Bind(username, password string) error {
+	_, err := conn.bind(RecordedBind, username)
+	return err
+}
+
+func (conn *ReplayConnection) UnauthenticatedBind(username string) error {
+	_, err := conn.bind(RecordedUnauthenticatedBind, username)
+	return err
+}
+
+func (conn *ReplayConnection) SimpleBind(request *LDAP.SimpleBindRequest) (*LDAP.SimpleBindResult, error) {
+	exchange, err := conn.bind(RecordedSimpleBind, request.Username)
+	if exchange == nil || (exchange.Result == nil && err != nil) {
+		return nil, err
+	}
+	if exchange.Result == nil {
+		return &LDAP.SimpleBindResult{}, nil
+	}
+
+	controls, controlsErr := replayControls(exchange.Result.Controls)
+	if controlsErr != nil {
+		return nil, controlsErr
+	}
+	return &LDAP.SimpleBindResult{Controls: controls}, err
+}
+
+func (conn *ReplayConnection) Search(request *LDAP.SearchRequest) (*LDAP.SearchResult, error) {
+	exchange, ok := conn.replay(func(exchange *RecordedExchange) bool {
+		return exchange.Operation == RecordedSearch && exchange.Search != nil &&
+			strings.EqualFold(exchange.Search.BaseDN, request.BaseDN) &&
+			exchange.Search.Scope == request.Scope &&
+			exchange.Search.Filter == request.Filter &&
+			sameAttributes(exchange.Search.Attributes, request.Attributes)
+	})
+	if !ok {
+		return nil, xerrors.Errorf("no recorded search of %q in %q", request.Filter, request.BaseDN)
+	}
+	if exchange.Result == nil {
+		return nil, replayError(exchange.Error)
+	}
+
+	controls, err := replayControls(exchange.Result.Controls)
+	if err != nil {
+		return nil, err
+	}
+	result := &LDAP.SearchResult{
+		Entries:   []*LDAP.Entry{},
+		Referrals: exchange.Result.Referrals,
+		Controls:  controls,
+	}
+	for _, entry := range exchange.Result.Entries {
+		result.Entries = append(result.Entries, replayEntry(entry))
+	}
+
+	return result, replayError(exchange.Error)
+}
+
+func (conn *ReplayConnection) SearchStream(request *LDAP.SearchRequest, pagingSize uint32, handle EntryHandler) error {
+	return streamSearch(conn, request, pagingSize, handle)
+}
+
+func (conn *ReplayConnection) StartTLS(*tls.Config) error {
+	return nil
+}
+
+func (conn *ReplayConnection) Close() {}
+
+// replayEntry is the entry of the recorded one, its attributes sorted by name
+func replayEntry(recorded *RecordedEntry) *LDAP.Entry {
+	names := make([]string, 0, len(recorded.Attributes))
+	for name := range recorded.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	entry := &LDAP.Entry{DN: recorded.DN}
+	for _, name := range names {
+		entry.Attributes = append(entry.Attributes, LDAP.NewEntryAttribute(name, recorded.Attributes[name]))
+	}
+	return entry
+}
+
+func replayError(recorded *RecordedError) error {
+	if recorded == nil {
+		return nil
+	}
+	if recorded.ResultCode == 0 {
+		return errors.New(recorded.Message)
+	}
+	return &LDAP.Error{ResultCode: recorded.ResultCode, Err: errors.New(recorded.Message)}
+}
+
+func replayControls(recorded []*RecordedControl) ([]LDAP.Control, error) {
+	var controls []LDAP.Control
+	for _, control := range recorded {
+		var replayed LDAP.Control
+		switch control.Type {
+		case LDAP.ControlTypePaging:
+			replayed = &LDAP.ControlPaging{}
+		case LDAP.ControlTypeBeheraPasswordPolicy:
+			replayed = &LDAP.ControlBeheraPasswordPolicy{}
+		case LDAP.ControlTypeVChuPasswordMustChange:
+			replayed = &LDAP.ControlVChuPasswordMustChange{}
+		case LDAP.ControlTypeVChuPasswordWarning:
+			replayed = &LDAP.ControlVChuPasswordWarning{}
+		case LDAP.ControlTypeManageDsaIT:
+			replayed = &LDAP.ControlManageDsaIT{}
+		default:
+			replayed = &LDAP.ControlString{}
+		}
+
+		if err := json.Unmarshal(control.Value, replayed); err != nil {
+			return nil, xerrors.Errorf("invalid recorded control %q: %w", control.Type, err)
+		}
+		controls = append(controls, replayed)
+	}
+	return controls, nil
+}
+
+// sameAttributes checks if the searches ask for the same attributes, in any order
+func sameAttributes(recorded []string, requested []string) bool {
+	if len(recorded) != len(requested) {
+		return false
+	}
+
+	count := map[string]int{}
+	for _, attribute := range recorded {
+		count[strings.ToLower(attribute)]++
+	}
+	for _, attribute := range requested {
+		count[strings.ToLower(attribute)]--
+	}
+	for _, n := range count {
+		if n != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,104 @@
+package ldap
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	LDAP "gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+func TestRecording(t *testing.T) {
+	Convey("Record and replay the exchanges", t, func() {
+		dir, err := ioutil.TempDir("", "ldap-recording")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		setting.LdapRecordFile = filepath.Join(dir, "ldap.jsonl")
+		defer func() {
+			setting.LdapRecordFile = ""
+			recorder.file.Close()
+			recorder.file = nil
+		}()
+
+		policy := LDAP.NewControlBeheraPasswordPolicy()
+		policy.Expire = 3600
+		mock := &mockLdapConn{
+			bindProvider: func(username, password string) error {
+				if password != "secret" {
+					return &LDAP.Error{ResultCode: LDAP.LDAPResultInvalidCredentials}
+				}
+				return nil
+			},
+			simpleBindProvider: func(request *LDAP.SimpleBindRequest) (*LDAP.SimpleBindResult, error) {
+				return &LDAP.SimpleBindResult{Controls: []LDAP.Control{policy}}, nil
+			},
+			searchProvider: func(request *LDAP.SearchRequest) (*LDAP.SearchResult, error) {
+				return &LDAP.SearchResult{Entries: []*LDAP.Entry{
+					LDAP.NewEntry("cn=roel,dc=grafana,dc=org", map[string][]string{
+						"cn":           {"roel"},
+						"memberOf":     {"cn=admins,dc=grafana,dc=org"},
+						"userPassword": {"{SSHA}hash"},
+						"totpSeed":     {"JBSWY3DPEHPK3PXP"},
+					}),
+				}}, nil
+			},
+		}
+		conn := recordConnection(mock, &ServerConfig{SecondFactorSeedAttribute: "totpSeed"})
+
+		So(conn.Bind("cn=roel,dc=grafana,dc=org", "secret"), ShouldBeNil)
+		So(conn.Bind("cn=roel,dc=grafana,dc=org", "wrong"), ShouldNotBeNil)
+		_, err = conn.SimpleBind(LDAP.NewSimpleBindRequest("cn=roel,dc=grafana,dc=org", "secret", nil))
+		So(err, ShouldBeNil)
+		request := &LDAP.SearchRequest{
+			BaseDN:     "dc=grafana,dc=org",
+			Scope:      LDAP.ScopeWholeSubtree,
+			Filter:     "(cn=roel)",
+			Attributes: []string{"cn", "memberOf"},
+		}
+		_, err = conn.Search(request)
+		So(err, ShouldBeNil)
+
+		Convey("Should not record the secrets", func() {
+			recorded, err := ioutil.ReadFile(setting.LdapRecordFile)
+			So(err, ShouldBeNil)
+			So(string(recorded), ShouldNotContainSubstring, "secret")
+			So(string(recorded), ShouldNotContainSubstring, "{SSHA}hash")
+			So(string(recorded), ShouldNotContainSubstring, "JBSWY3DPEHPK3PXP")
+		})
+
+		Convey("Should replay the exchanges", func() {
+			replay, err := NewReplayConnection(setting.LdapRecordFile)
+			So(err, ShouldBeNil)
+
+			So(replay.Bind("cn=roel,dc=grafana,dc=org", ""), ShouldBeNil)
+			err = replay.Bind("CN=roel,dc=grafana,dc=org", "")
+			So(LDAP.IsErrorWithCode(err, LDAP.LDAPResultInvalidCredentials), ShouldBeTrue)
+
+			// The last exchange is replayed once they are all used
+			err = replay.Bind("cn=roel,dc=grafana,dc=org", "")
+			So(LDAP.IsErrorWithCode(err, LDAP.LDAPResultInvalidCredentials), ShouldBeTrue)
+
+			result, err := replay.SimpleBind(LDAP.NewSimpleBindRequest("cn=roel,dc=grafana,dc=org", "secret", nil))
+			So(err, ShouldBeNil)
+			So(result.Controls, ShouldHaveLength, 1)
+			So(result.Controls[0].(*LDAP.ControlBeheraPasswordPolicy).Expire, ShouldEqual, 3600)
+
+			request.Attributes = []string{"memberOf", "cn"}
+			searchResult, err := replay.Search(request)
+			So(err, ShouldBeNil)
+			So(searchResult.Entries, ShouldHaveLength, 1)
+			So(searchResult.Entries[0].GetAttributeValue("cn"), ShouldEqual, "roel")
+			So(searchResult.Entries[0].GetAttributeValues("memberOf"), ShouldResemble, []string{"cn=admins,dc=grafana,dc=org"})
+
+			request.Filter = "(cn=tod)"
+			_, err = replay.Search(request)
+			So(err, ShouldNotBeNil)
+			So(replay.Bind("cn=tod,dc=grafana,dc=org", ""), ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,125 @@
+package ldap
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+
+	"github.com/davecgh/go-spew/spew"
+	"github.com/inconshreveable/log15"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+const (
+	// LogRedactionNone logs the usernames, DNs and emails as they are
+	LogRedactionNone = "none"
+
+	// LogRedactionHash replaces them with a hash keyed with the secret key
+	LogRedactionHash = "hash"
+
+	// LogRedactionMask keeps their first character only
+	LogRedactionMask = "mask"
+)
+
+// emailPattern matches emails like "roel@grafana.org"
+var emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+
+// redactedKeys are the log keys whose whole value identifies the user
+var redactedKeys = map[string]bool{
+	"username": true,
+	"login":    true,
+	"user":     true,
+	"email":    true,
+	"dn":       true,
+}
+
+// NewLogger returns a logger applying the log_redaction setting
+func NewLogger(name string, ctx ...interface{}) log.Logger {
+	logger := log.New(name, ctx...)
+	logger.SetHandler(redactionHandler(logger.GetHandler()))
+	return logger
+}
+
+// redactionHandler redacts the records before passing them to handler,
+// the setting is read when logging since loggers are created before it's loaded
+func redactionHandler(handler log15.Handler) log15.Handler {
+	return log15.FuncHandler(func(r *log15.Record) error {
+		if setting.LdapLogRedaction == "" || setting.LdapLogRedaction == LogRedactionNone {
+			return handler.Log(r)
+		}
+
+		redactedRecord := *r
+		redactedRecord.Msg = redactText(r.Msg)
+		redactedRecord.Ctx = make([]interface{}, len(r.Ctx))
+		for i := 0; i < len(r.Ctx); i += 2 {
+			redactedRecord.Ctx[i] = r.Ctx[i]
+			if i+1 < len(r.Ctx) {
+				key, _ := r.Ctx[i].(string)
+				redactedRecord.Ctx[i+1] = redactLogValue(key, r.Ctx[i+1])
+			}
+		}
+
+		return handler.Log(&redactedRecord)
+	})
+}
+
+func redactLogValue(key string, value interface{}) interface{} {
+	if redactedKeys[key] {
+		return redactValue(fmt.Sprint(value))
+	}
+
+	switch value := value.(type) {
+	case string:
+		return redactText(value)
+	case error:
+		return redactText(value.Error())
+	case []string:
+		result := make([]string, len(value))
+		for i, text := range value {
+			result[i] = redactText(text)
+		}
+		return result
+	}
+
+	return value
+}
+
+// redactText redacts the DNs and emails in text
+func redactText(text string) string {
+	text = emailPattern.ReplaceAllStringFunc(text, redactValue)
+	return dnPattern.ReplaceAllStringFunc(text, redactValue)
+}
+
+// redactValue hashes or masks value according to the log_redaction setting
+func redactValue(value string) string {
+	switch setting.LdapLogRedaction {
+	case LogRedactionNone, "":
+		return value
+	case LogRedactionHash:
+		mac := hmac.New(sha256.New, []byte(setting.SecretKey))
+		mac.Write([]byte(value))
+		return "hash:" + hex.EncodeToString(mac.Sum(nil))[:12]
+	}
+
+	// unknown modes mask too, so a typo doesn't leak the values
+	for _, first := range value {
+		return string(first) + "***"
+	}
+	return ""
+}
+
+// dumpUser dumps user for the debug logs, the handler redacts the DNs and emails
+// in the dump but can't tell the username apart so it's redacted here
+func dumpUser(user *UserInfo) string {
+	if setting.LdapLogRedaction == "" || setting.LdapLogRedaction == LogRedactionNone {
+		return spew.Sdump(user)
+	}
+
+	redactedUser := *user
+	redactedUser.Username = redactValue(user.Username)
+	return spew.Sdump(&redactedUser)
+}
@@ -0,0 +1,78 @@
+package ldap
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/inconshreveable/log15"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+func TestLogRedaction(t *testing.T) {
+	Convey("redactionHandler", t, func() {
+		var logged *log15.Record
+		handler := redactionHandler(log15.FuncHandler(func(r *log15.Record) error {
+			logged = r
+			return nil
+		}))
+		log := func(ctx ...interface{}) []interface{} {
+			So(handler.Log(&log15.Record{Msg: "Searching", Ctx: ctx}), ShouldBeNil)
+			return logged.Ctx
+		}
+		defer func() { setting.LdapLogRedaction = LogRedactionNone }()
+
+		Convey("Should leave the logs as they are by default", func() {
+			setting.LdapLogRedaction = LogRedactionNone
+
+			ctx := log("username", "roel", "filter", "(uid=roel)")
+			So(ctx, ShouldResemble, []interface{}{"username", "roel", "filter", "(uid=roel)"})
+		})
+
+		Convey("Should mask the usernames, DNs and emails", func() {
+			setting.LdapLogRedaction = LogRedactionMask
+
+			ctx := log(
+				"username", "roel",
+				"error", errors.New("no entry for roel@grafana.org"),
+				"groups", []string{"cn=admins,dc=grafana,dc=org"},
+				"count", 2,
+			)
+			So(ctx, ShouldResemble, []interface{}{
+				"username", "r***",
+				"error", "no entry for r***",
+				"groups", []string{"c***"},
+				"count", 2,
+			})
+		})
+
+		Convey("Should hash them consistently with the secret key", func() {
+			setting.LdapLogRedaction = LogRedactionHash
+			secretKey := setting.SecretKey
+			defer func() { setting.SecretKey = secretKey }()
+			setting.SecretKey = "secret"
+
+			first := log("username", "roel")[1]
+			So(first, ShouldStartWith, "hash:")
+			So(first, ShouldNotContainSubstring, "roel")
+			So(log("username", "roel")[1], ShouldEqual, first)
+
+			setting.SecretKey = "other"
+			So(log("username", "roel")[1], ShouldNotEqual, first)
+		})
+
+		Convey("Should mask with unknown modes", func() {
+			setting.LdapLogRedaction = "hsah"
+
+			So(log("dn", "cn=roel,dc=grafana,dc=org")[1], ShouldEqual, "c***")
+		})
+	})
+
+	Convey("dumpUser", t, func() {
+		defer func() { setting.LdapLogRedaction = LogRedactionNone }()
+		setting.LdapLogRedaction = LogRedactionMask
+
+		So(dumpUser(&UserInfo{Username: "roel"}), ShouldNotContainSubstring, "roel")
+	})
+}
@@ -0,0 +1,54 @@
+package ldap
+
+import (
+	opentracing "github.com/opentracing/opentracing-go"
+	jaeger "github.com/uber/jaeger-client-go"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	models "github.com/grafana/grafana/pkg/models"
+)
+
+// RequestLogger returns the logger with the ID of the request ctx belongs
+// to, so the LDAP logs of a login can be matched to its web logs
+func RequestLogger(logger log.Logger, ctx *models.ReqContext) log.Logger {
+	id := requestID(ctx)
+	if id == "" {
+		return logger
+	}
+
+	return logger.New("requestID", id)
+}
+
+// requestID returns the X-Request-Id set by a proxy in front of Grafana,
+// or the trace ID of the request if tracing is enabled
+func requestID(ctx *models.ReqContext) string {
+	if ctx == nil || ctx.Context == nil || ctx.Req.Request == nil {
+		return ""
+	}
+
+	if id := ctx.Req.Header.Get("X-Request-Id"); id != "" {
+		return id
+	}
+
+	span := opentracing.SpanFromContext(ctx.Req.Context())
+	if span == nil {
+		return ""
+	}
+
+	if spanContext, ok := span.Context().(jaeger.SpanContext); ok {
+		return spanContext.TraceID().String()
+	}
+
+	return ""
+}
+
+// logForRequest makes the logs of auth carry the ID of the
+// request until the returned function is called
+func (auth *Auth) logForRequest(ctx *models.ReqContext) func() {
+	logger := auth.log
+	auth.log = RequestLogger(logger, ctx)
+
+	return func() {
+		auth.log = logger
+	}
+}
@@ -0,0 +1,47 @@
+package ldap
+
+import (
+	"net/http"
+	"testing"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	. "github.com/smartystreets/goconvey/convey"
+	jaeger "github.com/uber/jaeger-client-go"
+	"gopkg.in/macaron.v1"
+
+	models "github.com/grafana/grafana/pkg/models"
+)
+
+func TestRequestID(t *testing.T) {
+	Convey("requestID", t, func() {
+		newContext := func(req *http.Request) *models.ReqContext {
+			return &models.ReqContext{
+				Context: &macaron.Context{Req: macaron.Request{Request: req}},
+			}
+		}
+
+		Convey("Should be empty without request", func() {
+			So(requestID(nil), ShouldBeEmpty)
+			So(requestID(&models.ReqContext{}), ShouldBeEmpty)
+		})
+
+		Convey("Should use the X-Request-Id header", func() {
+			req, _ := http.NewRequest("POST", "/login", nil)
+			req.Header.Set("X-Request-Id", "abc-123")
+
+			So(requestID(newContext(req)), ShouldEqual, "abc-123")
+		})
+
+		Convey("Should use the trace ID of the request", func() {
+			tracer, closer := jaeger.NewTracer("grafana", jaeger.NewConstSampler(true), jaeger.NewNullReporter())
+			defer closer.Close()
+			span := tracer.StartSpan("HTTP POST /login")
+			defer span.Finish()
+
+			req, _ := http.NewRequest("POST", "/login", nil)
+			req = req.WithContext(opentracing.ContextWithSpan(req.Context(), span))
+
+			So(requestID(newContext(req)), ShouldEqual, span.Context().(jaeger.SpanContext).TraceID().String())
+		})
+	})
+}
@@ -0,0 +1,85 @@
+package ldap
+
+import (
+	"golang.org/x/xerrors"
+
+	"github.com/grafana/grafana/pkg/infra/metrics"
+)
+
+// requiredAttributeValues returns the values of the attributes of
+// [servers.attributes] the required_attributes can name
+func requiredAttributeValues(user *UserInfo) map[string]string {
+	memberOf := ""
+	if len(user.MemberOf) > 0 {
+		memberOf = user.MemberOf[0]
+	}
+
+	return map[string]string{
+		"username":  user.Username,
+		"name":      user.FirstName,
+		"surname":   user.LastName,
+		"email":     user.Email,
+		"member_of": memberOf,
+	}
+}
+
+// validateRequiredAttributes checks each required attribute is one of
+// [servers.attributes] and is mapped to an LDAP attribute
+func validateRequiredAttributes(server *ServerConfig) error {
+	mapped := map[string]string{
+		"username":  server.Attr.Username,
+		"name":      server.Attr.Name,
+		"surname":   server.Attr.Surname,
+		"email":     server.Attr.Email,
+		"member_of": server.Attr.MemberOf,
+	}
+
+	for _, name := range server.RequiredAttributes {
+		attribute, ok := mapped[name]
+		if !ok {
+			return xerrors.Errorf("unknown required attribute %q, it must be username, name, surname, email or member_of", name)
+		}
+		if attribute == "" {
+			return xerrors.Errorf("the required attribute %q is not mapped in [servers.attributes]", name)
+		}
+	}
+	return nil
+}
+
+// missingAttribute returns the first of the required attributes the user
+// has no value for, empty if it has them all
+func missingAttribute(user *UserInfo, required []string) string {
+	values := requiredAttributeValues(user)
+	for _, name := range required {
+		if values[name] == "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// skipIncompleteUsers leaves out the users missing one of the
+// required_attributes, and logs and counts them
+func (auth *Auth) skipIncompleteUsers(users []*UserInfo) []*UserInfo {
+	if len(auth.server.RequiredAttributes) == 0 {
+		return users
+	}
+
+	complete := make([]*UserInfo, 0, len(users))
+	skipped := 0
+	for _, user := range users {
+		if name := missingAttribute(user, auth.server.RequiredAttributes); name != "" {
+			auth.log.Debug("Skipping the LDAP entry missing a required attribute", "dn", user.DN, "attribute", name)
+			skipped++
+			continue
+		}
+		complete = append(complete, user)
+	}
+
+	if skipped > 0 {
+		auth.log.Warn("Skipped the LDAP entries missing a required attribute", "host", auth.server.Host,
+			"skipped", skipped, "required_attributes", auth.server.RequiredAttributes)
+		metrics.M_Ldap_Incomplete_Entries.WithLabelValues(auth.server.Host).Add(float64(skipped))
+	}
+	return complete
+}
@@ -0,0 +1,45 @@
+package ldap
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+)
+
+func TestRequiredAttributes(t *testing.T) {
+	Convey("validateRequiredAttributes", t, func() {
+		server := &ServerConfig{Attr: AttributeMap{Username: "uid", Email: "mail"}}
+
+		server.RequiredAttributes = []string{"username", "email"}
+		So(validateRequiredAttributes(server), ShouldBeNil)
+
+		server.RequiredAttributes = []string{"mail"}
+		So(validateRequiredAttributes(server), ShouldNotBeNil)
+
+		server.RequiredAttributes = []string{"surname"}
+		So(validateRequiredAttributes(server), ShouldNotBeNil)
+	})
+
+	Convey("skipIncompleteUsers", t, func() {
+		auth := &Auth{log: log.New("test-logger"), server: &ServerConfig{Host: "ldap.example.org"}}
+		users := []*UserInfo{
+			{DN: "uid=roel,dc=grafana,dc=org", Username: "roel", Email: "roel@grafana.org"},
+			{DN: "uid=tod,dc=grafana,dc=org", Username: "tod"},
+			{DN: "cn=printer,dc=grafana,dc=org", Email: "printer@grafana.org"},
+		}
+
+		Convey("Should keep all the users without required attributes", func() {
+			So(auth.skipIncompleteUsers(users), ShouldHaveLength, 3)
+		})
+
+		Convey("Should leave out the users missing a required attribute", func() {
+			auth.server.RequiredAttributes = []string{"username", "email"}
+
+			complete := auth.skipIncompleteUsers(users)
+			So(complete, ShouldHaveLength, 1)
+			So(complete[0].Username, ShouldEqual, "roel")
+		})
+	})
+}
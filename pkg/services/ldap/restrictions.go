@@ -0,0 +1,115 @@
+package ldap
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	LDAP "gopkg.in/ldap.v3"
+)
+
+var (
+	// ErrOutsideLogonHours is returned if the Active Directory logonHours
+	// of the user don't allow it to log in at this time
+	ErrOutsideLogonHours = errors.New("LDAP account is not allowed to log in at this time")
+
+	// ErrAccountExpired is returned if the Active Directory accountExpires
+	// of the user is in the past
+	ErrAccountExpired = errors.New("LDAP account has expired")
+)
+
+// The attributes of the Active Directory login restrictions
+const (
+	logonHoursAttribute     = "logonHours"
+	accountExpiresAttribute = "accountExpires"
+)
+
+// accountNeverExpires is the accountExpires of the accounts which never expire, like 0
+const accountNeverExpires = 1<<63 - 1
+
+// windowsEpochOffset is the number of 100 nanoseconds intervals
+// between the Windows epoch, 1601-01-01, and the Unix epoch
+const windowsEpochOffset = 116444736000000000
+
+// accountRestrictions are the Active Directory login restrictions of a user
+type accountRestrictions struct {
+	// logonHours has a bit for every hour of the week in UTC starting on
+	// Sunday at midnight, nil if the logins are allowed at any time
+	logonHours []byte
+	// expires is when the account expires, zero if it never does
+	expires time.Time
+}
+
+// readAccountRestrictions reads the login restrictions of the user entry
+func readAccountRestrictions(entry *LDAP.Entry) *accountRestrictions {
+	restrictions := &accountRestrictions{}
+
+	if hours := entry.GetRawAttributeValue(logonHoursAttribute); len(hours) > 0 {
+		restrictions.logonHours = hours
+	}
+
+	expires, err := strconv.ParseInt(entry.GetAttributeValue(accountExpiresAttribute), 10, 64)
+	if err == nil && expires > 0 && expires != accountNeverExpires {
+		intervals := expires - windowsEpochOffset
+		restrictions.expires = time.Unix(intervals/1e7, intervals%1e7*100).UTC()
+	}
+
+	return restrictions
+}
+
+// check returns the error of the restriction refusing a login at the
+// time, logonHours of the wrong size are refused like Windows does
+func (restrictions *accountRestrictions) check(at time.Time) error {
+	if !restrictions.expires.IsZero() && !at.Before(restrictions.expires) {
+		return ErrAccountExpired
+	}
+
+	if restrictions.logonHours != nil {
+		at = at.UTC()
+		hour := int(at.Weekday())*24 + at.Hour()
+		if len(restrictions.logonHours) != 21 || restrictions.logonHours[hour/8]&(1<<uint(hour%8)) == 0 {
+			return ErrOutsideLogonHours
+		}
+	}
+
+	return nil
+}
+
+// restrictionCodes are the Active Directory sub-codes of the invalid
+// credentials errors the directory returns for the restricted accounts
+var restrictionCodes = map[string]error{
+	"data 530": ErrOutsideLogonHours, // ERROR_INVALID_LOGON_HOURS
+	"data 701": ErrAccountExpired,    // ERROR_ACCOUNT_EXPIRED
+}
+
+// restrictionError returns the restriction the directory refused the bind
+// for, or nil. Active Directory only reports them for valid passwords
+func restrictionError(err error) error {
+	ldapErr, ok := err.(*LDAP.Error)
+	if !ok || ldapErr.ResultCode != LDAP.LDAPResultInvalidCredentials || ldapErr.Err == nil {
+		return nil
+	}
+
+	for code, restriction := range restrictionCodes {
+		if strings.Contains(ldapErr.Err.Error(), code) {
+			return restriction
+		}
+	}
+	return nil
+}
+
+// checkAccountRestrictions refuses the login of user if its logonHours or
+// accountExpires don't allow it, when the server enforces them
+func (auth *Auth) checkAccountRestrictions(user *UserInfo) error {
+	if !auth.server.AccountRestrictions || user.restrictions == nil {
+		return nil
+	}
+
+	if err := user.restrictions.check(now()); err != nil {
+		auth.log.Info("Ldap Auth: login refused by the account restrictions", "username", user.Username, "reason", err)
+		return err
+	}
+
+	return nil
+}
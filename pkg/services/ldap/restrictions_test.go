@@ -0,0 +1,105 @@
+package ldap
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	. "github.com/smartystreets/goconvey/convey"
+	LDAP "gopkg.in/ldap.v3"
+)
+
+func TestAccountRestrictions(t *testing.T) {
+	Convey("readAccountRestrictions", t, func() {
+		Convey("Should read accountExpires", func() {
+			entry := LDAP.NewEntry("cn=user", map[string][]string{
+				// 2019-01-01T00:00:00Z
+				accountExpiresAttribute: {"131907744000000000"},
+			})
+
+			restrictions := readAccountRestrictions(entry)
+			So(restrictions.expires, ShouldResemble, time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+		})
+
+		Convey("Should read the accounts which never expire", func() {
+			for _, never := range []string{"0", "9223372036854775807", ""} {
+				entry := LDAP.NewEntry("cn=user", map[string][]string{accountExpiresAttribute: {never}})
+				So(readAccountRestrictions(entry).expires.IsZero(), ShouldBeTrue)
+			}
+		})
+	})
+
+	Convey("accountRestrictions.check", t, func() {
+		// 2019-06-03 is a Monday
+		monday := time.Date(2019, 6, 3, 10, 30, 0, 0, time.UTC)
+
+		Convey("Should allow the logins without restrictions", func() {
+			So((&accountRestrictions{}).check(monday), ShouldBeNil)
+		})
+
+		Convey("Should refuse the logins after the account expired", func() {
+			restrictions := &accountRestrictions{expires: monday.Add(-time.Hour)}
+			So(restrictions.check(monday), ShouldEqual, ErrAccountExpired)
+
+			restrictions = &accountRestrictions{expires: monday.Add(time.Hour)}
+			So(restrictions.check(monday), ShouldBeNil)
+		})
+
+		Convey("Should only allow the logins during the logon hours", func() {
+			hours := make([]byte, 21)
+			// Monday 10:00 to 11:00 UTC is the hour 24 + 10 of the week
+			hours[34/8] |= 1 << (34 % 8)
+			restrictions := &accountRestrictions{logonHours: hours}
+
+			So(restrictions.check(monday), ShouldBeNil)
+			So(restrictions.check(monday.Add(time.Hour)), ShouldEqual, ErrOutsideLogonHours)
+			So(restrictions.check(monday.In(time.FixedZone("UTC+2", 2*3600))), ShouldBeNil)
+		})
+
+		Convey("Should refuse the logon hours of the wrong size", func() {
+			So((&accountRestrictions{logonHours: []byte{0xff}}).check(monday), ShouldEqual, ErrOutsideLogonHours)
+		})
+	})
+
+	Convey("restrictionError", t, func() {
+		Convey("Should read the Active Directory sub-codes", func() {
+			So(restrictionError(&LDAP.Error{ResultCode: 49, Err: errors.New("AcceptSecurityContext error, data 530, v3839")}), ShouldEqual, ErrOutsideLogonHours)
+			So(restrictionError(&LDAP.Error{ResultCode: 49, Err: errors.New("AcceptSecurityContext error, data 701, v3839")}), ShouldEqual, ErrAccountExpired)
+			So(restrictionError(&LDAP.Error{ResultCode: 49, Err: errors.New("AcceptSecurityContext error, data 52e, v3839")}), ShouldBeNil)
+		})
+	})
+
+	Convey("Authenticate with account restrictions", t, func() {
+		entry := LDAP.NewEntry("cn=user,dc=grafana,dc=org", map[string][]string{
+			"username":              {"user"},
+			accountExpiresAttribute: {"131907744000000000"},
+		})
+		conn := &mockLdapConn{}
+		conn.setSearchResult(&LDAP.SearchResult{Entries: []*LDAP.Entry{entry}})
+		conn.bindProvider = func(username, password string) error { return nil }
+
+		auth := &Auth{
+			log:  log.New("test-logger"),
+			conn: conn,
+			server: &ServerConfig{
+				Attr:                AttributeMap{Username: "username"},
+				SearchBaseDNs:       []string{"dc=grafana,dc=org"},
+				AccountRestrictions: true,
+			},
+		}
+
+		Convey("Should refuse the expired accounts once the password is checked", func() {
+			user, err := auth.searchForUser("user", searchEverything)
+			So(err, ShouldBeNil)
+			So(auth.checkAccountRestrictions(user), ShouldEqual, ErrAccountExpired)
+		})
+
+		Convey("Should ignore the restrictions unless enforced", func() {
+			auth.server.AccountRestrictions = false
+			user, err := auth.searchForUser("user", searchEverything)
+			So(err, ShouldBeNil)
+			So(auth.checkAccountRestrictions(user), ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,85 @@
+package ldap
+
+import (
+	"time"
+
+	LDAP "gopkg.in/ldap.v3"
+)
+
+// busyRetryDelay is the wait before the first retry of a busy operation,
+// doubled on every retry. A variable so tests can shorten it
+var busyRetryDelay = 250 * time.Millisecond
+
+// retriedConnection is a connection whose binds and searches are
+// retried while the server answers busy, which is how the rate
+// limited directories like the Okta LDAP interface refuse them
+type retriedConnection struct {
+	IConnection
+	retries int
+}
+
+// retryConnection wraps the connection with the busy_retries of the server, if any
+func retryConnection(conn IConnection, retries int) IConnection {
+	if retries <= 0 {
+		return conn
+	}
+
+	return &retriedConnection{
+		IConnection: conn,
+		retries:     retries,
+	}
+}
+
+// retry runs operation until it isn't refused as busy or the retries are used up
+func (conn *retriedConnection) retry(operation func() error) error {
+	delay := busyRetryDelay
+	err := operation()
+	for retry := 0; retry < conn.retries && isBusy(err); retry++ {
+		time.Sleep(delay)
+		delay *= 2
+		err = operation()
+	}
+	return err
+}
+
+func (conn *retriedConnection) Bind(username, password string) error {
+	return conn.retry(func() error {
+		return conn.IConnection.Bind(username, password)
+	})
+}
+
+func (conn *retriedConnection) SimpleBind(request *LDAP.SimpleBindRequest) (*LDAP.SimpleBindResult, error) {
+	var result *LDAP.SimpleBindResult
+	err := conn.retry(func() error {
+		var err error
+		result, err = conn.IConnection.SimpleBind(request)
+		return err
+	})
+	return result, err
+}
+
+func (conn *retriedConnection) UnauthenticatedBind(username string) error {
+	return conn.retry(func() error {
+		return conn.IConnection.UnauthenticatedBind(username)
+	})
+}
+
+func (conn *retriedConnection) Search(request *LDAP.SearchRequest) (*LDAP.SearchResult, error) {
+	var result *LDAP.SearchResult
+	err := conn.retry(func() error {
+		var err error
+		result, err = conn.IConnection.Search(request)
+		return err
+	})
+	return result, err
+}
+
+func (conn *retriedConnection) SearchStream(request *LDAP.SearchRequest, pagingSize uint32, handle EntryHandler) error {
+	return streamSearch(conn, request, pagingSize, handle)
+}
+
+// isBusy checks if the server refused the operation as busy
+func isBusy(err error) bool {
+	ldapErr, ok := err.(*LDAP.Error)
+	return ok && ldapErr.ResultCode == LDAP.LDAPResultBusy
+}
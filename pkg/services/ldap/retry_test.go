@@ -0,0 +1,93 @@
+package ldap
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	LDAP "gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+func TestRetriedConnection(t *testing.T) {
+	Convey("retriedConnection", t, func() {
+		defer func(delay time.Duration) { busyRetryDelay = delay }(busyRetryDelay)
+		busyRetryDelay = time.Millisecond
+
+		busy := &LDAP.Error{ResultCode: LDAP.LDAPResultBusy, Err: errors.New("rate limit exceeded")}
+		binds := 0
+		conn := &mockLdapConn{}
+
+		Convey("Should retry the busy binds", func() {
+			conn.bindProvider = func(username, password string) error {
+				binds++
+				if binds < 3 {
+					return busy
+				}
+				return nil
+			}
+
+			So(retryConnection(conn, 3).Bind("cn=admin", "pwd"), ShouldBeNil)
+			So(binds, ShouldEqual, 3)
+		})
+
+		Convey("Should give up once the retries are used up", func() {
+			conn.bindProvider = func(username, password string) error {
+				binds++
+				return busy
+			}
+
+			So(retryConnection(conn, 2).Bind("cn=admin", "pwd"), ShouldEqual, busy)
+			So(binds, ShouldEqual, 3)
+		})
+
+		Convey("Should not retry the other errors", func() {
+			conn.bindProvider = func(username, password string) error {
+				binds++
+				return &LDAP.Error{ResultCode: LDAP.LDAPResultInvalidCredentials}
+			}
+
+			So(retryConnection(conn, 3).Bind("cn=admin", "pwd"), ShouldNotBeNil)
+			So(binds, ShouldEqual, 1)
+		})
+
+		Convey("Should leave the connection alone without retries", func() {
+			So(retryConnection(conn, 0), ShouldEqual, conn)
+		})
+	})
+
+	Convey("separate_user_bind", t, func() {
+		defer keepDial()()
+
+		var connections []*mockLdapConn
+		hookDial = func(auth *Auth) error {
+			conn := &mockLdapConn{
+				result: &LDAP.SearchResult{
+					Entries: []*LDAP.Entry{LDAP.NewEntry("uid=roel,ou=users,dc=grafana", map[string][]string{"uid": {"roel"}})},
+				},
+			}
+			connections = append(connections, conn)
+			auth.conn = conn
+			return nil
+		}
+
+		auth := &Auth{
+			server: &ServerConfig{
+				BindDN:           "cn=admin",
+				SearchBaseDNs:    []string{"ou=users,dc=grafana"},
+				Attr:             AttributeMap{Username: "uid"},
+				SeparateUserBind: true,
+			},
+			log: log.New("test-logger"),
+		}
+
+		_, err := auth.Authenticate(&models.LoginUserQuery{Username: "roel", Password: "pwd"})
+		So(err, ShouldBeNil)
+		So(connections, ShouldHaveLength, 2)
+		So(connections[0].searchCalled, ShouldBeTrue)
+		So(connections[1].searchCalled, ShouldBeFalse)
+	})
+}
@@ -0,0 +1,203 @@
+package ldap
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// RevocationOCSP checks the OCSP response stapled by the server
+	RevocationOCSP = "ocsp"
+
+	// RevocationCRL checks the CRLs listed in the server certificate
+	RevocationCRL = "crl"
+)
+
+// ErrCertificateRevoked is returned if the certificate of the LDAP server was revoked
+var ErrCertificateRevoked = errors.New("LDAP server certificate is revoked")
+
+// crlCacheTTL is how long a CRL is cached if it doesn't tell when it's updated
+const crlCacheTTL = time.Hour
+
+var crls = &crlCache{
+	lists: map[string]*cachedCRL{},
+	now:   time.Now,
+	fetch: fetchCRL,
+}
+
+type tlsStater interface {
+	TLSConnectionState() (tls.ConnectionState, bool)
+}
+
+// checkRevocation checks that the certificate of the server
+// conn is connected to wasn't revoked, using the revocation_checks
+// of the server in order until one of them knows the status
+func (auth *Auth) checkRevocation(conn IConnection) error {
+	if len(auth.server.RevocationChecks) == 0 || auth.server.SkipVerifySSL {
+		return nil
+	}
+
+	stater, ok := conn.(tlsStater)
+	if !ok {
+		return nil
+	}
+	state, ok := stater.TLSConnectionState()
+	if !ok || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) < 2 {
+		return nil
+	}
+	leaf, issuer := state.VerifiedChains[0][0], state.VerifiedChains[0][1]
+
+	var unknown []string
+	for _, method := range auth.server.RevocationChecks {
+		var err error
+		switch method {
+		case RevocationOCSP:
+			err = checkOCSP(state.OCSPResponse, leaf, issuer)
+		case RevocationCRL:
+			err = crls.check(leaf, issuer)
+		default:
+			return xerrors.Errorf("Unknown LDAP revocation check %q, use %q or %q", method, RevocationOCSP, RevocationCRL)
+		}
+
+		if err == nil {
+			return nil
+		}
+		if err == ErrCertificateRevoked {
+			return err
+		}
+		unknown = append(unknown, fmt.Sprintf("%s: %v", method, err))
+	}
+
+	err := xerrors.Errorf("Could not check if the LDAP server certificate is revoked: %s", strings.Join(unknown, ", "))
+	if auth.server.RevocationSoftFail {
+		auth.log.Warn("Trusting LDAP server certificate with unknown revocation status", "error", err)
+		return nil
+	}
+
+	return err
+}
+
+// checkOCSP checks the OCSP response stapled to the TLS handshake
+func checkOCSP(staple []byte, leaf, issuer *x509.Certificate) error {
+	if len(staple) == 0 {
+		return errors.New("server didn't staple an OCSP response")
+	}
+
+	resp, err := ocsp.ParseResponseForCert(staple, leaf, issuer)
+	if err != nil {
+		return err
+	}
+
+	if !resp.NextUpdate.IsZero() && time.Now().After(resp.NextUpdate) {
+		return errors.New("stapled OCSP response is outdated")
+	}
+
+	switch resp.Status {
+	case ocsp.Good:
+		return nil
+	case ocsp.Revoked:
+		return ErrCertificateRevoked
+	default:
+		return errors.New("OCSP responder doesn't know the certificate")
+	}
+}
+
+type cachedCRL struct {
+	list    *pkix.CertificateList
+	expires time.Time
+}
+
+// crlCache keeps the fetched CRLs until they are due to be updated
+type crlCache struct {
+	mutex sync.Mutex
+	lists map[string]*cachedCRL
+	now   func() time.Time
+	fetch func(url string) ([]byte, error)
+}
+
+// check looks the certificate up in the first CRL which can be fetched
+func (cache *crlCache) check(leaf, issuer *x509.Certificate) error {
+	if len(leaf.CRLDistributionPoints) == 0 {
+		return errors.New("certificate has no CRL distribution point")
+	}
+
+	var err error
+	for _, url := range leaf.CRLDistributionPoints {
+		var list *pkix.CertificateList
+		list, err = cache.get(url, issuer)
+		if err != nil {
+			continue
+		}
+
+		for _, revoked := range list.TBSCertList.RevokedCertificates {
+			if revoked.SerialNumber.Cmp(leaf.SerialNumber) == 0 {
+				return ErrCertificateRevoked
+			}
+		}
+		return nil
+	}
+
+	return err
+}
+
+func (cache *crlCache) get(url string, issuer *x509.Certificate) (*pkix.CertificateList, error) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	now := cache.now()
+	if cached, ok := cache.lists[url]; ok && now.Before(cached.expires) {
+		return cached.list, nil
+	}
+
+	raw, err := cache.fetch(url)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := x509.ParseCRL(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := issuer.CheckCRLSignature(list); err != nil {
+		return nil, err
+	}
+
+	expires := now.Add(crlCacheTTL)
+	if next := list.TBSCertList.NextUpdate; !next.IsZero() && next.Before(expires) {
+		expires = next
+	}
+	cache.lists[url] = &cachedCRL{list: list, expires: expires}
+
+	return list, nil
+}
+
+func fetchCRL(url string) ([]byte, error) {
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return nil, xerrors.Errorf("unsupported CRL distribution point %v", url)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, xerrors.Errorf("fetching CRL %v failed: %v", url, resp.Status)
+	}
+
+	return ioutil.ReadAll(resp.Body)
+}
@@ -0,0 +1,177 @@
+package ldap
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+)
+
+func TestRevocation(t *testing.T) {
+	ca, caKey := newTestCertificate(nil, nil, 1)
+	leaf, _ := newTestCertificate(ca, caKey, 2)
+
+	Convey("checkOCSP", t, func() {
+		Convey("Should accept a good stapled response", func() {
+			So(checkOCSP(newTestOCSPResponse(ca, caKey, leaf, ocsp.Good), leaf, ca), ShouldBeNil)
+		})
+
+		Convey("Should refuse a revoked certificate", func() {
+			So(checkOCSP(newTestOCSPResponse(ca, caKey, leaf, ocsp.Revoked), leaf, ca), ShouldEqual, ErrCertificateRevoked)
+		})
+
+		Convey("Should fail without a stapled response", func() {
+			err := checkOCSP(nil, leaf, ca)
+
+			So(err, ShouldNotBeNil)
+			So(err, ShouldNotEqual, ErrCertificateRevoked)
+		})
+	})
+
+	Convey("crlCache", t, func() {
+		now := time.Now()
+		fetched := 0
+		newCache := func(revoked ...*big.Int) *crlCache {
+			var list []pkix.RevokedCertificate
+			for _, serial := range revoked {
+				list = append(list, pkix.RevokedCertificate{SerialNumber: serial, RevocationTime: now})
+			}
+			raw, err := ca.CreateCRL(rand.Reader, caKey, list, now, now.Add(30*time.Minute))
+			So(err, ShouldBeNil)
+
+			return &crlCache{
+				lists: map[string]*cachedCRL{},
+				now:   func() time.Time { return now },
+				fetch: func(url string) ([]byte, error) {
+					fetched++
+					return raw, nil
+				},
+			}
+		}
+
+		Convey("Should accept a certificate missing from the CRL", func() {
+			So(newCache(big.NewInt(3)).check(leaf, ca), ShouldBeNil)
+		})
+
+		Convey("Should refuse a certificate listed in the CRL", func() {
+			So(newCache(big.NewInt(2)).check(leaf, ca), ShouldEqual, ErrCertificateRevoked)
+		})
+
+		Convey("Should cache the CRL until its next update", func() {
+			cache := newCache()
+
+			So(cache.check(leaf, ca), ShouldBeNil)
+			So(cache.check(leaf, ca), ShouldBeNil)
+			So(fetched, ShouldEqual, 1)
+
+			now = now.Add(time.Hour)
+			So(cache.check(leaf, ca), ShouldBeNil)
+			So(fetched, ShouldEqual, 2)
+		})
+	})
+
+	Convey("checkRevocation", t, func() {
+		conn := &tlsLdapConn{state: tls.ConnectionState{
+			VerifiedChains: [][]*x509.Certificate{{leaf, ca}},
+		}}
+		auth := &Auth{
+			server: &ServerConfig{RevocationChecks: []string{RevocationOCSP}},
+			log:    log.New("test-logger"),
+		}
+
+		Convey("Should fail if the status is unknown", func() {
+			So(auth.checkRevocation(conn), ShouldNotBeNil)
+		})
+
+		Convey("Should trust the certificate if the status is unknown with soft fail", func() {
+			auth.server.RevocationSoftFail = true
+
+			So(auth.checkRevocation(conn), ShouldBeNil)
+		})
+
+		Convey("Should try the next check if the status is unknown", func() {
+			auth.server.RevocationChecks = []string{RevocationOCSP, RevocationCRL}
+			originalCRLs := crls
+			defer func() { crls = originalCRLs }()
+			crls = &crlCache{
+				lists: map[string]*cachedCRL{},
+				now:   time.Now,
+				fetch: func(url string) ([]byte, error) { return nil, errors.New("unreachable") },
+			}
+
+			So(auth.checkRevocation(conn), ShouldNotBeNil)
+
+			conn.state.OCSPResponse = newTestOCSPResponse(ca, caKey, leaf, ocsp.Revoked)
+			So(auth.checkRevocation(conn), ShouldEqual, ErrCertificateRevoked)
+		})
+	})
+}
+
+type tlsLdapConn struct {
+	mockLdapConn
+	state tls.ConnectionState
+}
+
+func (c *tlsLdapConn) TLSConnectionState() (tls.ConnectionState, bool) {
+	return c.state, true
+}
+
+// newTestCertificate creates a self-signed CA if parent is nil, else a leaf signed by parent
+func newTestCertificate(parent *x509.Certificate, parentKey *ecdsa.PrivateKey, serial int64) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "ldap.example.org"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+		parent, parentKey = template, key
+	} else {
+		template.CRLDistributionPoints = []string{"http://crl.example.org/ca.crl"}
+	}
+
+	raw, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		panic(err)
+	}
+	cert, err := x509.ParseCertificate(raw)
+	if err != nil {
+		panic(err)
+	}
+
+	return cert, key
+}
+
+func newTestOCSPResponse(issuer *x509.Certificate, key *ecdsa.PrivateKey, leaf *x509.Certificate, status int) []byte {
+	raw, err := ocsp.CreateResponse(issuer, issuer, ocsp.Response{
+		Status:       status,
+		SerialNumber: leaf.SerialNumber,
+		ThisUpdate:   time.Now().Add(-time.Minute),
+		NextUpdate:   time.Now().Add(time.Hour),
+		RevokedAt:    time.Now().Add(-time.Minute),
+	}, key)
+	if err != nil {
+		panic(err)
+	}
+
+	return raw
+}
@@ -0,0 +1,83 @@
+package ldap
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	LDAP "gopkg.in/ldap.v3"
+)
+
+const redacted = "[redacted]"
+
+var (
+	// filterPattern matches the innermost filter components, applied
+	// until the components wrapping the redacted ones are gone too
+	filterPattern = regexp.MustCompile(`\([^()]*(=|\[redacted\])[^()]*\)`)
+
+	// dnPattern matches DNs like "cn=admin,dc=grafana,dc=org"
+	dnPattern = regexp.MustCompile(`(?i)\b[a-z][a-z0-9-]*=[^,+=()\s"]+(\s*[,+]\s*[a-z][a-z0-9-]*=[^,+=()\s"]+)*`)
+)
+
+// sanitizeError strips the credentials, DNs and filters the directory
+// or the LDAP library may have echoed in err, so it can be handed out of
+// the package, classifies it and keeps it for the diagnostics. The raw error is only logged at debug level
+func (auth *Auth) sanitizeError(err error, secrets ...string) error {
+	if err == nil {
+		return nil
+	}
+
+	switch err {
+	case ErrInvalidCredentials, ErrCouldNotFindUser, ErrClosed, ErrShuttingDown, ErrCertificateRevoked, ErrSearchOnly,
+		ErrOutsideLogonHours, ErrAccountExpired, ErrPasswordExpired, ErrAccountLocked, ErrPasswordMustChange,
+		ErrSigningRequired, ErrChannelBindingUnavailable, ErrHBACDenied, ErrEmailDomainNotAllowed,
+		ErrLoginCollision, ErrServiceBindFailed:
+		return err
+	}
+
+	auth.log.Debug("LDAP operation failed", "error", err)
+
+	kind := classifyError(err)
+	if kind == ErrInvalidCredentials {
+		return ErrInvalidCredentials
+	}
+
+	var sanitized error
+	secrets = append(secrets, auth.server.BindPassword)
+	if ldapErr, ok := err.(*LDAP.Error); ok {
+		sanitizedErr := &LDAP.Error{ResultCode: ldapErr.ResultCode, Err: errors.New("")}
+		if ldapErr.Err != nil {
+			sanitizedErr.Err = errors.New(scrub(ldapErr.Err.Error(), secrets))
+		}
+		sanitized = sanitizedErr
+	} else {
+		sanitized = errors.New(scrub(err.Error(), secrets))
+	}
+
+	recentErrors.add(auth.server, kind, sanitized)
+
+	if kind == nil {
+		return sanitized
+	}
+
+	return &ClassifiedError{Kind: kind, Err: sanitized}
+}
+
+// scrub redacts the secrets, filters and DNs in message
+func scrub(message string, secrets []string) string {
+	for _, secret := range secrets {
+		if secret != "" {
+			message = strings.Replace(message, secret, redacted, -1)
+		}
+	}
+
+	for {
+		scrubbed := filterPattern.ReplaceAllString(message, redacted)
+		if scrubbed == message {
+			break
+		}
+		message = scrubbed
+	}
+
+	return dnPattern.ReplaceAllString(message, redacted)
+}
@@ -0,0 +1,50 @@
+package ldap
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+)
+
+func TestSanitizeError(t *testing.T) {
+	Convey("sanitizeError", t, func() {
+		auth := &Auth{
+			server: &ServerConfig{BindPassword: "bindpwd"},
+			log:    log.New("test-logger"),
+		}
+
+		Convey("Should keep the package errors", func() {
+			So(auth.sanitizeError(nil), ShouldBeNil)
+			So(auth.sanitizeError(ErrInvalidCredentials), ShouldEqual, ErrInvalidCredentials)
+			So(auth.sanitizeError(ErrShuttingDown), ShouldEqual, ErrShuttingDown)
+		})
+
+		Convey("Should strip DNs from LDAP errors and keep the result code", func() {
+			err := auth.sanitizeError(&ldap.Error{
+				ResultCode: ldap.LDAPResultOther,
+				Err:        errors.New("no read access to cn=roel,ou=users,dc=grafana,dc=org"),
+				MatchedDN:  "ou=users,dc=grafana,dc=org",
+			})
+
+			ldapErr, ok := err.(*ldap.Error)
+			So(ok, ShouldBeTrue)
+			So(ldapErr.ResultCode, ShouldEqual, ldap.LDAPResultOther)
+			So(ldapErr.MatchedDN, ShouldBeEmpty)
+			So(err.Error(), ShouldNotContainSubstring, "roel")
+			So(err.Error(), ShouldContainSubstring, "no read access to [redacted]")
+		})
+
+		Convey("Should strip filters and credentials", func() {
+			err := auth.sanitizeError(
+				errors.New("bad search (&(objectClass=person)(|(uid=roel)(mail=roel@grafana.com))) bound with bindpwd or userpwd"),
+				"userpwd",
+			)
+
+			So(err.Error(), ShouldEqual, "bad search [redacted] bound with [redacted] or [redacted]")
+		})
+	})
+}
@@ -0,0 +1,85 @@
+package ldap
+
+import (
+	"fmt"
+
+	"golang.org/x/xerrors"
+)
+
+// SchemaVersion is the version of the config schema this build reads,
+// the configs of older versions are migrated when they're loaded
+const SchemaVersion = 3
+
+// schemaMigration upgrades a config of the previous version, it
+// returns what it translated for every server so it can be logged
+type schemaMigration func(server *ServerConfig) []string
+
+// schemaMigrations are the migrations by the version they upgrade to
+var schemaMigrations = map[int]schemaMigration{
+	2: migrateGroupSearchGroupAttribute,
+	3: migrateAuthStrategy,
+}
+
+// migrateConfig upgrades config to SchemaVersion, a config
+// without version is of the first version
+func migrateConfig(config *Config) error {
+	if config.Version == 0 {
+		config.Version = 1
+	}
+	if config.Version > SchemaVersion {
+		return xerrors.Errorf("LDAP config version %d is not supported, the latest version is %d", config.Version, SchemaVersion)
+	}
+
+	for _, change := range schemaChanges(config) {
+		logger.Info("Migrated LDAP config option",
+			"from", change.from, "to", change.from+1, "server", ServerKey(config.Servers[change.server]), "change", change.description)
+	}
+
+	config.Version = SchemaVersion
+	return nil
+}
+
+// schemaChange is an option translated by a migration,
+// server is the index of the server it was translated in
+type schemaChange struct {
+	from        int
+	server      int
+	description string
+}
+
+// schemaChanges applies the migrations config needs and returns what they changed
+func schemaChanges(config *Config) []*schemaChange {
+	changes := []*schemaChange{}
+	for version := config.Version; version < SchemaVersion; version++ {
+		migration := schemaMigrations[version+1]
+		for i, server := range config.Servers {
+			for _, description := range migration(server) {
+				changes = append(changes, &schemaChange{
+					from:        version,
+					server:      i,
+					description: description,
+				})
+			}
+		}
+	}
+	return changes
+}
+
+// migrateGroupSearchGroupAttribute moves the attribute of the group entries
+// out of attributes.member_of: in version 1 member_of named that attribute
+// when group_search_filter was set, unless set to "memberOf" which meant "dn"
+func migrateGroupSearchGroupAttribute(server *ServerConfig) []string {
+	if server.GroupSearchFilter == "" || server.GroupSearchGroupAttribute != "" {
+		return nil
+	}
+
+	switch server.Attr.MemberOf {
+	case "", "memberOf":
+		return nil
+	}
+
+	change := fmt.Sprintf("attributes.member_of = %q moved to group_search_group_attribute", server.Attr.MemberOf)
+	server.GroupSearchGroupAttribute = server.Attr.MemberOf
+	server.Attr.MemberOf = ""
+	return []string{change}
+}
@@ -0,0 +1,65 @@
+package ldap
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSchema(t *testing.T) {
+	Convey("migrateConfig", t, func() {
+		Convey("Should move the group attribute of version 1 configs out of member_of", func() {
+			config := &Config{
+				Servers: []*ServerConfig{
+					{GroupSearchFilter: "(member=%s)", Attr: AttributeMap{MemberOf: "cn"}},
+					{GroupSearchFilter: "(member=%s)", Attr: AttributeMap{MemberOf: "memberOf"}},
+					{Attr: AttributeMap{MemberOf: "memberOf"}},
+				},
+			}
+
+			err := migrateConfig(config)
+			So(err, ShouldBeNil)
+			So(config.Version, ShouldEqual, SchemaVersion)
+
+			So(config.Servers[0].GroupSearchGroupAttribute, ShouldEqual, "cn")
+			So(config.Servers[0].Attr.MemberOf, ShouldBeEmpty)
+
+			So(config.Servers[1].GroupSearchGroupAttribute, ShouldBeEmpty)
+			So(config.Servers[1].Attr.MemberOf, ShouldEqual, "memberOf")
+			So(config.Servers[2].Attr.MemberOf, ShouldEqual, "memberOf")
+		})
+
+		Convey("Should leave the configs of the current version alone", func() {
+			config := &Config{
+				Version: SchemaVersion,
+				Servers: []*ServerConfig{
+					{GroupSearchFilter: "(member=%s)", Attr: AttributeMap{MemberOf: "cn"}},
+				},
+			}
+
+			So(schemaChanges(config), ShouldBeEmpty)
+			So(config.Servers[0].Attr.MemberOf, ShouldEqual, "cn")
+		})
+
+		Convey("Should refuse the configs of newer versions", func() {
+			err := migrateConfig(&Config{Version: SchemaVersion + 1})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Should describe the changes", func() {
+			config := &Config{
+				Version: 1,
+				Servers: []*ServerConfig{
+					{},
+					{GroupSearchFilter: "(member=%s)", Attr: AttributeMap{MemberOf: "cn"}},
+				},
+			}
+
+			changes := schemaChanges(config)
+			So(changes, ShouldHaveLength, 1)
+			So(changes[0].from, ShouldEqual, 1)
+			So(changes[0].server, ShouldEqual, 1)
+			So(changes[0].description, ShouldEqual, `attributes.member_of = "cn" moved to group_search_group_attribute`)
+		})
+	})
+}
@@ -0,0 +1,63 @@
+package ldap
+
+import (
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// searchBaseSettings returns the user filter and attributes
+// of the search base, overridden by search_base_overrides
+func (server *ServerConfig) searchBaseSettings(base string) (string, AttributeMap) {
+	filter, attr := server.SearchFilter, server.Attr
+
+	for _, override := range server.SearchBaseOverrides {
+		if !strings.EqualFold(override.BaseDN, base) {
+			continue
+		}
+
+		if override.SearchFilter != "" {
+			filter = override.SearchFilter
+		}
+		overrideAttribute(&attr.Username, override.Attr.Username)
+		overrideAttribute(&attr.Name, override.Attr.Name)
+		overrideAttribute(&attr.Surname, override.Attr.Surname)
+		overrideAttribute(&attr.Email, override.Attr.Email)
+		overrideAttribute(&attr.MemberOf, override.Attr.MemberOf)
+		break
+	}
+
+	return filter, attr
+}
+
+func overrideAttribute(attribute *string, override string) {
+	if override != "" {
+		*attribute = override
+	}
+}
+
+// validateSearchBaseOverrides checks the overrides are for one of the search_base_dns
+func validateSearchBaseOverrides(server *ServerConfig) error {
+	for _, override := range server.SearchBaseOverrides {
+		if override.BaseDN == "" {
+			return xerrors.New("LDAP config file is missing option: base_dn")
+		}
+
+		found := false
+		for _, base := range server.SearchBaseDNs {
+			if strings.EqualFold(override.BaseDN, base) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return xerrors.Errorf("%v is not one of the search_base_dns", override.BaseDN)
+		}
+
+		if placeholder := unknownPlaceholder(override.SearchFilter); placeholder != "" {
+			return xerrors.Errorf("Unknown placeholder %s in the search_filter of %v, use %s", placeholder, override.BaseDN, placeholderNames)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,91 @@
+package ldap
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	LDAP "gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+)
+
+func TestSearchBaseOverrides(t *testing.T) {
+	server := &ServerConfig{
+		SearchFilter:  "(sAMAccountName=%s)",
+		SearchBaseDNs: []string{"ou=staff,dc=grafana,dc=org", "ou=contractors,dc=grafana,dc=org"},
+		Attr: AttributeMap{
+			Username: "sAMAccountName",
+			Email:    "mail",
+			MemberOf: "memberOf",
+		},
+		SearchBaseOverrides: []*SearchBaseOverride{
+			{
+				BaseDN:       "OU=Contractors,DC=grafana,DC=org",
+				SearchFilter: "(uid=%s)",
+				Attr:         AttributeMap{Username: "uid", Email: "contactMail"},
+			},
+		},
+	}
+
+	Convey("searchBaseSettings", t, func() {
+		Convey("Should use the server settings for the bases without override", func() {
+			filter, attr := server.searchBaseSettings("ou=staff,dc=grafana,dc=org")
+			So(filter, ShouldEqual, "(sAMAccountName=%s)")
+			So(attr, ShouldResemble, server.Attr)
+		})
+
+		Convey("Should override the options set for the base", func() {
+			filter, attr := server.searchBaseSettings("ou=contractors,dc=grafana,dc=org")
+			So(filter, ShouldEqual, "(uid=%s)")
+			So(attr.Username, ShouldEqual, "uid")
+			So(attr.Email, ShouldEqual, "contactMail")
+			So(attr.MemberOf, ShouldEqual, "memberOf")
+		})
+	})
+
+	Convey("validateSearchBaseOverrides", t, func() {
+		Convey("Should accept the overrides of the search bases", func() {
+			So(validateSearchBaseOverrides(server), ShouldBeNil)
+		})
+
+		Convey("Should refuse the overrides of other bases", func() {
+			err := validateSearchBaseOverrides(&ServerConfig{
+				SearchBaseDNs:       []string{"dc=grafana,dc=org"},
+				SearchBaseOverrides: []*SearchBaseOverride{{BaseDN: "ou=other,dc=grafana,dc=org"}},
+			})
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("searchForUser", t, func() {
+		requests := []*LDAP.SearchRequest{}
+		conn := &mockLdapConn{}
+		conn.searchProvider = func(request *LDAP.SearchRequest) (*LDAP.SearchResult, error) {
+			requests = append(requests, request)
+			if request.BaseDN != "ou=contractors,dc=grafana,dc=org" {
+				return &LDAP.SearchResult{}, nil
+			}
+			return &LDAP.SearchResult{Entries: []*LDAP.Entry{{
+				DN: "uid=roel,ou=contractors,dc=grafana,dc=org",
+				Attributes: []*LDAP.EntryAttribute{
+					{Name: "uid", Values: []string{"roel"}},
+					{Name: "contactMail", Values: []string{"roel@contractor.org"}},
+				},
+			}}}, nil
+		}
+		auth := &Auth{server: server, conn: conn, log: log.New("test-logger")}
+
+		Convey("Should search and read the user with the settings of each base", func() {
+			user, err := auth.searchForUser("roel", searchEverything)
+			So(err, ShouldBeNil)
+
+			So(requests, ShouldHaveLength, 2)
+			So(requests[0].Filter, ShouldEqual, "(sAMAccountName=roel)")
+			So(requests[1].Filter, ShouldEqual, "(uid=roel)")
+			So(requests[1].Attributes, ShouldContain, "contactMail")
+
+			So(user.Username, ShouldEqual, "roel")
+			So(user.Email, ShouldEqual, "roel@contractor.org")
+		})
+	})
+}
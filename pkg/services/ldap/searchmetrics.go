@@ -0,0 +1,82 @@
+package ldap
+
+import (
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"sync"
+	"time"
+
+	LDAP "gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/infra/metrics"
+)
+
+// The operations the search durations are segmented by
+const (
+	searchUser        = "user_search"
+	searchGroups      = "group_search"
+	searchEnumeration = "enumeration"
+	searchReferral    = "referral"
+	searchGroupWatch  = "group_watch"
+	searchGroupCheck  = "group_check"
+	searchHBAC        = "hbac"
+	searchManager     = "manager"
+	searchEntryCheck  = "entry_check"
+	searchDiagnostics = "diagnostics"
+)
+
+// maxFilterTemplates is the number of filter templates the search
+// durations are segmented by, the searches of the others count as
+// otherFilterTemplate
+const maxFilterTemplates = 100
+
+const otherFilterTemplate = "other"
+
+// filterTemplateValuePattern matches the asserted values of a search
+// filter but the presence ones, so the enumerations with "(uid=*)" are
+// told apart from the user searches with "(uid=roel)"
+var filterTemplateValuePattern = regexp.MustCompile(`([~<>]?=)(?:[^()*][^()]*|\*[^()]+)\)`)
+
+// filterTemplates holds the hashes of the filter templates seen
+var filterTemplates = map[string]string{}
+var filterTemplatesMutex = &sync.Mutex{}
+
+// search sends the search, recording its duration by host, operation
+// and filter template
+func (auth *Auth) search(operation string, request *LDAP.SearchRequest) (*LDAP.SearchResult, error) {
+	start := time.Now()
+	result, err := auth.conn.Search(request)
+	observeSearch(auth.address, operation, request.Filter, time.Since(start))
+	return result, err
+}
+
+func observeSearch(address string, operation string, filter string, elapsed time.Duration) {
+	metrics.M_Ldap_Search_Duration.
+		WithLabelValues(address, operation, filterTemplate(filter)).
+		Observe(float64(elapsed.Nanoseconds() / int64(time.Millisecond)))
+}
+
+// filterTemplate returns the hash of the template of the filter, the
+// filter without its values. Each new template is logged with its hash,
+// so the slow ones can be found without debug logging
+func filterTemplate(filter string) string {
+	template := filterTemplateValuePattern.ReplaceAllString(filter, "$1?)")
+
+	filterTemplatesMutex.Lock()
+	defer filterTemplatesMutex.Unlock()
+
+	if hash, ok := filterTemplates[template]; ok {
+		return hash
+	}
+	if len(filterTemplates) >= maxFilterTemplates {
+		return otherFilterTemplate
+	}
+
+	hasher := fnv.New32a()
+	hasher.Write([]byte(template))
+	hash := fmt.Sprintf("%08x", hasher.Sum32())
+	filterTemplates[template] = hash
+	logger.Info("New LDAP search filter template", "template", hash, "filter", template)
+	return hash
+}
@@ -0,0 +1,56 @@
+package ldap
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	. "github.com/smartystreets/goconvey/convey"
+	LDAP "gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/infra/metrics"
+)
+
+func searchCount(address, operation, template string) uint64 {
+	metric := &dto.Metric{}
+	histogram := metrics.M_Ldap_Search_Duration.WithLabelValues(address, operation, template).(prometheus.Histogram)
+	if err := histogram.Write(metric); err != nil {
+		panic(err)
+	}
+	return metric.Histogram.GetSampleCount()
+}
+
+func TestSearchMetrics(t *testing.T) {
+	Convey("filterTemplate", t, func() {
+		template := filterTemplate("(&(uid=roel)(objectClass=person))")
+		So(template, ShouldHaveLength, 8)
+		So(filterTemplate("(&(uid=torkel)(objectClass=user))"), ShouldEqual, template)
+		So(filterTemplate("(&(uid=*)(objectClass=person))"), ShouldNotEqual, template)
+		So(filterTemplate("(&(uid=*roel*)(objectClass=person))"), ShouldEqual, template)
+	})
+
+	Convey("Should not segment by more than maxFilterTemplates templates", t, func() {
+		defer func(templates map[string]string) { filterTemplates = templates }(filterTemplates)
+		filterTemplates = map[string]string{}
+		for i := 0; i < maxFilterTemplates; i++ {
+			filterTemplates[fmt.Sprint(i)] = "hash"
+		}
+
+		So(filterTemplate("(uid=roel)"), ShouldEqual, otherFilterTemplate)
+	})
+
+	Convey("Should record the searches by host, operation and filter template", t, func() {
+		conn := &mockLdapConn{}
+		conn.setSearchResult(&LDAP.SearchResult{})
+		auth := &Auth{server: &ServerConfig{}, conn: conn, address: "search.example.org:389", log: log.New("test-logger")}
+
+		template := filterTemplate("(uid=roel)")
+		count := searchCount("search.example.org:389", searchUser, template)
+
+		_, err := auth.search(searchUser, &LDAP.SearchRequest{Filter: "(uid=torkel)"})
+		So(err, ShouldBeNil)
+		So(searchCount("search.example.org:389", searchUser, template), ShouldEqual, count+1)
+	})
+}
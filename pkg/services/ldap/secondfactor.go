@@ -0,0 +1,189 @@
+package ldap
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/grafana/grafana/pkg/util"
+	"github.com/grafana/grafana/pkg/util/errutil"
+)
+
+var (
+	// ErrSecondFactorRequired is returned if the password is right but the
+	// groups of the user require a second factor and no code was given
+	ErrSecondFactorRequired = errors.New("A second factor is required")
+
+	// ErrInvalidSecondFactor is returned if the code of the second factor is wrong
+	ErrInvalidSecondFactor = errors.New("Invalid second factor code")
+
+	// ErrSecondFactorNotEnrolled is returned if the groups of the user
+	// require a second factor but the user has no seed
+	ErrSecondFactorNotEnrolled = errors.New("No second factor is enrolled for the user")
+)
+
+const (
+	// totpPeriod is how long a TOTP code is valid
+	totpPeriod = 30
+
+	// totpDigits is the number of digits of the codes
+	totpDigits = 6
+
+	// totpSkew is the number of periods a code may be early or late, for the clocks drifting
+	totpSkew = 1
+
+	// secondFactorSeedSize is the number of random bytes of the enrolled seeds
+	secondFactorSeedSize = 20
+)
+
+// seedEncoding is the base32 of the seeds, the authenticator apps leave the padding out
+var seedEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// requiresSecondFactor checks if one of the mapped groups of the user requires a second factor
+func (auth *Auth) requiresSecondFactor(user *UserInfo) bool {
+	for _, group := range auth.server.matchingGroups(user) {
+		if group.SecondFactor {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifySecondFactor is the step between the password check and the session:
+// if the groups of the user require it, the code of the query is checked
+// against the seed of second_factor_seed_attribute, or of the Grafana
+// enrollment when the server doesn't set one
+func (auth *Auth) VerifySecondFactor(query *models.LoginUserQuery, user *UserInfo, grafanaUser *models.User) error {
+	if !auth.requiresSecondFactor(user) {
+		return nil
+	}
+
+	seed := user.secondFactorSeed
+	if auth.server.SecondFactorSeedAttribute == "" {
+		var err error
+		if seed, err = enrolledSeed(grafanaUser.Id); err != nil {
+			return err
+		}
+	}
+
+	if seed == "" {
+		return ErrSecondFactorNotEnrolled
+	}
+	if query.SecondFactorCode == "" {
+		return ErrSecondFactorRequired
+	}
+	counter, ok := validateTOTP(seed, query.SecondFactorCode, now())
+	if !ok {
+		auth.log.Info("Invalid second factor code", "username", query.Username)
+		return ErrInvalidSecondFactor
+	}
+
+	// each code logs in once, and neither can the codes before it
+	cmd := &models.AcceptLdapSecondFactorCounterCommand{UserId: grafanaUser.Id, Counter: counter}
+	if err := bus.Dispatch(cmd); err != nil {
+		return errutil.Wrap("Failed to save the second factor counter", err)
+	}
+	if !cmd.Accepted {
+		auth.log.Info("Second factor code already used", "username", query.Username)
+		return ErrInvalidSecondFactor
+	}
+
+	return nil
+}
+
+// enrolledSeed returns the seed enrolled in Grafana for the user, empty if there is none
+func enrolledSeed(userID int64) (string, error) {
+	query := &models.GetLdapSecondFactorQuery{UserId: userID}
+	if err := bus.Dispatch(query); err != nil {
+		if err == models.ErrLdapSecondFactorNotFound {
+			return "", nil
+		}
+		return "", errutil.Wrap("Failed to read the second factor", err)
+	}
+
+	seed, err := util.Decrypt(query.Result.Secret, setting.SecretKey)
+	if err != nil {
+		return "", errutil.Wrap("Failed to decrypt the second factor", err)
+	}
+
+	return string(seed), nil
+}
+
+// EnrollSecondFactor generates the seed of the second factor of the user,
+// replacing the one enrolled before, and returns it for the authenticator app
+func EnrollSecondFactor(userID int64) (string, error) {
+	secret := make([]byte, secondFactorSeedSize)
+	if _, err := rand.Read(secret); err != nil {
+		return "", errutil.Wrap("Failed to generate the second factor", err)
+	}
+	seed := seedEncoding.EncodeToString(secret)
+
+	encrypted, err := util.Encrypt([]byte(seed), setting.SecretKey)
+	if err != nil {
+		return "", errutil.Wrap("Failed to encrypt the second factor", err)
+	}
+
+	if err := bus.Dispatch(&models.SaveLdapSecondFactorCommand{UserId: userID, Secret: encrypted}); err != nil {
+		return "", errutil.Wrap("Failed to save the second factor", err)
+	}
+
+	return seed, nil
+}
+
+// ResetSecondFactor deletes the second factor enrolled for the user
+func ResetSecondFactor(userID int64) error {
+	if err := bus.Dispatch(&models.DeleteLdapSecondFactorCommand{UserId: userID}); err != nil {
+		return errutil.Wrap("Failed to delete the second factor", err)
+	}
+	return nil
+}
+
+// SecondFactorURL is the otpauth:// URL the authenticator apps read from QR codes
+func SecondFactorURL(login string, seed string) string {
+	return fmt.Sprintf("otpauth://totp/Grafana:%s?secret=%s&issuer=Grafana&digits=%d&period=%d",
+		url.PathEscape(login), seed, totpDigits, totpPeriod)
+}
+
+// validateTOTP checks code is the RFC 6238 code of seed at the time, or of
+// the periods just before or after it, and returns the counter it's the code of
+func validateTOTP(seed string, code string, at time.Time) (int64, bool) {
+	key, err := seedEncoding.DecodeString(strings.ToUpper(strings.TrimRight(strings.Replace(seed, " ", "", -1), "=")))
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+
+	counter := at.Unix() / totpPeriod
+	for skew := int64(-totpSkew); skew <= totpSkew; skew++ {
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, counter+skew)), []byte(code)) == 1 {
+			return counter + skew, true
+		}
+	}
+
+	return 0, false
+}
+
+// totpCode is the HOTP code of key for the counter, see RFC 4226
+func totpCode(key []byte, counter int64) string {
+	message := make([]byte, 8)
+	binary.BigEndian.PutUint64(message, uint64(counter))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(message)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
@@ -0,0 +1,164 @@
+package ldap
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// rfcSeed is the seed of the RFC 6238 test vectors, "12345678901234567890"
+const rfcSeed = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestSecondFactor(t *testing.T) {
+	Convey("validateTOTP", t, func() {
+		valid := func(seed, code string, at int64) bool {
+			_, ok := validateTOTP(seed, code, time.Unix(at, 0))
+			return ok
+		}
+
+		Convey("Should check the codes of the RFC 6238 test vectors", func() {
+			So(valid(rfcSeed, "287082", 59), ShouldBeTrue)
+			So(valid(rfcSeed, "081804", 1111111109), ShouldBeTrue)
+			So(valid(rfcSeed, "050471", 1111111111), ShouldBeTrue)
+		})
+
+		Convey("Should allow the codes of the next and previous periods only", func() {
+			So(valid(rfcSeed, "287082", 59+totpPeriod), ShouldBeTrue)
+			So(valid(rfcSeed, "287082", 59+2*totpPeriod), ShouldBeFalse)
+		})
+
+		Convey("Should return the counter of the code", func() {
+			counter, ok := validateTOTP(rfcSeed, "287082", time.Unix(59+totpPeriod, 0))
+			So(ok, ShouldBeTrue)
+			So(counter, ShouldEqual, 59/totpPeriod)
+		})
+
+		Convey("Should refuse the wrong codes and seeds", func() {
+			So(valid(rfcSeed, "123456", 59), ShouldBeFalse)
+			So(valid(rfcSeed, "28708", 59), ShouldBeFalse)
+			So(valid("not base32!", "287082", 59), ShouldBeFalse)
+		})
+
+		Convey("Should read the seeds in lower case, with spaces or padding", func() {
+			So(valid("gezd gnbv gy3t qojq gezd gnbv gy3t qojq", "287082", 59), ShouldBeTrue)
+			So(valid(rfcSeed+"====", "287082", 59), ShouldBeTrue)
+		})
+	})
+
+	Convey("VerifySecondFactor", t, func() {
+		now = func() time.Time { return time.Unix(59, 0) }
+		defer func() { now = time.Now }()
+
+		auth := &Auth{
+			log: log.New("test-logger"),
+			server: &ServerConfig{
+				Groups: []*GroupToOrgRole{
+					{GroupDN: "cn=admins", OrgRole: "Admin", SecondFactor: true},
+					{GroupDN: "*", OrgRole: "Viewer"},
+				},
+			},
+		}
+		grafanaUser := &models.User{Id: 42}
+
+		defer bus.ClearBusHandlers()
+		counters := map[int64]int64{}
+		bus.AddHandler("test", func(cmd *models.AcceptLdapSecondFactorCounterCommand) error {
+			last, ok := counters[cmd.UserId]
+			if cmd.Accepted = !ok || cmd.Counter > last; cmd.Accepted {
+				counters[cmd.UserId] = cmd.Counter
+			}
+			return nil
+		})
+
+		Convey("Should not require a second factor from the other groups", func() {
+			user := &UserInfo{MemberOf: []string{"cn=users"}}
+			So(auth.VerifySecondFactor(&models.LoginUserQuery{}, user, grafanaUser), ShouldBeNil)
+		})
+
+		Convey("With the seeds of an LDAP attribute", func() {
+			auth.server.SecondFactorSeedAttribute = "totpSeed"
+			user := &UserInfo{MemberOf: []string{"cn=admins"}, secondFactorSeed: rfcSeed}
+
+			So(auth.VerifySecondFactor(&models.LoginUserQuery{}, user, grafanaUser), ShouldEqual, ErrSecondFactorRequired)
+			So(auth.VerifySecondFactor(&models.LoginUserQuery{SecondFactorCode: "123456"}, user, grafanaUser), ShouldEqual, ErrInvalidSecondFactor)
+			So(auth.VerifySecondFactor(&models.LoginUserQuery{SecondFactorCode: "287082"}, user, grafanaUser), ShouldBeNil)
+
+			user.secondFactorSeed = ""
+			So(auth.VerifySecondFactor(&models.LoginUserQuery{SecondFactorCode: "287082"}, user, grafanaUser), ShouldEqual, ErrSecondFactorNotEnrolled)
+		})
+
+		Convey("Should refuse the codes used before and the earlier ones", func() {
+			auth.server.SecondFactorSeedAttribute = "totpSeed"
+			user := &UserInfo{MemberOf: []string{"cn=admins"}, secondFactorSeed: rfcSeed}
+			key, _ := seedEncoding.DecodeString(rfcSeed)
+			now = func() time.Time { return time.Unix(89, 0) }
+
+			code := &models.LoginUserQuery{SecondFactorCode: totpCode(key, 89/totpPeriod)}
+			So(auth.VerifySecondFactor(code, user, grafanaUser), ShouldBeNil)
+			So(auth.VerifySecondFactor(code, user, grafanaUser), ShouldEqual, ErrInvalidSecondFactor)
+
+			earlier := &models.LoginUserQuery{SecondFactorCode: totpCode(key, 89/totpPeriod-1)}
+			So(auth.VerifySecondFactor(earlier, user, grafanaUser), ShouldEqual, ErrInvalidSecondFactor)
+
+			So(auth.VerifySecondFactor(code, user, &models.User{Id: 43}), ShouldBeNil)
+
+			later := &models.LoginUserQuery{SecondFactorCode: totpCode(key, 89/totpPeriod+1)}
+			So(auth.VerifySecondFactor(later, user, grafanaUser), ShouldBeNil)
+		})
+
+		Convey("With the seeds enrolled in Grafana", func() {
+			defer bus.ClearBusHandlers()
+			setting.SecretKey = "secret"
+
+			saved := map[int64][]byte{}
+			bus.AddHandler("test", func(query *models.GetLdapSecondFactorQuery) error {
+				secret, ok := saved[query.UserId]
+				if !ok {
+					return models.ErrLdapSecondFactorNotFound
+				}
+				query.Result = &models.LdapSecondFactor{UserId: query.UserId, Secret: secret}
+				return nil
+			})
+			bus.AddHandler("test", func(cmd *models.SaveLdapSecondFactorCommand) error {
+				saved[cmd.UserId] = cmd.Secret
+				return nil
+			})
+			bus.AddHandler("test", func(cmd *models.DeleteLdapSecondFactorCommand) error {
+				delete(saved, cmd.UserId)
+				return nil
+			})
+
+			user := &UserInfo{MemberOf: []string{"cn=admins"}}
+			query := &models.LoginUserQuery{}
+			So(auth.VerifySecondFactor(query, user, grafanaUser), ShouldEqual, ErrSecondFactorNotEnrolled)
+
+			seed, err := EnrollSecondFactor(42)
+			So(err, ShouldBeNil)
+			So(string(saved[42]), ShouldNotContainSubstring, seed)
+			So(SecondFactorURL("john doe", seed), ShouldEqual,
+				"otpauth://totp/Grafana:john%20doe?secret="+seed+"&issuer=Grafana&digits=6&period=30")
+
+			So(auth.VerifySecondFactor(query, user, grafanaUser), ShouldEqual, ErrSecondFactorRequired)
+
+			query.SecondFactorCode = totpCode(mustDecodeSeed(seed), 59/totpPeriod)
+			So(auth.VerifySecondFactor(query, user, grafanaUser), ShouldBeNil)
+
+			So(ResetSecondFactor(42), ShouldBeNil)
+			So(auth.VerifySecondFactor(query, user, grafanaUser), ShouldEqual, ErrSecondFactorNotEnrolled)
+		})
+	})
+}
+
+func mustDecodeSeed(seed string) []byte {
+	key, err := seedEncoding.DecodeString(seed)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
@@ -0,0 +1,73 @@
+package ldap
+
+import (
+	"context"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/registry"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+func init() {
+	registry.RegisterService(&LDAPService{})
+	bus.AddHandler("ldap", getHealth)
+}
+
+// LDAPService ties the LDAP authentication to the Grafana server lifecycle
+type LDAPService struct {
+	log log.Logger
+}
+
+// Init initializes the service
+func (service *LDAPService) Init() error {
+	service.log = NewLogger("ldap")
+
+	// Refuse to start with settings which aren't allowed in FIPS mode
+	if setting.LdapFIPSMode {
+		if _, err := GetConfig(); err != nil {
+			return err
+		}
+	}
+
+	return service.warmUp()
+}
+
+// IsDisabled checks if the LDAP authentication is disabled
+func (service *LDAPService) IsDisabled() bool {
+	return !IsEnabled()
+}
+
+// Run checks the mapped groups at start and on config reloads and probes
+// the servers if configured, then waits for the Grafana shutdown and
+// drains the in-flight LDAP operations
+func (service *LDAPService) Run(ctx context.Context) error {
+	if setting.LdapLivenessProbeInterval > 0 {
+		go service.probeLiveness(ctx, setting.LdapLivenessProbeInterval)
+	}
+
+	loadingMutex.Lock()
+	configReloaded = func(config *Config) {
+		closeServiceConnections()
+		go checkMappedGroups(config)
+	}
+	loadingMutex.Unlock()
+	if config, err := GetConfig(); err == nil {
+		go checkMappedGroups(config)
+	}
+
+	<-ctx.Done()
+
+	loadingMutex.Lock()
+	configReloaded = nil
+	loadingMutex.Unlock()
+
+	service.log.Info("Draining LDAP operations", "timeout", setting.LdapShutdownTimeout)
+
+	if closed := operations.drain(setting.LdapShutdownTimeout); closed > 0 {
+		service.log.Warn("Closed LDAP connections of unfinished operations", "count", closed)
+	}
+	closeServiceConnections()
+
+	return ctx.Err()
+}
@@ -0,0 +1,97 @@
+package ldap
+
+import (
+	"errors"
+	"strings"
+
+	"golang.org/x/xerrors"
+
+	"github.com/grafana/grafana/pkg/models"
+)
+
+// ErrServiceAccountInteractiveLogin is returned by the logins of the
+// service accounts from the login form, they only authenticate API requests
+var ErrServiceAccountInteractiveLogin = errors.New("LDAP service accounts can only authenticate API requests")
+
+// validateServiceAccounts checks each service account mapping matches
+// the entries by base_dn or attribute and has a valid org_role
+func validateServiceAccounts(server *ServerConfig) error {
+	for _, mapping := range server.ServiceAccounts {
+		if mapping.BaseDN == "" && mapping.Attribute == "" {
+			return xerrors.New("LDAP config file is missing option: base_dn or attribute")
+		}
+		if mapping.Attribute != "" && mapping.Value == "" {
+			return xerrors.Errorf("the service account mapping of attribute %q is missing option: value", mapping.Attribute)
+		}
+		if !mapping.OrgRole.IsValid() {
+			return xerrors.Errorf("invalid org_role %q of a service account mapping", mapping.OrgRole)
+		}
+		if mapping.OrgId == 0 {
+			mapping.OrgId = 1
+		}
+	}
+	return nil
+}
+
+// serviceAccountAttributeNames returns the attributes the service
+// account mappings match, to search for
+func (server *ServerConfig) serviceAccountAttributeNames() []string {
+	var names []string
+	for _, mapping := range server.ServiceAccounts {
+		names = appendIfNotEmpty(names, mapping.Attribute)
+	}
+	return names
+}
+
+// matches checks if the entry is under the base_dn of
+// has the value in the attribute of the mapping
+func (mapping *ServiceAccountMapping) matches(dn string, entry *entryAttributes) bool {
+	if mapping.BaseDN != "" {
+		dn, base := strings.ToLower(dn), strings.ToLower(mapping.BaseDN)
+		if dn == base || strings.HasSuffix(dn, ","+base) {
+			return true
+		}
+	}
+
+	if mapping.Attribute != "" {
+		for _, value := range entry.valuesOf(mapping.Attribute) {
+			if strings.EqualFold(value, mapping.Value) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// readServiceAccount marks the user read from the entry
+// as a service account if a mapping matches, with the org role of the
+// first mapping matching in each org
+func (server *ServerConfig) readServiceAccount(user *UserInfo, entry *entryAttributes) {
+	for _, mapping := range server.ServiceAccounts {
+		if !mapping.matches(user.DN, entry) {
+			continue
+		}
+
+		user.ServiceAccount = true
+		if user.serviceAccountRoles == nil {
+			user.serviceAccountRoles = map[int64]models.RoleType{}
+		}
+		if _, ok := user.serviceAccountRoles[mapping.OrgId]; !ok {
+			user.serviceAccountRoles[mapping.OrgId] = mapping.OrgRole
+		}
+	}
+}
+
+// CheckServiceAccountLogin only lets the service accounts log in to
+// authenticate API requests. These requests only create the Grafana users
+// of the service accounts, the other users must already exist
+func CheckServiceAccountLogin(query *models.LoginUserQuery, user *UserInfo) error {
+	if user.ServiceAccount && !query.NonInteractive {
+		return ErrServiceAccountInteractiveLogin
+	}
+	if !user.ServiceAccount && query.NonInteractive && query.User == nil {
+		return models.ErrUserNotFound
+	}
+	return nil
+}
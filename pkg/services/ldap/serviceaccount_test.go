@@ -0,0 +1,110 @@
+package ldap
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	LDAP "gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+func TestServiceAccounts(t *testing.T) {
+	Convey("validateServiceAccounts", t, func() {
+		Convey("Should default the org id", func() {
+			mapping := &ServiceAccountMapping{BaseDN: "ou=services,dc=grafana,dc=org", OrgRole: models.ROLE_VIEWER}
+			So(validateServiceAccounts(&ServerConfig{ServiceAccounts: []*ServiceAccountMapping{mapping}}), ShouldBeNil)
+			So(mapping.OrgId, ShouldEqual, 1)
+		})
+
+		Convey("Should refuse the invalid mappings", func() {
+			for _, mapping := range []*ServiceAccountMapping{
+				{OrgRole: models.ROLE_VIEWER},
+				{Attribute: "employeeType", OrgRole: models.ROLE_VIEWER},
+				{BaseDN: "ou=services,dc=grafana,dc=org", OrgRole: "Owner"},
+			} {
+				So(validateServiceAccounts(&ServerConfig{ServiceAccounts: []*ServiceAccountMapping{mapping}}), ShouldNotBeNil)
+			}
+		})
+	})
+
+	Convey("Service account mappings", t, func() {
+		conn := &mockLdapConn{}
+		conn.bindProvider = func(username, password string) error { return nil }
+		auth := &Auth{
+			log:  log.New("test-logger"),
+			conn: conn,
+			server: &ServerConfig{
+				Attr:          AttributeMap{Username: "username", MemberOf: "memberof"},
+				SearchBaseDNs: []string{"dc=grafana,dc=org"},
+				Groups:        []*GroupToOrgRole{{GroupDN: "cn=admins", OrgId: 1, OrgRole: models.ROLE_ADMIN}},
+				ServiceAccounts: []*ServiceAccountMapping{
+					{BaseDN: "OU=Services,dc=grafana,dc=org", OrgId: 1, OrgRole: models.ROLE_VIEWER},
+					{Attribute: "employeeType", Value: "service", OrgId: 1, OrgRole: models.ROLE_EDITOR},
+					{Attribute: "employeeType", Value: "service", OrgId: 2, OrgRole: models.ROLE_EDITOR},
+				},
+			},
+		}
+		search := func(dn string, attributes map[string][]string) *UserInfo {
+			conn.setSearchResult(&LDAP.SearchResult{Entries: []*LDAP.Entry{LDAP.NewEntry(dn, attributes)}})
+			user, err := auth.searchForUser("backup", searchEverything)
+			So(err, ShouldBeNil)
+			return user
+		}
+
+		Convey("Should search the attributes of the mappings", func() {
+			search("uid=backup,ou=services,dc=grafana,dc=org", map[string][]string{"username": {"backup"}})
+			So(conn.searchAttributes, ShouldContain, "employeeType")
+		})
+
+		Convey("Should match the entries under the base DN", func() {
+			user := search("uid=backup,ou=services,dc=grafana,dc=org", map[string][]string{
+				"username": {"backup"},
+				"memberof": {"cn=admins"},
+			})
+			So(user.ServiceAccount, ShouldBeTrue)
+
+			extUser := auth.buildGrafanaUser(user)
+			So(extUser.OrgRoles, ShouldResemble, map[int64]models.RoleType{1: models.ROLE_VIEWER})
+			So(*extUser.IsGrafanaAdmin, ShouldBeFalse)
+		})
+
+		Convey("Should match the entries by attribute", func() {
+			user := search("uid=backup,ou=people,dc=grafana,dc=org", map[string][]string{
+				"username":     {"backup"},
+				"employeeType": {"Service"},
+			})
+			So(user.ServiceAccount, ShouldBeTrue)
+			So(auth.buildGrafanaUser(user).OrgRoles, ShouldResemble, map[int64]models.RoleType{
+				1: models.ROLE_EDITOR,
+				2: models.ROLE_EDITOR,
+			})
+		})
+
+		Convey("Should leave the other entries to the group mappings", func() {
+			user := search("uid=tod,ou=notservices,dc=grafana,dc=org", map[string][]string{
+				"username":     {"tod"},
+				"memberof":     {"cn=admins"},
+				"employeeType": {"employee"},
+			})
+			So(user.ServiceAccount, ShouldBeFalse)
+			So(auth.buildGrafanaUser(user).OrgRoles, ShouldResemble, map[int64]models.RoleType{1: models.ROLE_ADMIN})
+		})
+	})
+
+	Convey("CheckServiceAccountLogin", t, func() {
+		account, human := &UserInfo{ServiceAccount: true}, &UserInfo{}
+
+		Convey("Should refuse the interactive logins of the service accounts", func() {
+			So(CheckServiceAccountLogin(&models.LoginUserQuery{}, account), ShouldEqual, ErrServiceAccountInteractiveLogin)
+			So(CheckServiceAccountLogin(&models.LoginUserQuery{NonInteractive: true}, account), ShouldBeNil)
+		})
+
+		Convey("Should only let the API requests create the service accounts", func() {
+			So(CheckServiceAccountLogin(&models.LoginUserQuery{NonInteractive: true}, human), ShouldEqual, models.ErrUserNotFound)
+			So(CheckServiceAccountLogin(&models.LoginUserQuery{NonInteractive: true, User: &models.User{}}, human), ShouldBeNil)
+			So(CheckServiceAccountLogin(&models.LoginUserQuery{}, human), ShouldBeNil)
+		})
+	})
+}
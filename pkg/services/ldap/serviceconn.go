@@ -0,0 +1,218 @@
+package ldap
+
+import (
+	"sync"
+	"time"
+
+	LDAP "gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// idleServiceConnection is the connection bound with the service account
+// of a server, kept between the operations which only search
+type idleServiceConnection struct {
+	server    *ServerConfig
+	address   string
+	conn      IConnection
+	checkedAt time.Time
+}
+
+// serviceConnections holds the idle service connection of each server.
+// An operation takes it while it runs, the concurrent ones dial their own
+var serviceConnections = map[string]*idleServiceConnection{}
+var serviceConnectionsMutex = &sync.Mutex{}
+
+// connectService connects and binds with the service account for the
+// operations which don't bind as a user, like the user lookups of the
+// admin APIs and the syncs. With service_connection, the idle service
+// connection of the server is reused instead of dialing and binding
+// again, Close gives it back
+func (auth *Auth) connectService() error {
+	var conn IConnection
+	var address string
+	if setting.LdapServiceConnection {
+		conn, address = takeServiceConnection(auth.server)
+	}
+
+	if conn == nil {
+		if err := auth.Dial(); err != nil {
+			return err
+		}
+		if err := auth.serverBind(); err != nil {
+			auth.conn.Close()
+			return err
+		}
+		if !setting.LdapServiceConnection {
+			return nil
+		}
+		conn, address = auth.conn, auth.address
+	}
+
+	auth.mutex.Lock()
+	defer auth.mutex.Unlock()
+
+	if auth.closed {
+		conn.Close()
+		return ErrClosed
+	}
+	auth.conn = &serviceConnection{IConnection: conn, server: auth.server, address: address}
+	return nil
+}
+
+// takeServiceConnection takes the idle service connection of the server
+// and its address, validated first if it wasn't used for
+// service_connection_check_interval
+func takeServiceConnection(server *ServerConfig) (IConnection, string) {
+	key := ServerKey(server)
+
+	serviceConnectionsMutex.Lock()
+	idle := serviceConnections[key]
+	delete(serviceConnections, key)
+	serviceConnectionsMutex.Unlock()
+
+	if idle == nil {
+		return nil, ""
+	}
+	recordHostConnectionPooled(idle.address, false)
+
+	// the config was reloaded since
+	if idle.server != server {
+		idle.conn.Close()
+		return nil, ""
+	}
+
+	if time.Since(idle.checkedAt) >= setting.LdapServiceConnectionCheckInterval {
+		if err := validateServiceConnection(idle.conn, server); err != nil {
+			logger.Debug("Dropping the LDAP service connection which failed its check", "server", key, "error", err)
+			idle.conn.Close()
+			return nil, ""
+		}
+	}
+	return idle.conn, idle.address
+}
+
+// validateServiceConnection reads the rootDSE, without its attributes
+func validateServiceConnection(conn IConnection, server *ServerConfig) error {
+	_, err := conn.Search(&LDAP.SearchRequest{
+		BaseDN:       "",
+		Scope:        LDAP.ScopeBaseObject,
+		DerefAliases: LDAP.NeverDerefAliases,
+		Filter:       "(objectClass=*)",
+		Attributes:   []string{"1.1"},
+		TimeLimit:    server.SearchTimeout,
+	})
+	return err
+}
+
+// putServiceConnection keeps the connection as the idle service connection
+// of the server, closing it if the server already has one
+func putServiceConnection(server *ServerConfig, address string, conn IConnection) {
+	key := ServerKey(server)
+
+	serviceConnectionsMutex.Lock()
+	defer serviceConnectionsMutex.Unlock()
+
+	if idle, ok := serviceConnections[key]; ok {
+		if idle.server == server {
+			conn.Close()
+			return
+		}
+		recordHostConnectionPooled(idle.address, false)
+		idle.conn.Close()
+	}
+	serviceConnections[key] = &idleServiceConnection{server: server, address: address, conn: conn, checkedAt: time.Now()}
+	recordHostConnectionPooled(address, true)
+}
+
+// closeServiceConnections closes the idle service connections, at
+// shutdown and when the config is reloaded
+func closeServiceConnections() {
+	serviceConnectionsMutex.Lock()
+	defer serviceConnectionsMutex.Unlock()
+
+	for key, idle := range serviceConnections {
+		recordHostConnectionPooled(idle.address, false)
+		idle.conn.Close()
+		delete(serviceConnections, key)
+	}
+}
+
+// serviceConnection is the service connection taken by an operation,
+// Close gives it back unless it failed
+type serviceConnection struct {
+	IConnection
+	server  *ServerConfig
+	address string
+
+	mutex    sync.Mutex
+	released bool
+	broken   bool
+}
+
+func (conn *serviceConnection) Bind(username, password string) error {
+	return conn.check(conn.IConnection.Bind(username, password))
+}
+
+func (conn *serviceConnection) UnauthenticatedBind(username string) error {
+	return conn.check(conn.IConnection.UnauthenticatedBind(username))
+}
+
+func (conn *serviceConnection) SimpleBind(request *LDAP.SimpleBindRequest) (*LDAP.SimpleBindResult, error) {
+	result, err := conn.IConnection.SimpleBind(request)
+	return result, conn.check(err)
+}
+
+func (conn *serviceConnection) Search(request *LDAP.SearchRequest) (*LDAP.SearchResult, error) {
+	result, err := conn.IConnection.Search(request)
+	return result, conn.check(err)
+}
+
+func (conn *serviceConnection) SearchStream(request *LDAP.SearchRequest, pagingSize uint32, handle EntryHandler) error {
+	return streamSearch(conn, request, pagingSize, handle)
+}
+
+// check marks the connection as broken on the connection errors
+func (conn *serviceConnection) check(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if isConnectionError(err) {
+		conn.mutex.Lock()
+		conn.broken = true
+		conn.mutex.Unlock()
+	}
+	return err
+}
+
+// Close gives the connection back as the idle service connection of the
+// server, or closes it if it failed
+func (conn *serviceConnection) Close() {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+
+	if conn.released {
+		return
+	}
+	conn.released = true
+
+	if conn.broken {
+		conn.IConnection.Close()
+		return
+	}
+	putServiceConnection(conn.server, conn.address, conn.IConnection)
+}
+
+// abort closes the connection, aborting the operation in flight on it.
+// Once given back, the connection isn't the operation's to close anymore
+func (conn *serviceConnection) abort() {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+
+	if conn.released {
+		return
+	}
+	conn.released = true
+	conn.IConnection.Close()
+}
@@ -0,0 +1,159 @@
+package ldap
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	LDAP "gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/infra/metrics"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+type closingLdapConn struct {
+	*mockLdapConn
+	closed bool
+}
+
+func (c *closingLdapConn) Close() {
+	c.closed = true
+}
+
+func TestServiceConnection(t *testing.T) {
+	Convey("Shared service connection", t, func() {
+		defer func(enabled bool, interval time.Duration) {
+			setting.LdapServiceConnection, setting.LdapServiceConnectionCheckInterval = enabled, interval
+		}(setting.LdapServiceConnection, setting.LdapServiceConnectionCheckInterval)
+		setting.LdapServiceConnection = true
+		setting.LdapServiceConnectionCheckInterval = time.Hour
+		defer closeServiceConnections()
+		defer keepDial()()
+
+		var searchErr error
+		var searchBases []string
+		var conns []*closingLdapConn
+		binds := 0
+		hookDial = func(auth *Auth) error {
+			conn := &closingLdapConn{mockLdapConn: &mockLdapConn{}}
+			conn.bindProvider = func(username, password string) error {
+				binds++
+				return nil
+			}
+			conn.searchProvider = func(request *LDAP.SearchRequest) (*LDAP.SearchResult, error) {
+				searchBases = append(searchBases, request.BaseDN)
+				if searchErr != nil {
+					return nil, searchErr
+				}
+				return &LDAP.SearchResult{Entries: []*LDAP.Entry{
+					LDAP.NewEntry("uid=roel,ou=users,dc=grafana,dc=org", map[string][]string{"uid": {"roel"}}),
+				}}, nil
+			}
+			conns = append(conns, conn)
+			auth.conn = conn
+			return nil
+		}
+
+		server := &ServerConfig{
+			Host:          "ldap.example.org",
+			BindDN:        "cn=admin,dc=grafana,dc=org",
+			BindPassword:  "grafana",
+			SearchFilter:  "(uid=%s)",
+			SearchBaseDNs: []string{"ou=users,dc=grafana,dc=org"},
+			Attr:          AttributeMap{Username: "uid"},
+		}
+		lookUp := func() error {
+			_, err := (&Auth{server: server, log: log.New("test-logger")}).User("roel")
+			return err
+		}
+
+		Convey("Should dial and bind once for the successive operations", func() {
+			So(lookUp(), ShouldBeNil)
+			So(lookUp(), ShouldBeNil)
+			So(conns, ShouldHaveLength, 1)
+			So(binds, ShouldEqual, 1)
+			So(conns[0].closed, ShouldBeFalse)
+		})
+
+		Convey("Should drop the connection after a network error", func() {
+			searchErr = LDAP.NewError(LDAP.ErrorNetwork, errors.New("connection reset"))
+			So(lookUp(), ShouldNotBeNil)
+			So(conns[0].closed, ShouldBeTrue)
+
+			searchErr = nil
+			So(lookUp(), ShouldBeNil)
+			So(conns, ShouldHaveLength, 2)
+		})
+
+		Convey("Should keep the connection after an error answered by the server", func() {
+			searchErr = LDAP.NewError(LDAP.LDAPResultNoSuchObject, errors.New("no such object"))
+			So(lookUp(), ShouldNotBeNil)
+
+			searchErr = nil
+			So(lookUp(), ShouldBeNil)
+			So(conns, ShouldHaveLength, 1)
+		})
+
+		Convey("Should check the idle connection before reusing it", func() {
+			setting.LdapServiceConnectionCheckInterval = 0
+			So(lookUp(), ShouldBeNil)
+			So(lookUp(), ShouldBeNil)
+			So(searchBases, ShouldResemble, []string{"ou=users,dc=grafana,dc=org", "", "ou=users,dc=grafana,dc=org"})
+			So(conns, ShouldHaveLength, 1)
+		})
+
+		Convey("Should drop the connections of a reloaded config", func() {
+			So(lookUp(), ShouldBeNil)
+
+			reloaded := *server
+			_, err := (&Auth{server: &reloaded, log: log.New("test-logger")}).User("roel")
+			So(err, ShouldBeNil)
+			So(conns, ShouldHaveLength, 2)
+			So(conns[0].closed, ShouldBeTrue)
+		})
+
+		Convey("Should close the connection of an aborted operation", func() {
+			auth := &Auth{server: server, log: log.New("test-logger")}
+			So(auth.connectService(), ShouldBeNil)
+			auth.Close()
+			So(conns[0].closed, ShouldBeTrue)
+
+			So(lookUp(), ShouldBeNil)
+			So(conns, ShouldHaveLength, 2)
+		})
+
+		Convey("Should count the pooled connection of the host", func() {
+			dialed := hookDial
+			hookDial = func(auth *Auth) error {
+				if err := dialed(auth); err != nil {
+					return err
+				}
+				return auth.setConn(auth.conn, "ldap.example.org:389")
+			}
+			address := "ldap.example.org:389"
+			open := gaugeValue(metrics.M_Ldap_Connections_Open, address)
+			pooled := gaugeValue(metrics.M_Ldap_Connections_Pooled, address)
+			inUse := gaugeValue(metrics.M_Ldap_Connections_In_Use, address)
+
+			So(lookUp(), ShouldBeNil)
+			So(gaugeValue(metrics.M_Ldap_Connections_Open, address), ShouldEqual, open+1)
+			So(gaugeValue(metrics.M_Ldap_Connections_Pooled, address), ShouldEqual, pooled+1)
+			So(gaugeValue(metrics.M_Ldap_Connections_In_Use, address), ShouldEqual, inUse)
+
+			closeServiceConnections()
+			So(gaugeValue(metrics.M_Ldap_Connections_Open, address), ShouldEqual, open)
+			So(gaugeValue(metrics.M_Ldap_Connections_Pooled, address), ShouldEqual, pooled)
+			So(gaugeValue(metrics.M_Ldap_Connections_In_Use, address), ShouldEqual, inUse)
+		})
+
+		Convey("Should dial every time without service_connection", func() {
+			setting.LdapServiceConnection = false
+			So(lookUp(), ShouldBeNil)
+			So(lookUp(), ShouldBeNil)
+			So(conns, ShouldHaveLength, 2)
+			So(binds, ShouldEqual, 2)
+		})
+	})
+}
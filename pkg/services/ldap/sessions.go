@@ -0,0 +1,71 @@
+package ldap
+
+import (
+	"strings"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+	LDAP "gopkg.in/ldap.v3"
+)
+
+// disabledAccountCodes are the Active Directory sub-codes of the invalid
+// credentials errors telling the account is disabled or expired, the
+// other sub-codes like a wrong password don't mean the access was lost
+var disabledAccountCodes = []string{
+	"data 533", // ERROR_ACCOUNT_DISABLED
+	"data 701", // ERROR_ACCOUNT_EXPIRED
+}
+
+// isAccountDisabled checks if the bind error says the account is disabled in the directory
+func isAccountDisabled(err error) bool {
+	ldapErr, ok := err.(*LDAP.Error)
+	if !ok || ldapErr.ResultCode != LDAP.LDAPResultInvalidCredentials || ldapErr.Err == nil {
+		return false
+	}
+
+	for _, code := range disabledAccountCodes {
+		if strings.Contains(ldapErr.Err.Error(), code) {
+			return true
+		}
+	}
+	return false
+}
+
+// revokeSessions revokes the Grafana sessions and deletes the API keys of
+// the user, who lost the LDAP access, instead of letting them last until
+// they expire. The Grafana user is the one the login would have updated,
+// the protected users are left alone
+func (auth *Auth) revokeSessions(user *UserInfo, reason string) {
+	if !setting.LdapRevokeSessions || IsProtectedUser(user) {
+		return
+	}
+
+	query := &models.GetUserByAuthInfoQuery{
+		AuthModule: AuthModule,
+		AuthId:     user.DN,
+		Email:      user.Email,
+		Login:      user.Username,
+	}
+	if err := bus.Dispatch(query); err != nil {
+		if err != models.ErrUserNotFound {
+			auth.log.Warn("Failed to find the user who lost the LDAP access", "username", user.Username, "error", err)
+		}
+		return
+	}
+
+	cmd := &models.RevokeAllUserTokensCommand{UserId: query.Result.Id}
+	if err := bus.Dispatch(cmd); err != nil {
+		auth.log.Warn("Failed to revoke the sessions of the user who lost the LDAP access", "username", user.Username, "error", err)
+		return
+	}
+
+	keys := &models.DeleteUserApiKeysCommand{UserId: query.Result.Id}
+	if err := bus.Dispatch(keys); err != nil {
+		auth.log.Warn("Failed to delete the API keys of the user who lost the LDAP access", "username", user.Username, "error", err)
+		return
+	}
+
+	auth.log.Info("Revoked the sessions of the user who lost the LDAP access",
+		"username", user.Username, "userId", query.Result.Id, "keys", keys.DeletedRows, "reason", reason)
+}
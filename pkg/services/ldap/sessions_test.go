@@ -0,0 +1,105 @@
+package ldap
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+	. "github.com/smartystreets/goconvey/convey"
+	LDAP "gopkg.in/ldap.v3"
+)
+
+func TestRevokeSessions(t *testing.T) {
+	Convey("isAccountDisabled", t, func() {
+		Convey("Should match the disabled and expired accounts", func() {
+			So(isAccountDisabled(&LDAP.Error{ResultCode: 49, Err: errors.New("80090308: LdapErr: DSID-0C09042A, comment: AcceptSecurityContext error, data 533, v3839")}), ShouldBeTrue)
+			So(isAccountDisabled(&LDAP.Error{ResultCode: 49, Err: errors.New("AcceptSecurityContext error, data 701, v3839")}), ShouldBeTrue)
+		})
+
+		Convey("Should not match the wrong passwords", func() {
+			So(isAccountDisabled(&LDAP.Error{ResultCode: 49, Err: errors.New("AcceptSecurityContext error, data 52e, v3839")}), ShouldBeFalse)
+			So(isAccountDisabled(errors.New("data 533")), ShouldBeFalse)
+		})
+	})
+
+	Convey("revokeSessions", t, func() {
+		revokeSessions := setting.LdapRevokeSessions
+		defer func() { setting.LdapRevokeSessions = revokeSessions }()
+		setting.LdapRevokeSessions = true
+
+		var revoked *models.RevokeAllUserTokensCommand
+		var deletedKeys *models.DeleteUserApiKeysCommand
+		bus.AddHandler("test", func(query *models.GetUserByAuthInfoQuery) error {
+			if query.AuthId != "cn=torkelo,dc=grafana,dc=org" {
+				return models.ErrUserNotFound
+			}
+			query.Result = &models.User{Id: 12}
+			return nil
+		})
+		bus.AddHandler("test", func(cmd *models.RevokeAllUserTokensCommand) error {
+			revoked = cmd
+			return nil
+		})
+		bus.AddHandler("test", func(cmd *models.DeleteUserApiKeysCommand) error {
+			deletedKeys = cmd
+			cmd.DeletedRows = 2
+			return nil
+		})
+
+		auth := &Auth{
+			server: &ServerConfig{Groups: []*GroupToOrgRole{{GroupDN: "cn=admins", OrgRole: "Admin"}}},
+			log:    log.New("test-logger"),
+		}
+
+		Convey("Should revoke the sessions of the users no group mapping matches", func() {
+			_, err := auth.GetGrafanaUserFor(nil, &UserInfo{DN: "cn=torkelo,dc=grafana,dc=org", Username: "torkelo"})
+			So(err, ShouldEqual, ErrInvalidCredentials)
+			So(revoked, ShouldNotBeNil)
+			So(revoked.UserId, ShouldEqual, 12)
+		})
+
+		Convey("Should delete the API keys of the users who lost the access", func() {
+			auth.revokeSessions(&UserInfo{DN: "cn=torkelo,dc=grafana,dc=org"}, "test")
+			So(deletedKeys, ShouldNotBeNil)
+			So(deletedKeys.UserId, ShouldEqual, 12)
+		})
+
+		Convey("Should revoke the sessions of the users disabled in the directory", func() {
+			conn := &mockLdapConn{}
+			conn.bindProvider = func(username, password string) error {
+				return &LDAP.Error{ResultCode: 49, Err: errors.New("AcceptSecurityContext error, data 533, v3839")}
+			}
+			auth.conn = conn
+
+			err := auth.secondBind(&UserInfo{DN: "cn=torkelo,dc=grafana,dc=org"}, "pwd")
+			So(err, ShouldEqual, ErrInvalidCredentials)
+			So(revoked, ShouldNotBeNil)
+		})
+
+		Convey("Should leave the sessions of the protected users alone", func() {
+			defer func() { setting.LdapSyncProtectedUsers = nil }()
+			setting.LdapSyncProtectedUsers = []string{"torkelo"}
+
+			_, err := auth.GetGrafanaUserFor(nil, &UserInfo{DN: "cn=torkelo,dc=grafana,dc=org", Username: "torkelo"})
+			So(err, ShouldEqual, ErrInvalidCredentials)
+			So(revoked, ShouldBeNil)
+			So(deletedKeys, ShouldBeNil)
+		})
+
+		Convey("Should leave the sessions alone when turned off", func() {
+			setting.LdapRevokeSessions = false
+			auth.revokeSessions(&UserInfo{DN: "cn=torkelo,dc=grafana,dc=org"}, "test")
+			So(revoked, ShouldBeNil)
+			So(deletedKeys, ShouldBeNil)
+		})
+
+		Convey("Should ignore the users not in Grafana", func() {
+			auth.revokeSessions(&UserInfo{DN: "cn=unknown,dc=grafana,dc=org"}, "test")
+			So(revoked, ShouldBeNil)
+			So(deletedKeys, ShouldBeNil)
+		})
+	})
+}
@@ -7,17 +7,22 @@ import (
 	"github.com/BurntSushi/toml"
 	"golang.org/x/xerrors"
 
-	"github.com/grafana/grafana/pkg/infra/log"
 	m "github.com/grafana/grafana/pkg/models"
 	"github.com/grafana/grafana/pkg/setting"
 	"github.com/grafana/grafana/pkg/util/errutil"
 )
 
 type Config struct {
+	// Version is the version of the config schema, see SchemaVersion
+	Version int             `toml:"version"`
 	Servers []*ServerConfig `toml:"servers"`
+
+	// Defaults holds the options inherited by the servers which leave them unset
+	Defaults *ServerConfig `toml:"defaults"`
 }
 
 type ServerConfig struct {
+	Enabled       *bool        `toml:"enabled"` // This is a pointer to know if it was set or not, servers are enabled by default
 	Host          string       `toml:"host"`
 	Port          int          `toml:"port"`
 	UseSSL        bool         `toml:"use_ssl"`
@@ -30,14 +35,158 @@ type ServerConfig struct {
 	BindPassword  string       `toml:"bind_password"`
 	Attr          AttributeMap `toml:"attributes"`
 
+	// AuthStrategy is how the users are authenticated, see AuthStrategySearchBind
+	AuthStrategy string `toml:"auth_strategy"`
+
+	// BindDNTemplates are the DNs tried in order by the direct binds, instead of BindDN
+	BindDNTemplates []string `toml:"bind_dn_templates"`
+
 	SearchFilter  string   `toml:"search_filter"`
 	SearchBaseDNs []string `toml:"search_base_dns"`
 
+	// SearchBaseOverrides sets the filter and attributes of some of the search bases
+	SearchBaseOverrides []*SearchBaseOverride `toml:"search_base_overrides"`
+
 	GroupSearchFilter              string   `toml:"group_search_filter"`
 	GroupSearchFilterUserAttribute string   `toml:"group_search_filter_user_attribute"`
 	GroupSearchBaseDNs             []string `toml:"group_search_base_dns"`
 
+	// GroupSearchFilters are more group search filters, the groups of
+	// the users are the union of the groups matching any of the filters
+	GroupSearchFilters []*GroupSearchFilter `toml:"group_search_filters"`
+
+	// GroupAttr names the attributes of the group entries read with the
+	// group search, besides the group_search_group_attribute
+	GroupAttr GroupAttributeMap `toml:"group_attributes"`
+
+	// GroupSearchGroupAttribute is the attribute of the group entries
+	// matched by the group search mapped to the groups, "dn" if unset
+	GroupSearchGroupAttribute string `toml:"group_search_group_attribute"`
+
 	Groups []*GroupToOrgRole `toml:"group_mappings"`
+
+	// Domains lists the login domains (user@domain) owned by this server,
+	// an empty list means the server can own any login
+	Domains []string `toml:"domains"`
+
+	// SearchTimeout is the number of seconds the directory may spend on a
+	// search, 0 leaves it to the directory
+	SearchTimeout int `toml:"search_timeout"`
+
+	// ProxyURL is the SOCKS5 or HTTP CONNECT proxy to dial the server through
+	ProxyURL string `toml:"proxy_url"`
+
+	// RevocationChecks lists the ways to check if the server certificate
+	// was revoked ("ocsp", "crl"), tried in order until one knows the status
+	RevocationChecks []string `toml:"revocation_checks"`
+
+	// RevocationSoftFail trusts the certificate if none of the checks knows its status
+	RevocationSoftFail bool `toml:"revocation_soft_fail"`
+
+	// ChannelBinding refuses the connections which can't carry the
+	// tls-server-end-point channel binding, for the domain controllers
+	// enforcing LDAP signing and channel binding. Requires use_ssl
+	ChannelBinding bool `toml:"channel_binding"`
+
+	// SeparateUserBind binds the user on a new connection instead of the one of
+	// the service account, for the directories which don't allow binding again
+	SeparateUserBind bool `toml:"separate_user_bind"`
+
+	// BusyRetries is how many times the binds and searches the server
+	// refused as busy are retried, with a doubling delay
+	BusyRetries int `toml:"busy_retries"`
+
+	// ClientCertAuth authenticates Grafana with client_cert alone, the
+	// searches are sent without binding a service account first
+	ClientCertAuth bool `toml:"client_cert_auth"`
+
+	// HBACService is the FreeIPA HBAC service of Grafana, when set the users
+	// must be allowed to access it by one of the HBAC rules of the domain
+	HBACService string `toml:"hbac_service"`
+
+	// HBACHost is the FreeIPA host of Grafana the HBAC rules are checked for,
+	// the rules for all hosts are the only ones matching if unset
+	HBACHost string `toml:"hbac_host"`
+
+	// Quirks are the vendor quirks of the server, detected from the
+	// vendor of its rootDSE if unset, "none" disables them
+	Quirks []string `toml:"quirks"`
+
+	// Preset names the directory vendor whose filters and attributes fill the ones left unset
+	Preset string `toml:"preset"`
+
+	// AllowSignUp creates the Grafana users on their first login, it's
+	// [auth.ldap] allow_sign_up if unset
+	AllowSignUp *bool `toml:"allow_sign_up"`
+
+	// SignUpGroups lists the groups whose members may be created on
+	// their first login, the members of any group may if empty
+	SignUpGroups []string `toml:"sign_up_groups"`
+
+	// AccountRestrictions refuses the logins the Active Directory
+	// logonHours and accountExpires of the user don't allow
+	AccountRestrictions bool `toml:"account_restrictions"`
+
+	// SecondFactorSeedAttribute is the attribute holding the base32 TOTP seed of the
+	// users, the seeds are the ones enrolled in Grafana if unset
+	SecondFactorSeedAttribute string `toml:"second_factor_seed_attribute"`
+
+	// PasswordPolicy asks for the draft-behera password policy control on the
+	// binds of the users, for the expiration warnings and the lockout reasons
+	PasswordPolicy bool `toml:"password_policy"`
+
+	// StoredAttributes maps the names of the attributes stored with the
+	// Grafana users on login and sync to the LDAP attributes they're read from
+	StoredAttributes map[string]string `toml:"stored_attributes"`
+
+	// ManagerAttribute is the attribute holding the DN of the manager of
+	// the users, resolved up to ManagerChainDepth managers and stored
+	ManagerAttribute  string `toml:"manager_attribute"`
+	ManagerChainDepth int    `toml:"manager_chain_depth"`
+
+	// ServiceAccounts maps the machine entries of the directory, by OU or
+	// attribute, to Grafana service accounts. They only authenticate the
+	// API requests, with the org roles of their mappings instead of the groups
+	ServiceAccounts []*ServiceAccountMapping `toml:"service_account_mappings"`
+
+	// RequiredAttributes lists the attributes of [servers.attributes] the
+	// users listed for the sync must have a value for, like "email". The
+	// entries missing one are left out and counted
+	RequiredAttributes []string `toml:"required_attributes"`
+
+	// AllowedEmailDomains lists the domains the emails of the users must
+	// be in, the other users are rejected or mapped without an email
+	// according to EmailDomainMismatch
+	AllowedEmailDomains []string `toml:"allowed_email_domains"`
+	EmailDomainMismatch string   `toml:"email_domain_mismatch"`
+
+	// LoginNormalization lists the steps applied to the login attribute
+	// to get the Grafana login, and LoginCollision how an entry getting
+	// the login of the Grafana user of another entry is handled
+	LoginNormalization []string `toml:"login_normalization"`
+	LoginCollision     string   `toml:"login_collision"`
+
+	// GuidAttribute is the attribute of the unique id of the entries, like
+	// objectGUID, the Grafana users of the moved entries are relinked by
+	GuidAttribute string `toml:"guid_attribute"`
+
+	// MultipleMatches is how an entry is chosen when the login matches
+	// several: it fails, or the entry is the one under the first of the
+	// PreferredBaseDNs or the one whose ExactMatchAttribute is the login
+	MultipleMatches     string   `toml:"multiple_matches"`
+	PreferredBaseDNs    []string `toml:"preferred_base_dns"`
+	ExactMatchAttribute string   `toml:"exact_match_attribute"`
+
+	// GroupMemberAttribute is the attribute of the members of the mapped
+	// groups read when group_watch_interval watches them, member by default
+	GroupMemberAttribute string `toml:"group_member_attribute"`
+
+	// AttributeProjection is which attributes the user searches request:
+	// the ones the operation needs by default, or all the mapped ones
+	AttributeProjection string `toml:"attribute_projection"`
+
+	// groupMapping is the lookup of the group mappings, built by validateConfig
+	groupMapping *groupMapping
 }
 
 type AttributeMap struct {
@@ -48,15 +197,40 @@ type AttributeMap struct {
 	MemberOf string `toml:"member_of"`
 }
 
+// SearchBaseOverride holds the filter and the attributes of the users of
+// one of the search_base_dns, the options left unset are the server ones
+type SearchBaseOverride struct {
+	BaseDN       string       `toml:"base_dn"`
+	SearchFilter string       `toml:"search_filter"`
+	Attr         AttributeMap `toml:"attributes"`
+}
+
 type GroupToOrgRole struct {
 	GroupDN        string     `toml:"group_dn"`
 	OrgId          int64      `toml:"org_id"`
 	IsGrafanaAdmin *bool      `toml:"grafana_admin"` // This is a pointer to know if it was set or not (for backwards compatibility)
 	OrgRole        m.RoleType `toml:"org_role"`
+
+	// SecondFactor requires the members of the group to give a TOTP code
+	SecondFactor bool `toml:"second_factor"`
+
+	// Quotas are the limits of the org quotas by target the logins and
+	// syncs of the members of the group raise the org quotas to
+	Quotas map[string]int64 `toml:"quotas"`
+}
+
+// ServiceAccountMapping matches the entries under BaseDN, or with the
+// Value in their Attribute, and gives them the OrgRole in the OrgId
+type ServiceAccountMapping struct {
+	BaseDN    string     `toml:"base_dn"`
+	Attribute string     `toml:"attribute"`
+	Value     string     `toml:"value"`
+	OrgId     int64      `toml:"org_id"`
+	OrgRole   m.RoleType `toml:"org_role"`
 }
 
 var config *Config
-var logger = log.New("ldap")
+var logger = NewLogger("ldap")
 
 // loadingMutex locks the reading of the config so multiple requests for reloading are sequential.
 var loadingMutex = &sync.Mutex{}
@@ -76,7 +250,10 @@ func ReloadConfig() error {
 	defer loadingMutex.Unlock()
 
 	var err error
-	config, err = readConfig(setting.LdapConfigFile)
+	config, err = loadConfig()
+	if err == nil && configReloaded != nil {
+		configReloaded(config)
+	}
 	return err
 }
 
@@ -96,34 +273,88 @@ func GetConfig() (*Config, error) {
 	defer loadingMutex.Unlock()
 
 	var err error
-	config, err = readConfig(setting.LdapConfigFile)
+	config, err = loadConfig()
 
 	return config, err
 }
 
+// ReadConfigFile reads and validates the LDAP config file, whether LDAP is enabled or not
+func ReadConfigFile(configFile string) (*Config, error) {
+	return readConfig(configFile)
+}
+
 func readConfig(configFile string) (*Config, error) {
 	result := &Config{}
 
 	logger.Info("Ldap enabled, reading config file", "file", configFile)
 
-	_, err := toml.DecodeFile(configFile, result)
+	meta, err := toml.DecodeFile(configFile, result)
 	if err != nil {
 		return nil, errutil.Wrap("Failed to load ldap config file", err)
 	}
+	inheritDefaults(result, meta)
+
+	if err := validateConfig(result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// validateConfig checks the required options and sets the defaults
+func validateConfig(result *Config) error {
+	if err := migrateConfig(result); err != nil {
+		return err
+	}
 
 	if len(result.Servers) == 0 {
-		return nil, xerrors.New("ldap enabled but no ldap servers defined in config file")
+		return xerrors.New("ldap enabled but no ldap servers defined in config file")
 	}
 
 	// set default org id
 	for _, server := range result.Servers {
+		err := applyPreset(server)
+		if err != nil {
+			return errutil.Wrap("Failed to apply preset", err)
+		}
+		err = validatePlaceholders(server)
+		if err != nil {
+			return errutil.Wrap("Failed to validate placeholders", err)
+		}
 		err = assertNotEmptyCfg(server.SearchFilter, "search_filter")
 		if err != nil {
-			return nil, errutil.Wrap("Failed to validate SearchFilter section", err)
+			return errutil.Wrap("Failed to validate SearchFilter section", err)
 		}
 		err = assertNotEmptyCfg(server.SearchBaseDNs, "search_base_dns")
 		if err != nil {
-			return nil, errutil.Wrap("Failed to validate SearchBaseDNs section", err)
+			return errutil.Wrap("Failed to validate SearchBaseDNs section", err)
+		}
+		err = validateAuthStrategy(server)
+		if err != nil {
+			return errutil.Wrap("Failed to validate auth_strategy", err)
+		}
+		if hasTemplatedServiceAccount(server) {
+			logger.Warn(templatedServiceAccountWarning, "server", ServerKey(server), "bind_dn", server.BindDN)
+		}
+		err = validateClientKey(server)
+		if err != nil {
+			return errutil.Wrap("Failed to validate client_key", err)
+		}
+		err = validateSearchBaseOverrides(server)
+		if err != nil {
+			return errutil.Wrap("Failed to validate search_base_overrides", err)
+		}
+		err = validateFIPS(server)
+		if err != nil {
+			return errutil.Wrap("Failed to validate FIPS mode", err)
+		}
+		err = validateChannelBinding(server)
+		if err != nil {
+			return errutil.Wrap("Failed to validate channel_binding", err)
+		}
+		err = validateQuirks(server)
+		if err != nil {
+			return errutil.Wrap("Failed to validate quirks", err)
 		}
 
 		for _, groupMap := range server.Groups {
@@ -131,9 +362,47 @@ func readConfig(configFile string) (*Config, error) {
 				groupMap.OrgId = 1
 			}
 		}
+		err = validateGroupQuotas(server)
+		if err != nil {
+			return errutil.Wrap("Failed to validate group_mappings quotas", err)
+		}
+		err = validateManagerChain(server)
+		if err != nil {
+			return errutil.Wrap("Failed to validate manager_attribute", err)
+		}
+		err = validateServiceAccounts(server)
+		if err != nil {
+			return errutil.Wrap("Failed to validate service_account_mappings", err)
+		}
+		err = validateRequiredAttributes(server)
+		if err != nil {
+			return errutil.Wrap("Failed to validate required_attributes", err)
+		}
+		err = validateEmailDomains(server)
+		if err != nil {
+			return errutil.Wrap("Failed to validate allowed_email_domains", err)
+		}
+		err = validateUsernames(server)
+		if err != nil {
+			return errutil.Wrap("Failed to validate login_normalization", err)
+		}
+		err = validateMultipleMatches(server)
+		if err != nil {
+			return errutil.Wrap("Failed to validate multiple_matches", err)
+		}
+		err = validateGroupSearchFilters(server)
+		if err != nil {
+			return errutil.Wrap("Failed to validate group_search_filters", err)
+		}
+		err = validateAttributeProjection(server)
+		if err != nil {
+			return errutil.Wrap("Failed to validate attribute_projection", err)
+		}
+
+		server.buildGroupMapping()
 	}
 
-	return result, nil
+	return nil
 }
 
 func assertNotEmptyCfg(val interface{}, propName string) error {
@@ -0,0 +1,73 @@
+package ldap
+
+import (
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap/ldaptest"
+)
+
+// Simulation is the mapping of a user of the LDIF entries
+type Simulation struct {
+	// Server is the server of the config which found the user
+	Server *ServerConfig
+
+	User         *UserInfo
+	ExternalUser *models.ExternalUserInfo
+
+	// SignupAllowed is set if a Grafana user may be created on the first login
+	SignupAllowed bool
+
+	// Err is the error refusing the user access, like
+	// ErrInvalidCredentials when no group mapping matches
+	Err error
+}
+
+// Simulate looks the user up in the LDIF entries, served by the ldaptest
+// server in place of each active server of the config in turn, and maps it
+// like a login does, without the password and the Grafana users. The first
+// server finding the user answers, ErrInvalidCredentials is returned if
+// none does
+func Simulate(config *Config, ldif string, username string) (*Simulation, error) {
+	directory, err := ldaptest.NewServer(ldif)
+	if err != nil {
+		return nil, err
+	}
+	defer directory.Close()
+
+	for _, server := range config.Servers {
+		if !IsActive(server) || !CanSearchUsers(server) {
+			continue
+		}
+
+		auth := &Auth{server: simulatedServer(server, directory), log: logger}
+		user, err := auth.User(username)
+		if err == ErrCouldNotFindUser {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		simulation := &Simulation{Server: server, User: user, ExternalUser: auth.buildGrafanaUser(user)}
+		simulation.SignupAllowed, simulation.Err = auth.validateGrafanaUser(user, simulation.ExternalUser)
+		return simulation, nil
+	}
+
+	return nil, ErrInvalidCredentials
+}
+
+// simulatedServer is the server searching the ldaptest server instead,
+// anonymously and without the options of the connection
+func simulatedServer(server *ServerConfig, directory *ldaptest.Server) *ServerConfig {
+	simulated := *server
+	simulated.Host = directory.Host()
+	simulated.Port = directory.Port()
+	simulated.UseSSL = false
+	simulated.StartTLS = false
+	simulated.ProxyURL = ""
+	simulated.RevocationChecks = nil
+	simulated.ChannelBinding = false
+	simulated.ClientCertAuth = false
+	simulated.BindDN = ""
+	simulated.BindPassword = ""
+	return &simulated
+}
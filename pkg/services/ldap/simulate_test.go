@@ -0,0 +1,63 @@
+package ldap
+
+import (
+	"io/ioutil"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/grafana/grafana/pkg/models"
+)
+
+func TestSimulate(t *testing.T) {
+	Convey("Simulate", t, func() {
+		ldif, err := ioutil.ReadFile("testdata/grafana.ldif")
+		So(err, ShouldBeNil)
+
+		defer dialServers()()
+
+		admin := true
+		config := &Config{Servers: []*ServerConfig{{
+			Host:          "ldap.example.org",
+			Port:          636,
+			UseSSL:        true,
+			BindDN:        "cn=admin,dc=grafana,dc=org",
+			BindPassword:  "production-secret",
+			SearchFilter:  "(cn=%s)",
+			SearchBaseDNs: []string{"dc=grafana,dc=org"},
+			Attr: AttributeMap{
+				Username: "cn",
+				Name:     "givenName",
+				Surname:  "sn",
+				Email:    "mail",
+				MemberOf: "memberOf",
+			},
+			Groups: []*GroupToOrgRole{
+				{GroupDN: "cn=admins,ou=groups,dc=grafana,dc=org", OrgId: 1, OrgRole: models.ROLE_ADMIN, IsGrafanaAdmin: &admin},
+				{GroupDN: "cn=editors,ou=groups,dc=grafana,dc=org", OrgId: 1, OrgRole: models.ROLE_EDITOR},
+				{GroupDN: "cn=editors,ou=groups,dc=grafana,dc=org", OrgId: 2, OrgRole: models.ROLE_VIEWER},
+			},
+		}}}
+
+		Convey("Should map the user with the first matching groups", func() {
+			simulation, err := Simulate(config, string(ldif), "ldap-admin")
+			So(err, ShouldBeNil)
+			So(simulation.Server, ShouldEqual, config.Servers[0])
+			So(simulation.Err, ShouldBeNil)
+			So(simulation.ExternalUser.Email, ShouldEqual, "ldap-admin@grafana.com")
+			So(simulation.ExternalUser.OrgRoles, ShouldResemble, map[int64]models.RoleType{1: models.ROLE_ADMIN, 2: models.ROLE_VIEWER})
+			So(*simulation.ExternalUser.IsGrafanaAdmin, ShouldBeTrue)
+		})
+
+		Convey("Should refuse the user without a matching group", func() {
+			simulation, err := Simulate(config, string(ldif), "ldap-viewer")
+			So(err, ShouldBeNil)
+			So(simulation.Err, ShouldEqual, ErrInvalidCredentials)
+		})
+
+		Convey("Should not find the unknown users", func() {
+			_, err := Simulate(config, string(ldif), "ldap-unknown")
+			So(err, ShouldEqual, ErrInvalidCredentials)
+		})
+	})
+}
@@ -0,0 +1,80 @@
+package ldap
+
+import (
+	"regexp"
+	"time"
+
+	LDAP "gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// filterValuePattern matches the asserted values of a search filter
+var filterValuePattern = regexp.MustCompile(`([~<>]?=)[^()]*\)`)
+
+// timedConnection is a connection which logs the
+// binds and searches slower than the configured threshold
+type timedConnection struct {
+	IConnection
+	address string
+	log     log.Logger
+}
+
+// timeConnection wraps the connection to address with the slow
+// operation logging, unless slow_operation_threshold is 0
+func timeConnection(conn IConnection, address string, logger log.Logger) IConnection {
+	if setting.LdapSlowOperationThreshold <= 0 {
+		return conn
+	}
+
+	return &timedConnection{
+		IConnection: conn,
+		address:     address,
+		log:         logger,
+	}
+}
+
+func (conn *timedConnection) Bind(username, password string) error {
+	defer conn.logIfSlow(time.Now(), "bind")
+
+	return conn.IConnection.Bind(username, password)
+}
+
+func (conn *timedConnection) SimpleBind(request *LDAP.SimpleBindRequest) (*LDAP.SimpleBindResult, error) {
+	defer conn.logIfSlow(time.Now(), "bind")
+
+	return conn.IConnection.SimpleBind(request)
+}
+
+func (conn *timedConnection) UnauthenticatedBind(username string) error {
+	defer conn.logIfSlow(time.Now(), "bind")
+
+	return conn.IConnection.UnauthenticatedBind(username)
+}
+
+func (conn *timedConnection) Search(request *LDAP.SearchRequest) (*LDAP.SearchResult, error) {
+	defer conn.logIfSlow(time.Now(), "search", "base_dn", request.BaseDN, "filter", anonymizeFilter(request.Filter))
+
+	return conn.IConnection.Search(request)
+}
+
+func (conn *timedConnection) SearchStream(request *LDAP.SearchRequest, pagingSize uint32, handle EntryHandler) error {
+	return streamSearch(conn, request, pagingSize, handle)
+}
+
+func (conn *timedConnection) logIfSlow(start time.Time, operation string, ctx ...interface{}) {
+	elapsed := time.Since(start)
+	if elapsed < setting.LdapSlowOperationThreshold {
+		return
+	}
+
+	ctx = append([]interface{}{"operation", operation, "host", conn.address, "duration", elapsed}, ctx...)
+	conn.log.Warn("Slow LDAP operation", ctx...)
+}
+
+// anonymizeFilter replaces the values of the filter, which contain
+// usernames, so "(&(uid=roel)(objectClass=person))" becomes "(&(uid=?)(objectClass=?))"
+func anonymizeFilter(filter string) string {
+	return filterValuePattern.ReplaceAllString(filter, "$1?)")
+}
@@ -0,0 +1,64 @@
+package ldap
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+func TestSlowOperationLogging(t *testing.T) {
+	Convey("anonymizeFilter", t, func() {
+		So(anonymizeFilter("(&(uid=roel)(objectClass=person))"), ShouldEqual, "(&(uid=?)(objectClass=?))")
+		So(anonymizeFilter("(|(sAMAccountName=roel)(userPrincipalName=roel@grafana.com))"), ShouldEqual, "(|(sAMAccountName=?)(userPrincipalName=?))")
+		So(anonymizeFilter("(memberOf:1.2.840.113556.1.4.1941:=CN=roel,DC=grafana)"), ShouldEqual, "(memberOf:1.2.840.113556.1.4.1941:=?)")
+		So(anonymizeFilter("(createTimestamp>=2019)"), ShouldEqual, "(createTimestamp>=?)")
+	})
+
+	Convey("timedConnection", t, func() {
+		logger := &recordingLogger{Logger: log.New("test-logger")}
+		defer func() { setting.LdapSlowOperationThreshold = 0 }()
+
+		Convey("Should not wrap the connection when disabled", func() {
+			setting.LdapSlowOperationThreshold = 0
+			conn := &mockLdapConn{}
+
+			So(timeConnection(conn, "ldap:389", logger), ShouldEqual, conn)
+		})
+
+		Convey("Should log the slow searches", func() {
+			setting.LdapSlowOperationThreshold = time.Nanosecond
+			conn := timeConnection(&mockLdapConn{}, "ldap:389", logger)
+
+			_, err := conn.Search(&ldap.SearchRequest{BaseDN: "dc=grafana,dc=org", Filter: "(uid=roel)"})
+
+			So(err, ShouldBeNil)
+			So(logger.warnings, ShouldHaveLength, 1)
+			So(logger.warnings[0], ShouldContain, "dc=grafana,dc=org")
+			So(logger.warnings[0], ShouldContain, "(uid=?)")
+			So(logger.warnings[0], ShouldContain, "ldap:389")
+		})
+
+		Convey("Should not log the fast binds", func() {
+			setting.LdapSlowOperationThreshold = time.Hour
+			conn := timeConnection(&mockLdapConn{}, "ldap:389", logger)
+
+			So(conn.Bind("cn=admin", "pwd"), ShouldBeNil)
+			So(logger.warnings, ShouldBeEmpty)
+		})
+	})
+}
+
+// recordingLogger records the context of the warnings
+type recordingLogger struct {
+	log.Logger
+	warnings [][]interface{}
+}
+
+func (logger *recordingLogger) Warn(msg string, ctx ...interface{}) {
+	logger.warnings = append(logger.warnings, ctx)
+}
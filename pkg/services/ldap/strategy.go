@@ -0,0 +1,108 @@
+package ldap
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/xerrors"
+)
+
+const (
+	// AuthStrategySearchBind binds with the service account, searches the
+	// user and binds as the user found to check the password, the default
+	AuthStrategySearchBind = "search+bind"
+
+	// AuthStrategyDirectBind binds as the user, bind_dn being the template
+	// of the user DNs, then searches the user with that connection
+	AuthStrategyDirectBind = "direct-bind"
+
+	// AuthStrategySearchOnly binds with the service account and searches
+	// the users without checking their password, to enrich the auth proxy users
+	AuthStrategySearchOnly = "search-only"
+)
+
+// ErrSearchOnly is returned by the logins on a search-only server
+var ErrSearchOnly = errors.New("LDAP server is search-only, it doesn't check passwords")
+
+// authStrategy returns the auth_strategy of the server
+func (server *ServerConfig) authStrategy() string {
+	if server.AuthStrategy == "" {
+		return AuthStrategySearchBind
+	}
+	return server.AuthStrategy
+}
+
+// CanAuthenticate checks if the server checks the passwords of the users logging in
+func CanAuthenticate(server *ServerConfig) bool {
+	return server.authStrategy() != AuthStrategySearchOnly
+}
+
+// CanSearchUsers checks if the server can search the users without their
+// password, the direct binds have no service account to search with
+func CanSearchUsers(server *ServerConfig) bool {
+	return server.authStrategy() != AuthStrategyDirectBind
+}
+
+// validateAuthStrategy checks the bind options fit the auth_strategy
+func validateAuthStrategy(server *ServerConfig) error {
+	if server.ClientCertAuth {
+		if server.authStrategy() == AuthStrategyDirectBind {
+			return xerrors.Errorf("client_cert_auth can't be used by auth_strategy %q, there is no service account to replace", AuthStrategyDirectBind)
+		}
+		if !server.UseSSL || server.ClientCert == "" || server.ClientKey == "" {
+			return xerrors.New("client_cert_auth needs use_ssl, client_cert and client_key")
+		}
+		if server.BindDN != "" || server.BindPassword != "" {
+			return xerrors.New("bind_dn and bind_password are not used with client_cert_auth, the client certificate authenticates Grafana")
+		}
+	}
+
+	switch server.authStrategy() {
+	case AuthStrategySearchBind, AuthStrategySearchOnly:
+		if hasPlaceholder(server.BindDN) && !hasTemplatedServiceAccount(server) {
+			return xerrors.Errorf("bind_dn %q has a placeholder, set auth_strategy = %q to bind as the user", server.BindDN, AuthStrategyDirectBind)
+		}
+		if len(server.BindDNTemplates) > 0 {
+			return xerrors.Errorf("bind_dn_templates is only used by auth_strategy %q", AuthStrategyDirectBind)
+		}
+	case AuthStrategyDirectBind:
+		if len(server.BindDNTemplates) > 0 && server.BindDN != "" {
+			return xerrors.New("bind_dn and bind_dn_templates can't both be set, list bind_dn in bind_dn_templates")
+		}
+		for _, template := range server.bindDNTemplates() {
+			if !hasPlaceholder(template) {
+				return xerrors.Errorf("auth_strategy %q needs bind DNs with a placeholder for the username, like \"cn=%%s,dc=grafana,dc=org\", got %q", AuthStrategyDirectBind, template)
+			}
+		}
+		if server.BindPassword != "" {
+			return xerrors.Errorf("bind_password is not used by auth_strategy %q, the users bind with their password", AuthStrategyDirectBind)
+		}
+	default:
+		return xerrors.Errorf("Unknown auth_strategy %q, use %q, %q or %q",
+			server.AuthStrategy, AuthStrategySearchBind, AuthStrategyDirectBind, AuthStrategySearchOnly)
+	}
+
+	return nil
+}
+
+// hasTemplatedServiceAccount checks bind_dn has a placeholder with
+// bind_password, which binds as bind_dn of the username with bind_password
+// before the search. Version 2 accepted it, it's deprecated but still works
+// templatedServiceAccountWarning is the deprecation warning of the templated service accounts
+const templatedServiceAccountWarning = "bind_dn with a placeholder and bind_password is deprecated, " +
+	"bind with a single service account or set auth_strategy = \"" + AuthStrategyDirectBind + "\""
+
+func hasTemplatedServiceAccount(server *ServerConfig) bool {
+	return server.authStrategy() == AuthStrategySearchBind && hasPlaceholder(server.BindDN) && server.BindPassword != ""
+}
+
+// migrateAuthStrategy makes the direct bind explicit: in version 2 the
+// users bound themselves when bind_dn had a placeholder and no bind_password
+func migrateAuthStrategy(server *ServerConfig) []string {
+	if server.AuthStrategy != "" || !hasPlaceholder(server.BindDN) || server.BindPassword != "" {
+		return nil
+	}
+
+	server.AuthStrategy = AuthStrategyDirectBind
+	return []string{fmt.Sprintf("auth_strategy = %q inferred from bind_dn %q without bind_password", AuthStrategyDirectBind, server.BindDN)}
+}
@@ -0,0 +1,91 @@
+package ldap
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAuthStrategy(t *testing.T) {
+	Convey("validateAuthStrategy", t, func() {
+		Convey("Should default to search+bind", func() {
+			server := &ServerConfig{BindDN: "cn=admin,dc=grafana,dc=org", BindPassword: "grafana"}
+			So(validateAuthStrategy(server), ShouldBeNil)
+			So(server.authStrategy(), ShouldEqual, AuthStrategySearchBind)
+			So(CanAuthenticate(server), ShouldBeTrue)
+		})
+
+		Convey("Should refuse a bind_dn with a placeholder and no bind_password to search+bind", func() {
+			err := validateAuthStrategy(&ServerConfig{AuthStrategy: AuthStrategySearchBind, BindDN: "cn=%s,dc=grafana,dc=org"})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, AuthStrategyDirectBind)
+
+			err = validateAuthStrategy(&ServerConfig{AuthStrategy: AuthStrategySearchOnly, BindDN: "cn=%s,dc=grafana,dc=org", BindPassword: "grafana"})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Should still accept a bind_dn with a placeholder and bind_password to search+bind", func() {
+			server := &ServerConfig{BindDN: "cn=%s,dc=grafana,dc=org", BindPassword: "grafana"}
+			So(validateAuthStrategy(server), ShouldBeNil)
+			So(hasTemplatedServiceAccount(server), ShouldBeTrue)
+			So(hasTemplatedServiceAccount(&ServerConfig{BindDN: "cn=admin,dc=grafana,dc=org", BindPassword: "grafana"}), ShouldBeFalse)
+		})
+
+		Convey("Should need a placeholder in bind_dn to direct-bind", func() {
+			err := validateAuthStrategy(&ServerConfig{AuthStrategy: AuthStrategyDirectBind, BindDN: "cn=admin,dc=grafana,dc=org"})
+			So(err, ShouldNotBeNil)
+
+			err = validateAuthStrategy(&ServerConfig{AuthStrategy: AuthStrategyDirectBind, BindDN: "cn={{.User}},dc=grafana,dc=org"})
+			So(err, ShouldBeNil)
+		})
+
+		Convey("Should refuse bind_password to direct-bind", func() {
+			err := validateAuthStrategy(&ServerConfig{
+				AuthStrategy: AuthStrategyDirectBind,
+				BindDN:       "cn=%s,dc=grafana,dc=org",
+				BindPassword: "grafana",
+			})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Should not authenticate with search-only", func() {
+			server := &ServerConfig{AuthStrategy: AuthStrategySearchOnly, BindDN: "cn=admin,dc=grafana,dc=org"}
+			So(validateAuthStrategy(server), ShouldBeNil)
+			So(CanAuthenticate(server), ShouldBeFalse)
+		})
+
+		Convey("Should need a client certificate for client_cert_auth", func() {
+			server := &ServerConfig{ClientCertAuth: true, UseSSL: true, ClientCert: "client.crt", ClientKey: "client.key"}
+			So(validateAuthStrategy(server), ShouldBeNil)
+
+			server.BindDN = "cn=admin,dc=grafana,dc=org"
+			So(validateAuthStrategy(server), ShouldNotBeNil)
+
+			So(validateAuthStrategy(&ServerConfig{ClientCertAuth: true, UseSSL: true}), ShouldNotBeNil)
+		})
+
+		Convey("Should refuse the unknown strategies", func() {
+			So(validateAuthStrategy(&ServerConfig{AuthStrategy: "bind"}), ShouldNotBeNil)
+		})
+	})
+
+	Convey("migrateAuthStrategy", t, func() {
+		Convey("Should make the direct bind of version 2 configs explicit", func() {
+			config := &Config{
+				Version: 2,
+				Servers: []*ServerConfig{
+					{BindDN: "cn=%s,dc=grafana,dc=org"},
+					{BindDN: "cn=admin,dc=grafana,dc=org", BindPassword: "grafana"},
+					{BindDN: "cn=%s,dc=grafana,dc=org", BindPassword: "grafana"},
+				},
+			}
+
+			changes := schemaChanges(config)
+			So(changes, ShouldHaveLength, 1)
+			So(changes[0].server, ShouldEqual, 0)
+			So(config.Servers[0].AuthStrategy, ShouldEqual, AuthStrategyDirectBind)
+			So(config.Servers[1].AuthStrategy, ShouldBeEmpty)
+			So(config.Servers[2].AuthStrategy, ShouldBeEmpty)
+		})
+	})
+}
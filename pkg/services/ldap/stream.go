@@ -0,0 +1,81 @@
+package ldap
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	LDAP "gopkg.in/ldap.v3"
+)
+
+// EntryHandler handles an entry of a streamed search, an error stops the search
+type EntryHandler func(entry *LDAP.Entry) error
+
+// ldapConnection is the connection of ldap.v3, streaming its searches and
+// abandoning the ones outliving its request timeout
+type ldapConnection struct {
+	*LDAP.Conn
+	network *abandoningConn
+
+	timeoutMutex sync.Mutex
+	timeout      time.Duration
+}
+
+// newLDAPConnection starts the connection of ldap.v3 over the network
+// connection, established and past its TLS handshake if any
+func newLDAPConnection(c net.Conn, isTLS bool) *ldapConnection {
+	network := &abandoningConn{Conn: c}
+	conn := LDAP.NewConn(network, isTLS)
+	conn.Start()
+	return &ldapConnection{Conn: conn, network: network}
+}
+
+func (conn *ldapConnection) SearchStream(request *LDAP.SearchRequest, pagingSize uint32, handle EntryHandler) error {
+	return streamSearch(conn, request, pagingSize, handle)
+}
+
+// streamSearch sends the search through the connection in pages of
+// pagingSize entries with the simple paged results control, handing the
+// entries of each page to the handler before the next page is requested,
+// so only one page is held at once instead of the whole result. The
+// connections wrapping another one stream with their own Search, so each
+// page goes through them like any search. The referrals are ignored
+func streamSearch(conn IConnection, request *LDAP.SearchRequest, pagingSize uint32, handle EntryHandler) error {
+	paging := LDAP.NewControlPaging(pagingSize)
+	paged := *request
+	paged.Controls = append(append([]LDAP.Control(nil), request.Controls...), paging)
+
+	for {
+		page, err := conn.Search(&paged)
+		if err != nil {
+			return err
+		}
+
+		response, ok := LDAP.FindControl(page.Controls, LDAP.ControlTypePaging).(*LDAP.ControlPaging)
+		more := ok && len(response.Cookie) > 0
+
+		for _, entry := range page.Entries {
+			if err := handle(entry); err != nil {
+				if more {
+					paging.SetCookie(response.Cookie)
+					abandonPagedSearch(conn, &paged, paging)
+				}
+				return err
+			}
+		}
+
+		if !more {
+			return nil
+		}
+		paging.SetCookie(response.Cookie)
+	}
+}
+
+// abandonPagedSearch abandons the paged search on the server, with a page
+// of size 0 carrying the cookie of the next page
+func abandonPagedSearch(conn IConnection, paged *LDAP.SearchRequest, paging *LDAP.ControlPaging) {
+	paging.PagingSize = 0
+	if _, err := conn.Search(paged); err != nil {
+		logger.Debug("Failed to abandon the paged LDAP search", "error", err)
+	}
+}
@@ -0,0 +1,69 @@
+package ldap
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	LDAP "gopkg.in/ldap.v3"
+)
+
+func TestSearchStream(t *testing.T) {
+	Convey("Streamed search", t, func() {
+		var sizes []uint32
+		conn := &mockLdapConn{
+			searchProvider: func(request *LDAP.SearchRequest) (*LDAP.SearchResult, error) {
+				paging := LDAP.FindControl(request.Controls, LDAP.ControlTypePaging).(*LDAP.ControlPaging)
+				sizes = append(sizes, paging.PagingSize)
+				result := &LDAP.SearchResult{Entries: []*LDAP.Entry{
+					LDAP.NewEntry("uid=user1", nil),
+					LDAP.NewEntry("uid=user2", nil),
+				}}
+				if len(sizes) < 3 {
+					result.Controls = []LDAP.Control{&LDAP.ControlPaging{Cookie: []byte("next")}}
+				}
+				return result, nil
+			},
+		}
+		request := &LDAP.SearchRequest{BaseDN: "dc=grafana,dc=org"}
+
+		Convey("Should hand each entry of each page to the handler", func() {
+			handled := 0
+			err := conn.SearchStream(request, 2, func(entry *LDAP.Entry) error {
+				handled++
+				return nil
+			})
+			So(err, ShouldBeNil)
+			So(handled, ShouldEqual, 6)
+			So(sizes, ShouldResemble, []uint32{2, 2, 2})
+			So(request.Controls, ShouldBeEmpty)
+		})
+
+		Convey("Should stop and abandon the search when the handler fails", func() {
+			stop := errors.New("stop")
+			handled := 0
+			err := conn.SearchStream(request, 2, func(entry *LDAP.Entry) error {
+				handled++
+				return stop
+			})
+			So(err, ShouldEqual, stop)
+			So(handled, ShouldEqual, 1)
+			So(sizes, ShouldResemble, []uint32{2, 0})
+		})
+
+		Convey("Should stream each page through the wrapping connections", func() {
+			search := conn.searchProvider
+			conn.searchProvider = func(request *LDAP.SearchRequest) (*LDAP.SearchResult, error) {
+				if len(sizes) == 1 {
+					return nil, LDAP.NewError(LDAP.ErrorNetwork, errors.New("connection reset"))
+				}
+				return search(request)
+			}
+			service := &serviceConnection{IConnection: conn, server: &ServerConfig{}}
+
+			err := service.SearchStream(request, 2, func(entry *LDAP.Entry) error { return nil })
+			So(err, ShouldNotBeNil)
+			So(service.broken, ShouldBeTrue)
+		})
+	})
+}
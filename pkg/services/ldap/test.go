@@ -16,8 +16,11 @@ type mockLdapConn struct {
 	result                      *ldap.SearchResult
 	searchCalled                bool
 	searchAttributes            []string
+	searchTimeLimit             int
 	bindProvider                func(username, password string) error
+	simpleBindProvider          func(request *ldap.SimpleBindRequest) (*ldap.SimpleBindResult, error)
 	unauthenticatedBindProvider func(username string) error
+	searchProvider              func(request *ldap.SearchRequest) (*ldap.SearchResult, error)
 }
 
 func (c *mockLdapConn) Bind(username, password string) error {
@@ -28,6 +31,14 @@ func (c *mockLdapConn) Bind(username, password string) error {
 	return nil
 }
 
+func (c *mockLdapConn) SimpleBind(request *ldap.SimpleBindRequest) (*ldap.SimpleBindResult, error) {
+	if c.simpleBindProvider != nil {
+		return c.simpleBindProvider(request)
+	}
+
+	return &ldap.SimpleBindResult{}, c.Bind(request.Username, request.Password)
+}
+
 func (c *mockLdapConn) UnauthenticatedBind(username string) error {
 	if c.unauthenticatedBindProvider != nil {
 		return c.unauthenticatedBindProvider(username)
@@ -45,9 +56,17 @@ func (c *mockLdapConn) setSearchResult(result *ldap.SearchResult) {
 func (c *mockLdapConn) Search(sr *ldap.SearchRequest) (*ldap.SearchResult, error) {
 	c.searchCalled = true
 	c.searchAttributes = sr.Attributes
+	c.searchTimeLimit = sr.TimeLimit
+	if c.searchProvider != nil {
+		return c.searchProvider(sr)
+	}
 	return c.result, nil
 }
 
+func (c *mockLdapConn) SearchStream(request *ldap.SearchRequest, pagingSize uint32, handle EntryHandler) error {
+	return streamSearch(c, request, pagingSize, handle)
+}
+
 func (c *mockLdapConn) StartTLS(*tls.Config) error {
 	return nil
 }
@@ -64,6 +83,7 @@ func AuthScenario(desc string, fn scenarioFunc) {
 			},
 		}
 
+		defer func(hook func(*Auth) error) { hookDial = hook }(hookDial)
 		hookDial = func(auth *Auth) error {
 			return nil
 		}
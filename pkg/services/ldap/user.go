@@ -2,6 +2,8 @@ package ldap
 
 import (
 	"strings"
+
+	"github.com/grafana/grafana/pkg/models"
 )
 
 type UserInfo struct {
@@ -11,6 +13,41 @@ type UserInfo struct {
 	Username  string
 	Email     string
 	MemberOf  []string
+
+	// Groups are the groups of MemberOf when they're found by the group
+	// search, with their group_attributes
+	Groups []*Group
+
+	// Server is the host of the server the user was found on
+	Server string
+
+	// GUID is the hex encoded value of the guid_attribute of the entry
+	GUID string
+
+	// Attributes are the values of the stored_attributes by name
+	Attributes map[string]string
+
+	// Managers are the logins of the manager chain of the user, nearest first
+	Managers []string
+
+	// ServiceAccount is set if one of the service_account_mappings matches the user
+	ServiceAccount bool
+
+	// PasswordPolicy holds the warnings of the password policy of the directory, if any
+	PasswordPolicy *models.PasswordPolicyWarning
+
+	// restrictions are the login restrictions of the user, read
+	// when the server enforces them
+	restrictions *accountRestrictions
+
+	// secondFactorSeed is the TOTP seed read from second_factor_seed_attribute
+	secondFactorSeed string
+
+	// managerDN is the DN of the manager read from manager_attribute
+	managerDN string
+
+	// serviceAccountRoles are the org roles of the service account mappings of the user
+	serviceAccountRoles map[int64]models.RoleType
 }
 
 func (u *UserInfo) isMemberOf(group string) bool {
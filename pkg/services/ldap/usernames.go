@@ -0,0 +1,237 @@
+package ldap
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/xerrors"
+	LDAP "gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+// The steps of the login_normalization of the login attribute
+const (
+	// NormalizeLowercase lowercases the login
+	NormalizeLowercase = "lowercase"
+
+	// NormalizeTransliterate replaces the accented and the other Latin
+	// letters by their ASCII counterparts, "José" by "Jose"
+	NormalizeTransliterate = "transliterate"
+
+	// NormalizeStripDomain removes the domain of the "user@domain" and
+	// "DOMAIN\user" logins
+	NormalizeStripDomain = "strip_domain"
+)
+
+// The login_collision policies for the entries getting the login of a
+// Grafana user linked to another entry
+const (
+	// LoginCollisionSuffix gives the entry the login with the first free
+	// numeric suffix, "roel2" when "roel" is taken
+	LoginCollisionSuffix = "suffix"
+
+	// LoginCollisionReject refuses the login and the sync of the entry
+	LoginCollisionReject = "reject"
+
+	// LoginCollisionPreferFirst refuses the entry while the one linked to
+	// the Grafana user is still in the directory, it takes its place once
+	// that one is gone
+	LoginCollisionPreferFirst = "prefer_first"
+)
+
+// maxLoginSuffix is the highest suffix tried for a colliding login
+const maxLoginSuffix = 100
+
+// ErrLoginCollision is returned for the LDAP users whose login is the one
+// of the Grafana user of another LDAP entry
+var ErrLoginCollision = errors.New("LDAP login is already used by another LDAP user")
+
+// transliterations are the ASCII counterparts of the letters of the
+// Latin-1 Supplement and Latin Extended-A blocks
+var transliterations = strings.NewReplacer(
+	"À", "A", "Á", "A", "Â", "A", "Ã", "A", "Ä", "A", "Å", "A", "Ç", "C", "È", "E", "É", "E", "Ê", "E", "Ë", "E", "Ì", "I",
+	"Í", "I", "Î", "I", "Ï", "I", "Ñ", "N", "Ò", "O", "Ó", "O", "Ô", "O", "Õ", "O", "Ö", "O", "Ù", "U", "Ú", "U", "Û", "U",
+	"Ü", "U", "Ý", "Y", "à", "a", "á", "a", "â", "a", "ã", "a", "ä", "a", "å", "a", "ç", "c", "è", "e", "é", "e", "ê", "e",
+	"ë", "e", "ì", "i", "í", "i", "î", "i", "ï", "i", "ñ", "n", "ò", "o", "ó", "o", "ô", "o", "õ", "o", "ö", "o", "ù", "u",
+	"ú", "u", "û", "u", "ü", "u", "ý", "y", "ÿ", "y", "Ā", "A", "ā", "a", "Ă", "A", "ă", "a", "Ą", "A", "ą", "a", "Ć", "C",
+	"ć", "c", "Ĉ", "C", "ĉ", "c", "Ċ", "C", "ċ", "c", "Č", "C", "č", "c", "Ď", "D", "ď", "d", "Ē", "E", "ē", "e", "Ĕ", "E",
+	"ĕ", "e", "Ė", "E", "ė", "e", "Ę", "E", "ę", "e", "Ě", "E", "ě", "e", "Ĝ", "G", "ĝ", "g", "Ğ", "G", "ğ", "g", "Ġ", "G",
+	"ġ", "g", "Ģ", "G", "ģ", "g", "Ĥ", "H", "ĥ", "h", "Ĩ", "I", "ĩ", "i", "Ī", "I", "ī", "i", "Ĭ", "I", "ĭ", "i", "Į", "I",
+	"į", "i", "İ", "I", "Ĵ", "J", "ĵ", "j", "Ķ", "K", "ķ", "k", "Ĺ", "L", "ĺ", "l", "Ļ", "L", "ļ", "l", "Ľ", "L", "ľ", "l",
+	"Ń", "N", "ń", "n", "Ņ", "N", "ņ", "n", "Ň", "N", "ň", "n", "Ō", "O", "ō", "o", "Ŏ", "O", "ŏ", "o", "Ő", "O", "ő", "o",
+	"Ŕ", "R", "ŕ", "r", "Ŗ", "R", "ŗ", "r", "Ř", "R", "ř", "r", "Ś", "S", "ś", "s", "Ŝ", "S", "ŝ", "s", "Ş", "S", "ş", "s",
+	"Š", "S", "š", "s", "Ţ", "T", "ţ", "t", "Ť", "T", "ť", "t", "Ũ", "U", "ũ", "u", "Ū", "U", "ū", "u", "Ŭ", "U", "ŭ", "u",
+	"Ů", "U", "ů", "u", "Ű", "U", "ű", "u", "Ų", "U", "ų", "u", "Ŵ", "W", "ŵ", "w", "Ŷ", "Y", "ŷ", "y", "Ÿ", "Y", "Ź", "Z",
+	"ź", "z", "Ż", "Z", "ż", "z", "Ž", "Z", "ž", "z", "ß", "ss", "æ", "ae", "Æ", "AE", "ø", "o", "Ø", "O", "œ", "oe", "Œ", "OE",
+	"đ", "d", "Đ", "D", "ł", "l", "Ł", "L", "þ", "th", "Þ", "TH", "ı", "i",
+)
+
+// validateUsernames checks the login_normalization steps and the
+// login_collision policy
+func validateUsernames(server *ServerConfig) error {
+	for i, step := range server.LoginNormalization {
+		step = strings.ToLower(strings.TrimSpace(step))
+		switch step {
+		case NormalizeLowercase, NormalizeTransliterate, NormalizeStripDomain:
+		default:
+			return xerrors.Errorf("invalid login_normalization %q, it must be lowercase, transliterate or strip_domain", server.LoginNormalization[i])
+		}
+		server.LoginNormalization[i] = step
+	}
+
+	switch server.LoginCollision {
+	case "", LoginCollisionSuffix, LoginCollisionReject, LoginCollisionPreferFirst:
+	default:
+		return xerrors.Errorf("invalid login_collision %q, it must be suffix, reject or prefer_first", server.LoginCollision)
+	}
+	return nil
+}
+
+// normalizeLogin applies the login_normalization steps, in their order,
+// to the value of the login attribute
+func (server *ServerConfig) normalizeLogin(login string) string {
+	for _, step := range server.LoginNormalization {
+		switch step {
+		case NormalizeLowercase:
+			login = strings.ToLower(login)
+		case NormalizeTransliterate:
+			login = transliterations.Replace(login)
+		case NormalizeStripDomain:
+			login = stripDomain(login)
+		}
+	}
+	return login
+}
+
+func stripDomain(login string) string {
+	if at := strings.LastIndex(login, "@"); at > 0 {
+		login = login[:at]
+	}
+	if slash := strings.LastIndex(login, `\`); slash != -1 {
+		login = login[slash+1:]
+	}
+	return login
+}
+
+// resolveLoginCollision applies the login_collision policy when the login
+// of the user is the one of a Grafana user linked to another LDAP entry,
+// which happens when several entries normalize to the same login. The
+// Grafana users not linked to LDAP are left to be matched by their login
+func (auth *Auth) resolveLoginCollision(extUser *models.ExternalUserInfo) error {
+	if auth.server.LoginCollision == "" {
+		return nil
+	}
+
+	owner, err := grafanaUserByLogin(extUser.Login)
+	if err != nil || owner == nil {
+		return err
+	}
+	linkedDN, err := ldapAuthId(owner.Id)
+	if err != nil || linkedDN == "" || strings.EqualFold(linkedDN, extUser.AuthId) {
+		return err
+	}
+
+	auth.log.Info("LDAP login collides with the one of another LDAP user",
+		"login", extUser.Login, "dn", extUser.AuthId, "linkedDn", linkedDN, "policy", auth.server.LoginCollision)
+
+	switch auth.server.LoginCollision {
+	case LoginCollisionPreferFirst:
+		if auth.entryExists(linkedDN) {
+			return ErrLoginCollision
+		}
+		return nil
+	case LoginCollisionSuffix:
+		return auth.suffixLogin(extUser)
+	default:
+		return ErrLoginCollision
+	}
+}
+
+// suffixLogin gives the user the first login with a numeric suffix that
+// is free or already its own
+func (auth *Auth) suffixLogin(extUser *models.ExternalUserInfo) error {
+	for i := 2; i <= maxLoginSuffix; i++ {
+		login := fmt.Sprintf("%s%d", extUser.Login, i)
+		owner, err := grafanaUserByLogin(login)
+		if err != nil {
+			return err
+		}
+		if owner != nil {
+			linkedDN, err := ldapAuthId(owner.Id)
+			if err != nil {
+				return err
+			}
+			if !strings.EqualFold(linkedDN, extUser.AuthId) {
+				continue
+			}
+		}
+
+		auth.log.Debug("Suffixed the colliding LDAP login", "login", extUser.Login, "suffixed", login)
+		extUser.Login = login
+		return nil
+	}
+	return ErrLoginCollision
+}
+
+// entryExists checks if the entry of the DN is still in the directory,
+// it's assumed to be when it can't be searched
+func (auth *Auth) entryExists(dn string) bool {
+	if auth.conn == nil {
+		return true
+	}
+
+	result, err := auth.search(searchEntryCheck, &LDAP.SearchRequest{
+		BaseDN:       dn,
+		Scope:        LDAP.ScopeBaseObject,
+		DerefAliases: LDAP.NeverDerefAliases,
+		Attributes:   []string{"dn"},
+		TimeLimit:    auth.server.SearchTimeout,
+		Filter:       "(objectClass=*)",
+	})
+	if ldapErr, ok := err.(*LDAP.Error); ok && ldapErr.ResultCode == LDAP.LDAPResultNoSuchObject {
+		return false
+	}
+	return err != nil || len(result.Entries) > 0
+}
+
+// grafanaUserByLogin returns the Grafana user of the login, nil if there
+// is none
+func grafanaUserByLogin(login string) (*models.User, error) {
+	query := &models.GetUserByLoginQuery{LoginOrEmail: login}
+	if err := bus.Dispatch(query); err == models.ErrUserNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(query.Result.Login, login) {
+		// matched by its email
+		return nil, nil
+	}
+	return query.Result, nil
+}
+
+// ldapAuthId returns the DN the Grafana user is linked to, empty if it's
+// not an LDAP user
+func ldapAuthId(userId int64) (string, error) {
+	query := &models.GetAuthInfoQuery{UserId: userId, AuthModule: AuthModule}
+	if err := bus.Dispatch(query); err == models.ErrUserNotFound {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	return query.Result.AuthId, nil
+}
+
+// IsLinkedUser checks if the Grafana user is an LDAP user linked to the DN
+// of the LDAP user, the LDAP user found by the login of another Grafana
+// user, like a local one, isn't its own
+func IsLinkedUser(userId int64, user *UserInfo) (bool, error) {
+	linkedDN, err := ldapAuthId(userId)
+	if err != nil {
+		return false, err
+	}
+	return linkedDN != "" && strings.EqualFold(linkedDN, user.DN), nil
+}
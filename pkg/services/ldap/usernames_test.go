@@ -0,0 +1,129 @@
+package ldap
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	LDAP "gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+func TestUsernames(t *testing.T) {
+	Convey("validateUsernames", t, func() {
+		server := &ServerConfig{LoginNormalization: []string{" Lowercase", "strip_domain"}, LoginCollision: LoginCollisionSuffix}
+		So(validateUsernames(server), ShouldBeNil)
+		So(server.LoginNormalization, ShouldResemble, []string{NormalizeLowercase, NormalizeStripDomain})
+
+		So(validateUsernames(&ServerConfig{LoginNormalization: []string{"uppercase"}}), ShouldNotBeNil)
+		So(validateUsernames(&ServerConfig{LoginCollision: "prefer_last"}), ShouldNotBeNil)
+	})
+
+	Convey("normalizeLogin", t, func() {
+		server := &ServerConfig{LoginNormalization: []string{NormalizeStripDomain, NormalizeTransliterate, NormalizeLowercase}}
+		So(server.normalizeLogin("José.Müller@Grafana.org"), ShouldEqual, "jose.muller")
+		So(server.normalizeLogin(`GRAFANA\Straße`), ShouldEqual, "strasse")
+		So(server.normalizeLogin("@roel"), ShouldEqual, "@roel")
+		So((&ServerConfig{}).normalizeLogin("Roel@Grafana.org"), ShouldEqual, "Roel@Grafana.org")
+	})
+
+	Convey("Login collisions", t, func() {
+		defer bus.ClearBusHandlers()
+
+		// the Grafana users by login and the DNs they're linked to by id
+		logins := map[string]int64{"roel": 1, "torkel": 2}
+		dns := map[int64]string{1: "cn=roel,ou=a,dc=grafana,dc=org"}
+		bus.AddHandler("test", func(query *models.GetUserByLoginQuery) error {
+			id, ok := logins[query.LoginOrEmail]
+			if !ok {
+				return models.ErrUserNotFound
+			}
+			query.Result = &models.User{Id: id, Login: query.LoginOrEmail}
+			return nil
+		})
+		bus.AddHandler("test", func(query *models.GetAuthInfoQuery) error {
+			dn, ok := dns[query.UserId]
+			if !ok {
+				return models.ErrUserNotFound
+			}
+			query.Result = &models.UserAuth{UserId: query.UserId, AuthModule: "ldap", AuthId: dn}
+			return nil
+		})
+
+		conn := &mockLdapConn{}
+		auth := &Auth{log: log.New("test-logger"), conn: conn, server: &ServerConfig{
+			LoginNormalization: []string{NormalizeStripDomain},
+		}}
+		newcomer := func() *models.ExternalUserInfo {
+			return auth.buildGrafanaUser(&UserInfo{DN: "cn=roel,ou=b,dc=grafana,dc=org", Username: "roel@b.grafana.org"})
+		}
+
+		Convey("Should give the login of the Grafana user without login_collision", func() {
+			extUser := newcomer()
+			So(auth.resolveLoginCollision(extUser), ShouldBeNil)
+			So(extUser.Login, ShouldEqual, "roel")
+		})
+
+		Convey("Should leave the user linked to the same DN and the ones not linked to LDAP", func() {
+			auth.server.LoginCollision = LoginCollisionReject
+			So(auth.resolveLoginCollision(&models.ExternalUserInfo{Login: "roel", AuthId: "CN=roel,OU=a,DC=grafana,DC=org"}), ShouldBeNil)
+			So(auth.resolveLoginCollision(&models.ExternalUserInfo{Login: "torkel", AuthId: "cn=torkel,dc=grafana,dc=org"}), ShouldBeNil)
+			So(auth.resolveLoginCollision(&models.ExternalUserInfo{Login: "tod", AuthId: "cn=tod,dc=grafana,dc=org"}), ShouldBeNil)
+		})
+
+		Convey("Should refuse the colliding user with reject", func() {
+			auth.server.LoginCollision = LoginCollisionReject
+			So(auth.resolveLoginCollision(newcomer()), ShouldEqual, ErrLoginCollision)
+
+			_, err := auth.MapGrafanaUser(&UserInfo{DN: "cn=roel,ou=b,dc=grafana,dc=org", Username: "roel@b.grafana.org"})
+			So(err, ShouldEqual, ErrLoginCollision)
+		})
+
+		Convey("Should suffix the colliding login with suffix", func() {
+			auth.server.LoginCollision = LoginCollisionSuffix
+			logins["roel2"] = 3
+			dns[3] = "cn=roel,ou=c,dc=grafana,dc=org"
+
+			extUser := newcomer()
+			So(auth.resolveLoginCollision(extUser), ShouldBeNil)
+			So(extUser.Login, ShouldEqual, "roel3")
+
+			// the user keeps its suffixed login
+			logins["roel3"] = 4
+			dns[4] = "cn=roel,ou=b,dc=grafana,dc=org"
+			extUser = newcomer()
+			So(auth.resolveLoginCollision(extUser), ShouldBeNil)
+			So(extUser.Login, ShouldEqual, "roel3")
+		})
+
+		Convey("Should refuse the colliding user while the first one exists with prefer_first", func() {
+			auth.server.LoginCollision = LoginCollisionPreferFirst
+
+			conn.setSearchResult(&LDAP.SearchResult{Entries: []*LDAP.Entry{LDAP.NewEntry(dns[1], nil)}})
+			So(auth.resolveLoginCollision(newcomer()), ShouldEqual, ErrLoginCollision)
+
+			conn.searchProvider = func(request *LDAP.SearchRequest) (*LDAP.SearchResult, error) {
+				So(request.BaseDN, ShouldEqual, dns[1])
+				return nil, &LDAP.Error{ResultCode: LDAP.LDAPResultNoSuchObject, Err: errors.New("no such object")}
+			}
+			So(auth.resolveLoginCollision(newcomer()), ShouldBeNil)
+		})
+
+		Convey("Should only link the Grafana users to the DN of their LDAP user", func() {
+			linked, err := IsLinkedUser(1, &UserInfo{DN: "CN=roel,ou=a,dc=grafana,dc=org"})
+			So(err, ShouldBeNil)
+			So(linked, ShouldBeTrue)
+
+			linked, err = IsLinkedUser(1, &UserInfo{DN: "cn=roel,ou=b,dc=grafana,dc=org"})
+			So(err, ShouldBeNil)
+			So(linked, ShouldBeFalse)
+
+			linked, err = IsLinkedUser(2, &UserInfo{DN: "cn=torkel,ou=a,dc=grafana,dc=org"})
+			So(err, ShouldBeNil)
+			So(linked, ShouldBeFalse)
+		})
+	})
+}
@@ -0,0 +1,30 @@
+package ldap
+
+import (
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// reactivateUser removes the state of the Grafana user logging in, it
+// was pending disable or disabled while the user was missing from LDAP
+func (auth *Auth) reactivateUser(user *models.User) {
+	if !setting.LdapDisableMissingUsers {
+		return
+	}
+
+	query := &models.GetLdapUserStateQuery{UserId: user.Id}
+	if err := bus.Dispatch(query); err != nil {
+		if err != models.ErrLdapUserStateNotFound {
+			auth.log.Warn("Failed to read the LDAP state of the user", "login", user.Login, "error", err)
+		}
+		return
+	}
+
+	if err := bus.Dispatch(&models.DeleteLdapUserStateCommand{UserId: user.Id}); err != nil {
+		auth.log.Warn("Failed to reactivate the user found in LDAP again", "login", user.Login, "error", err)
+		return
+	}
+
+	auth.log.Info("Reactivating the user found in LDAP again", "login", user.Login, "state", query.Result.State)
+}
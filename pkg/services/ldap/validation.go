@@ -0,0 +1,62 @@
+package ldap
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/grafana/grafana/pkg/infra/metrics"
+	models "github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// validateLogin rejects the login inputs which can't be valid
+// credentials before any directory traffic is created for them
+func (auth *Auth) validateLogin(query *models.LoginUserQuery) error {
+	reason := invalidLoginReason(query.Username, query.Password)
+	if reason == "" {
+		return nil
+	}
+
+	auth.log.Debug("Rejected LDAP login before binding", "username", query.Username, "reason", reason)
+	metrics.M_Ldap_Rejected_Logins.WithLabelValues(reason).Inc()
+
+	return ErrInvalidCredentials
+}
+
+// invalidLoginReason returns why the username and password
+// are not valid login inputs, or an empty string if they are
+func invalidLoginReason(username, password string) string {
+	if username == "" {
+		return "empty"
+	}
+
+	// Binding with an empty password is an unauthenticated bind,
+	// which some directories report as successful
+	if password == "" && setting.LdapRejectEmptyPasswords {
+		return "empty"
+	}
+
+	if strings.TrimSpace(username) == "" || (password != "" && strings.TrimSpace(password) == "") {
+		return "whitespace"
+	}
+
+	if utf8.RuneCountInString(password) < setting.LdapMinPasswordLength {
+		return "too_short"
+	}
+
+	max := setting.LdapMaxLoginInputLength
+	if max > 0 && (utf8.RuneCountInString(username) > max || utf8.RuneCountInString(password) > max) {
+		return "too_long"
+	}
+
+	if hasControlCharacters(username) || hasControlCharacters(password) {
+		return "control_characters"
+	}
+
+	return ""
+}
+
+func hasControlCharacters(value string) bool {
+	return strings.IndexFunc(value, unicode.IsControl) >= 0
+}
@@ -0,0 +1,56 @@
+package ldap
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+func TestInvalidLoginReason(t *testing.T) {
+	Convey("invalidLoginReason", t, func() {
+		setting.LdapRejectEmptyPasswords = true
+		setting.LdapMinPasswordLength = 4
+		setting.LdapMaxLoginInputLength = 16
+		defer func() {
+			setting.LdapRejectEmptyPasswords = false
+			setting.LdapMinPasswordLength = 0
+			setting.LdapMaxLoginInputLength = 0
+		}()
+
+		Convey("Should accept valid inputs", func() {
+			So(invalidLoginReason("roel", "secret password"), ShouldBeEmpty)
+			So(invalidLoginReason("rüdiger", "pässwört"), ShouldBeEmpty)
+		})
+
+		Convey("Should reject empty inputs", func() {
+			So(invalidLoginReason("", "secret"), ShouldEqual, "empty")
+			So(invalidLoginReason("roel", ""), ShouldEqual, "empty")
+		})
+
+		Convey("Should accept empty passwords if allowed", func() {
+			setting.LdapRejectEmptyPasswords = false
+			setting.LdapMinPasswordLength = 0
+
+			So(invalidLoginReason("roel", ""), ShouldBeEmpty)
+		})
+
+		Convey("Should reject whitespace only inputs", func() {
+			So(invalidLoginReason("  ", "secret"), ShouldEqual, "whitespace")
+			So(invalidLoginReason("roel", " \t  "), ShouldEqual, "whitespace")
+		})
+
+		Convey("Should reject inputs of the wrong length", func() {
+			So(invalidLoginReason("roel", "abc"), ShouldEqual, "too_short")
+			So(invalidLoginReason(strings.Repeat("r", 17), "secret"), ShouldEqual, "too_long")
+			So(invalidLoginReason("roel", strings.Repeat("s", 17)), ShouldEqual, "too_long")
+		})
+
+		Convey("Should reject control characters", func() {
+			So(invalidLoginReason("roel\x00", "secret"), ShouldEqual, "control_characters")
+			So(invalidLoginReason("roel", "sec\nret"), ShouldEqual, "control_characters")
+		})
+	})
+}
@@ -0,0 +1,83 @@
+package ldap
+
+import (
+	"fmt"
+
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+const (
+	// WarmUpOff skips the connection check at startup
+	WarmUpOff = "off"
+
+	// WarmUpWarn logs the servers which can't be reached at startup
+	WarmUpWarn = "warn"
+
+	// WarmUpFail stops the startup if any server can't be reached
+	WarmUpFail = "fail"
+)
+
+// checkServer is a variable so tests can replace it
+var checkServer = func(server *ServerConfig) error {
+	auth := New(server).(*Auth)
+	return auth.WarmUp()
+}
+
+// WarmUp connects to the server and binds with the configured service
+// account, so broken settings show up before the first user login.
+// Servers binding as the user (auth_strategy = "direct-bind") are only dialed
+func (auth *Auth) WarmUp() error {
+	if err := auth.Dial(); err != nil {
+		return auth.sanitizeError(err)
+	}
+	defer auth.Close()
+
+	if auth.server.authStrategy() == AuthStrategyDirectBind {
+		return nil
+	}
+
+	return auth.sanitizeError(auth.initialBind("", ""))
+}
+
+// warmUp checks all of the active servers according to the warm_up setting
+func (service *LDAPService) warmUp() error {
+	mode := setting.LdapWarmUp
+	if mode == "" || mode == WarmUpOff {
+		return nil
+	}
+
+	config, err := GetConfig()
+	if err == nil && config == nil {
+		return nil
+	}
+	if err != nil {
+		return service.warmUpFailed(mode, fmt.Errorf("Failed to read LDAP config: %v", err))
+	}
+
+	for _, server := range config.Servers {
+		if !IsActive(server) {
+			continue
+		}
+
+		if err := checkServer(server); err != nil {
+			err = fmt.Errorf("Failed to connect to LDAP server %s: %v", ServerKey(server), err)
+			if err := service.warmUpFailed(mode, err); err != nil {
+				return err
+			}
+			continue
+		}
+
+		service.log.Info("LDAP server is reachable", "server", ServerKey(server))
+	}
+
+	return nil
+}
+
+func (service *LDAPService) warmUpFailed(mode string, err error) error {
+	if mode == WarmUpFail {
+		return err
+	}
+
+	service.log.Warn("LDAP warm-up failed", "error", err)
+	return nil
+}
@@ -0,0 +1,118 @@
+package ldap
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+func TestWarmUp(t *testing.T) {
+	Convey("WarmUp", t, func() {
+		Convey("Should bind with the service account", func() {
+			conn := &mockLdapConn{}
+			var actualUsername, actualPassword string
+			conn.bindProvider = func(username, password string) error {
+				actualUsername = username
+				actualPassword = password
+				return nil
+			}
+			defer keepDial()()
+			hookDial = func(auth *Auth) error {
+				auth.conn = conn
+				return nil
+			}
+
+			auth := &Auth{
+				server: &ServerConfig{
+					BindDN:       "cn=admin,dc=grafana,dc=org",
+					BindPassword: "bindpwd",
+				},
+				log: log.New("test-logger"),
+			}
+
+			So(auth.WarmUp(), ShouldBeNil)
+			So(actualUsername, ShouldEqual, "cn=admin,dc=grafana,dc=org")
+			So(actualPassword, ShouldEqual, "bindpwd")
+		})
+
+		Convey("Should only dial when binding as the user", func() {
+			conn := &mockLdapConn{}
+			bindCalled := false
+			conn.bindProvider = func(username, password string) error {
+				bindCalled = true
+				return nil
+			}
+			dialCalled := false
+			defer keepDial()()
+			hookDial = func(auth *Auth) error {
+				dialCalled = true
+				auth.conn = conn
+				return nil
+			}
+
+			auth := &Auth{
+				server: &ServerConfig{
+					BindDN:       "cn=%s,dc=grafana,dc=org",
+					AuthStrategy: AuthStrategyDirectBind,
+				},
+				log: log.New("test-logger"),
+			}
+
+			So(auth.WarmUp(), ShouldBeNil)
+			So(dialCalled, ShouldBeTrue)
+			So(bindCalled, ShouldBeFalse)
+		})
+	})
+
+	Convey("LDAPService warm-up", t, func() {
+		setting.LdapEnabled = true
+		config = &Config{
+			Servers: []*ServerConfig{{Host: "first"}, {Host: "second"}},
+		}
+		var warmedUp []string
+		originalCheckServer := checkServer
+		checkServer = func(server *ServerConfig) error {
+			warmedUp = append(warmedUp, server.Host)
+			if server.Host == "first" {
+				return errors.New("connection refused")
+			}
+			return nil
+		}
+		defer func() {
+			setting.LdapEnabled = false
+			setting.LdapWarmUp = ""
+			config = nil
+			checkServer = originalCheckServer
+		}()
+
+		service := &LDAPService{log: log.New("test-logger")}
+
+		Convey("Should skip the servers when it's off", func() {
+			setting.LdapWarmUp = WarmUpOff
+
+			So(service.warmUp(), ShouldBeNil)
+			So(warmedUp, ShouldBeEmpty)
+		})
+
+		Convey("Should check all servers when it warns", func() {
+			setting.LdapWarmUp = WarmUpWarn
+
+			So(service.warmUp(), ShouldBeNil)
+			So(warmedUp, ShouldResemble, []string{"first", "second"})
+		})
+
+		Convey("Should stop at the first failure when it fails", func() {
+			setting.LdapWarmUp = WarmUpFail
+
+			err := service.warmUp()
+
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "first:0")
+			So(warmedUp, ShouldResemble, []string{"first"})
+		})
+	})
+}
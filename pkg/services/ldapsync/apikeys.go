@@ -0,0 +1,29 @@
+package ldapsync
+
+import (
+	"fmt"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+)
+
+// revokeApiKeys deletes the API keys created by the user once it's no
+// longer a member of the api_key_groups, it returns the change for the
+// report, empty if no key was deleted
+func (service *SyncService) revokeApiKeys(userId int64, user *ldap.UserInfo) (string, error) {
+	if !ldap.IsApiKeyGatingEnabled() || ldap.MayHoldApiKeys(user) {
+		return "", nil
+	}
+
+	cmd := &models.DeleteUserApiKeysCommand{UserId: userId}
+	if err := service.Bus.Dispatch(cmd); err != nil {
+		return "", err
+	}
+	if cmd.DeletedRows == 0 {
+		return "", nil
+	}
+
+	service.log.Info("Revoked the API keys of the user who left the LDAP API key groups",
+		"login", user.Username, "dn", user.DN, "keys", cmd.DeletedRows)
+	return fmt.Sprintf("%d API keys revoked", cmd.DeletedRows), nil
+}
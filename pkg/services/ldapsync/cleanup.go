@@ -0,0 +1,154 @@
+package ldapsync
+
+import (
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+var now = time.Now
+
+// cleanUp moves the Grafana users of LDAP missing from the users of the
+// directory to pending disable, then disables them once the grace period
+// is over and deletes them after delete_disabled_users_after_days. The
+// users found again are reactivated. The users under the base DNs of
+// partial, whose searches timed out, are left as they are since they
+// may still be in LDAP. Each change is added to the report of the job
+func (service *SyncService) cleanUp(job *models.LdapSyncJob, users []*ldap.UserInfo, partial *ldap.PartialUsersError) error {
+	// an empty directory is more likely a broken config than everyone leaving
+	if len(users) == 0 {
+		service.log.Warn("Not disabling the missing LDAP users, no user was found in LDAP")
+		return nil
+	}
+
+	found := make(map[string]*ldap.UserInfo, len(users))
+	for _, user := range users {
+		found[strings.ToLower(user.DN)] = user
+	}
+
+	authQuery := &models.GetAuthInfoListQuery{AuthModule: ldap.AuthModule}
+	if err := service.Bus.Dispatch(authQuery); err != nil {
+		return err
+	}
+
+	statesQuery := &models.GetLdapUserStatesQuery{}
+	if err := service.Bus.Dispatch(statesQuery); err != nil {
+		return err
+	}
+	states := make(map[int64]*models.LdapUserState, len(statesQuery.Result))
+	for _, state := range statesQuery.Result {
+		states[state.UserId] = state
+	}
+
+	// a user is missing if none of its DNs is found
+	var userIds []int64
+	dns := map[int64]string{}
+	present := map[int64]*ldap.UserInfo{}
+	for _, auth := range authQuery.Result {
+		if _, ok := dns[auth.UserId]; !ok {
+			userIds = append(userIds, auth.UserId)
+		}
+		dns[auth.UserId] = auth.AuthId
+		if user, ok := found[strings.ToLower(auth.AuthId)]; ok {
+			present[auth.UserId] = user
+		}
+	}
+
+	var entries []*models.LdapSyncReportEntry
+	defer func() {
+		service.mutex.Lock()
+		for _, entry := range entries {
+			service.record(job, entry)
+		}
+		service.mutex.Unlock()
+	}()
+
+	for _, userId := range userIds {
+		state, hasState := states[userId]
+		if user, ok := present[userId]; ok {
+			if hasState {
+				if err := service.reactivate(userId, user); err != nil {
+					return err
+				}
+				entries = append(entries, &models.LdapSyncReportEntry{Dn: user.DN, Login: user.Username,
+					Action: models.LdapSyncReactivated, Detail: "found in LDAP again, was " + state.State})
+			}
+			continue
+		}
+
+		if partial != nil && partial.Covers(dns[userId]) {
+			service.log.Info("Not disabling the user missing from LDAP, the search of its base DN timed out", "dn", dns[userId])
+			continue
+		}
+
+		entry, err := service.disable(userId, dns[userId], state)
+		if err != nil {
+			return err
+		}
+		if entry != nil {
+			entries = append(entries, entry)
+		}
+	}
+
+	return nil
+}
+
+// reactivate removes the state of the user found in LDAP again
+func (service *SyncService) reactivate(userId int64, user *ldap.UserInfo) error {
+	if err := service.Bus.Dispatch(&models.DeleteLdapUserStateCommand{UserId: userId}); err != nil {
+		return err
+	}
+	service.log.Info("Reactivating the user found in LDAP again", "login", user.Username, "dn", user.DN)
+	return nil
+}
+
+// disable moves the user missing from LDAP to its next state, if it's
+// due, and returns the entry of the report of the change
+func (service *SyncService) disable(userId int64, dn string, state *models.LdapUserState) (*models.LdapSyncReportEntry, error) {
+	query := &models.GetUserByIdQuery{Id: userId}
+	if err := service.Bus.Dispatch(query); err != nil {
+		if err == models.ErrUserNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	login := query.Result.Login
+	entry := &models.LdapSyncReportEntry{Dn: dn, Login: login}
+
+	if ldap.IsProtectedUser(&ldap.UserInfo{DN: dn, Username: login}) {
+		service.log.Info("Not disabling the protected user missing from LDAP", "login", login, "dn", dn)
+		return nil, nil
+	}
+
+	switch {
+	case state == nil:
+		disableAt := now().Add(setting.LdapDisableGracePeriod)
+		service.log.Info("User missing from LDAP, pending disable", "login", login, "dn", dn, "disableAt", disableAt)
+		entry.Action, entry.Detail = models.LdapUserPendingDisable, "missing from LDAP, disabled after "+disableAt.Format(time.RFC3339)
+		return entry, service.Bus.Dispatch(&models.SetLdapUserStateCommand{UserId: userId, State: models.LdapUserPendingDisable})
+
+	case state.State == models.LdapUserPendingDisable && now().Sub(state.Missing) >= setting.LdapDisableGracePeriod:
+		service.log.Info("Disabling the user missing from LDAP", "login", login, "dn", dn, "missing", state.Missing)
+		if err := service.Bus.Dispatch(&models.SetLdapUserStateCommand{UserId: userId, State: models.LdapUserDisabled}); err != nil {
+			return nil, err
+		}
+		entry.Action, entry.Detail = models.LdapUserDisabled, "missing from LDAP since "+state.Missing.Format(time.RFC3339)
+		if ldap.IsApiKeyGatingEnabled() {
+			if err := service.Bus.Dispatch(&models.DeleteUserApiKeysCommand{UserId: userId}); err != nil {
+				return nil, err
+			}
+		}
+		return entry, service.Bus.Dispatch(&models.RevokeAllUserTokensCommand{UserId: userId})
+
+	case state.State == models.LdapUserDisabled && setting.LdapDeleteDisabledAfterDays > 0 &&
+		now().Sub(state.Updated) >= time.Duration(setting.LdapDeleteDisabledAfterDays)*24*time.Hour:
+		service.log.Info("Deleting the user disabled since it's missing from LDAP", "login", login, "dn", dn, "disabled", state.Updated)
+		entry.Action, entry.Detail = models.LdapSyncDeleted, "disabled since "+state.Updated.Format(time.RFC3339)
+		return entry, service.Bus.Dispatch(&models.DeleteUserCommand{UserId: userId})
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,141 @@
+package ldapsync
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+func TestCleanUp(t *testing.T) {
+	Convey("Clean up of the users missing from LDAP", t, func() {
+		defer func(grace time.Duration, days int) {
+			setting.LdapDisableGracePeriod, setting.LdapDeleteDisabledAfterDays = grace, days
+			now = time.Now
+		}(setting.LdapDisableGracePeriod, setting.LdapDeleteDisabledAfterDays)
+		setting.LdapDisableGracePeriod = 72 * time.Hour
+		setting.LdapDeleteDisabledAfterDays = 30
+
+		current := time.Date(2019, 7, 1, 0, 0, 0, 0, time.UTC)
+		now = func() time.Time { return current }
+
+		auths := []*models.UserAuth{
+			{UserId: 1, AuthId: "uid=tod,ou=users,dc=grafana,dc=org"},
+			{UserId: 2, AuthId: "uid=gone,ou=users,dc=grafana,dc=org"},
+		}
+		states := map[int64]*models.LdapUserState{}
+		var revoked, deleted []int64
+
+		dispatcher := bus.New()
+		dispatcher.AddHandler(func(query *models.GetAuthInfoListQuery) error {
+			query.Result = auths
+			return nil
+		})
+		dispatcher.AddHandler(func(query *models.GetLdapUserStatesQuery) error {
+			for _, state := range states {
+				copied := *state
+				query.Result = append(query.Result, &copied)
+			}
+			return nil
+		})
+		dispatcher.AddHandler(func(cmd *models.SetLdapUserStateCommand) error {
+			if state, ok := states[cmd.UserId]; ok {
+				state.State, state.Updated = cmd.State, current
+				return nil
+			}
+			states[cmd.UserId] = &models.LdapUserState{UserId: cmd.UserId, State: cmd.State, Missing: current, Updated: current}
+			return nil
+		})
+		dispatcher.AddHandler(func(cmd *models.DeleteLdapUserStateCommand) error {
+			delete(states, cmd.UserId)
+			return nil
+		})
+		dispatcher.AddHandler(func(query *models.GetUserByIdQuery) error {
+			query.Result = &models.User{Id: query.Id, Login: "gone"}
+			return nil
+		})
+		dispatcher.AddHandler(func(cmd *models.RevokeAllUserTokensCommand) error {
+			revoked = append(revoked, cmd.UserId)
+			return nil
+		})
+		dispatcher.AddHandler(func(cmd *models.DeleteUserCommand) error {
+			deleted = append(deleted, cmd.UserId)
+			delete(states, cmd.UserId)
+			return nil
+		})
+
+		service := &SyncService{Bus: dispatcher, log: log.New("test-logger")}
+		job := &models.LdapSyncJob{Id: 1}
+		tod := &ldap.UserInfo{DN: "uid=Tod,ou=users,dc=grafana,dc=org", Username: "tod"}
+		gone := &ldap.UserInfo{DN: "uid=gone,ou=users,dc=grafana,dc=org", Username: "gone"}
+
+		Convey("Should disable the missing user after the grace period, then delete it", func() {
+			So(service.cleanUp(job, []*ldap.UserInfo{tod}, nil), ShouldBeNil)
+			So(states, ShouldHaveLength, 1)
+			So(states[2].State, ShouldEqual, models.LdapUserPendingDisable)
+
+			current = current.Add(time.Hour)
+			So(service.cleanUp(job, []*ldap.UserInfo{tod}, nil), ShouldBeNil)
+			So(states[2].State, ShouldEqual, models.LdapUserPendingDisable)
+
+			current = current.Add(72 * time.Hour)
+			So(service.cleanUp(job, []*ldap.UserInfo{tod}, nil), ShouldBeNil)
+			So(states[2].State, ShouldEqual, models.LdapUserDisabled)
+			So(revoked, ShouldResemble, []int64{2})
+
+			current = current.Add(29 * 24 * time.Hour)
+			So(service.cleanUp(job, []*ldap.UserInfo{tod}, nil), ShouldBeNil)
+			So(deleted, ShouldBeEmpty)
+
+			current = current.Add(24 * time.Hour)
+			So(service.cleanUp(job, []*ldap.UserInfo{tod}, nil), ShouldBeNil)
+			So(deleted, ShouldResemble, []int64{2})
+			So(states, ShouldBeEmpty)
+
+			var actions []string
+			for _, entry := range service.report {
+				So(entry.JobId, ShouldEqual, 1)
+				So(entry.Login, ShouldEqual, "gone")
+				actions = append(actions, entry.Action)
+			}
+			So(actions, ShouldResemble, []string{models.LdapUserPendingDisable, models.LdapUserDisabled, models.LdapSyncDeleted})
+		})
+
+		Convey("Should reactivate the user found again", func() {
+			So(service.cleanUp(job, []*ldap.UserInfo{tod}, nil), ShouldBeNil)
+			current = current.Add(73 * time.Hour)
+			So(service.cleanUp(job, []*ldap.UserInfo{tod}, nil), ShouldBeNil)
+			So(states[2].State, ShouldEqual, models.LdapUserDisabled)
+
+			So(service.cleanUp(job, []*ldap.UserInfo{tod, gone}, nil), ShouldBeNil)
+			So(states, ShouldBeEmpty)
+			So(service.report[len(service.report)-1].Action, ShouldEqual, models.LdapSyncReactivated)
+		})
+
+		Convey("Should not disable the protected users", func() {
+			defer func(users []string) { setting.LdapSyncProtectedUsers = users }(setting.LdapSyncProtectedUsers)
+			setting.LdapSyncProtectedUsers = []string{"gone"}
+
+			So(service.cleanUp(job, []*ldap.UserInfo{tod}, nil), ShouldBeNil)
+			So(states, ShouldBeEmpty)
+		})
+
+		Convey("Should not disable the users under the base DNs whose search timed out", func() {
+			partial := &ldap.PartialUsersError{Errors: []*ldap.BaseDNError{{BaseDN: "OU=users,dc=grafana,dc=org", Err: ldap.ErrTimeout}}}
+
+			So(service.cleanUp(job, []*ldap.UserInfo{tod}, partial), ShouldBeNil)
+			So(states, ShouldBeEmpty)
+		})
+
+		Convey("Should not disable anyone when no user is found in LDAP", func() {
+			So(service.cleanUp(job, nil, nil), ShouldBeNil)
+			So(states, ShouldBeEmpty)
+		})
+	})
+}
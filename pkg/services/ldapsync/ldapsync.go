@@ -0,0 +1,517 @@
+package ldapsync
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/registry"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/services/login"
+	"github.com/grafana/grafana/pkg/services/multildap"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+var (
+	// ErrSyncRunning is returned when starting or resuming a sync while one runs
+	ErrSyncRunning = errors.New("LDAP sync is already running")
+
+	// ErrSyncNotRunning is returned when pausing while no sync runs
+	ErrSyncNotRunning = errors.New("LDAP sync is not running")
+
+	// ErrSyncPaused is returned when starting a sync while one is paused,
+	// it has to be resumed or cancelled first
+	ErrSyncPaused = errors.New("LDAP sync is paused, resume or cancel it first")
+
+	// ErrSyncNotPaused is returned when resuming while no sync is paused
+	ErrSyncNotPaused = errors.New("LDAP sync is not paused")
+)
+
+// defaultBatchSize is the batch size with an invalid sync_batch_size
+const defaultBatchSize = 500
+
+func init() {
+	registry.RegisterService(&SyncService{})
+}
+
+// SyncService syncs the Grafana users of the LDAP servers with the
+// directory, on the sync_cron schedule with active_sync_enabled or on
+// demand through the admin API. A run can be paused, resumed and
+// cancelled, and one interrupted by a restart resumes on the next start
+type SyncService struct {
+	Bus bus.Bus `inject:""`
+
+	log          log.Logger
+	getConfig    func() (*ldap.Config, error)
+	newMultiLDAP func(configs []*ldap.ServerConfig) multildap.IMultiLDAP
+	newLDAP      func(server *ldap.ServerConfig) ldap.IAuth
+
+	mutex sync.Mutex
+	ctx   context.Context
+
+	// retryMutex serializes the syncs of the users queued for retry
+	retryMutex sync.Mutex
+
+	// job is the running job, nil if none runs
+	job  *models.LdapSyncJob
+	stop context.CancelFunc
+	done chan struct{}
+
+	// report holds the report entries of the job saved with its checkpoint
+	report []*models.LdapSyncReportEntry
+
+	// stopState is the state the job takes once stopped,
+	// a job stopped by a shutdown stays running to be resumed
+	stopState string
+}
+
+// Init initializes the service
+func (service *SyncService) Init() error {
+	service.log = log.New("ldap.sync")
+	service.getConfig = ldap.GetConfig
+	service.newMultiLDAP = multildap.New
+	service.newLDAP = ldap.New
+	service.ctx = context.Background()
+	return nil
+}
+
+// IsDisabled checks if LDAP is disabled
+func (service *SyncService) IsDisabled() bool {
+	return !ldap.IsEnabled()
+}
+
+// Run resumes the job interrupted by the last shutdown, then starts
+// the jobs of the sync_cron schedule and syncs the users queued for
+// retry until ctx is done
+func (service *SyncService) Run(ctx context.Context) error {
+	service.mutex.Lock()
+	service.ctx = ctx
+	service.mutex.Unlock()
+
+	defer service.wait()
+	go service.runRetries(ctx)
+
+	if last, err := service.lastJob(); err == nil && last.State == models.LdapSyncRunning {
+		service.log.Info("Resuming the interrupted LDAP sync", "id", last.Id, "checkpoint", last.Checkpoint)
+		service.resume(last)
+	}
+
+	if !setting.LdapActiveSyncEnabled {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	schedule, err := cron.ParseStandard(setting.LdapSyncCron)
+	if err != nil {
+		service.log.Error("Invalid LDAP sync_cron, the sync only runs on demand", "sync_cron", setting.LdapSyncCron, "error", err)
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	for {
+		timer := time.NewTimer(time.Until(schedule.Next(time.Now())))
+		select {
+		case <-timer.C:
+			if _, err := service.Start(0); err != nil {
+				service.log.Info("Skipping the scheduled LDAP sync", "reason", err)
+			}
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// Status returns the running job, or the last one
+func (service *SyncService) Status() (*models.LdapSyncJob, error) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	if service.job != nil {
+		job := *service.job
+		return &job, nil
+	}
+
+	return service.lastJob()
+}
+
+// Start starts a new job on behalf of the user, 0 for the schedule
+func (service *SyncService) Start(userId int64) (*models.LdapSyncJob, error) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	if service.job != nil {
+		return nil, ErrSyncRunning
+	}
+
+	last, err := service.lastJob()
+	if err != nil && err != models.ErrLdapSyncJobNotFound {
+		return nil, err
+	}
+	if err == nil && last.State == models.LdapSyncPaused {
+		return nil, ErrSyncPaused
+	}
+
+	job := &models.LdapSyncJob{State: models.LdapSyncRunning, Started: time.Now(), StartedBy: userId}
+	if err := service.save(job); err != nil {
+		return nil, err
+	}
+
+	service.log.Info("Starting the LDAP sync", "id", job.Id, "startedBy", userId)
+	service.run(job)
+
+	copied := *job
+	return &copied, nil
+}
+
+// Pause stops the running job, it can be resumed after its checkpoint
+func (service *SyncService) Pause() error {
+	return service.stopJob(models.LdapSyncPaused)
+}
+
+// Resume resumes the paused job after its checkpoint
+func (service *SyncService) Resume() (*models.LdapSyncJob, error) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	if service.job != nil {
+		return nil, ErrSyncRunning
+	}
+
+	last, err := service.lastJob()
+	if err == models.ErrLdapSyncJobNotFound || (err == nil && last.State != models.LdapSyncPaused) {
+		return nil, ErrSyncNotPaused
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	service.log.Info("Resuming the LDAP sync", "id", last.Id, "checkpoint", last.Checkpoint)
+	last.State = models.LdapSyncRunning
+	if err := service.save(last); err != nil {
+		return nil, err
+	}
+	service.run(last)
+
+	copied := *last
+	return &copied, nil
+}
+
+// Cancel stops the running or paused job for good
+func (service *SyncService) Cancel() error {
+	err := service.stopJob(models.LdapSyncCancelled)
+	if err != ErrSyncNotRunning {
+		return err
+	}
+
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	last, err := service.lastJob()
+	if err == models.ErrLdapSyncJobNotFound || (err == nil && last.State != models.LdapSyncPaused) {
+		return ErrSyncNotRunning
+	}
+	if err != nil {
+		return err
+	}
+
+	last.State = models.LdapSyncCancelled
+	return service.save(last)
+}
+
+// resume runs the job interrupted by a shutdown
+func (service *SyncService) resume(job *models.LdapSyncJob) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	if service.job == nil {
+		service.run(job)
+	}
+}
+
+// stopJob stops the running job, which then takes the state, and waits for it
+func (service *SyncService) stopJob(state string) error {
+	service.mutex.Lock()
+	if service.job == nil {
+		service.mutex.Unlock()
+		return ErrSyncNotRunning
+	}
+	service.stopState = state
+	service.stop()
+	done := service.done
+	service.mutex.Unlock()
+
+	<-done
+	return nil
+}
+
+// wait waits for the running job, if any
+func (service *SyncService) wait() {
+	service.mutex.Lock()
+	done := service.done
+	service.mutex.Unlock()
+
+	if done != nil {
+		<-done
+	}
+}
+
+// run runs the job in the background, the mutex must be held
+func (service *SyncService) run(job *models.LdapSyncJob) {
+	ctx, stop := context.WithCancel(service.ctx)
+	done := make(chan struct{})
+	service.job, service.stop, service.done = job, stop, done
+	service.stopState = models.LdapSyncRunning
+
+	go func() {
+		defer close(done)
+		defer stop()
+
+		state, err := service.sync(ctx, job)
+
+		service.mutex.Lock()
+		defer service.mutex.Unlock()
+
+		if state == "" {
+			state = service.stopState
+		}
+		job.State = state
+		job.Error = ""
+		if _, ok := ldap.AsPartialUsers(err); ok {
+			job.Error = err.Error()
+			service.log.Warn("LDAP sync missed the users of some base DNs", "id", job.Id, "error", err)
+		} else if err != nil {
+			job.Error = err.Error()
+			service.log.Error("LDAP sync failed", "id", job.Id, "error", err)
+		}
+		if err := service.saveWithReport(job); err != nil {
+			service.log.Error("Failed to save the LDAP sync job", "id", job.Id, "error", err)
+		}
+		service.log.Info("LDAP sync stopped", "id", job.Id, "state", job.State,
+			"synced", job.Synced, "skipped", job.Skipped, "failed", job.Failed, "total", job.Total)
+
+		service.job, service.stop = nil, nil
+	}()
+}
+
+// sync syncs the users after the checkpoint of the job. It returns the
+// state of the job once done, empty when it was stopped
+func (service *SyncService) sync(ctx context.Context, job *models.LdapSyncJob) (string, error) {
+	config, err := service.getConfig()
+	if err != nil {
+		return models.LdapSyncFailed, err
+	}
+	if config == nil {
+		return models.LdapSyncFailed, errors.New("LDAP is not enabled")
+	}
+
+	// the users found are synced even if the searches of some base DNs
+	// timed out, the job reports these base DNs
+	users, err := service.newMultiLDAP(config.Servers).UsersPaged(batchSize(), newPacer(ctx, service.log))
+	if ctx.Err() != nil {
+		return "", nil
+	}
+	partial, isPartial := ldap.AsPartialUsers(err)
+	if err != nil && !isPartial {
+		return models.LdapSyncFailed, err
+	}
+	if isPartial {
+		service.recordMissingBaseDNs(job, partial)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return strings.ToLower(users[i].DN) < strings.ToLower(users[j].DN)
+	})
+
+	service.mutex.Lock()
+	job.Total = int64(len(users))
+	service.mutex.Unlock()
+
+	queued, err := service.queuedRetries()
+	if err != nil {
+		service.log.Warn("Failed to get the LDAP users queued for retry", "error", err)
+	}
+
+	// the users after the checkpoint
+	pending := users[sort.Search(len(users), func(i int) bool {
+		return strings.ToLower(users[i].DN) > job.Checkpoint
+	}):]
+
+	for len(pending) > 0 {
+		if ctx.Err() != nil {
+			return "", nil
+		}
+
+		batch := pending
+		if len(batch) > batchSize() {
+			batch = batch[:batchSize()]
+		}
+		pending = pending[len(batch):]
+		entries := service.syncBatch(ctx, config, batch)
+		for i, entry := range entries {
+			if entry == nil {
+				break
+			}
+			if err := service.updateRetry(batch[i], entry, queued[retryKey(batch[i].Server, batch[i].DN)]); err != nil {
+				service.log.Warn("Failed to update the LDAP sync retry of the user", "dn", batch[i].DN, "error", err)
+			}
+		}
+
+		stopped := false
+		service.mutex.Lock()
+		for i, entry := range entries {
+			// the users after the first one not synced are synced again on resume
+			if entry == nil {
+				stopped = true
+				break
+			}
+
+			switch entry.Action {
+			case models.LdapSyncUserFailed:
+				job.Failed++
+			case models.LdapSyncSkipped:
+				job.Skipped++
+			default:
+				job.Synced++
+			}
+			service.record(job, entry)
+			job.Checkpoint = strings.ToLower(batch[i].DN)
+		}
+		if err := service.saveWithReport(job); err != nil {
+			service.log.Error("Failed to save the LDAP sync checkpoint", "id", job.Id, "error", err)
+		}
+		service.mutex.Unlock()
+
+		if stopped {
+			return "", nil
+		}
+	}
+
+	if setting.LdapDisableMissingUsers {
+		if err := service.cleanUp(job, users, partial); err != nil {
+			return models.LdapSyncFailed, err
+		}
+	}
+
+	if isPartial {
+		return models.LdapSyncCompleted, partial
+	}
+	return models.LdapSyncCompleted, nil
+}
+
+// syncUser updates the Grafana user of the LDAP user. It returns the
+// action of the report with its detail, the changes applied or why the
+// user was skipped, and the error of a failed sync
+func (service *SyncService) syncUser(config *ldap.Config, user *ldap.UserInfo) (string, string, error) {
+	if ldap.IsProtectedUser(user) {
+		service.log.Info("Skipping the protected LDAP user", "login", user.Username, "dn", user.DN)
+		return models.LdapSyncSkipped, "protected user", nil
+	}
+
+	server := findServer(config, user.Server)
+	if server == nil {
+		return models.LdapSyncUserFailed, "", errors.New("LDAP server of the user not found")
+	}
+
+	// the Grafana users of the moved entries are looked up by their new DN
+	auth := service.newLDAP(server)
+	if err := auth.RelinkUser(user); err != nil {
+		return models.LdapSyncUserFailed, "", err
+	}
+
+	query := &models.GetUserByAuthInfoQuery{AuthModule: ldap.AuthModule, AuthId: user.DN, Login: user.Username}
+	if err := service.Bus.Dispatch(query); err != nil {
+		if err == models.ErrUserNotFound {
+			return models.LdapSyncSkipped, "no Grafana user", nil
+		}
+		return models.LdapSyncUserFailed, "", err
+	}
+
+	before, err := service.snapshot(query.Result.Id)
+	if err != nil {
+		return models.LdapSyncUserFailed, "", err
+	}
+
+	revoked, err := service.revokeApiKeys(query.Result.Id, user)
+	if err != nil {
+		return models.LdapSyncUserFailed, "", err
+	}
+
+	// only upsert the users out of sync, the ones losing their access included
+	if extUser, err := auth.MapGrafanaUser(user); err == nil && !login.NeedsSync(before.user, before.orgs, extUser) {
+		if err := auth.ApplyGroupQuotas(user); err != nil {
+			return models.LdapSyncUserFailed, "", err
+		}
+		if err := auth.StoreAttributes(user, query.Result.Id); err != nil {
+			return models.LdapSyncUserFailed, "", err
+		}
+		if revoked != "" {
+			return models.LdapSyncUpdated, revoked, nil
+		}
+		return models.LdapSyncUnchanged, "", nil
+	}
+
+	// with strict_org_removal, the users matching no group mapping are removed from their orgs
+	_, syncErr := auth.GetGrafanaUserFor(nil, user)
+	if syncErr != nil && (syncErr != ldap.ErrInvalidCredentials || !setting.LdapStrictOrgRemoval) {
+		return models.LdapSyncUserFailed, "", syncErr
+	}
+
+	after, err := service.snapshot(query.Result.Id)
+	if err != nil {
+		return models.LdapSyncUserFailed, "", err
+	}
+
+	changes := before.changes(after)
+	if revoked != "" {
+		changes = append(changes, revoked)
+	}
+	if syncErr != nil {
+		if len(changes) == 0 {
+			return models.LdapSyncUserFailed, "", syncErr
+		}
+		return models.LdapSyncOrgsRemoved, strings.Join(changes, "; "), nil
+	}
+	if len(changes) == 0 {
+		return models.LdapSyncUnchanged, "", nil
+	}
+	return models.LdapSyncUpdated, strings.Join(changes, "; "), nil
+}
+
+// findServer returns the server of the config with the host
+func findServer(config *ldap.Config, host string) *ldap.ServerConfig {
+	for _, server := range config.Servers {
+		if server.Host == host {
+			return server
+		}
+	}
+	return nil
+}
+
+// Job returns the job of the id
+func (service *SyncService) Job(id int64) (*models.LdapSyncJob, error) {
+	query := &models.GetLdapSyncJobQuery{Id: id}
+	if err := service.Bus.Dispatch(query); err != nil {
+		return nil, err
+	}
+	return query.Result, nil
+}
+
+func (service *SyncService) lastJob() (*models.LdapSyncJob, error) {
+	query := &models.GetLdapSyncJobQuery{}
+	if err := service.Bus.Dispatch(query); err != nil {
+		return nil, err
+	}
+	return query.Result, nil
+}
+
+func (service *SyncService) save(job *models.LdapSyncJob) error {
+	return service.Bus.Dispatch(&models.SaveLdapSyncJobCommand{Job: job})
+}
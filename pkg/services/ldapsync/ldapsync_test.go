@@ -0,0 +1,557 @@
+package ldapsync
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/services/multildap"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+type mockMultiLDAP struct {
+	multildap.IMultiLDAP
+	users []*ldap.UserInfo
+	err   error
+}
+
+func (multiLDAP *mockMultiLDAP) UsersPaged(pageSize int, pacer ldap.Pacer) ([]*ldap.UserInfo, error) {
+	return multiLDAP.users, multiLDAP.err
+}
+
+func (multiLDAP *mockMultiLDAP) User(username string) (*ldap.UserInfo, error) {
+	for _, user := range multiLDAP.users {
+		if user.Username == username {
+			return user, nil
+		}
+	}
+	return nil, ldap.ErrInvalidCredentials
+}
+
+type mockLDAP struct {
+	ldap.IAuth
+	synced  func(user *ldap.UserInfo)
+	written func(user *ldap.UserInfo)
+	denied  string
+}
+
+// MapGrafanaUser maps tod to a Grafana admin, the others to themselves,
+// but the denied user matching no group mapping
+func (auth *mockLDAP) MapGrafanaUser(user *ldap.UserInfo) (*models.ExternalUserInfo, error) {
+	auth.synced(user)
+	if user.Username == auth.denied {
+		return nil, ldap.ErrInvalidCredentials
+	}
+	extUser := &models.ExternalUserInfo{Login: user.Username}
+	if user.Username == "tod" {
+		admin := true
+		extUser.IsGrafanaAdmin = &admin
+	}
+	return extUser, nil
+}
+
+func (auth *mockLDAP) ApplyGroupQuotas(user *ldap.UserInfo) error {
+	return nil
+}
+
+func (auth *mockLDAP) StoreAttributes(user *ldap.UserInfo, userId int64) error {
+	return nil
+}
+
+func (auth *mockLDAP) RelinkUser(user *ldap.UserInfo) error {
+	return nil
+}
+
+func (auth *mockLDAP) GetGrafanaUserFor(ctx *models.ReqContext, user *ldap.UserInfo) (*models.User, error) {
+	auth.written(user)
+	if user.Username == auth.denied {
+		return nil, ldap.ErrInvalidCredentials
+	}
+	return &models.User{Login: user.Username}, nil
+}
+
+// syncScenario is a service syncing 3 users, the second of which has no Grafana user
+type syncScenario struct {
+	service *SyncService
+	jobs    []models.LdapSyncJob
+
+	mutex   sync.Mutex
+	synced  []string
+	written []string
+	report  []*models.LdapSyncReportEntry
+
+	// retries are the users queued for retry by lowercase DN
+	retries map[string]*models.LdapSyncRetry
+
+	// logins are the logins of the Grafana users by id, and admins the
+	// ids of the Grafana admins, the sync of tod makes it one
+	logins map[int64]string
+	admins map[int64]bool
+
+	// denied matches no group mapping, its orgs are removed by strict_org_removal
+	denied string
+	orgs   map[int64][]*models.UserOrgDTO
+
+	// usersErr is returned with the users of the directory
+	usersErr error
+
+	// block blocks the sync of the user until it's closed
+	block   string
+	entered chan struct{}
+	release chan struct{}
+}
+
+func newSyncScenario() *syncScenario {
+	sc := &syncScenario{entered: make(chan struct{}), release: make(chan struct{}), logins: map[int64]string{}, retries: map[string]*models.LdapSyncRetry{}, admins: map[int64]bool{}, orgs: map[int64][]*models.UserOrgDTO{}}
+	server := &ldap.ServerConfig{Host: "ldap.example.org"}
+	users := []*ldap.UserInfo{
+		{DN: "uid=tod,ou=users,dc=grafana,dc=org", Username: "tod", Server: server.Host},
+		{DN: "uid=nobody,ou=users,dc=grafana,dc=org", Username: "nobody", Server: server.Host},
+		{DN: "uid=Roel,ou=users,dc=grafana,dc=org", Username: "roel", Server: server.Host},
+	}
+
+	dispatcher := bus.New()
+	dispatcher.AddHandler(func(query *models.GetLdapSyncJobQuery) error {
+		sc.mutex.Lock()
+		defer sc.mutex.Unlock()
+		if len(sc.jobs) == 0 || query.Id > int64(len(sc.jobs)) {
+			return models.ErrLdapSyncJobNotFound
+		}
+		job := sc.jobs[len(sc.jobs)-1]
+		if query.Id != 0 {
+			job = sc.jobs[query.Id-1]
+		}
+		query.Result = &job
+		return nil
+	})
+	dispatcher.AddHandler(func(cmd *models.AddLdapSyncReportEntriesCommand) error {
+		sc.mutex.Lock()
+		defer sc.mutex.Unlock()
+		sc.report = append(sc.report, cmd.Entries...)
+		return nil
+	})
+	dispatcher.AddHandler(func(query *models.GetLdapSyncReportQuery) error {
+		sc.mutex.Lock()
+		defer sc.mutex.Unlock()
+		for _, entry := range sc.report {
+			if entry.JobId == query.JobId {
+				query.Result = append(query.Result, entry)
+			}
+		}
+		return nil
+	})
+	dispatcher.AddHandler(func(cmd *models.SaveLdapSyncJobCommand) error {
+		sc.mutex.Lock()
+		defer sc.mutex.Unlock()
+		if cmd.Job.Id == 0 {
+			cmd.Job.Id = int64(len(sc.jobs) + 1)
+			sc.jobs = append(sc.jobs, *cmd.Job)
+			return nil
+		}
+		sc.jobs[cmd.Job.Id-1] = *cmd.Job
+		return nil
+	})
+	dispatcher.AddHandler(func(query *models.GetLdapSyncRetriesQuery) error {
+		sc.mutex.Lock()
+		defer sc.mutex.Unlock()
+		for _, retry := range sc.retries {
+			if query.DueBy.IsZero() || !retry.NextAttempt.After(query.DueBy) {
+				copied := *retry
+				query.Result = append(query.Result, &copied)
+			}
+		}
+		return nil
+	})
+	dispatcher.AddHandler(func(query *models.GetLdapSyncRetryQuery) error {
+		sc.mutex.Lock()
+		defer sc.mutex.Unlock()
+		retry, ok := sc.retries[strings.ToLower(query.Dn)]
+		if !ok {
+			return models.ErrLdapSyncRetryNotFound
+		}
+		copied := *retry
+		query.Result = &copied
+		return nil
+	})
+	dispatcher.AddHandler(func(cmd *models.SaveLdapSyncRetryCommand) error {
+		sc.mutex.Lock()
+		defer sc.mutex.Unlock()
+		retry := *cmd.Retry
+		retry.Dn = strings.ToLower(retry.Dn)
+		sc.retries[retry.Dn] = &retry
+		return nil
+	})
+	dispatcher.AddHandler(func(cmd *models.DeleteLdapSyncRetryCommand) error {
+		sc.mutex.Lock()
+		defer sc.mutex.Unlock()
+		delete(sc.retries, strings.ToLower(cmd.Dn))
+		return nil
+	})
+	dispatcher.AddHandler(func(query *models.GetUserByAuthInfoQuery) error {
+		if query.Login == "nobody" {
+			return models.ErrUserNotFound
+		}
+		sc.mutex.Lock()
+		defer sc.mutex.Unlock()
+		id := int64(len(query.Login))
+		sc.logins[id] = query.Login
+		query.Result = &models.User{Id: id, Login: query.Login}
+		return nil
+	})
+	dispatcher.AddHandler(func(query *models.GetUserByIdQuery) error {
+		sc.mutex.Lock()
+		defer sc.mutex.Unlock()
+		query.Result = &models.User{Id: query.Id, Login: sc.logins[query.Id], IsAdmin: sc.admins[query.Id]}
+		return nil
+	})
+	dispatcher.AddHandler(func(query *models.GetUserOrgListQuery) error {
+		sc.mutex.Lock()
+		defer sc.mutex.Unlock()
+		query.Result = sc.orgs[query.UserId]
+		return nil
+	})
+
+	sc.service = &SyncService{
+		Bus:          dispatcher,
+		log:          log.New("test-logger"),
+		ctx:          context.Background(),
+		getConfig:    func() (*ldap.Config, error) { return &ldap.Config{Servers: []*ldap.ServerConfig{server}}, nil },
+		newMultiLDAP: func([]*ldap.ServerConfig) multildap.IMultiLDAP { return &mockMultiLDAP{users: users, err: sc.usersErr} },
+		newLDAP: func(*ldap.ServerConfig) ldap.IAuth {
+			return &mockLDAP{
+				synced: func(user *ldap.UserInfo) {
+					if user.Username == sc.block {
+						close(sc.entered)
+						<-sc.release
+					}
+					sc.mutex.Lock()
+					sc.synced = append(sc.synced, user.Username)
+					sc.mutex.Unlock()
+				},
+				written: func(user *ldap.UserInfo) {
+					sc.mutex.Lock()
+					sc.written = append(sc.written, user.Username)
+					if user.Username == sc.denied {
+						if setting.LdapStrictOrgRemoval {
+							delete(sc.orgs, int64(len(user.Username)))
+						}
+					} else {
+						sc.admins[int64(len(user.Username))] = true
+					}
+					sc.mutex.Unlock()
+				},
+				denied: sc.denied,
+			}
+		},
+	}
+	return sc
+}
+
+// waitStopping waits for the running job to be asked to stop
+func (sc *syncScenario) waitStopping() {
+	for {
+		sc.service.mutex.Lock()
+		stopping := sc.service.stopState != models.LdapSyncRunning
+		sc.service.mutex.Unlock()
+		if stopping {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSyncService(t *testing.T) {
+	Convey("Sync service", t, func() {
+		sc := newSyncScenario()
+		service := sc.service
+
+		Convey("Should sync the Grafana users in the order of their DN", func() {
+			_, err := service.Status()
+			So(err, ShouldEqual, models.ErrLdapSyncJobNotFound)
+
+			job, err := service.Start(1)
+			So(err, ShouldBeNil)
+			So(job.State, ShouldEqual, models.LdapSyncRunning)
+			service.wait()
+
+			status, err := service.Status()
+			So(err, ShouldBeNil)
+			So(status.State, ShouldEqual, models.LdapSyncCompleted)
+			So(status.Total, ShouldEqual, 3)
+			So(status.Synced, ShouldEqual, 2)
+			So(status.Skipped, ShouldEqual, 1)
+			So(status.StartedBy, ShouldEqual, 1)
+			So(sc.synced, ShouldResemble, []string{"roel", "tod"})
+
+			_, report, err := service.Report(job.Id)
+			So(err, ShouldBeNil)
+			So(report, ShouldHaveLength, 3)
+			So(report[0].Login, ShouldEqual, "nobody")
+			So(report[0].Action, ShouldEqual, models.LdapSyncSkipped)
+			So(report[0].Detail, ShouldEqual, "no Grafana user")
+			So(report[1].Action, ShouldEqual, models.LdapSyncUnchanged)
+			So(report[2].Action, ShouldEqual, models.LdapSyncUpdated)
+			So(report[2].Detail, ShouldEqual, "grafana admin: false -> true")
+			So(sc.written, ShouldResemble, []string{"tod"})
+
+			_, _, err = service.Report(job.Id + 1)
+			So(err, ShouldEqual, models.ErrLdapSyncJobNotFound)
+		})
+
+		Convey("Should report the users matching no group mapping removed from their orgs", func() {
+			defer func(strict bool) { setting.LdapStrictOrgRemoval = strict }(setting.LdapStrictOrgRemoval)
+			setting.LdapStrictOrgRemoval = true
+			sc.denied = "roel"
+			sc.orgs[4] = []*models.UserOrgDTO{{OrgId: 1, Role: models.ROLE_VIEWER}}
+
+			job, err := service.Start(1)
+			So(err, ShouldBeNil)
+			service.wait()
+
+			_, report, err := service.Report(job.Id)
+			So(err, ShouldBeNil)
+			So(report[1].Login, ShouldEqual, "roel")
+			So(report[1].Action, ShouldEqual, models.LdapSyncOrgsRemoved)
+			So(report[1].Detail, ShouldEqual, "org 1: removed, was Viewer")
+			So(sc.orgs, ShouldBeEmpty)
+		})
+
+		Convey("Should fail to sync the users matching no group mapping without strict org removal", func() {
+			sc.denied = "roel"
+			sc.orgs[4] = []*models.UserOrgDTO{{OrgId: 1, Role: models.ROLE_VIEWER}}
+
+			job, err := service.Start(1)
+			So(err, ShouldBeNil)
+			service.wait()
+
+			_, report, err := service.Report(job.Id)
+			So(err, ShouldBeNil)
+			So(report[1].Action, ShouldEqual, models.LdapSyncUserFailed)
+			So(report[1].Error, ShouldEqual, ldap.ErrInvalidCredentials.Error())
+			So(sc.orgs, ShouldHaveLength, 1)
+		})
+
+		Convey("Should revoke the API keys of the users who left the API key groups", func() {
+			defer func(enabled bool, groups []string) {
+				setting.LdapEnabled, setting.LdapApiKeyGroups = enabled, groups
+			}(setting.LdapEnabled, setting.LdapApiKeyGroups)
+			setting.LdapEnabled = true
+			setting.LdapApiKeyGroups = []string{"cn=automation,dc=grafana,dc=org"}
+
+			var revoked []int64
+			service.Bus.AddHandler(func(cmd *models.DeleteUserApiKeysCommand) error {
+				sc.mutex.Lock()
+				defer sc.mutex.Unlock()
+				revoked = append(revoked, cmd.UserId)
+				if cmd.UserId == 4 {
+					cmd.DeletedRows = 2
+				}
+				return nil
+			})
+
+			job, err := service.Start(1)
+			So(err, ShouldBeNil)
+			service.wait()
+
+			_, report, err := service.Report(job.Id)
+			So(err, ShouldBeNil)
+			So(revoked, ShouldHaveLength, 2)
+			So(report[1].Login, ShouldEqual, "roel")
+			So(report[1].Action, ShouldEqual, models.LdapSyncUpdated)
+			So(report[1].Detail, ShouldEqual, "2 API keys revoked")
+			So(report[2].Detail, ShouldEqual, "grafana admin: false -> true")
+		})
+
+		Convey("Should sync the users found and report the base DNs whose search timed out", func() {
+			sc.usersErr = &ldap.PartialUsersError{Errors: []*ldap.BaseDNError{
+				{Server: "ldap.example.org", BaseDN: "ou=admins,dc=grafana,dc=org", Err: ldap.ErrTimeout},
+			}}
+
+			job, err := service.Start(1)
+			So(err, ShouldBeNil)
+			service.wait()
+
+			status, err := service.Status()
+			So(err, ShouldBeNil)
+			So(status.State, ShouldEqual, models.LdapSyncCompleted)
+			So(status.Synced, ShouldEqual, 2)
+			So(status.Error, ShouldEqual, sc.usersErr.Error())
+
+			_, report, err := service.Report(job.Id)
+			So(err, ShouldBeNil)
+			So(report, ShouldHaveLength, 4)
+			So(report[0].Dn, ShouldEqual, "ou=admins,dc=grafana,dc=org")
+			So(report[0].Action, ShouldEqual, models.LdapSyncBaseDNMissed)
+			So(report[0].Error, ShouldEqual, ldap.ErrTimeout.Error())
+		})
+
+		Convey("Should fail on the other errors of the directory", func() {
+			sc.usersErr = ldap.ErrServerUnavailable
+
+			_, err := service.Start(1)
+			So(err, ShouldBeNil)
+			service.wait()
+
+			status, err := service.Status()
+			So(err, ShouldBeNil)
+			So(status.State, ShouldEqual, models.LdapSyncFailed)
+			So(status.Error, ShouldEqual, ldap.ErrServerUnavailable.Error())
+		})
+
+		Convey("Should sync the batches with several workers", func() {
+			defer func(workers, size int) {
+				setting.LdapSyncWorkers, setting.LdapSyncBatchSize = workers, size
+			}(setting.LdapSyncWorkers, setting.LdapSyncBatchSize)
+			setting.LdapSyncWorkers, setting.LdapSyncBatchSize = 4, 2
+
+			job, err := service.Start(1)
+			So(err, ShouldBeNil)
+			service.wait()
+
+			status, err := service.Status()
+			So(err, ShouldBeNil)
+			So(status.State, ShouldEqual, models.LdapSyncCompleted)
+			So(status.Checkpoint, ShouldEqual, "uid=tod,ou=users,dc=grafana,dc=org")
+			So(status.Synced, ShouldEqual, 2)
+			So(status.Skipped, ShouldEqual, 1)
+			So(sc.synced, ShouldHaveLength, 2)
+
+			_, report, err := service.Report(job.Id)
+			So(err, ShouldBeNil)
+			So(report, ShouldHaveLength, 3)
+			So(report[0].Login, ShouldEqual, "nobody")
+			So(report[1].Login, ShouldEqual, "roel")
+			So(report[2].Login, ShouldEqual, "tod")
+		})
+
+		Convey("Should skip the protected users", func() {
+			defer func(users []string) { setting.LdapSyncProtectedUsers = users }(setting.LdapSyncProtectedUsers)
+			setting.LdapSyncProtectedUsers = []string{"uid=tod,ou=users,dc=grafana,dc=org"}
+
+			_, err := service.Start(1)
+			So(err, ShouldBeNil)
+			service.wait()
+
+			status, err := service.Status()
+			So(err, ShouldBeNil)
+			So(status.Synced, ShouldEqual, 1)
+			So(status.Skipped, ShouldEqual, 2)
+			So(sc.synced, ShouldResemble, []string{"roel"})
+		})
+
+		Convey("Should pause after the checkpoint and resume", func() {
+			sc.block = "roel"
+			_, err := service.Start(1)
+			So(err, ShouldBeNil)
+			<-sc.entered
+
+			_, err = service.Start(1)
+			So(err, ShouldEqual, ErrSyncRunning)
+
+			paused := make(chan error)
+			go func() { paused <- service.Pause() }()
+			sc.waitStopping()
+			close(sc.release)
+			So(<-paused, ShouldBeNil)
+
+			status, err := service.Status()
+			So(err, ShouldBeNil)
+			So(status.State, ShouldEqual, models.LdapSyncPaused)
+			So(status.Checkpoint, ShouldEqual, "uid=roel,ou=users,dc=grafana,dc=org")
+			So(status.Synced, ShouldEqual, 1)
+
+			_, err = service.Start(1)
+			So(err, ShouldEqual, ErrSyncPaused)
+
+			_, err = service.Resume()
+			So(err, ShouldBeNil)
+			service.wait()
+
+			status, err = service.Status()
+			So(err, ShouldBeNil)
+			So(status.State, ShouldEqual, models.LdapSyncCompleted)
+			So(status.Synced, ShouldEqual, 2)
+			So(status.Skipped, ShouldEqual, 1)
+			So(sc.synced, ShouldResemble, []string{"roel", "tod"})
+			So(sc.jobs, ShouldHaveLength, 1)
+
+			So(service.Pause(), ShouldEqual, ErrSyncNotRunning)
+			_, err = service.Resume()
+			So(err, ShouldEqual, ErrSyncNotPaused)
+		})
+
+		Convey("Should cancel the paused job", func() {
+			sc.block = "roel"
+			_, err := service.Start(1)
+			So(err, ShouldBeNil)
+			<-sc.entered
+
+			paused := make(chan error)
+			go func() { paused <- service.Pause() }()
+			sc.waitStopping()
+			close(sc.release)
+			So(<-paused, ShouldBeNil)
+
+			So(service.Cancel(), ShouldBeNil)
+			status, err := service.Status()
+			So(err, ShouldBeNil)
+			So(status.State, ShouldEqual, models.LdapSyncCancelled)
+
+			_, err = service.Resume()
+			So(err, ShouldEqual, ErrSyncNotPaused)
+			So(service.Cancel(), ShouldEqual, ErrSyncNotRunning)
+		})
+
+		Convey("Should resume the job interrupted by a shutdown", func() {
+			sc.block = "roel"
+			ctx, shutdown := context.WithCancel(context.Background())
+			stopped := make(chan error)
+			go func() { stopped <- service.Run(ctx) }()
+
+			for {
+				service.mutex.Lock()
+				running := service.ctx == ctx
+				service.mutex.Unlock()
+				if running {
+					break
+				}
+				time.Sleep(time.Millisecond)
+			}
+
+			_, err := service.Start(0)
+			So(err, ShouldBeNil)
+			<-sc.entered
+			shutdown()
+			close(sc.release)
+			So(<-stopped, ShouldEqual, context.Canceled)
+
+			status, err := service.Status()
+			So(err, ShouldBeNil)
+			So(status.State, ShouldEqual, models.LdapSyncRunning)
+			So(status.Checkpoint, ShouldEqual, "uid=roel,ou=users,dc=grafana,dc=org")
+
+			ctx, shutdown = context.WithCancel(context.Background())
+			defer shutdown()
+			go func() { stopped <- service.Run(ctx) }()
+
+			for {
+				status, err = service.Status()
+				So(err, ShouldBeNil)
+				if status.State != models.LdapSyncRunning {
+					break
+				}
+				time.Sleep(time.Millisecond)
+			}
+			So(status.State, ShouldEqual, models.LdapSyncCompleted)
+			So(sc.synced, ShouldResemble, []string{"roel", "tod"})
+		})
+	})
+}
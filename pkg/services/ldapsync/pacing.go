@@ -0,0 +1,89 @@
+package ldapsync
+
+import (
+	"context"
+	"time"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// minPacingDelay is the wait under which the pacing stops waiting
+const minPacingDelay = 10 * time.Millisecond
+
+// pacer paces the pages of the users searched by a sync with the latency
+// of the directory, waiting longer between the pages while the directory
+// answers slower than sync_pacing_latency
+type pacer struct {
+	ctx      context.Context
+	log      log.Logger
+	latency  time.Duration
+	maxDelay time.Duration
+
+	// delay is the wait before the next page
+	delay time.Duration
+}
+
+// newPacer returns the pacer of the pages of a sync, nil when
+// sync_pacing_latency turns the pacing off
+func newPacer(ctx context.Context, logger log.Logger) ldap.Pacer {
+	if setting.LdapSyncPacingLatency <= 0 || setting.LdapSyncPacingMaxDelay <= 0 {
+		return nil
+	}
+	return &pacer{
+		ctx:      ctx,
+		log:      logger,
+		latency:  setting.LdapSyncPacingLatency,
+		maxDelay: setting.LdapSyncPacingMaxDelay,
+	}
+}
+
+// observe adapts the delay to the latency of the last page. A slow page
+// doubles the delay, starting from its latency, up to sync_pacing_max_delay,
+// a fast one halves it
+func (pacer *pacer) observe(latency time.Duration) time.Duration {
+	if latency > pacer.latency {
+		pacer.delay *= 2
+		if pacer.delay < latency {
+			pacer.delay = latency
+		}
+		if pacer.delay > pacer.maxDelay {
+			pacer.delay = pacer.maxDelay
+		}
+		return pacer.delay
+	}
+
+	pacer.delay /= 2
+	if pacer.delay < minPacingDelay {
+		pacer.delay = 0
+	}
+	return pacer.delay
+}
+
+// Pace waits before the next page for as long as the latency of the
+// directory asks, returning the error of the context of the sync once
+// it's stopped
+func (pacer *pacer) Pace(latency time.Duration) error {
+	previous := pacer.delay
+	delay := pacer.observe(latency)
+	if delay == 0 {
+		if previous > 0 {
+			pacer.log.Info("LDAP sync back to full speed", "latency", latency)
+		}
+		return pacer.ctx.Err()
+	}
+	if previous == 0 {
+		pacer.log.Info("LDAP directory answering slowly, slowing the sync down", "latency", latency, "delay", delay)
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-pacer.ctx.Done():
+		return pacer.ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
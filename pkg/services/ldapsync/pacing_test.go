@@ -0,0 +1,52 @@
+package ldapsync
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+func TestSyncPacing(t *testing.T) {
+	Convey("Sync pacing", t, func() {
+		defer func(latency, maxDelay time.Duration) {
+			setting.LdapSyncPacingLatency, setting.LdapSyncPacingMaxDelay = latency, maxDelay
+		}(setting.LdapSyncPacingLatency, setting.LdapSyncPacingMaxDelay)
+		setting.LdapSyncPacingLatency, setting.LdapSyncPacingMaxDelay = time.Second, 10*time.Second
+
+		Convey("Should slow down while the directory is slow and speed up once it's fast again", func() {
+			pacer := newPacer(context.Background(), log.New("test-logger")).(*pacer)
+
+			So(pacer.observe(500*time.Millisecond), ShouldEqual, 0)
+			So(pacer.observe(2*time.Second), ShouldEqual, 2*time.Second)
+			So(pacer.observe(1500*time.Millisecond), ShouldEqual, 4*time.Second)
+			So(pacer.observe(2*time.Second), ShouldEqual, 8*time.Second)
+			So(pacer.observe(3*time.Second), ShouldEqual, 10*time.Second)
+			So(pacer.observe(12*time.Second), ShouldEqual, 10*time.Second)
+
+			So(pacer.observe(100*time.Millisecond), ShouldEqual, 5*time.Second)
+			for i := 0; i < 8; i++ {
+				pacer.observe(100 * time.Millisecond)
+			}
+			So(pacer.observe(100*time.Millisecond), ShouldEqual, 0)
+		})
+
+		Convey("Should stop waiting once the sync is stopped", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			pacer := newPacer(ctx, log.New("test-logger"))
+
+			cancel()
+			So(pacer.Pace(5*time.Second), ShouldEqual, context.Canceled)
+			So(pacer.Pace(0), ShouldEqual, context.Canceled)
+		})
+
+		Convey("Should not pace with sync_pacing_latency = 0", func() {
+			setting.LdapSyncPacingLatency = 0
+			So(newPacer(context.Background(), log.New("test-logger")), ShouldBeNil)
+		})
+	})
+}
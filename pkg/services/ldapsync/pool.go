@@ -0,0 +1,68 @@
+package ldapsync
+
+import (
+	"context"
+	"sync"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// batchSize is the number of users searched in each page and synced
+// between two checkpoints
+func batchSize() int {
+	if setting.LdapSyncBatchSize < 1 {
+		return defaultBatchSize
+	}
+	return setting.LdapSyncBatchSize
+}
+
+// syncBatch syncs the users of the batch with sync_workers workers and
+// returns their report entries in the order of the batch. The entries of
+// the users left when the sync is stopped are nil
+func (service *SyncService) syncBatch(ctx context.Context, config *ldap.Config, batch []*ldap.UserInfo) []*models.LdapSyncReportEntry {
+	workers := setting.LdapSyncWorkers
+	if workers > len(batch) {
+		workers = len(batch)
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	entries := make([]*models.LdapSyncReportEntry, len(batch))
+	indexes := make(chan int)
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for worker := 0; worker < workers; worker++ {
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				if ctx.Err() != nil {
+					continue
+				}
+				entries[index] = service.syncEntry(config, batch[index])
+			}
+		}()
+	}
+
+	for index := range batch {
+		indexes <- index
+	}
+	close(indexes)
+	wg.Wait()
+
+	return entries
+}
+
+// syncEntry syncs the user and returns its report entry
+func (service *SyncService) syncEntry(config *ldap.Config, user *ldap.UserInfo) *models.LdapSyncReportEntry {
+	action, detail, err := service.syncUser(config, user)
+	entry := &models.LdapSyncReportEntry{Dn: user.DN, Login: user.Username, Action: action, Detail: detail}
+	if err != nil {
+		service.log.Warn("Failed to sync the LDAP user", "dn", user.DN, "error", err)
+		entry.Error = err.Error()
+	}
+	return entry
+}
@@ -0,0 +1,142 @@
+package ldapsync
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+)
+
+// Report returns the job of the id with its report
+func (service *SyncService) Report(id int64) (*models.LdapSyncJob, []*models.LdapSyncReportEntry, error) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	job, err := service.Job(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	query := &models.GetLdapSyncReportQuery{JobId: id}
+	if err := service.Bus.Dispatch(query); err != nil {
+		return nil, nil, err
+	}
+	entries := query.Result
+
+	// the running job has entries not saved yet
+	if service.job != nil && service.job.Id == id {
+		copied := *service.job
+		job = &copied
+		entries = append(entries, service.report...)
+	}
+
+	return job, entries, nil
+}
+
+// record adds the entry to the report of the job, the mutex must be held
+func (service *SyncService) record(job *models.LdapSyncJob, entry *models.LdapSyncReportEntry) {
+	entry.JobId = job.Id
+	entry.Created = now()
+	service.report = append(service.report, entry)
+}
+
+// saveWithReport saves the job with the report entries recorded since
+// the last save, the mutex must be held
+func (service *SyncService) saveWithReport(job *models.LdapSyncJob) error {
+	// the entries are saved with the next checkpoint if they can't be now
+	if err := service.Bus.Dispatch(&models.AddLdapSyncReportEntriesCommand{Entries: service.report}); err != nil {
+		service.log.Error("Failed to save the LDAP sync report", "id", job.Id, "error", err)
+	} else {
+		service.report = nil
+	}
+	return service.save(job)
+}
+
+// userSnapshot is what the sync may change of a Grafana user
+type userSnapshot struct {
+	user *models.User
+	orgs []*models.UserOrgDTO
+}
+
+func (service *SyncService) snapshot(userId int64) (*userSnapshot, error) {
+	query := &models.GetUserByIdQuery{Id: userId}
+	if err := service.Bus.Dispatch(query); err != nil {
+		return nil, err
+	}
+
+	orgsQuery := &models.GetUserOrgListQuery{UserId: userId}
+	if err := service.Bus.Dispatch(orgsQuery); err != nil {
+		return nil, err
+	}
+
+	return &userSnapshot{user: query.Result, orgs: orgsQuery.Result}, nil
+}
+
+func (snapshot *userSnapshot) orgRoles() map[int64]models.RoleType {
+	orgRoles := map[int64]models.RoleType{}
+	for _, org := range snapshot.orgs {
+		orgRoles[org.OrgId] = org.Role
+	}
+	return orgRoles
+}
+
+// changes describes the changes from the snapshot to the other, in the order of the orgs
+func (snapshot *userSnapshot) changes(other *userSnapshot) []string {
+	var changes []string
+	if snapshot.user.Login != other.user.Login {
+		changes = append(changes, fmt.Sprintf("login: %q -> %q", snapshot.user.Login, other.user.Login))
+	}
+	if snapshot.user.Name != other.user.Name {
+		changes = append(changes, fmt.Sprintf("name: %q -> %q", snapshot.user.Name, other.user.Name))
+	}
+	if snapshot.user.Email != other.user.Email {
+		changes = append(changes, fmt.Sprintf("email: %q -> %q", snapshot.user.Email, other.user.Email))
+	}
+	if snapshot.user.IsAdmin != other.user.IsAdmin {
+		changes = append(changes, fmt.Sprintf("grafana admin: %v -> %v", snapshot.user.IsAdmin, other.user.IsAdmin))
+	}
+
+	beforeRoles, afterRoles := snapshot.orgRoles(), other.orgRoles()
+	var orgIds []int64
+	for orgId := range beforeRoles {
+		orgIds = append(orgIds, orgId)
+	}
+	for orgId := range afterRoles {
+		if _, ok := beforeRoles[orgId]; !ok {
+			orgIds = append(orgIds, orgId)
+		}
+	}
+	sort.Slice(orgIds, func(i, j int) bool { return orgIds[i] < orgIds[j] })
+
+	for _, orgId := range orgIds {
+		before, after := beforeRoles[orgId], afterRoles[orgId]
+		switch {
+		case before == after:
+		case before == "":
+			changes = append(changes, fmt.Sprintf("org %d: added as %s", orgId, after))
+		case after == "":
+			changes = append(changes, fmt.Sprintf("org %d: removed, was %s", orgId, before))
+		default:
+			changes = append(changes, fmt.Sprintf("org %d: %s -> %s", orgId, before, after))
+		}
+	}
+
+	return changes
+}
+
+// recordMissingBaseDNs adds an entry to the report of the job for each
+// base DN whose search timed out, their users are not synced
+func (service *SyncService) recordMissingBaseDNs(job *models.LdapSyncJob, partial *ldap.PartialUsersError) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	for _, baseErr := range partial.Errors {
+		service.record(job, &models.LdapSyncReportEntry{
+			Dn:     baseErr.BaseDN,
+			Action: models.LdapSyncBaseDNMissed,
+			Detail: "search timed out on " + baseErr.Server + ", its users are not synced",
+			Error:  baseErr.Err.Error(),
+		})
+	}
+}
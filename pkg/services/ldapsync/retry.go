@@ -0,0 +1,204 @@
+package ldapsync
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// retryInterval is how often the retries due are synced
+const retryInterval = time.Minute
+
+// retryBackoff returns the delay before the next attempt of a user which
+// failed to sync attempts times, doubling from sync_retry_backoff up to
+// sync_retry_max_backoff
+func retryBackoff(attempts int) time.Duration {
+	backoff, maxBackoff := setting.LdapSyncRetryBackoff, setting.LdapSyncRetryMaxBackoff
+	if maxBackoff < backoff {
+		maxBackoff = backoff
+	}
+	for i := 1; i < attempts && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		return maxBackoff
+	}
+	return backoff
+}
+
+// retriesEnabled checks if the users failing to sync are queued
+func retriesEnabled() bool {
+	return setting.LdapSyncRetryBackoff > 0
+}
+
+// runRetries syncs the retries due every retryInterval until ctx is done
+func (service *SyncService) runRetries(ctx context.Context) {
+	ticker := time.NewTicker(retryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if !retriesEnabled() {
+				continue
+			}
+			if _, err := service.syncRetries(now()); err != nil && err != ErrSyncRunning {
+				service.log.Error("Failed to sync the LDAP users queued for retry", "error", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Retries returns the users queued for retry, the ones due first first
+func (service *SyncService) Retries() ([]*models.LdapSyncRetry, error) {
+	query := &models.GetLdapSyncRetriesQuery{}
+	if err := service.Bus.Dispatch(query); err != nil {
+		return nil, err
+	}
+	return query.Result, nil
+}
+
+// FlushRetries syncs all the users queued for retry now, without waiting
+// for their next attempt, and returns what was done to each of them
+func (service *SyncService) FlushRetries() ([]*models.LdapSyncReportEntry, error) {
+	return service.syncRetries(time.Time{})
+}
+
+// ClearRetries empties the queue, the users are then only synced again by
+// the next sync. It returns the number of users removed
+func (service *SyncService) ClearRetries() (int64, error) {
+	cmd := &models.DeleteLdapSyncRetriesCommand{}
+	if err := service.Bus.Dispatch(cmd); err != nil {
+		return 0, err
+	}
+	service.log.Info("Cleared the LDAP sync retries", "deleted", cmd.DeletedRows)
+	return cmd.DeletedRows, nil
+}
+
+// syncRetries syncs the users queued for retry due by dueBy, all of them
+// when it's zero, unless a job runs since it syncs them too. The users
+// synced leave the queue, the ones failing again wait longer
+func (service *SyncService) syncRetries(dueBy time.Time) ([]*models.LdapSyncReportEntry, error) {
+	service.retryMutex.Lock()
+	defer service.retryMutex.Unlock()
+
+	service.mutex.Lock()
+	running := service.job != nil
+	service.mutex.Unlock()
+	if running {
+		return nil, ErrSyncRunning
+	}
+
+	query := &models.GetLdapSyncRetriesQuery{DueBy: dueBy}
+	if err := service.Bus.Dispatch(query); err != nil {
+		return nil, err
+	}
+	if len(query.Result) == 0 {
+		return []*models.LdapSyncReportEntry{}, nil
+	}
+
+	config, err := service.getConfig()
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, errors.New("LDAP is not enabled")
+	}
+
+	multiLDAP := service.newMultiLDAP(config.Servers)
+	entries := make([]*models.LdapSyncReportEntry, 0, len(query.Result))
+	for _, retry := range query.Result {
+		entry := &models.LdapSyncReportEntry{Dn: retry.Dn, Login: retry.Login}
+		entries = append(entries, entry)
+
+		user, err := multiLDAP.User(retry.Login)
+		if err == ldap.ErrInvalidCredentials || (err == nil && !strings.EqualFold(user.DN, retry.Dn)) {
+			// the users missing from LDAP are left to disable_missing_users
+			service.log.Info("Dropping the LDAP sync retry of the user missing from LDAP", "login", retry.Login, "dn", retry.Dn)
+			entry.Action, entry.Detail = models.LdapSyncSkipped, "missing from LDAP"
+			if err := service.dequeueRetry(retry.Server, retry.Dn); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			entry.Action, entry.Error = models.LdapSyncUserFailed, err.Error()
+			if err := service.queueRetry(&ldap.UserInfo{DN: retry.Dn, Username: retry.Login, Server: retry.Server}, err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		*entry = *service.syncEntry(config, user)
+		if err := service.updateRetry(user, entry, true); err != nil {
+			return nil, err
+		}
+	}
+
+	service.log.Info("Synced the LDAP users queued for retry", "users", len(entries))
+	return entries, nil
+}
+
+// retryKey returns the key of the user of the DN on the server in the queue
+func retryKey(server, dn string) string {
+	return server + "\n" + strings.ToLower(dn)
+}
+
+// queuedRetries returns the retryKey of the users queued for retry
+func (service *SyncService) queuedRetries() (map[string]bool, error) {
+	retries, err := service.Retries()
+	if err != nil {
+		return nil, err
+	}
+
+	queued := make(map[string]bool, len(retries))
+	for _, retry := range retries {
+		queued[retryKey(retry.Server, retry.Dn)] = true
+	}
+	return queued, nil
+}
+
+// updateRetry queues the user if its sync failed, or removes it from the
+// queue if it's synced and queued
+func (service *SyncService) updateRetry(user *ldap.UserInfo, entry *models.LdapSyncReportEntry, queued bool) error {
+	if entry.Action == models.LdapSyncUserFailed {
+		if !retriesEnabled() {
+			return nil
+		}
+		return service.queueRetry(user, errors.New(entry.Error))
+	}
+	if queued {
+		return service.dequeueRetry(user.Server, user.DN)
+	}
+	return nil
+}
+
+// queueRetry queues the user which failed to sync, or counts another
+// failed attempt of the queued one
+func (service *SyncService) queueRetry(user *ldap.UserInfo, syncErr error) error {
+	retry := &models.LdapSyncRetry{Dn: user.DN, Login: user.Username, Server: user.Server}
+	query := &models.GetLdapSyncRetryQuery{Server: user.Server, Dn: user.DN}
+	if err := service.Bus.Dispatch(query); err == nil {
+		retry = query.Result
+	} else if err != models.ErrLdapSyncRetryNotFound {
+		return err
+	}
+
+	retry.Attempts++
+	retry.Error = syncErr.Error()
+	retry.NextAttempt = now().Add(retryBackoff(retry.Attempts))
+	service.log.Info("Queued the LDAP user for another sync", "login", retry.Login, "dn", retry.Dn,
+		"attempts", retry.Attempts, "nextAttempt", retry.NextAttempt)
+	return service.Bus.Dispatch(&models.SaveLdapSyncRetryCommand{Retry: retry})
+}
+
+func (service *SyncService) dequeueRetry(server, dn string) error {
+	return service.Bus.Dispatch(&models.DeleteLdapSyncRetryCommand{Server: server, Dn: dn})
+}
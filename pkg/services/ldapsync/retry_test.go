@@ -0,0 +1,94 @@
+package ldapsync
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+func TestSyncRetries(t *testing.T) {
+	Convey("Sync retries", t, func() {
+		defer func(backoff, maxBackoff time.Duration) {
+			setting.LdapSyncRetryBackoff, setting.LdapSyncRetryMaxBackoff = backoff, maxBackoff
+			now = time.Now
+		}(setting.LdapSyncRetryBackoff, setting.LdapSyncRetryMaxBackoff)
+		setting.LdapSyncRetryBackoff, setting.LdapSyncRetryMaxBackoff = 5*time.Minute, time.Hour
+
+		current := time.Date(2019, 7, 1, 0, 0, 0, 0, time.UTC)
+		now = func() time.Time { return current }
+
+		Convey("Should double the backoff up to sync_retry_max_backoff", func() {
+			So(retryBackoff(1), ShouldEqual, 5*time.Minute)
+			So(retryBackoff(2), ShouldEqual, 10*time.Minute)
+			So(retryBackoff(4), ShouldEqual, 40*time.Minute)
+			So(retryBackoff(5), ShouldEqual, time.Hour)
+			So(retryBackoff(1000), ShouldEqual, time.Hour)
+		})
+
+		sc := newSyncScenario()
+		service := sc.service
+		sc.denied = "roel"
+
+		_, err := service.Start(1)
+		So(err, ShouldBeNil)
+		service.wait()
+
+		Convey("Should queue the users failing to sync", func() {
+			retries, err := service.Retries()
+			So(err, ShouldBeNil)
+			So(retries, ShouldHaveLength, 1)
+			So(retries[0].Dn, ShouldEqual, "uid=roel,ou=users,dc=grafana,dc=org")
+			So(retries[0].Login, ShouldEqual, "roel")
+			So(retries[0].Attempts, ShouldEqual, 1)
+			So(retries[0].NextAttempt, ShouldEqual, current.Add(5*time.Minute))
+			So(retries[0].Error, ShouldEqual, "Invalid Username or Password")
+		})
+
+		Convey("Should only sync the retries due", func() {
+			entries, err := service.syncRetries(current.Add(time.Minute))
+			So(err, ShouldBeNil)
+			So(entries, ShouldBeEmpty)
+
+			entries, err = service.syncRetries(current.Add(5 * time.Minute))
+			So(err, ShouldBeNil)
+			So(entries, ShouldHaveLength, 1)
+			So(entries[0].Action, ShouldEqual, models.LdapSyncUserFailed)
+			So(sc.retries["uid=roel,ou=users,dc=grafana,dc=org"].Attempts, ShouldEqual, 2)
+			So(sc.retries["uid=roel,ou=users,dc=grafana,dc=org"].NextAttempt, ShouldEqual, current.Add(10*time.Minute))
+		})
+
+		Convey("Should remove the users synced from the queue", func() {
+			sc.denied = ""
+
+			entries, err := service.FlushRetries()
+			So(err, ShouldBeNil)
+			So(entries, ShouldHaveLength, 1)
+			So(entries[0].Login, ShouldEqual, "roel")
+			So(entries[0].Action, ShouldEqual, models.LdapSyncUnchanged)
+			So(sc.retries, ShouldBeEmpty)
+		})
+
+		Convey("Should drop the users missing from LDAP", func() {
+			sc.retries["uid=gone,ou=users,dc=grafana,dc=org"] = &models.LdapSyncRetry{Dn: "uid=gone,ou=users,dc=grafana,dc=org", Login: "gone"}
+
+			entries, err := service.FlushRetries()
+			So(err, ShouldBeNil)
+			So(entries, ShouldHaveLength, 2)
+			So(sc.retries, ShouldHaveLength, 1)
+		})
+
+		Convey("Should not queue the users with the retries off", func() {
+			setting.LdapSyncRetryBackoff = 0
+			sc.retries = map[string]*models.LdapSyncRetry{}
+
+			_, err := service.Start(1)
+			So(err, ShouldBeNil)
+			service.wait()
+			So(sc.retries, ShouldBeEmpty)
+		})
+	})
+}
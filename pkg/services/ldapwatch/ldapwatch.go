@@ -0,0 +1,192 @@
+package ldapwatch
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/infra/remotecache"
+	authproxy "github.com/grafana/grafana/pkg/middleware/auth_proxy"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/registry"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+func init() {
+	registry.RegisterService(&WatchService{})
+}
+
+// WatchService watches the mapped groups of the LDAP servers every
+// group_watch_interval and drops the auth proxy cache entries of the
+// users whose membership changed, so they're looked up again on their
+// next request instead of once ldap_sync_ttl expires
+type WatchService struct {
+	Bus         bus.Bus                  `inject:""`
+	RemoteCache *remotecache.RemoteCache `inject:""`
+
+	log        log.Logger
+	getConfig  func() (*ldap.Config, error)
+	newWatcher func(server *ldap.ServerConfig) groupWatcher
+
+	// groups are the last read groups by server and DN
+	groups map[string]map[string]*watchedGroup
+}
+
+// groupWatcher reads the mapped groups of a server
+type groupWatcher interface {
+	WatchGroups(modified map[string]string) ([]*ldap.WatchedGroup, error)
+}
+
+// watchedGroup is the last read state of a group, its members by their
+// lowercased value
+type watchedGroup struct {
+	modified string
+	members  map[string]string
+}
+
+// Init initializes the service
+func (service *WatchService) Init() error {
+	service.log = log.New("ldap.watch")
+	service.getConfig = ldap.GetConfig
+	service.newWatcher = func(server *ldap.ServerConfig) groupWatcher {
+		return ldap.New(server).(groupWatcher)
+	}
+	service.groups = map[string]map[string]*watchedGroup{}
+	return nil
+}
+
+// IsDisabled checks if there's no auth proxy cache of the LDAP users to
+// keep in sync with the groups
+func (service *WatchService) IsDisabled() bool {
+	return !ldap.IsEnabled() || setting.LdapGroupWatchInterval <= 0 ||
+		!setting.AuthProxyEnabled || !setting.AuthProxyLdapEnrichment
+}
+
+// Run watches the groups until ctx is done
+func (service *WatchService) Run(ctx context.Context) error {
+	ticker := time.NewTicker(setting.LdapGroupWatchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			service.watch()
+		}
+	}
+}
+
+// watch reads the groups of the active servers once and invalidates the
+// cache of the members added or removed since the previous read. The
+// first read of a group only records its members
+func (service *WatchService) watch() {
+	config, err := service.getConfig()
+	if err != nil || config == nil {
+		return
+	}
+
+	changed := map[string]string{}
+	for _, server := range config.Servers {
+		if !ldap.IsActive(server) {
+			continue
+		}
+
+		key := ldap.ServerKey(server)
+		known := service.groups[key]
+		if known == nil {
+			known = map[string]*watchedGroup{}
+			service.groups[key] = known
+		}
+
+		modified := map[string]string{}
+		for dn, group := range known {
+			modified[dn] = group.modified
+		}
+
+		groups, err := service.newWatcher(server).WatchGroups(modified)
+		if err != nil {
+			service.log.Warn("Failed to watch the LDAP groups", "server", key, "error", err)
+			continue
+		}
+
+		for _, group := range groups {
+			if group.Members == nil {
+				continue
+			}
+
+			members := map[string]string{}
+			for _, member := range group.Members {
+				members[strings.ToLower(member)] = member
+			}
+
+			if previous, ok := known[group.DN]; ok {
+				for lower, member := range members {
+					if _, ok := previous.members[lower]; !ok {
+						changed[lower] = member
+					}
+				}
+				for lower, member := range previous.members {
+					if _, ok := members[lower]; !ok {
+						changed[lower] = member
+					}
+				}
+			}
+			known[group.DN] = &watchedGroup{modified: group.Modified, members: members}
+		}
+	}
+
+	for _, member := range changed {
+		service.invalidate(member)
+	}
+	if len(changed) > 0 {
+		service.log.Info("Invalidated the auth proxy cache of the LDAP users whose groups changed", "count", len(changed))
+	}
+}
+
+// invalidate drops the auth proxy cache entries of the Grafana user of
+// the member, by its login and its email since the proxy header can be
+// either
+func (service *WatchService) invalidate(member string) {
+	for _, header := range service.headers(member) {
+		if err := service.RemoteCache.Delete(fmt.Sprintf(authproxy.CachePrefix, header)); err != nil {
+			service.log.Debug("Failed to invalidate the auth proxy cache", "header", header, "error", err)
+		}
+	}
+}
+
+// headers returns the auth proxy headers of the Grafana user of the
+// member, which is the DN of an LDAP user or its login
+func (service *WatchService) headers(member string) []string {
+	var user *models.User
+	if strings.Contains(member, "=") {
+		authQuery := &models.GetAuthInfoQuery{AuthModule: ldap.AuthModule, AuthId: member}
+		if err := service.Bus.Dispatch(authQuery); err != nil {
+			return nil
+		}
+		userQuery := &models.GetUserByIdQuery{Id: authQuery.Result.UserId}
+		if err := service.Bus.Dispatch(userQuery); err != nil {
+			return nil
+		}
+		user = userQuery.Result
+	} else {
+		userQuery := &models.GetUserByLoginQuery{LoginOrEmail: member}
+		if err := service.Bus.Dispatch(userQuery); err != nil {
+			return []string{member}
+		}
+		user = userQuery.Result
+	}
+
+	headers := []string{user.Login}
+	if user.Email != "" && user.Email != user.Login {
+		headers = append(headers, user.Email)
+	}
+	if !strings.Contains(member, "=") && member != user.Login {
+		headers = append(headers, member)
+	}
+	return headers
+}
@@ -0,0 +1,119 @@
+package ldapwatch
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/infra/remotecache"
+	authproxy "github.com/grafana/grafana/pkg/middleware/auth_proxy"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+)
+
+type mockWatcher struct {
+	groups   []*ldap.WatchedGroup
+	modified map[string]string
+}
+
+func (watcher *mockWatcher) WatchGroups(modified map[string]string) ([]*ldap.WatchedGroup, error) {
+	watcher.modified = modified
+	return watcher.groups, nil
+}
+
+func TestWatchService(t *testing.T) {
+	Convey("Watching the LDAP groups", t, func() {
+		users := map[int64]*models.User{
+			1: {Id: 1, Login: "roel", Email: "roel@grafana.org"},
+			2: {Id: 2, Login: "tod", Email: "tod@grafana.org"},
+			3: {Id: 3, Login: "torkel", Email: "torkel@grafana.org"},
+		}
+		dns := map[string]int64{
+			"cn=roel,dc=grafana,dc=org": 1,
+			"cn=tod,dc=grafana,dc=org":  2,
+		}
+
+		dispatcher := bus.New()
+		dispatcher.AddHandler(func(query *models.GetAuthInfoQuery) error {
+			id, ok := dns[query.AuthId]
+			if !ok {
+				return models.ErrUserNotFound
+			}
+			query.Result = &models.UserAuth{UserId: id, AuthModule: query.AuthModule, AuthId: query.AuthId}
+			return nil
+		})
+		dispatcher.AddHandler(func(query *models.GetUserByIdQuery) error {
+			query.Result = users[query.Id]
+			return nil
+		})
+		dispatcher.AddHandler(func(query *models.GetUserByLoginQuery) error {
+			for _, user := range users {
+				if user.Login == query.LoginOrEmail {
+					query.Result = user
+					return nil
+				}
+			}
+			return models.ErrUserNotFound
+		})
+
+		cache := remotecache.NewFakeStore(t)
+		for _, header := range []string{"roel", "roel@grafana.org", "tod", "tod@grafana.org", "torkel"} {
+			So(cache.Set(fmt.Sprintf(authproxy.CachePrefix, header), int64(1), time.Hour), ShouldBeNil)
+		}
+		cached := func(header string) bool {
+			_, err := cache.Get(fmt.Sprintf(authproxy.CachePrefix, header))
+			return err == nil
+		}
+
+		watcher := &mockWatcher{groups: []*ldap.WatchedGroup{
+			{DN: "cn=admins,dc=grafana,dc=org", Modified: "1", Members: []string{"cn=roel,dc=grafana,dc=org"}},
+			{DN: "cn=editors,dc=grafana,dc=org", Modified: "1", Members: []string{"torkel"}},
+		}}
+		service := &WatchService{
+			Bus:         dispatcher,
+			RemoteCache: cache,
+			log:         log.New("test-logger"),
+			getConfig: func() (*ldap.Config, error) {
+				return &ldap.Config{Servers: []*ldap.ServerConfig{{Host: "ldap.example.org"}}}, nil
+			},
+			newWatcher: func(server *ldap.ServerConfig) groupWatcher { return watcher },
+			groups:     map[string]map[string]*watchedGroup{},
+		}
+
+		Convey("Should only record the groups on the first read", func() {
+			service.watch()
+			So(cached("roel"), ShouldBeTrue)
+			So(cached("torkel"), ShouldBeTrue)
+		})
+
+		Convey("Should invalidate the members added and removed since the previous read", func() {
+			service.watch()
+
+			watcher.groups = []*ldap.WatchedGroup{
+				{DN: "cn=admins,dc=grafana,dc=org", Modified: "2", Members: []string{"CN=roel,dc=grafana,dc=org", "cn=tod,dc=grafana,dc=org"}},
+				{DN: "cn=editors,dc=grafana,dc=org", Modified: "2", Members: []string{}},
+			}
+			service.watch()
+			So(watcher.modified, ShouldResemble, map[string]string{"cn=admins,dc=grafana,dc=org": "1", "cn=editors,dc=grafana,dc=org": "1"})
+
+			So(cached("roel"), ShouldBeTrue)
+			So(cached("roel@grafana.org"), ShouldBeTrue)
+			So(cached("tod"), ShouldBeFalse)
+			So(cached("tod@grafana.org"), ShouldBeFalse)
+			So(cached("torkel"), ShouldBeFalse)
+		})
+
+		Convey("Should not invalidate the groups which weren't modified", func() {
+			service.watch()
+
+			watcher.groups = []*ldap.WatchedGroup{{DN: "cn=admins,dc=grafana,dc=org", Modified: "1"}}
+			service.watch()
+			So(cached("roel"), ShouldBeTrue)
+			So(cached("torkel"), ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,70 @@
+package login
+
+import (
+	m "github.com/grafana/grafana/pkg/models"
+)
+
+// OrgRolesDiff is the writes syncing the orgs of a user with the org
+// roles of an external user
+type OrgRolesDiff struct {
+	Add    map[int64]m.RoleType
+	Update map[int64]m.RoleType
+	Remove []int64
+}
+
+// IsEmpty checks if the orgs of the user are already in sync
+func (diff *OrgRolesDiff) IsEmpty() bool {
+	return len(diff.Add) == 0 && len(diff.Update) == 0 && len(diff.Remove) == 0
+}
+
+// DiffOrgRoles compares the orgs of the user with the org roles, no org
+// roles leave the orgs as they are
+func DiffOrgRoles(orgs []*m.UserOrgDTO, orgRoles map[int64]m.RoleType) *OrgRolesDiff {
+	diff := &OrgRolesDiff{Add: map[int64]m.RoleType{}, Update: map[int64]m.RoleType{}}
+	if len(orgRoles) == 0 {
+		return diff
+	}
+
+	handledOrgIds := map[int64]bool{}
+	for _, org := range orgs {
+		handledOrgIds[org.OrgId] = true
+
+		if orgRoles[org.OrgId] == "" {
+			diff.Remove = append(diff.Remove, org.OrgId)
+		} else if orgRoles[org.OrgId] != org.Role {
+			diff.Update[org.OrgId] = orgRoles[org.OrgId]
+		}
+	}
+
+	for orgId, orgRole := range orgRoles {
+		if !handledOrgIds[orgId] {
+			diff.Add[orgId] = orgRole
+		}
+	}
+
+	return diff
+}
+
+// NeedsSync checks if the upsert of the external user would write
+// anything to the Grafana user in the orgs: its login, email, name, org
+// roles, current org or Grafana admin permission. The OAuth tokens and
+// the teams are always synced
+func NeedsSync(user *m.User, orgs []*m.UserOrgDTO, extUser *m.ExternalUserInfo) bool {
+	if (extUser.Login != "" && extUser.Login != user.Login) ||
+		(extUser.Email != "" && extUser.Email != user.Email) ||
+		(extUser.Name != "" && extUser.Name != user.Name) {
+		return true
+	}
+
+	if extUser.IsGrafanaAdmin != nil && *extUser.IsGrafanaAdmin != user.IsAdmin {
+		return true
+	}
+
+	if len(extUser.OrgRoles) == 0 {
+		return false
+	}
+	if _, ok := extUser.OrgRoles[user.OrgId]; !ok {
+		return true
+	}
+	return !DiffOrgRoles(orgs, extUser.OrgRoles).IsEmpty()
+}
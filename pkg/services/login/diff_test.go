@@ -0,0 +1,55 @@
+package login
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	m "github.com/grafana/grafana/pkg/models"
+)
+
+func TestDiff(t *testing.T) {
+	Convey("Diff of a Grafana user with an external user", t, func() {
+		user := &m.User{Id: 1, Login: "roel", Email: "roel@grafana.com", Name: "Roel", OrgId: 1}
+		orgs := []*m.UserOrgDTO{
+			{OrgId: 1, Role: m.ROLE_ADMIN},
+			{OrgId: 2, Role: m.ROLE_VIEWER},
+		}
+		extUser := &m.ExternalUserInfo{
+			Login:    "roel",
+			Email:    "roel@grafana.com",
+			OrgRoles: map[int64]m.RoleType{1: m.ROLE_ADMIN, 2: m.ROLE_VIEWER},
+		}
+
+		Convey("Should not sync the user in sync", func() {
+			So(NeedsSync(user, orgs, extUser), ShouldBeFalse)
+			So(DiffOrgRoles(orgs, extUser.OrgRoles).IsEmpty(), ShouldBeTrue)
+
+			extUser.OrgRoles = nil
+			So(NeedsSync(user, orgs, extUser), ShouldBeFalse)
+		})
+
+		Convey("Should diff the org roles", func() {
+			diff := DiffOrgRoles(orgs, map[int64]m.RoleType{1: m.ROLE_EDITOR, 3: m.ROLE_VIEWER})
+			So(diff.Update, ShouldResemble, map[int64]m.RoleType{1: m.ROLE_EDITOR})
+			So(diff.Add, ShouldResemble, map[int64]m.RoleType{3: m.ROLE_VIEWER})
+			So(diff.Remove, ShouldResemble, []int64{2})
+		})
+
+		Convey("Should sync the user with other info", func() {
+			extUser.Email = "roel@grafana.org"
+			So(NeedsSync(user, orgs, extUser), ShouldBeTrue)
+		})
+
+		Convey("Should sync the user becoming a Grafana admin", func() {
+			admin := true
+			extUser.IsGrafanaAdmin = &admin
+			So(NeedsSync(user, orgs, extUser), ShouldBeTrue)
+		})
+
+		Convey("Should sync the user removed from its current org", func() {
+			extUser.OrgRoles = map[int64]m.RoleType{2: m.ROLE_VIEWER}
+			So(NeedsSync(user, []*m.UserOrgDTO{orgs[1]}, extUser), ShouldBeTrue)
+		})
+	})
+}
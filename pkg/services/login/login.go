@@ -6,6 +6,7 @@ import (
 	m "github.com/grafana/grafana/pkg/models"
 	"github.com/grafana/grafana/pkg/registry"
 	"github.com/grafana/grafana/pkg/services/quota"
+	"github.com/grafana/grafana/pkg/setting"
 )
 
 func init() {
@@ -106,8 +107,9 @@ func (ls *LoginService) UpsertUser(cmd *m.UpsertUserCommand) error {
 	}
 
 	err = ls.Bus.Dispatch(&m.SyncTeamsCommand{
-		User:         cmd.Result,
-		ExternalUser: extUser,
+		User:           cmd.Result,
+		ExternalUser:   extUser,
+		ManualRemovals: manualTeamRemovals(extUser),
 	})
 
 	if err == bus.ErrHandlerNotFound {
@@ -117,6 +119,16 @@ func (ls *LoginService) UpsertUser(cmd *m.UpsertUserCommand) error {
 	return err
 }
 
+// manualTeamRemovals is the policy of the team sync of the external user
+// for the teams it was removed from manually, team_sync_manual_removals
+// for the LDAP users
+func manualTeamRemovals(extUser *m.ExternalUserInfo) string {
+	if extUser.AuthModule == "ldap" && setting.LdapTeamSyncManualRemovals == m.TeamMemberRemovalRespect {
+		return m.TeamMemberRemovalRespect
+	}
+	return m.TeamMemberRemovalOverride
+}
+
 func createUser(extUser *m.ExternalUserInfo) (*m.User, error) {
 	cmd := &m.CreateUserCommand{
 		Login:        extUser.Login,
@@ -188,31 +200,18 @@ func syncOrgRoles(user *m.User, extUser *m.ExternalUserInfo) error {
 		return err
 	}
 
-	handledOrgIds := map[int64]bool{}
-	deleteOrgIds := []int64{}
+	diff := DiffOrgRoles(orgsQuery.Result, extUser.OrgRoles)
 
 	// update existing org roles
-	for _, org := range orgsQuery.Result {
-		handledOrgIds[org.OrgId] = true
-
-		if extUser.OrgRoles[org.OrgId] == "" {
-			deleteOrgIds = append(deleteOrgIds, org.OrgId)
-		} else if extUser.OrgRoles[org.OrgId] != org.Role {
-			// update role
-			cmd := &m.UpdateOrgUserCommand{OrgId: org.OrgId, UserId: user.Id, Role: extUser.OrgRoles[org.OrgId]}
-			if err := bus.Dispatch(cmd); err != nil {
-				return err
-			}
+	for orgId, orgRole := range diff.Update {
+		cmd := &m.UpdateOrgUserCommand{OrgId: orgId, UserId: user.Id, Role: orgRole}
+		if err := bus.Dispatch(cmd); err != nil {
+			return err
 		}
 	}
 
 	// add any new org roles
-	for orgId, orgRole := range extUser.OrgRoles {
-		if _, exists := handledOrgIds[orgId]; exists {
-			continue
-		}
-
-		// add role
+	for orgId, orgRole := range diff.Add {
 		cmd := &m.AddOrgUserCommand{UserId: user.Id, Role: orgRole, OrgId: orgId}
 		err := bus.Dispatch(cmd)
 		if err != nil && err != m.ErrOrgNotFound {
@@ -221,7 +220,7 @@ func syncOrgRoles(user *m.User, extUser *m.ExternalUserInfo) error {
 	}
 
 	// delete any removed org roles
-	for _, orgId := range deleteOrgIds {
+	for _, orgId := range diff.Remove {
 		cmd := &m.RemoveOrgUserCommand{OrgId: orgId, UserId: user.Id}
 		if err := bus.Dispatch(cmd); err != nil {
 			return err
@@ -0,0 +1,98 @@
+package multildap
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+)
+
+// affinityCache remembers the server which authenticated a login,
+// so it can be tried first on the next login of the user.
+// Least recently used entries are evicted once the cache is full
+type affinityCache struct {
+	mutex   sync.Mutex
+	size    int
+	ttl     time.Duration
+	entries map[string]*list.Element
+	order   *list.List
+	now     func() time.Time
+}
+
+type affinityEntry struct {
+	login   string
+	server  string
+	expires time.Time
+}
+
+func newAffinityCache(size int, ttl time.Duration) *affinityCache {
+	return &affinityCache{
+		size:    size,
+		ttl:     ttl,
+		entries: map[string]*list.Element{},
+		order:   list.New(),
+		now:     time.Now,
+	}
+}
+
+// get returns the server remembered for the login
+func (cache *affinityCache) get(login string) (string, bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	element, ok := cache.entries[strings.ToLower(login)]
+	if !ok {
+		return "", false
+	}
+
+	entry := element.Value.(*affinityEntry)
+	if cache.now().After(entry.expires) {
+		cache.removeElement(element)
+		return "", false
+	}
+
+	cache.order.MoveToFront(element)
+	return entry.server, true
+}
+
+// set remembers the server for the login
+func (cache *affinityCache) set(login, server string) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	login = strings.ToLower(login)
+	expires := cache.now().Add(cache.ttl)
+
+	if element, ok := cache.entries[login]; ok {
+		entry := element.Value.(*affinityEntry)
+		entry.server = server
+		entry.expires = expires
+		cache.order.MoveToFront(element)
+		return
+	}
+
+	cache.entries[login] = cache.order.PushFront(&affinityEntry{
+		login:   login,
+		server:  server,
+		expires: expires,
+	})
+
+	for cache.order.Len() > cache.size {
+		cache.removeElement(cache.order.Back())
+	}
+}
+
+// remove forgets the server remembered for the login
+func (cache *affinityCache) remove(login string) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if element, ok := cache.entries[strings.ToLower(login)]; ok {
+		cache.removeElement(element)
+	}
+}
+
+func (cache *affinityCache) removeElement(element *list.Element) {
+	cache.order.Remove(element)
+	delete(cache.entries, element.Value.(*affinityEntry).login)
+}
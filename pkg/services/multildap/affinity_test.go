@@ -0,0 +1,59 @@
+package multildap
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAffinityCache(t *testing.T) {
+	Convey("Affinity cache", t, func() {
+		now := time.Now()
+		cache := newAffinityCache(2, time.Minute)
+		cache.now = func() time.Time {
+			return now
+		}
+
+		Convey("Should remember the server of the login", func() {
+			cache.set("User", "first")
+			server, ok := cache.get("user")
+
+			So(ok, ShouldBeTrue)
+			So(server, ShouldEqual, "first")
+		})
+
+		Convey("Should forget the expired entries", func() {
+			cache.set("user", "first")
+			now = now.Add(2 * time.Minute)
+			_, ok := cache.get("user")
+
+			So(ok, ShouldBeFalse)
+			So(cache.order.Len(), ShouldEqual, 0)
+		})
+
+		Convey("Should evict the least recently used entry", func() {
+			cache.set("one", "first")
+			cache.set("two", "first")
+			cache.get("one")
+			cache.set("three", "second")
+
+			_, ok := cache.get("two")
+			So(ok, ShouldBeFalse)
+
+			_, ok = cache.get("one")
+			So(ok, ShouldBeTrue)
+
+			_, ok = cache.get("three")
+			So(ok, ShouldBeTrue)
+		})
+
+		Convey("Should remove the entry", func() {
+			cache.set("user", "first")
+			cache.remove("user")
+			_, ok := cache.get("user")
+
+			So(ok, ShouldBeFalse)
+		})
+	})
+}
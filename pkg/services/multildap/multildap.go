@@ -0,0 +1,572 @@
+package multildap
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana/pkg/infra/metrics"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// newLDAP is the function that creates the LDAP object
+var newLDAP = ldap.New
+
+var logger = ldap.NewLogger("ldap")
+
+var (
+	affinity      *affinityCache
+	affinityMutex sync.Mutex
+)
+
+// ErrNoLDAPServers is returned when there is no LDAP servers specified
+var ErrNoLDAPServers = errors.New("No LDAP servers are configured")
+
+// ErrNoActiveServers is returned when all the servers are disabled or in maintenance mode
+var ErrNoActiveServers = errors.New("All LDAP servers are disabled or in maintenance")
+
+// ErrDuplicateUser is returned when the user authenticates on several
+// servers and the duplicates are rejected
+var ErrDuplicateUser = errors.New("User exists on more than one LDAP server")
+
+// errPasswordRejected is returned by loginAgainst when a server rejected
+// the password, Login returns it as ldap.ErrInvalidCredentials
+var errPasswordRejected = errors.New("LDAP server rejected the password")
+
+// Values of the duplicate_users setting
+const (
+	// DuplicateUsersFirstAnswer logs in against the fastest server
+	DuplicateUsersFirstAnswer = "first_answer"
+
+	// DuplicateUsersConfigOrder logs in against the topmost server
+	DuplicateUsersConfigOrder = "config_order"
+
+	// DuplicateUsersReject rejects the login
+	DuplicateUsersReject = "reject"
+)
+
+// IMultiLDAP is interface for MultiLDAP
+type IMultiLDAP interface {
+	Login(query *models.LoginUserQuery) error
+	VerifyPassword(username, password string) error
+	Users() ([]*ldap.UserInfo, error)
+	UsersPaged(pageSize int, pacer ldap.Pacer) ([]*ldap.UserInfo, error)
+	User(username string) (*ldap.UserInfo, error)
+}
+
+// MultiLDAP is basic struct of LDAP authorization
+// against the several configured servers
+type MultiLDAP struct {
+	configs []*ldap.ServerConfig
+}
+
+// authResult is the answer of a single server to a login attempt
+type authResult struct {
+	index   int
+	user    *ldap.UserInfo
+	err     error
+	elapsed time.Duration
+}
+
+// New creates the new MultiLDAP
+func New(configs []*ldap.ServerConfig) IMultiLDAP {
+	return &MultiLDAP{
+		configs: configs,
+	}
+}
+
+// Login tries to log in the user against all the configured servers at once.
+//
+// A server answering with ldap.ErrCouldNotFindUser does not own the
+// account, the other servers are still awaited, as do the ones whose
+// direct binds were all refused. One answering with
+// ldap.ErrInvalidCredentials found the user and rejected the password,
+// which is final: the
+// other attempts are cancelled and ldap.ErrInvalidCredentials is returned,
+// so a wrong password can't be tried against the other servers. Which of
+// the servers authenticating the user wins is decided by the duplicate_users
+// setting, see loginFirstAnswer and loginByPrecedence. If no server accepts
+// the user, the first error other than these two in config order is
+// returned, so an unavailable server is reported instead of being hidden
+// behind invalid credentials, and ldap.ErrInvalidCredentials otherwise.
+//
+// The server which authenticated the user last time is tried alone first,
+// see getAffinityCache. The attempt is audited once for each server which
+// answered, see ldap.AuditLogin
+func (multiples *MultiLDAP) Login(query *models.LoginUserQuery) error {
+	if len(multiples.configs) == 0 {
+		return ErrNoLDAPServers
+	}
+
+	configs := activeServers(multiples.configs)
+	if len(configs) == 0 {
+		return ErrNoActiveServers
+	}
+
+	configs = serversForLogin(configs, query.Username)
+
+	affinity := getAffinityCache()
+	if affinity == nil {
+		_, err := loginAgainst(configs, query)
+		return loginError(err)
+	}
+
+	var preferredErr error
+	if key, ok := affinity.get(query.Username); ok {
+		if preferred := findServer(configs, key); preferred != nil {
+			_, preferredErr = loginAgainst([]*ldap.ServerConfig{preferred}, query)
+			if preferredErr == nil || preferredErr == errPasswordRejected {
+				return loginError(preferredErr)
+			}
+
+			affinity.remove(query.Username)
+			configs = withoutServer(configs, preferred)
+		}
+	}
+
+	winner, err := loginAgainst(configs, query)
+	if err == nil {
+		affinity.set(query.Username, ldap.ServerKey(winner))
+		return nil
+	}
+
+	if err == ldap.ErrInvalidCredentials && preferredErr != nil {
+		return preferredErr
+	}
+
+	return loginError(err)
+}
+
+// loginError returns the error of loginAgainst as the one of Login
+func loginError(err error) error {
+	if err == errPasswordRejected {
+		return ldap.ErrInvalidCredentials
+	}
+
+	return err
+}
+
+// VerifyPassword checks the password of the user against the servers
+// which can own the login, in config order, without touching the Grafana
+// user. The first server having the user decides, the next servers are
+// only tried when it doesn't have the user or can't be reached. The
+// errors are reported like the ones of Login
+func (multiples *MultiLDAP) VerifyPassword(username, password string) error {
+	if len(multiples.configs) == 0 {
+		return ErrNoLDAPServers
+	}
+
+	configs := activeServers(multiples.configs)
+	if len(configs) == 0 {
+		return ErrNoActiveServers
+	}
+
+	errs := []error{}
+	for _, config := range serversForLogin(configs, username) {
+		err := newLDAP(config).VerifyPassword(username, password)
+		if err == nil || err == ldap.ErrInvalidCredentials {
+			return err
+		}
+		errs = append(errs, err)
+	}
+
+	return firstError(errs)
+}
+
+// loginAgainst logs in the user against the servers at once
+// and returns the config of the server which won. It returns
+// errPasswordRejected once a server rejects the password
+func loginAgainst(configs []*ldap.ServerConfig, query *models.LoginUserQuery) (*ldap.ServerConfig, error) {
+	servers := make([]ldap.IAuth, len(configs))
+	results := make(chan *authResult, len(configs))
+
+	for index, config := range configs {
+		servers[index] = newLDAP(config)
+
+		go func(index int, server ldap.IAuth) {
+			start := time.Now()
+			user, err := server.Authenticate(query)
+			results <- &authResult{index: index, user: user, err: err, elapsed: time.Since(start)}
+		}(index, servers[index])
+	}
+
+	var winner int
+	var err error
+	if awaitsAllServers() {
+		winner, err = loginByPrecedence(configs, servers, results, query)
+	} else {
+		winner, err = loginFirstAnswer(configs, servers, results, query)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return configs[winner], nil
+}
+
+// getAffinityCache returns the cache of the servers which authenticated
+// the users. It returns nil if the server affinity is disabled or the
+// duplicate_users setting needs the answer of every server
+func getAffinityCache() *affinityCache {
+	if setting.LdapServerAffinityCacheSize <= 0 || awaitsAllServers() {
+		return nil
+	}
+
+	affinityMutex.Lock()
+	defer affinityMutex.Unlock()
+
+	if affinity == nil {
+		affinity = newAffinityCache(
+			setting.LdapServerAffinityCacheSize,
+			setting.LdapServerAffinityTTL,
+		)
+	}
+
+	return affinity
+}
+
+// awaitsAllServers checks if the duplicate_users
+// setting needs the answer of every server
+func awaitsAllServers() bool {
+	switch setting.LdapDuplicateUsers {
+	case DuplicateUsersConfigOrder, DuplicateUsersReject:
+		return true
+	default:
+		return false
+	}
+}
+
+// loginFirstAnswer logs in against the first server that authenticates the user
+// and maps them to Grafana, the still running requests are cancelled. They're
+// cancelled as well when a server rejects the password
+func loginFirstAnswer(
+	configs []*ldap.ServerConfig,
+	servers []ldap.IAuth,
+	results chan *authResult,
+	query *models.LoginUserQuery,
+) (int, error) {
+	errs := make([]error, len(servers))
+	for range servers {
+		result := <-results
+
+		if result.err == ldap.ErrInvalidCredentials {
+			cancelOthers(servers, result.index)
+			auditAnswer(configs, query, result)
+			return 0, errPasswordRejected
+		}
+
+		if result.err == nil {
+			loginAnswered(servers[result.index], query, result)
+		}
+		auditAnswer(configs, query, result)
+
+		if result.err == nil {
+			cancelOthers(servers, result.index)
+			return result.index, nil
+		}
+
+		errs[result.index] = result.err
+	}
+
+	return 0, firstError(errs)
+}
+
+// loginByPrecedence waits for all the servers, flags the user authenticating
+// on more than one of them and logs in against the topmost one in config order,
+// unless duplicates are rejected. It stops waiting when a server rejects the
+// password, cancelling the other requests
+func loginByPrecedence(
+	configs []*ldap.ServerConfig,
+	servers []ldap.IAuth,
+	results chan *authResult,
+	query *models.LoginUserQuery,
+) (int, error) {
+	answers := make([]*authResult, len(servers))
+	defer auditAnswers(configs, query, answers)
+
+	for range servers {
+		result := <-results
+		answers[result.index] = result
+
+		if result.err == ldap.ErrInvalidCredentials {
+			cancelOthers(servers, result.index)
+			return 0, errPasswordRejected
+		}
+	}
+
+	hosts := []string{}
+	for _, answer := range answers {
+		if answer.err == nil {
+			hosts = append(hosts, configs[answer.index].Host)
+		}
+	}
+
+	if len(hosts) > 1 {
+		ldap.RequestLogger(logger, query.ReqContext).Warn(
+			"User exists on more than one LDAP server",
+			"username", query.Username,
+			"servers", hosts,
+			"policy", setting.LdapDuplicateUsers,
+		)
+		metrics.M_Ldap_Duplicate_Users.Inc()
+
+		if setting.LdapDuplicateUsers == DuplicateUsersReject {
+			for _, answer := range answers {
+				if answer.err == nil {
+					answer.err = ErrDuplicateUser
+				}
+			}
+			return 0, ErrDuplicateUser
+		}
+	}
+
+	errs := make([]error, len(servers))
+	for _, answer := range answers {
+		if answer.err == nil {
+			loginAnswered(servers[answer.index], query, answer)
+		}
+
+		if answer.err == nil {
+			return answer.index, nil
+		}
+
+		errs[answer.index] = answer.err
+	}
+
+	return 0, firstError(errs)
+}
+
+// loginAnswered logs in the user the server authenticated, the time the
+// mapping took counting in the elapsed time of the answer
+func loginAnswered(server ldap.IAuth, query *models.LoginUserQuery, answer *authResult) {
+	start := time.Now()
+	answer.err = loginUser(server, query, answer.user)
+	answer.elapsed += time.Since(start)
+}
+
+// auditAnswer saves the login attempt against the server which answered
+func auditAnswer(configs []*ldap.ServerConfig, query *models.LoginUserQuery, answer *authResult) {
+	ldap.AuditLogin(configs[answer.index], query, answer.err, answer.elapsed)
+}
+
+// auditAnswers saves the login attempts against each server which answered,
+// the answers of the servers not awaited are nil
+func auditAnswers(configs []*ldap.ServerConfig, query *models.LoginUserQuery, answers []*authResult) {
+	for _, answer := range answers {
+		if answer != nil {
+			auditAnswer(configs, query, answer)
+		}
+	}
+}
+
+// firstError returns the first error that is neither ldap.ErrInvalidCredentials
+// nor ldap.ErrCouldNotFindUser, and ldap.ErrInvalidCredentials otherwise
+func firstError(errs []error) error {
+	for _, err := range errs {
+		if err != ldap.ErrInvalidCredentials && err != ldap.ErrCouldNotFindUser {
+			return err
+		}
+	}
+
+	return ldap.ErrInvalidCredentials
+}
+
+// Users gets the users of all the configured servers. A user
+// found on several servers is only returned once, as found
+// on the topmost server in config order. When the searches of
+// some base DNs time out, the users found are returned along
+// with an *ldap.PartialUsersError listing the base DNs of all the servers
+func (multiples *MultiLDAP) Users() ([]*ldap.UserInfo, error) {
+	return multiples.UsersPaged(0, nil)
+}
+
+// UsersPaged gets the users like Users, searching each server in
+// pages of pageSize entries paced by the pacer
+func (multiples *MultiLDAP) UsersPaged(pageSize int, pacer ldap.Pacer) ([]*ldap.UserInfo, error) {
+	if len(multiples.configs) == 0 {
+		return nil, ErrNoLDAPServers
+	}
+
+	configs := activeServers(multiples.configs)
+	if len(configs) == 0 {
+		return nil, ErrNoActiveServers
+	}
+
+	result := []*ldap.UserInfo{}
+	seen := map[string]bool{}
+	var partial *ldap.PartialUsersError
+
+	for _, config := range configs {
+		users, err := newLDAP(config).UsersPaged(pageSize, pacer)
+		if serverPartial, ok := ldap.AsPartialUsers(err); ok {
+			if partial == nil {
+				partial = &ldap.PartialUsersError{}
+			}
+			partial.Add(serverPartial)
+		} else if err != nil {
+			return nil, err
+		}
+
+		for _, user := range users {
+			// DNs are case-insensitive
+			key := strings.ToLower(user.DN)
+			if seen[key] {
+				continue
+			}
+
+			seen[key] = true
+			user.Server = config.Host
+			result = append(result, user)
+		}
+	}
+
+	if partial != nil {
+		return result, partial
+	}
+	return result, nil
+}
+
+// User looks the user up on the servers which can own the login and search
+// the users, in config order, without touching the Grafana user. It returns
+// ldap.ErrInvalidCredentials if none of the servers has the user
+func (multiples *MultiLDAP) User(username string) (*ldap.UserInfo, error) {
+	if len(multiples.configs) == 0 {
+		return nil, ErrNoLDAPServers
+	}
+
+	configs := activeServers(multiples.configs)
+	if len(configs) == 0 {
+		return nil, ErrNoActiveServers
+	}
+
+	for _, config := range serversForLogin(configs, username) {
+		if !ldap.CanSearchUsers(config) {
+			continue
+		}
+
+		user, err := newLDAP(config).User(username)
+		if err == ldap.ErrCouldNotFindUser {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		user.Server = config.Host
+		return user, nil
+	}
+
+	return nil, ldap.ErrInvalidCredentials
+}
+
+// activeServers returns the servers which are
+// neither disabled nor in maintenance mode
+func activeServers(configs []*ldap.ServerConfig) []*ldap.ServerConfig {
+	result := []*ldap.ServerConfig{}
+	for _, config := range configs {
+		if ldap.IsActive(config) {
+			result = append(result, config)
+		}
+	}
+
+	return result
+}
+
+// serversForLogin returns the servers which can own the login, skipping
+// the search-only ones and the ones whose configured domains don't match
+// the login domain
+func serversForLogin(configs []*ldap.ServerConfig, login string) []*ldap.ServerConfig {
+	domain := ""
+	if at := strings.LastIndex(login, "@"); at != -1 {
+		domain = login[at+1:]
+	}
+
+	result := []*ldap.ServerConfig{}
+	for _, config := range configs {
+		if !ldap.CanAuthenticate(config) {
+			continue
+		}
+		if domain == "" || ownsDomain(config, domain) {
+			result = append(result, config)
+		}
+	}
+
+	return result
+}
+
+// ownsDomain checks if the server can own the accounts of the domain
+func ownsDomain(config *ldap.ServerConfig, domain string) bool {
+	if len(config.Domains) == 0 {
+		return true
+	}
+
+	for _, owned := range config.Domains {
+		if strings.EqualFold(owned, domain) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// findServer returns the config of the server identified by the key
+func findServer(configs []*ldap.ServerConfig, key string) *ldap.ServerConfig {
+	for _, config := range configs {
+		if ldap.ServerKey(config) == key {
+			return config
+		}
+	}
+
+	return nil
+}
+
+// withoutServer returns the configs except the given one
+func withoutServer(configs []*ldap.ServerConfig, excluded *ldap.ServerConfig) []*ldap.ServerConfig {
+	result := []*ldap.ServerConfig{}
+	for _, config := range configs {
+		if config != excluded {
+			result = append(result, config)
+		}
+	}
+
+	return result
+}
+
+// loginUser maps the authenticated user to the Grafana one,
+// once the second factor its groups may require is checked.
+// The service accounts only log in to authenticate API requests
+// and have no second factor, see ldap.CheckServiceAccountLogin
+func loginUser(server ldap.IAuth, query *models.LoginUserQuery, user *ldap.UserInfo) error {
+	if err := ldap.CheckServiceAccountLogin(query, user); err != nil {
+		return err
+	}
+
+	grafanaUser, err := server.GetGrafanaUserFor(query.ReqContext, user)
+	if err != nil {
+		return err
+	}
+
+	if !user.ServiceAccount {
+		if err := server.VerifySecondFactor(query, user, grafanaUser); err != nil {
+			return err
+		}
+	}
+
+	query.User = grafanaUser
+	query.PasswordPolicy = user.PasswordPolicy
+	return nil
+}
+
+// cancelOthers aborts the requests still running
+// against every server except the winner
+func cancelOthers(servers []ldap.IAuth, winner int) {
+	for index, server := range servers {
+		if index != winner {
+			server.Close()
+		}
+	}
+}
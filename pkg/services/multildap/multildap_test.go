@@ -0,0 +1,678 @@
+package multildap
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+func TestMultiLDAP(t *testing.T) {
+	Convey("Multildap", t, func() {
+		Convey("Login()", func() {
+			Convey("Should return error for absent config list", func() {
+				multi := New([]*ldap.ServerConfig{})
+				err := multi.Login(&models.LoginUserQuery{})
+
+				So(err, ShouldEqual, ErrNoLDAPServers)
+			})
+
+			Convey("Should login against the server that knows the user", func() {
+				mocks := setup(map[string]*mockLDAP{
+					"first":  {authenticateErr: ldap.ErrCouldNotFindUser},
+					"second": {},
+				})
+
+				query := &models.LoginUserQuery{Username: "user"}
+				multi := New([]*ldap.ServerConfig{{Host: "first"}, {Host: "second"}})
+				err := multi.Login(query)
+
+				So(err, ShouldBeNil)
+				So(query.User.Login, ShouldEqual, "second")
+				So(mocks["first"].getGrafanaUserForCalled, ShouldBeFalse)
+				So(mocks["first"].closeCalled, ShouldBeTrue)
+				So(mocks["second"].closeCalled, ShouldBeFalse)
+
+				teardown()
+			})
+
+			Convey("Should not log in the user until the second factor is given", func() {
+				setup(map[string]*mockLDAP{
+					"first": {verifySecondFactorErr: ldap.ErrSecondFactorRequired},
+				})
+
+				query := &models.LoginUserQuery{Username: "user"}
+				multi := New([]*ldap.ServerConfig{{Host: "first"}})
+				err := multi.Login(query)
+
+				So(err, ShouldEqual, ldap.ErrSecondFactorRequired)
+				So(query.User, ShouldBeNil)
+
+				teardown()
+			})
+
+			Convey("Should continue when the user does not belong to the mapped groups", func() {
+				mocks := setup(map[string]*mockLDAP{
+					"first":  {getGrafanaUserForErr: ldap.ErrInvalidCredentials},
+					"second": {authenticateErr: ldap.ErrCouldNotFindUser},
+				})
+
+				query := &models.LoginUserQuery{Username: "user"}
+				multi := New([]*ldap.ServerConfig{{Host: "first"}, {Host: "second"}})
+				err := multi.Login(query)
+
+				So(err, ShouldEqual, ldap.ErrInvalidCredentials)
+				So(mocks["first"].getGrafanaUserForCalled, ShouldBeTrue)
+				So(query.User, ShouldBeNil)
+
+				teardown()
+			})
+
+			Convey("Should return the error of the unavailable server", func() {
+				expected := errors.New("Network error")
+				setup(map[string]*mockLDAP{
+					"first":  {authenticateErr: ldap.ErrCouldNotFindUser},
+					"second": {authenticateErr: expected},
+				})
+
+				multi := New([]*ldap.ServerConfig{{Host: "first"}, {Host: "second"}})
+				err := multi.Login(&models.LoginUserQuery{Username: "user"})
+
+				So(err, ShouldEqual, expected)
+
+				teardown()
+			})
+
+			Convey("Should not fall through to the other servers when the password is rejected", func() {
+				mocks := setup(map[string]*mockLDAP{
+					"first":  {authenticateErr: ldap.ErrInvalidCredentials},
+					"second": {authenticateDelay: 50 * time.Millisecond},
+				})
+
+				query := &models.LoginUserQuery{Username: "user"}
+				multi := New([]*ldap.ServerConfig{{Host: "first"}, {Host: "second"}})
+				err := multi.Login(query)
+
+				So(err, ShouldEqual, ldap.ErrInvalidCredentials)
+				So(query.User, ShouldBeNil)
+				So(mocks["second"].wasCloseCalled(), ShouldBeTrue)
+				So(mocks["second"].wasGrafanaUserMapped(), ShouldBeFalse)
+
+				teardown()
+			})
+
+			Convey("Should not fall through to the other servers when the password is rejected with config_order policy", func() {
+				setting.LdapDuplicateUsers = DuplicateUsersConfigOrder
+				mocks := setup(map[string]*mockLDAP{
+					"first":  {authenticateErr: ldap.ErrInvalidCredentials, authenticateDelay: 50 * time.Millisecond},
+					"second": {},
+				})
+
+				query := &models.LoginUserQuery{Username: "user"}
+				multi := New([]*ldap.ServerConfig{{Host: "first"}, {Host: "second"}})
+				err := multi.Login(query)
+
+				So(err, ShouldEqual, ldap.ErrInvalidCredentials)
+				So(query.User, ShouldBeNil)
+				So(mocks["second"].wasGrafanaUserMapped(), ShouldBeFalse)
+
+				teardown()
+			})
+
+			Convey("Should skip the servers which don't own the login domain", func() {
+				mocks := setup(map[string]*mockLDAP{
+					"emea": {},
+					"apac": {},
+					"any":  {authenticateErr: ldap.ErrCouldNotFindUser},
+				})
+
+				query := &models.LoginUserQuery{Username: "user@APAC.corp"}
+				multi := New([]*ldap.ServerConfig{
+					{Host: "emea", Domains: []string{"emea.corp"}},
+					{Host: "apac", Domains: []string{"apac.corp"}},
+					{Host: "any"},
+				})
+				err := multi.Login(query)
+
+				So(err, ShouldBeNil)
+				So(query.User.Login, ShouldEqual, "apac")
+				So(mocks["emea"].wasAuthenticated(), ShouldBeFalse)
+
+				teardown()
+			})
+
+			Convey("Should fail when no server owns the login domain", func() {
+				mocks := setup(map[string]*mockLDAP{
+					"emea": {},
+				})
+
+				multi := New([]*ldap.ServerConfig{
+					{Host: "emea", Domains: []string{"emea.corp"}},
+				})
+				err := multi.Login(&models.LoginUserQuery{Username: "user@apac.corp"})
+
+				So(err, ShouldEqual, ldap.ErrInvalidCredentials)
+				So(mocks["emea"].wasAuthenticated(), ShouldBeFalse)
+
+				teardown()
+			})
+
+			Convey("Should skip the search-only servers", func() {
+				mocks := setup(map[string]*mockLDAP{
+					"enrichment": {},
+					"login":      {},
+				})
+
+				query := &models.LoginUserQuery{Username: "user"}
+				multi := New([]*ldap.ServerConfig{
+					{Host: "enrichment", AuthStrategy: ldap.AuthStrategySearchOnly},
+					{Host: "login"},
+				})
+				err := multi.Login(query)
+
+				So(err, ShouldBeNil)
+				So(query.User.Login, ShouldEqual, "login")
+				So(mocks["enrichment"].wasAuthenticated(), ShouldBeFalse)
+
+				teardown()
+			})
+
+			Convey("Should skip the disabled servers and the ones in maintenance", func() {
+				disabled := false
+				mocks := setup(map[string]*mockLDAP{
+					"disabled":    {},
+					"maintenance": {},
+					"active":      {authenticateErr: ldap.ErrInvalidCredentials},
+				})
+				ldap.SetMaintenance("maintenance:0", true)
+
+				multi := New([]*ldap.ServerConfig{
+					{Host: "disabled", Enabled: &disabled},
+					{Host: "maintenance"},
+					{Host: "active"},
+				})
+				err := multi.Login(&models.LoginUserQuery{Username: "user"})
+
+				So(err, ShouldEqual, ldap.ErrInvalidCredentials)
+				So(mocks["disabled"].wasAuthenticated(), ShouldBeFalse)
+				So(mocks["maintenance"].wasAuthenticated(), ShouldBeFalse)
+
+				ldap.SetMaintenance("maintenance:0", false)
+				teardown()
+			})
+
+			Convey("Should fail when all the servers are in maintenance", func() {
+				setup(map[string]*mockLDAP{
+					"maintenance": {},
+				})
+				ldap.SetMaintenance("maintenance:0", true)
+
+				multi := New([]*ldap.ServerConfig{{Host: "maintenance"}})
+				err := multi.Login(&models.LoginUserQuery{Username: "user"})
+
+				So(err, ShouldEqual, ErrNoActiveServers)
+
+				ldap.SetMaintenance("maintenance:0", false)
+				teardown()
+			})
+
+			Convey("Should prefer success over the error of the unavailable server", func() {
+				setup(map[string]*mockLDAP{
+					"first":  {authenticateErr: errors.New("Network error")},
+					"second": {},
+				})
+
+				query := &models.LoginUserQuery{Username: "user"}
+				multi := New([]*ldap.ServerConfig{{Host: "first"}, {Host: "second"}})
+				err := multi.Login(query)
+
+				So(err, ShouldBeNil)
+				So(query.User.Login, ShouldEqual, "second")
+
+				teardown()
+			})
+
+			Convey("Should login against the topmost server with config_order policy", func() {
+				setting.LdapDuplicateUsers = DuplicateUsersConfigOrder
+				mocks := setup(map[string]*mockLDAP{
+					"first":  {},
+					"second": {},
+				})
+
+				query := &models.LoginUserQuery{Username: "user"}
+				multi := New([]*ldap.ServerConfig{{Host: "first"}, {Host: "second"}})
+				err := multi.Login(query)
+
+				So(err, ShouldBeNil)
+				So(query.User.Login, ShouldEqual, "first")
+				So(mocks["second"].getGrafanaUserForCalled, ShouldBeFalse)
+
+				teardown()
+			})
+
+			Convey("Should reject the duplicated user with reject policy", func() {
+				setting.LdapDuplicateUsers = DuplicateUsersReject
+				setup(map[string]*mockLDAP{
+					"first":  {},
+					"second": {},
+				})
+
+				query := &models.LoginUserQuery{Username: "user"}
+				multi := New([]*ldap.ServerConfig{{Host: "first"}, {Host: "second"}})
+				err := multi.Login(query)
+
+				So(err, ShouldEqual, ErrDuplicateUser)
+				So(query.User, ShouldBeNil)
+
+				teardown()
+			})
+
+			Convey("Should not reject the user found on a single server with reject policy", func() {
+				setting.LdapDuplicateUsers = DuplicateUsersReject
+				setup(map[string]*mockLDAP{
+					"first":  {authenticateErr: ldap.ErrCouldNotFindUser},
+					"second": {},
+				})
+
+				query := &models.LoginUserQuery{Username: "user"}
+				multi := New([]*ldap.ServerConfig{{Host: "first"}, {Host: "second"}})
+				err := multi.Login(query)
+
+				So(err, ShouldBeNil)
+				So(query.User.Login, ShouldEqual, "second")
+
+				teardown()
+			})
+		})
+
+		Convey("Login() with server affinity", func() {
+			Convey("Should try the remembered server first", func() {
+				setting.LdapServerAffinityCacheSize = 10
+				setting.LdapServerAffinityTTL = time.Hour
+				mocks := setup(map[string]*mockLDAP{
+					"first":  {},
+					"second": {},
+				})
+				getAffinityCache().set("user", "second:0")
+
+				query := &models.LoginUserQuery{Username: "user"}
+				multi := New([]*ldap.ServerConfig{{Host: "first"}, {Host: "second"}})
+				err := multi.Login(query)
+
+				So(err, ShouldBeNil)
+				So(query.User.Login, ShouldEqual, "second")
+				So(mocks["first"].wasAuthenticated(), ShouldBeFalse)
+
+				teardown()
+			})
+
+			Convey("Should fall back to the other servers when the remembered one doesn't have the user", func() {
+				setting.LdapServerAffinityCacheSize = 10
+				setting.LdapServerAffinityTTL = time.Hour
+				setup(map[string]*mockLDAP{
+					"first":  {},
+					"second": {authenticateErr: ldap.ErrCouldNotFindUser},
+				})
+				getAffinityCache().set("user", "second:0")
+
+				query := &models.LoginUserQuery{Username: "user"}
+				multi := New([]*ldap.ServerConfig{{Host: "first"}, {Host: "second"}})
+				err := multi.Login(query)
+
+				So(err, ShouldBeNil)
+				So(query.User.Login, ShouldEqual, "first")
+
+				key, _ := getAffinityCache().get("user")
+				So(key, ShouldEqual, "first:0")
+
+				teardown()
+			})
+
+			Convey("Should not fall back to the other servers when the remembered one rejects the password", func() {
+				setting.LdapServerAffinityCacheSize = 10
+				setting.LdapServerAffinityTTL = time.Hour
+				mocks := setup(map[string]*mockLDAP{
+					"first":  {},
+					"second": {authenticateErr: ldap.ErrInvalidCredentials},
+				})
+				getAffinityCache().set("user", "second:0")
+
+				query := &models.LoginUserQuery{Username: "user"}
+				multi := New([]*ldap.ServerConfig{{Host: "first"}, {Host: "second"}})
+				err := multi.Login(query)
+
+				So(err, ShouldEqual, ldap.ErrInvalidCredentials)
+				So(query.User, ShouldBeNil)
+				So(mocks["first"].wasAuthenticated(), ShouldBeFalse)
+
+				teardown()
+			})
+
+			Convey("Should remember the server which authenticated the user", func() {
+				setting.LdapServerAffinityCacheSize = 10
+				setting.LdapServerAffinityTTL = time.Hour
+				setup(map[string]*mockLDAP{
+					"first":  {authenticateErr: ldap.ErrCouldNotFindUser},
+					"second": {},
+				})
+
+				multi := New([]*ldap.ServerConfig{{Host: "first"}, {Host: "second"}})
+				err := multi.Login(&models.LoginUserQuery{Username: "user"})
+
+				So(err, ShouldBeNil)
+
+				key, _ := getAffinityCache().get("user")
+				So(key, ShouldEqual, "second:0")
+
+				teardown()
+			})
+		})
+
+		Convey("VerifyPassword()", func() {
+			Convey("Should verify against the server that knows the user", func() {
+				mocks := setup(map[string]*mockLDAP{
+					"first":  {authenticateErr: ldap.ErrCouldNotFindUser},
+					"second": {},
+				})
+
+				multi := New([]*ldap.ServerConfig{{Host: "first"}, {Host: "second"}})
+				err := multi.VerifyPassword("user", "pwd")
+
+				So(err, ShouldBeNil)
+				So(mocks["second"].wasAuthenticated(), ShouldBeTrue)
+				So(mocks["second"].getGrafanaUserForCalled, ShouldBeFalse)
+
+				teardown()
+			})
+
+			Convey("Should report the unavailable servers over invalid credentials", func() {
+				setup(map[string]*mockLDAP{
+					"first":  {authenticateErr: ldap.ErrCouldNotFindUser},
+					"second": {authenticateErr: ldap.ErrServerUnavailable},
+				})
+
+				multi := New([]*ldap.ServerConfig{{Host: "first"}, {Host: "second"}})
+				err := multi.VerifyPassword("user", "pwd")
+
+				So(err, ShouldEqual, ldap.ErrServerUnavailable)
+
+				teardown()
+			})
+
+			Convey("Should stop at the server rejecting the password", func() {
+				mocks := setup(map[string]*mockLDAP{
+					"first":  {authenticateErr: ldap.ErrInvalidCredentials},
+					"second": {},
+				})
+
+				multi := New([]*ldap.ServerConfig{{Host: "first"}, {Host: "second"}})
+				err := multi.VerifyPassword("user", "pwd")
+
+				So(err, ShouldEqual, ldap.ErrInvalidCredentials)
+				So(mocks["second"].wasAuthenticated(), ShouldBeFalse)
+
+				teardown()
+			})
+
+			Convey("Should answer invalid credentials when no server has the user", func() {
+				setup(map[string]*mockLDAP{
+					"first":  {authenticateErr: ldap.ErrCouldNotFindUser},
+					"second": {authenticateErr: ldap.ErrCouldNotFindUser},
+				})
+
+				multi := New([]*ldap.ServerConfig{{Host: "first"}, {Host: "second"}})
+				err := multi.VerifyPassword("user", "pwd")
+
+				So(err, ShouldEqual, ldap.ErrInvalidCredentials)
+
+				teardown()
+			})
+		})
+
+		Convey("User()", func() {
+			Convey("Should return the user of the first server which has it", func() {
+				setup(map[string]*mockLDAP{
+					"first":  {userErr: ldap.ErrCouldNotFindUser},
+					"second": {},
+					"third":  {},
+				})
+
+				multi := New([]*ldap.ServerConfig{{Host: "first"}, {Host: "second"}, {Host: "third"}})
+				user, err := multi.User("user")
+
+				So(err, ShouldBeNil)
+				So(user.Username, ShouldEqual, "second")
+				So(user.Server, ShouldEqual, "second")
+
+				teardown()
+			})
+
+			Convey("Should skip the servers which can't search the users", func() {
+				setup(map[string]*mockLDAP{
+					"first": {},
+				})
+
+				multi := New([]*ldap.ServerConfig{{Host: "first", AuthStrategy: ldap.AuthStrategyDirectBind}})
+				_, err := multi.User("user")
+
+				So(err, ShouldEqual, ldap.ErrInvalidCredentials)
+
+				teardown()
+			})
+
+			Convey("Should return the error of the failing server", func() {
+				expected := errors.New("Network error")
+				setup(map[string]*mockLDAP{
+					"first":  {userErr: expected},
+					"second": {},
+				})
+
+				multi := New([]*ldap.ServerConfig{{Host: "first"}, {Host: "second"}})
+				_, err := multi.User("user")
+
+				So(err, ShouldEqual, expected)
+
+				teardown()
+			})
+		})
+
+		Convey("Users()", func() {
+			Convey("Should return error for absent config list", func() {
+				multi := New([]*ldap.ServerConfig{})
+				_, err := multi.Users()
+
+				So(err, ShouldEqual, ErrNoLDAPServers)
+			})
+
+			Convey("Should merge the users of all servers", func() {
+				setup(map[string]*mockLDAP{
+					"first": {users: []*ldap.UserInfo{
+						{DN: "cn=one,dc=grafana,dc=org"},
+						{DN: "cn=two,dc=grafana,dc=org"},
+					}},
+					"second": {users: []*ldap.UserInfo{
+						{DN: "CN=two,dc=grafana,dc=org"},
+						{DN: "cn=three,dc=grafana,dc=org"},
+					}},
+				})
+
+				multi := New([]*ldap.ServerConfig{{Host: "first"}, {Host: "second"}})
+				users, err := multi.Users()
+
+				So(err, ShouldBeNil)
+				So(users, ShouldHaveLength, 3)
+				So(users[0].DN, ShouldEqual, "cn=one,dc=grafana,dc=org")
+				So(users[0].Server, ShouldEqual, "first")
+				So(users[1].DN, ShouldEqual, "cn=two,dc=grafana,dc=org")
+				So(users[1].Server, ShouldEqual, "first")
+				So(users[2].DN, ShouldEqual, "cn=three,dc=grafana,dc=org")
+				So(users[2].Server, ShouldEqual, "second")
+
+				teardown()
+			})
+
+			Convey("Should return the error of the failing server", func() {
+				expected := errors.New("Network error")
+				setup(map[string]*mockLDAP{
+					"first":  {users: []*ldap.UserInfo{{DN: "cn=one"}}},
+					"second": {usersErr: expected},
+				})
+
+				multi := New([]*ldap.ServerConfig{{Host: "first"}, {Host: "second"}})
+				users, err := multi.Users()
+
+				So(err, ShouldEqual, expected)
+				So(users, ShouldBeNil)
+
+				teardown()
+			})
+
+			Convey("Should return the users of the servers with missing base DNs", func() {
+				setup(map[string]*mockLDAP{
+					"first": {users: []*ldap.UserInfo{{DN: "cn=one,ou=a,dc=grafana,dc=org"}}, usersErr: &ldap.PartialUsersError{
+						Errors: []*ldap.BaseDNError{{Server: "first", BaseDN: "ou=b,dc=grafana,dc=org", Err: ldap.ErrTimeout}},
+					}},
+					"second": {users: []*ldap.UserInfo{{DN: "cn=two,dc=grafana,dc=org"}}},
+				})
+
+				multi := New([]*ldap.ServerConfig{{Host: "first"}, {Host: "second"}})
+				users, err := multi.Users()
+
+				So(users, ShouldHaveLength, 2)
+				partial, ok := ldap.AsPartialUsers(err)
+				So(ok, ShouldBeTrue)
+				So(partial.Errors, ShouldHaveLength, 1)
+				So(partial.Covers("CN=three,OU=b,dc=grafana,dc=org"), ShouldBeTrue)
+				So(partial.Covers("cn=one,ou=a,dc=grafana,dc=org"), ShouldBeFalse)
+
+				teardown()
+			})
+		})
+	})
+}
+
+type mockLDAP struct {
+	ldap.IAuth
+
+	// mutex guards the fields read by the requests which are still
+	// running against the losing servers when Login returns
+	mutex sync.Mutex
+
+	host                    string
+	authenticateCalled      bool
+	authenticateDelay       time.Duration
+	authenticateErr         error
+	getGrafanaUserForErr    error
+	getGrafanaUserForCalled bool
+	verifySecondFactorErr   error
+	closeCalled             bool
+	users                   []*ldap.UserInfo
+	usersErr                error
+	userErr                 error
+}
+
+func (mock *mockLDAP) Authenticate(query *models.LoginUserQuery) (*ldap.UserInfo, error) {
+	time.Sleep(mock.authenticateDelay)
+
+	mock.mutex.Lock()
+	defer mock.mutex.Unlock()
+
+	mock.authenticateCalled = true
+
+	if mock.authenticateErr != nil {
+		return nil, mock.authenticateErr
+	}
+
+	return &ldap.UserInfo{Username: mock.host}, nil
+}
+
+func (mock *mockLDAP) VerifyPassword(username, password string) error {
+	_, err := mock.Authenticate(&models.LoginUserQuery{Username: username, Password: password})
+	return err
+}
+
+func (mock *mockLDAP) GetGrafanaUserFor(ctx *models.ReqContext, user *ldap.UserInfo) (*models.User, error) {
+	mock.mutex.Lock()
+	defer mock.mutex.Unlock()
+
+	mock.getGrafanaUserForCalled = true
+
+	if mock.getGrafanaUserForErr != nil {
+		return nil, mock.getGrafanaUserForErr
+	}
+
+	return &models.User{Login: user.Username}, nil
+}
+
+func (mock *mockLDAP) VerifySecondFactor(query *models.LoginUserQuery, user *ldap.UserInfo, grafanaUser *models.User) error {
+	return mock.verifySecondFactorErr
+}
+
+func (mock *mockLDAP) Users() ([]*ldap.UserInfo, error) {
+	return mock.users, mock.usersErr
+}
+
+func (mock *mockLDAP) UsersPaged(pageSize int, pacer ldap.Pacer) ([]*ldap.UserInfo, error) {
+	return mock.Users()
+}
+
+func (mock *mockLDAP) User(username string) (*ldap.UserInfo, error) {
+	if mock.userErr != nil {
+		return nil, mock.userErr
+	}
+
+	return &ldap.UserInfo{Username: mock.host}, nil
+}
+
+func (mock *mockLDAP) Close() {
+	mock.mutex.Lock()
+	defer mock.mutex.Unlock()
+
+	mock.closeCalled = true
+}
+
+func (mock *mockLDAP) wasAuthenticated() bool {
+	mock.mutex.Lock()
+	defer mock.mutex.Unlock()
+
+	return mock.authenticateCalled
+}
+
+func (mock *mockLDAP) wasGrafanaUserMapped() bool {
+	mock.mutex.Lock()
+	defer mock.mutex.Unlock()
+
+	return mock.getGrafanaUserForCalled
+}
+
+func (mock *mockLDAP) wasCloseCalled() bool {
+	mock.mutex.Lock()
+	defer mock.mutex.Unlock()
+
+	return mock.closeCalled
+}
+
+func setup(mocks map[string]*mockLDAP) map[string]*mockLDAP {
+	for host, mock := range mocks {
+		mock.host = host
+	}
+
+	newLDAP = func(config *ldap.ServerConfig) ldap.IAuth {
+		return mocks[config.Host]
+	}
+
+	return mocks
+}
+
+func teardown() {
+	newLDAP = ldap.New
+	setting.LdapDuplicateUsers = DuplicateUsersFirstAnswer
+	setting.LdapServerAffinityCacheSize = 0
+	affinity = nil
+}
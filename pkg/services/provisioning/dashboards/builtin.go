@@ -0,0 +1,28 @@
+package dashboards
+
+import (
+	"path/filepath"
+
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// builtinConfigs returns the configs of the dashboards shipped with Grafana
+// and provisioned by a setting, like monitoring_dashboard of [auth.ldap]
+func builtinConfigs() []*DashboardsAsConfig {
+	var configs []*DashboardsAsConfig
+
+	if setting.LdapEnabled && setting.LdapMonitoringDashboard {
+		configs = append(configs, &DashboardsAsConfig{
+			Name:                  "ldap-monitoring",
+			Type:                  "file",
+			OrgId:                 1,
+			DisableDeletion:       true,
+			UpdateIntervalSeconds: 10,
+			Options: map[string]interface{}{
+				"path": filepath.Join(setting.StaticRootPath, "dashboards", "ldap"),
+			},
+		})
+	}
+
+	return configs
+}
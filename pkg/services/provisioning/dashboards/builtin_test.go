@@ -0,0 +1,43 @@
+package dashboards
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+func TestBuiltinConfigs(t *testing.T) {
+	Convey("Builtin dashboards", t, func() {
+		defer func(enabled, dashboard bool, static string) {
+			setting.LdapEnabled, setting.LdapMonitoringDashboard, setting.StaticRootPath = enabled, dashboard, static
+		}(setting.LdapEnabled, setting.LdapMonitoringDashboard, setting.StaticRootPath)
+		setting.StaticRootPath = "../../../../public"
+
+		Convey("Should not provision the LDAP dashboard by default", func() {
+			setting.LdapEnabled = true
+			So(builtinConfigs(), ShouldBeEmpty)
+		})
+
+		Convey("Should provision the LDAP dashboard with LDAP enabled", func() {
+			setting.LdapEnabled, setting.LdapMonitoringDashboard = true, true
+
+			configs := builtinConfigs()
+			So(configs, ShouldHaveLength, 1)
+			So(configs[0].DisableDeletion, ShouldBeTrue)
+
+			content, err := ioutil.ReadFile(filepath.Join(configs[0].Options["path"].(string), "ldap.json"))
+			So(err, ShouldBeNil)
+			dashboard, err := simplejson.NewJson(content)
+			So(err, ShouldBeNil)
+			So(dashboard.Get("title").MustString(), ShouldEqual, "LDAP")
+
+			setting.LdapEnabled = false
+			So(builtinConfigs(), ShouldBeEmpty)
+		})
+	})
+}
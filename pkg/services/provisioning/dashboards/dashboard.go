@@ -21,6 +21,7 @@ func NewDashboardProvisionerImpl(configDirectory string) (*DashboardProvisionerI
 	if err != nil {
 		return nil, errutil.Wrap("Failed to read dashboards config", err)
 	}
+	configs = append(configs, builtinConfigs()...)
 
 	fileReaders, err := getFileReaders(configs, logger)
 
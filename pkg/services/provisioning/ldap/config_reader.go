@@ -0,0 +1,80 @@
+package ldap
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	LDAP "github.com/grafana/grafana/pkg/services/ldap"
+)
+
+type configReader struct {
+	log log.Logger
+}
+
+// readConfig merges the servers of the provisioning files in path, in the
+// order of their names. It returns nil if there are no servers
+func (cr *configReader) readConfig(path string) (*LDAP.Config, error) {
+	cr.log.Debug("Looking for LDAP provisioning files", "path", path)
+
+	files, err := ioutil.ReadDir(path)
+	if err != nil {
+		cr.log.Error("Can't read LDAP provisioning files from directory", "path", path, "error", err)
+		return nil, nil
+	}
+
+	// the provisioning files were added with the current schema, they're never migrated
+	config := &LDAP.Config{Version: LDAP.SchemaVersion}
+	for _, file := range files {
+		if strings.HasSuffix(file.Name(), ".yaml") || strings.HasSuffix(file.Name(), ".yml") {
+			cr.log.Debug("Parsing LDAP provisioning file", "path", path, "file.Name", file.Name())
+			servers, err := cr.parseLdapConfig(path, file)
+			if err != nil {
+				return nil, err
+			}
+
+			config.Servers = append(config.Servers, servers...)
+		}
+	}
+
+	if len(config.Servers) == 0 {
+		return nil, nil
+	}
+
+	return config, nil
+}
+
+func (cr *configReader) parseLdapConfig(path string, file os.FileInfo) ([]*LDAP.ServerConfig, error) {
+	filename, _ := filepath.Abs(filepath.Join(path, file.Name()))
+	yamlFile, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var apiVersion *configVersion
+	err = yaml.Unmarshal(yamlFile, &apiVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	if apiVersion == nil {
+		return nil, nil
+	}
+
+	if apiVersion.ApiVersion != 1 {
+		return nil, fmt.Errorf("Unsupported LDAP provisioning apiVersion %d in %s", apiVersion.ApiVersion, filename)
+	}
+
+	v1 := &ldapAsConfigV1{}
+	err = yaml.Unmarshal(yamlFile, v1)
+	if err != nil {
+		return nil, err
+	}
+
+	return v1.mapToServersFromConfig(), nil
+}
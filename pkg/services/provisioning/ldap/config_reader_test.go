@@ -0,0 +1,80 @@
+package ldap
+
+import (
+	"os"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
+	LDAP "github.com/grafana/grafana/pkg/services/ldap"
+)
+
+var (
+	serversConfig = "./testdata/test-configs/servers"
+	twoFiles      = "./testdata/test-configs/two-files"
+	brokenYaml    = "./testdata/test-configs/broken-yaml"
+	invalidConfig = "./testdata/test-configs/invalid"
+	emptyFolder   = "./testdata/test-configs/empty_folder"
+)
+
+func TestLdapAsConfig(t *testing.T) {
+	Convey("Testing LDAP as configuration", t, func() {
+		cr := &configReader{log: log.New("fake.log")}
+
+		Convey("Can read the servers", func() {
+			os.Setenv("LDAP_TEST_BIND_PASSWORD", "bindpwd")
+			defer os.Unsetenv("LDAP_TEST_BIND_PASSWORD")
+
+			config, err := cr.readConfig(serversConfig)
+			So(err, ShouldBeNil)
+			So(config.Servers, ShouldHaveLength, 1)
+
+			server := config.Servers[0]
+			So(server.Enabled, ShouldBeNil)
+			So(server.Host, ShouldEqual, "ldap.corp")
+			So(server.Port, ShouldEqual, 636)
+			So(server.UseSSL, ShouldBeTrue)
+			So(server.BindPassword, ShouldEqual, "bindpwd")
+			So(server.SearchBaseDNs, ShouldResemble, []string{"dc=grafana,dc=org"})
+			So(server.Attr.MemberOf, ShouldEqual, "memberOf")
+
+			So(server.Groups, ShouldHaveLength, 2)
+			So(server.Groups[0].OrgRole, ShouldEqual, models.ROLE_ADMIN)
+			So(*server.Groups[0].IsGrafanaAdmin, ShouldBeTrue)
+			So(server.Groups[1].OrgId, ShouldEqual, 2)
+			So(server.Groups[1].IsGrafanaAdmin, ShouldBeNil)
+		})
+
+		Convey("Merges the servers of every file", func() {
+			config, err := cr.readConfig(twoFiles)
+			So(err, ShouldBeNil)
+			So(config.Servers, ShouldHaveLength, 2)
+			So(config.Servers[0].Host, ShouldEqual, "first.corp")
+			So(config.Servers[1].Host, ShouldEqual, "second.corp")
+			So(*config.Servers[1].Enabled, ShouldBeFalse)
+		})
+
+		Convey("Returns no config without servers", func() {
+			config, err := cr.readConfig(emptyFolder)
+			So(err, ShouldBeNil)
+			So(config, ShouldBeNil)
+
+			config, err = cr.readConfig("./testdata/test-configs/missing")
+			So(err, ShouldBeNil)
+			So(config, ShouldBeNil)
+		})
+
+		Convey("Broken yaml should return error", func() {
+			_, err := cr.readConfig(brokenYaml)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Invalid servers should not be applied", func() {
+			config, err := cr.readConfig(invalidConfig)
+			So(err, ShouldBeNil)
+			So(LDAP.SetProvisionedConfig(config), ShouldNotBeNil)
+		})
+	})
+}
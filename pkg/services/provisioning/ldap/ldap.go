@@ -0,0 +1,19 @@
+package ldap
+
+import (
+	"github.com/grafana/grafana/pkg/infra/log"
+	LDAP "github.com/grafana/grafana/pkg/services/ldap"
+)
+
+// Provision applies the LDAP servers of the provisioning files in configDirectory,
+// they take precedence over the config saved in the database and the config file
+func Provision(configDirectory string) error {
+	cr := &configReader{log: log.New("provisioning.ldap")}
+
+	config, err := cr.readConfig(configDirectory)
+	if err != nil {
+		return err
+	}
+
+	return LDAP.SetProvisionedConfig(config)
+}
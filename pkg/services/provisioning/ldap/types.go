@@ -0,0 +1,272 @@
+package ldap
+
+import (
+	"github.com/grafana/grafana/pkg/models"
+	LDAP "github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/services/provisioning/values"
+)
+
+type configVersion struct {
+	ApiVersion int64 `json:"apiVersion" yaml:"apiVersion"`
+}
+
+// ldapAsConfigV1 is the mapping of the version 1 configs, the keys are the ones of ldap.toml
+type ldapAsConfigV1 struct {
+	Servers []*serverFromConfigV1 `json:"servers" yaml:"servers"`
+}
+
+type serverFromConfigV1 struct {
+	Enabled       *values.BoolValue  `json:"enabled" yaml:"enabled"`
+	Host          values.StringValue `json:"host" yaml:"host"`
+	Port          values.IntValue    `json:"port" yaml:"port"`
+	UseSSL        values.BoolValue   `json:"use_ssl" yaml:"use_ssl"`
+	StartTLS      values.BoolValue   `json:"start_tls" yaml:"start_tls"`
+	SkipVerifySSL values.BoolValue   `json:"ssl_skip_verify" yaml:"ssl_skip_verify"`
+	RootCACert    values.StringValue `json:"root_ca_cert" yaml:"root_ca_cert"`
+	ClientCert    values.StringValue `json:"client_cert" yaml:"client_cert"`
+	ClientKey     values.StringValue `json:"client_key" yaml:"client_key"`
+	BindDN        values.StringValue `json:"bind_dn" yaml:"bind_dn"`
+	BindPassword  values.StringValue `json:"bind_password" yaml:"bind_password"`
+	Attr          attributeMapV1     `json:"attributes" yaml:"attributes"`
+
+	AuthStrategy    values.StringValue `json:"auth_strategy" yaml:"auth_strategy"`
+	BindDNTemplates []string           `json:"bind_dn_templates" yaml:"bind_dn_templates"`
+
+	SearchFilter  values.StringValue `json:"search_filter" yaml:"search_filter"`
+	SearchBaseDNs []string           `json:"search_base_dns" yaml:"search_base_dns"`
+
+	SearchBaseOverrides []*searchBaseOverrideV1 `json:"search_base_overrides" yaml:"search_base_overrides"`
+
+	GroupSearchFilter              values.StringValue `json:"group_search_filter" yaml:"group_search_filter"`
+	GroupSearchFilterUserAttribute values.StringValue `json:"group_search_filter_user_attribute" yaml:"group_search_filter_user_attribute"`
+	GroupSearchBaseDNs             []string           `json:"group_search_base_dns" yaml:"group_search_base_dns"`
+	GroupSearchGroupAttribute      values.StringValue `json:"group_search_group_attribute" yaml:"group_search_group_attribute"`
+
+	Groups []*groupToOrgRoleV1 `json:"group_mappings" yaml:"group_mappings"`
+
+	Domains            []string           `json:"domains" yaml:"domains"`
+	SearchTimeout      values.IntValue    `json:"search_timeout" yaml:"search_timeout"`
+	ProxyURL           values.StringValue `json:"proxy_url" yaml:"proxy_url"`
+	RevocationChecks   []string           `json:"revocation_checks" yaml:"revocation_checks"`
+	RevocationSoftFail values.BoolValue   `json:"revocation_soft_fail" yaml:"revocation_soft_fail"`
+	ChannelBinding     values.BoolValue   `json:"channel_binding" yaml:"channel_binding"`
+	SeparateUserBind   values.BoolValue   `json:"separate_user_bind" yaml:"separate_user_bind"`
+	BusyRetries        values.IntValue    `json:"busy_retries" yaml:"busy_retries"`
+	ClientCertAuth     values.BoolValue   `json:"client_cert_auth" yaml:"client_cert_auth"`
+	HBACService        values.StringValue `json:"hbac_service" yaml:"hbac_service"`
+	HBACHost           values.StringValue `json:"hbac_host" yaml:"hbac_host"`
+	Quirks             []string           `json:"quirks" yaml:"quirks"`
+	Preset             values.StringValue `json:"preset" yaml:"preset"`
+
+	AllowSignUp  *values.BoolValue `json:"allow_sign_up" yaml:"allow_sign_up"`
+	SignUpGroups []string          `json:"sign_up_groups" yaml:"sign_up_groups"`
+
+	AccountRestrictions values.BoolValue `json:"account_restrictions" yaml:"account_restrictions"`
+
+	SecondFactorSeedAttribute values.StringValue `json:"second_factor_seed_attribute" yaml:"second_factor_seed_attribute"`
+
+	PasswordPolicy values.BoolValue `json:"password_policy" yaml:"password_policy"`
+
+	StoredAttributes  values.StringMapValue `json:"stored_attributes" yaml:"stored_attributes"`
+	ManagerAttribute  values.StringValue    `json:"manager_attribute" yaml:"manager_attribute"`
+	ManagerChainDepth values.IntValue       `json:"manager_chain_depth" yaml:"manager_chain_depth"`
+
+	ServiceAccounts []*serviceAccountMappingV1 `json:"service_account_mappings" yaml:"service_account_mappings"`
+
+	RequiredAttributes []string `json:"required_attributes" yaml:"required_attributes"`
+
+	AllowedEmailDomains []string           `json:"allowed_email_domains" yaml:"allowed_email_domains"`
+	EmailDomainMismatch values.StringValue `json:"email_domain_mismatch" yaml:"email_domain_mismatch"`
+
+	LoginNormalization []string           `json:"login_normalization" yaml:"login_normalization"`
+	LoginCollision     values.StringValue `json:"login_collision" yaml:"login_collision"`
+
+	GuidAttribute values.StringValue `json:"guid_attribute" yaml:"guid_attribute"`
+
+	MultipleMatches     values.StringValue `json:"multiple_matches" yaml:"multiple_matches"`
+	PreferredBaseDNs    []string           `json:"preferred_base_dns" yaml:"preferred_base_dns"`
+	ExactMatchAttribute values.StringValue `json:"exact_match_attribute" yaml:"exact_match_attribute"`
+
+	GroupMemberAttribute values.StringValue `json:"group_member_attribute" yaml:"group_member_attribute"`
+
+	AttributeProjection values.StringValue `json:"attribute_projection" yaml:"attribute_projection"`
+
+	GroupSearchFilters []*groupSearchFilterV1 `json:"group_search_filters" yaml:"group_search_filters"`
+	GroupAttr          groupAttributeMapV1    `json:"group_attributes" yaml:"group_attributes"`
+}
+
+type attributeMapV1 struct {
+	Username values.StringValue `json:"username" yaml:"username"`
+	Name     values.StringValue `json:"name" yaml:"name"`
+	Surname  values.StringValue `json:"surname" yaml:"surname"`
+	Email    values.StringValue `json:"email" yaml:"email"`
+	MemberOf values.StringValue `json:"member_of" yaml:"member_of"`
+}
+
+type searchBaseOverrideV1 struct {
+	BaseDN       values.StringValue `json:"base_dn" yaml:"base_dn"`
+	SearchFilter values.StringValue `json:"search_filter" yaml:"search_filter"`
+	Attr         attributeMapV1     `json:"attributes" yaml:"attributes"`
+}
+
+type groupToOrgRoleV1 struct {
+	GroupDN        values.StringValue           `json:"group_dn" yaml:"group_dn"`
+	OrgId          values.Int64Value            `json:"org_id" yaml:"org_id"`
+	IsGrafanaAdmin *values.BoolValue            `json:"grafana_admin" yaml:"grafana_admin"`
+	OrgRole        values.StringValue           `json:"org_role" yaml:"org_role"`
+	SecondFactor   values.BoolValue             `json:"second_factor" yaml:"second_factor"`
+	Quotas         map[string]values.Int64Value `json:"quotas" yaml:"quotas"`
+}
+
+type serviceAccountMappingV1 struct {
+	BaseDN    values.StringValue `json:"base_dn" yaml:"base_dn"`
+	Attribute values.StringValue `json:"attribute" yaml:"attribute"`
+	Value     values.StringValue `json:"value" yaml:"value"`
+	OrgId     values.Int64Value  `json:"org_id" yaml:"org_id"`
+	OrgRole   values.StringValue `json:"org_role" yaml:"org_role"`
+}
+
+type groupAttributeMapV1 struct {
+	Name        values.StringValue `json:"name" yaml:"name"`
+	Description values.StringValue `json:"description" yaml:"description"`
+	GidNumber   values.StringValue `json:"gid_number" yaml:"gid_number"`
+}
+
+type groupSearchFilterV1 struct {
+	Filter        values.StringValue `json:"filter" yaml:"filter"`
+	UserAttribute values.StringValue `json:"user_attribute" yaml:"user_attribute"`
+}
+
+func (cfg *ldapAsConfigV1) mapToServersFromConfig() []*LDAP.ServerConfig {
+	servers := []*LDAP.ServerConfig{}
+
+	for _, server := range cfg.Servers {
+		serverConfig := &LDAP.ServerConfig{
+			Host:          server.Host.Value(),
+			Port:          server.Port.Value(),
+			UseSSL:        server.UseSSL.Value(),
+			StartTLS:      server.StartTLS.Value(),
+			SkipVerifySSL: server.SkipVerifySSL.Value(),
+			RootCACert:    server.RootCACert.Value(),
+			ClientCert:    server.ClientCert.Value(),
+			ClientKey:     server.ClientKey.Value(),
+			BindDN:        server.BindDN.Value(),
+			BindPassword:  server.BindPassword.Value(),
+			Attr: LDAP.AttributeMap{
+				Username: server.Attr.Username.Value(),
+				Name:     server.Attr.Name.Value(),
+				Surname:  server.Attr.Surname.Value(),
+				Email:    server.Attr.Email.Value(),
+				MemberOf: server.Attr.MemberOf.Value(),
+			},
+			SearchFilter:                   server.SearchFilter.Value(),
+			SearchBaseDNs:                  server.SearchBaseDNs,
+			GroupSearchFilter:              server.GroupSearchFilter.Value(),
+			GroupSearchFilterUserAttribute: server.GroupSearchFilterUserAttribute.Value(),
+			GroupSearchBaseDNs:             server.GroupSearchBaseDNs,
+			GroupSearchGroupAttribute:      server.GroupSearchGroupAttribute.Value(),
+			Domains:                        server.Domains,
+			SearchTimeout:                  server.SearchTimeout.Value(),
+			ProxyURL:                       server.ProxyURL.Value(),
+			RevocationChecks:               server.RevocationChecks,
+			RevocationSoftFail:             server.RevocationSoftFail.Value(),
+			ChannelBinding:                 server.ChannelBinding.Value(),
+			SeparateUserBind:               server.SeparateUserBind.Value(),
+			BusyRetries:                    server.BusyRetries.Value(),
+			ClientCertAuth:                 server.ClientCertAuth.Value(),
+			HBACService:                    server.HBACService.Value(),
+			HBACHost:                       server.HBACHost.Value(),
+			Quirks:                         server.Quirks,
+			Preset:                         server.Preset.Value(),
+			AuthStrategy:                   server.AuthStrategy.Value(),
+			BindDNTemplates:                server.BindDNTemplates,
+			SignUpGroups:                   server.SignUpGroups,
+			AccountRestrictions:            server.AccountRestrictions.Value(),
+			SecondFactorSeedAttribute:      server.SecondFactorSeedAttribute.Value(),
+			PasswordPolicy:                 server.PasswordPolicy.Value(),
+			StoredAttributes:               server.StoredAttributes.Value(),
+			ManagerAttribute:               server.ManagerAttribute.Value(),
+			ManagerChainDepth:              server.ManagerChainDepth.Value(),
+			RequiredAttributes:             server.RequiredAttributes,
+			AllowedEmailDomains:            server.AllowedEmailDomains,
+			EmailDomainMismatch:            server.EmailDomainMismatch.Value(),
+			LoginNormalization:             server.LoginNormalization,
+			LoginCollision:                 server.LoginCollision.Value(),
+			GuidAttribute:                  server.GuidAttribute.Value(),
+			MultipleMatches:                server.MultipleMatches.Value(),
+			PreferredBaseDNs:               server.PreferredBaseDNs,
+			ExactMatchAttribute:            server.ExactMatchAttribute.Value(),
+			GroupMemberAttribute:           server.GroupMemberAttribute.Value(),
+			AttributeProjection:            server.AttributeProjection.Value(),
+			GroupAttr: LDAP.GroupAttributeMap{
+				Name:        server.GroupAttr.Name.Value(),
+				Description: server.GroupAttr.Description.Value(),
+				GidNumber:   server.GroupAttr.GidNumber.Value(),
+			},
+		}
+
+		if server.Enabled != nil {
+			enabled := server.Enabled.Value()
+			serverConfig.Enabled = &enabled
+		}
+		if server.AllowSignUp != nil {
+			allowSignUp := server.AllowSignUp.Value()
+			serverConfig.AllowSignUp = &allowSignUp
+		}
+
+		for _, override := range server.SearchBaseOverrides {
+			serverConfig.SearchBaseOverrides = append(serverConfig.SearchBaseOverrides, &LDAP.SearchBaseOverride{
+				BaseDN:       override.BaseDN.Value(),
+				SearchFilter: override.SearchFilter.Value(),
+				Attr: LDAP.AttributeMap{
+					Username: override.Attr.Username.Value(),
+					Name:     override.Attr.Name.Value(),
+					Surname:  override.Attr.Surname.Value(),
+					Email:    override.Attr.Email.Value(),
+					MemberOf: override.Attr.MemberOf.Value(),
+				},
+			})
+		}
+
+		for _, group := range server.Groups {
+			groupConfig := &LDAP.GroupToOrgRole{
+				GroupDN:      group.GroupDN.Value(),
+				OrgId:        group.OrgId.Value(),
+				OrgRole:      models.RoleType(group.OrgRole.Value()),
+				SecondFactor: group.SecondFactor.Value(),
+			}
+			if group.IsGrafanaAdmin != nil {
+				isGrafanaAdmin := group.IsGrafanaAdmin.Value()
+				groupConfig.IsGrafanaAdmin = &isGrafanaAdmin
+			}
+			for target, limit := range group.Quotas {
+				if groupConfig.Quotas == nil {
+					groupConfig.Quotas = map[string]int64{}
+				}
+				groupConfig.Quotas[target] = limit.Value()
+			}
+			serverConfig.Groups = append(serverConfig.Groups, groupConfig)
+		}
+
+		for _, mapping := range server.ServiceAccounts {
+			serverConfig.ServiceAccounts = append(serverConfig.ServiceAccounts, &LDAP.ServiceAccountMapping{
+				BaseDN:    mapping.BaseDN.Value(),
+				Attribute: mapping.Attribute.Value(),
+				Value:     mapping.Value.Value(),
+				OrgId:     mapping.OrgId.Value(),
+				OrgRole:   models.RoleType(mapping.OrgRole.Value()),
+			})
+		}
+
+		for _, filter := range server.GroupSearchFilters {
+			serverConfig.GroupSearchFilters = append(serverConfig.GroupSearchFilters, &LDAP.GroupSearchFilter{
+				Filter:        filter.Filter.Value(),
+				UserAttribute: filter.UserAttribute.Value(),
+			})
+		}
+
+		servers = append(servers, serverConfig)
+	}
+
+	return servers
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/grafana/grafana/pkg/registry"
 	"github.com/grafana/grafana/pkg/services/provisioning/dashboards"
 	"github.com/grafana/grafana/pkg/services/provisioning/datasources"
+	"github.com/grafana/grafana/pkg/services/provisioning/ldap"
 	"github.com/grafana/grafana/pkg/services/provisioning/notifiers"
 	"github.com/grafana/grafana/pkg/setting"
 )
@@ -30,6 +31,7 @@ func init() {
 		},
 		notifiers.Provision,
 		datasources.Provision,
+		ldap.Provision,
 	))
 }
 
@@ -37,12 +39,14 @@ func NewProvisioningServiceImpl(
 	newDashboardProvisioner DashboardProvisionerFactory,
 	provisionNotifiers func(string) error,
 	provisionDatasources func(string) error,
+	provisionLdap func(string) error,
 ) *provisioningServiceImpl {
 	return &provisioningServiceImpl{
 		log:                     log.New("provisioning"),
 		newDashboardProvisioner: newDashboardProvisioner,
 		provisionNotifiers:      provisionNotifiers,
 		provisionDatasources:    provisionDatasources,
+		provisionLdap:           provisionLdap,
 	}
 }
 
@@ -54,6 +58,7 @@ type provisioningServiceImpl struct {
 	dashboardProvisioner    DashboardProvisioner
 	provisionNotifiers      func(string) error
 	provisionDatasources    func(string) error
+	provisionLdap           func(string) error
 	mutex                   sync.Mutex
 }
 
@@ -73,6 +78,11 @@ func (ps *provisioningServiceImpl) Init() error {
 		return err
 	}
 
+	err = ps.ProvisionLdap()
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -112,6 +122,12 @@ func (ps *provisioningServiceImpl) ProvisionNotifications() error {
 	return errutil.Wrap("Alert notification provisioning error", err)
 }
 
+func (ps *provisioningServiceImpl) ProvisionLdap() error {
+	ldapPath := path.Join(ps.Cfg.ProvisioningPath, "ldap")
+	err := ps.provisionLdap(ldapPath)
+	return errutil.Wrap("LDAP provisioning error", err)
+}
+
 func (ps *provisioningServiceImpl) ProvisionDashboards() error {
 	dashboardPath := path.Join(ps.Cfg.ProvisioningPath, "dashboards")
 	dashProvisioner, err := ps.newDashboardProvisioner(dashboardPath)
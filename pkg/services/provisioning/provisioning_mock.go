@@ -4,6 +4,7 @@ type Calls struct {
 	ProvisionDatasources                []interface{}
 	ProvisionNotifications              []interface{}
 	ProvisionDashboards                 []interface{}
+	ProvisionLdap                       []interface{}
 	GetDashboardProvisionerResolvedPath []interface{}
 }
 
@@ -12,6 +13,7 @@ type ProvisioningServiceMock struct {
 	ProvisionDatasourcesFunc                func() error
 	ProvisionNotificationsFunc              func() error
 	ProvisionDashboardsFunc                 func() error
+	ProvisionLdapFunc                       func() error
 	GetDashboardProvisionerResolvedPathFunc func(name string) string
 }
 
@@ -45,6 +47,14 @@ func (mock *ProvisioningServiceMock) ProvisionDashboards() error {
 	return nil
 }
 
+func (mock *ProvisioningServiceMock) ProvisionLdap() error {
+	mock.Calls.ProvisionLdap = append(mock.Calls.ProvisionLdap, nil)
+	if mock.ProvisionLdapFunc != nil {
+		return mock.ProvisionLdapFunc()
+	}
+	return nil
+}
+
 func (mock *ProvisioningServiceMock) GetDashboardProvisionerResolvedPath(name string) string {
 	mock.Calls.GetDashboardProvisionerResolvedPath = append(mock.Calls.GetDashboardProvisionerResolvedPath, name)
 	if mock.GetDashboardProvisionerResolvedPathFunc != nil {
@@ -19,6 +19,9 @@ func (qs *QuotaService) Init() error {
 	return nil
 }
 
+// QuotaReached checks if one of the quotas of the target is reached. Without
+// a request context, like for the logins completing in the background, only
+// the global quotas are checked
 func (qs *QuotaService) QuotaReached(c *m.ReqContext, target string) (bool, error) {
 	if !setting.Quota.Enabled {
 		return false, nil
@@ -31,7 +34,9 @@ func (qs *QuotaService) QuotaReached(c *m.ReqContext, target string) (bool, erro
 	}
 
 	for _, scope := range scopes {
-		c.Logger.Debug("Checking quota", "target", target, "scope", scope)
+		if c != nil {
+			c.Logger.Debug("Checking quota", "target", target, "scope", scope)
+		}
 
 		switch scope.Name {
 		case "global":
@@ -42,6 +47,9 @@ func (qs *QuotaService) QuotaReached(c *m.ReqContext, target string) (bool, erro
 				return true, nil
 			}
 			if target == "session" {
+				if c == nil {
+					continue
+				}
 
 				usedSessions, err := qs.AuthTokenService.ActiveTokenCount(c.Req.Context())
 				if err != nil {
@@ -62,7 +70,7 @@ func (qs *QuotaService) QuotaReached(c *m.ReqContext, target string) (bool, erro
 				return true, nil
 			}
 		case "org":
-			if !c.IsSignedIn {
+			if c == nil || !c.IsSignedIn {
 				continue
 			}
 			query := m.GetOrgQuotaByTargetQuery{OrgId: c.OrgId, Target: scope.Target, Default: scope.DefaultLimit}
@@ -80,7 +88,7 @@ func (qs *QuotaService) QuotaReached(c *m.ReqContext, target string) (bool, erro
 				return true, nil
 			}
 		case "user":
-			if !c.IsSignedIn || c.UserId == 0 {
+			if c == nil || !c.IsSignedIn || c.UserId == 0 {
 				continue
 			}
 			query := m.GetUserQuotaByTargetQuery{UserId: c.UserId, Target: scope.Target, Default: scope.DefaultLimit}
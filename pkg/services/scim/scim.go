@@ -0,0 +1,382 @@
+package scim
+
+import (
+	"encoding/base64"
+	"sort"
+	"strconv"
+	"strings"
+
+	LDAP "gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/registry"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/services/multildap"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// The SCIM schemas of RFC 7643 and RFC 7644
+const (
+	UserSchema                  = "urn:ietf:params:scim:schemas:core:2.0:User"
+	GroupSchema                 = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	ServiceProviderConfigSchema = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	ListResponseSchema          = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	ErrorSchema                 = "urn:ietf:params:scim:api:messages:2.0:Error"
+)
+
+// BasePath is the path of the SCIM endpoints, under the root URL of Grafana
+const BasePath = "api/scim/v2/"
+
+func init() {
+	registry.RegisterService(&SCIMService{})
+}
+
+// SCIMService serves the LDAP users and their groups through the read-only
+// SCIM 2.0 endpoints, for the tools consuming the directory identity
+type SCIMService struct {
+	log          log.Logger
+	getConfig    func() (*ldap.Config, error)
+	newMultiLDAP func(configs []*ldap.ServerConfig) multildap.IMultiLDAP
+}
+
+// Init initializes the service
+func (service *SCIMService) Init() error {
+	service.log = log.New("ldap.scim")
+	service.getConfig = ldap.GetConfig
+	service.newMultiLDAP = multildap.New
+	return nil
+}
+
+// IsDisabled checks if the SCIM endpoints are disabled
+func (service *SCIMService) IsDisabled() bool {
+	return !setting.LdapSCIMEnabled || !ldap.IsEnabled()
+}
+
+// Directory reads the users of the LDAP servers, and their groups, as SCIM resources
+func (service *SCIMService) Directory() (*Directory, error) {
+	config, err := service.getConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	users, err := service.newMultiLDAP(config.Servers).Users()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewDirectory(users), nil
+}
+
+// Meta is the metadata of a resource
+type Meta struct {
+	ResourceType string `json:"resourceType"`
+	Location     string `json:"location"`
+}
+
+// Name is the name of a user
+type Name struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+// Email is an email of a user
+type Email struct {
+	Value   string `json:"value"`
+	Primary bool   `json:"primary"`
+}
+
+// Reference is a group of a user or a member of a group
+type Reference struct {
+	Value   string `json:"value"`
+	Ref     string `json:"$ref"`
+	Display string `json:"display,omitempty"`
+}
+
+// User is the SCIM resource of an LDAP user, externalId being its DN
+type User struct {
+	Schemas     []string    `json:"schemas"`
+	Id          string      `json:"id"`
+	ExternalId  string      `json:"externalId"`
+	UserName    string      `json:"userName"`
+	Name        Name        `json:"name"`
+	DisplayName string      `json:"displayName,omitempty"`
+	Emails      []Email     `json:"emails,omitempty"`
+	Groups      []Reference `json:"groups"`
+	Active      bool        `json:"active"`
+	Meta        Meta        `json:"meta"`
+}
+
+// Group is the SCIM resource of an LDAP group, externalId being its DN
+type Group struct {
+	Schemas     []string    `json:"schemas"`
+	Id          string      `json:"id"`
+	ExternalId  string      `json:"externalId"`
+	DisplayName string      `json:"displayName"`
+	Members     []Reference `json:"members"`
+	Meta        Meta        `json:"meta"`
+}
+
+// ListResponse is a page of the users or groups matching a filter
+type ListResponse struct {
+	Schemas      []string      `json:"schemas"`
+	TotalResults int           `json:"totalResults"`
+	StartIndex   int           `json:"startIndex"`
+	ItemsPerPage int           `json:"itemsPerPage"`
+	Resources    []interface{} `json:"Resources"`
+}
+
+// Error is the SCIM error response
+type Error struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail"`
+}
+
+func (err *Error) Error() string {
+	return err.Detail
+}
+
+// Directory holds the users and the groups of the LDAP servers
+type Directory struct {
+	Users  []*User
+	Groups []*Group
+}
+
+// location is the URL of the resource
+func location(resourceType string, id string) string {
+	return setting.AppUrl + BasePath + resourceType + "s/" + id
+}
+
+// ResourceID is the id of the resource of a DN, the DNs can't be used as they are in URLs
+func ResourceID(dn string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strings.ToLower(dn)))
+}
+
+// groupName is the value of the first RDN of the group, or the group itself
+// if it's not a DN, like the group names of a group_search_filter
+func groupName(group string) string {
+	dn, err := LDAP.ParseDN(group)
+	if err != nil || len(dn.RDNs) == 0 || len(dn.RDNs[0].Attributes) == 0 {
+		return group
+	}
+	return dn.RDNs[0].Attributes[0].Value
+}
+
+// NewDirectory builds the SCIM resources of the users, the groups being the memberOf of the users
+func NewDirectory(users []*ldap.UserInfo) *Directory {
+	directory := &Directory{Users: []*User{}, Groups: []*Group{}}
+	groups := map[string]*Group{}
+
+	for _, info := range users {
+		user := &User{
+			Schemas:    []string{UserSchema},
+			Id:         ResourceID(info.DN),
+			ExternalId: info.DN,
+			UserName:   info.Username,
+			Name: Name{
+				Formatted:  strings.TrimSpace(info.FirstName + " " + info.LastName),
+				GivenName:  info.FirstName,
+				FamilyName: info.LastName,
+			},
+			DisplayName: strings.TrimSpace(info.FirstName + " " + info.LastName),
+			Groups:      []Reference{},
+			Active:      true,
+			Meta:        Meta{ResourceType: "User", Location: location("User", ResourceID(info.DN))},
+		}
+		if info.Email != "" {
+			user.Emails = []Email{{Value: info.Email, Primary: true}}
+		}
+
+		for _, memberOf := range info.MemberOf {
+			id := ResourceID(memberOf)
+			group, ok := groups[id]
+			if !ok {
+				group = &Group{
+					Schemas:     []string{GroupSchema},
+					Id:          id,
+					ExternalId:  memberOf,
+					DisplayName: groupName(memberOf),
+					Members:     []Reference{},
+					Meta:        Meta{ResourceType: "Group", Location: location("Group", id)},
+				}
+				groups[id] = group
+				directory.Groups = append(directory.Groups, group)
+			}
+
+			group.Members = append(group.Members, Reference{Value: user.Id, Ref: user.Meta.Location, Display: user.UserName})
+			user.Groups = append(user.Groups, Reference{Value: group.Id, Ref: group.Meta.Location, Display: group.DisplayName})
+		}
+
+		directory.Users = append(directory.Users, user)
+	}
+
+	sort.Slice(directory.Groups, func(i, j int) bool {
+		return directory.Groups[i].DisplayName < directory.Groups[j].DisplayName
+	})
+
+	return directory
+}
+
+// User returns the user of the id, nil if there is none
+func (directory *Directory) User(id string) *User {
+	for _, user := range directory.Users {
+		if user.Id == id {
+			return user
+		}
+	}
+	return nil
+}
+
+// Group returns the group of the id, nil if there is none
+func (directory *Directory) Group(id string) *Group {
+	for _, group := range directory.Groups {
+		if group.Id == id {
+			return group
+		}
+	}
+	return nil
+}
+
+// ListUsers returns the page of the users matching the filter, startIndex starting at 1
+func (directory *Directory) ListUsers(filter string, startIndex int, count int) (*ListResponse, error) {
+	match, err := parseFilter(filter, map[string]func(interface{}) []string{
+		"id":         func(r interface{}) []string { return []string{r.(*User).Id} },
+		"externalid": func(r interface{}) []string { return []string{r.(*User).ExternalId} },
+		"username":   func(r interface{}) []string { return []string{r.(*User).UserName} },
+		"emails.value": func(r interface{}) []string {
+			emails := []string{}
+			for _, email := range r.(*User).Emails {
+				emails = append(emails, email.Value)
+			}
+			return emails
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resources := []interface{}{}
+	for _, user := range directory.Users {
+		if match(user) {
+			resources = append(resources, user)
+		}
+	}
+
+	return page(resources, startIndex, count), nil
+}
+
+// ListGroups returns the page of the groups matching the filter, startIndex starting at 1
+func (directory *Directory) ListGroups(filter string, startIndex int, count int) (*ListResponse, error) {
+	match, err := parseFilter(filter, map[string]func(interface{}) []string{
+		"id":          func(r interface{}) []string { return []string{r.(*Group).Id} },
+		"externalid":  func(r interface{}) []string { return []string{r.(*Group).ExternalId} },
+		"displayname": func(r interface{}) []string { return []string{r.(*Group).DisplayName} },
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resources := []interface{}{}
+	for _, group := range directory.Groups {
+		if match(group) {
+			resources = append(resources, group)
+		}
+	}
+
+	return page(resources, startIndex, count), nil
+}
+
+// page returns the count resources from startIndex, count 0 being all of
+// them, at most max_results of [auth.ldap]
+func page(resources []interface{}, startIndex int, count int) *ListResponse {
+	if startIndex < 1 {
+		startIndex = 1
+	}
+	if max := setting.LdapMaxResults; max > 0 && (count <= 0 || count > max) {
+		count = max
+	}
+
+	pageResources := []interface{}{}
+	if startIndex <= len(resources) {
+		pageResources = resources[startIndex-1:]
+	}
+	if count > 0 && count < len(pageResources) {
+		pageResources = pageResources[:count]
+	}
+
+	return &ListResponse{
+		Schemas:      []string{ListResponseSchema},
+		TotalResults: len(resources),
+		StartIndex:   startIndex,
+		ItemsPerPage: len(pageResources),
+		Resources:    pageResources,
+	}
+}
+
+// parseFilter parses the `attribute eq "value"` filters, the only ones
+// the provisioning clients need to find a resource. The attribute
+// names and the values are case-insensitive
+func parseFilter(filter string, attributes map[string]func(interface{}) []string) (func(interface{}) bool, error) {
+	filter = strings.TrimSpace(filter)
+	if filter == "" {
+		return func(interface{}) bool { return true }, nil
+	}
+
+	parts := strings.SplitN(filter, " ", 3)
+	if len(parts) != 3 || !strings.EqualFold(parts[1], "eq") {
+		return nil, NewError(400, "invalidFilter", "Only the eq filters are supported")
+	}
+
+	values, ok := attributes[strings.ToLower(parts[0])]
+	if !ok {
+		return nil, NewError(400, "invalidFilter", "Unsupported filter attribute "+parts[0])
+	}
+
+	value := strings.TrimSpace(parts[2])
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return nil, NewError(400, "invalidFilter", "The filter value must be a string")
+	}
+	value = strings.Replace(value[1:len(value)-1], `\"`, `"`, -1)
+
+	return func(resource interface{}) bool {
+		for _, v := range values(resource) {
+			if strings.EqualFold(v, value) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// NewError returns the SCIM error of the status
+func NewError(status int, scimType string, detail string) *Error {
+	return &Error{
+		Schemas:  []string{ErrorSchema},
+		Status:   strconv.Itoa(status),
+		ScimType: scimType,
+		Detail:   detail,
+	}
+}
+
+// ServiceProviderConfig tells the clients the endpoints are read-only and filterable
+func ServiceProviderConfig() map[string]interface{} {
+	unsupported := map[string]interface{}{"supported": false}
+
+	return map[string]interface{}{
+		"schemas":        []string{ServiceProviderConfigSchema},
+		"patch":          unsupported,
+		"bulk":           map[string]interface{}{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         map[string]interface{}{"supported": true, "maxResults": setting.LdapMaxResults},
+		"changePassword": unsupported,
+		"sort":           unsupported,
+		"etag":           unsupported,
+		"authenticationSchemes": []map[string]interface{}{{
+			"type":        "httpbasic",
+			"name":        "HTTP Basic",
+			"description": "The credentials of a Grafana server admin",
+		}},
+		"meta": Meta{ResourceType: "ServiceProviderConfig", Location: setting.AppUrl + BasePath + "ServiceProviderConfig"},
+	}
+}
@@ -0,0 +1,154 @@
+package scim
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/services/multildap"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+type mockMultiLDAP struct {
+	multildap.IMultiLDAP
+	users []*ldap.UserInfo
+}
+
+func (multiLDAP *mockMultiLDAP) Users() ([]*ldap.UserInfo, error) {
+	return multiLDAP.users, nil
+}
+
+func TestSCIM(t *testing.T) {
+	users := []*ldap.UserInfo{
+		{
+			DN:        "uid=roel,ou=users,dc=grafana,dc=org",
+			Username:  "roel",
+			FirstName: "Roel",
+			LastName:  "Gerrits",
+			Email:     "roel@grafana.org",
+			MemberOf: []string{
+				"cn=editors,ou=groups,dc=grafana,dc=org",
+				"cn=admins,ou=groups,dc=grafana,dc=org",
+			},
+		},
+		{
+			DN:       "uid=tod,ou=users,dc=grafana,dc=org",
+			Username: "tod",
+			MemberOf: []string{"CN=Editors,OU=groups,DC=grafana,DC=org"},
+		},
+	}
+
+	Convey("NewDirectory", t, func() {
+		directory := NewDirectory(users)
+
+		So(directory.Users, ShouldHaveLength, 2)
+		roel := directory.Users[0]
+		So(roel.Id, ShouldEqual, ResourceID("uid=roel,ou=users,dc=grafana,dc=org"))
+		So(roel.ExternalId, ShouldEqual, "uid=roel,ou=users,dc=grafana,dc=org")
+		So(roel.UserName, ShouldEqual, "roel")
+		So(roel.DisplayName, ShouldEqual, "Roel Gerrits")
+		So(roel.Emails, ShouldResemble, []Email{{Value: "roel@grafana.org", Primary: true}})
+		So(roel.Groups, ShouldHaveLength, 2)
+		So(directory.Users[1].Emails, ShouldBeNil)
+
+		Convey("Should group the members of the same DN, whatever its case", func() {
+			So(directory.Groups, ShouldHaveLength, 2)
+			So(directory.Groups[0].DisplayName, ShouldEqual, "admins")
+			So(directory.Groups[1].DisplayName, ShouldEqual, "editors")
+			So(directory.Groups[1].Members, ShouldHaveLength, 2)
+			So(directory.Groups[1].Members[1].Value, ShouldEqual, directory.Users[1].Id)
+		})
+
+		Convey("Should find the resources by id", func() {
+			So(directory.User(roel.Id), ShouldEqual, roel)
+			So(directory.User("unknown"), ShouldBeNil)
+			So(directory.Group(roel.Groups[0].Value).DisplayName, ShouldEqual, "editors")
+			So(directory.Group("unknown"), ShouldBeNil)
+		})
+	})
+
+	Convey("Directory", t, func() {
+		var servers []*ldap.ServerConfig
+		service := &SCIMService{
+			getConfig: func() (*ldap.Config, error) {
+				return &ldap.Config{Servers: []*ldap.ServerConfig{{Host: "ldap.grafana.org"}}}, nil
+			},
+			newMultiLDAP: func(configs []*ldap.ServerConfig) multildap.IMultiLDAP {
+				servers = configs
+				return &mockMultiLDAP{users: users}
+			},
+		}
+
+		directory, err := service.Directory()
+		So(err, ShouldBeNil)
+		So(directory.Users, ShouldHaveLength, 2)
+		So(servers[0].Host, ShouldEqual, "ldap.grafana.org")
+	})
+
+	Convey("ListUsers", t, func() {
+		directory := NewDirectory(users)
+
+		Convey("Should filter on the userName", func() {
+			list, err := directory.ListUsers(`userName eq "ROEL"`, 0, 0)
+			So(err, ShouldBeNil)
+			So(list.TotalResults, ShouldEqual, 1)
+			So(list.Resources[0].(*User).UserName, ShouldEqual, "roel")
+		})
+
+		Convey("Should filter on the emails", func() {
+			list, err := directory.ListUsers(`emails.value eq "roel@grafana.org"`, 0, 0)
+			So(err, ShouldBeNil)
+			So(list.TotalResults, ShouldEqual, 1)
+		})
+
+		Convey("Should page the users", func() {
+			list, err := directory.ListUsers("", 2, 1)
+			So(err, ShouldBeNil)
+			So(list.TotalResults, ShouldEqual, 2)
+			So(list.StartIndex, ShouldEqual, 2)
+			So(list.ItemsPerPage, ShouldEqual, 1)
+			So(list.Resources[0].(*User).UserName, ShouldEqual, "tod")
+
+			list, err = directory.ListUsers("", 3, 0)
+			So(err, ShouldBeNil)
+			So(list.Resources, ShouldBeEmpty)
+		})
+
+		Convey("Should cap the pages to max_results", func() {
+			defer func(max int) { setting.LdapMaxResults = max }(setting.LdapMaxResults)
+			setting.LdapMaxResults = 1
+
+			list, err := directory.ListUsers("", 0, 0)
+			So(err, ShouldBeNil)
+			So(list.TotalResults, ShouldEqual, 2)
+			So(list.ItemsPerPage, ShouldEqual, 1)
+
+			list, err = directory.ListUsers("", 0, 5)
+			So(err, ShouldBeNil)
+			So(list.ItemsPerPage, ShouldEqual, 1)
+		})
+
+		Convey("Should refuse the unsupported filters", func() {
+			_, err := directory.ListUsers(`userName sw "ro"`, 0, 0)
+			So(err, ShouldNotBeNil)
+			So(err.(*Error).ScimType, ShouldEqual, "invalidFilter")
+			So(err.(*Error).Status, ShouldEqual, "400")
+
+			_, err = directory.ListUsers(`title eq "boss"`, 0, 0)
+			So(err, ShouldNotBeNil)
+
+			_, err = directory.ListUsers(`userName eq roel`, 0, 0)
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("ListGroups", t, func() {
+		directory := NewDirectory(users)
+
+		list, err := directory.ListGroups(`displayName eq "editors"`, 0, 0)
+		So(err, ShouldBeNil)
+		So(list.TotalResults, ShouldEqual, 1)
+		So(list.Resources[0].(*Group).Members, ShouldHaveLength, 2)
+	})
+}
@@ -14,6 +14,7 @@ func init() {
 	bus.AddHandler("sql", GetApiKeyByName)
 	bus.AddHandlerCtx("sql", DeleteApiKeyCtx)
 	bus.AddHandler("sql", AddApiKey)
+	bus.AddHandler("sql", DeleteUserApiKeys)
 }
 
 func GetApiKeys(query *m.GetApiKeysQuery) error {
@@ -31,6 +32,17 @@ func DeleteApiKeyCtx(ctx context.Context, cmd *m.DeleteApiKeyCommand) error {
 	})
 }
 
+func DeleteUserApiKeys(cmd *m.DeleteUserApiKeysCommand) error {
+	return inTransaction(func(sess *DBSession) error {
+		res, err := sess.Exec("DELETE FROM api_key WHERE created_by=?", cmd.UserId)
+		if err != nil {
+			return err
+		}
+		cmd.DeletedRows, err = res.RowsAffected()
+		return err
+	})
+}
+
 func AddApiKey(cmd *m.AddApiKeyCommand) error {
 	return inTransaction(func(sess *DBSession) error {
 		t := m.ApiKey{
@@ -40,6 +52,8 @@ func AddApiKey(cmd *m.AddApiKeyCommand) error {
 			Key:     cmd.Key,
 			Created: time.Now(),
 			Updated: time.Now(),
+
+			CreatedBy: cmd.CreatedBy,
 		}
 
 		if _, err := sess.Insert(&t); err != nil {
@@ -27,5 +27,27 @@ func TestApiKeyDataAccess(t *testing.T) {
 			})
 
 		})
+
+		Convey("Given the api keys of a user", func() {
+			for _, cmd := range []*m.AddApiKeyCommand{
+				{OrgId: 1, Name: "first", Key: "first", CreatedBy: 2},
+				{OrgId: 2, Name: "second", Key: "second", CreatedBy: 2},
+				{OrgId: 1, Name: "other", Key: "other", CreatedBy: 3},
+			} {
+				So(AddApiKey(cmd), ShouldBeNil)
+			}
+
+			Convey("Should delete the keys of the user in all the orgs", func() {
+				cmd := m.DeleteUserApiKeysCommand{UserId: 2}
+				So(DeleteUserApiKeys(&cmd), ShouldBeNil)
+				So(cmd.DeletedRows, ShouldEqual, 2)
+
+				query := m.GetApiKeysQuery{OrgId: 1}
+				So(GetApiKeys(&query), ShouldBeNil)
+				So(query.Result, ShouldHaveLength, 1)
+				So(query.Result[0].Name, ShouldEqual, "other")
+				So(query.Result[0].CreatedBy, ShouldEqual, 3)
+			})
+		})
 	})
 }
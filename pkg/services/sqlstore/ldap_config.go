@@ -0,0 +1,87 @@
+package sqlstore
+
+import (
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	m "github.com/grafana/grafana/pkg/models"
+)
+
+func init() {
+	bus.AddHandler("sql", GetLdapConfig)
+	bus.AddHandler("sql", SaveLdapConfig)
+	bus.AddHandler("sql", DeleteLdapConfig)
+	bus.AddHandler("sql", GetLdapLoginState)
+	bus.AddHandler("sql", SetLdapLoginState)
+}
+
+func GetLdapConfig(query *m.GetLdapConfigQuery) error {
+	config := &m.LdapConfig{}
+	has, err := x.Desc("id").Get(config)
+	if err != nil {
+		return err
+	}
+	if !has {
+		return m.ErrLdapConfigNotFound
+	}
+
+	query.Result = config
+	return nil
+}
+
+// SaveLdapConfig replaces the saved LDAP config, there is only one
+func SaveLdapConfig(cmd *m.SaveLdapConfigCommand) error {
+	return inTransaction(func(sess *DBSession) error {
+		if _, err := sess.Exec("DELETE FROM ldap_config"); err != nil {
+			return err
+		}
+
+		config := &m.LdapConfig{
+			Config:    cmd.Config,
+			Updated:   time.Now(),
+			UpdatedBy: cmd.UserId,
+		}
+
+		_, err := sess.Insert(config)
+		return err
+	})
+}
+
+func DeleteLdapConfig(cmd *m.DeleteLdapConfigCommand) error {
+	return inTransaction(func(sess *DBSession) error {
+		_, err := sess.Exec("DELETE FROM ldap_config")
+		return err
+	})
+}
+
+func GetLdapLoginState(query *m.GetLdapLoginStateQuery) error {
+	state := &m.LdapLoginState{}
+	has, err := x.Desc("id").Get(state)
+	if err != nil {
+		return err
+	}
+	if !has {
+		return m.ErrLdapLoginStateNotFound
+	}
+
+	query.Result = state
+	return nil
+}
+
+// SetLdapLoginState replaces the saved LDAP login state, there is only one
+func SetLdapLoginState(cmd *m.SetLdapLoginStateCommand) error {
+	return inTransaction(func(sess *DBSession) error {
+		if _, err := sess.Exec("DELETE FROM ldap_login_state"); err != nil {
+			return err
+		}
+
+		state := &m.LdapLoginState{
+			Enabled:   cmd.Enabled,
+			Updated:   time.Now(),
+			UpdatedBy: cmd.UserId,
+		}
+
+		_, err := sess.Insert(state)
+		return err
+	})
+}
@@ -0,0 +1,52 @@
+package sqlstore
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	m "github.com/grafana/grafana/pkg/models"
+)
+
+func TestLdapConfig(t *testing.T) {
+	Convey("Testing LDAP config DB Access", t, func() {
+		InitTestDB(t)
+
+		Convey("Should not find a config before it's saved", func() {
+			So(GetLdapConfig(&m.GetLdapConfigQuery{}), ShouldEqual, m.ErrLdapConfigNotFound)
+		})
+
+		Convey("Should replace the saved config", func() {
+			err := SaveLdapConfig(&m.SaveLdapConfigCommand{Config: []byte("first"), UserId: 1})
+			So(err, ShouldBeNil)
+			err = SaveLdapConfig(&m.SaveLdapConfigCommand{Config: []byte("second"), UserId: 2})
+			So(err, ShouldBeNil)
+
+			query := &m.GetLdapConfigQuery{}
+			So(GetLdapConfig(query), ShouldBeNil)
+			So(string(query.Result.Config), ShouldEqual, "second")
+			So(query.Result.UpdatedBy, ShouldEqual, 2)
+
+			Convey("Should delete it", func() {
+				So(DeleteLdapConfig(&m.DeleteLdapConfigCommand{}), ShouldBeNil)
+				So(GetLdapConfig(&m.GetLdapConfigQuery{}), ShouldEqual, m.ErrLdapConfigNotFound)
+			})
+		})
+
+		Convey("Should not find a login state before it's set", func() {
+			So(GetLdapLoginState(&m.GetLdapLoginStateQuery{}), ShouldEqual, m.ErrLdapLoginStateNotFound)
+		})
+
+		Convey("Should replace the login state", func() {
+			err := SetLdapLoginState(&m.SetLdapLoginStateCommand{Enabled: false, UserId: 1})
+			So(err, ShouldBeNil)
+			err = SetLdapLoginState(&m.SetLdapLoginStateCommand{Enabled: true, UserId: 2})
+			So(err, ShouldBeNil)
+
+			query := &m.GetLdapLoginStateQuery{}
+			So(GetLdapLoginState(query), ShouldBeNil)
+			So(query.Result.Enabled, ShouldBeTrue)
+			So(query.Result.UpdatedBy, ShouldEqual, 2)
+		})
+	})
+}
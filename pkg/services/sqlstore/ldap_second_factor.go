@@ -0,0 +1,87 @@
+package sqlstore
+
+import (
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	m "github.com/grafana/grafana/pkg/models"
+)
+
+func init() {
+	bus.AddHandler("sql", GetLdapSecondFactor)
+	bus.AddHandler("sql", SaveLdapSecondFactor)
+	bus.AddHandler("sql", DeleteLdapSecondFactor)
+	bus.AddHandler("sql", AcceptLdapSecondFactorCounter)
+}
+
+func GetLdapSecondFactor(query *m.GetLdapSecondFactorQuery) error {
+	secondFactor := &m.LdapSecondFactor{}
+	has, err := x.Where("user_id=?", query.UserId).Get(secondFactor)
+	if err != nil {
+		return err
+	}
+	if !has {
+		return m.ErrLdapSecondFactorNotFound
+	}
+
+	query.Result = secondFactor
+	return nil
+}
+
+// SaveLdapSecondFactor replaces the second factor enrolled for the user
+func SaveLdapSecondFactor(cmd *m.SaveLdapSecondFactorCommand) error {
+	return inTransaction(func(sess *DBSession) error {
+		if _, err := sess.Exec("DELETE FROM ldap_second_factor WHERE user_id=?", cmd.UserId); err != nil {
+			return err
+		}
+
+		secondFactor := &m.LdapSecondFactor{
+			UserId:  cmd.UserId,
+			Secret:  cmd.Secret,
+			Created: time.Now(),
+		}
+
+		_, err := sess.Insert(secondFactor)
+		return err
+	})
+}
+
+func DeleteLdapSecondFactor(cmd *m.DeleteLdapSecondFactorCommand) error {
+	return inTransaction(func(sess *DBSession) error {
+		_, err := sess.Exec("DELETE FROM ldap_second_factor WHERE user_id=?", cmd.UserId)
+		return err
+	})
+}
+
+// AcceptLdapSecondFactorCounter moves the counter of the user forward, the
+// update only matching the counters before it so that the concurrent
+// logins with the same code accept it once
+func AcceptLdapSecondFactorCounter(cmd *m.AcceptLdapSecondFactorCounterCommand) error {
+	return inTransaction(func(sess *DBSession) error {
+		result, err := sess.Exec("UPDATE ldap_second_factor_counter SET counter=?, updated=? WHERE user_id=? AND counter<?",
+			cmd.Counter, time.Now(), cmd.UserId, cmd.Counter)
+		if err != nil {
+			return err
+		}
+		updated, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if updated > 0 {
+			cmd.Accepted = true
+			return nil
+		}
+
+		// the counter isn't past the last one, or it's the first code of the user
+		has, err := sess.Where("user_id=?", cmd.UserId).Exist(&m.LdapSecondFactorCounter{})
+		if err != nil || has {
+			return err
+		}
+
+		if _, err := sess.Insert(&m.LdapSecondFactorCounter{UserId: cmd.UserId, Counter: cmd.Counter, Updated: time.Now()}); err != nil {
+			return err
+		}
+		cmd.Accepted = true
+		return nil
+	})
+}
@@ -0,0 +1,49 @@
+package sqlstore
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	m "github.com/grafana/grafana/pkg/models"
+)
+
+func TestLdapSecondFactor(t *testing.T) {
+	Convey("Testing LDAP second factor DB Access", t, func() {
+		InitTestDB(t)
+
+		Convey("Should not find a second factor before it's enrolled", func() {
+			So(GetLdapSecondFactor(&m.GetLdapSecondFactorQuery{UserId: 1}), ShouldEqual, m.ErrLdapSecondFactorNotFound)
+		})
+
+		Convey("Should replace the second factor of the user only", func() {
+			So(SaveLdapSecondFactor(&m.SaveLdapSecondFactorCommand{UserId: 1, Secret: []byte("first")}), ShouldBeNil)
+			So(SaveLdapSecondFactor(&m.SaveLdapSecondFactorCommand{UserId: 1, Secret: []byte("second")}), ShouldBeNil)
+			So(SaveLdapSecondFactor(&m.SaveLdapSecondFactorCommand{UserId: 2, Secret: []byte("other")}), ShouldBeNil)
+
+			query := &m.GetLdapSecondFactorQuery{UserId: 1}
+			So(GetLdapSecondFactor(query), ShouldBeNil)
+			So(string(query.Result.Secret), ShouldEqual, "second")
+
+			Convey("Should delete it", func() {
+				So(DeleteLdapSecondFactor(&m.DeleteLdapSecondFactorCommand{UserId: 1}), ShouldBeNil)
+				So(GetLdapSecondFactor(&m.GetLdapSecondFactorQuery{UserId: 1}), ShouldEqual, m.ErrLdapSecondFactorNotFound)
+				So(GetLdapSecondFactor(&m.GetLdapSecondFactorQuery{UserId: 2}), ShouldBeNil)
+			})
+		})
+
+		Convey("Should accept the counters past the last one of the user only", func() {
+			accept := func(userID, counter int64) bool {
+				cmd := &m.AcceptLdapSecondFactorCounterCommand{UserId: userID, Counter: counter}
+				So(AcceptLdapSecondFactorCounter(cmd), ShouldBeNil)
+				return cmd.Accepted
+			}
+
+			So(accept(1, 100), ShouldBeTrue)
+			So(accept(1, 100), ShouldBeFalse)
+			So(accept(1, 99), ShouldBeFalse)
+			So(accept(2, 100), ShouldBeTrue)
+			So(accept(1, 101), ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,59 @@
+package sqlstore
+
+import (
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	m "github.com/grafana/grafana/pkg/models"
+)
+
+func init() {
+	bus.AddHandler("sql", GetLdapSyncJob)
+	bus.AddHandler("sql", SaveLdapSyncJob)
+	bus.AddHandler("sql", AddLdapSyncReportEntries)
+	bus.AddHandler("sql", GetLdapSyncReport)
+}
+
+func GetLdapSyncJob(query *m.GetLdapSyncJobQuery) error {
+	job := &m.LdapSyncJob{Id: query.Id}
+	has, err := x.Desc("id").Get(job)
+	if err != nil {
+		return err
+	}
+	if !has {
+		return m.ErrLdapSyncJobNotFound
+	}
+
+	query.Result = job
+	return nil
+}
+
+func SaveLdapSyncJob(cmd *m.SaveLdapSyncJobCommand) error {
+	return inTransaction(func(sess *DBSession) error {
+		cmd.Job.Updated = time.Now()
+
+		if cmd.Job.Id == 0 {
+			_, err := sess.Insert(cmd.Job)
+			return err
+		}
+
+		_, err := sess.ID(cmd.Job.Id).AllCols().Update(cmd.Job)
+		return err
+	})
+}
+
+func AddLdapSyncReportEntries(cmd *m.AddLdapSyncReportEntriesCommand) error {
+	if len(cmd.Entries) == 0 {
+		return nil
+	}
+
+	return inTransaction(func(sess *DBSession) error {
+		_, err := sess.Insert(&cmd.Entries)
+		return err
+	})
+}
+
+func GetLdapSyncReport(query *m.GetLdapSyncReportQuery) error {
+	query.Result = make([]*m.LdapSyncReportEntry, 0)
+	return x.Where("job_id=?", query.JobId).Asc("id").Find(&query.Result)
+}
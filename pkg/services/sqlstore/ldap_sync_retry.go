@@ -0,0 +1,84 @@
+package sqlstore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	m "github.com/grafana/grafana/pkg/models"
+)
+
+func init() {
+	bus.AddHandler("sql", GetLdapSyncRetry)
+	bus.AddHandler("sql", GetLdapSyncRetries)
+	bus.AddHandler("sql", SaveLdapSyncRetry)
+	bus.AddHandler("sql", DeleteLdapSyncRetry)
+	bus.AddHandler("sql", DeleteLdapSyncRetries)
+}
+
+func GetLdapSyncRetry(query *m.GetLdapSyncRetryQuery) error {
+	retry := &m.LdapSyncRetry{}
+	has, err := x.Where("server=? AND dn_hash=?", query.Server, ldapSyncRetryDnHash(query.Dn)).Get(retry)
+	if err != nil {
+		return err
+	}
+	if !has {
+		return m.ErrLdapSyncRetryNotFound
+	}
+
+	query.Result = retry
+	return nil
+}
+
+func GetLdapSyncRetries(query *m.GetLdapSyncRetriesQuery) error {
+	query.Result = make([]*m.LdapSyncRetry, 0)
+	sess := x.Asc("next_attempt", "id")
+	if !query.DueBy.IsZero() {
+		sess = sess.Where("next_attempt<=?", query.DueBy)
+	}
+	return sess.Find(&query.Result)
+}
+
+func SaveLdapSyncRetry(cmd *m.SaveLdapSyncRetryCommand) error {
+	return inTransaction(func(sess *DBSession) error {
+		cmd.Retry.Dn = strings.ToLower(cmd.Retry.Dn)
+		cmd.Retry.DnHash = ldapSyncRetryDnHash(cmd.Retry.Dn)
+		cmd.Retry.Updated = time.Now()
+
+		if cmd.Retry.Id == 0 {
+			cmd.Retry.Created = cmd.Retry.Updated
+			_, err := sess.Insert(cmd.Retry)
+			return err
+		}
+
+		_, err := sess.ID(cmd.Retry.Id).AllCols().Update(cmd.Retry)
+		return err
+	})
+}
+
+func DeleteLdapSyncRetry(cmd *m.DeleteLdapSyncRetryCommand) error {
+	return inTransaction(func(sess *DBSession) error {
+		_, err := sess.Exec("DELETE FROM ldap_sync_retry WHERE server=? AND dn_hash=?", cmd.Server, ldapSyncRetryDnHash(cmd.Dn))
+		return err
+	})
+}
+
+func DeleteLdapSyncRetries(cmd *m.DeleteLdapSyncRetriesCommand) error {
+	return inTransaction(func(sess *DBSession) error {
+		result, err := sess.Exec("DELETE FROM ldap_sync_retry")
+		if err != nil {
+			return err
+		}
+		cmd.DeletedRows, err = result.RowsAffected()
+		return err
+	})
+}
+
+// ldapSyncRetryDnHash returns the hash the retries are queued by, the
+// DNs being too long for an index
+func ldapSyncRetryDnHash(dn string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(dn)))
+	return hex.EncodeToString(sum[:])
+}
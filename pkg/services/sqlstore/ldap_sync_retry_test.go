@@ -0,0 +1,72 @@
+package sqlstore
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	m "github.com/grafana/grafana/pkg/models"
+)
+
+func TestLdapSyncRetry(t *testing.T) {
+	Convey("Testing LDAP sync retry DB Access", t, func() {
+		InitTestDB(t)
+		now := time.Now()
+
+		Convey("Should not find a user never queued", func() {
+			So(GetLdapSyncRetry(&m.GetLdapSyncRetryQuery{Dn: "uid=tod,dc=grafana,dc=org"}), ShouldEqual, m.ErrLdapSyncRetryNotFound)
+		})
+
+		Convey("Should queue the users by DN and return the due ones", func() {
+			retry := &m.LdapSyncRetry{Dn: "uid=Tod,dc=grafana,dc=org", Login: "tod", Attempts: 1, NextAttempt: now.Add(time.Hour)}
+			So(SaveLdapSyncRetry(&m.SaveLdapSyncRetryCommand{Retry: retry}), ShouldBeNil)
+			So(SaveLdapSyncRetry(&m.SaveLdapSyncRetryCommand{Retry: &m.LdapSyncRetry{
+				Dn: "uid=roel,dc=grafana,dc=org", Login: "roel", Attempts: 1, NextAttempt: now.Add(-time.Minute),
+			}}), ShouldBeNil)
+
+			query := &m.GetLdapSyncRetryQuery{Dn: "UID=tod,dc=grafana,dc=org"}
+			So(GetLdapSyncRetry(query), ShouldBeNil)
+			So(query.Result.Dn, ShouldEqual, "uid=tod,dc=grafana,dc=org")
+
+			query.Result.Attempts = 2
+			query.Result.Error = "LDAP operation timed out"
+			So(SaveLdapSyncRetry(&m.SaveLdapSyncRetryCommand{Retry: query.Result}), ShouldBeNil)
+
+			due := &m.GetLdapSyncRetriesQuery{DueBy: now}
+			So(GetLdapSyncRetries(due), ShouldBeNil)
+			So(due.Result, ShouldHaveLength, 1)
+			So(due.Result[0].Login, ShouldEqual, "roel")
+
+			all := &m.GetLdapSyncRetriesQuery{}
+			So(GetLdapSyncRetries(all), ShouldBeNil)
+			So(all.Result, ShouldHaveLength, 2)
+			So(all.Result[1].Attempts, ShouldEqual, 2)
+			So(all.Result[1].Error, ShouldEqual, "LDAP operation timed out")
+
+			So(DeleteLdapSyncRetry(&m.DeleteLdapSyncRetryCommand{Dn: "uid=Roel,dc=grafana,dc=org"}), ShouldBeNil)
+			cmd := &m.DeleteLdapSyncRetriesCommand{}
+			So(DeleteLdapSyncRetries(cmd), ShouldBeNil)
+			So(cmd.DeletedRows, ShouldEqual, 1)
+		})
+
+		Convey("Should queue the DN of each server apart, however long it is", func() {
+			dn := "uid=tod," + strings.Repeat("ou=department,", 30) + "dc=grafana,dc=org"
+			for _, server := range []string{"ldap-a:389", "ldap-b:389"} {
+				So(SaveLdapSyncRetry(&m.SaveLdapSyncRetryCommand{Retry: &m.LdapSyncRetry{
+					Dn: dn, Login: "tod", Server: server, Attempts: 1, NextAttempt: now,
+				}}), ShouldBeNil)
+			}
+
+			query := &m.GetLdapSyncRetryQuery{Server: "ldap-b:389", Dn: strings.ToUpper(dn)}
+			So(GetLdapSyncRetry(query), ShouldBeNil)
+			So(query.Result.Dn, ShouldEqual, dn)
+			So(query.Result.Server, ShouldEqual, "ldap-b:389")
+
+			So(DeleteLdapSyncRetry(&m.DeleteLdapSyncRetryCommand{Server: "ldap-a:389", Dn: dn}), ShouldBeNil)
+			So(GetLdapSyncRetry(&m.GetLdapSyncRetryQuery{Server: "ldap-a:389", Dn: dn}), ShouldEqual, m.ErrLdapSyncRetryNotFound)
+			So(GetLdapSyncRetry(&m.GetLdapSyncRetryQuery{Server: "ldap-b:389", Dn: dn}), ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,64 @@
+package sqlstore
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	m "github.com/grafana/grafana/pkg/models"
+)
+
+func TestLdapSyncJob(t *testing.T) {
+	Convey("Testing LDAP sync job DB Access", t, func() {
+		InitTestDB(t)
+
+		Convey("Should not find a job before one is saved", func() {
+			So(GetLdapSyncJob(&m.GetLdapSyncJobQuery{}), ShouldEqual, m.ErrLdapSyncJobNotFound)
+		})
+
+		Convey("Should save and update the last job", func() {
+			first := &m.LdapSyncJob{State: m.LdapSyncCompleted, Started: time.Now()}
+			So(SaveLdapSyncJob(&m.SaveLdapSyncJobCommand{Job: first}), ShouldBeNil)
+
+			job := &m.LdapSyncJob{State: m.LdapSyncRunning, Started: time.Now(), StartedBy: 1}
+			So(SaveLdapSyncJob(&m.SaveLdapSyncJobCommand{Job: job}), ShouldBeNil)
+			So(job.Id, ShouldBeGreaterThan, first.Id)
+
+			job.State = m.LdapSyncPaused
+			job.Checkpoint = "cn=ldap-editor,ou=users,dc=grafana,dc=org"
+			job.Synced = 2
+			So(SaveLdapSyncJob(&m.SaveLdapSyncJobCommand{Job: job}), ShouldBeNil)
+
+			query := &m.GetLdapSyncJobQuery{}
+			So(GetLdapSyncJob(query), ShouldBeNil)
+			So(query.Result.Id, ShouldEqual, job.Id)
+			So(query.Result.State, ShouldEqual, m.LdapSyncPaused)
+			So(query.Result.Checkpoint, ShouldEqual, job.Checkpoint)
+			So(query.Result.Synced, ShouldEqual, 2)
+		})
+
+		Convey("Should get the job of the id and its report", func() {
+			first := &m.LdapSyncJob{State: m.LdapSyncCompleted, Started: time.Now()}
+			So(SaveLdapSyncJob(&m.SaveLdapSyncJobCommand{Job: first}), ShouldBeNil)
+			So(SaveLdapSyncJob(&m.SaveLdapSyncJobCommand{Job: &m.LdapSyncJob{State: m.LdapSyncRunning, Started: time.Now()}}), ShouldBeNil)
+
+			query := &m.GetLdapSyncJobQuery{Id: first.Id}
+			So(GetLdapSyncJob(query), ShouldBeNil)
+			So(query.Result.State, ShouldEqual, m.LdapSyncCompleted)
+
+			So(AddLdapSyncReportEntries(&m.AddLdapSyncReportEntriesCommand{Entries: []*m.LdapSyncReportEntry{
+				{JobId: first.Id, Dn: "cn=ldap-admin,ou=users,dc=grafana,dc=org", Login: "ldap-admin", Action: m.LdapSyncUpdated, Detail: "org 1: Viewer -> Admin", Created: time.Now()},
+				{JobId: first.Id, Dn: "cn=ldap-editor,ou=users,dc=grafana,dc=org", Login: "ldap-editor", Action: m.LdapSyncSkipped, Created: time.Now()},
+				{JobId: first.Id + 1, Dn: "cn=ldap-viewer,ou=users,dc=grafana,dc=org", Action: m.LdapSyncUnchanged, Created: time.Now()},
+			}}), ShouldBeNil)
+
+			report := &m.GetLdapSyncReportQuery{JobId: first.Id}
+			So(GetLdapSyncReport(report), ShouldBeNil)
+			So(report.Result, ShouldHaveLength, 2)
+			So(report.Result[0].Login, ShouldEqual, "ldap-admin")
+			So(report.Result[0].Detail, ShouldEqual, "org 1: Viewer -> Admin")
+			So(report.Result[1].Action, ShouldEqual, m.LdapSyncSkipped)
+		})
+	})
+}
@@ -0,0 +1,44 @@
+package sqlstore
+
+import (
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	m "github.com/grafana/grafana/pkg/models"
+)
+
+func init() {
+	bus.AddHandler("sql", GetLdapUserGuid)
+	bus.AddHandler("sql", SetLdapUserGuid)
+}
+
+func GetLdapUserGuid(query *m.GetLdapUserGuidQuery) error {
+	guid := &m.LdapUserGuid{}
+	has, err := x.Where("guid=?", query.Guid).Get(guid)
+	if err != nil {
+		return err
+	}
+	if !has {
+		return m.ErrLdapUserGuidNotFound
+	}
+
+	query.Result = guid
+	return nil
+}
+
+// SetLdapUserGuid links the user to the GUID, nothing is written when
+// it's already linked to it
+func SetLdapUserGuid(cmd *m.SetLdapUserGuidCommand) error {
+	return inTransaction(func(sess *DBSession) error {
+		has, err := sess.Where("user_id=? AND guid=?", cmd.UserId, cmd.Guid).Exist(&m.LdapUserGuid{})
+		if err != nil || has {
+			return err
+		}
+
+		if _, err := sess.Exec("DELETE FROM ldap_user_guid WHERE user_id=? OR guid=?", cmd.UserId, cmd.Guid); err != nil {
+			return err
+		}
+		_, err = sess.Insert(&m.LdapUserGuid{UserId: cmd.UserId, Guid: cmd.Guid, Created: time.Now()})
+		return err
+	})
+}
@@ -0,0 +1,36 @@
+package sqlstore
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	m "github.com/grafana/grafana/pkg/models"
+)
+
+func TestLdapUserGuid(t *testing.T) {
+	Convey("Testing LDAP user GUID DB Access", t, func() {
+		InitTestDB(t)
+
+		Convey("Should not find a GUID never linked", func() {
+			So(GetLdapUserGuid(&m.GetLdapUserGuidQuery{Guid: "0a1b"}), ShouldEqual, m.ErrLdapUserGuidNotFound)
+		})
+
+		Convey("Should link each user to a single GUID and each GUID to a single user", func() {
+			So(SetLdapUserGuid(&m.SetLdapUserGuidCommand{UserId: 1, Guid: "0a1b"}), ShouldBeNil)
+			So(SetLdapUserGuid(&m.SetLdapUserGuidCommand{UserId: 1, Guid: "0a1b"}), ShouldBeNil)
+
+			query := &m.GetLdapUserGuidQuery{Guid: "0a1b"}
+			So(GetLdapUserGuid(query), ShouldBeNil)
+			So(query.Result.UserId, ShouldEqual, 1)
+
+			So(SetLdapUserGuid(&m.SetLdapUserGuidCommand{UserId: 1, Guid: "2c3d"}), ShouldBeNil)
+			So(GetLdapUserGuid(&m.GetLdapUserGuidQuery{Guid: "0a1b"}), ShouldEqual, m.ErrLdapUserGuidNotFound)
+
+			So(SetLdapUserGuid(&m.SetLdapUserGuidCommand{UserId: 2, Guid: "2c3d"}), ShouldBeNil)
+			query = &m.GetLdapUserGuidQuery{Guid: "2c3d"}
+			So(GetLdapUserGuid(query), ShouldBeNil)
+			So(query.Result.UserId, ShouldEqual, 2)
+		})
+	})
+}
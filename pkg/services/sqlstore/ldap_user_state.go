@@ -0,0 +1,64 @@
+package sqlstore
+
+import (
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	m "github.com/grafana/grafana/pkg/models"
+)
+
+func init() {
+	bus.AddHandler("sql", GetLdapUserState)
+	bus.AddHandler("sql", GetLdapUserStates)
+	bus.AddHandler("sql", SetLdapUserState)
+	bus.AddHandler("sql", DeleteLdapUserState)
+}
+
+func GetLdapUserState(query *m.GetLdapUserStateQuery) error {
+	state := &m.LdapUserState{}
+	has, err := x.Where("user_id=?", query.UserId).Get(state)
+	if err != nil {
+		return err
+	}
+	if !has {
+		return m.ErrLdapUserStateNotFound
+	}
+
+	query.Result = state
+	return nil
+}
+
+func GetLdapUserStates(query *m.GetLdapUserStatesQuery) error {
+	query.Result = make([]*m.LdapUserState, 0)
+	return x.Asc("user_id").Find(&query.Result)
+}
+
+// SetLdapUserState inserts the state of the user, or updates it
+// keeping the time the user went missing
+func SetLdapUserState(cmd *m.SetLdapUserStateCommand) error {
+	return inTransaction(func(sess *DBSession) error {
+		now := time.Now()
+
+		state := &m.LdapUserState{}
+		has, err := sess.Where("user_id=?", cmd.UserId).Get(state)
+		if err != nil {
+			return err
+		}
+		if !has {
+			_, err := sess.Insert(&m.LdapUserState{UserId: cmd.UserId, State: cmd.State, Missing: now, Updated: now})
+			return err
+		}
+
+		state.State = cmd.State
+		state.Updated = now
+		_, err = sess.ID(state.Id).Cols("state", "updated").Update(state)
+		return err
+	})
+}
+
+func DeleteLdapUserState(cmd *m.DeleteLdapUserStateCommand) error {
+	return inTransaction(func(sess *DBSession) error {
+		_, err := sess.Exec("DELETE FROM ldap_user_state WHERE user_id=?", cmd.UserId)
+		return err
+	})
+}
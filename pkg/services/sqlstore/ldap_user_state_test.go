@@ -0,0 +1,38 @@
+package sqlstore
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	m "github.com/grafana/grafana/pkg/models"
+)
+
+func TestLdapUserState(t *testing.T) {
+	Convey("Testing LDAP user state DB Access", t, func() {
+		InitTestDB(t)
+
+		Convey("Should not find the state of a user never missing", func() {
+			So(GetLdapUserState(&m.GetLdapUserStateQuery{UserId: 1}), ShouldEqual, m.ErrLdapUserStateNotFound)
+		})
+
+		Convey("Should keep the time the user went missing", func() {
+			So(SetLdapUserState(&m.SetLdapUserStateCommand{UserId: 1, State: m.LdapUserPendingDisable}), ShouldBeNil)
+			query := &m.GetLdapUserStateQuery{UserId: 1}
+			So(GetLdapUserState(query), ShouldBeNil)
+			missing := query.Result.Missing
+
+			So(SetLdapUserState(&m.SetLdapUserStateCommand{UserId: 1, State: m.LdapUserDisabled}), ShouldBeNil)
+			So(SetLdapUserState(&m.SetLdapUserStateCommand{UserId: 2, State: m.LdapUserPendingDisable}), ShouldBeNil)
+
+			states := &m.GetLdapUserStatesQuery{}
+			So(GetLdapUserStates(states), ShouldBeNil)
+			So(states.Result, ShouldHaveLength, 2)
+			So(states.Result[0].State, ShouldEqual, m.LdapUserDisabled)
+			So(states.Result[0].Missing.Unix(), ShouldEqual, missing.Unix())
+
+			So(DeleteLdapUserState(&m.DeleteLdapUserStateCommand{UserId: 1}), ShouldBeNil)
+			So(GetLdapUserState(&m.GetLdapUserStateQuery{UserId: 1}), ShouldEqual, m.ErrLdapUserStateNotFound)
+		})
+	})
+}
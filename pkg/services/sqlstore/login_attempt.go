@@ -10,18 +10,27 @@ import (
 
 var getTimeNow = time.Now
 
+// authModuleFilter matches the attempts of an auth module, the attempts
+// saved by the brute force login protection have no auth module
+const authModuleFilter = "COALESCE(auth_module, '') = ?"
+
 func init() {
 	bus.AddHandler("sql", CreateLoginAttempt)
 	bus.AddHandler("sql", DeleteOldLoginAttempts)
 	bus.AddHandler("sql", GetUserLoginAttemptCount)
+	bus.AddHandler("sql", SearchLoginAttempts)
 }
 
 func CreateLoginAttempt(cmd *m.CreateLoginAttemptCommand) error {
 	return inTransaction(func(sess *DBSession) error {
 		loginAttempt := m.LoginAttempt{
-			Username:  cmd.Username,
-			IpAddress: cmd.IpAddress,
-			Created:   getTimeNow().Unix(),
+			Username:    cmd.Username,
+			IpAddress:   cmd.IpAddress,
+			Created:     getTimeNow().Unix(),
+			AuthModule:  cmd.AuthModule,
+			Server:      cmd.Server,
+			ResultClass: cmd.ResultClass,
+			Duration:    int64(cmd.Duration / time.Millisecond),
 		}
 
 		if _, err := sess.Insert(&loginAttempt); err != nil {
@@ -37,8 +46,8 @@ func CreateLoginAttempt(cmd *m.CreateLoginAttemptCommand) error {
 func DeleteOldLoginAttempts(cmd *m.DeleteOldLoginAttemptsCommand) error {
 	return inTransaction(func(sess *DBSession) error {
 		var maxId int64
-		sql := "SELECT max(id) as id FROM login_attempt WHERE created < ?"
-		result, err := sess.Query(sql, cmd.OlderThan.Unix())
+		sql := "SELECT max(id) as id FROM login_attempt WHERE created < ? AND " + authModuleFilter
+		result, err := sess.Query(sql, cmd.OlderThan.Unix(), cmd.AuthModule)
 
 		if err != nil {
 			return err
@@ -54,9 +63,9 @@ func DeleteOldLoginAttempts(cmd *m.DeleteOldLoginAttemptsCommand) error {
 			return nil
 		}
 
-		sql = "DELETE FROM login_attempt WHERE id <= ?"
+		sql = "DELETE FROM login_attempt WHERE id <= ? AND " + authModuleFilter
 
-		if result, err := sess.Exec(sql, maxId); err != nil {
+		if result, err := sess.Exec(sql, maxId, cmd.AuthModule); err != nil {
 			return err
 		} else if cmd.DeletedRows, err = result.RowsAffected(); err != nil {
 			return err
@@ -71,6 +80,7 @@ func GetUserLoginAttemptCount(query *m.GetUserLoginAttemptCountQuery) error {
 	total, err := x.
 		Where("username = ?", query.Username).
 		And("created >= ?", query.Since.Unix()).
+		And(authModuleFilter, "").
 		Count(loginAttempt)
 
 	if err != nil {
@@ -81,6 +91,32 @@ func GetUserLoginAttemptCount(query *m.GetUserLoginAttemptCountQuery) error {
 	return nil
 }
 
+func SearchLoginAttempts(query *m.SearchLoginAttemptsQuery) error {
+	sess := x.Where(authModuleFilter, query.AuthModule)
+
+	if query.Username != "" {
+		sess.And("username = ?", query.Username)
+	}
+	if query.Server != "" {
+		sess.And("server = ?", query.Server)
+	}
+	if query.ResultClass != "" {
+		sess.And("result_class = ?", query.ResultClass)
+	}
+	if !query.From.IsZero() {
+		sess.And("created >= ?", query.From.Unix())
+	}
+	if !query.To.IsZero() {
+		sess.And("created <= ?", query.To.Unix())
+	}
+	if query.Limit > 0 {
+		sess.Limit(query.Limit)
+	}
+
+	query.Result = make([]*m.LoginAttempt, 0)
+	return sess.Desc("id").Find(&query.Result)
+}
+
 func toInt64(i interface{}) int64 {
 	switch i := i.(type) {
 	case []byte:
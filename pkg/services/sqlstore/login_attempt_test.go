@@ -121,5 +121,74 @@ func TestLoginAttempts(t *testing.T) {
 			So(err, ShouldBeNil)
 			So(cmd.DeletedRows, ShouldEqual, 3)
 		})
+
+		Convey("With audited login attempts", func() {
+			err := CreateLoginAttempt(&m.CreateLoginAttemptCommand{
+				Username:    user,
+				IpAddress:   "192.168.0.1",
+				AuthModule:  "ldap",
+				Server:      "ldap:389",
+				ResultClass: "invalid_credentials",
+				Duration:    42 * time.Millisecond,
+			})
+			So(err, ShouldBeNil)
+
+			err = CreateLoginAttempt(&m.CreateLoginAttemptCommand{
+				Username:    "other",
+				IpAddress:   "192.168.0.2",
+				AuthModule:  "ldap",
+				Server:      "ldap:389",
+				ResultClass: "success",
+			})
+			So(err, ShouldBeNil)
+
+			Convey("Should not count them for the brute force login protection", func() {
+				query := m.GetUserLoginAttemptCountQuery{
+					Username: user,
+					Since:    beginningOfTime,
+				}
+				err := GetUserLoginAttemptCount(&query)
+				So(err, ShouldBeNil)
+				So(query.Result, ShouldEqual, 3)
+			})
+
+			Convey("Should only delete the attempts of the auth module", func() {
+				cmd := m.DeleteOldLoginAttemptsCommand{
+					OlderThan: timePlusTwoMinutes.Add(time.Second * 1),
+				}
+				err := DeleteOldLoginAttempts(&cmd)
+				So(err, ShouldBeNil)
+				So(cmd.DeletedRows, ShouldEqual, 3)
+
+				cmd = m.DeleteOldLoginAttemptsCommand{
+					OlderThan:  timePlusTwoMinutes.Add(time.Second * 1),
+					AuthModule: "ldap",
+				}
+				err = DeleteOldLoginAttempts(&cmd)
+				So(err, ShouldBeNil)
+				So(cmd.DeletedRows, ShouldEqual, 2)
+			})
+
+			Convey("Should search them", func() {
+				query := m.SearchLoginAttemptsQuery{AuthModule: "ldap", Username: user}
+				err := SearchLoginAttempts(&query)
+				So(err, ShouldBeNil)
+				So(query.Result, ShouldHaveLength, 1)
+				So(query.Result[0].Server, ShouldEqual, "ldap:389")
+				So(query.Result[0].ResultClass, ShouldEqual, "invalid_credentials")
+				So(query.Result[0].Duration, ShouldEqual, 42)
+
+				query = m.SearchLoginAttemptsQuery{AuthModule: "ldap", ResultClass: "success"}
+				err = SearchLoginAttempts(&query)
+				So(err, ShouldBeNil)
+				So(query.Result, ShouldHaveLength, 1)
+				So(query.Result[0].Username, ShouldEqual, "other")
+
+				query = m.SearchLoginAttemptsQuery{AuthModule: "ldap", From: timePlusTwoMinutes.Add(time.Second)}
+				err = SearchLoginAttempts(&query)
+				So(err, ShouldBeNil)
+				So(query.Result, ShouldHaveLength, 0)
+			})
+		})
 	})
 }
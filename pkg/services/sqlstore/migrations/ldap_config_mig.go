@@ -0,0 +1,186 @@
+package migrations
+
+import . "github.com/grafana/grafana/pkg/services/sqlstore/migrator"
+
+func addLdapConfigMigrations(mg *Migrator) {
+	ldapConfigV1 := Table{
+		Name: "ldap_config",
+		Columns: []*Column{
+			{Name: "id", Type: DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "config", Type: DB_Blob, Nullable: false},
+			{Name: "updated", Type: DB_DateTime, Nullable: false},
+			{Name: "updated_by", Type: DB_BigInt, Nullable: false},
+		},
+	}
+
+	mg.AddMigration("create ldap_config table", NewAddTableMigration(ldapConfigV1))
+
+	ldapLoginStateV1 := Table{
+		Name: "ldap_login_state",
+		Columns: []*Column{
+			{Name: "id", Type: DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "enabled", Type: DB_Bool, Nullable: false},
+			{Name: "updated", Type: DB_DateTime, Nullable: false},
+			{Name: "updated_by", Type: DB_BigInt, Nullable: false},
+		},
+	}
+
+	mg.AddMigration("create ldap_login_state table", NewAddTableMigration(ldapLoginStateV1))
+
+	ldapSecondFactorV1 := Table{
+		Name: "ldap_second_factor",
+		Columns: []*Column{
+			{Name: "id", Type: DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "user_id", Type: DB_BigInt, Nullable: false},
+			{Name: "secret", Type: DB_Blob, Nullable: false},
+			{Name: "created", Type: DB_DateTime, Nullable: false},
+		},
+		Indices: []*Index{
+			{Cols: []string{"user_id"}, Type: UniqueIndex},
+		},
+	}
+
+	mg.AddMigration("create ldap_second_factor table", NewAddTableMigration(ldapSecondFactorV1))
+	mg.AddMigration("add unique index ldap_second_factor.user_id", NewAddIndexMigration(ldapSecondFactorV1, ldapSecondFactorV1.Indices[0]))
+
+	ldapSyncJobV1 := Table{
+		Name: "ldap_sync_job",
+		Columns: []*Column{
+			{Name: "id", Type: DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "state", Type: DB_NVarchar, Length: 20, Nullable: false},
+			{Name: "checkpoint", Type: DB_Text, Nullable: false},
+			{Name: "total", Type: DB_BigInt, Nullable: false},
+			{Name: "synced", Type: DB_BigInt, Nullable: false},
+			{Name: "skipped", Type: DB_BigInt, Nullable: false},
+			{Name: "failed", Type: DB_BigInt, Nullable: false},
+			{Name: "error", Type: DB_Text, Nullable: false},
+			{Name: "started", Type: DB_DateTime, Nullable: false},
+			{Name: "updated", Type: DB_DateTime, Nullable: false},
+			{Name: "started_by", Type: DB_BigInt, Nullable: false},
+		},
+	}
+
+	mg.AddMigration("create ldap_sync_job table", NewAddTableMigration(ldapSyncJobV1))
+
+	ldapSyncReportEntryV1 := Table{
+		Name: "ldap_sync_report_entry",
+		Columns: []*Column{
+			{Name: "id", Type: DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "job_id", Type: DB_BigInt, Nullable: false},
+			{Name: "dn", Type: DB_Text, Nullable: false},
+			{Name: "login", Type: DB_NVarchar, Length: 190, Nullable: false},
+			{Name: "action", Type: DB_NVarchar, Length: 20, Nullable: false},
+			{Name: "detail", Type: DB_Text, Nullable: false},
+			{Name: "error", Type: DB_Text, Nullable: false},
+			{Name: "created", Type: DB_DateTime, Nullable: false},
+		},
+		Indices: []*Index{
+			{Cols: []string{"job_id"}},
+		},
+	}
+
+	mg.AddMigration("create ldap_sync_report_entry table", NewAddTableMigration(ldapSyncReportEntryV1))
+	mg.AddMigration("add index ldap_sync_report_entry.job_id", NewAddIndexMigration(ldapSyncReportEntryV1, ldapSyncReportEntryV1.Indices[0]))
+
+	ldapUserStateV1 := Table{
+		Name: "ldap_user_state",
+		Columns: []*Column{
+			{Name: "id", Type: DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "user_id", Type: DB_BigInt, Nullable: false},
+			{Name: "state", Type: DB_NVarchar, Length: 20, Nullable: false},
+			{Name: "missing", Type: DB_DateTime, Nullable: false},
+			{Name: "updated", Type: DB_DateTime, Nullable: false},
+		},
+		Indices: []*Index{
+			{Cols: []string{"user_id"}, Type: UniqueIndex},
+		},
+	}
+
+	mg.AddMigration("create ldap_user_state table", NewAddTableMigration(ldapUserStateV1))
+	mg.AddMigration("add unique index ldap_user_state.user_id", NewAddIndexMigration(ldapUserStateV1, ldapUserStateV1.Indices[0]))
+
+	ldapSyncRetryV1 := Table{
+		Name: "ldap_sync_retry",
+		Columns: []*Column{
+			{Name: "id", Type: DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "dn", Type: DB_NVarchar, Length: 190, Nullable: false},
+			{Name: "login", Type: DB_NVarchar, Length: 190, Nullable: false},
+			{Name: "server", Type: DB_NVarchar, Length: 255, Nullable: false},
+			{Name: "attempts", Type: DB_Int, Nullable: false},
+			{Name: "error", Type: DB_Text, Nullable: false},
+			{Name: "next_attempt", Type: DB_DateTime, Nullable: false},
+			{Name: "created", Type: DB_DateTime, Nullable: false},
+			{Name: "updated", Type: DB_DateTime, Nullable: false},
+		},
+		Indices: []*Index{
+			{Cols: []string{"dn"}, Type: UniqueIndex},
+			{Cols: []string{"next_attempt"}},
+		},
+	}
+
+	mg.AddMigration("create ldap_sync_retry table", NewAddTableMigration(ldapSyncRetryV1))
+	mg.AddMigration("add unique index ldap_sync_retry.dn", NewAddIndexMigration(ldapSyncRetryV1, ldapSyncRetryV1.Indices[0]))
+	mg.AddMigration("add index ldap_sync_retry.next_attempt", NewAddIndexMigration(ldapSyncRetryV1, ldapSyncRetryV1.Indices[1]))
+
+	// the DNs outgrow an indexed column, the v2 queue is keyed by the server
+	// and the hash of the DN. The retries are dropped with the v1 table,
+	// the next syncs queue the users failing again
+	ldapSyncRetryV2 := Table{
+		Name: "ldap_sync_retry",
+		Columns: []*Column{
+			{Name: "id", Type: DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "dn", Type: DB_Text, Nullable: false},
+			{Name: "dn_hash", Type: DB_Varchar, Length: 64, Nullable: false},
+			{Name: "login", Type: DB_NVarchar, Length: 190, Nullable: false},
+			{Name: "server", Type: DB_NVarchar, Length: 190, Nullable: false},
+			{Name: "attempts", Type: DB_Int, Nullable: false},
+			{Name: "error", Type: DB_Text, Nullable: false},
+			{Name: "next_attempt", Type: DB_DateTime, Nullable: false},
+			{Name: "created", Type: DB_DateTime, Nullable: false},
+			{Name: "updated", Type: DB_DateTime, Nullable: false},
+		},
+		Indices: []*Index{
+			{Cols: []string{"server", "dn_hash"}, Type: UniqueIndex},
+			{Cols: []string{"next_attempt"}},
+		},
+	}
+
+	addDropAllIndicesMigrations(mg, "v1", ldapSyncRetryV1)
+	mg.AddMigration("drop ldap_sync_retry table v1", NewDropTableMigration("ldap_sync_retry"))
+	mg.AddMigration("create ldap_sync_retry table v2", NewAddTableMigration(ldapSyncRetryV2))
+	addTableIndicesMigrations(mg, "v2", ldapSyncRetryV2)
+
+	ldapUserGuidV1 := Table{
+		Name: "ldap_user_guid",
+		Columns: []*Column{
+			{Name: "id", Type: DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "user_id", Type: DB_BigInt, Nullable: false},
+			{Name: "guid", Type: DB_NVarchar, Length: 190, Nullable: false},
+			{Name: "created", Type: DB_DateTime, Nullable: false},
+		},
+		Indices: []*Index{
+			{Cols: []string{"user_id"}, Type: UniqueIndex},
+			{Cols: []string{"guid"}, Type: UniqueIndex},
+		},
+	}
+
+	mg.AddMigration("create ldap_user_guid table", NewAddTableMigration(ldapUserGuidV1))
+	mg.AddMigration("add unique index ldap_user_guid.user_id", NewAddIndexMigration(ldapUserGuidV1, ldapUserGuidV1.Indices[0]))
+	mg.AddMigration("add unique index ldap_user_guid.guid", NewAddIndexMigration(ldapUserGuidV1, ldapUserGuidV1.Indices[1]))
+
+	ldapSecondFactorCounterV1 := Table{
+		Name: "ldap_second_factor_counter",
+		Columns: []*Column{
+			{Name: "id", Type: DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "user_id", Type: DB_BigInt, Nullable: false},
+			{Name: "counter", Type: DB_BigInt, Nullable: false},
+			{Name: "updated", Type: DB_DateTime, Nullable: false},
+		},
+		Indices: []*Index{
+			{Cols: []string{"user_id"}, Type: UniqueIndex},
+		},
+	}
+
+	mg.AddMigration("create ldap_second_factor_counter table", NewAddTableMigration(ldapSecondFactorCounterV1))
+	mg.AddMigration("add unique index ldap_second_factor_counter.user_id", NewAddIndexMigration(ldapSecondFactorCounterV1, ldapSecondFactorCounterV1.Indices[0]))
+}
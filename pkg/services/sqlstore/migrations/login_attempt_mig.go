@@ -39,4 +39,20 @@ func addLoginAttemptMigrations(mg *Migrator) {
 		"username":   "username",
 		"ip_address": "ip_address",
 	})
+
+	mg.AddMigration("Add column auth_module to login_attempt", NewAddColumnMigration(loginAttemptV2, &Column{
+		Name: "auth_module", Type: DB_NVarchar, Length: 50, Nullable: true,
+	}))
+	mg.AddMigration("Add column server to login_attempt", NewAddColumnMigration(loginAttemptV2, &Column{
+		Name: "server", Type: DB_NVarchar, Length: 255, Nullable: true,
+	}))
+	mg.AddMigration("Add column result_class to login_attempt", NewAddColumnMigration(loginAttemptV2, &Column{
+		Name: "result_class", Type: DB_NVarchar, Length: 50, Nullable: true,
+	}))
+	mg.AddMigration("Add column duration to login_attempt", NewAddColumnMigration(loginAttemptV2, &Column{
+		Name: "duration", Type: DB_BigInt, Nullable: true,
+	}))
+	mg.AddMigration("add index login_attempt.auth_module_created", NewAddIndexMigration(loginAttemptV2, &Index{
+		Cols: []string{"auth_module", "created"},
+	}))
 }
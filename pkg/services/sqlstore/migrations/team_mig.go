@@ -58,4 +58,29 @@ func addTeamMigrations(mg *Migrator) {
 	mg.AddMigration("Add column permission to team_member table", NewAddColumnMigration(teamMemberV1, &Column{
 		Name: "permission", Type: DB_SmallInt, Nullable: true,
 	}))
+
+	mg.AddMigration("Add column external_source to team_member table", NewAddColumnMigration(teamMemberV1, &Column{
+		Name: "external_source", Type: DB_NVarchar, Nullable: true, Length: 40,
+	}))
+
+	mg.AddMigration("Add column external_group to team_member table", NewAddColumnMigration(teamMemberV1, &Column{
+		Name: "external_group", Type: DB_Text, Nullable: true,
+	}))
+
+	teamMemberRemovalV1 := Table{
+		Name: "team_member_removal",
+		Columns: []*Column{
+			{Name: "id", Type: DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "org_id", Type: DB_BigInt},
+			{Name: "team_id", Type: DB_BigInt},
+			{Name: "user_id", Type: DB_BigInt},
+			{Name: "created", Type: DB_DateTime, Nullable: false},
+		},
+		Indices: []*Index{
+			{Cols: []string{"org_id", "team_id", "user_id"}, Type: UniqueIndex},
+		},
+	}
+
+	mg.AddMigration("create team member removal table", NewAddTableMigration(teamMemberRemovalV1))
+	mg.AddMigration("add unique index team_member_removal_org_id_team_id_user_id", NewAddIndexMigration(teamMemberRemovalV1, teamMemberRemovalV1.Indices[0]))
 }
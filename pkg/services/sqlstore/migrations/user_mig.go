@@ -116,6 +116,24 @@ func addUserMigrations(mg *Migrator) {
 
 	// Adds salt & rands for old users who used ldap or oauth
 	mg.AddMigration("Add missing user data", &AddMissingUserSaltAndRandsMigration{})
+
+	userAttributeV1 := Table{
+		Name: "user_attribute",
+		Columns: []*Column{
+			{Name: "id", Type: DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "user_id", Type: DB_BigInt, Nullable: false},
+			{Name: "source", Type: DB_NVarchar, Length: 40, Nullable: false},
+			{Name: "name", Type: DB_NVarchar, Length: 190, Nullable: false},
+			{Name: "value", Type: DB_Text, Nullable: false},
+			{Name: "updated", Type: DB_DateTime, Nullable: false},
+		},
+		Indices: []*Index{
+			{Cols: []string{"user_id", "source", "name"}, Type: UniqueIndex},
+		},
+	}
+
+	mg.AddMigration("create user_attribute table", NewAddTableMigration(userAttributeV1))
+	mg.AddMigration("add unique index user_attribute.user_id_source_name", NewAddIndexMigration(userAttributeV1, userAttributeV1.Indices[0]))
 }
 
 type AddMissingUserSaltAndRandsMigration struct {
@@ -148,6 +148,7 @@ func RemoveOrgUser(cmd *m.RemoveOrgUserCommand) error {
 			"DELETE FROM org_user WHERE org_id=? and user_id=?",
 			"DELETE FROM dashboard_acl WHERE org_id=? and user_id = ?",
 			"DELETE FROM team_member WHERE org_id=? and user_id = ?",
+			"DELETE FROM team_member_removal WHERE org_id=? and user_id = ?",
 		}
 
 		for _, sql := range deletes {
@@ -110,6 +110,7 @@ func DeleteTeam(cmd *m.DeleteTeamCommand) error {
 
 		deletes := []string{
 			"DELETE FROM team_member WHERE org_id=? and team_id = ?",
+			"DELETE FROM team_member_removal WHERE org_id=? and team_id = ?",
 			"DELETE FROM team WHERE org_id=? and id = ?",
 			"DELETE FROM dashboard_acl WHERE org_id=? and team_id = ?",
 		}
@@ -253,14 +254,28 @@ func AddTeamMember(cmd *m.AddTeamMemberCommand) error {
 			return err
 		}
 
+		if cmd.External && cmd.ManualRemovals == m.TeamMemberRemovalRespect {
+			if res, err := sess.Query("SELECT 1 FROM team_member_removal WHERE org_id=? and team_id=? and user_id=?", cmd.OrgId, cmd.TeamId, cmd.UserId); err != nil {
+				return err
+			} else if len(res) == 1 {
+				return m.ErrTeamMemberRemovedManually
+			}
+		}
+
+		if _, err := sess.Exec("DELETE FROM team_member_removal WHERE org_id=? and team_id=? and user_id=?", cmd.OrgId, cmd.TeamId, cmd.UserId); err != nil {
+			return err
+		}
+
 		entity := m.TeamMember{
-			OrgId:      cmd.OrgId,
-			TeamId:     cmd.TeamId,
-			UserId:     cmd.UserId,
-			External:   cmd.External,
-			Created:    time.Now(),
-			Updated:    time.Now(),
-			Permission: cmd.Permission,
+			OrgId:          cmd.OrgId,
+			TeamId:         cmd.TeamId,
+			UserId:         cmd.UserId,
+			External:       cmd.External,
+			ExternalSource: cmd.ExternalSource,
+			ExternalGroup:  cmd.ExternalGroup,
+			Created:        time.Now(),
+			Updated:        time.Now(),
+			Permission:     cmd.Permission,
 		}
 
 		_, err := sess.Insert(&entity)
@@ -323,16 +338,21 @@ func RemoveTeamMember(cmd *m.RemoveTeamMemberCommand) error {
 			}
 		}
 
-		var rawSql = "DELETE FROM team_member WHERE org_id=? and team_id=? and user_id=?"
-		res, err := sess.Exec(rawSql, cmd.OrgId, cmd.TeamId, cmd.UserId)
+		member, err := getTeamMember(sess, cmd.OrgId, cmd.TeamId, cmd.UserId)
 		if err != nil {
 			return err
 		}
-		rows, err := res.RowsAffected()
-		if rows == 0 {
-			return m.ErrTeamMemberNotFound
+
+		var rawSql = "DELETE FROM team_member WHERE org_id=? and team_id=? and user_id=?"
+		if _, err := sess.Exec(rawSql, cmd.OrgId, cmd.TeamId, cmd.UserId); err != nil {
+			return err
 		}
 
+		// the team sync may leave out the external members removed manually
+		if !cmd.Manual || !member.External {
+			return nil
+		}
+		_, err = sess.Insert(&m.TeamMemberRemoval{OrgId: cmd.OrgId, TeamId: cmd.TeamId, UserId: cmd.UserId, Created: time.Now()})
 		return err
 	})
 }
@@ -377,7 +397,7 @@ func GetTeamMembers(query *m.GetTeamMembersQuery) error {
 	if query.External {
 		sess.Where("team_member.external=?", dialect.BooleanStr(true))
 	}
-	sess.Cols("team_member.org_id", "team_member.team_id", "team_member.user_id", "user.email", "user.login", "team_member.external", "team_member.permission")
+	sess.Cols("team_member.org_id", "team_member.team_id", "team_member.user_id", "user.email", "user.login", "team_member.external", "team_member.permission", "team_member.external_source", "team_member.external_group")
 	sess.Asc("user.login", "user.email")
 
 	err := sess.Find(&query.Result)
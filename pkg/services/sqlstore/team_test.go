@@ -180,6 +180,42 @@ func TestTeamCommandsAndQueries(t *testing.T) {
 				So(len(q2.Result), ShouldEqual, 0)
 			})
 
+			Convey("Should record where the external members come from", func() {
+				cmd := &m.AddTeamMemberCommand{OrgId: testOrgId, TeamId: group1.Result.Id, UserId: userIds[0],
+					External: true, ExternalSource: "ldap", ExternalGroup: "cn=editors,ou=groups,dc=grafana,dc=org"}
+				err = AddTeamMember(cmd)
+				So(err, ShouldBeNil)
+
+				q1 := &m.GetTeamMembersQuery{OrgId: testOrgId, TeamId: group1.Result.Id}
+				err = GetTeamMembers(q1)
+				So(err, ShouldBeNil)
+				So(q1.Result[0].ExternalSource, ShouldEqual, "ldap")
+				So(q1.Result[0].ExternalGroup, ShouldEqual, "cn=editors,ou=groups,dc=grafana,dc=org")
+
+				Convey("And leave out the members removed manually if the policy respects it", func() {
+					err = RemoveTeamMember(&m.RemoveTeamMemberCommand{OrgId: testOrgId, TeamId: group1.Result.Id, UserId: userIds[0], Manual: true})
+					So(err, ShouldBeNil)
+
+					cmd.ManualRemovals = m.TeamMemberRemovalRespect
+					So(AddTeamMember(cmd), ShouldEqual, m.ErrTeamMemberRemovedManually)
+
+					cmd.ManualRemovals = m.TeamMemberRemovalOverride
+					So(AddTeamMember(cmd), ShouldBeNil)
+				})
+
+				Convey("And add them back after a manual add", func() {
+					err = RemoveTeamMember(&m.RemoveTeamMemberCommand{OrgId: testOrgId, TeamId: group1.Result.Id, UserId: userIds[0], Manual: true})
+					So(err, ShouldBeNil)
+					err = AddTeamMember(&m.AddTeamMemberCommand{OrgId: testOrgId, TeamId: group1.Result.Id, UserId: userIds[0]})
+					So(err, ShouldBeNil)
+					err = RemoveTeamMember(&m.RemoveTeamMemberCommand{OrgId: testOrgId, TeamId: group1.Result.Id, UserId: userIds[0]})
+					So(err, ShouldBeNil)
+
+					cmd.ManualRemovals = m.TeamMemberRemovalRespect
+					So(AddTeamMember(cmd), ShouldBeNil)
+				})
+			})
+
 			Convey("When ProtectLastAdmin is set to true", func() {
 				err = AddTeamMember(&m.AddTeamMemberCommand{OrgId: testOrgId, TeamId: group1.Result.Id, UserId: userIds[0], Permission: m.PERMISSION_ADMIN})
 				So(err, ShouldBeNil)
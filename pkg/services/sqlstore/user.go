@@ -487,7 +487,12 @@ func deleteUserInTransaction(sess *DBSession, cmd *m.DeleteUserCommand) error {
 		"DELETE FROM dashboard_acl WHERE user_id = ?",
 		"DELETE FROM preferences WHERE user_id = ?",
 		"DELETE FROM team_member WHERE user_id = ?",
+		"DELETE FROM team_member_removal WHERE user_id = ?",
 		"DELETE FROM user_auth WHERE user_id = ?",
+		"DELETE FROM ldap_user_state WHERE user_id = ?",
+		"DELETE FROM ldap_user_guid WHERE user_id = ?",
+		"DELETE FROM ldap_second_factor_counter WHERE user_id = ?",
+		"DELETE FROM user_attribute WHERE user_id = ?",
 	}
 
 	for _, sql := range deletes {
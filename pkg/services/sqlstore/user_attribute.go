@@ -0,0 +1,62 @@
+package sqlstore
+
+import (
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	m "github.com/grafana/grafana/pkg/models"
+)
+
+func init() {
+	bus.AddHandler("sql", GetUserAttributes)
+	bus.AddHandler("sql", SetUserAttributes)
+}
+
+func GetUserAttributes(query *m.GetUserAttributesQuery) error {
+	query.Result = make([]*m.UserAttribute, 0)
+	return x.Where("user_id=?", query.UserId).Asc("source", "name").Find(&query.Result)
+}
+
+// SetUserAttributes only writes the attributes of the source that changed,
+// the ones no longer set are deleted
+func SetUserAttributes(cmd *m.SetUserAttributesCommand) error {
+	return inTransaction(func(sess *DBSession) error {
+		existing := make([]*m.UserAttribute, 0)
+		if err := sess.Where("user_id=? AND source=?", cmd.UserId, cmd.Source).Find(&existing); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		seen := map[string]bool{}
+		for _, attribute := range existing {
+			value, ok := cmd.Attributes[attribute.Name]
+			if !ok {
+				if _, err := sess.ID(attribute.Id).Delete(&m.UserAttribute{}); err != nil {
+					return err
+				}
+				continue
+			}
+			seen[attribute.Name] = true
+
+			if value == attribute.Value {
+				continue
+			}
+			attribute.Value, attribute.Updated = value, now
+			if _, err := sess.ID(attribute.Id).Cols("value", "updated").Update(attribute); err != nil {
+				return err
+			}
+		}
+
+		for name, value := range cmd.Attributes {
+			if seen[name] {
+				continue
+			}
+			attribute := &m.UserAttribute{UserId: cmd.UserId, Source: cmd.Source, Name: name, Value: value, Updated: now}
+			if _, err := sess.Insert(attribute); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
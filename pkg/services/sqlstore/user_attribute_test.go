@@ -0,0 +1,37 @@
+package sqlstore
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	m "github.com/grafana/grafana/pkg/models"
+)
+
+func TestUserAttributes(t *testing.T) {
+	Convey("Testing user attributes DB Access", t, func() {
+		InitTestDB(t)
+
+		Convey("Should replace the attributes of the source", func() {
+			cmd := &m.SetUserAttributesCommand{UserId: 1, Source: "ldap", Attributes: map[string]string{
+				"cost_center": "4200",
+				"region":      "emea",
+			}}
+			So(SetUserAttributes(cmd), ShouldBeNil)
+			So(SetUserAttributes(&m.SetUserAttributesCommand{UserId: 1, Source: "oauth", Attributes: map[string]string{"region": "us"}}), ShouldBeNil)
+			So(SetUserAttributes(&m.SetUserAttributesCommand{UserId: 2, Source: "ldap", Attributes: map[string]string{"region": "apac"}}), ShouldBeNil)
+
+			cmd.Attributes = map[string]string{"cost_center": "4300", "manager": "uid=tod,ou=users,dc=grafana,dc=org"}
+			So(SetUserAttributes(cmd), ShouldBeNil)
+
+			query := &m.GetUserAttributesQuery{UserId: 1}
+			So(GetUserAttributes(query), ShouldBeNil)
+			So(query.Result, ShouldHaveLength, 3)
+			So(query.Result[0].Name, ShouldEqual, "cost_center")
+			So(query.Result[0].Value, ShouldEqual, "4300")
+			So(query.Result[1].Name, ShouldEqual, "manager")
+			So(query.Result[2].Source, ShouldEqual, "oauth")
+			So(query.Result[2].Value, ShouldEqual, "us")
+		})
+	})
+}
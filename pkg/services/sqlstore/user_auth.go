@@ -15,6 +15,7 @@ var getTime = time.Now
 func init() {
 	bus.AddHandler("sql", GetUserByAuthInfo)
 	bus.AddHandler("sql", GetAuthInfo)
+	bus.AddHandler("sql", GetAuthInfoList)
 	bus.AddHandler("sql", SetAuthInfo)
 	bus.AddHandler("sql", UpdateAuthInfo)
 	bus.AddHandler("sql", DeleteAuthInfo)
@@ -149,6 +150,14 @@ func GetAuthInfo(query *m.GetAuthInfoQuery) error {
 	return nil
 }
 
+func GetAuthInfoList(query *m.GetAuthInfoListQuery) error {
+	query.Result = make([]*m.UserAuth, 0)
+	return x.Cols("id", "user_id", "auth_module", "auth_id", "created").
+		Where("auth_module=?", query.AuthModule).
+		Asc("id").
+		Find(&query.Result)
+}
+
 func SetAuthInfo(cmd *m.SetAuthInfoCommand) error {
 	return inTransaction(func(sess *DBSession) error {
 		authUser := &m.UserAuth{
@@ -14,6 +14,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
 	"time"
 
@@ -139,6 +140,7 @@ var (
 	AuthProxyHeaderProperty string
 	AuthProxyAutoSignUp     bool
 	AuthProxyLdapSyncTtl    int
+	AuthProxyLdapEnrichment bool
 	AuthProxyWhitelist      string
 	AuthProxyHeaders        map[string]string
 
@@ -170,6 +172,58 @@ var (
 	LdapSyncCron          string
 	LdapAllowSignup       bool
 	LdapActiveSyncEnabled bool
+	LdapDuplicateUsers    string
+
+	LdapServerAffinityCacheSize int
+	LdapServerAffinityTTL       time.Duration
+	LdapShutdownTimeout         time.Duration
+	LdapMaxConcurrentOperations int
+	LdapWarmUp                  string
+	LdapTCPKeepAlive            time.Duration
+	LdapLivenessProbeInterval   time.Duration
+	LdapFIPSMode                bool
+	LdapRejectEmptyPasswords    bool
+	LdapMinPasswordLength       int
+	LdapMaxLoginInputLength     int
+	LdapHealthCheck             bool
+	LdapHealthCheckCacheTTL     time.Duration
+	LdapSlowOperationThreshold  time.Duration
+	LdapLogRedaction            string
+	LdapLoginAudit              bool
+	LdapLoginAuditRetention     time.Duration
+	LdapDatabaseConfig          bool
+	LdapRevokeSessions          bool
+	LdapImpersonationGroup      string
+	LdapImpersonationDuration   time.Duration
+	LdapApiKeyGroups            []string
+	LdapEndpointRateLimits      map[string]int
+	LdapMaxResults              int
+	LdapSCIMEnabled             bool
+	LdapRecordFile              string
+	LdapFaultInjection          string
+	LdapMonitoringDashboard     bool
+	LdapSyncProtectedUsers      []string
+	LdapSyncProtectedOrgIds     []int64
+	LdapDisableMissingUsers     bool
+	LdapDisableGracePeriod      time.Duration
+	LdapDeleteDisabledAfterDays int
+	LdapSyncWorkers             int
+	LdapSyncBatchSize           int
+	LdapSyncRetryBackoff        time.Duration
+	LdapSyncRetryMaxBackoff     time.Duration
+	LdapSyncPacingLatency       time.Duration
+	LdapSyncPacingMaxDelay      time.Duration
+	LdapStrictOrgRemoval        bool
+	LdapOrgRemovalExemptOrgIds  []int64
+	LdapTeamSyncManualRemovals  string
+	LdapGroupWatchInterval      time.Duration
+	LdapCheckMappedGroups       bool
+	LdapGenericLoginErrors      bool
+	LdapLoginErrorMessages      map[string]string
+	LdapLoginDeadline           time.Duration
+
+	LdapServiceConnection              bool
+	LdapServiceConnectionCheckInterval time.Duration
 
 	// QUOTA
 	Quota QuotaSettings
@@ -815,6 +869,7 @@ func (cfg *Cfg) Load(args *CommandLineArgs) error {
 	}
 	AuthProxyAutoSignUp = authProxy.Key("auto_sign_up").MustBool(true)
 	AuthProxyLdapSyncTtl = authProxy.Key("ldap_sync_ttl").MustInt()
+	AuthProxyLdapEnrichment = authProxy.Key("ldap_enrichment").MustBool(true)
 	AuthProxyWhitelist, err = valueAsString(authProxy, "whitelist", "")
 	if err != nil {
 		return err
@@ -982,6 +1037,118 @@ func (cfg *Cfg) readLDAPConfig() {
 	LdapEnabled = ldapSec.Key("enabled").MustBool(false)
 	LdapActiveSyncEnabled = ldapSec.Key("active_sync_enabled").MustBool(false)
 	LdapAllowSignup = ldapSec.Key("allow_sign_up").MustBool(true)
+	LdapDuplicateUsers = ldapSec.Key("duplicate_users").MustString("first_answer")
+	LdapServerAffinityCacheSize = ldapSec.Key("server_affinity_cache_size").MustInt(10000)
+	LdapServerAffinityTTL = ldapSec.Key("server_affinity_ttl").MustDuration(time.Hour)
+	LdapShutdownTimeout = ldapSec.Key("shutdown_timeout").MustDuration(10 * time.Second)
+	LdapMaxConcurrentOperations = ldapSec.Key("max_concurrent_operations").MustInt(0)
+	LdapWarmUp = ldapSec.Key("warm_up").MustString("off")
+	LdapTCPKeepAlive = ldapSec.Key("tcp_keepalive").MustDuration(30 * time.Second)
+	LdapLivenessProbeInterval = ldapSec.Key("liveness_probe_interval").MustDuration(0)
+	LdapFIPSMode = ldapSec.Key("fips_mode").MustBool(false)
+	LdapRejectEmptyPasswords = ldapSec.Key("reject_empty_passwords").MustBool(true)
+	LdapMinPasswordLength = ldapSec.Key("min_password_length").MustInt(0)
+	LdapMaxLoginInputLength = ldapSec.Key("max_login_input_length").MustInt(256)
+	LdapHealthCheck = ldapSec.Key("health_check").MustBool(false)
+	LdapHealthCheckCacheTTL = ldapSec.Key("health_check_cache_ttl").MustDuration(30 * time.Second)
+	LdapSlowOperationThreshold = ldapSec.Key("slow_operation_threshold").MustDuration(time.Second)
+	LdapLogRedaction = ldapSec.Key("log_redaction").MustString("none")
+	LdapLoginAudit = ldapSec.Key("login_audit").MustBool(false)
+	LdapLoginAuditRetention = ldapSec.Key("login_audit_retention").MustDuration(30 * 24 * time.Hour)
+	LdapDatabaseConfig = ldapSec.Key("database_config").MustBool(false)
+	LdapRevokeSessions = ldapSec.Key("revoke_sessions").MustBool(true)
+	LdapImpersonationGroup = ldapSec.Key("impersonation_group").String()
+	LdapImpersonationDuration = ldapSec.Key("impersonation_duration").MustDuration(time.Hour)
+	// separated by semicolons, the DNs have commas
+	LdapApiKeyGroups = nil
+	for _, group := range strings.Split(ldapSec.Key("api_key_groups").String(), ";") {
+		if group = strings.TrimSpace(group); group != "" {
+			LdapApiKeyGroups = append(LdapApiKeyGroups, group)
+		}
+	}
+	LdapSCIMEnabled = ldapSec.Key("scim_enabled").MustBool(false)
+	LdapEndpointRateLimits = cfg.readRateLimits(ldapSec, "endpoint_rate_limits")
+	LdapMaxResults = ldapSec.Key("max_results").MustInt(1000)
+	LdapRecordFile = ldapSec.Key("record_file").String()
+	LdapFaultInjection = ldapSec.Key("fault_injection").String()
+	LdapMonitoringDashboard = ldapSec.Key("monitoring_dashboard").MustBool(false)
+	// separated by semicolons, the DNs have commas
+	LdapSyncProtectedUsers = nil
+	for _, user := range strings.Split(ldapSec.Key("sync_protected_users").String(), ";") {
+		if user = strings.TrimSpace(user); user != "" {
+			LdapSyncProtectedUsers = append(LdapSyncProtectedUsers, user)
+		}
+	}
+	LdapSyncProtectedOrgIds = cfg.readOrgIds(ldapSec, "sync_protected_org_ids")
+	LdapDisableMissingUsers = ldapSec.Key("disable_missing_users").MustBool(false)
+	LdapDisableGracePeriod = ldapSec.Key("disable_grace_period").MustDuration(72 * time.Hour)
+	LdapDeleteDisabledAfterDays = ldapSec.Key("delete_disabled_users_after_days").MustInt(0)
+	LdapSyncWorkers = ldapSec.Key("sync_workers").MustInt(4)
+	LdapSyncBatchSize = ldapSec.Key("sync_batch_size").MustInt(500)
+	LdapSyncRetryBackoff = ldapSec.Key("sync_retry_backoff").MustDuration(5 * time.Minute)
+	LdapSyncRetryMaxBackoff = ldapSec.Key("sync_retry_max_backoff").MustDuration(24 * time.Hour)
+	LdapSyncPacingLatency = ldapSec.Key("sync_pacing_latency").MustDuration(time.Second)
+	LdapSyncPacingMaxDelay = ldapSec.Key("sync_pacing_max_delay").MustDuration(30 * time.Second)
+	LdapStrictOrgRemoval = ldapSec.Key("strict_org_removal").MustBool(false)
+	LdapOrgRemovalExemptOrgIds = cfg.readOrgIds(ldapSec, "org_removal_exempt_org_ids")
+	LdapTeamSyncManualRemovals = ldapSec.Key("team_sync_manual_removals").In("override", []string{"override", "respect"})
+	LdapGroupWatchInterval = ldapSec.Key("group_watch_interval").MustDuration(0)
+	LdapCheckMappedGroups = ldapSec.Key("check_mapped_groups").MustBool(true)
+	LdapGenericLoginErrors = ldapSec.Key("generic_login_errors").MustBool(false)
+	LdapLoginDeadline = ldapSec.Key("login_deadline").MustDuration(0)
+	LdapServiceConnection = ldapSec.Key("service_connection").MustBool(true)
+	LdapServiceConnectionCheckInterval = ldapSec.Key("service_connection_check_interval").MustDuration(time.Minute)
+	LdapLoginErrorMessages = map[string]string{}
+	for _, key := range cfg.Raw.Section("auth.ldap.login_error_messages").Keys() {
+		LdapLoginErrorMessages[key.Name()] = key.String()
+	}
+}
+
+// ldapRateLimitEndpoints are the LDAP endpoints endpoint_rate_limits can limit
+var ldapRateLimitEndpoints = []string{"scim", "diagnostics", "servers", "login_attempts", "sync_report", "config"}
+
+// readRateLimits reads the comma or space separated endpoint:limit pairs
+// of the key, ignoring the invalid ones
+func (cfg *Cfg) readRateLimits(section *ini.Section, key string) map[string]int {
+	limits := map[string]int{}
+	for _, pair := range util.SplitString(section.Key(key).String()) {
+		parts := strings.SplitN(pair, ":", 2)
+		if len(parts) != 2 || !isLdapRateLimitEndpoint(parts[0]) {
+			cfg.Logger.Warn("Ignoring the invalid endpoint of "+key, "endpoint", pair, "endpoints", ldapRateLimitEndpoints)
+			continue
+		}
+		limit, err := strconv.Atoi(parts[1])
+		if err != nil {
+			cfg.Logger.Warn("Ignoring the invalid limit of "+key, "endpoint", pair)
+			continue
+		}
+		limits[parts[0]] = limit
+	}
+	return limits
+}
+
+func isLdapRateLimitEndpoint(endpoint string) bool {
+	for _, known := range ldapRateLimitEndpoints {
+		if endpoint == known {
+			return true
+		}
+	}
+	return false
+}
+
+// readOrgIds reads the comma or space separated org ids of the key,
+// ignoring the invalid ones
+func (cfg *Cfg) readOrgIds(section *ini.Section, key string) []int64 {
+	var orgIds []int64
+	for _, orgId := range util.SplitString(section.Key(key).String()) {
+		id, err := strconv.ParseInt(orgId, 10, 64)
+		if err != nil {
+			cfg.Logger.Warn("Ignoring the invalid org id of "+key, "orgId", orgId)
+			continue
+		}
+		orgIds = append(orgIds, id)
+	}
+	return orgIds
 }
 
 func (cfg *Cfg) readSessionConfig() {
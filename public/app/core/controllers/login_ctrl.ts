@@ -110,6 +110,7 @@ export class LoginCtrl {
 
       backendSrv
         .post('/login', $scope.formModel)
+        .then($scope.waitForLogin)
         .then((result: any) => {
           $scope.result = result;
 
@@ -122,9 +123,22 @@ export class LoginCtrl {
         })
         .catch(() => {
           $scope.loggingIn = false;
+          $scope.loginPending = false;
         });
     };
 
+    // a login still verified by the directory after the login_deadline is polled until it completes
+    $scope.waitForLogin = (result: any): any => {
+      if (!result.pendingLogin) {
+        return result;
+      }
+      if (!$scope.loginPending) {
+        $scope.loginPending = true;
+        $scope.appEvent('alert-warning', ['Logging in', result.message]);
+      }
+      return backendSrv.get('/login/pending/' + result.pendingLogin).then($scope.waitForLogin);
+    };
+
     $scope.toGrafana = () => {
       const params = $location.search();
 